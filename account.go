@@ -4,11 +4,13 @@ import (
 	"crypto"
 	"encoding/json"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
 
 	"github.com/xenolf/lego/acme"
 	"github.com/xenolf/lego/log"
+	"github.com/xenolf/lego/registration/storage"
 )
 
 // Account represents a users local saved credentials
@@ -22,73 +24,98 @@ type Account struct {
 
 // NewAccount creates a new account for an email address
 func NewAccount(email string, conf *Configuration) *Account {
-	accKeysPath := conf.AccountKeysPath(email)
-	// TODO: move to function in configuration?
-	accKeyPath := filepath.Join(accKeysPath, email+".key")
-	if err := checkFolder(accKeysPath); err != nil {
-		log.Fatalf("Could not check/create directory for account %s: %v", email, err)
+	flatPath := filepath.Join(conf.context.GlobalString("path"), "accounts", email)
+	serverURL, _ := url.Parse(conf.context.GlobalString("server"))
+	migrated, err := migrateFlatAccount(flatPath, conf.AccountPath(email), email, serverURL.Host)
+	if err != nil {
+		log.Fatalf("Could not copy the account %s from %s: %v", email, flatPath, err)
+	}
+	if migrated {
+		log.Printf("Copied the account %s from %s to %s, the former files are kept.", email, flatPath, conf.AccountPath(email))
 	}
 
-	var privKey crypto.PrivateKey
-	if _, err := os.Stat(accKeyPath); os.IsNotExist(err) {
+	stored, created, err := storage.LoadOrCreateAccount(conf.AccountStorage(), conf.context.GlobalString("server"), email)
+	if err != nil {
+		log.Fatalf("Could not load account %s: %v", email, err)
+	}
+	if created {
+		log.Printf("No key found for account %s. Generated a curve P384 EC key, saved to %s", email, conf.AccountKeyPath(email))
+	}
 
-		log.Printf("No key found for account %s. Generating a curve P384 EC key.", email)
-		privKey, err = generatePrivateKey(accKeyPath)
+	acc := Account{Email: email, key: stored.Key, Registration: stored.Registration, conf: conf}
+	if acc.Registration == nil {
+		// the account is registered by the command.
+		return &acc
+	}
+
+	if acc.Registration.Body.Status == "" {
+		reg, err := tryRecoverAccount(acc.key, conf)
 		if err != nil {
-			log.Fatalf("Could not generate RSA private account key for account %s: %v", email, err)
+			log.Fatalf("Could not load account for %s. Registration is nil -> %#v", email, err)
 		}
 
-		log.Printf("Saved key to %s", accKeyPath)
-	} else {
-		privKey, err = loadPrivateKey(accKeyPath)
+		acc.Registration = reg
+		err = acc.Save()
 		if err != nil {
-			log.Fatalf("Could not load RSA private key from file %s: %v", accKeyPath, err)
+			log.Fatalf("Could not save account for %s. Registration is nil -> %#v", email, err)
 		}
 	}
 
-	accountFile := filepath.Join(conf.AccountPath(email), "account.json")
-	if _, err := os.Stat(accountFile); os.IsNotExist(err) {
-		return &Account{Email: email, key: privKey, conf: conf}
+	return &acc
+}
+
+// migrateFlatAccount copies the account of the flat layout, accounts/<email>/, to accountPath,
+// the directory of the account for its server, if it was registered with serverHost
+// and accountPath does not hold an account yet.
+// It returns true if the account was copied.
+func migrateFlatAccount(flatPath, accountPath, email, serverHost string) (bool, error) {
+	keyFile := filepath.Join("keys", email+".key")
+	if _, err := os.Stat(filepath.Join(accountPath, keyFile)); err == nil {
+		return false, nil
 	}
 
-	fileBytes, err := ioutil.ReadFile(accountFile)
+	accountBytes, err := ioutil.ReadFile(filepath.Join(flatPath, "account.json"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
 	if err != nil {
-		log.Fatalf("Could not load file for account %s -> %v", email, err)
+		return false, err
 	}
 
 	var acc Account
-	err = json.Unmarshal(fileBytes, &acc)
-	if err != nil {
-		log.Fatalf("Could not parse file for account %s -> %v", email, err)
+	if err = json.Unmarshal(accountBytes, &acc); err != nil {
+		return false, err
+	}
+	if acc.Registration == nil {
+		return false, nil
 	}
 
-	acc.key = privKey
-	acc.conf = conf
-
-	if acc.Registration == nil || acc.Registration.Body.Status == "" {
-		reg, err := tryRecoverAccount(privKey, conf)
-		if err != nil {
-			log.Fatalf("Could not load account for %s. Registration is nil -> %#v", email, err)
-		}
-
-		acc.Registration = reg
-		err = acc.Save()
-		if err != nil {
-			log.Fatalf("Could not save account for %s. Registration is nil -> %#v", email, err)
-		}
+	// an account registered with another server is not usable with this one.
+	if regURL, err := url.Parse(acc.Registration.URI); err != nil || regURL.Host != serverHost {
+		return false, nil
 	}
 
-	if acc.conf == nil {
-		log.Fatalf("Could not load account for %s. Configuration is nil.", email)
+	keyBytes, err := ioutil.ReadFile(filepath.Join(flatPath, keyFile))
+	if err != nil {
+		return false, err
 	}
 
-	return &acc
+	if err = checkFolder(filepath.Join(accountPath, "keys")); err != nil {
+		return false, err
+	}
+	if err = ioutil.WriteFile(filepath.Join(accountPath, keyFile), keyBytes, 0600); err != nil {
+		return false, err
+	}
+	if err = ioutil.WriteFile(filepath.Join(accountPath, "account.json"), accountBytes, 0600); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 func tryRecoverAccount(privKey crypto.PrivateKey, conf *Configuration) (*acme.RegistrationResource, error) {
 	// couldn't load account but got a key. Try to look the account up.
 	serverURL := conf.context.GlobalString("server")
-	client, err := acme.NewClient(serverURL, &Account{key: privKey, conf: conf}, acme.RSA2048)
+	client, err := acme.NewClientWithOptions(serverURL, &Account{key: privKey, conf: conf}, conf.ClientOptions(acme.RSA2048)...)
 	if err != nil {
 		return nil, err
 	}
@@ -119,16 +146,10 @@ func (a *Account) GetRegistration() *acme.RegistrationResource {
 
 /** End **/
 
-// Save the account to disk
+// Save the account to its storage, to disk by default
 func (a *Account) Save() error {
-	jsonBytes, err := json.MarshalIndent(a, "", "\t")
-	if err != nil {
-		return err
-	}
-
-	return ioutil.WriteFile(
-		filepath.Join(a.conf.AccountPath(a.Email), "account.json"),
-		jsonBytes,
-		0600,
+	return a.conf.AccountStorage().SaveAccount(
+		a.conf.context.GlobalString("server"),
+		&storage.Account{Email: a.Email, Registration: a.Registration, Key: a.key},
 	)
 }
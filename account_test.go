@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateFlatAccount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	email := "foo@example.com"
+	flatPath := filepath.Join(dir, "accounts", email)
+	if err = os.MkdirAll(filepath.Join(flatPath, "keys"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	accountJSON := `{"email": "foo@example.com", "registration": {"uri": "https://acme-v02.api.letsencrypt.org/acme/acct/1"}}`
+	if err = ioutil.WriteFile(filepath.Join(flatPath, "account.json"), []byte(accountJSON), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(flatPath, "keys", email+".key"), []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// an account of another server is not copied.
+	stagingPath := filepath.Join(dir, "accounts", "acme-staging-v02.api.letsencrypt.org", email)
+	migrated, err := migrateFlatAccount(flatPath, stagingPath, email, "acme-staging-v02.api.letsencrypt.org")
+	if err != nil || migrated {
+		t.Fatalf("Expected the account not to be copied, got %t, %v", migrated, err)
+	}
+
+	accountPath := filepath.Join(dir, "accounts", "acme-v02.api.letsencrypt.org", email)
+	migrated, err = migrateFlatAccount(flatPath, accountPath, email, "acme-v02.api.letsencrypt.org")
+	if err != nil || !migrated {
+		t.Fatalf("Expected the account to be copied, got %t, %v", migrated, err)
+	}
+
+	for _, file := range []string{"account.json", filepath.Join("keys", email+".key")} {
+		if _, err = os.Stat(filepath.Join(accountPath, file)); err != nil {
+			t.Errorf("Expected %s to be copied: %v", file, err)
+		}
+		if _, err = os.Stat(filepath.Join(flatPath, file)); err != nil {
+			t.Errorf("Expected %s to be kept: %v", file, err)
+		}
+	}
+
+	// a migrated account is not copied again.
+	migrated, err = migrateFlatAccount(flatPath, accountPath, email, "acme-v02.api.letsencrypt.org")
+	if err != nil || migrated {
+		t.Errorf("Expected the account to be copied once, got %t, %v", migrated, err)
+	}
+}
@@ -0,0 +1,198 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBulkAttempts is the number of times ObtainCertificates attempts to obtain a rate limited certificate.
+const maxBulkAttempts = 3
+
+// CertRequest is a certificate to obtain with ObtainCertificates,
+// the arguments being those of ObtainCertificateWithOptions.
+type CertRequest struct {
+	Domains    []string
+	Bundle     bool
+	PrivateKey crypto.PrivateKey
+	MustStaple bool
+	Options    OrderOptions
+}
+
+// CertResult is the outcome of a CertRequest.
+type CertResult struct {
+	Request CertRequest
+	// Certificate is the certificate obtained, nil if Err is set.
+	Certificate *CertificateResource
+	// Err is the error of the last attempt, as returned by ObtainCertificateWithOptions
+	// (e.g. a RateLimitError or an ObtainError), or the error of the context.
+	Err error
+	// Attempts is the number of times the certificate was attempted to be obtained.
+	Attempts int
+}
+
+// ObtainCertificates obtains the certificates of the requests with concurrency workers (1 if less),
+// and returns their results in the order of the requests.
+//
+// The orders are created one at a time. If the CA rate limits a request,
+// every worker waits until the time advertised by the CA before creating its next order,
+// and the request is attempted again, up to 3 times.
+// The requests sharing domains are not obtained concurrently,
+// so that the later ones reuse the authorizations validated for the former ones.
+func (c *Client) ObtainCertificates(ctx context.Context, requests []CertRequest, concurrency int) []CertResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]CertResult, len(requests))
+	b := &bulk{client: c, inUse: make(map[string]bool)}
+	b.cond = sync.NewCond(&b.mu)
+
+	// waking up the workers waiting for domains, once the context is done.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			b.mu.Lock()
+			b.cond.Broadcast()
+			b.mu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results[index] = b.obtain(ctx, requests[index])
+			}
+		}()
+	}
+
+	for index := range requests {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// bulk is the state shared by the workers of ObtainCertificates.
+type bulk struct {
+	client *Client
+
+	// mu protects inUse and pauseUntil, cond is signaled when they change.
+	mu   sync.Mutex
+	cond *sync.Cond
+	// inUse are the domains of the certificates being obtained.
+	inUse map[string]bool
+	// pauseUntil is the time until which no order is created, once rate limited.
+	pauseUntil time.Time
+}
+
+// obtain obtains the certificate of the request, attempting it again if it is rate limited.
+func (b *bulk) obtain(ctx context.Context, request CertRequest) CertResult {
+	result := CertResult{Request: request}
+
+	if err := b.acquire(ctx, request.Domains); err != nil {
+		result.Err = err
+		return result
+	}
+	defer b.release(request.Domains)
+
+	for result.Attempts < maxBulkAttempts {
+		if err := b.wait(ctx); err != nil {
+			if result.Err == nil {
+				result.Err = err
+			}
+			return result
+		}
+
+		result.Attempts++
+		result.Certificate, result.Err = b.client.ObtainCertificateWithOptions(ctx, request.Domains, request.Bundle, request.PrivateKey, request.MustStaple, request.Options)
+
+		var rateLimitErr RateLimitError
+		if result.Err == nil || !errors.As(result.Err, &rateLimitErr) || rateLimitErr.RetryAfter.IsZero() {
+			return result
+		}
+
+		b.client.logger().Warnf("[%s] acme: Rate limited, retrying after %s", strings.Join(request.Domains, ", "), rateLimitErr.RetryAfter.Format(time.RFC3339))
+		b.pause(rateLimitErr.RetryAfter)
+	}
+	return result
+}
+
+// acquire waits until none of the domains is in use by another worker, and marks them in use.
+func (b *bulk) acquire(ctx context.Context, domains []string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for b.anyInUse(domains) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		b.cond.Wait()
+	}
+	for _, domain := range domains {
+		b.inUse[domain] = true
+	}
+	return nil
+}
+
+func (b *bulk) anyInUse(domains []string) bool {
+	for _, domain := range domains {
+		if b.inUse[domain] {
+			return true
+		}
+	}
+	return false
+}
+
+// release marks the domains as not in use anymore.
+func (b *bulk) release(domains []string) {
+	b.mu.Lock()
+	for _, domain := range domains {
+		delete(b.inUse, domain)
+	}
+	b.cond.Broadcast()
+	b.mu.Unlock()
+}
+
+// pause delays the creation of the orders of every worker until retryAfter.
+func (b *bulk) pause(retryAfter time.Time) {
+	b.mu.Lock()
+	if retryAfter.After(b.pauseUntil) {
+		b.pauseUntil = retryAfter
+	}
+	b.mu.Unlock()
+}
+
+// wait waits until the orders can be created again, or the context is done.
+func (b *bulk) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		wait := time.Until(b.pauseUntil)
+		b.mu.Unlock()
+
+		// another worker may have been rate limited again meanwhile.
+		if wait <= 0 {
+			return ctx.Err()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestObtainCertificates(t *testing.T) {
+	defer func(f PreCheckFunc) { PreCheckDNS = f }(PreCheckDNS)
+	PreCheckDNS = func(fqdn, value string) (bool, error) { return true, nil }
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	// the stub server rate limits the first new order, and validates every challenge but those of invalid.example.com.
+	var mu sync.Mutex
+	var newOrders, ordering, maxOrdering int
+	validated := map[string]bool{}
+	solved := map[string]int{}
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+
+		parts := strings.Split(r.URL.Path, "/")
+		domain := parts[len(parts)-1]
+
+		switch {
+		case r.URL.Path == "/directory":
+			writeJSONResponse(w, directory{
+				NewNonceURL:   ts.URL + "/nonce",
+				NewAccountURL: ts.URL + "/account",
+				NewOrderURL:   ts.URL + "/newOrder",
+				RevokeCertURL: ts.URL + "/revokeCert",
+				KeyChangeURL:  ts.URL + "/keyChange",
+			})
+		case r.URL.Path == "/nonce":
+		case r.URL.Path == "/newOrder":
+			mu.Lock()
+			newOrders++
+			first := newOrders == 1
+			ordering++
+			if ordering > maxOrdering {
+				maxOrdering = ordering
+			}
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				ordering--
+				mu.Unlock()
+			}()
+			time.Sleep(10 * time.Millisecond)
+
+			if first {
+				w.Header().Set("Retry-After", "1")
+				w.Header().Set("Content-Type", "application/problem+json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(`{"type":"urn:ietf:params:acme:error:rateLimited","detail":"Too many new orders"}`))
+				return
+			}
+
+			body := readJWSPayload(t, r)
+			var order orderMessage
+			if err := json.Unmarshal(body, &order); err != nil {
+				http.Error(w, "invalid order", http.StatusBadRequest)
+				return
+			}
+			for _, identifier := range order.Identifiers {
+				order.Authorizations = append(order.Authorizations, ts.URL+"/authz/"+identifier.Value)
+			}
+			order.Status = "pending"
+			order.Finalize = ts.URL + "/finalize/" + order.Identifiers[0].Value
+			w.Header().Set("Location", ts.URL+"/order/"+order.Identifiers[0].Value)
+			w.WriteHeader(http.StatusCreated)
+			writeJSONResponse(w, order)
+		case strings.HasPrefix(r.URL.Path, "/authz/") && r.Method == http.MethodPost:
+			writeJSONResponse(w, authorization{Status: "deactivated"})
+		case strings.HasPrefix(r.URL.Path, "/authz/"):
+			status := "pending"
+			mu.Lock()
+			if validated[domain] {
+				status = "valid"
+			}
+			mu.Unlock()
+			writeJSONResponse(w, authorization{
+				Status:     status,
+				Identifier: Identifier{Type: "dns", Value: domain},
+				Challenges: []challenge{{Type: string(DNS01), URL: ts.URL + "/chlg/" + domain, Token: "token"}},
+			})
+		case r.URL.Path == "/chlg/invalid.example.com":
+			writeJSONResponse(w, challenge{Type: string(DNS01), Status: "invalid", Error: RemoteError{Type: "urn:ietf:params:acme:error:unauthorized", Detail: "no TXT record"}})
+		case strings.HasPrefix(r.URL.Path, "/chlg/"):
+			mu.Lock()
+			validated[domain] = true
+			solved[domain]++
+			mu.Unlock()
+			writeJSONResponse(w, challenge{Type: string(DNS01), Status: "valid"})
+		case strings.HasPrefix(r.URL.Path, "/finalize/"):
+			writeJSONResponse(w, orderMessage{Status: "valid", Certificate: ts.URL + "/cert/" + domain})
+		case strings.HasPrefix(r.URL.Path, "/cert/"):
+			cert, err := generatePemCert(key, domain, nil)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Write(cert)
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     &RegistrationResource{URI: ts.URL + "/account/1"},
+		privatekey: key,
+	}
+
+	client, err := NewClient(ts.URL+"/directory", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	if err = client.SetChallengeProvider(DNS01, nopProviderMock{}); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := []CertRequest{
+		{Domains: []string{"a.example.com"}, PrivateKey: key},
+		{Domains: []string{"b.example.com", "a.example.com"}, PrivateKey: key},
+		{Domains: []string{"c.example.com"}, PrivateKey: key},
+		{Domains: []string{"invalid.example.com"}, PrivateKey: key},
+	}
+	results := client.ObtainCertificates(context.Background(), requests, 3)
+
+	if len(results) != len(requests) {
+		t.Fatalf("Expected %d results, got %d", len(requests), len(results))
+	}
+	for i, result := range results[:3] {
+		if result.Err != nil {
+			t.Errorf("%v: %v", requests[i].Domains, result.Err)
+			continue
+		}
+		if result.Certificate.Domain != requests[i].Domains[0] {
+			t.Errorf("Expected the certificate of %s, got %s", requests[i].Domains[0], result.Certificate.Domain)
+		}
+	}
+
+	// the challenge failure is typed, and not attempted again.
+	if _, ok := results[3].Err.(ObtainError); !ok || results[3].Attempts != 1 {
+		t.Errorf("Expected a failed attempt for invalid.example.com, got %d attempts (%v)", results[3].Attempts, results[3].Err)
+	}
+
+	var attempts int
+	for _, result := range results {
+		attempts += result.Attempts
+	}
+	if attempts != len(requests)+1 {
+		t.Errorf("Expected the rate limited request to be attempted again, got %d attempts", attempts)
+	}
+
+	if maxOrdering != 1 {
+		t.Errorf("Expected the orders to be created one at a time, got %d at once", maxOrdering)
+	}
+	for domain, count := range solved {
+		if count != 1 {
+			t.Errorf("Expected the authorization of %s to be reused, got %d challenges solved", domain, count)
+		}
+	}
+}
+
+// readJWSPayload returns the payload of the JWS request.
+func readJWSPayload(t *testing.T, r *http.Request) []byte {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Errorf("Could not read JWS: %v", err)
+		return nil
+	}
+	sig, err := jose.ParseSigned(string(body))
+	if err != nil {
+		t.Errorf("Could not parse JWS: %v", err)
+		return nil
+	}
+	return sig.UnsafePayloadWithoutVerification()
+}
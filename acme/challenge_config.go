@@ -0,0 +1,80 @@
+package acme
+
+// ChallengeConfig is a snapshot of the challenge configuration of a client, see Client.ChallengeConfig.
+// Changing it does not change the configuration of the client.
+type ChallengeConfig struct {
+	// Providers are the providers of the challenges with a solver, by challenge.
+	// The dns-01 challenge has no provider here if only SetDNSProviderForDomain was called.
+	Providers map[Challenge]ChallengeProvider
+
+	// DNSProviders are the dns-01 providers by domain, set by SetDNSProviderForDomain.
+	DNSProviders map[string]ChallengeProvider
+
+	// Preferences are the challenges to attempt by identifier, set by SetChallengePreference.
+	Preferences map[string][]Challenge
+
+	// Order is the order of the challenges of the identifiers without preference, set by SetChallengeOrder.
+	Order []Challenge
+}
+
+// ChallengeConfig returns a snapshot of the challenge configuration of the client,
+// e.g. to log it or to check which providers are set.
+func (c *Client) ChallengeConfig() ChallengeConfig {
+	setup := c.challengeSetup()
+
+	config := ChallengeConfig{
+		Providers:    make(map[Challenge]ChallengeProvider),
+		DNSProviders: make(map[string]ChallengeProvider),
+		Preferences:  make(map[string][]Challenge, len(setup.preferences)),
+		Order:        append([]Challenge(nil), setup.order...),
+	}
+	for domain, challenges := range setup.preferences {
+		config.Preferences[domain] = append([]Challenge(nil), challenges...)
+	}
+	for challenge, s := range setup.solvers {
+		var provider ChallengeProvider
+		switch chlng := s.(type) {
+		case *httpChallenge:
+			provider = chlng.provider
+		case *dnsChallenge:
+			provider = chlng.provider
+			for domain, p := range chlng.providers {
+				config.DNSProviders[domain] = p
+			}
+		case *tlsALPNChallenge:
+			provider = chlng.provider
+		}
+		if provider != nil {
+			config.Providers[challenge] = provider
+		}
+	}
+	return config
+}
+
+// challengeSetup are the solvers and the challenge preferences used to solve the challenges of an order,
+// copied from the client when the order starts, so that the order is not affected by the later changes.
+type challengeSetup struct {
+	solvers     map[Challenge]solver
+	preferences map[string][]Challenge
+	order       []Challenge
+}
+
+// challengeSetup returns a copy of the current solvers and challenge preferences of the client.
+// The solvers themselves are never modified once set, they are replaced.
+func (c *Client) challengeSetup() challengeSetup {
+	c.solversMu.RLock()
+	defer c.solversMu.RUnlock()
+
+	setup := challengeSetup{
+		solvers:     make(map[Challenge]solver, len(c.solvers)),
+		preferences: make(map[string][]Challenge, len(c.challengePreferences)),
+		order:       c.challengeOrder,
+	}
+	for challenge, s := range c.solvers {
+		setup.solvers[challenge] = s
+	}
+	for domain, challenges := range c.challengePreferences {
+		setup.preferences[domain] = challenges
+	}
+	return setup
+}
@@ -0,0 +1,178 @@
+package acme
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// namedProviderMock records the domains presented by every provider, by name.
+type namedProviderMock struct {
+	name      string
+	mu        *sync.Mutex
+	presented map[string]string
+	onPresent func()
+}
+
+func (p namedProviderMock) Present(domain, token, keyAuth string) error {
+	p.mu.Lock()
+	p.presented[domain] = p.name
+	p.mu.Unlock()
+	if p.onPresent != nil {
+		p.onPresent()
+	}
+	return nil
+}
+
+func (p namedProviderMock) CleanUp(domain, token, keyAuth string) error { return nil }
+
+func TestSwapChallengeProvidersConcurrently(t *testing.T) {
+	defer func(f PreCheckFunc) { PreCheckDNS = f }(PreCheckDNS)
+	PreCheckDNS = func(fqdn, value string) (bool, error) { return true, nil }
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	// the stub server orders the identifiers of the request, and validates every challenge.
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+
+		parts := strings.Split(r.URL.Path, "/")
+		domain := parts[len(parts)-1]
+
+		switch {
+		case r.URL.Path == "/directory":
+			writeJSONResponse(w, directory{
+				NewNonceURL:   ts.URL + "/nonce",
+				NewAccountURL: ts.URL + "/account",
+				NewOrderURL:   ts.URL + "/newOrder",
+				RevokeCertURL: ts.URL + "/revokeCert",
+				KeyChangeURL:  ts.URL + "/keyChange",
+			})
+		case r.URL.Path == "/nonce":
+		case r.URL.Path == "/newOrder":
+			var order orderMessage
+			if err := json.Unmarshal(readJWSPayload(t, r), &order); err != nil {
+				http.Error(w, "invalid order", http.StatusBadRequest)
+				return
+			}
+			for _, identifier := range order.Identifiers {
+				order.Authorizations = append(order.Authorizations, ts.URL+"/authz/"+identifier.Value)
+			}
+			order.Status = "pending"
+			order.Finalize = ts.URL + "/finalize/" + order.Identifiers[0].Value
+			w.Header().Set("Location", ts.URL+"/order/"+order.Identifiers[0].Value)
+			w.WriteHeader(http.StatusCreated)
+			writeJSONResponse(w, order)
+		case strings.HasPrefix(r.URL.Path, "/authz/") && r.Method == http.MethodPost:
+			writeJSONResponse(w, authorization{Status: "deactivated"})
+		case strings.HasPrefix(r.URL.Path, "/authz/"):
+			writeJSONResponse(w, authorization{
+				Status:     "pending",
+				Identifier: Identifier{Type: "dns", Value: domain},
+				Challenges: []challenge{{Type: string(DNS01), URL: ts.URL + "/chlg/" + domain, Token: "token"}},
+			})
+		case strings.HasPrefix(r.URL.Path, "/chlg/"):
+			writeJSONResponse(w, challenge{Type: string(DNS01), Status: "valid"})
+		case strings.HasPrefix(r.URL.Path, "/finalize/"):
+			writeJSONResponse(w, orderMessage{Status: "valid", Certificate: ts.URL + "/cert/" + domain})
+		case strings.HasPrefix(r.URL.Path, "/cert/"):
+			cert, err := generatePemCert(key, domain, nil)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Write(cert)
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     &RegistrationResource{URI: ts.URL + "/account/1"},
+		privatekey: key,
+	}
+	client, err := NewClient(ts.URL+"/directory", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	client.ExcludeChallenges([]Challenge{HTTP01, TLSALPN01})
+
+	var mu sync.Mutex
+	presented := map[string]string{}
+	provider := func(name string) namedProviderMock {
+		return namedProviderMock{name: name, mu: &mu, presented: presented}
+	}
+
+	// the first provider is replaced while the challenges of its order are presented:
+	// the order keeps it for all its domains.
+	first := provider("first")
+	first.onPresent = func() { client.SetChallengeProvider(DNS01, provider("second")) }
+	if err = client.SetChallengeProvider(DNS01, first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.ObtainCertificate([]string{"a.example.com", "b.example.com"}, false, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if presented["a.example.com"] != "first" || presented["b.example.com"] != "first" {
+		t.Errorf("Expected the order to keep its provider, got %v", presented)
+	}
+	if p, ok := client.ChallengeConfig().Providers[DNS01].(namedProviderMock); !ok || p.name != "second" {
+		t.Errorf("Expected the second provider in the configuration, got %v", client.ChallengeConfig().Providers)
+	}
+
+	// the providers are swapped while certificates are obtained.
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			client.SetChallengeProvider(DNS01, provider(fmt.Sprintf("provider%d", i)))
+			client.SetDNSProviderForDomain("d.example.com", provider(fmt.Sprintf("domain%d", i)))
+			client.SetChallengePreference("c.example.com", []Challenge{DNS01})
+			client.ChallengeConfig()
+		}
+	}()
+
+	var obtained sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		obtained.Add(1)
+		go func(i int) {
+			defer obtained.Done()
+			domains := []string{fmt.Sprintf("c%d.example.com", i), fmt.Sprintf("%d.d.example.com", i)}
+			if _, err := client.ObtainCertificate(domains, false, nil, false); err != nil {
+				t.Errorf("%v: %v", domains, err)
+			}
+		}(i)
+	}
+	obtained.Wait()
+	close(stop)
+	wg.Wait()
+
+	// the removed challenge is not attempted anymore.
+	client.RemoveChallengeProvider(DNS01)
+	config := client.ChallengeConfig()
+	if _, ok := config.Providers[DNS01]; ok || len(config.DNSProviders) != 0 {
+		t.Errorf("Expected no dns-01 provider, got %v and %v", config.Providers, config.DNSProviders)
+	}
+	if _, err = client.ObtainCertificate([]string{"e.example.com"}, false, nil, false); err == nil {
+		t.Error("Expected an error without solver")
+	}
+}
@@ -0,0 +1,168 @@
+package acme
+
+import (
+	"context"
+	"time"
+)
+
+// ChallengeMetrics are the durations and the outcome of a challenge,
+// reported to the ChallengeObserver once the challenge is done.
+type ChallengeMetrics struct {
+	Type   Challenge
+	Domain string
+	// Provider is the provider which presented the challenge.
+	Provider ChallengeProvider
+
+	// Present is the time the provider took to present the challenge.
+	Present time.Duration
+	// Propagation is the time waited for the TXT record to propagate, for the dns-01 challenges.
+	Propagation time.Duration
+	// Validation is the time the CA took to validate the challenge.
+	Validation time.Duration
+
+	// Err is the error of the challenge, nil if the CA validated it.
+	Err error
+}
+
+// ChallengeObserver receives the metrics of the challenges,
+// e.g. to export them to a monitoring system.
+// ObserveChallenge is called by the goroutine solving the challenge, possibly concurrently.
+type ChallengeObserver interface {
+	ObserveChallenge(metrics ChallengeMetrics)
+}
+
+// SetChallengeObserver sets the observer receiving the metrics of the challenges, nil to disable it.
+// Without observer, nothing is measured.
+func (c *Client) SetChallengeObserver(observer ChallengeObserver) {
+	c.observer = observer
+}
+
+// challengePhase is a measured phase of a challenge.
+type challengePhase int
+
+const (
+	phasePresent challengePhase = iota
+	phasePropagation
+	phaseValidation
+)
+
+// challengeRecord measures a challenge for the observer, and sends its events.
+// A nil challengeRecord measures nothing, so that the solvers do not check whether an observer or events are set.
+type challengeRecord struct {
+	observer ChallengeObserver
+	metrics  ChallengeMetrics
+
+	events Events
+	event  ChallengeEvent
+}
+
+type challengeRecordKey struct{}
+
+// newChallengeRecord returns the record of the challenge solved by item, nil without observer and events.
+func (c *Client) newChallengeRecord(item *selectedAuthSolver) *challengeRecord {
+	if c.observer == nil && c.events == nil {
+		return nil
+	}
+
+	domain := item.authz.Identifier.Value
+	chlng := item.authz.Challenges[item.challengeIndex]
+	return &challengeRecord{
+		observer: c.observer,
+		metrics: ChallengeMetrics{
+			Type:     Challenge(chlng.Type),
+			Domain:   domain,
+			Provider: solverProvider(item.solver, domain),
+		},
+		events: c.events,
+		event: ChallengeEvent{
+			Domain:           domain,
+			Type:             Challenge(chlng.Type),
+			URL:              chlng.URL,
+			AuthorizationURL: item.authz.url,
+		},
+	}
+}
+
+// solverProvider returns the provider of the solver for the domain.
+func solverProvider(s solver, domain string) ChallengeProvider {
+	switch s := s.(type) {
+	case *dnsChallenge:
+		return s.providerFor(domain)
+	case *httpChallenge:
+		return s.provider
+	case *tlsALPNChallenge:
+		return s.provider
+	default:
+		return nil
+	}
+}
+
+// withChallengeRecord returns a context carrying the record to the solver.
+func withChallengeRecord(ctx context.Context, r *challengeRecord) context.Context {
+	if r == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, challengeRecordKey{}, r)
+}
+
+// challengeRecordFrom returns the record carried by the context, nil if none.
+func challengeRecordFrom(ctx context.Context) *challengeRecord {
+	r, _ := ctx.Value(challengeRecordKey{}).(*challengeRecord)
+	return r
+}
+
+// start returns the start of a phase, the zero time without record.
+func (r *challengeRecord) start() time.Time {
+	if r == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// end adds the time elapsed since start to the phase.
+func (r *challengeRecord) end(phase challengePhase, start time.Time) {
+	if r == nil {
+		return
+	}
+
+	elapsed := time.Since(start)
+	switch phase {
+	case phasePresent:
+		r.metrics.Present += elapsed
+	case phasePropagation:
+		r.metrics.Propagation += elapsed
+	case phaseValidation:
+		r.metrics.Validation += elapsed
+	}
+}
+
+// presented sends the event of the challenge presented by the provider.
+func (r *challengeRecord) presented() {
+	if r == nil || r.events == nil {
+		return
+	}
+	r.events.ChallengePresented(r.event)
+}
+
+// done reports the metrics of the challenge with its error, and sends its event.
+func (r *challengeRecord) done(err error) {
+	if r == nil {
+		return
+	}
+
+	if r.observer != nil {
+		r.metrics.Err = err
+		r.observer.ObserveChallenge(r.metrics)
+	}
+
+	if r.events == nil {
+		return
+	}
+	if err != nil {
+		event := r.event
+		event.Err = err
+		r.events.ChallengeFailed(event)
+		return
+	}
+	r.events.ChallengeValidated(r.event)
+}
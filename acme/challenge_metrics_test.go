@@ -0,0 +1,89 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type observerMock struct {
+	mu      sync.Mutex
+	metrics []ChallengeMetrics
+}
+
+func (o *observerMock) ObserveChallenge(metrics ChallengeMetrics) {
+	o.mu.Lock()
+	o.metrics = append(o.metrics, metrics)
+	o.mu.Unlock()
+}
+
+type slowProviderMock struct{}
+
+func (slowProviderMock) Present(domain, token, keyAuth string) error {
+	time.Sleep(10 * time.Millisecond)
+	return nil
+}
+
+func (slowProviderMock) CleanUp(domain, token, keyAuth string) error { return nil }
+
+func TestChallengeObserver(t *testing.T) {
+	defer func(f PreCheckFunc) { PreCheckDNS = f }(PreCheckDNS)
+	PreCheckDNS = func(fqdn, value string) (bool, error) {
+		time.Sleep(10 * time.Millisecond)
+		return true, nil
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 512)
+	j := &jws{privKey: privKey}
+
+	provider := slowProviderMock{}
+	client := &Client{jws: j, solvers: map[Challenge]solver{
+		DNS01: &dnsChallenge{
+			jws: j,
+			validate: func(ctx context.Context, j *jws, domain, uri string, chlng challenge) error {
+				time.Sleep(10 * time.Millisecond)
+				if domain == "invalid.example.com" {
+					return errors.New("unauthorized")
+				}
+				return nil
+			},
+			provider: provider,
+		},
+	}}
+
+	observer := &observerMock{}
+	client.SetChallengeObserver(observer)
+
+	var authorizations []authorization
+	for _, domain := range []string{"example.com", "invalid.example.com"} {
+		authorizations = append(authorizations, authorization{
+			Status:     "pending",
+			Identifier: Identifier{Type: "dns", Value: domain},
+			Challenges: []challenge{{Type: string(DNS01), Token: "token-" + domain}},
+		})
+	}
+
+	if err := client.solveChallengeForAuthz(context.Background(), client.challengeSetup(), authorizations); err == nil {
+		t.Fatal("Expected the challenge of invalid.example.com to fail")
+	}
+
+	if len(observer.metrics) != 2 {
+		t.Fatalf("Expected the metrics of 2 challenges, got %d", len(observer.metrics))
+	}
+	for _, metrics := range observer.metrics {
+		if metrics.Type != DNS01 || metrics.Provider != provider {
+			t.Errorf("Expected the dns-01 challenge of the provider, got %s with %v", metrics.Type, metrics.Provider)
+		}
+		if metrics.Present < 10*time.Millisecond || metrics.Propagation < 10*time.Millisecond || metrics.Validation < 10*time.Millisecond {
+			t.Errorf("[%s] Expected every phase to last at least 10ms, got %+v", metrics.Domain, metrics)
+		}
+
+		if failed := metrics.Err != nil; failed != (metrics.Domain == "invalid.example.com") {
+			t.Errorf("[%s] Unexpected error: %v", metrics.Domain, metrics.Err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package acme
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// challengeServerShutdownTimeout bounds the wait for the in-flight validation requests
+	// when a challenge server is closed.
+	challengeServerShutdownTimeout = 2 * time.Second
+
+	// challengeServerIdleTimeout is how long a challenge server without challenge keeps its listener,
+	// so that the next challenges of the run do not have to bind the port again.
+	challengeServerIdleTimeout = 5 * time.Second
+)
+
+// challengeServer is the web server of a provider serving the challenges itself,
+// shared by the challenges presented concurrently.
+type challengeServer struct {
+	server *http.Server
+	done   chan struct{}
+}
+
+// startChallengeServer serves the requests of the listener with handler until shutdown.
+func startChallengeServer(listener net.Listener, handler http.Handler) *challengeServer {
+	s := &challengeServer{
+		server: &http.Server{Handler: handler},
+		done:   make(chan struct{}),
+	}
+	// Once the server is shut down we don't want any lingering
+	// connections, so disable KeepAlives.
+	s.server.SetKeepAlivesEnabled(false)
+
+	go func() {
+		s.server.Serve(listener)
+		close(s.done)
+	}()
+	return s
+}
+
+// shutdown closes the listener, and waits for the in-flight requests for at most challengeServerShutdownTimeout.
+func (s *challengeServer) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), challengeServerShutdownTimeout)
+	defer cancel()
+
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		// the requests still in flight are interrupted.
+		s.server.Close()
+	}
+	<-s.done
+	return err
+}
+
+// listenTCP listens on the address with SO_REUSEADDR,
+// so that the port can be bound again while the connections of a previous server are in TIME_WAIT.
+func listenTCP(address string) (net.Listener, error) {
+	lc := net.ListenConfig{Control: reuseAddr}
+	return lc.Listen(context.Background(), "tcp", address)
+}
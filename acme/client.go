@@ -2,20 +2,26 @@
 package acme
 
 import (
+	"context"
 	"crypto"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
-	"encoding/pem"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/http"
+	"os"
 	"regexp"
-	"strconv"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/xenolf/lego/log"
+	"github.com/xenolf/lego/platform/wait"
 )
 
 const (
@@ -38,7 +44,7 @@ type User interface {
 
 // Interface for all challenge solvers to implement.
 type solver interface {
-	Solve(challenge challenge, domain string) error
+	Solve(ctx context.Context, challenge challenge, domain string) error
 }
 
 // Interface for challenges like dns, where we can set a record in advance for ALL challenges.
@@ -52,30 +58,100 @@ type cleanup interface {
 	CleanUp(challenge challenge, domain string) error
 }
 
-type validateFunc func(j *jws, domain, uri string, chlng challenge) error
+type validateFunc func(ctx context.Context, j *jws, domain, uri string, chlng challenge) error
 
 // Client is the user-friendy way to ACME
+//
+// A client is safe for concurrent use: several certificates can be obtained, renewed and revoked
+// from different goroutines, sharing the directory, the account and the pool of nonces.
+// SetChallengeProvider, RemoveChallengeProvider, SetDNSProviderForDomain, ExcludeChallenges, SetChallengePreference,
+// SetChallengeOrder and the other challenge setters may be called at any time, and apply to the orders started after the call:
+// the orders in progress keep the providers and the preferences of when they started.
+// The other setters and the account management (Register, ResolveAccountByKey, ChangeAccountKey,
+// DeactivateAccount) must not be called while other requests are in progress.
 type Client struct {
 	directory directory
 	user      User
 	jws       *jws
+	sender    *sender
 	keyType   KeyType
+
+	// solversMu protects solvers, dnsProviders, challengePreferences and challengeOrder.
+	solversMu sync.RWMutex
 	solvers   map[Challenge]solver
+
+	// dnsProviders are the dns-01 providers by domain, see SetDNSProviderForDomain.
+	dnsProviders map[string]ChallengeProvider
+
+	alwaysDeactivateAuthorizations bool
+
+	// dnsRequireAllNameservers is set by SetDNSRequireAllNameservers.
+	dnsRequireAllNameservers bool
+
+	// dnsResolvers are the recursive nameservers set by WithDNSResolvers, RecursiveNameservers if nil.
+	dnsResolvers []string
+
+	// challengePreferences are the challenges to attempt, by identifier.
+	challengePreferences map[string][]Challenge
+
+	// challengeOrder is the order in which the challenges are attempted
+	// for the identifiers without preference.
+	challengeOrder []Challenge
+
+	tosCallback TOSCallback
+
+	// observer receives the metrics of the challenges, see SetChallengeObserver.
+	observer ChallengeObserver
+
+	// events receives the events of the lifecycle of the certificates, see SetEvents.
+	events Events
+
+	// newOrderMu serializes the creation of the orders,
+	// the CA limiting the number of new orders per account.
+	newOrderMu sync.Mutex
 }
 
+// TOSCallback is called with the URL of the TOS when the user must agree to it.
+// The user agrees to the TOS if it returns true.
+type TOSCallback func(tosURL string) bool
+
 // NewClient creates a new ACME client on behalf of the user. The client will depend on
 // the ACME directory located at caDirURL for the rest of its actions.  A private
 // key of type keyType (see KeyType contants) will be generated when requesting a new
 // certificate if one isn't provided.
 func NewClient(caDirURL string, user User, keyType KeyType) (*Client, error) {
+	return NewClientWithOptions(caDirURL, user, WithKeyType(keyType))
+}
+
+// NewClientWithHTTPClient is like NewClient, but all the requests to the ACME server,
+// including the directory discovery, are sent using the given HTTP client.
+// If httpClient is nil, HTTPClient is used.
+func NewClientWithHTTPClient(caDirURL string, user User, keyType KeyType, httpClient *http.Client) (*Client, error) {
+	return NewClientWithOptions(caDirURL, user, WithKeyType(keyType), WithHTTPClient(httpClient))
+}
+
+// NewClientWithOptions creates a new ACME client on behalf of the user, as NewClient,
+// configured by the options.
+// The settings of the options are stored on the client: clients created with different
+// options, e.g. WithDNSResolvers, are independent within a process.
+func NewClientWithOptions(caDirURL string, user User, opts ...ClientOption) (*Client, error) {
+	options := clientOptions{keyType: RSA2048}
+	for _, opt := range opts {
+		if err := opt(&options); err != nil {
+			return nil, err
+		}
+	}
+
 	privKey := user.GetPrivateKey()
 	if privKey == nil {
 		return nil, errors.New("private key was nil")
 	}
 
+	s := &sender{client: options.httpClient, userAgentProduct: options.userAgent, leveledLogger: options.logger}
+
 	var dir directory
-	if _, err := getJSON(caDirURL, &dir); err != nil {
-		return nil, fmt.Errorf("get directory at '%s': %v", caDirURL, err)
+	if _, err := s.getJSON(context.Background(), caDirURL, &dir); err != nil {
+		return nil, fmt.Errorf("get directory at '%s': %w", caDirURL, err)
 	}
 
 	if dir.NewAccountURL == "" {
@@ -85,7 +161,7 @@ func NewClient(caDirURL string, user User, keyType KeyType) (*Client, error) {
 		return nil, errors.New("directory missing new order URL")
 	}
 
-	jws := &jws{privKey: privKey, getNonceURL: dir.NewNonceURL}
+	jws := &jws{sender: s, privKey: privKey, getNonceURL: dir.NewNonceURL}
 	if reg := user.GetRegistration(); reg != nil {
 		jws.kid = reg.URI
 	}
@@ -98,16 +174,26 @@ func NewClient(caDirURL string, user User, keyType KeyType) (*Client, error) {
 		TLSALPN01: &tlsALPNChallenge{jws: jws, validate: validate, provider: &TLSALPNProviderServer{}},
 	}
 
-	return &Client{directory: dir, user: user, jws: jws, keyType: keyType, solvers: solvers}, nil
+	return &Client{directory: dir, user: user, jws: jws, sender: s, keyType: options.keyType, solvers: solvers,
+		dnsResolvers: options.resolvers}, nil
+}
+
+// logger returns the logger of the client, set by WithLogger.
+func (c *Client) logger() log.LeveledLogger {
+	return c.sender.logger()
 }
 
 // SetChallengeProvider specifies a custom provider p that can solve the given challenge type.
 func (c *Client) SetChallengeProvider(challenge Challenge, p ChallengeProvider) error {
+	c.solversMu.Lock()
+	defer c.solversMu.Unlock()
+
 	switch challenge {
 	case HTTP01:
 		c.solvers[challenge] = &httpChallenge{jws: c.jws, validate: validate, provider: p}
 	case DNS01:
-		c.solvers[challenge] = &dnsChallenge{jws: c.jws, validate: validate, provider: p}
+		c.solvers[challenge] = &dnsChallenge{jws: c.jws, validate: validate, provider: p, providers: c.dnsProviders,
+			requireAllNameservers: c.dnsRequireAllNameservers, resolvers: c.dnsResolvers}
 	case TLSALPN01:
 		c.solvers[challenge] = &tlsALPNChallenge{jws: c.jws, validate: validate, provider: p}
 	default:
@@ -116,9 +202,78 @@ func (c *Client) SetChallengeProvider(challenge Challenge, p ChallengeProvider)
 	return nil
 }
 
+// SetDNSProviderForDomain sets the provider presenting the dns-01 challenges of the domain and of its subdomains,
+// instead of the provider set by SetChallengeProvider, which remains the one of the other domains.
+// The provider of the closest parent domain is used if several match.
+// It adds the dns-01 solver if needed.
+func (c *Client) SetDNSProviderForDomain(domain string, p ChallengeProvider) {
+	c.solversMu.Lock()
+	defer c.solversMu.Unlock()
+
+	// the providers are copied, as the solvers chosen before the call keep using the previous ones.
+	providers := make(map[string]ChallengeProvider, len(c.dnsProviders)+1)
+	for name, provider := range c.dnsProviders {
+		providers[name] = provider
+	}
+	providers[strings.TrimSuffix(strings.ToLower(strings.TrimPrefix(domain, "*.")), ".")] = p
+	c.dnsProviders = providers
+
+	var defaultProvider ChallengeProvider
+	if solver, ok := c.solvers[DNS01].(*dnsChallenge); ok {
+		defaultProvider = solver.provider
+	}
+	c.solvers[DNS01] = &dnsChallenge{jws: c.jws, validate: validate, provider: defaultProvider, providers: providers,
+		requireAllNameservers: c.dnsRequireAllNameservers, resolvers: c.dnsResolvers}
+}
+
+// SetDNSRequireAllNameservers makes the dns-01 propagation check query every IPv4 and IPv6 address
+// of every authoritative nameserver of the zone, and wait until all of them serve the TXT record,
+// as a CA validating from several network perspectives may reach any of them.
+// The unreachable nameservers are retried until the propagation timeout,
+// and are ignored then if all the others serve the record.
+// The addresses without route from this host, e.g. the IPv4 addresses on an IPv6-only host, are not queried.
+// The error of the check lists the status of every address.
+// It does not apply to the providers with a PreCheck method, nor with DNS01DisableCompletePropagationRequirement.
+func (c *Client) SetDNSRequireAllNameservers(require bool) {
+	c.solversMu.Lock()
+	defer c.solversMu.Unlock()
+
+	c.dnsRequireAllNameservers = require
+	if solver, ok := c.solvers[DNS01].(*dnsChallenge); ok {
+		// the solvers chosen before the call keep the previous setting.
+		copied := *solver
+		copied.requireAllNameservers = require
+		c.solvers[DNS01] = &copied
+	}
+}
+
+// SetUserAgentSuffix appends the given product token (e.g. "myproduct/2.3")
+// to the User-Agent string in all the requests of the client.
+func (c *Client) SetUserAgentSuffix(suffix string) {
+	c.sender.userAgentSuffix = strings.TrimSpace(suffix)
+}
+
+// SetAlwaysDeactivateAuthorizations makes the client deactivate the authorizations
+// of an order after issuing its certificate. They are always deactivated
+// when the order fails.
+func (c *Client) SetAlwaysDeactivateAuthorizations(always bool) {
+	c.alwaysDeactivateAuthorizations = always
+}
+
+// SetRateLimitRetryBudget allows to retry the requests that the server rate limits,
+// waiting for the time advertised in the Retry-After header,
+// as long as the total wait for a request stays within budget.
+// By default, the requests are not retried and a RateLimitError is returned,
+// so that callers can schedule a retry themselves.
+func (c *Client) SetRateLimitRetryBudget(budget time.Duration) {
+	c.sender.rateLimitBudget = budget
+}
+
 // SetHTTPAddress specifies a custom interface:port to be used for HTTP based challenges.
 // If this option is not used, the default port 80 and all interfaces will be used.
 // To only specify a port and no interface use the ":port" notation.
+// The CA still connects to the port 80 of the domain: a custom port is meant
+// to be used behind a port forwarding or a reverse proxy.
 //
 // NOTE: This REPLACES any custom HTTP provider previously set by calling
 // c.SetChallengeProvider with the default HTTP challenge provider.
@@ -128,16 +283,121 @@ func (c *Client) SetHTTPAddress(iface string) error {
 		return err
 	}
 
-	if chlng, ok := c.solvers[HTTP01]; ok {
-		chlng.(*httpChallenge).provider = NewHTTPProviderServer(host, port)
+	c.solversMu.Lock()
+	defer c.solversMu.Unlock()
+
+	if chlng, ok := c.solvers[HTTP01].(*httpChallenge); ok {
+		copied := *chlng
+		copied.provider = NewHTTPProviderServer(host, port)
+		c.solvers[HTTP01] = &copied
+	}
+
+	return nil
+}
+
+// SetHTTPSocket specifies a UNIX socket to be used for HTTP based challenges instead of a TCP port,
+// created with the permissions mode (0666 if zero) and removed once the challenges are done.
+// It is meant to be used behind a reverse proxy forwarding the requests of `HTTP01ChallengePath("")` to the socket.
+//
+// NOTE: This REPLACES any custom HTTP provider previously set by calling
+// c.SetChallengeProvider with the default HTTP challenge provider.
+func (c *Client) SetHTTPSocket(path string, mode os.FileMode) error {
+	if path == "" {
+		return errors.New("acme: the path of the HTTP socket is empty")
+	}
+
+	c.solversMu.Lock()
+	defer c.solversMu.Unlock()
+
+	if chlng, ok := c.solvers[HTTP01].(*httpChallenge); ok {
+		copied := *chlng
+		copied.provider = NewUnixProviderServer(path, mode)
+		c.solvers[HTTP01] = &copied
 	}
 
 	return nil
 }
 
+// HTTPChallengeHandler makes the HTTP based challenges answered by the returned handler,
+// to be mounted in the web server of the caller already listening on the port 80, instead of a server started by lego.
+// The requests of `HTTP01ChallengePath(token)` for the presented challenges are answered from memory,
+// and the others are passed to next (a 404 Not Found is returned if next is nil).
+// The tokens are removed once their challenges are validated.
+//
+// NOTE: This REPLACES any custom HTTP provider previously set by calling
+// c.SetChallengeProvider with an HTTPProviderHandler.
+func (c *Client) HTTPChallengeHandler(next http.Handler) http.Handler {
+	handler := NewHTTPProviderHandler(next)
+
+	c.solversMu.Lock()
+	defer c.solversMu.Unlock()
+
+	c.solvers[HTTP01] = &httpChallenge{jws: c.jws, validate: validate, provider: handler}
+
+	return handler
+}
+
+// SetHTTPProxyHeader sets the header matched against the domains of the HTTP based challenges instead of the Host header,
+// e.g. X-Forwarded-Host behind a reverse proxy rewriting the Host header.
+// It applies to the default HTTP provider, set with SetHTTPAddress or SetHTTPSocket, or to the handler of HTTPChallengeHandler,
+// which must be called first.
+func (c *Client) SetHTTPProxyHeader(name string) error {
+	c.solversMu.Lock()
+	defer c.solversMu.Unlock()
+
+	chlng, ok := c.solvers[HTTP01]
+	if !ok {
+		return nil
+	}
+	switch provider := chlng.(*httpChallenge).provider.(type) {
+	case *HTTPProviderServer:
+		provider.SetProxyHeader(name)
+	case *HTTPProviderHandler:
+		provider.SetProxyHeader(name)
+	default:
+		return errors.New("acme: the proxy header only applies to the default HTTP provider")
+	}
+
+	return nil
+}
+
+// SetTLSChallengeStore makes the TLS based challenges answered by the GetCertificate callback of a TLS server
+// of the caller, already listening on the port 443, instead of a server started by lego:
+// the callback returns the certificate of TLSChallengeCert if found.
+// The server must add ACMETLS1Protocol to the NextProtos of its tls.Config.
+//
+// NOTE: This REPLACES any custom TLS-ALPN provider previously set by calling
+// c.SetChallengeProvider with a TLSALPNProviderStore.
+func (c *Client) SetTLSChallengeStore() {
+	c.solversMu.Lock()
+	defer c.solversMu.Unlock()
+
+	c.solvers[TLSALPN01] = &tlsALPNChallenge{jws: c.jws, validate: validate, provider: NewTLSALPNProviderStore()}
+}
+
+// TLSChallengeCert returns the challenge certificate of a TLS based challenge for the connection of the CA,
+// following the rules of TLSALPNProviderStore.GetCertificate, and false for the other connections.
+// It requires SetTLSChallengeStore, or a TLSALPNProviderStore set with SetChallengeProvider.
+func (c *Client) TLSChallengeCert(clientHello *tls.ClientHelloInfo) (*tls.Certificate, bool) {
+	c.solversMu.RLock()
+	chlng, ok := c.solvers[TLSALPN01].(*tlsALPNChallenge)
+	c.solversMu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	store, ok := chlng.provider.(*TLSALPNProviderStore)
+	if !ok {
+		return nil, false
+	}
+	return store.GetCertificate(clientHello)
+}
+
 // SetTLSAddress specifies a custom interface:port to be used for TLS based challenges.
 // If this option is not used, the default port 443 and all interfaces will be used.
 // To only specify a port and no interface use the ":port" notation.
+// The CA still connects to the port 443 of the domain: a custom port is meant
+// to be used behind a port forwarding or a TLS passthrough proxy.
 //
 // NOTE: This REPLACES any custom TLS-ALPN provider previously set by calling
 // c.SetChallengeProvider with the default TLS-ALPN challenge provider.
@@ -147,36 +407,167 @@ func (c *Client) SetTLSAddress(iface string) error {
 		return err
 	}
 
-	if chlng, ok := c.solvers[TLSALPN01]; ok {
-		chlng.(*tlsALPNChallenge).provider = NewTLSALPNProviderServer(host, port)
+	c.solversMu.Lock()
+	defer c.solversMu.Unlock()
+
+	if chlng, ok := c.solvers[TLSALPN01].(*tlsALPNChallenge); ok {
+		copied := *chlng
+		copied.provider = NewTLSALPNProviderServer(host, port)
+		c.solvers[TLSALPN01] = &copied
 	}
 	return nil
 }
 
 // ExcludeChallenges explicitly removes challenges from the pool for solving.
 func (c *Client) ExcludeChallenges(challenges []Challenge) {
+	c.solversMu.Lock()
+	defer c.solversMu.Unlock()
+
 	// Loop through all challenges and delete the requested one if found.
 	for _, challenge := range challenges {
 		delete(c.solvers, challenge)
 	}
 }
 
+// RemoveChallengeProvider removes the solver of the challenge, which is not attempted anymore
+// by the orders started after the call. For dns-01, the providers set by SetDNSProviderForDomain are removed too.
+func (c *Client) RemoveChallengeProvider(challenge Challenge) {
+	c.solversMu.Lock()
+	defer c.solversMu.Unlock()
+
+	delete(c.solvers, challenge)
+	if challenge == DNS01 {
+		c.dnsProviders = nil
+	}
+}
+
+// SetChallengePreference sets the challenges to attempt, in order of preference,
+// for the authorization of the given identifier (the domain without the "*." of a wildcard).
+// The other challenges are not attempted for this identifier.
+// The challenges must have a solver: the excluded challenges are never attempted.
+// The identifiers without preference use any challenge with a solver.
+func (c *Client) SetChallengePreference(domain string, challenges []Challenge) {
+	c.solversMu.Lock()
+	defer c.solversMu.Unlock()
+
+	if c.challengePreferences == nil {
+		c.challengePreferences = make(map[string][]Challenge)
+	}
+	c.challengePreferences[strings.ToLower(domain)] = challenges
+}
+
+// SetChallengeOrder sets the order in which the challenges are attempted
+// for the identifiers without preference set by SetChallengePreference.
+// The challenges offered by the server and missing from the list are attempted last, in the order of the server.
+// By default, the challenges are attempted in the order of the server.
+//
+// When a challenge fails, the next one is attempted if the server keeps the authorization pending.
+func (c *Client) SetChallengeOrder(challenges []Challenge) {
+	c.solversMu.Lock()
+	defer c.solversMu.Unlock()
+
+	c.challengeOrder = challenges
+}
+
 // GetToSURL returns the current ToS URL from the Directory
 func (c *Client) GetToSURL() string {
 	return c.directory.Meta.TermsOfService
 }
 
+// GetDirectoryMeta returns the metadata of the Directory:
+// the ToS URL, the website, the CAA identities, the External Account Binding requirement and the issuance profiles.
+func (c *Client) GetDirectoryMeta() DirectoryMeta {
+	meta := c.directory.Meta
+	meta.CaaIdentities = append([]string(nil), meta.CaaIdentities...)
+	return meta
+}
+
+// DefaultMaxIdentifiers is the maximum number of identifiers of an order
+// if the CA does not advertise it, the limit of Let's Encrypt.
+const DefaultMaxIdentifiers = 100
+
+// MaxIdentifiers returns the maximum number of identifiers of an order:
+// the MaxIdentifiers of the directory meta if advertised, DefaultMaxIdentifiers otherwise.
+func (c *Client) MaxIdentifiers() int {
+	if c.directory.Meta.MaxIdentifiers > 0 {
+		return c.directory.Meta.MaxIdentifiers
+	}
+	return DefaultMaxIdentifiers
+}
+
 // GetExternalAccountRequired returns the External Account Binding requirement of the Directory
 func (c *Client) GetExternalAccountRequired() bool {
 	return c.directory.Meta.ExternalAccountRequired
 }
 
+// SetTOSCallback sets the callback asking the user to agree to the TOS.
+// It is called by RegisterWithTOSCallback, and when the CA requires to agree to new TOS:
+// the account is updated and the request is retried if the callback returns true.
+// The URL of the agreed TOS is stored in the registration resource of the user.
+func (c *Client) SetTOSCallback(callback TOSCallback) {
+	c.tosCallback = callback
+	if callback == nil {
+		c.jws.tosChanged = nil
+		return
+	}
+	c.jws.tosChanged = c.agreeToNewTOS
+}
+
+// RegisterWithTOSCallback registers the current account to the ACME server,
+// asking the callback whether the user agrees to the TOS advertised by the directory.
+// The callback is also used when the CA requires to agree to new TOS, see SetTOSCallback.
+func (c *Client) RegisterWithTOSCallback(callback TOSCallback) (*RegistrationResource, error) {
+	c.SetTOSCallback(callback)
+
+	var tosAgreed bool
+	if tosURL := c.directory.Meta.TermsOfService; tosURL != "" && callback != nil {
+		tosAgreed = callback(tosURL)
+	}
+
+	return c.Register(tosAgreed)
+}
+
+// agreeToNewTOS asks the TOS callback whether the user agrees to the new TOS,
+// and updates the account if so.
+func (c *Client) agreeToNewTOS(ctx context.Context, tosURL string) bool {
+	if tosURL == "" {
+		tosURL = c.directory.Meta.TermsOfService
+	}
+
+	// The account must be registered to be updated.
+	if c.jws.kid == "" || c.tosCallback == nil || !c.tosCallback(tosURL) {
+		return false
+	}
+	c.logger().Infof("acme: Agreeing to the new TOS %s", tosURL)
+
+	jsonBytes, err := json.Marshal(accountMessage{TermsOfServiceAgreed: true})
+	if err != nil {
+		return false
+	}
+
+	// The update is not posted through postJSON, to not ask again if it fails.
+	if _, err := doPostJSON(ctx, c.jws, c.jws.kid, jsonBytes, nil); err != nil {
+		c.logger().Warnf("acme: Could not agree to the new TOS: %v", err)
+		return false
+	}
+
+	if reg := c.user.GetRegistration(); reg != nil {
+		reg.TOSAgreedURL = tosURL
+	}
+	return true
+}
+
 // Register the current account to the ACME server.
+// The URL of the TOS advertised by the directory is stored in the registration resource if tosAgreed is true.
 func (c *Client) Register(tosAgreed bool) (*RegistrationResource, error) {
 	if c == nil || c.user == nil {
 		return nil, errors.New("acme: cannot register a nil client or user")
 	}
-	log.Infof("acme: Registering account for %s", c.user.GetEmail())
+	c.logger().Infof("acme: Registering account for %s", c.user.GetEmail())
+
+	if c.directory.Meta.ExternalAccountRequired {
+		return nil, ExternalAccountRequiredError{}
+	}
 
 	accMsg := accountMessage{}
 	if c.user.GetEmail() != "" {
@@ -187,7 +578,7 @@ func (c *Client) Register(tosAgreed bool) (*RegistrationResource, error) {
 	accMsg.TermsOfServiceAgreed = tosAgreed
 
 	var serverReg accountMessage
-	hdr, err := postJSON(c.jws, c.directory.NewAccountURL, accMsg, &serverReg)
+	hdr, err := postJSON(context.Background(), c.jws, c.directory.NewAccountURL, accMsg, &serverReg)
 	if err != nil {
 		remoteErr, ok := err.(RemoteError)
 		if ok && remoteErr.StatusCode == 409 {
@@ -200,6 +591,9 @@ func (c *Client) Register(tosAgreed bool) (*RegistrationResource, error) {
 		URI:  hdr.Get("Location"),
 		Body: serverReg,
 	}
+	if tosAgreed {
+		reg.TOSAgreedURL = c.directory.Meta.TermsOfService
+	}
 	c.jws.kid = reg.URI
 
 	return reg, nil
@@ -210,7 +604,7 @@ func (c *Client) RegisterWithExternalAccountBinding(tosAgreed bool, kid string,
 	if c == nil || c.user == nil {
 		return nil, errors.New("acme: cannot register a nil client or user")
 	}
-	log.Infof("acme: Registering account (EAB) for %s", c.user.GetEmail())
+	c.logger().Infof("acme: Registering account (EAB) for %s", c.user.GetEmail())
 
 	accMsg := accountMessage{}
 	if c.user.GetEmail() != "" {
@@ -235,7 +629,7 @@ func (c *Client) RegisterWithExternalAccountBinding(tosAgreed bool, kid string,
 	accMsg.ExternalAccountBinding = []byte(eabPayload)
 
 	var serverReg accountMessage
-	hdr, err := postJSON(c.jws, c.directory.NewAccountURL, accMsg, &serverReg)
+	hdr, err := postJSON(context.Background(), c.jws, c.directory.NewAccountURL, accMsg, &serverReg)
 	if err != nil {
 		remoteErr, ok := err.(RemoteError)
 		if ok && remoteErr.StatusCode == 409 {
@@ -248,6 +642,9 @@ func (c *Client) RegisterWithExternalAccountBinding(tosAgreed bool, kid string,
 		URI:  hdr.Get("Location"),
 		Body: serverReg,
 	}
+	if tosAgreed {
+		reg.TOSAgreedURL = c.directory.Meta.TermsOfService
+	}
 	c.jws.kid = reg.URI
 
 	return reg, nil
@@ -256,10 +653,10 @@ func (c *Client) RegisterWithExternalAccountBinding(tosAgreed bool, kid string,
 // ResolveAccountByKey will attempt to look up an account using the given account key
 // and return its registration resource.
 func (c *Client) ResolveAccountByKey() (*RegistrationResource, error) {
-	log.Infof("acme: Trying to resolve account by key")
+	c.logger().Infof("acme: Trying to resolve account by key")
 
 	acc := accountMessage{OnlyReturnExisting: true}
-	hdr, err := postJSON(c.jws, c.directory.NewAccountURL, acc, nil)
+	hdr, err := postJSON(context.Background(), c.jws, c.directory.NewAccountURL, acc, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -271,7 +668,7 @@ func (c *Client) ResolveAccountByKey() (*RegistrationResource, error) {
 
 	var retAccount accountMessage
 	c.jws.kid = accountLink
-	_, err = postJSON(c.jws, accountLink, accountMessage{}, &retAccount)
+	_, err = postJSON(context.Background(), c.jws, accountLink, accountMessage{}, &retAccount)
 	if err != nil {
 		return nil, err
 	}
@@ -281,18 +678,75 @@ func (c *Client) ResolveAccountByKey() (*RegistrationResource, error) {
 
 // DeleteRegistration deletes the client's user registration from the ACME
 // server.
+// It is the same as DeactivateAccount.
 func (c *Client) DeleteRegistration() error {
+	return c.DeactivateAccount()
+}
+
+// DeactivateAccount deactivates the client's user registration on the ACME server.
+// Once deactivated, the account cannot be used anymore, and the client refuses
+// all further requests with ErrAccountDeactivated.
+func (c *Client) DeactivateAccount() error {
 	if c == nil || c.user == nil {
 		return errors.New("acme: cannot unregister a nil client or user")
 	}
-	log.Infof("acme: Deleting account for %s", c.user.GetEmail())
+	if c.user.GetRegistration() == nil || c.user.GetRegistration().URI == "" {
+		return errors.New("acme: cannot deactivate an unregistered account")
+	}
+	c.logger().Infof("acme: Deactivating account for %s", c.user.GetEmail())
 
 	accMsg := accountMessage{
 		Status: "deactivated",
 	}
 
-	_, err := postJSON(c.jws, c.user.GetRegistration().URI, accMsg, nil)
-	return err
+	var retAccount accountMessage
+	_, err := postJSON(context.Background(), c.jws, c.user.GetRegistration().URI, accMsg, &retAccount)
+	if err != nil {
+		return fmt.Errorf("acme: the server refused to deactivate the account: %w", err)
+	}
+
+	if retAccount.Status != "deactivated" {
+		return fmt.Errorf("acme: the server did not deactivate the account, its status is %q", retAccount.Status)
+	}
+
+	c.jws.deactivated = true
+
+	return nil
+}
+
+// ChangeAccountKey replaces the key of the client's user registration with newKey
+// on the ACME server. On success, the client signs all further requests with newKey,
+// which is returned so that the caller can persist it.
+//
+// If newKey is already used by another account, a KeyConflictError is returned.
+func (c *Client) ChangeAccountKey(newKey crypto.PrivateKey) (crypto.PrivateKey, error) {
+	if c == nil || c.user == nil {
+		return nil, errors.New("acme: cannot change the account key of a nil client or user")
+	}
+	if newKey == nil {
+		return nil, errors.New("acme: new account key was nil")
+	}
+	if c.user.GetRegistration() == nil || c.jws.kid == "" {
+		return nil, errors.New("acme: cannot change the key of an unregistered account")
+	}
+	c.logger().Infof("acme: Changing the account key for %s", c.user.GetRegistration().URI)
+
+	inner, err := c.jws.signKeyChange(c.directory.KeyChangeURL, newKey)
+	if err != nil {
+		return nil, err
+	}
+
+	hdr, err := postJSON(context.Background(), c.jws, c.directory.KeyChangeURL, json.RawMessage(inner.FullSerialize()), nil)
+	if err != nil {
+		if remoteErr, ok := err.(RemoteError); ok && remoteErr.StatusCode == http.StatusConflict {
+			return nil, KeyConflictError{RemoteError: remoteErr, AccountURL: hdr.Get("Location")}
+		}
+		return nil, err
+	}
+
+	c.jws.privKey = newKey
+
+	return newKey, nil
 }
 
 // QueryRegistration runs a POST request on the client's registration and
@@ -305,12 +759,12 @@ func (c *Client) QueryRegistration() (*RegistrationResource, error) {
 		return nil, errors.New("acme: cannot query the registration of a nil client or user")
 	}
 	// Log the URL here instead of the email as the email may not be set
-	log.Infof("acme: Querying account for %s", c.user.GetRegistration().URI)
+	c.logger().Infof("acme: Querying account for %s", c.user.GetRegistration().URI)
 
 	accMsg := accountMessage{}
 
 	var serverReg accountMessage
-	_, err := postJSON(c.jws, c.user.GetRegistration().URI, accMsg, &serverReg)
+	_, err := postJSON(context.Background(), c.jws, c.user.GetRegistration().URI, accMsg, &serverReg)
 	if err != nil {
 		return nil, err
 	}
@@ -324,6 +778,55 @@ func (c *Client) QueryRegistration() (*RegistrationResource, error) {
 	return reg, nil
 }
 
+// OrderOptions are the optional parameters of the order of a certificate.
+type OrderOptions struct {
+	// Profile is the issuance profile to request, one of the Profiles of the DirectoryMeta.
+	// The default profile of the CA is used if empty.
+	Profile string
+
+	// NotBefore and NotAfter are the requested validity period of the certificate,
+	// they are not sent if zero. Most CAs, such as Let's Encrypt, reject the orders with a validity period.
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	// Replaces is the CertificateID of the certificate renewed by the order.
+	// It is only sent if the CA supports renewal information (RFC 9773),
+	// and dropped if the CA answers that the certificate was already replaced.
+	Replaces string
+
+	// Key is the source of the private key of the certificate, instead of the private key argument.
+	// A new private key is generated if both are nil. It is not used for the CSR orders.
+	Key KeySource
+
+	// SplitLargeOrders splits the domains exceeding the MaxIdentifiers of the CA into several certificates
+	// with ObtainCertificatesWithOptions, instead of returning a TooManyIdentifiersError.
+	// It is ignored by the functions obtaining a single certificate.
+	SplitLargeOrders bool
+}
+
+// validate checks that the requested validity period is in the future, and not empty.
+func (o OrderOptions) validate(now time.Time) error {
+	if !o.NotBefore.IsZero() && !o.NotBefore.After(now) {
+		return fmt.Errorf("acme: the requested notBefore %s is not in the future", o.NotBefore.Format(time.RFC3339))
+	}
+	if !o.NotAfter.IsZero() && !o.NotAfter.After(now) {
+		return fmt.Errorf("acme: the requested notAfter %s is not in the future", o.NotAfter.Format(time.RFC3339))
+	}
+	if !o.NotBefore.IsZero() && !o.NotAfter.IsZero() && !o.NotAfter.After(o.NotBefore) {
+		return fmt.Errorf("acme: the requested notAfter %s is not after notBefore %s",
+			o.NotAfter.Format(time.RFC3339), o.NotBefore.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// formatOrderTime formats a time of the validity period of an order, the zero time as an empty string.
+func formatOrderTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
 // ObtainCertificateForCSR tries to obtain a certificate matching the CSR passed into it.
 // The domains are inferred from the CommonName and SubjectAltNames, if any. The private key
 // for this CSR is not required.
@@ -332,13 +835,33 @@ func (c *Client) QueryRegistration() (*RegistrationResource, error) {
 // This function will never return a partial certificate. If one domain in the list fails,
 // the whole certificate will fail.
 func (c *Client) ObtainCertificateForCSR(csr x509.CertificateRequest, bundle bool) (*CertificateResource, error) {
+	return c.ObtainCertificateForCSRWithContext(context.Background(), csr, bundle)
+}
+
+// ObtainCertificateForCSRWithContext is like ObtainCertificateForCSR,
+// but aborts the requests and the polling when the context is done.
+func (c *Client) ObtainCertificateForCSRWithContext(ctx context.Context, csr x509.CertificateRequest, bundle bool) (*CertificateResource, error) {
+	return c.ObtainCertificateForCSRWithOptions(ctx, csr, bundle, OrderOptions{})
+}
+
+// ObtainCertificateForCSRWithOptions is like ObtainCertificateForCSRWithContext,
+// but sends the given options with the order.
+func (c *Client) ObtainCertificateForCSRWithOptions(ctx context.Context, csr x509.CertificateRequest, bundle bool, opts OrderOptions) (*CertificateResource, error) {
 	// figure out what domains it concerns
 	// start with the common name
-	domains := []string{csr.Subject.CommonName}
+	var domains []string
+	if csr.Subject.CommonName != "" {
+		domains = append(domains, csr.Subject.CommonName)
+	}
+
+	sanNames := csr.DNSNames
+	for _, ip := range csr.IPAddresses {
+		sanNames = append(sanNames, ip.String())
+	}
 
-	// loop over the SubjectAltName DNS names
+	// loop over the SubjectAltName DNS names and IP addresses
 DNSNames:
-	for _, sanName := range csr.DNSNames {
+	for _, sanName := range sanNames {
 		for _, existingName := range domains {
 			if existingName == sanName {
 				// duplicate; skip this name
@@ -351,43 +874,52 @@ DNSNames:
 	}
 
 	if bundle {
-		log.Infof("[%s] acme: Obtaining bundled SAN certificate given a CSR", strings.Join(domains, ", "))
+		c.logger().Infof("[%s] acme: Obtaining bundled SAN certificate given a CSR", strings.Join(domains, ", "))
 	} else {
-		log.Infof("[%s] acme: Obtaining SAN certificate given a CSR", strings.Join(domains, ", "))
+		c.logger().Infof("[%s] acme: Obtaining SAN certificate given a CSR", strings.Join(domains, ", "))
 	}
 
-	order, err := c.createOrderForIdentifiers(domains)
+	// the order keeps the challenge configuration of when it starts.
+	setup := c.challengeSetup()
+
+	order, err := c.createOrderForIdentifiers(ctx, domains, opts)
 	if err != nil {
 		return nil, err
 	}
-	authz, err := c.getAuthzForOrder(order)
+	authz, err := c.getAuthzForOrder(ctx, order)
 	if err != nil {
 		// If any challenge fails, return. Do not generate partial SAN certificates.
-		/*for _, auth := range authz {
-			c.disableAuthz(auth)
-		}*/
+		c.deactivateAuthorizations(order)
 		return nil, err
 	}
 
-	err = c.solveChallengeForAuthz(authz)
+	err = c.solveChallengeForAuthz(ctx, setup, authz)
 	if err != nil {
 		// If any challenge fails, return. Do not generate partial SAN certificates.
+		c.deactivateAuthorizations(order)
+		c.hintCAA(err)
 		return nil, err
 	}
 
-	log.Infof("[%s] acme: Validations succeeded; requesting certificates", strings.Join(domains, ", "))
+	c.logger().Infof("[%s] acme: Validations succeeded; requesting certificates", strings.Join(domains, ", "))
 
 	failures := make(ObtainError)
-	cert, err := c.requestCertificateForCsr(order, bundle, csr.Raw, nil)
+	cert, err := c.requestCertificateForCsr(ctx, order, bundle, csr.Raw, nil, false)
 	if err != nil {
-		for _, chln := range authz {
-			failures[chln.Identifier.Value] = err
-		}
+		c.hintCAA(err)
+		failures = c.orderFailures(ctx, authz, err)
 	}
 
 	if cert != nil {
-		// Add the CSR to the certificate so that it can be used for renewals.
+		// Add the CSR and the profile to the certificate so that they can be used for renewals.
 		cert.CSR = pemEncode(&csr)
+		order.setOptions(cert, opts)
+		order.setRequest(cert, bundle, hasMustStaple(csr.Extensions))
+		cert.KeyType = publicKeyType(csr.PublicKey)
+	}
+
+	if len(failures) > 0 || c.alwaysDeactivateAuthorizations {
+		c.deactivateAuthorizations(order)
 	}
 
 	// do not return an empty failures map, because
@@ -400,51 +932,89 @@ DNSNames:
 
 // ObtainCertificate tries to obtain a single certificate using all domains passed into it.
 // The first domain in domains is used for the CommonName field of the certificate, all other
-// domains are added using the Subject Alternate Names extension. A new private key is generated
-// for every invocation of this function. If you do not want that you can supply your own private key
+// domains are added using the Subject Alternate Names extension.
+// Internationalized domains are converted to their A-label (punycode) form, see DomainToASCII.
+// A new private key is generated for every invocation of this function. If you do not want that you can supply your own private key
 // in the privKey parameter. If this parameter is non-nil it will be used instead of generating a new one.
+// The key can also be provided by the Key of the options of ObtainCertificateWithOptions, e.g. an ExternalKey.
 // If bundle is true, the []byte contains both the issuer certificate and
 // your issued certificate as a bundle.
 // This function will never return a partial certificate. If one domain in the list fails,
 // the whole certificate will fail.
 func (c *Client) ObtainCertificate(domains []string, bundle bool, privKey crypto.PrivateKey, mustStaple bool) (*CertificateResource, error) {
+	return c.ObtainCertificateWithContext(context.Background(), domains, bundle, privKey, mustStaple)
+}
+
+// ObtainCertificateWithContext is like ObtainCertificate,
+// but aborts the requests and the polling when the context is done.
+func (c *Client) ObtainCertificateWithContext(ctx context.Context, domains []string, bundle bool, privKey crypto.PrivateKey, mustStaple bool) (*CertificateResource, error) {
+	return c.ObtainCertificateWithOptions(ctx, domains, bundle, privKey, mustStaple, OrderOptions{})
+}
+
+// ObtainCertificateWithOptions is like ObtainCertificateWithContext,
+// but sends the given options with the order.
+func (c *Client) ObtainCertificateWithOptions(ctx context.Context, domains []string, bundle bool, privKey crypto.PrivateKey, mustStaple bool, opts OrderOptions) (*CertificateResource, error) {
 	if len(domains) == 0 {
 		return nil, errors.New("No domains to obtain a certificate for")
 	}
 
+	keySource, err := keySourceOf(privKey, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	if bundle {
-		log.Infof("[%s] acme: Obtaining bundled SAN certificate", strings.Join(domains, ", "))
+		c.logger().Infof("[%s] acme: Obtaining bundled SAN certificate", strings.Join(domains, ", "))
 	} else {
-		log.Infof("[%s] acme: Obtaining SAN certificate", strings.Join(domains, ", "))
+		c.logger().Infof("[%s] acme: Obtaining SAN certificate", strings.Join(domains, ", "))
+	}
+
+	// The Unicode domains are converted to their A-label form,
+	// which is also the form of the Domain of the certificate resource.
+	asciiDomains, err := domainsToASCII(domains)
+	if err != nil {
+		return nil, err
 	}
 
-	order, err := c.createOrderForIdentifiers(domains)
+	// the order keeps the challenge configuration of when it starts.
+	setup := c.challengeSetup()
+
+	order, err := c.createOrderForIdentifiers(ctx, asciiDomains, opts)
 	if err != nil {
 		return nil, err
 	}
-	authz, err := c.getAuthzForOrder(order)
+	authz, err := c.getAuthzForOrder(ctx, order)
 	if err != nil {
 		// If any challenge fails, return. Do not generate partial SAN certificates.
-		/*for _, auth := range authz {
-			c.disableAuthz(auth)
-		}*/
+		c.deactivateAuthorizations(order)
 		return nil, err
 	}
 
-	err = c.solveChallengeForAuthz(authz)
+	err = c.solveChallengeForAuthz(ctx, setup, authz)
 	if err != nil {
 		// If any challenge fails, return. Do not generate partial SAN certificates.
+		c.deactivateAuthorizations(order)
+		c.hintCAA(err)
 		return nil, err
 	}
 
-	log.Infof("[%s] acme: Validations succeeded; requesting certificates", strings.Join(domains, ", "))
+	c.logger().Infof("[%s] acme: Validations succeeded; requesting certificates", strings.Join(domains, ", "))
 
 	failures := make(ObtainError)
-	cert, err := c.requestCertificateForOrder(order, bundle, privKey, mustStaple)
+	cert, err := c.requestCertificateForOrder(ctx, order, bundle, keySource, mustStaple)
 	if err != nil {
-		for _, auth := range authz {
-			failures[auth.Identifier.Value] = err
-		}
+		c.hintCAA(err)
+		failures = c.orderFailures(ctx, authz, err)
+	}
+
+	if cert != nil {
+		// Add the profile and the request to the certificate so that they can be used for renewals.
+		order.setOptions(cert, opts)
+		order.setRequest(cert, bundle, mustStaple)
+	}
+
+	if len(failures) > 0 || c.alwaysDeactivateAuthorizations {
+		c.deactivateAuthorizations(order)
 	}
 
 	// do not return an empty failures map, because
@@ -455,9 +1025,84 @@ func (c *Client) ObtainCertificate(domains []string, bundle bool, privKey crypto
 	return cert, nil
 }
 
+// ObtainCertificatesWithOptions is like ObtainCertificateWithOptions, but with the SplitLargeOrders option,
+// the domains exceeding the MaxIdentifiers of the CA are split into several orders, in the order of the domains:
+// the first domain is the CommonName of the first certificate, the first domain of each part the one of its certificate.
+// The private key, if any, is used for every certificate. The certificates are obtained one after the other:
+// those obtained before an error are returned with it, but not the one of the failed order.
+func (c *Client) ObtainCertificatesWithOptions(ctx context.Context, domains []string, bundle bool, privKey crypto.PrivateKey, mustStaple bool, opts OrderOptions) ([]*CertificateResource, error) {
+	if !opts.SplitLargeOrders {
+		cert, err := c.ObtainCertificateWithOptions(ctx, domains, bundle, privKey, mustStaple, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []*CertificateResource{cert}, nil
+	}
+
+	parts := splitDomains(domains, c.MaxIdentifiers())
+	if len(parts) > 1 {
+		c.logger().Infof("[%s] acme: Splitting the %d domains into %d orders of at most %d identifiers",
+			domains[0], len(domains), len(parts), c.MaxIdentifiers())
+	}
+
+	var certs []*CertificateResource
+	for _, part := range parts {
+		cert, err := c.ObtainCertificateWithOptions(ctx, part, bundle, privKey, mustStaple, opts)
+		if err != nil {
+			return certs, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// splitDomains splits the domains into parts of at most max domains, keeping their order.
+func splitDomains(domains []string, max int) [][]string {
+	var parts [][]string
+	for len(domains) > max {
+		parts = append(parts, domains[:max:max])
+		domains = domains[max:]
+	}
+	return append(parts, domains)
+}
+
 // RevokeCertificate takes a PEM encoded certificate or bundle and tries to revoke it at the CA.
 func (c *Client) RevokeCertificate(certificate []byte) error {
-	certificates, err := parsePEMBundle(certificate)
+	return c.revokeCertificate(certificate, nil, c.jws)
+}
+
+// RevokeCertificateWithReason is like RevokeCertificate, but also sends the reason
+// of the revocation, one of the RevocationReason constants.
+func (c *Client) RevokeCertificateWithReason(certificate []byte, reason uint) error {
+	if err := checkRevocationReason(reason); err != nil {
+		return err
+	}
+	return c.revokeCertificate(certificate, &reason, c.jws)
+}
+
+// RevokeCertificateWithKey is like RevokeCertificateWithReason, but the request is signed
+// with the private key of the certificate instead of the account key.
+// It allows to revoke a compromised certificate without the account which requested it.
+func (c *Client) RevokeCertificateWithKey(certificate []byte, reason uint, privKey crypto.PrivateKey) error {
+	if err := checkRevocationReason(reason); err != nil {
+		return err
+	}
+
+	certificates, err := ParsePEMBundle(certificate)
+	if err != nil {
+		return err
+	}
+
+	if err = checkCertificateKey(certificates[0], privKey); err != nil {
+		return err
+	}
+
+	certJWS := &jws{sender: c.sender, privKey: privKey, getNonceURL: c.directory.NewNonceURL}
+	return c.revokeCertificate(certificate, &reason, certJWS)
+}
+
+func (c *Client) revokeCertificate(certificate []byte, reason *uint, j *jws) error {
+	certificates, err := ParsePEMBundle(certificate)
 	if err != nil {
 		return err
 	}
@@ -469,10 +1114,22 @@ func (c *Client) RevokeCertificate(certificate []byte) error {
 
 	encodedCert := base64.URLEncoding.EncodeToString(x509Cert.Raw)
 
-	_, err = postJSON(c.jws, c.directory.RevokeCertURL, revokeCertMessage{Certificate: encodedCert}, nil)
+	_, err = postJSON(context.Background(), j, c.directory.RevokeCertURL, revokeCertMessage{Certificate: encodedCert, Reason: reason}, nil)
 	return err
 }
 
+// checkRevocationReason checks that the reason is one of the RevocationReason constants.
+func checkRevocationReason(reason uint) error {
+	switch reason {
+	case RevocationReasonUnspecified, RevocationReasonKeyCompromise, RevocationReasonCACompromise,
+		RevocationReasonAffiliationChanged, RevocationReasonSuperseded, RevocationReasonCessationOfOperation,
+		RevocationReasonCertificateHold, RevocationReasonRemoveFromCRL, RevocationReasonPrivilegeWithdrawn,
+		RevocationReasonAACompromise:
+		return nil
+	}
+	return fmt.Errorf("acme: invalid revocation reason code: %d", reason)
+}
+
 // RenewCertificate takes a CertificateResource and tries to renew the certificate.
 // If the renewal process succeeds, the new certificate will ge returned in a new CertResource.
 // Please be aware that this function will return a new certificate in ANY case that is not an error.
@@ -481,10 +1138,28 @@ func (c *Client) RevokeCertificate(certificate []byte) error {
 // If bundle is true, the []byte contains both the issuer certificate and
 // your issued certificate as a bundle.
 // For private key reuse the PrivateKey property of the passed in CertificateResource should be non-nil.
+// If its ReuseKey property is set, the renewal fails without PrivateKey rather than generating a new key,
+// and the new CertificateResource has ReuseKey set too.
+// If its ExternalKey property is set, the renewal fails unless the key is given in the Key of the options
+// of RenewCertificateWithOptions.
+// A new private key has the KeyType of the passed in CertificateResource if set, the key type of the client otherwise.
+// The new certificate is requested with the Profile of the passed in CertificateResource.
 func (c *Client) RenewCertificate(cert CertificateResource, bundle, mustStaple bool) (*CertificateResource, error) {
+	return c.RenewCertificateWithContext(context.Background(), cert, bundle, mustStaple)
+}
+
+// RenewCertificateWithContext is like RenewCertificate,
+// but aborts the requests and the polling when the context is done.
+func (c *Client) RenewCertificateWithContext(ctx context.Context, cert CertificateResource, bundle, mustStaple bool) (*CertificateResource, error) {
+	return c.RenewCertificateWithOptions(ctx, cert, bundle, mustStaple, OrderOptions{Profile: cert.Profile})
+}
+
+// RenewCertificateWithOptions is like RenewCertificateWithContext,
+// but sends the given options with the order instead of the Profile of the passed in CertificateResource.
+func (c *Client) RenewCertificateWithOptions(ctx context.Context, cert CertificateResource, bundle, mustStaple bool, opts OrderOptions) (*CertificateResource, error) {
 	// Input certificate is PEM encoded. Decode it here as we may need the decoded
 	// cert later on in the renewal process. The input may be a bundle or a single certificate.
-	certificates, err := parsePEMBundle(cert.Certificate)
+	certificates, err := ParsePEMBundle(cert.Certificate)
 	if err != nil {
 		return nil, err
 	}
@@ -496,7 +1171,7 @@ func (c *Client) RenewCertificate(cert CertificateResource, bundle, mustStaple b
 
 	// This is just meant to be informal for the user.
 	timeLeft := x509Cert.NotAfter.Sub(time.Now().UTC())
-	log.Infof("[%s] acme: Trying renewal with %d hours remaining", cert.Domain, int(timeLeft.Hours()))
+	c.logger().Infof("[%s] acme: Trying renewal with %d hours remaining", cert.Domain, int(timeLeft.Hours()))
 
 	// We always need to request a new certificate to renew.
 	// Start by checking to see if the certificate was based off a CSR, and
@@ -506,50 +1181,90 @@ func (c *Client) RenewCertificate(cert CertificateResource, bundle, mustStaple b
 		if err != nil {
 			return nil, err
 		}
-		newCert, failures := c.ObtainCertificateForCSR(*csr, bundle)
+		newCert, failures := c.ObtainCertificateForCSRWithOptions(ctx, *csr, bundle, opts)
 		return newCert, failures
 	}
 
 	var privKey crypto.PrivateKey
-	if cert.PrivateKey != nil {
+	switch {
+	case opts.Key != nil:
+		// the key is given by the key source.
+	case cert.PrivateKey != nil:
 		privKey, err = parsePEMPrivateKey(cert.PrivateKey)
 		if err != nil {
 			return nil, err
 		}
+	case cert.ReuseKey:
+		return nil, fmt.Errorf("[%s] acme: the private key of the certificate is required to renew it with the same key", cert.Domain)
+	case cert.ExternalKey:
+		return nil, fmt.Errorf("[%s] acme: the key source of the external key of the certificate is required to renew it", cert.Domain)
+	case cert.KeyType != "":
+		opts.Key = generatedKey{keyType: cert.KeyType}
 	}
 
 	var domains []string
-	// check for SAN certificate
-	if len(x509Cert.DNSNames) > 1 {
+	if x509Cert.Subject.CommonName != "" {
 		domains = append(domains, x509Cert.Subject.CommonName)
-		for _, sanDomain := range x509Cert.DNSNames {
-			if sanDomain == x509Cert.Subject.CommonName {
-				continue
-			}
-			domains = append(domains, sanDomain)
+	}
+	// check for SAN certificate
+	for _, sanDomain := range x509Cert.DNSNames {
+		if sanDomain == x509Cert.Subject.CommonName {
+			continue
 		}
-	} else {
-		domains = append(domains, x509Cert.Subject.CommonName)
+		domains = append(domains, sanDomain)
+	}
+	for _, ip := range x509Cert.IPAddresses {
+		domains = append(domains, ip.String())
 	}
 
-	newCert, err := c.ObtainCertificate(domains, bundle, privKey, mustStaple)
+	newCert, err := c.ObtainCertificateWithOptions(ctx, domains, bundle, privKey, mustStaple, opts)
+	if newCert != nil {
+		newCert.ReuseKey = cert.ReuseKey
+	}
 	return newCert, err
 }
 
-func (c *Client) createOrderForIdentifiers(domains []string) (orderResource, error) {
+func (c *Client) createOrderForIdentifiers(ctx context.Context, domains []string, opts OrderOptions) (orderResource, error) {
+	if err := c.checkProfile(opts.Profile); err != nil {
+		return orderResource{}, err
+	}
+	if err := opts.validate(time.Now()); err != nil {
+		return orderResource{}, err
+	}
+	if max := c.MaxIdentifiers(); len(domains) > max {
+		return orderResource{}, TooManyIdentifiersError{Identifiers: len(domains), Max: max}
+	}
 
-	var identifiers []identifier
+	var identifiers []Identifier
 	for _, domain := range domains {
-		identifiers = append(identifiers, identifier{Type: "dns", Value: domain})
+		identifiers = append(identifiers, newIdentifier(domain))
 	}
 
 	order := orderMessage{
 		Identifiers: identifiers,
+		Profile:     opts.Profile,
+		NotBefore:   formatOrderTime(opts.NotBefore),
+		NotAfter:    formatOrderTime(opts.NotAfter),
+	}
+	if c.SupportsRenewalInfo() {
+		order.Replaces = opts.Replaces
 	}
 
 	var response orderMessage
-	hdr, err := postJSON(c.jws, c.directory.NewOrderURL, order, &response)
+	c.newOrderMu.Lock()
+	hdr, err := postJSON(ctx, c.jws, c.directory.NewOrderURL, order, &response)
+	if err != nil && order.Replaces != "" && IsProblemType(err, alreadyReplacedError) {
+		// the certificate can still be renewed by an order replacing no certificate.
+		c.logger().Infof("acme: The certificate %s was already replaced, ordering without replacing it", order.Replaces)
+		order.Replaces = ""
+		hdr, err = postJSON(ctx, c.jws, c.directory.NewOrderURL, order, &response)
+	}
+	c.newOrderMu.Unlock()
 	if err != nil {
+		var problem ProblemDetails
+		if opts.Profile != "" && errors.As(err, &problem) && problem.Type == invalidProfileError {
+			return orderResource{}, InvalidProfileError{RemoteError: problem, Profile: opts.Profile}
+		}
 		return orderResource{}, err
 	}
 
@@ -558,19 +1273,51 @@ func (c *Client) createOrderForIdentifiers(domains []string) (orderResource, err
 		Domains:      domains,
 		orderMessage: response,
 	}
+	c.orderCreated(orderRes)
 	return orderRes, nil
 }
 
+// checkProfile checks that the profile is advertised by the CA, if the CA advertises its profiles.
+func (c *Client) checkProfile(profile string) error {
+	if profile == "" || len(c.directory.Meta.Profiles) == 0 {
+		return nil
+	}
+	if _, ok := c.directory.Meta.Profiles[profile]; ok {
+		return nil
+	}
+
+	var names []string
+	for name := range c.directory.Meta.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("acme: unknown profile %q, the CA advertises: %s", profile, strings.Join(names, ", "))
+}
+
 // an authz with the solver we have chosen and the index of the challenge associated with it
 type selectedAuthSolver struct {
 	authz          authorization
 	challengeIndex int
 	solver         solver
+
+	// fallbacks are the challenges to attempt if the chosen one fails.
+	fallbacks []challengeCandidate
+
+	// record measures the chosen challenge, nil without observer.
+	record *challengeRecord
+}
+
+// challengeCandidate is a challenge of an authorization which can be attempted with a solver.
+type challengeCandidate struct {
+	index  int
+	solver solver
+	// reason explains why the challenge is attempted, for the logs.
+	reason string
 }
 
 // Looks through the challenge combinations to find a solvable match.
 // Then solves the challenges in series and returns.
-func (c *Client) solveChallengeForAuthz(authorizations []authorization) error {
+func (c *Client) solveChallengeForAuthz(ctx context.Context, setup challengeSetup, authorizations []authorization) error {
 	failures := make(ObtainError)
 
 	authSolvers := []*selectedAuthSolver{}
@@ -579,27 +1326,63 @@ func (c *Client) solveChallengeForAuthz(authorizations []authorization) error {
 	for _, authz := range authorizations {
 		if authz.Status == "valid" {
 			// Boulder might recycle recent validated authz (see issue #267)
-			log.Infof("[%s] acme: Authorization already valid; skipping challenge", authz.Identifier.Value)
+			c.logger().Infof("[%s] acme: Authorization already valid; skipping challenge", authz.Identifier.Value)
 			continue
 		}
-		if i, solver := c.chooseSolver(authz, authz.Identifier.Value); solver != nil {
-			authSolvers = append(authSolvers, &selectedAuthSolver{
+		if candidates := c.challengeCandidates(setup, authz, authz.Identifier.Value); len(candidates) > 0 {
+			c.logger().Infof("[%s] acme: Selected the %s challenge (%s)",
+				authz.Identifier.Value, authz.Challenges[candidates[0].index].Type, candidates[0].reason)
+			item := &selectedAuthSolver{
 				authz:          authz,
-				challengeIndex: i,
-				solver:         solver,
-			})
+				challengeIndex: candidates[0].index,
+				solver:         candidates[0].solver,
+				fallbacks:      candidates[1:],
+			}
+			item.record = c.newChallengeRecord(item)
+			authSolvers = append(authSolvers, item)
 		} else {
 			failures[authz.Identifier.Value] = fmt.Errorf("[%s] acme: Could not determine solvers", authz.Identifier.Value)
 		}
 	}
 
+	// challenges relying on a sequential provider are solved one after the other,
+	// all the other challenges are solved in parallel.
+	var parallel, sequential []*selectedAuthSolver
+	for _, item := range authSolvers {
+		if _, ok := sequentialInterval(item.solver, item.authz.Identifier.Value); ok {
+			sequential = append(sequential, item)
+		} else {
+			parallel = append(parallel, item)
+		}
+	}
+
+	c.solveInParallel(ctx, parallel, failures)
+	c.solveSequentially(ctx, sequential, failures)
+	c.solveFallbacks(ctx, authSolvers, failures)
+
+	// be careful not to return an empty failures map, for
+	// even an empty ObtainError is a non-nil error value
+	if len(failures) > 0 {
+		return failures
+	}
+	return nil
+}
+
+// solveInParallel presolves all the challenges before solving them, so the records have max time to propagate.
+func (c *Client) solveInParallel(ctx context.Context, authSolvers []*selectedAuthSolver, failures ObtainError) {
 	// for all valid presolvers, first submit the challenges so they have max time to propigate
 	for _, item := range authSolvers {
 		authz := item.authz
 		i := item.challengeIndex
 		if presolver, ok := item.solver.(presolver); ok {
-			if err := presolver.PreSolve(authz.Challenges[i], authz.Identifier.Value); err != nil {
-				failures[authz.Identifier.Value] = err
+			start := item.record.start()
+			err := presolver.PreSolve(authz.Challenges[i], authz.Identifier.Value)
+			item.record.end(phasePresent, start)
+			if err != nil {
+				failures[authz.Identifier.Value] = challengeFailure(authz.Identifier.Value, authz.Challenges[i], err)
+				item.record.done(failures[authz.Identifier.Value])
+			} else {
+				item.record.presented()
 			}
 		}
 	}
@@ -614,7 +1397,7 @@ func (c *Client) solveChallengeForAuthz(authorizations []authorization) error {
 				}
 				err := cleanup.CleanUp(item.authz.Challenges[item.challengeIndex], item.authz.Identifier.Value)
 				if err != nil {
-					log.Warnf("Error cleaning up %s: %v ", item.authz.Identifier.Value, err)
+					c.logger().Warnf("[%s] acme: Error cleaning up: %v", item.authz.Identifier.Value, err)
 				}
 			}
 		}
@@ -628,32 +1411,206 @@ func (c *Client) solveChallengeForAuthz(authorizations []authorization) error {
 			// already failed in previous loop
 			continue
 		}
-		if err := item.solver.Solve(authz.Challenges[i], authz.Identifier.Value); err != nil {
-			failures[authz.Identifier.Value] = err
+		if err := item.solver.Solve(withChallengeRecord(ctx, item.record), authz.Challenges[i], authz.Identifier.Value); err != nil {
+			failures[authz.Identifier.Value] = challengeFailure(authz.Identifier.Value, authz.Challenges[i], err)
 		}
+		item.record.done(failures[authz.Identifier.Value])
 	}
+}
 
-	// be careful not to return an empty failures map, for
-	// even an empty ObtainError is a non-nil error value
-	if len(failures) > 0 {
-		return failures
+// solveSequentially presents, validates and cleans up the challenges one after the other.
+func (c *Client) solveSequentially(ctx context.Context, authSolvers []*selectedAuthSolver, failures ObtainError) {
+	for i, item := range authSolvers {
+		domain := item.authz.Identifier.Value
+
+		if i > 0 {
+			interval, _ := sequentialInterval(item.solver, domain)
+			c.logger().Infof("[%s] acme: Waiting %s before solving the next sequential challenge", domain, interval)
+			if err := wait.Sleep(ctx, interval); err != nil {
+				failures[domain] = fmt.Errorf("[%s] acme: waiting for the next sequential challenge aborted: %v", domain, err)
+				continue
+			}
+		}
+
+		if err := c.solveChallenge(ctx, item); err != nil {
+			failures[domain] = err
+		}
 	}
-	return nil
+}
+
+// solveChallenge presents, validates and cleans up the chosen challenge of an authorization.
+func (c *Client) solveChallenge(ctx context.Context, item *selectedAuthSolver) error {
+	domain := item.authz.Identifier.Value
+	chlng := item.authz.Challenges[item.challengeIndex]
+
+	if presolver, ok := item.solver.(presolver); ok {
+		start := item.record.start()
+		err := presolver.PreSolve(chlng, domain)
+		item.record.end(phasePresent, start)
+		if err != nil {
+			err = challengeFailure(domain, chlng, err)
+			item.record.done(err)
+			return err
+		}
+		item.record.presented()
+	}
+
+	var solveErr error
+	if err := item.solver.Solve(withChallengeRecord(ctx, item.record), chlng, domain); err != nil {
+		solveErr = challengeFailure(domain, chlng, err)
+	}
+	item.record.done(solveErr)
+
+	if cleanup, ok := item.solver.(cleanup); ok {
+		if err := cleanup.CleanUp(chlng, domain); err != nil {
+			c.logger().Warnf("[%s] acme: Error cleaning up: %v", domain, err)
+		}
+	}
+	return solveErr
+}
+
+// solveFallbacks attempts the next challenges of the authorizations whose chosen challenge failed.
+// Most CAs invalidate the whole authorization when a challenge fails:
+// another challenge is only attempted if the authorization is still pending.
+func (c *Client) solveFallbacks(ctx context.Context, authSolvers []*selectedAuthSolver, failures ObtainError) {
+	for _, item := range authSolvers {
+		domain := item.authz.Identifier.Value
+
+		for failures[domain] != nil && len(item.fallbacks) > 0 && item.authz.url != "" && ctx.Err() == nil {
+			failed := item.authz.Challenges[item.challengeIndex].Type
+
+			var authz authorization
+			if _, err := c.sender.getJSON(ctx, item.authz.url, &authz); err != nil {
+				c.logger().Warnf("[%s] acme: Unable to fetch the authorization after the %s challenge failed: %v", domain, failed, err)
+				break
+			}
+			if authz.Status != "pending" {
+				c.logger().Infof("[%s] acme: The %s challenge failed, the authorization is %s: no other challenge can be attempted", domain, failed, authz.Status)
+				break
+			}
+
+			next := item.fallbacks[0]
+			item.fallbacks = item.fallbacks[1:]
+			chlngType := item.authz.Challenges[next.index].Type
+
+			authz.setURL(item.authz.url)
+			index := -1
+			for i, chlng := range authz.Challenges {
+				if chlng.Type == chlngType {
+					index = i
+					break
+				}
+			}
+			if index < 0 {
+				continue
+			}
+
+			c.logger().Infof("[%s] acme: Selected the %s challenge (the %s challenge failed)", domain, chlngType, failed)
+			item.authz, item.challengeIndex, item.solver = authz, index, next.solver
+			item.record = c.newChallengeRecord(item)
+
+			if err := c.solveChallenge(ctx, item); err != nil {
+				failures[domain] = err
+			} else {
+				delete(failures, domain)
+			}
+		}
+	}
+}
+
+// challengeSupported checks whether the challenge can prove the control of the identifier:
+// the dns-01 challenge is meaningless for IP addresses.
+func challengeSupported(id Identifier, chlng Challenge) bool {
+	return id.Type != "ip" || chlng != DNS01
+}
+
+// hintCAA logs the CAA identities of the CA if the issuance failed because of the CAA records.
+func (c *Client) hintCAA(err error) {
+	if !IsProblemType(err, caaError) {
+		return
+	}
+
+	if len(c.directory.Meta.CaaIdentities) == 0 {
+		c.logger().Warnf("acme: The CAA records of the domain do not allow the CA to issue the certificate")
+		return
+	}
+	c.logger().Warnf("acme: The CAA records of the domain must allow one of %s to issue the certificate",
+		strings.Join(c.directory.Meta.CaaIdentities, ", "))
+}
+
+// challengeFailure reports which challenge was attempted for which identifier when it failed.
+func challengeFailure(domain string, chlng challenge, err error) error {
+	var problem challengeProblem
+	if errors.As(err, &problem) {
+		return ChallengeError{Identifier: domain, Challenge: Challenge(chlng.Type), Err: problem.ProblemDetails,
+			ValidationRecord: problem.validationRecord}
+	}
+	return ChallengeError{Identifier: domain, Challenge: Challenge(chlng.Type), Err: err}
+}
+
+// sequentialInterval returns the delay between two challenges if the solver relies on a sequential provider for the domain.
+func sequentialInterval(s solver, domain string) (time.Duration, bool) {
+	if chlng, ok := s.(*dnsChallenge); ok {
+		if provider, ok := chlng.providerFor(domain).(ChallengeProviderSequential); ok {
+			return provider.Sequential(), true
+		}
+	}
+	return 0, false
 }
 
 // Checks all challenges from the server in order and returns the first matching solver.
 func (c *Client) chooseSolver(auth authorization, domain string) (int, solver) {
-	for i, challenge := range auth.Challenges {
-		if solver, ok := c.solvers[Challenge(challenge.Type)]; ok {
-			return i, solver
+	candidates := c.challengeCandidates(c.challengeSetup(), auth, domain)
+	if len(candidates) == 0 {
+		return 0, nil
+	}
+	return candidates[0].index, candidates[0].solver
+}
+
+// challengeCandidates returns the challenges of the authorization which can be attempted, in order:
+// the preferences of the identifier if any, otherwise the challenge order followed by the order of the server.
+func (c *Client) challengeCandidates(setup challengeSetup, auth authorization, domain string) []challengeCandidate {
+	var candidates []challengeCandidate
+	seen := make(map[int]bool)
+
+	add := func(i int, reason string) {
+		challenge := Challenge(auth.Challenges[i].Type)
+		if seen[i] || !challengeSupported(auth.Identifier, challenge) {
+			return
+		}
+		seen[i] = true
+
+		if solver, ok := setup.solvers[challenge]; ok {
+			candidates = append(candidates, challengeCandidate{index: i, solver: solver, reason: reason})
+			return
+		}
+		c.logger().Infof("[%s] acme: Could not find solver for: %s", domain, challenge)
+	}
+
+	addOrdered := func(order []Challenge, reason string) {
+		for _, preference := range order {
+			for i, challenge := range auth.Challenges {
+				if Challenge(challenge.Type) == preference {
+					add(i, reason)
+				}
+			}
 		}
-		log.Infof("[%s] acme: Could not find solver for: %s", domain, challenge.Type)
 	}
-	return 0, nil
+
+	if preferences, ok := setup.preferences[strings.ToLower(domain)]; ok {
+		addOrdered(preferences, "preferred for the identifier")
+		return candidates
+	}
+
+	addOrdered(setup.order, "first in the challenge order")
+	for i := range auth.Challenges {
+		add(i, "first offered by the server")
+	}
+	return candidates
 }
 
 // Get the challenges needed to proof our identifier to the ACME server.
-func (c *Client) getAuthzForOrder(order orderResource) ([]authorization, error) {
+func (c *Client) getAuthzForOrder(ctx context.Context, order orderResource) ([]authorization, error) {
 	resc, errc := make(chan authorization), make(chan domainError)
 
 	delay := time.Second / overallRequestLimit
@@ -663,11 +1620,12 @@ func (c *Client) getAuthzForOrder(order orderResource) ([]authorization, error)
 
 		go func(authzURL string) {
 			var authz authorization
-			_, err := getJSON(authzURL, &authz)
+			_, err := c.sender.getJSON(ctx, authzURL, &authz)
 			if err != nil {
 				errc <- domainError{Domain: authz.Identifier.Value, Error: err}
 				return
 			}
+			authz.setURL(authzURL)
 
 			resc <- authz
 		}(authzURL)
@@ -684,7 +1642,7 @@ func (c *Client) getAuthzForOrder(order orderResource) ([]authorization, error)
 		}
 	}
 
-	logAuthz(order)
+	c.logAuthz(order)
 
 	close(resc)
 	close(errc)
@@ -697,27 +1655,171 @@ func (c *Client) getAuthzForOrder(order orderResource) ([]authorization, error)
 	return responses, nil
 }
 
-func logAuthz(order orderResource) {
+func (c *Client) logAuthz(order orderResource) {
 	for i, auth := range order.Authorizations {
-		log.Infof("[%s] AuthURL: %s", order.Identifiers[i].Value, auth)
+		c.logger().Debugf("[%s] AuthURL: %s", order.Identifiers[i].Value, auth)
 	}
 }
 
-// cleanAuthz loops through the passed in slice and disables any auths which are not "valid"
-func (c *Client) disableAuthz(authURL string) error {
-	var disabledAuth authorization
-	_, err := postJSON(c.jws, authURL, deactivateAuthMessage{Status: "deactivated"}, &disabledAuth)
-	return err
+// GetOrderURLs returns the URLs of the orders of the account,
+// following the pages of the orders list.
+// It returns ErrOrdersNotSupported if the CA does not provide the orders list.
+func (c *Client) GetOrderURLs() ([]string, error) {
+	reg, err := c.QueryRegistration()
+	if err != nil {
+		return nil, err
+	}
+	if reg.Body.Orders == "" {
+		return nil, ErrOrdersNotSupported
+	}
+
+	var orderURLs []string
+	seen := map[string]bool{}
+	for pageURL := reg.Body.Orders; pageURL != "" && !seen[pageURL]; {
+		seen[pageURL] = true
+
+		var page ordersMessage
+		hdr, err := c.sender.getJSON(context.Background(), pageURL, &page)
+		if err != nil {
+			return nil, err
+		}
+		orderURLs = append(orderURLs, page.Orders...)
+
+		pageURL = parseLinks(hdr["Link"])["next"]
+	}
+
+	return orderURLs, nil
 }
 
-func (c *Client) requestCertificateForOrder(order orderResource, bundle bool, privKey crypto.PrivateKey, mustStaple bool) (*CertificateResource, error) {
+// GetOrder returns the order at the given URL.
+func (c *Client) GetOrder(orderURL string) (*Order, error) {
+	var order orderMessage
+	if _, err := c.sender.getJSON(context.Background(), orderURL, &order); err != nil {
+		return nil, err
+	}
 
-	var err error
-	if privKey == nil {
-		privKey, err = generatePrivateKey(c.keyType)
+	var identifiers []string
+	for _, id := range order.Identifiers {
+		identifiers = append(identifiers, id.Value)
+	}
+
+	return &Order{
+		URL:            orderURL,
+		Status:         order.Status,
+		Expires:        order.Expires,
+		Identifiers:    identifiers,
+		Authorizations: order.Authorizations,
+		Certificate:    order.Certificate,
+		Profile:        order.Profile,
+	}, nil
+}
+
+// DeactivatePendingAuthorizations deactivates the pending authorizations of the order,
+// and returns the URLs of the deactivated authorizations.
+func (c *Client) DeactivatePendingAuthorizations(order *Order) ([]string, error) {
+	var deactivated []string
+	for _, authzURL := range order.Authorizations {
+		var authz authorization
+		if _, err := c.sender.getJSON(context.Background(), authzURL, &authz); err != nil {
+			return deactivated, err
+		}
+		if authz.Status != "pending" {
+			continue
+		}
+
+		if err := c.disableAuthz(authzURL); err != nil {
+			return deactivated, err
+		}
+		deactivated = append(deactivated, authzURL)
+	}
+	return deactivated, nil
+}
+
+// GetChallengeInfo returns the description of the challenges of the authorization at the given URL,
+// with the key authorizations of the account.
+func (c *Client) GetChallengeInfo(authzURL string) ([]ChallengeInfo, error) {
+	var authz authorization
+	if _, err := c.sender.getJSON(context.Background(), authzURL, &authz); err != nil {
+		return nil, err
+	}
+	authz.setURL(authzURL)
+
+	var infos []ChallengeInfo
+	for _, chlng := range authz.Challenges {
+		keyAuth, err := getKeyAuthorization(chlng.Token, c.jws.privKey)
 		if err != nil {
 			return nil, err
 		}
+		infos = append(infos, newChallengeInfo(chlng, authz.Identifier.Value, keyAuth))
+	}
+	return infos, nil
+}
+
+// deactivateAuthorizations deactivates all the authorizations of the order,
+// so that the pending ones do not count against the rate limits.
+// Failures are only logged, so that they do not mask the error of the order.
+func (c *Client) deactivateAuthorizations(order orderResource) {
+	for _, authzURL := range order.Authorizations {
+		if err := c.disableAuthz(authzURL); err != nil {
+			c.logger().Warnf("acme: Unable to deactivate the authorization %s: %v", authzURL, err)
+		}
+	}
+}
+
+// orderFailures returns the failures of the identifiers of the authorizations of an order which failed with err,
+// e.g. when finalized: the subproblems of the problem of the server for the identifiers they name,
+// the errors of the invalid challenges of the authorizations, fetched again, for the others,
+// and err itself for the identifiers without more specific failure.
+func (c *Client) orderFailures(ctx context.Context, authz []authorization, err error) ObtainError {
+	failures := make(ObtainError)
+
+	var problem ProblemDetails
+	if errors.As(err, &problem) {
+		for _, sub := range problem.SubProblems {
+			if sub.Identifier.Value != "" {
+				failures[sub.Identifier.Value] = ProblemDetails{StatusCode: problem.StatusCode, Type: sub.Type, Detail: sub.Detail}
+			}
+		}
+	}
+
+	for _, auth := range authz {
+		domain := auth.Identifier.Value
+		if _, ok := failures[domain]; ok || auth.url == "" || ctx.Err() != nil {
+			continue
+		}
+
+		var current authorization
+		if _, authErr := c.sender.getJSON(ctx, auth.url, &current); authErr != nil {
+			c.logger().Debugf("[%s] acme: Could not get the authorization of the failed order: %v", domain, authErr)
+			continue
+		}
+		for _, chlng := range current.Challenges {
+			if chlng.Status == "invalid" && chlng.Error.Type != "" {
+				failures[domain] = challengeFailure(domain, chlng, handleChallengeError(chlng))
+				break
+			}
+		}
+	}
+
+	for _, auth := range authz {
+		if _, ok := failures[auth.Identifier.Value]; !ok {
+			failures[auth.Identifier.Value] = err
+		}
+	}
+	return failures
+}
+
+// disableAuthz deactivates the authorization at the given URL.
+func (c *Client) disableAuthz(authURL string) error {
+	var disabledAuth authorization
+	_, err := postJSON(context.Background(), c.jws, authURL, deactivateAuthMessage{Status: "deactivated"}, &disabledAuth)
+	return err
+}
+
+func (c *Client) requestCertificateForOrder(ctx context.Context, order orderResource, bundle bool, keySource KeySource, mustStaple bool) (*CertificateResource, error) {
+	privKey, privateKeyPem, err := keySource.CertificateKey(c.keyType)
+	if err != nil {
+		return nil, err
 	}
 
 	// determine certificate name(s) based on the authorization resources
@@ -742,63 +1844,73 @@ func (c *Client) requestCertificateForOrder(order orderResource, bundle bool, pr
 		return nil, err
 	}
 
-	return c.requestCertificateForCsr(order, bundle, csr, pemEncode(privKey))
+	cert, err := c.requestCertificateForCsr(ctx, order, bundle, csr, privateKeyPem, privateKeyPem == nil)
+	if cert != nil {
+		cert.KeyType = publicKeyType(privKey.Public())
+	}
+	return cert, err
 }
 
-func (c *Client) requestCertificateForCsr(order orderResource, bundle bool, csr []byte, privateKeyPem []byte) (*CertificateResource, error) {
+func (c *Client) requestCertificateForCsr(ctx context.Context, order orderResource, bundle bool, csr []byte, privateKeyPem []byte, externalKey bool) (*CertificateResource, error) {
 	commonName := order.Domains[0]
 
 	csrString := base64.RawURLEncoding.EncodeToString(csr)
 	var retOrder orderMessage
-	_, err := postJSON(c.jws, order.Finalize, csrMessage{Csr: csrString}, &retOrder)
+	hdr, err := postJSON(ctx, c.jws, order.Finalize, csrMessage{Csr: csrString}, &retOrder)
 	if err != nil {
 		return nil, err
 	}
 
 	if retOrder.Status == "invalid" {
-		return nil, err
+		return nil, orderError(retOrder)
 	}
 
 	certRes := CertificateResource{
-		Domain:     commonName,
-		CertURL:    retOrder.Certificate,
-		PrivateKey: privateKeyPem,
+		Domain:      commonName,
+		CertURL:     retOrder.Certificate,
+		PrivateKey:  privateKeyPem,
+		ExternalKey: externalKey,
 	}
 
 	if retOrder.Status == "valid" {
 		// if the certificate is available right away, short cut!
-		ok, err := c.checkCertResponse(retOrder, &certRes, bundle)
+		ok, err := c.checkCertResponse(ctx, retOrder, &certRes, bundle)
 		if err != nil {
 			return nil, err
 		}
 
 		if ok {
+			c.certificateIssued(order, &certRes)
 			return &certRes, nil
 		}
 	}
 
-	stopTimer := time.NewTimer(30 * time.Second)
-	defer stopTimer.Stop()
-	retryTick := time.NewTicker(500 * time.Millisecond)
-	defer retryTick.Stop()
+	pollCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
 
+	var polls backoff
 	for {
-		select {
-		case <-stopTimer.C:
-			return nil, errors.New("certificate polling timed out")
-		case <-retryTick.C:
-			_, err := getJSON(order.URL, &retOrder)
-			if err != nil {
-				return nil, err
+		// The server asks to wait with a Retry-After header while the order is processing.
+		if err := wait.Sleep(pollCtx, polls.next(hdr)); err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("[%s] acme: certificate polling aborted after %d polls: %v", commonName, polls.polls-1, ctx.Err())
 			}
+			return nil, fmt.Errorf("certificate polling timed out after %d polls", polls.polls-1)
+		}
 
-			done, err := c.checkCertResponse(retOrder, &certRes, bundle)
-			if err != nil {
-				return nil, err
-			}
-			if done {
-				return &certRes, nil
-			}
+		// the requests are not aborted by the polling timeout.
+		hdr, err = c.sender.getJSON(ctx, order.URL, &retOrder)
+		if err != nil {
+			return nil, err
+		}
+
+		done, err := c.checkCertResponse(ctx, retOrder, &certRes, bundle)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			c.certificateIssued(order, &certRes)
+			return &certRes, nil
 		}
 	}
 }
@@ -806,71 +1918,67 @@ func (c *Client) requestCertificateForCsr(order orderResource, bundle bool, csr
 // checkCertResponse checks to see if the certificate is ready and a link is contained in the
 // response. if so, loads it into certRes and returns true. If the cert
 // is not yet ready, it returns false. The certRes input
-// should already have the Domain (common name) field populated. If bundle is
+// should already have the Domain (common name) field populated.
+// The issuer certificates are always stored in IssuerCertificate. If bundle is
 // true, the certificate will be bundled with the issuer's cert.
-func (c *Client) checkCertResponse(order orderMessage, certRes *CertificateResource, bundle bool) (bool, error) {
+func (c *Client) checkCertResponse(ctx context.Context, order orderMessage, certRes *CertificateResource, bundle bool) (bool, error) {
 
 	switch order.Status {
 	case "valid":
-		resp, err := httpGet(order.Certificate)
+		resp, err := c.sender.httpGet(ctx, order.Certificate)
 		if err != nil {
 			return false, err
 		}
 
-		cert, err := ioutil.ReadAll(limitReader(resp.Body, maxBodySize))
+		body, err := ioutil.ReadAll(limitReader(resp.Body, maxBodySize))
 		if err != nil {
 			return false, err
 		}
 
+		// Get issuerCert from bundled response from Let's Encrypt
+		// See https://community.letsencrypt.org/t/acme-v2-no-up-link-in-response/64962
+		cert, issuerCert := splitPEMBundle(body)
+
 		// The issuer certificate link may be supplied via an "up" link
 		// in the response headers of a new certificate.  See
 		// https://tools.ietf.org/html/draft-ietf-acme-acme-12#section-7.4.2
 		links := parseLinks(resp.Header["Link"])
-		if link, ok := links["up"]; ok {
-			issuerCert, err := c.getIssuerCertificate(link)
-
+		if link, ok := links["up"]; ok && issuerCert == nil {
+			upCert, err := c.getIssuerCertificate(ctx, link)
 			if err != nil {
 				// If we fail to acquire the issuer cert, return the issued certificate - do not fail.
-				log.Warnf("[%s] acme: Could not bundle issuer certificate: %v", certRes.Domain, err)
+				c.logger().Warnf("[%s] acme: Could not bundle issuer certificate: %v", certRes.Domain, err)
 			} else {
-				issuerCert = pemEncode(derCertificateBytes(issuerCert))
-
-				// If bundle is true, we want to return a certificate bundle.
-				// To do this, we append the issuer cert to the issued cert.
-				if bundle {
-					cert = append(cert, issuerCert...)
-				}
-
-				certRes.IssuerCertificate = issuerCert
-			}
-		} else {
-			// Get issuerCert from bundled response from Let's Encrypt
-			// See https://community.letsencrypt.org/t/acme-v2-no-up-link-in-response/64962
-			_, rest := pem.Decode(cert)
-			if rest != nil {
-				certRes.IssuerCertificate = rest
+				issuerCert = pemEncode(derCertificateBytes(upCert))
 			}
 		}
 
+		// If bundle is true, we want to return a certificate bundle.
+		// To do this, we append the issuer cert to the issued cert.
+		if bundle && issuerCert != nil {
+			cert = append(cert, issuerCert...)
+		}
+
 		certRes.Certificate = cert
+		certRes.IssuerCertificate = issuerCert
 		certRes.CertURL = order.Certificate
 		certRes.CertStableURL = order.Certificate
-		log.Infof("[%s] Server responded with a certificate.", certRes.Domain)
+		c.logger().Infof("[%s] acme: Server responded with a certificate.", certRes.Domain)
 		return true, nil
 
 	case "processing":
 		return false, nil
 	case "invalid":
-		return false, errors.New("order has invalid state: invalid")
+		return false, orderError(order)
 	default:
 		return false, nil
 	}
 }
 
 // getIssuerCertificate requests the issuer certificate
-func (c *Client) getIssuerCertificate(url string) ([]byte, error) {
-	log.Infof("acme: Requesting issuer cert from %s", url)
-	resp, err := httpGet(url)
+func (c *Client) getIssuerCertificate(ctx context.Context, url string) ([]byte, error) {
+	c.logger().Debugf("acme: Requesting issuer cert from %s", url)
+	resp, err := c.sender.httpGet(ctx, url)
 	if err != nil {
 		return nil, err
 	}
@@ -910,20 +2018,21 @@ func parseLinks(links []string) map[string]string {
 
 // validate makes the ACME server start validating a
 // challenge response, only returning once it is done.
-func validate(j *jws, domain, uri string, c challenge) error {
+func validate(ctx context.Context, j *jws, domain, uri string, c challenge) error {
 	var chlng challenge
 
-	hdr, err := postJSON(j, uri, c, &chlng)
+	hdr, err := postJSON(ctx, j, uri, c, &chlng)
 	if err != nil {
 		return err
 	}
 
 	// After the path is sent, the ACME server will access our server.
 	// Repeatedly check the server for an updated status on our request.
+	var polls backoff
 	for {
 		switch chlng.Status {
 		case "valid":
-			log.Infof("[%s] The server validated our request", domain)
+			j.logger().Infof("[%s] acme: The server validated our request", domain)
 			return nil
 		case "pending":
 		case "processing":
@@ -933,15 +2042,12 @@ func validate(j *jws, domain, uri string, c challenge) error {
 			return errors.New("the server returned an unexpected state")
 		}
 
-		ra, err := strconv.Atoi(hdr.Get("Retry-After"))
-		if err != nil {
-			// The ACME server MUST return a Retry-After.
-			// If it doesn't, we'll just poll hard.
-			ra = 5
+		// The ACME server should return a Retry-After, which caps the backoff.
+		if err = wait.Sleep(ctx, polls.next(hdr)); err != nil {
+			return fmt.Errorf("[%s] acme: challenge validation polling aborted after %d polls: %v", domain, polls.polls-1, err)
 		}
-		time.Sleep(time.Duration(ra) * time.Second)
 
-		hdr, err = getJSON(uri, &chlng)
+		hdr, err = j.getSender().getJSON(ctx, uri, &chlng)
 		if err != nil {
 			return err
 		}
@@ -1,16 +1,29 @@
 package acme
 
 import (
+	"bytes"
+	"context"
 	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/xenolf/lego/challenge/dns01"
+	"gopkg.in/square/go-jose.v2"
 )
 
 func TestNewClient(t *testing.T) {
@@ -58,6 +71,134 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
+func TestNewClientWithHTTPClient(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     new(RegistrationResource),
+		privatekey: key,
+	}
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := json.Marshal(directory{
+			NewNonceURL:   "http://test",
+			NewAccountURL: "http://test",
+			NewOrderURL:   "http://test",
+			RevokeCertURL: "http://test",
+			KeyChangeURL:  "http://test",
+		})
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	// The certificate of the test server is signed by a private CA.
+	if _, err = NewClient(ts.URL, user, RSA2048); err == nil {
+		t.Fatal("Expected the directory fetch to fail with the default HTTP client")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	httpClient := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+
+	client, err := NewClientWithHTTPClient(ts.URL, user, RSA2048, httpClient)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+
+	if client.sender.client != httpClient {
+		t.Errorf("Expected the client to use the custom HTTP client")
+	}
+	if client.jws.sender != client.sender {
+		t.Errorf("Expected the JWS to share the sender of the client")
+	}
+}
+
+func TestClientUserAgentSuffix(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     new(RegistrationResource),
+		privatekey: key,
+	}
+
+	var mu sync.Mutex
+	userAgents := make(map[string]string)
+
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	record := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		userAgents[r.URL.Path] = r.Header.Get("User-Agent")
+		mu.Unlock()
+		w.Header().Add("Replay-Nonce", "12345")
+	}
+	mux.HandleFunc("/dir", func(w http.ResponseWriter, r *http.Request) {
+		record(w, r)
+		data, _ := json.Marshal(directory{
+			NewNonceURL:   ts.URL + "/nonce",
+			NewAccountURL: ts.URL + "/new-account",
+			NewOrderURL:   ts.URL + "/new-order",
+			RevokeCertURL: ts.URL + "/revoke-cert",
+			KeyChangeURL:  ts.URL + "/key-change",
+		})
+		w.Write(data)
+	})
+	mux.HandleFunc("/nonce", record)
+	mux.HandleFunc("/new-order", func(w http.ResponseWriter, r *http.Request) {
+		record(w, r)
+		w.Header().Add("Location", ts.URL+"/order")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":"valid","certificate":"` + ts.URL + `/cert"}`))
+	})
+	mux.HandleFunc("/cert", func(w http.ResponseWriter, r *http.Request) {
+		record(w, r)
+		w.Write([]byte("certificate"))
+	})
+
+	defer func(ua string) { UserAgent = ua }(UserAgent)
+	UserAgent = "myproduct/2.3"
+
+	client, err := NewClient(ts.URL+"/dir", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	client.SetUserAgentSuffix("myplugin/1.0")
+
+	order, err := client.createOrderForIdentifiers(context.Background(), []string{"example.com"}, OrderOptions{})
+	if err != nil {
+		t.Fatalf("Could not create order: %v", err)
+	}
+
+	certRes := CertificateResource{Domain: "example.com"}
+	if _, err = client.checkCertResponse(context.Background(), order.orderMessage, &certRes, false); err != nil {
+		t.Fatalf("Could not download certificate: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// The directory is fetched before the suffix can be set.
+	if ua := userAgents["/dir"]; !strings.HasPrefix(ua, "myproduct/2.3 "+ourUserAgent) {
+		t.Errorf("Expected directory User-Agent to start with %q, got %q", "myproduct/2.3 "+ourUserAgent, ua)
+	}
+	for _, path := range []string{"/nonce", "/new-order", "/cert"} {
+		ua := userAgents[path]
+		if !strings.HasPrefix(ua, "myproduct/2.3 "+ourUserAgent) || !strings.HasSuffix(ua, " myplugin/1.0") {
+			t.Errorf("Expected %s User-Agent to start with %q and end with %q, got %q", path, "myproduct/2.3 "+ourUserAgent, "myplugin/1.0", ua)
+		}
+	}
+}
+
 func TestClientOptPort(t *testing.T) {
 	keyBits := 32 // small value keeps test fast
 	key, err := rsa.GenerateKey(rand.Reader, keyBits)
@@ -107,9 +248,25 @@ func TestClientOptPort(t *testing.T) {
 	optHost = "127.0.0.1"
 	client.SetHTTPAddress(net.JoinHostPort(optHost, optPort))
 
+	// the solver is replaced, the orders in progress keep the previous one.
+	httpSolver = client.solvers[HTTP01].(*httpChallenge)
 	if got := httpSolver.provider.(*HTTPProviderServer).iface; got != optHost {
 		t.Errorf("Expected http-01 to have iface %s but was %s", optHost, got)
 	}
+
+	// test setting an IPv6 host
+	if err = client.SetHTTPAddress("[::1]:8888"); err != nil {
+		t.Fatalf("Could not set the address: %v", err)
+	}
+
+	httpProvider := client.solvers[HTTP01].(*httpChallenge).provider.(*HTTPProviderServer)
+	if httpProvider.iface != "::1" || httpProvider.port != "8888" {
+		t.Errorf("Expected http-01 to listen on [::1]:8888 but was [%s]:%s", httpProvider.iface, httpProvider.port)
+	}
+
+	if err = client.SetTLSAddress("8888"); err == nil {
+		t.Error("Expected an error for an address without port separator")
+	}
 }
 
 func TestNotHoldingLockWhileMakingHTTPRequests(t *testing.T) {
@@ -187,7 +344,7 @@ func TestValidate(t *testing.T) {
 
 	for _, tst := range tsts {
 		statuses = tst.statuses
-		if err := validate(j, "example.com", ts.URL, challenge{Type: "http-01", Token: "token"}); err == nil && tst.want != "" {
+		if err := validate(context.Background(), j, "example.com", ts.URL, challenge{Type: "http-01", Token: "token"}); err == nil && tst.want != "" {
 			t.Errorf("[%s] validate: got error %v, want something with %q", tst.name, err, tst.want)
 		} else if err != nil && !strings.Contains(err.Error(), tst.want) {
 			t.Errorf("[%s] validate: got error %v, want something with %q", tst.name, err, tst.want)
@@ -232,7 +389,7 @@ func TestGetChallenges(t *testing.T) {
 		t.Fatalf("Could not create client: %v", err)
 	}
 
-	_, err = client.createOrderForIdentifiers([]string{"example.com"})
+	_, err = client.createOrderForIdentifiers(context.Background(), []string{"example.com"}, OrderOptions{})
 	if err != nil {
 		t.Fatal("Expecting \"Server did not provide next link to proceed\" error, got nil")
 	}
@@ -286,6 +443,360 @@ func TestResolveAccountByKey(t *testing.T) {
 	}
 }
 
+func TestChangeAccountKey(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	var conflict bool
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+
+		switch r.RequestURI {
+		case "/directory":
+			writeJSONResponse(w, directory{
+				NewNonceURL:   ts.URL + "/nonce",
+				NewAccountURL: ts.URL + "/account",
+				NewOrderURL:   ts.URL + "/newOrder",
+				RevokeCertURL: ts.URL + "/revokeCert",
+				KeyChangeURL:  ts.URL + "/keyChange",
+			})
+		case "/keyChange":
+			body, _ := ioutil.ReadAll(r.Body)
+			outer, err := jose.ParseSigned(string(body))
+			if err != nil {
+				t.Errorf("Could not parse the outer JWS: %v", err)
+				return
+			}
+			if kid := outer.Signatures[0].Protected.KeyID; kid != ts.URL+"/account/1" {
+				t.Errorf("Expected the outer JWS kid to be the account URL, got %q", kid)
+			}
+			innerBytes, err := outer.Verify(&oldKey.PublicKey)
+			if err != nil {
+				t.Errorf("Expected the outer JWS to be signed by the old key: %v", err)
+				return
+			}
+
+			inner, err := jose.ParseSigned(string(innerBytes))
+			if err != nil {
+				t.Errorf("Could not parse the inner JWS: %v", err)
+				return
+			}
+			if nonce := inner.Signatures[0].Protected.Nonce; nonce != "" {
+				t.Errorf("Expected the inner JWS to have no nonce, got %q", nonce)
+			}
+			payload, err := inner.Verify(&newKey.PublicKey)
+			if err != nil {
+				t.Errorf("Expected the inner JWS to be signed by the new key: %v", err)
+				return
+			}
+
+			var msg keyChangeMessage
+			if err = json.Unmarshal(payload, &msg); err != nil {
+				t.Errorf("Could not parse the key change payload: %v", err)
+				return
+			}
+			if msg.Account != ts.URL+"/account/1" {
+				t.Errorf("Expected the account URL in the payload, got %q", msg.Account)
+			}
+
+			if conflict {
+				w.Header().Set("Location", ts.URL+"/account/2")
+				w.Header().Set("Content-Type", "application/problem+json")
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"type":"urn:ietf:params:acme:error:malformed","detail":"New key is already in use for a different account"}`))
+			}
+		}
+	}))
+	defer ts.Close()
+
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     &RegistrationResource{URI: ts.URL + "/account/1"},
+		privatekey: oldKey,
+	}
+
+	client, err := NewClient(ts.URL+"/directory", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+
+	key, err := client.ChangeAccountKey(newKey)
+	if err != nil {
+		t.Fatalf("Unexpected error changing the account key: %v", err)
+	}
+	if key != newKey || client.jws.privKey != newKey {
+		t.Errorf("Expected the client to sign with the new key")
+	}
+
+	// The client now signs with the new key, so the old key is the new one.
+	oldKey, newKey = newKey, oldKey
+	conflict = true
+
+	_, err = client.ChangeAccountKey(newKey)
+	conflictErr, ok := err.(KeyConflictError)
+	if !ok {
+		t.Fatalf("Expected a KeyConflictError, got: %v", err)
+	}
+	if conflictErr.AccountURL != ts.URL+"/account/2" {
+		t.Errorf("Expected the conflicting account URL, got %q", conflictErr.AccountURL)
+	}
+	if client.jws.privKey != oldKey {
+		t.Errorf("Expected the client to keep its key after a conflict")
+	}
+}
+
+func TestDeactivateAccount(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	var refuse bool
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+
+		switch r.RequestURI {
+		case "/directory":
+			writeJSONResponse(w, directory{
+				NewNonceURL:   ts.URL + "/nonce",
+				NewAccountURL: ts.URL + "/account",
+				NewOrderURL:   ts.URL + "/newOrder",
+				RevokeCertURL: ts.URL + "/revokeCert",
+				KeyChangeURL:  ts.URL + "/keyChange",
+			})
+		case "/account/1":
+			if refuse {
+				w.Header().Set("Content-Type", "application/problem+json")
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"type":"urn:ietf:params:acme:error:unauthorized","detail":"Account is not valid"}`))
+				return
+			}
+			writeJSONResponse(w, accountMessage{Status: "deactivated"})
+		}
+	}))
+	defer ts.Close()
+
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     &RegistrationResource{URI: ts.URL + "/account/1"},
+		privatekey: key,
+	}
+
+	client, err := NewClient(ts.URL+"/directory", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+
+	refuse = true
+	if err = client.DeactivateAccount(); err == nil {
+		t.Fatal("Expected an error when the server refuses the deactivation")
+	}
+	if _, err = client.QueryRegistration(); err == ErrAccountDeactivated {
+		t.Fatal("Expected the client to be usable after a refused deactivation")
+	}
+
+	refuse = false
+	if err = client.DeactivateAccount(); err != nil {
+		t.Fatalf("Unexpected error deactivating the account: %v", err)
+	}
+	if _, err = client.QueryRegistration(); err != ErrAccountDeactivated {
+		t.Errorf("Expected ErrAccountDeactivated after the deactivation, got: %v", err)
+	}
+	if _, err = client.ObtainCertificate([]string{"example.com"}, false, nil, false); err != ErrAccountDeactivated {
+		t.Errorf("Expected ErrAccountDeactivated after the deactivation, got: %v", err)
+	}
+}
+
+func TestObtainCertificateDeactivatesAuthorizationsOnFailure(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	var mu sync.Mutex
+	var deactivated []string
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+
+		switch {
+		case r.RequestURI == "/directory":
+			writeJSONResponse(w, directory{
+				NewNonceURL:   ts.URL + "/nonce",
+				NewAccountURL: ts.URL + "/account",
+				NewOrderURL:   ts.URL + "/newOrder",
+				RevokeCertURL: ts.URL + "/revokeCert",
+				KeyChangeURL:  ts.URL + "/keyChange",
+			})
+		case r.RequestURI == "/newOrder":
+			w.Header().Set("Location", ts.URL+"/order/1")
+			w.WriteHeader(http.StatusCreated)
+			writeJSONResponse(w, orderMessage{
+				Status:         "pending",
+				Identifiers:    []Identifier{{Type: "dns", Value: "a.example.com"}, {Type: "dns", Value: "b.example.com"}},
+				Authorizations: []string{ts.URL + "/authz/a", ts.URL + "/authz/b"},
+			})
+		case strings.HasPrefix(r.RequestURI, "/authz/") && r.Method == http.MethodPost:
+			mu.Lock()
+			deactivated = append(deactivated, r.RequestURI)
+			mu.Unlock()
+			writeJSONResponse(w, authorization{Status: "deactivated"})
+		case r.RequestURI == "/authz/a":
+			writeJSONResponse(w, authorization{
+				Status:     "valid",
+				Identifier: Identifier{Type: "dns", Value: "a.example.com"},
+			})
+		case r.RequestURI == "/authz/b":
+			// No challenge can be solved by the client.
+			writeJSONResponse(w, authorization{
+				Status:     "pending",
+				Identifier: Identifier{Type: "dns", Value: "b.example.com"},
+				Challenges: []challenge{{Type: "unknown-01", URL: ts.URL + "/chlg/b"}},
+			})
+		}
+	}))
+	defer ts.Close()
+
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     &RegistrationResource{URI: ts.URL + "/account/1"},
+		privatekey: key,
+	}
+
+	client, err := NewClient(ts.URL+"/directory", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+
+	_, err = client.ObtainCertificate([]string{"a.example.com", "b.example.com"}, false, nil, false)
+	if _, ok := err.(ObtainError); !ok {
+		t.Fatalf("Expected the original ObtainError, got: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	expected := []string{"/authz/a", "/authz/b"}
+	if !reflect.DeepEqual(deactivated, expected) {
+		t.Errorf("Expected the authorizations %v to be deactivated, got %v", expected, deactivated)
+	}
+}
+
+func TestRevokeCertificateWithReason(t *testing.T) {
+	accountKey, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	certKey, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	cert, err := generatePemCert(certKey, "example.com", nil)
+	if err != nil {
+		t.Fatal("Could not generate test certificate:", err)
+	}
+
+	var revocations []*jose.JSONWebSignature
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+
+		switch r.RequestURI {
+		case "/directory":
+			writeJSONResponse(w, directory{
+				NewNonceURL:   ts.URL + "/nonce",
+				NewAccountURL: ts.URL + "/account",
+				NewOrderURL:   ts.URL + "/newOrder",
+				RevokeCertURL: ts.URL + "/revokeCert",
+				KeyChangeURL:  ts.URL + "/keyChange",
+			})
+		case "/revokeCert":
+			body, _ := ioutil.ReadAll(r.Body)
+			sig, err := jose.ParseSigned(string(body))
+			if err != nil {
+				t.Errorf("Could not parse JWS: %v", err)
+				return
+			}
+			revocations = append(revocations, sig)
+		}
+	}))
+	defer ts.Close()
+
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     &RegistrationResource{URI: ts.URL + "/account/1"},
+		privatekey: accountKey,
+	}
+
+	client, err := NewClient(ts.URL+"/directory", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+
+	if err = client.RevokeCertificateWithReason(cert, 7); err == nil {
+		t.Error("Expected an error for the unused reason code 7")
+	}
+	if err = client.RevokeCertificateWithKey(cert, RevocationReasonKeyCompromise, accountKey); err == nil {
+		t.Error("Expected an error for a key not matching the certificate")
+	}
+	if len(revocations) != 0 {
+		t.Fatalf("Expected no request for invalid revocations, got %d", len(revocations))
+	}
+
+	if err = client.RevokeCertificateWithReason(cert, RevocationReasonCessationOfOperation); err != nil {
+		t.Fatalf("Unexpected error revoking the certificate: %v", err)
+	}
+	if err = client.RevokeCertificateWithKey(cert, RevocationReasonKeyCompromise, certKey); err != nil {
+		t.Fatalf("Unexpected error revoking the certificate with its key: %v", err)
+	}
+	if len(revocations) != 2 {
+		t.Fatalf("Expected 2 revocation requests, got %d", len(revocations))
+	}
+
+	testCases := []struct {
+		key    *rsa.PrivateKey
+		kid    string
+		reason uint
+	}{
+		{key: accountKey, kid: ts.URL + "/account/1", reason: RevocationReasonCessationOfOperation},
+		{key: certKey, kid: "", reason: RevocationReasonKeyCompromise},
+	}
+
+	for i, test := range testCases {
+		header := revocations[i].Signatures[0].Protected
+		if header.KeyID != test.kid {
+			t.Errorf("Expected kid %q, got %q", test.kid, header.KeyID)
+		}
+		if test.kid == "" && header.JSONWebKey == nil {
+			t.Errorf("Expected an embedded JWK when signing with the certificate key")
+		}
+
+		payload, err := revocations[i].Verify(&test.key.PublicKey)
+		if err != nil {
+			t.Errorf("Expected the revocation to be signed by the expected key: %v", err)
+			continue
+		}
+
+		var msg revokeCertMessage
+		if err = json.Unmarshal(payload, &msg); err != nil {
+			t.Errorf("Could not parse the revocation payload: %v", err)
+			continue
+		}
+		if msg.Reason == nil || *msg.Reason != test.reason {
+			t.Errorf("Expected reason %d, got %v", test.reason, msg.Reason)
+		}
+	}
+}
+
 // writeJSONResponse marshals the body as JSON and writes it to the response.
 func writeJSONResponse(w http.ResponseWriter, body interface{}) {
 	bs, err := json.Marshal(body)
@@ -301,7 +812,7 @@ func writeJSONResponse(w http.ResponseWriter, body interface{}) {
 }
 
 // stubValidate is like validate, except it does nothing.
-func stubValidate(j *jws, domain, uri string, chlng challenge) error {
+func stubValidate(ctx context.Context, j *jws, domain, uri string, chlng challenge) error {
 	return nil
 }
 
@@ -314,3 +825,1041 @@ type mockUser struct {
 func (u mockUser) GetEmail() string                       { return u.email }
 func (u mockUser) GetRegistration() *RegistrationResource { return u.regres }
 func (u mockUser) GetPrivateKey() crypto.PrivateKey       { return u.privatekey }
+
+type sequentialProviderMock struct {
+	calls *[]string
+}
+
+func (p *sequentialProviderMock) Present(domain, token, keyAuth string) error {
+	*p.calls = append(*p.calls, "present "+domain)
+	return nil
+}
+
+func (p *sequentialProviderMock) CleanUp(domain, token, keyAuth string) error {
+	*p.calls = append(*p.calls, "cleanup "+domain)
+	return nil
+}
+
+func (p *sequentialProviderMock) Sequential() time.Duration { return 10 * time.Millisecond }
+
+func TestSolveChallengeForAuthzSequential(t *testing.T) {
+	defer func(f PreCheckFunc) { PreCheckDNS = f }(PreCheckDNS)
+	PreCheckDNS = func(fqdn, value string) (bool, error) { return true, nil }
+
+	var calls []string
+	privKey, _ := rsa.GenerateKey(rand.Reader, 512)
+	j := &jws{privKey: privKey}
+
+	client := &Client{jws: j, solvers: map[Challenge]solver{
+		DNS01: &dnsChallenge{
+			jws: j,
+			validate: func(ctx context.Context, j *jws, domain, uri string, chlng challenge) error {
+				calls = append(calls, "validate "+domain)
+				return nil
+			},
+			provider: &sequentialProviderMock{calls: &calls},
+		},
+	}}
+
+	var authorizations []authorization
+	for _, domain := range []string{"example.com", "*.example.com"} {
+		authorizations = append(authorizations, authorization{
+			Status:     "pending",
+			Identifier: Identifier{Type: "dns", Value: domain},
+			Challenges: []challenge{{Type: string(DNS01), Token: "token-" + domain}},
+		})
+	}
+
+	if err := client.solveChallengeForAuthz(context.Background(), client.challengeSetup(), authorizations); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"present example.com", "validate example.com", "cleanup example.com",
+		"present *.example.com", "validate *.example.com", "cleanup *.example.com",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("got calls %v; want %v", calls, expected)
+	}
+}
+
+func TestChooseSolverChallengePreference(t *testing.T) {
+	client := &Client{solvers: map[Challenge]solver{
+		HTTP01: &httpChallenge{},
+		DNS01:  &dnsChallenge{},
+	}}
+	client.SetChallengePreference("Internal.example.com", []Challenge{DNS01, HTTP01})
+	client.SetChallengePreference("alpn.example.com", []Challenge{TLSALPN01})
+
+	challenges := []challenge{{Type: string(HTTP01)}, {Type: string(DNS01)}, {Type: string(TLSALPN01)}}
+
+	testCases := []struct {
+		domain        string
+		expectedIndex int
+		expectSolver  bool
+	}{
+		{domain: "public.example.com", expectedIndex: 0, expectSolver: true},
+		{domain: "internal.example.com", expectedIndex: 1, expectSolver: true},
+		{domain: "alpn.example.com", expectSolver: false},
+	}
+
+	// dns-01 is never chosen for IP addresses.
+	ipChallenges := []challenge{{Type: string(DNS01)}, {Type: string(HTTP01)}}
+	ipAuthz := authorization{Identifier: newIdentifier("2001:DB8::1"), Challenges: ipChallenges}
+	if ipAuthz.Identifier != (Identifier{Type: "ip", Value: "2001:db8::1"}) {
+		t.Errorf("Expected an ip identifier, got %v", ipAuthz.Identifier)
+	}
+	if i, solver := client.chooseSolver(ipAuthz, ipAuthz.Identifier.Value); solver == nil || i != 1 {
+		t.Errorf("Expected the http-01 challenge to be chosen for an IP address, got %d", i)
+	}
+
+	for _, test := range testCases {
+		t.Run(test.domain, func(t *testing.T) {
+			authz := authorization{Identifier: Identifier{Type: "dns", Value: test.domain}, Challenges: challenges}
+
+			i, solver := client.chooseSolver(authz, test.domain)
+			if (solver != nil) != test.expectSolver {
+				t.Fatalf("Expected a solver: %t, got %v", test.expectSolver, solver)
+			}
+			if test.expectSolver && i != test.expectedIndex {
+				t.Errorf("Expected the challenge %d to be chosen, got %d", test.expectedIndex, i)
+			}
+		})
+	}
+}
+
+// solverMock records the challenges it solves, and fails them if failing is set.
+type solverMock struct {
+	calls   *[]string
+	failing bool
+}
+
+func (s solverMock) Solve(ctx context.Context, chlng challenge, domain string) error {
+	*s.calls = append(*s.calls, chlng.Type)
+	if s.failing {
+		return errors.New("validation failed")
+	}
+	return nil
+}
+
+func TestSolveChallengeForAuthzFallback(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		order       []Challenge
+		authzStatus string
+		expected    []string
+		expectErr   bool
+	}{
+		{desc: "server order", authzStatus: "pending", expected: []string{"http-01"}},
+		{desc: "fallback", order: []Challenge{TLSALPN01, HTTP01}, authzStatus: "pending", expected: []string{"tls-alpn-01", "http-01"}},
+		{desc: "invalid authorization", order: []Challenge{TLSALPN01, HTTP01}, authzStatus: "invalid", expected: []string{"tls-alpn-01"}, expectErr: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			challenges := []challenge{{Type: string(HTTP01)}, {Type: string(TLSALPN01)}}
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeJSONResponse(w, authorization{
+					Status:     test.authzStatus,
+					Identifier: Identifier{Type: "dns", Value: "example.com"},
+					Challenges: challenges,
+				})
+			}))
+			defer ts.Close()
+
+			var calls []string
+			client := &Client{solvers: map[Challenge]solver{
+				HTTP01:    solverMock{calls: &calls},
+				TLSALPN01: solverMock{calls: &calls, failing: true},
+			}}
+			client.SetChallengeOrder(test.order)
+
+			authz := authorization{
+				Status:     "pending",
+				Identifier: Identifier{Type: "dns", Value: "example.com"},
+				Challenges: challenges,
+				url:        ts.URL,
+			}
+
+			err := client.solveChallengeForAuthz(context.Background(), client.challengeSetup(), []authorization{authz})
+			if (err != nil) != test.expectErr {
+				t.Fatalf("Expected an error: %t, got %v", test.expectErr, err)
+			}
+			if !reflect.DeepEqual(calls, test.expected) {
+				t.Errorf("got calls %v; want %v", calls, test.expected)
+			}
+		})
+	}
+}
+
+func TestCheckCertResponseIssuer(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	leaf, err := generatePemCert(key, "example.com", nil)
+	if err != nil {
+		t.Fatal("Could not generate test certificate:", err)
+	}
+	issuerDER, err := generateDerCert(key, time.Time{}, "issuer.example.com", nil)
+	if err != nil {
+		t.Fatal("Could not generate test certificate:", err)
+	}
+	issuer := pemEncode(derCertificateBytes(issuerDER))
+
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	mux.HandleFunc("/cert-up", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Link", "<"+ts.URL+"/issuer>;rel=\"up\"")
+		w.Write(leaf)
+	})
+	mux.HandleFunc("/issuer", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(issuerDER)
+	})
+	mux.HandleFunc("/cert-chain", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(append(append([]byte{}, leaf...), issuer...))
+	})
+
+	client := &Client{}
+
+	for _, path := range []string{"/cert-up", "/cert-chain"} {
+		for _, bundle := range []bool{false, true} {
+			certRes := CertificateResource{Domain: "example.com"}
+			order := orderMessage{Status: "valid", Certificate: ts.URL + path}
+			if _, err := client.checkCertResponse(context.Background(), order, &certRes, bundle); err != nil {
+				t.Fatalf("%s (bundle: %t): Could not download certificate: %v", path, bundle, err)
+			}
+
+			expected := leaf
+			if bundle {
+				expected = append(append([]byte{}, leaf...), issuer...)
+			}
+			if !bytes.Equal(certRes.Certificate, expected) {
+				t.Errorf("%s (bundle: %t): Expected certificate\n%s\ngot\n%s", path, bundle, expected, certRes.Certificate)
+			}
+			if !bytes.Equal(certRes.IssuerCertificate, issuer) {
+				t.Errorf("%s (bundle: %t): Expected issuer certificate\n%s\ngot\n%s", path, bundle, issuer, certRes.IssuerCertificate)
+			}
+
+			leafCert, err := certRes.Leaf()
+			if err != nil {
+				t.Fatalf("%s (bundle: %t): Could not get the leaf certificate: %v", path, bundle, err)
+			}
+			if !reflect.DeepEqual(leafCert.DNSNames, []string{"example.com"}) {
+				t.Errorf("%s (bundle: %t): Expected the leaf certificate of example.com, got %v", path, bundle, leafCert.DNSNames)
+			}
+
+			chain, err := certRes.Chain()
+			if err != nil {
+				t.Fatalf("%s (bundle: %t): Could not get the chain: %v", path, bundle, err)
+			}
+			if len(chain) != 1 || !reflect.DeepEqual(chain[0].DNSNames, []string{"issuer.example.com"}) {
+				t.Errorf("%s (bundle: %t): Expected the issuer certificate in the chain, got %d certificates", path, bundle, len(chain))
+			}
+		}
+	}
+}
+
+func TestGetDirectoryMeta(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     new(RegistrationResource),
+		privatekey: key,
+	}
+
+	meta := DirectoryMeta{
+		TermsOfService:          "https://example.com/tos.pdf",
+		Website:                 "https://example.com",
+		CaaIdentities:           []string{"example.com"},
+		ExternalAccountRequired: true,
+	}
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+
+		switch r.RequestURI {
+		case "/directory":
+			writeJSONResponse(w, directory{
+				NewNonceURL:   ts.URL + "/nonce",
+				NewAccountURL: ts.URL + "/account",
+				NewOrderURL:   ts.URL + "/newOrder",
+				RevokeCertURL: ts.URL + "/revokeCert",
+				KeyChangeURL:  ts.URL + "/keyChange",
+				Meta:          meta,
+			})
+		case "/nonce":
+		case "/account":
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"type":"urn:ietf:params:acme:error:externalAccountRequired","detail":"No external account binding"}`))
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL+"/directory", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+
+	if actual := client.GetDirectoryMeta(); !reflect.DeepEqual(actual, meta) {
+		t.Errorf("Expected directory meta %+v, got %+v", meta, actual)
+	}
+
+	// The requirement is checked before sending the registration.
+	_, err = client.Register(true)
+	if _, ok := err.(ExternalAccountRequiredError); !ok {
+		t.Errorf("Expected an ExternalAccountRequiredError, got %T: %v", err, err)
+	}
+
+	// The problem of the server is also converted.
+	client.directory.Meta.ExternalAccountRequired = false
+	_, err = client.Register(true)
+	if eabErr, ok := err.(ExternalAccountRequiredError); !ok || eabErr.Detail != "No external account binding" {
+		t.Errorf("Expected an ExternalAccountRequiredError with the server detail, got %T: %v", err, err)
+	}
+}
+
+func TestTOSCallback(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     new(RegistrationResource),
+		privatekey: key,
+	}
+
+	var mu sync.Mutex
+	var updates, orders int
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.RequestURI {
+		case "/directory":
+			writeJSONResponse(w, directory{
+				NewNonceURL:   ts.URL + "/nonce",
+				NewAccountURL: ts.URL + "/newAccount",
+				NewOrderURL:   ts.URL + "/newOrder",
+				RevokeCertURL: ts.URL + "/revokeCert",
+				KeyChangeURL:  ts.URL + "/keyChange",
+				Meta:          DirectoryMeta{TermsOfService: ts.URL + "/tos-v1"},
+			})
+		case "/nonce":
+		case "/newAccount":
+			w.Header().Set("Location", ts.URL+"/account")
+			w.WriteHeader(http.StatusCreated)
+			writeJSONResponse(w, accountMessage{Status: "valid"})
+		case "/account":
+			updates++
+			writeJSONResponse(w, accountMessage{Status: "valid", TermsOfServiceAgreed: true})
+		case "/newOrder":
+			orders++
+			if updates == 0 {
+				w.Header().Set("Link", "<"+ts.URL+"/tos-v2>;rel=\"terms-of-service\"")
+				w.Header().Set("Content-Type", "application/problem+json")
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"type":"urn:ietf:params:acme:error:userActionRequired","detail":"Terms of service have changed"}`))
+				return
+			}
+			w.Header().Set("Location", ts.URL+"/order")
+			w.WriteHeader(http.StatusCreated)
+			writeJSONResponse(w, orderMessage{Status: "pending"})
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL+"/directory", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+
+	var asked []string
+	reg, err := client.RegisterWithTOSCallback(func(tosURL string) bool {
+		asked = append(asked, tosURL)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Could not register: %v", err)
+	}
+	if reg.TOSAgreedURL != ts.URL+"/tos-v1" {
+		t.Errorf("Expected the agreed TOS %s, got %q", ts.URL+"/tos-v1", reg.TOSAgreedURL)
+	}
+	*user.regres = *reg
+
+	// The CA requires to agree to new TOS: the request is retried once agreed.
+	if _, err = client.createOrderForIdentifiers(context.Background(), []string{"example.com"}, OrderOptions{}); err != nil {
+		t.Fatalf("Could not create order: %v", err)
+	}
+
+	if expected := []string{ts.URL + "/tos-v1", ts.URL + "/tos-v2"}; !reflect.DeepEqual(asked, expected) {
+		t.Errorf("Expected the callback to be asked for %v, got %v", expected, asked)
+	}
+	mu.Lock()
+	if updates != 1 || orders != 2 {
+		t.Errorf("Expected 1 account update and 2 orders, got %d and %d", updates, orders)
+	}
+	updates = 0
+	mu.Unlock()
+	if user.regres.TOSAgreedURL != ts.URL+"/tos-v2" {
+		t.Errorf("Expected the agreed TOS %s, got %q", ts.URL+"/tos-v2", user.regres.TOSAgreedURL)
+	}
+
+	// Without agreement, the TOS error is returned.
+	client.SetTOSCallback(func(tosURL string) bool { return false })
+	_, err = client.createOrderForIdentifiers(context.Background(), []string{"example.com"}, OrderOptions{})
+	if tosErr, ok := err.(TOSError); !ok || tosErr.TOSURL != ts.URL+"/tos-v2" {
+		t.Errorf("Expected a TOSError with the new TOS URL, got %T: %v", err, err)
+	}
+}
+
+func TestGetOrders(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	var mu sync.Mutex
+	var ordersURL string
+	var deactivated []string
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.RequestURI {
+		case "/directory":
+			writeJSONResponse(w, directory{
+				NewNonceURL:   ts.URL + "/nonce",
+				NewAccountURL: ts.URL + "/newAccount",
+				NewOrderURL:   ts.URL + "/newOrder",
+				RevokeCertURL: ts.URL + "/revokeCert",
+				KeyChangeURL:  ts.URL + "/keyChange",
+			})
+		case "/nonce":
+		case "/account":
+			writeJSONResponse(w, accountMessage{Status: "valid", Orders: ordersURL})
+		case "/orders":
+			w.Header().Set("Link", "<"+ts.URL+"/orders?page=2>;rel=\"next\"")
+			writeJSONResponse(w, ordersMessage{Orders: []string{ts.URL + "/order/1"}})
+		case "/orders?page=2":
+			writeJSONResponse(w, ordersMessage{Orders: []string{ts.URL + "/order/2"}})
+		case "/order/1", "/order/2":
+			writeJSONResponse(w, orderMessage{
+				Status:         "pending",
+				Identifiers:    []Identifier{{Type: "dns", Value: "example.com"}},
+				Authorizations: []string{ts.URL + "/authz/pending", ts.URL + "/authz/valid"},
+			})
+		case "/authz/pending", "/authz/valid":
+			if r.Method == http.MethodPost {
+				deactivated = append(deactivated, r.RequestURI)
+				writeJSONResponse(w, authorization{Status: "deactivated"})
+				return
+			}
+			writeJSONResponse(w, authorization{Status: strings.TrimPrefix(r.RequestURI, "/authz/")})
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     &RegistrationResource{URI: ts.URL + "/account"},
+		privatekey: key,
+	}
+
+	client, err := NewClient(ts.URL+"/directory", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	client.jws.kid = user.regres.URI
+
+	// The CA does not provide the orders list.
+	if _, err = client.GetOrderURLs(); err != ErrOrdersNotSupported {
+		t.Errorf("Expected ErrOrdersNotSupported, got %v", err)
+	}
+
+	mu.Lock()
+	ordersURL = ts.URL + "/orders"
+	mu.Unlock()
+
+	orderURLs, err := client.GetOrderURLs()
+	if err != nil {
+		t.Fatalf("Could not list the orders: %v", err)
+	}
+	if expected := []string{ts.URL + "/order/1", ts.URL + "/order/2"}; !reflect.DeepEqual(orderURLs, expected) {
+		t.Errorf("Expected the orders %v, got %v", expected, orderURLs)
+	}
+
+	order, err := client.GetOrder(orderURLs[0])
+	if err != nil {
+		t.Fatalf("Could not get the order: %v", err)
+	}
+	if order.URL != orderURLs[0] || order.Status != "pending" || !reflect.DeepEqual(order.Identifiers, []string{"example.com"}) {
+		t.Errorf("Unexpected order %+v", order)
+	}
+
+	authzURLs, err := client.DeactivatePendingAuthorizations(order)
+	if err != nil {
+		t.Fatalf("Could not deactivate the pending authorizations: %v", err)
+	}
+	if expected := []string{ts.URL + "/authz/pending"}; !reflect.DeepEqual(authzURLs, expected) {
+		t.Errorf("Expected the deactivated authorizations %v, got %v", expected, authzURLs)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if expected := []string{"/authz/pending"}; !reflect.DeepEqual(deactivated, expected) {
+		t.Errorf("Expected the server to deactivate %v, got %v", expected, deactivated)
+	}
+}
+
+func TestObtainCertificatesConcurrently(t *testing.T) {
+	const certificates = 20
+
+	accountKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	certKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	var mu sync.Mutex
+	var orders []string
+	var lastNonce int
+	usedNonces := map[string]bool{}
+
+	// readPayload checks the nonce of a JWS request, and returns its payload.
+	readPayload := func(r *http.Request) []byte {
+		body, _ := ioutil.ReadAll(r.Body)
+		sig, err := jose.ParseSigned(string(body))
+		if err != nil {
+			t.Errorf("Could not parse JWS: %v", err)
+			return nil
+		}
+
+		nonce := sig.Signatures[0].Protected.Nonce
+		mu.Lock()
+		if usedNonces[nonce] {
+			t.Errorf("Nonce %s used twice", nonce)
+		}
+		usedNonces[nonce] = true
+		mu.Unlock()
+
+		return sig.UnsafePayloadWithoutVerification()
+	}
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		lastNonce++
+		w.Header().Add("Replay-Nonce", fmt.Sprintf("nonce-%d", lastNonce))
+		mu.Unlock()
+
+		parts := strings.Split(r.URL.Path, "/")
+		id := parts[len(parts)-1]
+
+		switch {
+		case r.URL.Path == "/directory":
+			writeJSONResponse(w, directory{
+				NewNonceURL:   ts.URL + "/nonce",
+				NewAccountURL: ts.URL + "/account",
+				NewOrderURL:   ts.URL + "/newOrder",
+				RevokeCertURL: ts.URL + "/revokeCert",
+				KeyChangeURL:  ts.URL + "/keyChange",
+			})
+		case r.URL.Path == "/nonce":
+		case r.URL.Path == "/newOrder":
+			var order orderMessage
+			if err := json.Unmarshal(readPayload(r), &order); err != nil || len(order.Identifiers) != 1 {
+				http.Error(w, "invalid order", http.StatusBadRequest)
+				return
+			}
+
+			mu.Lock()
+			orders = append(orders, order.Identifiers[0].Value)
+			id := strconv.Itoa(len(orders) - 1)
+			mu.Unlock()
+
+			w.Header().Set("Location", ts.URL+"/order/"+id)
+			w.WriteHeader(http.StatusCreated)
+			writeJSONResponse(w, orderMessage{
+				Status:         "pending",
+				Identifiers:    order.Identifiers,
+				Authorizations: []string{ts.URL + "/authz/" + id},
+				Finalize:       ts.URL + "/finalize/" + id,
+			})
+		case strings.HasPrefix(r.URL.Path, "/authz/"):
+			i, _ := strconv.Atoi(id)
+			mu.Lock()
+			domain := orders[i]
+			mu.Unlock()
+
+			writeJSONResponse(w, authorization{
+				Status:     "pending",
+				Identifier: Identifier{Type: "dns", Value: domain},
+				Challenges: []challenge{{Type: string(HTTP01), URL: ts.URL + "/chlg/" + id, Token: "token-" + id}},
+			})
+		case strings.HasPrefix(r.URL.Path, "/chlg/"):
+			readPayload(r)
+			i, _ := strconv.Atoi(id)
+			mu.Lock()
+			domain := orders[i]
+			mu.Unlock()
+
+			// validate the challenge against the provider server of the client.
+			req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:23459"+HTTP01ChallengePath("token-"+id), nil)
+			req.Host = domain
+			status := "invalid"
+			if resp, err := http.DefaultClient.Do(req); err == nil {
+				keyAuth, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if strings.HasPrefix(string(keyAuth), "token-"+id+".") {
+					status = "valid"
+				}
+			}
+			writeJSONResponse(w, challenge{Type: string(HTTP01), Status: status, Token: "token-" + id})
+		case strings.HasPrefix(r.URL.Path, "/finalize/"):
+			readPayload(r)
+			writeJSONResponse(w, orderMessage{Status: "valid", Certificate: ts.URL + "/cert/" + id})
+		case strings.HasPrefix(r.URL.Path, "/cert/"):
+			i, _ := strconv.Atoi(id)
+			mu.Lock()
+			domain := orders[i]
+			mu.Unlock()
+
+			cert, err := generatePemCert(certKey, domain, nil)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Write(cert)
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     &RegistrationResource{URI: ts.URL + "/account/1"},
+		privatekey: accountKey,
+	}
+
+	client, err := NewClient(ts.URL+"/directory", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	client.ExcludeChallenges([]Challenge{TLSALPN01})
+	if err = client.SetHTTPAddress("127.0.0.1:23459"); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, certificates)
+	for i := 0; i < certificates; i++ {
+		wg.Add(1)
+		go func(domain string) {
+			defer wg.Done()
+
+			cert, err := client.ObtainCertificate([]string{domain}, false, certKey, false)
+			if err != nil {
+				errs <- fmt.Errorf("%s: %v", domain, err)
+				return
+			}
+			if cert.Domain != domain {
+				errs <- fmt.Errorf("expected a certificate for %s, got %s", domain, cert.Domain)
+			}
+		}(fmt.Sprintf("d%d.example.com", i))
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(orders) != certificates {
+		t.Errorf("Expected %d orders, got %d", certificates, len(orders))
+	}
+}
+
+func TestGetChallengeInfo(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONResponse(w, authorization{
+			Status:     "pending",
+			Identifier: Identifier{Type: "dns", Value: "example.com"},
+			Challenges: []challenge{
+				{Type: string(HTTP01), URL: ts.URL + "/chlg/http", Token: "token1"},
+				{Type: string(DNS01), URL: ts.URL + "/chlg/dns", Token: "token2"},
+			},
+		})
+	}))
+	defer ts.Close()
+
+	j := &jws{privKey: key}
+	client := &Client{jws: j}
+
+	infos, err := client.GetChallengeInfo(ts.URL + "/authz")
+	if err != nil {
+		t.Fatalf("Could not get the challenges: %v", err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("Expected 2 challenges, got %d", len(infos))
+	}
+
+	keyAuth, _ := getKeyAuthorization("token1", key)
+	expected := ChallengeInfo{
+		Type:             HTTP01,
+		Domain:           "example.com",
+		Token:            "token1",
+		KeyAuth:          keyAuth,
+		AuthorizationURL: ts.URL + "/authz",
+		ChallengeURL:     ts.URL + "/chlg/http",
+		HTTPPath:         "/.well-known/acme-challenge/token1",
+	}
+	if infos[0] != expected {
+		t.Errorf("got %+v; want %+v", infos[0], expected)
+	}
+
+	keyAuth, _ = getKeyAuthorization("token2", key)
+	fqdn, value := dns01.GetRecord("example.com", keyAuth)
+	if infos[1].Type != DNS01 || infos[1].FQDN != fqdn || infos[1].Value != value {
+		t.Errorf("Expected the TXT record %s %s, got %+v", fqdn, value, infos[1])
+	}
+
+	// The callbacks of the provider receive the same information.
+	var presented, cleaned []ChallengeInfo
+	provider := &CallbackProvider{
+		PresentFunc: func(info ChallengeInfo) error {
+			presented = append(presented, info)
+			return nil
+		},
+		CleanUpFunc: func(info ChallengeInfo) error {
+			cleaned = append(cleaned, info)
+			return nil
+		},
+	}
+	solver := &httpChallenge{jws: j, validate: stubValidate, provider: provider}
+
+	chlng := challenge{Type: string(HTTP01), URL: ts.URL + "/chlg/http", Token: "token1", authzURL: ts.URL + "/authz"}
+	if err := solver.Solve(context.Background(), chlng, "example.com"); err != nil {
+		t.Fatalf("Solve error: %v", err)
+	}
+	if !reflect.DeepEqual(presented, []ChallengeInfo{expected}) || !reflect.DeepEqual(cleaned, presented) {
+		t.Errorf("got presented %+v and cleaned %+v; want %+v", presented, cleaned, expected)
+	}
+}
+
+func TestCreateOrderWithProfile(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	var mu sync.Mutex
+	var profiles []string
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+
+		switch r.RequestURI {
+		case "/directory":
+			writeJSONResponse(w, directory{
+				NewNonceURL:   ts.URL + "/nonce",
+				NewAccountURL: ts.URL + "/account",
+				NewOrderURL:   ts.URL + "/newOrder",
+				RevokeCertURL: ts.URL + "/revokeCert",
+				KeyChangeURL:  ts.URL + "/keyChange",
+				Meta: DirectoryMeta{Profiles: map[string]string{
+					"classic":    "The usual certificates",
+					"shortlived": "Certificates valid for 6 days",
+					"retired":    "No more available",
+				}},
+			})
+		case "/newOrder":
+			body, _ := ioutil.ReadAll(r.Body)
+			sig, err := jose.ParseSigned(string(body))
+			if err != nil {
+				t.Errorf("Could not parse JWS: %v", err)
+				return
+			}
+			var order orderMessage
+			if err := json.Unmarshal(sig.UnsafePayloadWithoutVerification(), &order); err != nil {
+				t.Errorf("Could not parse the order: %v", err)
+				return
+			}
+
+			mu.Lock()
+			profiles = append(profiles, order.Profile)
+			mu.Unlock()
+
+			if order.Profile == "retired" {
+				w.Header().Set("Content-Type", "application/problem+json")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"type":"urn:ietf:params:acme:error:invalidProfile","detail":"profile retired is not available"}`))
+				return
+			}
+			w.Header().Set("Location", ts.URL+"/order")
+			w.WriteHeader(http.StatusCreated)
+			writeJSONResponse(w, orderMessage{Status: "pending", Profile: order.Profile})
+		}
+	}))
+	defer ts.Close()
+
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     &RegistrationResource{URI: ts.URL + "/account/1"},
+		privatekey: key,
+	}
+	client, err := NewClient(ts.URL+"/directory", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+
+	if len(client.GetDirectoryMeta().Profiles) != 3 {
+		t.Errorf("Expected the 3 advertised profiles, got %v", client.GetDirectoryMeta().Profiles)
+	}
+
+	order, err := client.createOrderForIdentifiers(context.Background(), []string{"example.com"}, OrderOptions{Profile: "shortlived"})
+	if err != nil {
+		t.Fatalf("Could not create order: %v", err)
+	}
+	if profile := order.profile(OrderOptions{}); profile != "shortlived" {
+		t.Errorf("Expected the profile shortlived, got %q", profile)
+	}
+
+	// the profiles unknown to the CA are not requested.
+	if _, err = client.createOrderForIdentifiers(context.Background(), []string{"example.com"}, OrderOptions{Profile: "unknown"}); err == nil ||
+		!strings.Contains(err.Error(), "classic, retired, shortlived") {
+		t.Errorf("Expected an error listing the profiles, got %v", err)
+	}
+
+	_, err = client.createOrderForIdentifiers(context.Background(), []string{"example.com"}, OrderOptions{Profile: "retired"})
+	var profileErr InvalidProfileError
+	if !errors.As(err, &profileErr) || profileErr.Profile != "retired" {
+		t.Errorf("Expected an InvalidProfileError, got %T: %v", err, err)
+	}
+
+	if _, err = client.createOrderForIdentifiers(context.Background(), []string{"example.com"}, OrderOptions{}); err != nil {
+		t.Fatalf("Could not create order: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if expected := []string{"shortlived", "retired", ""}; !reflect.DeepEqual(profiles, expected) {
+		t.Errorf("Expected the orders with the profiles %q, got %q", expected, profiles)
+	}
+}
+
+func TestOrderOptionsValidityPeriod(t *testing.T) {
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		desc      string
+		opts      OrderOptions
+		expectErr bool
+	}{
+		{desc: "none"},
+		{desc: "valid", opts: OrderOptions{NotBefore: now.Add(time.Minute), NotAfter: now.Add(24 * time.Hour)}},
+		{desc: "only not after", opts: OrderOptions{NotAfter: now.Add(24 * time.Hour)}},
+		{desc: "not before in the past", opts: OrderOptions{NotBefore: now.Add(-time.Minute)}, expectErr: true},
+		{desc: "not after in the past", opts: OrderOptions{NotAfter: now.Add(-time.Minute)}, expectErr: true},
+		{desc: "empty period", opts: OrderOptions{NotBefore: now.Add(time.Hour), NotAfter: now.Add(time.Minute)}, expectErr: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			if err := test.opts.validate(now); (err != nil) != test.expectErr {
+				t.Errorf("Expected an error: %t, got %v", test.expectErr, err)
+			}
+		})
+	}
+
+	// the validity period is only sent when set.
+	payload, _ := json.Marshal(orderMessage{NotBefore: formatOrderTime(time.Time{}), NotAfter: formatOrderTime(now.Add(24 * time.Hour))})
+	if expected := `{"identifiers":null,"notAfter":"2018-10-02T12:00:00Z"}`; string(payload) != expected {
+		t.Errorf("got payload %s; want %s", payload, expected)
+	}
+}
+
+func TestRenewCertificateReuseKeyWithoutKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	cert, err := generatePemCert(key, "example.com", nil)
+	if err != nil {
+		t.Fatal("Could not generate test certificate:", err)
+	}
+
+	// the renewal fails before contacting the CA.
+	client := &Client{}
+	certRes := CertificateResource{Domain: "example.com", Certificate: cert, ReuseKey: true}
+	if _, err := client.RenewCertificateWithOptions(context.Background(), certRes, false, false, OrderOptions{}); err == nil {
+		t.Error("Expected an error renewing with ReuseKey and no private key")
+	}
+}
+
+func TestObtainCertificatesSplitLargeOrders(t *testing.T) {
+	defer func(f PreCheckFunc) { PreCheckDNS = f }(PreCheckDNS)
+	PreCheckDNS = func(fqdn, value string) (bool, error) { return true, nil }
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	// the stub server accepts orders of at most 2 identifiers, and validates every challenge.
+	var mu sync.Mutex
+	var orders [][]string
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+
+		parts := strings.Split(r.URL.Path, "/")
+		domain := parts[len(parts)-1]
+
+		switch {
+		case r.URL.Path == "/directory":
+			writeJSONResponse(w, directory{
+				NewNonceURL:   ts.URL + "/nonce",
+				NewAccountURL: ts.URL + "/account",
+				NewOrderURL:   ts.URL + "/newOrder",
+				RevokeCertURL: ts.URL + "/revokeCert",
+				KeyChangeURL:  ts.URL + "/keyChange",
+				Meta:          DirectoryMeta{MaxIdentifiers: 2},
+			})
+		case r.URL.Path == "/nonce":
+		case r.URL.Path == "/newOrder":
+			var order orderMessage
+			if err := json.Unmarshal(readJWSPayload(t, r), &order); err != nil {
+				http.Error(w, "invalid order", http.StatusBadRequest)
+				return
+			}
+
+			var names []string
+			for _, identifier := range order.Identifiers {
+				names = append(names, identifier.Value)
+				order.Authorizations = append(order.Authorizations, ts.URL+"/authz/"+identifier.Value)
+			}
+			mu.Lock()
+			orders = append(orders, names)
+			mu.Unlock()
+
+			order.Status = "pending"
+			order.Finalize = ts.URL + "/finalize/" + names[0]
+			w.Header().Set("Location", ts.URL+"/order/"+names[0])
+			w.WriteHeader(http.StatusCreated)
+			writeJSONResponse(w, order)
+		case strings.HasPrefix(r.URL.Path, "/authz/"):
+			writeJSONResponse(w, authorization{
+				Status:     "pending",
+				Identifier: Identifier{Type: "dns", Value: domain},
+				Challenges: []challenge{{Type: string(DNS01), URL: ts.URL + "/chlg/" + domain, Token: "token"}},
+			})
+		case strings.HasPrefix(r.URL.Path, "/chlg/"):
+			writeJSONResponse(w, challenge{Type: string(DNS01), Status: "valid"})
+		case strings.HasPrefix(r.URL.Path, "/finalize/"):
+			writeJSONResponse(w, orderMessage{Status: "valid", Certificate: ts.URL + "/cert/" + domain})
+		case strings.HasPrefix(r.URL.Path, "/cert/"):
+			cert, err := generatePemCert(key, domain, nil)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Write(cert)
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     &RegistrationResource{URI: ts.URL + "/account/1"},
+		privatekey: key,
+	}
+	client, err := NewClient(ts.URL+"/directory", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	if err = client.SetChallengeProvider(DNS01, nopProviderMock{}); err != nil {
+		t.Fatal(err)
+	}
+	if max := client.MaxIdentifiers(); max != 2 {
+		t.Errorf("Expected the advertised maximum of 2 identifiers, got %d", max)
+	}
+
+	domains := []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com", "e.example.com"}
+
+	// without the option, the order is not created.
+	_, err = client.ObtainCertificatesWithOptions(context.Background(), domains, false, nil, false, OrderOptions{})
+	var tooManyErr TooManyIdentifiersError
+	if !errors.As(err, &tooManyErr) || tooManyErr.Identifiers != 5 || tooManyErr.Max != 2 {
+		t.Errorf("Expected a TooManyIdentifiersError, got %T: %v", err, err)
+	}
+	if len(orders) != 0 {
+		t.Errorf("Expected no order, got %v", orders)
+	}
+
+	certs, err := client.ObtainCertificatesWithOptions(context.Background(), domains, false, nil, false, OrderOptions{SplitLargeOrders: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var certDomains []string
+	for _, cert := range certs {
+		certDomains = append(certDomains, strings.Join(cert.Domains, ","))
+	}
+	expected := []string{"a.example.com,b.example.com", "c.example.com,d.example.com", "e.example.com"}
+	if !reflect.DeepEqual(certDomains, expected) {
+		t.Errorf("Expected the certificates %v, got %v", expected, certDomains)
+	}
+	if len(certs) > 0 && certs[0].Domain != "a.example.com" {
+		t.Errorf("Expected the first domain to be the one of the first certificate, got %s", certs[0].Domain)
+	}
+	if len(orders) != 3 {
+		t.Errorf("Expected 3 orders, got %v", orders)
+	}
+}
+
+func TestMaxIdentifiersDefault(t *testing.T) {
+	client := &Client{}
+	if max := client.MaxIdentifiers(); max != DefaultMaxIdentifiers {
+		t.Errorf("Expected the default maximum of %d identifiers, got %d", DefaultMaxIdentifiers, max)
+	}
+}
@@ -2,6 +2,7 @@ package acme
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -17,11 +18,11 @@ import (
 	"io"
 	"io/ioutil"
 	"math/big"
+	"net"
 	"net/http"
 	"time"
 
 	"golang.org/x/crypto/ocsp"
-	jose "gopkg.in/square/go-jose.v2"
 )
 
 // KeyType represents the key algo as well as the key size or curve to use.
@@ -48,6 +49,20 @@ const (
 	OCSPServerFailed = ocsp.ServerFailed
 )
 
+// Revocation reason codes of RFC 5280 section 5.3.1 which are allowed by ACME.
+const (
+	RevocationReasonUnspecified          uint = ocsp.Unspecified
+	RevocationReasonKeyCompromise        uint = ocsp.KeyCompromise
+	RevocationReasonCACompromise         uint = ocsp.CACompromise
+	RevocationReasonAffiliationChanged   uint = ocsp.AffiliationChanged
+	RevocationReasonSuperseded           uint = ocsp.Superseded
+	RevocationReasonCessationOfOperation uint = ocsp.CessationOfOperation
+	RevocationReasonCertificateHold      uint = ocsp.CertificateHold
+	RevocationReasonRemoveFromCRL        uint = ocsp.RemoveFromCRL
+	RevocationReasonPrivilegeWithdrawn   uint = ocsp.PrivilegeWithdrawn
+	RevocationReasonAACompromise         uint = ocsp.AACompromise
+)
+
 // Constants for OCSP must staple
 var (
 	tlsFeatureExtensionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
@@ -61,7 +76,7 @@ var (
 // IssuingCertificateURL in the certificate. If the []byte and/or ocsp.Response return
 // values are nil, the OCSP status may be assumed OCSPUnknown.
 func GetOCSPForCert(bundle []byte) ([]byte, *ocsp.Response, error) {
-	certificates, err := parsePEMBundle(bundle)
+	certificates, err := ParsePEMBundle(bundle)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -81,7 +96,7 @@ func GetOCSPForCert(bundle []byte) ([]byte, *ocsp.Response, error) {
 			return nil, nil, errors.New("no issuing certificate URL")
 		}
 
-		resp, err := httpGet(issuedCert.IssuingCertificateURL[0])
+		resp, err := defaultSender.httpGet(context.Background(), issuedCert.IssuingCertificateURL[0])
 		if err != nil {
 			return nil, nil, err
 		}
@@ -110,7 +125,7 @@ func GetOCSPForCert(bundle []byte) ([]byte, *ocsp.Response, error) {
 	}
 
 	reader := bytes.NewReader(ocspReq)
-	req, err := httpPost(issuedCert.OCSPServer[0], "application/ocsp-request", reader)
+	req, err := defaultSender.httpPost(context.Background(), issuedCert.OCSPServer[0], "application/ocsp-request", reader)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -130,18 +145,10 @@ func GetOCSPForCert(bundle []byte) ([]byte, *ocsp.Response, error) {
 }
 
 func getKeyAuthorization(token string, key interface{}) (string, error) {
-	var publicKey crypto.PublicKey
-	switch k := key.(type) {
-	case *ecdsa.PrivateKey:
-		publicKey = k.Public()
-	case *rsa.PrivateKey:
-		publicKey = k.Public()
-	}
-
 	// Generate the Key Authorization for the challenge
-	jwk := &jose.JSONWebKey{Key: publicKey}
-	if jwk == nil {
-		return "", errors.New("could not generate JWK from key")
+	jwk, err := publicJWK(key)
+	if err != nil {
+		return "", err
 	}
 	thumbBytes, err := jwk.Thumbprint(crypto.SHA256)
 	if err != nil {
@@ -154,9 +161,9 @@ func getKeyAuthorization(token string, key interface{}) (string, error) {
 	return token + "." + keyThumb, nil
 }
 
-// parsePEMBundle parses a certificate bundle from top to bottom and returns
+// ParsePEMBundle parses a certificate bundle from top to bottom and returns
 // a slice of x509 certificates. This function will error if no certificates are found.
-func parsePEMBundle(bundle []byte) ([]*x509.Certificate, error) {
+func ParsePEMBundle(bundle []byte) ([]*x509.Certificate, error) {
 	var certificates []*x509.Certificate
 	var certDERBlock *pem.Block
 
@@ -182,6 +189,22 @@ func parsePEMBundle(bundle []byte) ([]*x509.Certificate, error) {
 	return certificates, nil
 }
 
+// splitPEMBundle splits a PEM bundle into its first block and the remaining blocks.
+// The blocks are returned as is, the remaining blocks are nil if there are none.
+// A bundle without PEM block is returned unchanged as the first block.
+func splitPEMBundle(bundle []byte) (first, rest []byte) {
+	block, rest := pem.Decode(bundle)
+	if block == nil {
+		return bundle, nil
+	}
+
+	first = bundle[:len(bundle)-len(rest)]
+	if len(bytes.TrimSpace(rest)) == 0 {
+		return first, nil
+	}
+	return first, rest
+}
+
 func parsePEMPrivateKey(key []byte) (crypto.PrivateKey, error) {
 	keyBlock, _ := pem.Decode(key)
 
@@ -195,7 +218,8 @@ func parsePEMPrivateKey(key []byte) (crypto.PrivateKey, error) {
 	}
 }
 
-func generatePrivateKey(keyType KeyType) (crypto.PrivateKey, error) {
+// GeneratePrivateKey generates a private key of the given type.
+func GeneratePrivateKey(keyType KeyType) (crypto.PrivateKey, error) {
 
 	switch keyType {
 	case EC256:
@@ -213,13 +237,49 @@ func generatePrivateKey(keyType KeyType) (crypto.PrivateKey, error) {
 	return nil, fmt.Errorf("invalid KeyType: %s", keyType)
 }
 
+// checkCertificateKey checks that privKey is the private key of the certificate.
+func checkCertificateKey(cert *x509.Certificate, privKey crypto.PrivateKey) error {
+	signer, ok := privKey.(crypto.Signer)
+	if !ok {
+		return errors.New("acme: unsupported certificate private key type")
+	}
+
+	keyBytes, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return err
+	}
+	certKeyBytes, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(keyBytes, certKeyBytes) {
+		return errors.New("acme: the private key does not match the certificate")
+	}
+	return nil
+}
+
+// generateCsr generates a CSR for the domain and the SANs.
+// The IP addresses (RFC 8738) are added as IP SANs, and are not used as common name.
 func generateCsr(privateKey crypto.PrivateKey, domain string, san []string, mustStaple bool) ([]byte, error) {
-	template := x509.CertificateRequest{
-		Subject: pkix.Name{CommonName: domain},
+	template := x509.CertificateRequest{}
+
+	if net.ParseIP(domain) == nil {
+		template.Subject = pkix.Name{CommonName: domain}
 	}
 
-	if len(san) > 0 {
-		template.DNSNames = san
+	ips := make(map[string]bool)
+	for _, name := range san {
+		ip := net.ParseIP(name)
+		if ip == nil {
+			template.DNSNames = append(template.DNSNames, name)
+			continue
+		}
+
+		if !ips[ip.String()] {
+			ips[ip.String()] = true
+			template.IPAddresses = append(template.IPAddresses, ip)
+		}
 	}
 
 	if mustStaple {
@@ -291,6 +351,43 @@ func GetPEMCertExpiration(cert []byte) (time.Time, error) {
 	return getCertExpiration(pemBlock.Bytes)
 }
 
+// NeedsRenewal checks whether the PEM encoded certificate (or bundle) should be renewed,
+// because it expires within the given number of days, or, if checkOCSP is true,
+// because its OCSP responder reports it as revoked.
+// The reason explains the decision. An unreachable OCSP responder does not
+// prevent the decision based on the expiration, but the reason mentions it.
+func NeedsRenewal(certPEM []byte, days int, checkOCSP bool) (bool, string, error) {
+	certificates, err := ParsePEMBundle(certPEM)
+	if err != nil {
+		return false, "", err
+	}
+
+	leaf := certificates[0]
+	daysLeft := int(time.Until(leaf.NotAfter).Hours() / 24.0)
+	if daysLeft <= days {
+		return true, fmt.Sprintf("the certificate expires in %d days", daysLeft), nil
+	}
+
+	reason := fmt.Sprintf("the certificate expires in %d days", daysLeft)
+	if !checkOCSP {
+		return false, reason, nil
+	}
+
+	_, ocspResp, err := GetOCSPForCert(certPEM)
+	if err != nil {
+		return false, fmt.Sprintf("%s, and the OCSP check failed: %v", reason, err), nil
+	}
+
+	switch ocspResp.Status {
+	case OCSPRevoked:
+		return true, fmt.Sprintf("the certificate was revoked at %s", ocspResp.RevokedAt.Format(time.RFC3339)), nil
+	case OCSPGood:
+		return false, fmt.Sprintf("%s, and OCSP reports it as good", reason), nil
+	default:
+		return false, fmt.Sprintf("%s, and OCSP could not report its status", reason), nil
+	}
+}
+
 // getCertExpiration returns the "NotAfter" date of a DER encoded certificate.
 func getCertExpiration(cert []byte) (time.Time, error) {
 	pCert, err := x509.ParseCertificate(cert)
@@ -331,10 +428,15 @@ func generateDerCert(privKey *rsa.PrivateKey, expiration time.Time, domain strin
 
 		KeyUsage:              x509.KeyUsageKeyEncipherment,
 		BasicConstraintsValid: true,
-		DNSNames:              []string{domain},
 		ExtraExtensions:       extensions,
 	}
 
+	if ip := net.ParseIP(domain); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{domain}
+	}
+
 	return x509.CreateCertificate(rand.Reader, &template, &template, &privKey.PublicKey, privKey)
 }
 
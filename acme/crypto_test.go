@@ -2,14 +2,21 @@ package acme
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
 	"testing"
 	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
 )
 
 func TestGeneratePrivateKey(t *testing.T) {
-	key, err := generatePrivateKey(RSA2048)
+	key, err := GeneratePrivateKey(RSA2048)
 	if err != nil {
 		t.Error("Error generating private key:", err)
 	}
@@ -53,7 +60,7 @@ func TestPEMEncode(t *testing.T) {
 }
 
 func TestPEMCertExpiration(t *testing.T) {
-	privKey, err := generatePrivateKey(RSA2048)
+	privKey, err := GeneratePrivateKey(RSA2048)
 	if err != nil {
 		t.Fatal("Error generating private key:", err)
 	}
@@ -91,3 +98,197 @@ type MockRandReader struct {
 func (r MockRandReader) Read(p []byte) (int, error) {
 	return r.b.Read(p)
 }
+
+func TestNeedsRenewal(t *testing.T) {
+	privKey, err := GeneratePrivateKey(RSA2048)
+	if err != nil {
+		t.Fatal("Error generating private key:", err)
+	}
+
+	certBytes, err := generateDerCert(privKey.(*rsa.PrivateKey), time.Now().Add(10*24*time.Hour+time.Hour), "test.com", nil)
+	if err != nil {
+		t.Fatal("Error generating cert:", err)
+	}
+	pemCert := pemEncode(derCertificateBytes(certBytes))
+
+	testCases := []struct {
+		desc      string
+		days      int
+		checkOCSP bool
+		expected  bool
+		reason    string
+	}{
+		{desc: "expires within the threshold", days: 30, expected: true, reason: "expires in 10 days"},
+		{desc: "expires after the threshold", days: 5, expected: false, reason: "expires in 10 days"},
+		{desc: "unreachable OCSP responder", days: 5, checkOCSP: true, expected: false, reason: "OCSP check failed"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			renew, reason, err := NeedsRenewal(pemCert, test.days, test.checkOCSP)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if renew != test.expected {
+				t.Errorf("Expected renewal to be %t, got %t (%s)", test.expected, renew, reason)
+			}
+			if !strings.Contains(reason, test.reason) {
+				t.Errorf("Expected the reason to contain %q, got %q", test.reason, reason)
+			}
+		})
+	}
+
+	if _, _, err := NeedsRenewal([]byte("not a certificate"), 30, false); err == nil {
+		t.Error("Expected an error for an invalid certificate")
+	}
+}
+
+func TestGenerateCSRWithIPAddresses(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Error generating private key:", err)
+	}
+
+	csrBytes, err := generateCsr(key, "192.0.2.10", []string{"192.0.2.10", "example.com", "2001:db8::1", "2001:DB8:0::1"}, false)
+	if err != nil {
+		t.Fatal("Error generating CSR:", err)
+	}
+
+	csr, err := x509.ParseCertificateRequest(csrBytes)
+	if err != nil {
+		t.Fatal("Error parsing CSR:", err)
+	}
+
+	if csr.Subject.CommonName != "" {
+		t.Errorf("Expected no common name for an IP address, got %q", csr.Subject.CommonName)
+	}
+	if len(csr.DNSNames) != 1 || csr.DNSNames[0] != "example.com" {
+		t.Errorf("Expected the DNS names [example.com], got %v", csr.DNSNames)
+	}
+	if len(csr.IPAddresses) != 2 || csr.IPAddresses[0].String() != "192.0.2.10" || csr.IPAddresses[1].String() != "2001:db8::1" {
+		t.Errorf("Expected the IP addresses [192.0.2.10 2001:db8::1], got %v", csr.IPAddresses)
+	}
+}
+
+func TestCertificateResourcePEM(t *testing.T) {
+	privKey, err := GeneratePrivateKey(RSA2048)
+	if err != nil {
+		t.Fatal("Error generating private key:", err)
+	}
+	leaf, err := generatePemCert(privKey.(*rsa.PrivateKey), "example.com", nil)
+	if err != nil {
+		t.Fatal("Error generating cert:", err)
+	}
+	issuerDER, err := generateDerCert(privKey.(*rsa.PrivateKey), time.Time{}, "issuer.example.com", nil)
+	if err != nil {
+		t.Fatal("Error generating cert:", err)
+	}
+	issuer := pemEncode(derCertificateBytes(issuerDER))
+	key := pemEncode(privKey)
+
+	expected := bytes.Join([][]byte{key, leaf, issuer}, nil)
+
+	// the issuer is included whether the certificate is a bundle or not.
+	testCases := []struct {
+		desc    string
+		certRes CertificateResource
+	}{
+		{desc: "bundle", certRes: CertificateResource{PrivateKey: key, Certificate: append(append([]byte{}, leaf...), issuer...), IssuerCertificate: issuer}},
+		{desc: "no bundle", certRes: CertificateResource{PrivateKey: key, Certificate: leaf, IssuerCertificate: issuer}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			data, err := test.certRes.PEM()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !bytes.Equal(data, expected) {
+				t.Errorf("Expected the key, the leaf and the issuer\n%s\ngot\n%s", expected, data)
+			}
+		})
+	}
+
+	if _, err := (&CertificateResource{Certificate: leaf}).PEM(); err == nil {
+		t.Error("Expected an error without private key")
+	}
+}
+
+func TestCertificateResourcePKCS12(t *testing.T) {
+	issuerKey, err := GeneratePrivateKey(EC256)
+	if err != nil {
+		t.Fatal("Error generating private key:", err)
+	}
+	issuer := generateTestCertificate(t, issuerKey, "issuer.example.com")
+
+	for _, keyType := range []KeyType{RSA2048, EC256} {
+		t.Run(string(keyType), func(t *testing.T) {
+			privKey, err := GeneratePrivateKey(keyType)
+			if err != nil {
+				t.Fatal("Error generating private key:", err)
+			}
+			leaf := generateTestCertificate(t, privKey, "example.com")
+
+			certRes := CertificateResource{
+				PrivateKey:        pemEncode(privKey),
+				Certificate:       pemEncode(derCertificateBytes(leaf.Raw)),
+				IssuerCertificate: pemEncode(derCertificateBytes(issuer.Raw)),
+			}
+			pfxData, err := certRes.PKCS12("changeit")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			decodedKey, decodedLeaf, chain, err := pkcs12.DecodeChain(pfxData, "changeit")
+			if err != nil {
+				t.Fatalf("Could not decode the archive: %v", err)
+			}
+			if !bytes.Equal(decodedLeaf.Raw, leaf.Raw) {
+				t.Error("Expected the leaf certificate")
+			}
+			if len(chain) != 1 || !bytes.Equal(chain[0].Raw, issuer.Raw) {
+				t.Errorf("Expected the issuer certificate, got %d certificates", len(chain))
+			}
+			if err = checkCertificateKey(leaf, decodedKey); err != nil {
+				t.Error(err)
+			}
+
+			if _, _, _, err = pkcs12.DecodeChain(pfxData, "wrong"); err == nil {
+				t.Error("Expected an error decoding with a wrong password")
+			}
+		})
+	}
+
+	otherKey, err := GeneratePrivateKey(EC256)
+	if err != nil {
+		t.Fatal("Error generating private key:", err)
+	}
+	certRes := CertificateResource{PrivateKey: pemEncode(otherKey), Certificate: pemEncode(derCertificateBytes(issuer.Raw))}
+	if _, err = certRes.PKCS12("changeit"); err == nil {
+		t.Error("Expected an error for a private key not matching the certificate")
+	}
+	if _, err = (&CertificateResource{Certificate: certRes.Certificate}).PKCS12("changeit"); err == nil {
+		t.Error("Expected an error without private key")
+	}
+}
+
+func generateTestCertificate(t *testing.T, privKey crypto.PrivateKey, commonName string) *x509.Certificate {
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+
+	signer := privKey.(crypto.Signer)
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, signer.Public(), signer)
+	if err != nil {
+		t.Fatal("Error generating cert:", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
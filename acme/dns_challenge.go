@@ -1,27 +1,46 @@
 package acme
 
 import (
-	"crypto/sha256"
-	"encoding/base64"
+	"context"
 	"errors"
 	"fmt"
 	"net"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/miekg/dns"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/log"
+	"github.com/xenolf/lego/platform/wait"
 )
 
-type preCheckDNSFunc func(fqdn, value string) (bool, error)
+// PreCheckFunc checks whether the TXT record fqdn with the given value
+// is ready to be validated by the ACME server.
+type PreCheckFunc func(fqdn, value string) (bool, error)
+
+// WrapPreCheckFunc checks whether the TXT record of the dns-01 challenge of domain is ready
+// to be validated. check is the check lego would run otherwise, which can be called or not.
+type WrapPreCheckFunc func(domain, fqdn, value string, check PreCheckFunc) (bool, error)
 
 var (
 	// PreCheckDNS checks DNS propagation before notifying ACME that
 	// the DNS challenge is ready.
-	PreCheckDNS preCheckDNSFunc = checkDNSPropagation
-	fqdnToZone                  = map[string]string{}
+	PreCheckDNS PreCheckFunc = checkDNSPropagation
+
+	// preCheckWrapper overrides the pre-check of the dns-01 challenges, if not nil.
+	preCheckWrapper WrapPreCheckFunc
 )
 
+// DNS01WrapPreCheck wraps or replaces the check of the TXT record
+// run before notifying ACME that a dns-01 challenge is ready.
+// The wrapper receives the check lego would run otherwise: the PreCheck method
+// of the provider if it implements ChallengeProviderPreCheck, PreCheckDNS if not.
+func DNS01WrapPreCheck(wrap WrapPreCheckFunc) {
+	preCheckWrapper = wrap
+}
+
 const defaultResolvConf = "/etc/resolv.conf"
 
 var defaultNameservers = []string{
@@ -30,11 +49,112 @@ var defaultNameservers = []string{
 }
 
 // RecursiveNameservers are used to pre-check DNS propagations
+// by the clients created without WithDNSResolvers, and to find the zones of the providers.
 var RecursiveNameservers = getNameservers(defaultResolvConf, defaultNameservers)
 
+// SetRecursiveNameservers replaces the nameservers used to pre-check DNS propagations
+// and to find the zone of a domain.
+// Each nameserver can be given as host, host:port or as an IPv6 literal (with or without a port).
+// The default port 53 is used when no port is specified.
+//
+// Deprecated: it applies to every client of the process, use WithDNSResolvers.
+// The providers still find their zones with RecursiveNameservers.
+func SetRecursiveNameservers(nameservers []string) error {
+	if len(nameservers) == 0 {
+		return errors.New("no recursive nameservers provided")
+	}
+
+	var servers []string
+	for _, ns := range nameservers {
+		server, err := parseNameserver(ns)
+		if err != nil {
+			return err
+		}
+		servers = append(servers, server)
+	}
+
+	RecursiveNameservers = servers
+	return nil
+}
+
+// recursiveNameservers returns the nameservers, or RecursiveNameservers if there are none.
+func recursiveNameservers(nameservers []string) []string {
+	if len(nameservers) == 0 {
+		return RecursiveNameservers
+	}
+	return nameservers
+}
+
+// parseNameserver validates a nameserver and returns it in the host:port form.
+func parseNameserver(ns string) (string, error) {
+	ns = strings.TrimSpace(ns)
+
+	host, port, err := net.SplitHostPort(ns)
+	if err != nil {
+		// no port: the value is a host or a (bracketed) IPv6 literal.
+		host, port = strings.TrimSuffix(strings.TrimPrefix(ns, "["), "]"), "53"
+	}
+
+	if host == "" || strings.ContainsAny(host, "[]/ ") {
+		return "", fmt.Errorf("invalid nameserver %q", ns)
+	}
+
+	if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+		return "", fmt.Errorf("invalid port for nameserver %q", ns)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
 // DNSTimeout is used to override the default DNS timeout of 10 seconds.
 var DNSTimeout = 10 * time.Second
 
+// RequireCompletePropagation controls whether all the authoritative nameservers
+// must serve the TXT record of a dns-01 challenge (the default),
+// or if one of them is enough, before notifying ACME that the challenge is ready.
+var RequireCompletePropagation = true
+
+const (
+	// dnsPropagationTimeoutEnvVar is the environment variable name that can be used
+	// to override the DNS propagation timeout (in seconds) of every DNS provider.
+	dnsPropagationTimeoutEnvVar = "LEGO_DNS_PROPAGATION_TIMEOUT"
+
+	// dnsPollingIntervalEnvVar is the environment variable name that can be used
+	// to override the DNS propagation polling interval (in seconds) of every DNS provider.
+	dnsPollingIntervalEnvVar = "LEGO_DNS_POLLING_INTERVAL"
+)
+
+const (
+	// DefaultPropagationTimeout is the DNS propagation timeout of the providers not implementing Timeout.
+	DefaultPropagationTimeout = 60 * time.Second
+
+	// DefaultPollingInterval is the DNS propagation polling interval of the providers not implementing Timeout.
+	DefaultPollingInterval = 2 * time.Second
+)
+
+var (
+	dnsPropagationTimeout time.Duration
+	dnsPollingInterval    time.Duration
+
+	disableCompletePropagation bool
+)
+
+// DNS01SetPropagationTimeout overrides the timeout and interval used when checking
+// for DNS record propagation, whatever the DNS provider reports.
+// A zero value leaves the corresponding setting to the environment, the provider or the default.
+func DNS01SetPropagationTimeout(timeout, interval time.Duration) {
+	dnsPropagationTimeout = timeout
+	dnsPollingInterval = interval
+}
+
+// DNS01DisableCompletePropagationRequirement disables the verification that all the authoritative
+// nameservers serve the TXT record before notifying ACME that the DNS challenge is ready.
+// Only the polling interval of the provider is waited instead.
+// This is meant for split-horizon setups where the record can never be seen by lego itself.
+func DNS01DisableCompletePropagationRequirement() {
+	disableCompletePropagation = true
+}
+
 // getNameservers attempts to get systems nameservers before falling back to the defaults
 func getNameservers(path string, defaults []string) []string {
 	config, err := dns.ClientConfigFromFile(path)
@@ -54,14 +174,40 @@ func getNameservers(path string, defaults []string) []string {
 	return systemNameservers
 }
 
-// DNS01Record returns a DNS record which will fulfill the `dns-01` challenge
+func init() {
+	dns01.SetCNAMELookup(lookupCNAME)
+}
+
+// DNS01Record returns a DNS record which will fulfill the `dns-01` challenge.
+// When LEGO_EXPERIMENTAL_CNAME_SUPPORT is true, the CNAME chain of the challenge FQDN
+// is followed and the returned fqdn is the final target of the chain.
+//
+// Deprecated: use dns01.GetRecord, the TTL is dns01.DefaultTTL.
 func DNS01Record(domain, keyAuth string) (fqdn string, value string, ttl int) {
-	keyAuthShaBytes := sha256.Sum256([]byte(keyAuth))
-	// base64URL encoding without padding
-	value = base64.RawURLEncoding.EncodeToString(keyAuthShaBytes[:sha256.Size])
-	ttl = 120
-	fqdn = fmt.Sprintf("_acme-challenge.%s.", domain)
-	return
+	fqdn, value = dns01.GetRecord(domain, keyAuth)
+	return fqdn, value, dns01.DefaultTTL
+}
+
+// lookupCNAME returns the target of the CNAME record of fqdn, using the recursive nameservers.
+func lookupCNAME(fqdn string) (string, error) {
+	r, err := dnsQuery(fqdn, dns.TypeCNAME, RecursiveNameservers, true)
+	if err != nil {
+		return "", err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return "", nil
+	}
+	return cnameTarget(r, fqdn), nil
+}
+
+// cnameTarget returns the target of the CNAME record of fqdn in the answer section, if any.
+func cnameTarget(msg *dns.Msg, fqdn string) string {
+	for _, rr := range msg.Answer {
+		if cn, ok := rr.(*dns.CNAME); ok && strings.EqualFold(cn.Hdr.Name, fqdn) {
+			return cn.Target
+		}
+	}
+	return ""
 }
 
 // dnsChallenge implements the dns-01 challenge according to ACME 7.5
@@ -69,14 +215,39 @@ type dnsChallenge struct {
 	jws      *jws
 	validate validateFunc
 	provider ChallengeProvider
+	// providers are the providers set by Client.SetDNSProviderForDomain, by domain.
+	// They are not modified once the solver is created.
+	providers map[string]ChallengeProvider
+	// requireAllNameservers is set by Client.SetDNSRequireAllNameservers.
+	requireAllNameservers bool
+	// resolvers are the recursive nameservers set by WithDNSResolvers, RecursiveNameservers if nil.
+	resolvers []string
+}
+
+// providerFor returns the provider of the domain: the one of its closest parent domain
+// set by Client.SetDNSProviderForDomain, or the default provider.
+func (s *dnsChallenge) providerFor(domain string) ChallengeProvider {
+	name := strings.TrimSuffix(strings.ToLower(domain), ".")
+	for {
+		if provider, ok := s.providers[name]; ok {
+			return provider
+		}
+
+		i := strings.Index(name, ".")
+		if i < 0 {
+			return s.provider
+		}
+		name = name[i+1:]
+	}
 }
 
 // PreSolve just submits the txt record to the dns provider. It does not validate record propagation, or
 // do anything at all with the acme server.
 func (s *dnsChallenge) PreSolve(chlng challenge, domain string) error {
-	log.Infof("[%s] acme: Preparing to solve DNS-01", domain)
+	s.jws.logger().Infof("[%s] acme: Preparing to solve DNS-01", domain)
 
-	if s.provider == nil {
+	provider := s.providerFor(domain)
+	if provider == nil {
 		return errors.New("no DNS Provider configured")
 	}
 
@@ -86,7 +257,7 @@ func (s *dnsChallenge) PreSolve(chlng challenge, domain string) error {
 		return err
 	}
 
-	err = s.provider.Present(domain, chlng.Token, keyAuth)
+	err = presentChallenge(provider, chlng, domain, keyAuth)
 	if err != nil {
 		return fmt.Errorf("error presenting token: %s", err)
 	}
@@ -94,8 +265,8 @@ func (s *dnsChallenge) PreSolve(chlng challenge, domain string) error {
 	return nil
 }
 
-func (s *dnsChallenge) Solve(chlng challenge, domain string) error {
-	log.Infof("[%s] acme: Trying to solve DNS-01", domain)
+func (s *dnsChallenge) Solve(ctx context.Context, chlng challenge, domain string) error {
+	s.jws.logger().Infof("[%s] acme: Trying to solve DNS-01", domain)
 
 	// Generate the Key Authorization for the challenge
 	keyAuth, err := getKeyAuthorization(chlng.Token, s.jws.privKey)
@@ -103,26 +274,122 @@ func (s *dnsChallenge) Solve(chlng challenge, domain string) error {
 		return err
 	}
 
-	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	record := challengeRecordFrom(ctx)
+	start := record.start()
+	err = s.waitForPropagation(ctx, domain, keyAuth)
+	record.end(phasePropagation, start)
+	if err != nil {
+		return err
+	}
+
+	start = record.start()
+	defer record.end(phaseValidation, start)
 
-	log.Infof("[%s] Checking DNS record propagation using %+v", domain, RecursiveNameservers)
+	return s.validate(ctx, s.jws, domain, chlng.URL, challenge{Type: chlng.Type, Token: chlng.Token, KeyAuthorization: keyAuth})
+}
 
-	var timeout, interval time.Duration
-	switch provider := s.provider.(type) {
-	case ChallengeProviderTimeout:
-		timeout, interval = provider.Timeout()
-	default:
-		timeout, interval = 60*time.Second, 2*time.Second
+// waitForPropagation waits until the TXT record of the challenge of domain is ready to be validated.
+func (s *dnsChallenge) waitForPropagation(ctx context.Context, domain, keyAuth string) error {
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+
+	timeout, interval := s.timeouts(domain)
+
+	if disableCompletePropagation {
+		s.jws.logger().Warnf("[%s] acme: DNS propagation check is DISABLED, waiting %s before validation without checking the authoritative nameservers", domain, interval)
+		if err := wait.Sleep(ctx, interval); err != nil {
+			return fmt.Errorf("[%s] acme: waiting before validation aborted: %v", domain, err)
+		}
+		return nil
 	}
 
-	err = WaitFor(timeout, interval, func() (bool, error) {
-		return PreCheckDNS(fqdn, value)
+	s.jws.logger().Infof("[%s] acme: Checking DNS record propagation using %+v (timeout: %s, interval: %s)", domain, recursiveNameservers(s.resolvers), timeout, interval)
+
+	check := s.preCheck(domain)
+	var attempt int
+	err := WaitForWithContext(ctx, timeout, interval, func() (bool, error) {
+		attempt++
+		ok, err := check(fqdn, value)
+		switch {
+		case ok:
+			s.jws.logger().Debugf("[%s] acme: The TXT record %s is propagated (attempt %d)", domain, fqdn, attempt)
+		case err != nil:
+			s.jws.logger().Debugf("[%s] acme: The TXT record %s is not propagated yet (attempt %d): %v", domain, fqdn, attempt, err)
+		default:
+			s.jws.logger().Debugf("[%s] acme: The TXT record %s is not propagated yet (attempt %d)", domain, fqdn, attempt)
+		}
+		return ok, err
 	})
 	if err != nil {
-		return err
+		return fmt.Errorf("[%s] acme: DNS propagation check failed: %v", domain, err)
+	}
+	return nil
+}
+
+// preCheck returns the check of the TXT record of the challenge of domain.
+// The precedence is: the DNS01WrapPreCheck wrapper, the provider PreCheck method,
+// and finally PreCheckDNS (the check using the resolvers of WithDNSResolvers if set),
+// or the check of every address of the nameservers with Client.SetDNSRequireAllNameservers.
+func (s *dnsChallenge) preCheck(domain string) PreCheckFunc {
+	check := PreCheckDNS
+	if s.resolvers != nil {
+		check = func(fqdn, value string) (bool, error) {
+			return checkPropagation(fqdn, value, s.resolvers)
+		}
 	}
+	if s.requireAllNameservers {
+		timeout, interval := s.timeouts(domain)
+		check = newAllNameserversCheck(timeout, interval, s.resolvers).check
+	}
+	if provider, ok := s.providerFor(domain).(ChallengeProviderPreCheck); ok {
+		check = func(fqdn, value string) (bool, error) {
+			return provider.PreCheck(domain, fqdn, value)
+		}
+	}
+
+	if wrap := preCheckWrapper; wrap != nil {
+		original := check
+		check = func(fqdn, value string) (bool, error) {
+			return wrap(domain, fqdn, value, original)
+		}
+	}
+
+	return check
+}
+
+// timeouts returns the timeout and interval to use when checking for DNS propagation of the record of domain.
+// The precedence is: explicit override (DNS01SetPropagationTimeout, then environment variables),
+// the provider Timeout method, and finally the defaults.
+func (s *dnsChallenge) timeouts(domain string) (timeout, interval time.Duration) {
+	timeout, interval = DefaultPropagationTimeout, DefaultPollingInterval
+	if provider, ok := s.providerFor(domain).(ChallengeProviderTimeout); ok {
+		timeout, interval = provider.Timeout()
+	}
+
+	if d := durationFromEnv(dnsPropagationTimeoutEnvVar); d > 0 {
+		timeout = d
+	}
+	if d := durationFromEnv(dnsPollingIntervalEnvVar); d > 0 {
+		interval = d
+	}
+
+	if dnsPropagationTimeout > 0 {
+		timeout = dnsPropagationTimeout
+	}
+	if dnsPollingInterval > 0 {
+		interval = dnsPollingInterval
+	}
+
+	return timeout, interval
+}
 
-	return s.validate(s.jws, domain, chlng.URL, challenge{Type: chlng.Type, Token: chlng.Token, KeyAuthorization: keyAuth})
+// durationFromEnv returns the duration in seconds found in the given environment variable,
+// or zero if the variable is not set or is invalid.
+func durationFromEnv(envVar string) time.Duration {
+	v, err := strconv.Atoi(os.Getenv(envVar))
+	if err != nil || v <= 0 {
+		return 0
+	}
+	return time.Duration(v) * time.Second
 }
 
 // CleanUp cleans the challenge
@@ -131,64 +398,132 @@ func (s *dnsChallenge) CleanUp(chlng challenge, domain string) error {
 	if err != nil {
 		return err
 	}
-	return s.provider.CleanUp(domain, chlng.Token, keyAuth)
+	return cleanUpChallenge(s.providerFor(domain), chlng, domain, keyAuth)
 }
 
 // checkDNSPropagation checks if the expected TXT record has been propagated to all authoritative nameservers.
 func checkDNSPropagation(fqdn, value string) (bool, error) {
+	return checkPropagation(fqdn, value, nil)
+}
+
+// checkPropagation is checkDNSPropagation using the given recursive nameservers,
+// RecursiveNameservers if nil.
+func checkPropagation(fqdn, value string, resolvers []string) (bool, error) {
 	// Initial attempt to resolve at the recursive NS
-	r, err := dnsQuery(fqdn, dns.TypeTXT, RecursiveNameservers, true)
+	r, err := dnsQuery(fqdn, dns.TypeTXT, recursiveNameservers(resolvers), true)
 	if err != nil {
 		return false, err
 	}
 	if r.Rcode == dns.RcodeSuccess {
 		// If we see a CNAME here then use the alias
-		for _, rr := range r.Answer {
-			if cn, ok := rr.(*dns.CNAME); ok {
-				if cn.Hdr.Name == fqdn {
-					fqdn = cn.Target
-					break
-				}
-			}
+		if target := cnameTarget(r, fqdn); target != "" {
+			fqdn = target
 		}
 	}
 
-	authoritativeNss, err := lookupNameservers(fqdn)
+	if dohResolverURL != "" {
+		// The authoritative nameservers cannot be reached directly,
+		// so rely on the answer of the DNS-over-HTTPS resolver.
+		return checkTXTAnswer(r, value)
+	}
+
+	authoritativeNss, err := lookupNameservers(fqdn, resolvers)
 	if err != nil {
 		return false, err
 	}
 
-	return checkAuthoritativeNss(fqdn, value, authoritativeNss)
+	return checkAuthoritativeNss(fqdn, value, authoritativeNss, resolvers)
 }
 
 // checkAuthoritativeNss queries each of the given nameservers for the expected TXT record.
-func checkAuthoritativeNss(fqdn, value string, nameservers []string) (bool, error) {
+// All the nameservers must return it if RequireCompletePropagation is true, one is enough otherwise.
+// Their addresses are resolved by the recursive nameservers resolvers, RecursiveNameservers if nil.
+func checkAuthoritativeNss(fqdn, value string, nameservers, resolvers []string) (bool, error) {
+	var lastErr error
 	for _, ns := range nameservers {
-		r, err := dnsQuery(fqdn, dns.TypeTXT, []string{net.JoinHostPort(ns, "53")}, false)
+		err := checkAuthoritativeNs(fqdn, value, ns, resolvers)
 		if err != nil {
-			return false, err
+			if RequireCompletePropagation {
+				return false, err
+			}
+			lastErr = err
+			continue
 		}
 
-		if r.Rcode != dns.RcodeSuccess {
-			return false, fmt.Errorf("NS %s returned %s for %s", ns, dns.RcodeToString[r.Rcode], fqdn)
+		if !RequireCompletePropagation {
+			return true, nil
 		}
+	}
 
-		var found bool
-		for _, rr := range r.Answer {
-			if txt, ok := rr.(*dns.TXT); ok {
-				if strings.Join(txt.Txt, "") == value {
-					found = true
-					break
-				}
-			}
+	if lastErr != nil {
+		return false, lastErr
+	}
+	return true, nil
+}
+
+// nameserverAddr returns the address of the nameserver ns, given as a host, or as host:port.
+// It is overridden in the tests to reach the local nameservers.
+var nameserverAddr = func(ns string) string {
+	if _, _, err := net.SplitHostPort(ns); err != nil {
+		return net.JoinHostPort(ns, "53")
+	}
+	return ns
+}
+
+// checkAuthoritativeNs queries the given nameserver for the expected TXT record.
+// The nameserver is given as a host, or as host:port.
+// Its IPv4 and IPv6 addresses are tried in turn, the ones routable from this host first.
+func checkAuthoritativeNs(fqdn, value, ns string, resolvers []string) error {
+	addrs, err := resolveNameserver(ns, resolvers)
+	if err != nil {
+		// the system resolver may still find the address.
+		addrs = []string{nameserverAddr(ns)}
+	}
+
+	var r *dns.Msg
+	for _, addr := range addrs {
+		r, err = dnsQuery(fqdn, dns.TypeTXT, []string{addr}, false)
+		if err == nil {
+			break
 		}
+	}
+	if err != nil {
+		return fmt.Errorf("NS %s could not be queried at %s: %v", ns, strings.Join(addrs, ", "), err)
+	}
 
-		if !found {
-			return false, fmt.Errorf("NS %s did not return the expected TXT record", ns)
+	if r.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("NS %s returned %s for %s", ns, dns.RcodeToString[r.Rcode], fqdn)
+	}
+
+	if !containsTXT(r, value) {
+		return fmt.Errorf("NS %s did not return the expected TXT record", ns)
+	}
+	return nil
+}
+
+// containsTXT returns true if any of the TXT records of the answer has the expected value.
+// The record can be the target of a CNAME at the challenge name,
+// and a name can hold several values (e.g. for a wildcard and its apex domain).
+func containsTXT(r *dns.Msg, value string) bool {
+	for _, rr := range r.Answer {
+		if txt, ok := rr.(*dns.TXT); ok && strings.Join(txt.Txt, "") == value {
+			return true
 		}
 	}
+	return false
+}
 
-	return true, nil
+// checkTXTAnswer checks if the expected TXT record is in the answer of a recursive query.
+func checkTXTAnswer(r *dns.Msg, value string) (bool, error) {
+	if r.Rcode != dns.RcodeSuccess {
+		return false, fmt.Errorf("resolver returned %s", dns.RcodeToString[r.Rcode])
+	}
+
+	if containsTXT(r, value) {
+		return true, nil
+	}
+
+	return false, errors.New("resolver did not return the expected TXT record")
 }
 
 // dnsQuery will query a nameserver, iterating through the supplied servers as it retries
@@ -202,6 +537,14 @@ func dnsQuery(fqdn string, rtype uint16, nameservers []string, recursive bool) (
 		m.RecursionDesired = false
 	}
 
+	if recursive && dohResolverURL != "" {
+		in, err = dohQuery(m)
+		if err == nil || !dohFallback {
+			return in, err
+		}
+		log.Warnf("acme: %v; falling back to the recursive nameservers", err)
+	}
+
 	// Will retry the request based on the number of servers (n+1)
 	for i := 1; i <= len(nameservers)+1; i++ {
 		ns := nameservers[i%len(nameservers)]
@@ -217,20 +560,24 @@ func dnsQuery(fqdn string, rtype uint16, nameservers []string, recursive bool) (
 		if err == nil {
 			break
 		}
+
+		err = fmt.Errorf("DNS query for %s using %s failed: %v", fqdn, ns, err)
 	}
 	return
 }
 
-// lookupNameservers returns the authoritative nameservers for the given fqdn.
-func lookupNameservers(fqdn string) ([]string, error) {
+// lookupNameservers returns the authoritative nameservers for the given fqdn,
+// asking the recursive nameservers resolvers, RecursiveNameservers if nil.
+func lookupNameservers(fqdn string, resolvers []string) ([]string, error) {
 	var authoritativeNss []string
 
-	zone, err := FindZoneByFqdn(fqdn, RecursiveNameservers)
+	resolvers = recursiveNameservers(resolvers)
+	zone, err := FindZoneByFqdn(fqdn, resolvers)
 	if err != nil {
 		return nil, fmt.Errorf("Could not determine the zone: %v", err)
 	}
 
-	r, err := dnsQuery(zone, dns.TypeNS, RecursiveNameservers, true)
+	r, err := dnsQuery(zone, dns.TypeNS, resolvers, true)
 	if err != nil {
 		return nil, err
 	}
@@ -249,9 +596,14 @@ func lookupNameservers(fqdn string) ([]string, error) {
 
 // FindZoneByFqdn determines the zone apex for the given fqdn by recursing up the
 // domain labels until the nameserver returns a SOA record in the answer section.
+// The labels which do not exist (NXDOMAIN) or are CNAMEs are walked over,
+// and a label answered with SERVFAIL or REFUSED is asked to the next nameserver.
+// The zone is cached for the TTL of the SOA record, up to an hour;
+// the labels walked over are not cached.
 func FindZoneByFqdn(fqdn string, nameservers []string) (string, error) {
-	// Do we have it cached?
-	if zone, ok := fqdnToZone[fqdn]; ok {
+	// Do we have it cached? The clients may use different nameservers.
+	cacheKey := fqdn + "@" + strings.Join(nameservers, ",")
+	if zone, ok := fqdnToZone.get(cacheKey, time.Now()); ok {
 		return zone, nil
 	}
 
@@ -259,52 +611,63 @@ func FindZoneByFqdn(fqdn string, nameservers []string) (string, error) {
 	for _, index := range labelIndexes {
 		domain := fqdn[index:]
 
-		in, err := dnsQuery(domain, dns.TypeSOA, nameservers, true)
+		in, err := querySOA(domain, nameservers)
 		if err != nil {
 			return "", err
 		}
 
-		// Any response code other than NOERROR and NXDOMAIN is treated as error
-		if in.Rcode != dns.RcodeNameError && in.Rcode != dns.RcodeSuccess {
-			return "", fmt.Errorf("Unexpected response code '%s' for %s",
-				dns.RcodeToString[in.Rcode], domain)
+		// NXDOMAIN: the label does not exist, its parent may be the zone.
+		if in.Rcode != dns.RcodeSuccess {
+			continue
 		}
 
-		// Check if we got a SOA RR in the answer section
-		if in.Rcode == dns.RcodeSuccess {
+		if soa := soaOf(in, domain); soa != nil {
+			zone := soa.Hdr.Name
+			fqdnToZone.set(cacheKey, zone, time.Duration(soa.Hdr.Ttl)*time.Second, time.Now())
+			return zone, nil
+		}
+	}
 
-			// CNAME records cannot/should not exist at the root of a zone.
-			// So we skip a domain when a CNAME is found.
-			if dnsMsgContainsCNAME(in) {
-				continue
-			}
+	return "", fmt.Errorf("Could not find the start of authority of %s", fqdn)
+}
 
-			for _, ans := range in.Answer {
-				if soa, ok := ans.(*dns.SOA); ok {
-					zone := soa.Hdr.Name
-					fqdnToZone[fqdn] = zone
-					return zone, nil
-				}
-			}
+// querySOA queries the SOA record of domain, asking the next nameserver
+// if a nameserver cannot answer it (SERVFAIL) or refuses to (REFUSED).
+// The answer is either NOERROR or NXDOMAIN.
+func querySOA(domain string, nameservers []string) (*dns.Msg, error) {
+	var errs []string
+	for _, ns := range nameservers {
+		in, err := dnsQuery(domain, dns.TypeSOA, []string{ns}, true)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		switch in.Rcode {
+		case dns.RcodeSuccess, dns.RcodeNameError:
+			return in, nil
+		case dns.RcodeServerFailure, dns.RcodeRefused:
+			errs = append(errs, fmt.Sprintf("%s answered %s", ns, dns.RcodeToString[in.Rcode]))
+		default:
+			// Any other response code is not a failure of the nameserver.
+			return nil, fmt.Errorf("Unexpected response code '%s' for %s from %s",
+				dns.RcodeToString[in.Rcode], domain, ns)
 		}
 	}
 
-	return "", fmt.Errorf("Could not find the start of authority")
+	return nil, fmt.Errorf("Could not query the SOA record of %s: %s", domain, strings.Join(errs, "; "))
 }
 
-// dnsMsgContainsCNAME checks for a CNAME answer in msg
-func dnsMsgContainsCNAME(msg *dns.Msg) bool {
+// soaOf returns the SOA record of domain in the answer section, nil if domain is not a zone apex.
+// CNAME records cannot exist at the apex of a zone: if domain is a CNAME,
+// the SOA answered is the one of the target of the CNAME chain, not of domain.
+func soaOf(msg *dns.Msg, domain string) *dns.SOA {
 	for _, ans := range msg.Answer {
-		if _, ok := ans.(*dns.CNAME); ok {
-			return true
+		if soa, ok := ans.(*dns.SOA); ok && strings.EqualFold(soa.Hdr.Name, domain) {
+			return soa
 		}
 	}
-	return false
-}
-
-// ClearFqdnCache clears the cache of fqdn to zone mappings. Primarily used in testing.
-func ClearFqdnCache() {
-	fqdnToZone = map[string]string{}
+	return nil
 }
 
 // ToFqdn converts the name into a fqdn appending a trailing dot.
@@ -0,0 +1,228 @@
+package acme
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/xenolf/lego/log"
+)
+
+// allNameserversCheck is the propagation check of Client.SetDNSRequireAllNameservers:
+// every address of every authoritative nameserver of the zone must serve the TXT record.
+type allNameserversCheck struct {
+	// deadline is the end of the retries of the unreachable nameservers.
+	deadline time.Time
+	// resolvers are the recursive nameservers, RecursiveNameservers if nil.
+	resolvers []string
+}
+
+// newAllNameserversCheck returns the check of a challenge whose propagation is checked every interval up to timeout,
+// using the recursive nameservers resolvers (RecursiveNameservers if nil).
+// The unreachable nameservers are retried until the last check.
+func newAllNameserversCheck(timeout, interval time.Duration, resolvers []string) *allNameserversCheck {
+	return &allNameserversCheck{deadline: time.Now().Add(timeout - interval), resolvers: resolvers}
+}
+
+// nameserverStatus is the outcome of the query of an address of an authoritative nameserver.
+type nameserverStatus struct {
+	ns   string
+	addr string
+	// reachable is true if the nameserver answered the query.
+	reachable bool
+	// unroutable is true if this host has no route to the address, which is then not queried.
+	unroutable bool
+	ok         bool
+	err        error
+}
+
+func (s nameserverStatus) String() string {
+	switch {
+	case s.ok:
+		return fmt.Sprintf("NS %s (%s): ok", s.ns, s.addr)
+	case !s.reachable:
+		return fmt.Sprintf("NS %s (%s): unreachable: %v", s.ns, s.addr, s.err)
+	default:
+		return fmt.Sprintf("NS %s (%s): %v", s.ns, s.addr, s.err)
+	}
+}
+
+// check checks that every address of the authoritative nameservers of fqdn serves the expected TXT record.
+// The check fails while a nameserver is unreachable, up to the deadline:
+// the nameservers still unreachable then are ignored if all the others serve the record.
+func (c *allNameserversCheck) check(fqdn, value string) (bool, error) {
+	r, err := dnsQuery(fqdn, dns.TypeTXT, recursiveNameservers(c.resolvers), true)
+	if err != nil {
+		return false, err
+	}
+	if r.Rcode == dns.RcodeSuccess {
+		// If we see a CNAME here then use the alias
+		if target := cnameTarget(r, fqdn); target != "" {
+			fqdn = target
+		}
+	}
+
+	nameservers, err := lookupNameservers(fqdn, c.resolvers)
+	if err != nil {
+		return false, err
+	}
+
+	statuses := checkNameserverAddresses(fqdn, value, nameservers, c.resolvers)
+
+	var missing, unreachable []string
+	var routed int
+	for _, status := range statuses {
+		if status.unroutable {
+			continue
+		}
+		routed++
+
+		switch {
+		case !status.reachable:
+			unreachable = append(unreachable, status.String())
+		case !status.ok:
+			missing = append(missing, status.String())
+		}
+	}
+
+	switch {
+	case routed == 0:
+		return false, fmt.Errorf("no address of the nameservers is routable from this host: %s", joinStatuses(statuses))
+	case len(missing) == 0 && len(unreachable) == 0:
+		return true, nil
+	case len(missing) == 0 && !time.Now().Before(c.deadline):
+		log.Warnf("acme: Every reachable nameserver serves the TXT record of %s, ignoring the unreachable ones: %s", fqdn, strings.Join(unreachable, "; "))
+		return true, nil
+	}
+
+	return false, errors.New(strings.Join(append(missing, unreachable...), "; "))
+}
+
+func joinStatuses(statuses []nameserverStatus) string {
+	var s []string
+	for _, status := range statuses {
+		s = append(s, status.String())
+	}
+	return strings.Join(s, "; ")
+}
+
+// checkNameserverAddresses queries every address of the nameservers for the expected TXT record, concurrently.
+func checkNameserverAddresses(fqdn, value string, nameservers, resolvers []string) []nameserverStatus {
+	var statuses []nameserverStatus
+	for _, ns := range nameservers {
+		addrs, err := resolveNameserver(ns, resolvers)
+		if err != nil {
+			statuses = append(statuses, nameserverStatus{ns: ns, addr: nameserverAddr(ns), err: err})
+			continue
+		}
+		for _, addr := range addrs {
+			statuses = append(statuses, nameserverStatus{ns: ns, addr: addr})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range statuses {
+		if statuses[i].err != nil {
+			continue
+		}
+		if !addrRoutable(statuses[i].addr) {
+			statuses[i].unroutable = true
+			statuses[i].err = errors.New("no route from this host")
+			continue
+		}
+
+		wg.Add(1)
+		go func(status *nameserverStatus) {
+			defer wg.Done()
+
+			r, err := dnsQuery(fqdn, dns.TypeTXT, []string{status.addr}, false)
+			switch {
+			case err != nil:
+				status.err = err
+			case r.Rcode != dns.RcodeSuccess:
+				status.reachable = true
+				status.err = fmt.Errorf("returned %s for %s", dns.RcodeToString[r.Rcode], fqdn)
+			case !containsTXT(r, value):
+				status.reachable = true
+				status.err = errors.New("did not return the expected TXT record")
+			default:
+				status.reachable = true
+				status.ok = true
+			}
+		}(&statuses[i])
+	}
+	wg.Wait()
+
+	return statuses
+}
+
+// resolveNameserver returns the IPv4 and IPv6 addresses of the nameserver ns, with their port,
+// resolved by the recursive nameservers resolvers, RecursiveNameservers if nil.
+// The addresses routable from this host come first, e.g. the IPv6 addresses on an IPv6-only host.
+func resolveNameserver(ns string, resolvers []string) ([]string, error) {
+	host, port, err := net.SplitHostPort(nameserverAddr(ns))
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return []string{net.JoinHostPort(host, port)}, nil
+	}
+
+	var addrs []string
+	var errs []string
+	for _, rtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		r, err := dnsQuery(dns.Fqdn(host), rtype, recursiveNameservers(resolvers), true)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		for _, rr := range r.Answer {
+			switch rr := rr.(type) {
+			case *dns.A:
+				addrs = append(addrs, net.JoinHostPort(rr.A.String(), port))
+			case *dns.AAAA:
+				addrs = append(addrs, net.JoinHostPort(rr.AAAA.String(), port))
+			}
+		}
+	}
+
+	switch {
+	case len(addrs) > 0:
+		return routableFirst(addrs), nil
+	case len(errs) > 0:
+		return nil, fmt.Errorf("could not resolve the nameserver: %s", strings.Join(errs, "; "))
+	default:
+		return nil, fmt.Errorf("the nameserver %s has no address", host)
+	}
+}
+
+// routableFirst sorts the addresses routable from this host first, keeping their order otherwise.
+func routableFirst(addrs []string) []string {
+	var routable, others []string
+	for _, addr := range addrs {
+		if addrRoutable(addr) {
+			routable = append(routable, addr)
+		} else {
+			others = append(others, addr)
+		}
+	}
+	return append(routable, others...)
+}
+
+// addrRoutable returns true if this host has a route to the UDP address,
+// e.g. false for an IPv4 address on an IPv6-only host.
+// Connecting a UDP socket sends no packet.
+// It is overridden in the tests.
+var addrRoutable = func(addr string) bool {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
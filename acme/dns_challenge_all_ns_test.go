@@ -0,0 +1,115 @@
+package acme
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xenolf/lego/internal/challengetest"
+)
+
+func TestAllNameserversCheck(t *testing.T) {
+	defer func(timeout time.Duration) { DNSTimeout = timeout }(DNSTimeout)
+	DNSTimeout = time.Second
+
+	// the primary nameserver is also the recursive nameserver, resolving the names of the nameservers.
+	primary, shutdown := startLocalNameserver(t)
+	defer shutdown()
+	secondary := challengetest.NewDNSServer(t, "example.com.")
+	defer secondary.Close()
+
+	_, primaryPort, _ := net.SplitHostPort(primary.Addr())
+	secondaryAddr := secondary.Addr()
+	nameserverAddr = func(ns string) string {
+		if ns == "ns1.example.com." {
+			return net.JoinHostPort(ns, primaryPort)
+		}
+		return secondaryAddr
+	}
+
+	fqdn := "_acme-challenge.strict.example.com."
+	primary.AddTXT(fqdn, "value")
+
+	check := newAllNameserversCheck(time.Minute, time.Second, nil)
+	ok, err := check.check(fqdn, "value")
+	if ok || err == nil {
+		t.Fatalf("Expected the check to fail without the record on the secondary nameserver, got %t", ok)
+	}
+	if expected := "NS ns2.example.com. (" + secondaryAddr + "): returned NXDOMAIN for " + fqdn; err.Error() != expected {
+		t.Errorf("Expected the status of the secondary nameserver %q, got %q", expected, err)
+	}
+
+	secondary.AddTXT(fqdn, "value")
+	if ok, err := check.check(fqdn, "value"); !ok || err != nil {
+		t.Errorf("Expected the record on every nameserver, got %t (%v)", ok, err)
+	}
+
+	// an unreachable nameserver is retried until the deadline.
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondaryAddr = pc.LocalAddr().String()
+	pc.Close()
+
+	ok, err = check.check(fqdn, "value")
+	if ok || err == nil || !strings.Contains(err.Error(), "NS ns2.example.com. ("+secondaryAddr+"): unreachable") {
+		t.Errorf("Expected the check to fail with an unreachable nameserver, got %t (%v)", ok, err)
+	}
+
+	check = newAllNameserversCheck(time.Second, time.Second, nil)
+	if ok, err := check.check(fqdn, "value"); !ok || err != nil {
+		t.Errorf("Expected the unreachable nameserver to be ignored after the deadline, got %t (%v)", ok, err)
+	}
+
+	// a missing record is never ignored.
+	primary.RemoveTXT(fqdn)
+	if ok, _ := check.check(fqdn, "value"); ok {
+		t.Error("Expected the check to fail without the record on the reachable nameserver")
+	}
+}
+
+func TestResolveNameserver(t *testing.T) {
+	srv, shutdown := startLocalNameserver(t)
+	defer shutdown()
+
+	_, port, _ := net.SplitHostPort(srv.Addr())
+	nameserverAddr = func(ns string) string { return net.JoinHostPort(ns, port) }
+
+	addrs, err := resolveNameserver("ns1.example.com.", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != srv.Addr() {
+		t.Errorf("Expected the address %s, got %v", srv.Addr(), addrs)
+	}
+
+	if _, err := resolveNameserver("unknown.example.com.", nil); err == nil {
+		t.Error("Expected an error for a nameserver without address")
+	}
+}
+
+func TestSetDNSRequireAllNameservers(t *testing.T) {
+	client := &Client{solvers: map[Challenge]solver{}}
+	manualProvider, _ := NewDNSProviderManual()
+
+	client.SetDNSProviderForDomain("example.com", manualProvider)
+	client.SetDNSRequireAllNameservers(true)
+	if !client.solvers[DNS01].(*dnsChallenge).requireAllNameservers {
+		t.Error("Expected the dns-01 solver to require all the nameservers")
+	}
+
+	// the setting is kept by the new solvers.
+	if err := client.SetChallengeProvider(DNS01, manualProvider); err != nil {
+		t.Fatal(err)
+	}
+	if !client.solvers[DNS01].(*dnsChallenge).requireAllNameservers {
+		t.Error("Expected the setting to be kept with a new provider")
+	}
+
+	client.SetDNSRequireAllNameservers(false)
+	if client.solvers[DNS01].(*dnsChallenge).requireAllNameservers {
+		t.Error("Expected the setting to be disabled")
+	}
+}
@@ -0,0 +1,107 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xenolf/lego/challenge/dns01"
+)
+
+// The steps of CheckDNSProvider.
+const (
+	CheckStepPresent     = "present"
+	CheckStepPropagation = "propagation"
+	CheckStepCleanUp     = "cleanup"
+)
+
+// DNSProviderCheck is the report of CheckDNSProvider.
+type DNSProviderCheck struct {
+	Domain string
+	// FQDN and Value are the TXT record of the check, named with dns01.CheckLabel.
+	FQDN  string
+	Value string
+	// Steps are the steps attempted, in order.
+	Steps []DNSProviderCheckStep
+}
+
+// DNSProviderCheckStep is a step of CheckDNSProvider.
+type DNSProviderCheckStep struct {
+	// Name is CheckStepPresent, CheckStepPropagation or CheckStepCleanUp.
+	Name     string
+	Duration time.Duration
+	// Err is nil if the step succeeded.
+	Err error
+}
+
+// CheckDNSProvider checks the credentials of a DNS provider without contacting any ACME server:
+// it presents a TXT record with a random value for domain, named _lego-test.<domain> instead of _acme-challenge.<domain>
+// so that a concurrent issuance is not disturbed, waits until the record is propagated to the authoritative nameservers
+// as for a dns-01 challenge, and cleans it up.
+// The cleanup is always attempted, even if presenting or propagating the record failed.
+// The report is returned with the error of the first step which failed.
+// The providers which do not create the TXT record with its name, e.g. acme-dns, fail the propagation step.
+func CheckDNSProvider(ctx context.Context, provider ChallengeProvider, domain string) (*DNSProviderCheck, error) {
+	domain = strings.TrimPrefix(domain, "*.")
+
+	token, err := randomCheckValue()
+	if err != nil {
+		return nil, err
+	}
+	thumbprint, err := randomCheckValue()
+	if err != nil {
+		return nil, err
+	}
+	keyAuth := token + "." + thumbprint
+
+	stop := dns01.StartCheck(keyAuth)
+	defer stop()
+
+	report := &DNSProviderCheck{Domain: domain}
+	report.FQDN, report.Value = dns01.GetRecord(domain, keyAuth)
+
+	err = report.step(CheckStepPresent, func() error {
+		if err := provider.Present(domain, token, keyAuth); err != nil {
+			return fmt.Errorf("[%s] acme: could not present the check record %s: %v", domain, report.FQDN, err)
+		}
+		return nil
+	})
+	if err == nil {
+		s := &dnsChallenge{provider: provider}
+		err = report.step(CheckStepPropagation, func() error {
+			return s.waitForPropagation(ctx, domain, keyAuth)
+		})
+	}
+
+	errC := report.step(CheckStepCleanUp, func() error {
+		if err := provider.CleanUp(domain, token, keyAuth); err != nil {
+			return fmt.Errorf("[%s] acme: could not clean up the check record %s: %v", domain, report.FQDN, err)
+		}
+		return nil
+	})
+	if err == nil {
+		err = errC
+	}
+
+	return report, err
+}
+
+// step runs and times a step of the check.
+func (r *DNSProviderCheck) step(name string, f func() error) error {
+	start := time.Now()
+	err := f()
+	r.Steps = append(r.Steps, DNSProviderCheckStep{Name: name, Duration: time.Since(start), Err: err})
+	return err
+}
+
+// randomCheckValue returns a random token of a check record.
+func randomCheckValue() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("acme: could not generate the check record: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,113 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xenolf/lego/challenge/dns01"
+)
+
+// providerCheckMock stores the TXT records it presents, and reports them as propagated.
+type providerCheckMock struct {
+	records    map[string]string
+	presentErr error
+	propagated bool
+	cleanedUp  bool
+}
+
+func (p *providerCheckMock) Present(domain, token, keyAuth string) error {
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	p.records[fqdn] = value
+	return p.presentErr
+}
+
+func (p *providerCheckMock) CleanUp(domain, token, keyAuth string) error {
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
+	delete(p.records, fqdn)
+	p.cleanedUp = true
+	return nil
+}
+
+func (p *providerCheckMock) PreCheck(domain, fqdn, value string) (bool, error) {
+	return p.propagated && p.records[fqdn] == value, nil
+}
+
+func (p *providerCheckMock) Timeout() (time.Duration, time.Duration) {
+	return 50 * time.Millisecond, 10 * time.Millisecond
+}
+
+// stepNames returns the names of the steps of the report.
+func stepNames(report *DNSProviderCheck) string {
+	var names []string
+	for _, step := range report.Steps {
+		names = append(names, step.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestCheckDNSProvider(t *testing.T) {
+	provider := &providerCheckMock{records: map[string]string{}, propagated: true}
+
+	report, err := CheckDNSProvider(context.Background(), provider, "*.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.FQDN != "_lego-test.example.com." || report.Value == "" {
+		t.Errorf("Expected the check record _lego-test.example.com., got %s %q", report.FQDN, report.Value)
+	}
+	if names := stepNames(report); names != "present,propagation,cleanup" {
+		t.Errorf("Expected all the steps, got %s", names)
+	}
+	if !provider.cleanedUp || len(provider.records) != 0 {
+		t.Errorf("Expected the check record to be cleaned up, got %v", provider.records)
+	}
+
+	// the record is not a challenge record anymore after the check.
+	if fqdn, _ := dns01.GetRecord("example.com", "token.thumbprint"); fqdn != "_acme-challenge.example.com." {
+		t.Errorf("Expected the challenge record after the check, got %s", fqdn)
+	}
+}
+
+func TestCheckDNSProviderFailures(t *testing.T) {
+	tests := []struct {
+		desc     string
+		provider *providerCheckMock
+		steps    string
+		failed   string
+	}{
+		{
+			desc:     "present",
+			provider: &providerCheckMock{records: map[string]string{}, presentErr: errors.New("invalid credentials"), propagated: true},
+			steps:    "present,cleanup",
+			failed:   CheckStepPresent,
+		},
+		{
+			desc:     "propagation",
+			provider: &providerCheckMock{records: map[string]string{}},
+			steps:    "present,propagation,cleanup",
+			failed:   CheckStepPropagation,
+		},
+	}
+
+	for _, test := range tests {
+		report, err := CheckDNSProvider(context.Background(), test.provider, "example.com")
+		if err == nil {
+			t.Errorf("%s: expected an error", test.desc)
+			continue
+		}
+		if names := stepNames(report); names != test.steps {
+			t.Errorf("%s: expected the steps %s, got %s", test.desc, test.steps, names)
+		}
+		for _, step := range report.Steps {
+			if (step.Err != nil) != (step.Name == test.failed) {
+				t.Errorf("%s: unexpected result of the step %s: %v", test.desc, step.Name, step.Err)
+			}
+		}
+		if !test.provider.cleanedUp {
+			t.Errorf("%s: expected the cleanup to be attempted", test.desc)
+		}
+	}
+}
@@ -3,8 +3,12 @@ package acme
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"sync"
+	"time"
 
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/log"
 )
 
@@ -13,17 +17,40 @@ const (
 )
 
 // DNSProviderManual is an implementation of the ChallengeProvider interface
-type DNSProviderManual struct{}
+// printing the records to create and remove by hand.
+// It waits for the Enter key if stdin is a terminal,
+// and for at most the duration of MANUAL_SLEEP (in seconds) if it is set.
+type DNSProviderManual struct {
+	wait time.Duration
+	in   io.Reader
+	// interactive is true if in is a terminal, on which the Enter key is waited for.
+	interactive bool
+
+	readOnce sync.Once
+	lines    chan struct{}
+}
 
 // NewDNSProviderManual returns a DNSProviderManual instance.
 func NewDNSProviderManual() (*DNSProviderManual, error) {
-	return &DNSProviderManual{}, nil
+	return &DNSProviderManual{
+		wait:        durationFromEnv("MANUAL_SLEEP"),
+		in:          os.Stdin,
+		interactive: isTerminal(os.Stdin),
+	}, nil
 }
 
-// Present prints instructions for manually creating the TXT record
-func (*DNSProviderManual) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := DNS01Record(domain, keyAuth)
-	dnsRecord := fmt.Sprintf(dnsTemplate, fqdn, ttl, value)
+// SetWait sets the maximum time waited after printing a record, e.g. to update the zone in a web panel.
+// On a terminal, the Enter key ends the wait earlier; without wait, Enter is waited for.
+// Without terminal nor wait, the records are printed without waiting.
+func (d *DNSProviderManual) SetWait(wait time.Duration) {
+	d.wait = wait
+}
+
+// Present prints instructions for manually creating the TXT record,
+// with a command to check it on an authoritative nameserver.
+func (d *DNSProviderManual) Present(domain, token, keyAuth string) error {
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	dnsRecord := fmt.Sprintf(dnsTemplate, fqdn, dns01.DefaultTTL, value)
 
 	authZone, err := FindZoneByFqdn(fqdn, RecursiveNameservers)
 	if err != nil {
@@ -32,17 +59,16 @@ func (*DNSProviderManual) Present(domain, token, keyAuth string) error {
 
 	log.Infof("acme: Please create the following TXT record in your %s zone:", authZone)
 	log.Infof("acme: %s", dnsRecord)
-	log.Infof("acme: Press 'Enter' when you are done")
+	log.Infof("acme: Check it with: %s", verifyCommand(fqdn))
 
-	reader := bufio.NewReader(os.Stdin)
-	_, _ = reader.ReadString('\n')
+	d.waitForUser("when you are done")
 	return nil
 }
 
 // CleanUp prints instructions for manually removing the TXT record
-func (*DNSProviderManual) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, ttl := DNS01Record(domain, keyAuth)
-	dnsRecord := fmt.Sprintf(dnsTemplate, fqdn, ttl, "...")
+func (d *DNSProviderManual) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	dnsRecord := fmt.Sprintf(dnsTemplate, fqdn, dns01.DefaultTTL, value)
 
 	authZone, err := FindZoneByFqdn(fqdn, RecursiveNameservers)
 	if err != nil {
@@ -51,5 +77,68 @@ func (*DNSProviderManual) CleanUp(domain, token, keyAuth string) error {
 
 	log.Infof("acme: You can now remove this TXT record from your %s zone:", authZone)
 	log.Infof("acme: %s", dnsRecord)
+
+	d.waitForUser("once it is removed")
 	return nil
 }
+
+// verifyCommand returns the dig command querying the TXT record on the first authoritative nameserver of its zone,
+// on the recursive nameservers if they cannot be found.
+func verifyCommand(fqdn string) string {
+	nameservers, err := lookupNameservers(fqdn, nil)
+	if err != nil {
+		return fmt.Sprintf("dig +short TXT %s", fqdn)
+	}
+	return fmt.Sprintf("dig @%s +short TXT %s", nameservers[0], fqdn)
+}
+
+// waitForUser waits for the Enter key on a terminal, for at most the wait of the provider if set.
+func (d *DNSProviderManual) waitForUser(action string) {
+	switch {
+	case d.interactive && d.wait > 0:
+		log.Infof("acme: Press 'Enter' %s, continuing in %s", action, d.wait)
+	case d.interactive:
+		log.Infof("acme: Press 'Enter' %s", action)
+	case d.wait > 0:
+		log.Infof("acme: Continuing in %s", d.wait)
+	default:
+		return
+	}
+
+	var enter <-chan struct{}
+	if d.interactive {
+		// a single goroutine reads the terminal, so that a line is never lost to an expired wait.
+		d.readOnce.Do(func() {
+			d.lines = make(chan struct{})
+			go func() {
+				reader := bufio.NewReader(d.in)
+				for {
+					if _, err := reader.ReadString('\n'); err != nil {
+						close(d.lines)
+						return
+					}
+					d.lines <- struct{}{}
+				}
+			}()
+		})
+		enter = d.lines
+	}
+
+	var timeout <-chan time.Time
+	if d.wait > 0 {
+		timer := time.NewTimer(d.wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-enter:
+	case <-timeout:
+	}
+}
+
+// isTerminal returns true if the file is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,66 @@
+package acme
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestDNSProviderManualWait(t *testing.T) {
+	// without terminal, the wait elapses without reading the input.
+	provider := &DNSProviderManual{wait: 50 * time.Millisecond}
+	start := time.Now()
+	provider.waitForUser("when you are done")
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected to wait 50ms, waited %s", elapsed)
+	}
+
+	// without terminal nor wait, nothing is waited for.
+	provider = &DNSProviderManual{}
+	start = time.Now()
+	provider.waitForUser("when you are done")
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("Expected not to wait, waited %s", elapsed)
+	}
+}
+
+func TestDNSProviderManualEnter(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+
+	provider := &DNSProviderManual{wait: 10 * time.Second, in: reader, interactive: true}
+
+	done := make(chan struct{})
+	go func() {
+		provider.waitForUser("when you are done")
+		close(done)
+	}()
+
+	if _, err := writer.Write([]byte("\n")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the Enter key to end the wait")
+	}
+
+	// a wait expiring without Enter does not consume the next line.
+	provider.wait = 10 * time.Millisecond
+	provider.waitForUser("once it is removed")
+
+	done = make(chan struct{})
+	provider.wait = 0
+	go func() {
+		provider.waitForUser("once it is removed")
+		close(done)
+	}()
+	if _, err := writer.Write([]byte("\n")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the Enter key to end the wait without timeout")
+	}
+}
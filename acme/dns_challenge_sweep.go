@@ -0,0 +1,76 @@
+package acme
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/xenolf/lego/log"
+)
+
+// SweepOptions selects the challenge records removed by SweepChallengeRecords.
+type SweepOptions struct {
+	// OlderThan keeps the records created more recently, which may belong to a challenge in progress.
+	// The records whose creation time is unknown are only removed if OlderThan is zero.
+	OlderThan time.Duration
+	// Keep are the values of the TXT records of the challenges in progress, which are never removed.
+	Keep []string
+	// DryRun only returns the records which would be removed.
+	DryRun bool
+}
+
+// orphaned returns true if the record is removed with the options.
+func (o SweepOptions) orphaned(record ChallengeRecord, now time.Time) bool {
+	for _, value := range o.Keep {
+		if record.Value == value {
+			return false
+		}
+	}
+
+	if o.OlderThan == 0 {
+		return true
+	}
+	return !record.Created.IsZero() && now.Sub(record.Created) > o.OlderThan
+}
+
+// SweepChallengeRecords removes the challenge records of domain and of its subdomains
+// left by the challenges which were never cleaned up, e.g. after a crash.
+// The records to remove are selected by opts.
+// It returns the records removed, or the records which would be removed with DryRun.
+// A record which cannot be removed does not stop the sweep: the errors are returned together.
+func SweepChallengeRecords(provider ChallengeProviderLister, domain string, opts SweepOptions) ([]ChallengeRecord, error) {
+	domain = ToFqdn(strings.ToLower(strings.TrimPrefix(domain, "*.")))
+
+	records, err := provider.ListChallengeRecords(UnFqdn(domain))
+	if err != nil {
+		return nil, fmt.Errorf("[%s] acme: could not list the challenge records: %v", UnFqdn(domain), err)
+	}
+
+	now := time.Now()
+	var swept []ChallengeRecord
+	var failures []string
+	for _, record := range records {
+		fqdn := ToFqdn(strings.ToLower(record.FQDN))
+		if !strings.HasPrefix(fqdn, "_acme-challenge.") || !dns.IsSubDomain(domain, fqdn) || !opts.orphaned(record, now) {
+			continue
+		}
+
+		if opts.DryRun {
+			swept = append(swept, record)
+			continue
+		}
+
+		if err := provider.DeleteChallengeRecord(record); err != nil {
+			failures = append(failures, fmt.Sprintf("%s %q: %v", record.FQDN, record.Value, err))
+			continue
+		}
+		log.Infof("[%s] acme: Removed the challenge record %s %q", UnFqdn(domain), record.FQDN, record.Value)
+		swept = append(swept, record)
+	}
+
+	if len(failures) > 0 {
+		return swept, fmt.Errorf("[%s] acme: could not remove the challenge records: %s", UnFqdn(domain), strings.Join(failures, "; "))
+	}
+	return swept, nil
+}
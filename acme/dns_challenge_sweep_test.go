@@ -0,0 +1,98 @@
+package acme
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type providerListerMock struct {
+	records []ChallengeRecord
+	deleted []string
+}
+
+func (p *providerListerMock) Present(domain, token, keyAuth string) error { return nil }
+func (p *providerListerMock) CleanUp(domain, token, keyAuth string) error { return nil }
+func (p *providerListerMock) ListChallengeRecords(domain string) ([]ChallengeRecord, error) {
+	return p.records, nil
+}
+func (p *providerListerMock) DeleteChallengeRecord(record ChallengeRecord) error {
+	if record.ID == "locked" {
+		return errors.New("locked record")
+	}
+	p.deleted = append(p.deleted, record.ID)
+	return nil
+}
+
+func TestSweepChallengeRecords(t *testing.T) {
+	now := time.Now()
+	records := []ChallengeRecord{
+		{ID: "old", FQDN: "_acme-challenge.example.com.", Value: "a", Created: now.Add(-48 * time.Hour)},
+		{ID: "recent", FQDN: "_acme-challenge.www.example.com.", Value: "b", Created: now.Add(-time.Minute)},
+		{ID: "unknown age", FQDN: "_acme-challenge.mail.example.com", Value: "c"},
+		{ID: "in progress", FQDN: "_acme-challenge.example.com.", Value: "d", Created: now.Add(-48 * time.Hour)},
+		{ID: "other domain", FQDN: "_acme-challenge.example.org.", Value: "e"},
+		{ID: "not a challenge", FQDN: "www.example.com.", Value: "f"},
+	}
+
+	tests := []struct {
+		desc     string
+		domain   string
+		opts     SweepOptions
+		expected []string
+	}{
+		{desc: "all", domain: "example.com", expected: []string{"old", "recent", "unknown age", "in progress"}},
+		{desc: "older than", domain: "example.com", opts: SweepOptions{OlderThan: 24 * time.Hour}, expected: []string{"old", "in progress"}},
+		{desc: "kept", domain: "*.example.com", opts: SweepOptions{Keep: []string{"d"}}, expected: []string{"old", "recent", "unknown age"}},
+		{desc: "subdomain", domain: "WWW.example.com.", expected: []string{"recent"}},
+	}
+
+	for _, test := range tests {
+		provider := &providerListerMock{records: records}
+
+		dryRun := test.opts
+		dryRun.DryRun = true
+		swept, err := SweepChallengeRecords(provider, test.domain, dryRun)
+		if err != nil {
+			t.Fatalf("%s: %v", test.desc, err)
+		}
+		if len(provider.deleted) != 0 {
+			t.Errorf("%s: expected no deletion with DryRun, got %v", test.desc, provider.deleted)
+		}
+		if ids := recordIDs(swept); !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("%s: expected the records %v with DryRun, got %v", test.desc, test.expected, ids)
+		}
+
+		swept, err = SweepChallengeRecords(provider, test.domain, test.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", test.desc, err)
+		}
+		if !reflect.DeepEqual(provider.deleted, test.expected) || !reflect.DeepEqual(recordIDs(swept), test.expected) {
+			t.Errorf("%s: expected the deletion of %v, got %v", test.desc, test.expected, provider.deleted)
+		}
+	}
+}
+
+func TestSweepChallengeRecordsErrors(t *testing.T) {
+	provider := &providerListerMock{records: []ChallengeRecord{
+		{ID: "locked", FQDN: "_acme-challenge.example.com.", Value: "a"},
+		{ID: "removed", FQDN: "_acme-challenge.example.com.", Value: "b"},
+	}}
+
+	swept, err := SweepChallengeRecords(provider, "example.com", SweepOptions{})
+	if err == nil {
+		t.Fatal("Expected an error for the locked record")
+	}
+	if ids := recordIDs(swept); !reflect.DeepEqual(ids, []string{"removed"}) {
+		t.Errorf("Expected the other records to be removed, got %v", ids)
+	}
+}
+
+func recordIDs(records []ChallengeRecord) []string {
+	var ids []string
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	return ids
+}
@@ -1,9 +1,10 @@
 package acme
 
 import (
-	"bufio"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -12,20 +13,23 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/miekg/dns"
+	"github.com/xenolf/lego/internal/challengetest"
 )
 
 var lookupNameserversTestsOK = []struct {
 	fqdn string
 	nss  []string
 }{
-	{"books.google.com.ng.",
-		[]string{"ns1.google.com.", "ns2.google.com.", "ns3.google.com.", "ns4.google.com."},
+	{"_acme-challenge.www.example.com.",
+		[]string{"ns1.example.com.", "ns2.example.com."},
 	},
-	{"www.google.com.",
-		[]string{"ns1.google.com.", "ns2.google.com.", "ns3.google.com.", "ns4.google.com."},
+	{"www.example.com.",
+		[]string{"ns1.example.com.", "ns2.example.com."},
 	},
-	{"physics.georgetown.edu.",
-		[]string{"ns1.georgetown.edu.", "ns2.georgetown.edu.", "ns3.georgetown.edu."},
+	{"example.com.",
+		[]string{"ns1.example.com.", "ns2.example.com."},
 	},
 }
 
@@ -33,7 +37,7 @@ var lookupNameserversTestsErr = []struct {
 	fqdn  string
 	error string
 }{
-	// invalid tld
+	// out of the zone
 	{"_null.n0n0.",
 		"Could not determine the zone",
 	},
@@ -43,10 +47,10 @@ var findZoneByFqdnTests = []struct {
 	fqdn string
 	zone string
 }{
-	{"mail.google.com.", "google.com."},             // domain is a CNAME
-	{"foo.google.com.", "google.com."},              // domain is a non-existent subdomain
-	{"example.com.ac.", "ac."},                      // domain is a eTLD
-	{"cross-zone-example.assets.sh.", "assets.sh."}, // domain is a cross-zone CNAME
+	{"mail.example.com.", "example.com."},       // domain is a CNAME
+	{"foo.example.com.", "example.com."},        // domain is a non-existent subdomain
+	{"example.com.", "example.com."},            // domain is the zone apex
+	{"cross-zone.example.com.", "example.com."}, // domain is a cross-zone CNAME
 }
 
 var checkAuthoritativeNssTests = []struct {
@@ -55,11 +59,11 @@ var checkAuthoritativeNssTests = []struct {
 	ok          bool
 }{
 	// TXT RR w/ expected value
-	{"8.8.8.8.asn.routeviews.org.", "151698.8.8.024", []string{"asnums.routeviews.org."},
+	{"_acme-challenge.www.example.com.", "151698.8.8.024", []string{"ns1.example.com."},
 		true,
 	},
 	// No TXT RR
-	{"ns1.google.com.", "", []string{"ns2.google.com."},
+	{"www.example.com.", "", []string{"ns2.example.com."},
 		false,
 	},
 }
@@ -70,15 +74,36 @@ var checkAuthoritativeNssTestsErr = []struct {
 	error       string
 }{
 	// TXT RR /w unexpected value
-	{"8.8.8.8.asn.routeviews.org.", "fe01=", []string{"asnums.routeviews.org."},
+	{"_acme-challenge.www.example.com.", "fe01=", []string{"ns1.example.com."},
 		"did not return the expected TXT record",
 	},
 	// No TXT RR
-	{"ns1.google.com.", "fe01=", []string{"ns2.google.com."},
+	{"www.example.com.", "fe01=", []string{"ns2.example.com."},
 		"did not return the expected TXT record",
 	},
 }
 
+// startLocalNameserver starts the nameserver of example.com,
+// used as the recursive nameserver and as the authoritative nameservers of the zone.
+// It returns the server and a function to shut it down and restore the nameservers.
+func startLocalNameserver(t *testing.T) (*challengetest.DNSServer, func()) {
+	srv := challengetest.NewDNSServer(t, "example.com.")
+	srv.AddCNAME("mail.example.com.", "www.example.com.")
+	srv.AddCNAME("cross-zone.example.com.", "assets.example.net.")
+	srv.AddTXT("_acme-challenge.www.example.com.", "151698.8.8.024")
+
+	recursive, addr := RecursiveNameservers, nameserverAddr
+	RecursiveNameservers = []string{srv.Addr()}
+	nameserverAddr = func(string) string { return srv.Addr() }
+	ClearFqdnCache()
+
+	return srv, func() {
+		srv.Close()
+		RecursiveNameservers, nameserverAddr = recursive, addr
+		ClearFqdnCache()
+	}
+}
+
 var checkResolvConfServersTests = []struct {
 	fixture  string
 	expected []string
@@ -89,9 +114,9 @@ var checkResolvConfServersTests = []struct {
 }
 
 func TestDNSValidServerResponse(t *testing.T) {
-	PreCheckDNS = func(fqdn, value string) (bool, error) {
-		return true, nil
-	}
+	srv, shutdown := startLocalNameserver(t)
+	defer shutdown()
+
 	privKey, _ := rsa.GenerateKey(rand.Reader, 512)
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -99,33 +124,101 @@ func TestDNSValidServerResponse(t *testing.T) {
 		w.Write([]byte("{\"type\":\"dns01\",\"status\":\"valid\",\"uri\":\"http://some.url\",\"token\":\"http8\"}"))
 	}))
 
-	manualProvider, _ := NewDNSProviderManual()
 	jws := &jws{privKey: privKey, getNonceURL: ts.URL}
-	solver := &dnsChallenge{jws: jws, validate: validate, provider: manualProvider}
+	solver := &dnsChallenge{jws: jws, validate: validate, provider: srv}
 	clientChallenge := challenge{Type: "dns01", Status: "pending", URL: ts.URL, Token: "http8"}
 
-	go func() {
-		time.Sleep(time.Second * 2)
-		f := bufio.NewWriter(os.Stdout)
-		defer f.Flush()
-		f.WriteString("\n")
-	}()
-
-	if err := solver.Solve(clientChallenge, "example.com"); err != nil {
+	if err := solver.PreSolve(clientChallenge, "www.example.com"); err != nil {
+		t.Fatalf("Expected PreSolve to present the record, got %v", err)
+	}
+	if err := solver.Solve(context.Background(), clientChallenge, "www.example.com"); err != nil {
 		t.Errorf("VALID: Expected Solve to return no error but the error was -> %v", err)
 	}
+	if err := solver.CleanUp(clientChallenge, "www.example.com"); err != nil {
+		t.Errorf("Expected CleanUp to return no error but the error was -> %v", err)
+	}
+
+	// only the record of the test fixture is left.
+	if txt := srv.TXT("_acme-challenge.www.example.com."); !reflect.DeepEqual(txt, []string{"151698.8.8.024"}) {
+		t.Errorf("Expected the challenge record to be removed, got %v", txt)
+	}
 }
 
 func TestPreCheckDNS(t *testing.T) {
-	ok, err := PreCheckDNS("acme-staging.api.letsencrypt.org", "fe01=")
-	if err != nil || !ok {
-		t.Errorf("preCheckDNS failed for acme-staging.api.letsencrypt.org")
+	srv, shutdown := startLocalNameserver(t)
+	defer shutdown()
+
+	fqdn := "_acme-challenge.test.example.com."
+	if ok, err := PreCheckDNS(fqdn, "fe01="); ok || err == nil {
+		t.Errorf("Expected the missing record to fail the check, got %t", ok)
+	}
+
+	srv.AddTXT(fqdn, "fe01=")
+	if ok, err := PreCheckDNS(fqdn, "fe01="); err != nil || !ok {
+		t.Errorf("preCheckDNS failed for %s: %v", fqdn, err)
+	}
+
+	// the record is aliased by a CNAME at the challenge name.
+	srv.AddCNAME("_acme-challenge.alias.example.com.", fqdn)
+	if ok, err := PreCheckDNS("_acme-challenge.alias.example.com.", "fe01="); err != nil || !ok {
+		t.Errorf("preCheckDNS failed for the CNAME to %s: %v", fqdn, err)
+	}
+}
+
+func TestPreCheckDNSIPv6Only(t *testing.T) {
+	// the nameservers of the zone only have AAAA records, and the host has no IPv4 route.
+	srv := challengetest.NewDNSServer6(t, "example.com.")
+	defer srv.Close()
+
+	_, port, _ := net.SplitHostPort(srv.Addr())
+	defer func(recursive []string, addr func(string) string, routable func(string) bool) {
+		RecursiveNameservers, nameserverAddr, addrRoutable = recursive, addr, routable
+		ClearFqdnCache()
+	}(RecursiveNameservers, nameserverAddr, addrRoutable)
+	RecursiveNameservers = []string{srv.Addr()}
+	nameserverAddr = func(ns string) string { return net.JoinHostPort(ns, port) }
+	addrRoutable = func(addr string) bool { return !strings.HasPrefix(addr, "127.") }
+	ClearFqdnCache()
+
+	fqdn := "_acme-challenge.v6.example.com."
+	srv.AddTXT(fqdn, "v6=")
+	if ok, err := PreCheckDNS(fqdn, "v6="); err != nil || !ok {
+		t.Errorf("preCheckDNS failed for %s: %v", fqdn, err)
+	}
+
+	check := newAllNameserversCheck(time.Minute, time.Second, nil)
+	if ok, err := check.check(fqdn, "v6="); err != nil || !ok {
+		t.Errorf("Expected the record on every IPv6 address of the nameservers, got %t (%v)", ok, err)
+	}
+
+	// the error lists the addresses tried.
+	defer func(timeout time.Duration) { DNSTimeout = timeout }(DNSTimeout)
+	DNSTimeout = 100 * time.Millisecond
+	srv.Close()
+	nameserverAddr = func(string) string { return net.JoinHostPort("::1", port) }
+	err := checkAuthoritativeNs(fqdn, "v6=", "ns1.example.com.", nil)
+	if expected := "NS ns1.example.com. could not be queried at [::1]:" + port; err == nil || !strings.HasPrefix(err.Error(), expected) {
+		t.Errorf("Expected an error starting with %q, got %v", expected, err)
+	}
+}
+
+func TestRoutableFirst(t *testing.T) {
+	defer func(routable func(string) bool) { addrRoutable = routable }(addrRoutable)
+	addrRoutable = func(addr string) bool { return strings.HasPrefix(addr, "[") }
+
+	addrs := routableFirst([]string{"192.0.2.1:53", "[2001:db8::1]:53", "192.0.2.2:53", "[2001:db8::2]:53"})
+	expected := []string{"[2001:db8::1]:53", "[2001:db8::2]:53", "192.0.2.1:53", "192.0.2.2:53"}
+	if !reflect.DeepEqual(addrs, expected) {
+		t.Errorf("Expected %v, got %v", expected, addrs)
 	}
 }
 
 func TestLookupNameserversOK(t *testing.T) {
+	_, shutdown := startLocalNameserver(t)
+	defer shutdown()
+
 	for _, tt := range lookupNameserversTestsOK {
-		nss, err := lookupNameservers(tt.fqdn)
+		nss, err := lookupNameservers(tt.fqdn, nil)
 		if err != nil {
 			t.Fatalf("#%s: got %q; want nil", tt.fqdn, err)
 		}
@@ -140,8 +233,11 @@ func TestLookupNameserversOK(t *testing.T) {
 }
 
 func TestLookupNameserversErr(t *testing.T) {
+	_, shutdown := startLocalNameserver(t)
+	defer shutdown()
+
 	for _, tt := range lookupNameserversTestsErr {
-		_, err := lookupNameservers(tt.fqdn)
+		_, err := lookupNameservers(tt.fqdn, nil)
 		if err == nil {
 			t.Fatalf("#%s: expected %q (error); got <nil>", tt.fqdn, tt.error)
 		}
@@ -154,6 +250,9 @@ func TestLookupNameserversErr(t *testing.T) {
 }
 
 func TestFindZoneByFqdn(t *testing.T) {
+	_, shutdown := startLocalNameserver(t)
+	defer shutdown()
+
 	for _, tt := range findZoneByFqdnTests {
 		res, err := FindZoneByFqdn(tt.fqdn, RecursiveNameservers)
 		if err != nil {
@@ -165,9 +264,70 @@ func TestFindZoneByFqdn(t *testing.T) {
 	}
 }
 
+func TestFindZoneByFqdnWalk(t *testing.T) {
+	com := challengetest.NewDNSServer(t, "example.com.")
+	defer com.Close()
+	com.AddCNAME("apex-alias.example.com.", "example.com.")
+
+	// failing cannot answer for www.example.com., org refuses the names out of example.org.
+	failing := challengetest.NewDNSServer(t, "example.com.")
+	defer failing.Close()
+	failing.SetRcode("www.example.com.", dns.RcodeServerFailure)
+
+	org := challengetest.NewDNSServer(t, "example.org.")
+	defer org.Close()
+
+	defer ClearFqdnCache()
+
+	testCases := []struct {
+		desc        string
+		fqdn        string
+		nameservers []string
+		zone        string
+		err         string
+	}{
+		{desc: "CNAME to the zone apex", fqdn: "apex-alias.example.com.", nameservers: []string{com.Addr()}, zone: "example.com."},
+		{desc: "non-existent intermediate labels", fqdn: "a.b.c.example.com.", nameservers: []string{com.Addr()}, zone: "example.com."},
+		{desc: "REFUSED by the first nameserver", fqdn: "www.example.com.", nameservers: []string{org.Addr(), com.Addr()}, zone: "example.com."},
+		{desc: "SERVFAIL by the first nameserver", fqdn: "_acme-challenge.www.example.com.", nameservers: []string{failing.Addr(), com.Addr()}, zone: "example.com."},
+		{
+			desc:        "SERVFAIL by every nameserver",
+			fqdn:        "_acme-challenge.www.example.com.",
+			nameservers: []string{failing.Addr()},
+			err:         "Could not query the SOA record of www.example.com.: " + failing.Addr() + " answered SERVFAIL",
+		},
+		{
+			desc:        "REFUSED by every nameserver",
+			fqdn:        "www.example.net.",
+			nameservers: []string{org.Addr(), com.Addr()},
+			err:         "Could not query the SOA record of www.example.net.: " + org.Addr() + " answered REFUSED; " + com.Addr() + " answered REFUSED",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			ClearFqdnCache()
+
+			zone, err := FindZoneByFqdn(test.fqdn, test.nameservers)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("Expected the error %q, got %q (%v)", test.err, zone, err)
+				}
+				return
+			}
+			if err != nil || zone != test.zone {
+				t.Errorf("Expected the zone %s, got %q (%v)", test.zone, zone, err)
+			}
+		})
+	}
+}
+
 func TestCheckAuthoritativeNss(t *testing.T) {
+	_, shutdown := startLocalNameserver(t)
+	defer shutdown()
+
 	for _, tt := range checkAuthoritativeNssTests {
-		ok, _ := checkAuthoritativeNss(tt.fqdn, tt.value, tt.ns)
+		ok, _ := checkAuthoritativeNss(tt.fqdn, tt.value, tt.ns, nil)
 		if ok != tt.ok {
 			t.Errorf("%s: got %t; want %t", tt.fqdn, ok, tt.ok)
 		}
@@ -175,8 +335,11 @@ func TestCheckAuthoritativeNss(t *testing.T) {
 }
 
 func TestCheckAuthoritativeNssErr(t *testing.T) {
+	_, shutdown := startLocalNameserver(t)
+	defer shutdown()
+
 	for _, tt := range checkAuthoritativeNssTestsErr {
-		_, err := checkAuthoritativeNss(tt.fqdn, tt.value, tt.ns)
+		_, err := checkAuthoritativeNss(tt.fqdn, tt.value, tt.ns, nil)
 		if err == nil {
 			t.Fatalf("#%s: expected %q (error); got <nil>", tt.fqdn, tt.error)
 		}
@@ -198,3 +361,354 @@ func TestResolveConfServers(t *testing.T) {
 		}
 	}
 }
+
+type providerTimeoutMock struct {
+	timeout, interval time.Duration
+}
+
+func (p *providerTimeoutMock) Present(domain, token, keyAuth string) error { return nil }
+func (p *providerTimeoutMock) CleanUp(domain, token, keyAuth string) error { return nil }
+func (p *providerTimeoutMock) Timeout() (time.Duration, time.Duration)     { return p.timeout, p.interval }
+
+func TestDNSChallengeTimeouts(t *testing.T) {
+	defer DNS01SetPropagationTimeout(0, 0)
+	defer os.Unsetenv(dnsPropagationTimeoutEnvVar)
+	defer os.Unsetenv(dnsPollingIntervalEnvVar)
+
+	manualProvider, _ := NewDNSProviderManual()
+	timeoutProvider := &providerTimeoutMock{timeout: 5 * time.Minute, interval: 10 * time.Second}
+
+	tests := []struct {
+		desc             string
+		provider         ChallengeProvider
+		envTimeout       string
+		envInterval      string
+		override         [2]time.Duration
+		expectedTimeout  time.Duration
+		expectedInterval time.Duration
+	}{
+		{
+			desc:             "default",
+			provider:         manualProvider,
+			expectedTimeout:  DefaultPropagationTimeout,
+			expectedInterval: DefaultPollingInterval,
+		},
+		{
+			desc:             "provider",
+			provider:         timeoutProvider,
+			expectedTimeout:  5 * time.Minute,
+			expectedInterval: 10 * time.Second,
+		},
+		{
+			desc:             "env overrides provider",
+			provider:         timeoutProvider,
+			envTimeout:       "600",
+			expectedTimeout:  10 * time.Minute,
+			expectedInterval: 10 * time.Second,
+		},
+		{
+			desc:             "invalid env is ignored",
+			provider:         timeoutProvider,
+			envInterval:      "foo",
+			expectedTimeout:  5 * time.Minute,
+			expectedInterval: 10 * time.Second,
+		},
+		{
+			desc:             "explicit override wins",
+			provider:         timeoutProvider,
+			envTimeout:       "600",
+			envInterval:      "20",
+			override:         [2]time.Duration{time.Hour, time.Minute},
+			expectedTimeout:  time.Hour,
+			expectedInterval: time.Minute,
+		},
+	}
+
+	for _, test := range tests {
+		os.Setenv(dnsPropagationTimeoutEnvVar, test.envTimeout)
+		os.Setenv(dnsPollingIntervalEnvVar, test.envInterval)
+		DNS01SetPropagationTimeout(test.override[0], test.override[1])
+
+		solver := &dnsChallenge{provider: test.provider}
+		timeout, interval := solver.timeouts("example.com")
+		if timeout != test.expectedTimeout || interval != test.expectedInterval {
+			t.Errorf("%s: got (%s, %s); want (%s, %s)", test.desc, timeout, interval, test.expectedTimeout, test.expectedInterval)
+		}
+	}
+}
+
+func TestSetRecursiveNameservers(t *testing.T) {
+	defer func(nss []string) { RecursiveNameservers = nss }(RecursiveNameservers)
+
+	tests := []struct {
+		desc     string
+		input    []string
+		expected []string
+		err      bool
+	}{
+		{
+			desc:     "host",
+			input:    []string{"8.8.8.8", "dns.example.com"},
+			expected: []string{"8.8.8.8:53", "dns.example.com:53"},
+		},
+		{
+			desc:     "host and port",
+			input:    []string{"8.8.8.8:5353"},
+			expected: []string{"8.8.8.8:5353"},
+		},
+		{
+			desc:     "IPv6 literal",
+			input:    []string{"2001:4860:4860::8888", "[2001:4860:4860::8844]", "[::1]:5353"},
+			expected: []string{"[2001:4860:4860::8888]:53", "[2001:4860:4860::8844]:53", "[::1]:5353"},
+		},
+		{desc: "empty", input: []string{}, err: true},
+		{desc: "empty host", input: []string{":53"}, err: true},
+		{desc: "invalid port", input: []string{"8.8.8.8:dns"}, err: true},
+	}
+
+	for _, test := range tests {
+		RecursiveNameservers = []string{"unchanged:53"}
+
+		err := SetRecursiveNameservers(test.input)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error; got nil", test.desc)
+			}
+			if !reflect.DeepEqual(RecursiveNameservers, []string{"unchanged:53"}) {
+				t.Errorf("%s: nameservers must not change on error; got %v", test.desc, RecursiveNameservers)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.desc, err)
+		}
+		if !reflect.DeepEqual(RecursiveNameservers, test.expected) {
+			t.Errorf("%s: got %v; want %v", test.desc, RecursiveNameservers, test.expected)
+		}
+	}
+}
+
+func TestDNS01RecordCNAMESupport(t *testing.T) {
+	cnames := map[string]string{
+		"_acme-challenge.example.com.":           "_acme-challenge.delegated.example.net.",
+		"_acme-challenge.delegated.example.net.": "challenges.example.org.",
+		"_acme-challenge.loop.com.":              "loop.example.net.",
+		"loop.example.net.":                      "_acme-challenge.loop.com.",
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		if target, ok := cnames[req.Question[0].Name]; ok {
+			m.Answer = append(m.Answer, &dns.CNAME{
+				Hdr:    dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 60},
+				Target: target,
+			})
+		}
+		w.WriteMsg(m)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	defer func(nss []string) { RecursiveNameservers = nss }(RecursiveNameservers)
+	RecursiveNameservers = []string{pc.LocalAddr().String()}
+
+	defer os.Unsetenv("LEGO_EXPERIMENTAL_CNAME_SUPPORT")
+
+	tests := []struct {
+		desc     string
+		domain   string
+		enabled  string
+		expected string
+	}{
+		{desc: "disabled", domain: "example.com", expected: "_acme-challenge.example.com."},
+		{desc: "chain", domain: "example.com", enabled: "true", expected: "challenges.example.org."},
+		{desc: "no CNAME", domain: "example.org", enabled: "true", expected: "_acme-challenge.example.org."},
+		{desc: "loop", domain: "loop.com", enabled: "true", expected: "_acme-challenge.loop.com."},
+	}
+
+	for _, test := range tests {
+		os.Setenv("LEGO_EXPERIMENTAL_CNAME_SUPPORT", test.enabled)
+
+		fqdn, _, _ := DNS01Record(test.domain, "keyAuth")
+		if fqdn != test.expected {
+			t.Errorf("%s: got %s; want %s", test.desc, fqdn, test.expected)
+		}
+	}
+}
+
+type providerPreCheckMock struct {
+	calls []string
+}
+
+func (p *providerPreCheckMock) Present(domain, token, keyAuth string) error { return nil }
+func (p *providerPreCheckMock) CleanUp(domain, token, keyAuth string) error { return nil }
+func (p *providerPreCheckMock) PreCheck(domain, fqdn, value string) (bool, error) {
+	p.calls = append(p.calls, domain+" "+fqdn+" "+value)
+	return true, nil
+}
+
+func TestDNSChallengePreCheck(t *testing.T) {
+	defer func(f PreCheckFunc) { PreCheckDNS = f }(PreCheckDNS)
+	defer DNS01WrapPreCheck(nil)
+
+	var defaultCalls int
+	PreCheckDNS = func(fqdn, value string) (bool, error) {
+		defaultCalls++
+		return false, nil
+	}
+
+	manualProvider, _ := NewDNSProviderManual()
+	preCheckProvider := &providerPreCheckMock{}
+
+	// The default check is used by providers without PreCheck.
+	s := &dnsChallenge{provider: manualProvider}
+	if ok, _ := s.preCheck("example.com")("_acme-challenge.example.com.", "value"); ok || defaultCalls != 1 {
+		t.Errorf("Expected the default check to be used, got %t with %d calls", ok, defaultCalls)
+	}
+
+	// The provider check replaces the default check.
+	s = &dnsChallenge{provider: preCheckProvider}
+	if ok, _ := s.preCheck("example.com")("_acme-challenge.example.com.", "value"); !ok || defaultCalls != 1 {
+		t.Errorf("Expected the provider check to be used, got %t with %d default calls", ok, defaultCalls)
+	}
+	if expected := []string{"example.com _acme-challenge.example.com. value"}; !reflect.DeepEqual(preCheckProvider.calls, expected) {
+		t.Errorf("Expected provider calls %v, got %v", expected, preCheckProvider.calls)
+	}
+
+	// The wrapper takes precedence and receives the provider check.
+	var wrapped []string
+	DNS01WrapPreCheck(func(domain, fqdn, value string, check PreCheckFunc) (bool, error) {
+		wrapped = append(wrapped, domain)
+		ok, err := check(fqdn, value)
+		return !ok, err
+	})
+
+	if ok, _ := s.preCheck("example.com")("_acme-challenge.example.com.", "value"); ok {
+		t.Error("Expected the result of the wrapper")
+	}
+	if len(wrapped) != 1 || len(preCheckProvider.calls) != 2 || defaultCalls != 1 {
+		t.Errorf("Expected the wrapper to call the provider check, got %d wrapper, %d provider and %d default calls",
+			len(wrapped), len(preCheckProvider.calls), defaultCalls)
+	}
+}
+
+// startTXTServer starts an authoritative nameserver mock answering with the given records.
+// It returns the address of the server and a function to shut it down.
+func startTXTServer(t *testing.T, records map[string][]dns.RR) (string, func()) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Authoritative = true
+		m.Answer = records[req.Question[0].Name]
+		w.WriteMsg(m)
+	})}
+	go server.ActivateAndServe()
+
+	return pc.LocalAddr().String(), func() { server.Shutdown() }
+}
+
+func txtRecord(name string, txt ...string) dns.RR {
+	return &dns.TXT{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60}, Txt: txt}
+}
+
+func TestCheckAuthoritativeNssPropagation(t *testing.T) {
+	defer func(require bool) { RequireCompletePropagation = require }(RequireCompletePropagation)
+
+	fqdn := "_acme-challenge.example.com."
+	target := "_acme-challenge.delegated.example.net."
+
+	complete := map[string][]dns.RR{
+		// several values: e.g. a wildcard and its apex domain, and a leftover record.
+		fqdn: {txtRecord(fqdn, "wildcard"), txtRecord(fqdn, "apex"), txtRecord(fqdn, "left", "over")},
+	}
+	aliased := map[string][]dns.RR{
+		fqdn: {
+			&dns.CNAME{Hdr: dns.RR_Header{Name: fqdn, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 60}, Target: target},
+			txtRecord(target, "apex"),
+		},
+	}
+
+	ns1, shutdown1 := startTXTServer(t, complete)
+	defer shutdown1()
+	ns2, shutdown2 := startTXTServer(t, aliased)
+	defer shutdown2()
+	ns3, shutdown3 := startTXTServer(t, map[string][]dns.RR{})
+	defer shutdown3()
+
+	tests := []struct {
+		desc     string
+		value    string
+		ns       []string
+		complete bool
+		ok       bool
+	}{
+		{desc: "first of several values", value: "wildcard", ns: []string{ns1}, complete: true, ok: true},
+		{desc: "second of several values", value: "apex", ns: []string{ns1}, complete: true, ok: true},
+		{desc: "split strings", value: "leftover", ns: []string{ns1}, complete: true, ok: true},
+		{desc: "unexpected value", value: "other", ns: []string{ns1}, complete: true},
+		{desc: "CNAME at the challenge name", value: "apex", ns: []string{ns2}, complete: true, ok: true},
+		{desc: "missing on one of three NS", value: "apex", ns: []string{ns1, ns2, ns3}, complete: true},
+		{desc: "missing on one of three NS, one is enough", value: "apex", ns: []string{ns3, ns1, ns2}, ok: true},
+		{desc: "missing on all NS, one is enough", value: "other", ns: []string{ns1, ns2, ns3}},
+	}
+
+	for _, test := range tests {
+		RequireCompletePropagation = test.complete
+
+		ok, err := checkAuthoritativeNss(fqdn, test.value, test.ns, nil)
+		if ok != test.ok {
+			t.Errorf("%s: got %t (%v); want %t", test.desc, ok, err, test.ok)
+		}
+		if !ok && (err == nil || !strings.Contains(err.Error(), "did not return the expected TXT record")) {
+			t.Errorf("%s: expected an error naming the missing record, got %v", test.desc, err)
+		}
+	}
+}
+
+func TestSetDNSProviderForDomain(t *testing.T) {
+	defaultProvider, _ := NewDNSProviderManual()
+	exampleProvider := &providerPreCheckMock{}
+	internalProvider := &CallbackProvider{}
+
+	client := &Client{solvers: map[Challenge]solver{}}
+	client.SetDNSProviderForDomain("Example.com", exampleProvider)
+	client.SetDNSProviderForDomain("*.internal.example.com", internalProvider)
+
+	// the mapped providers are kept when the default provider is set afterwards.
+	if err := client.SetChallengeProvider(DNS01, defaultProvider); err != nil {
+		t.Fatal(err)
+	}
+	dnsSolver := client.solvers[DNS01].(*dnsChallenge)
+
+	testCases := map[string]ChallengeProvider{
+		"example.com":              exampleProvider,
+		"www.example.com":          exampleProvider,
+		"internal.example.com":     internalProvider,
+		"db.internal.example.com.": internalProvider,
+		"example.org":              defaultProvider,
+		"notexample.com":           defaultProvider,
+	}
+	for domain, expected := range testCases {
+		if got := dnsSolver.providerFor(domain); got != expected {
+			t.Errorf("Expected the provider %T for %s, got %T", expected, domain, got)
+		}
+	}
+
+	// without a default provider, the unmapped domains have no provider.
+	client = &Client{solvers: map[Challenge]solver{}}
+	client.SetDNSProviderForDomain("example.com", exampleProvider)
+	dnsSolver = client.solvers[DNS01].(*dnsChallenge)
+	if err := dnsSolver.PreSolve(challenge{Type: string(DNS01)}, "example.org"); err == nil {
+		t.Error("Expected an error for a domain without provider")
+	}
+}
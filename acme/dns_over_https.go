@@ -0,0 +1,125 @@
+package acme
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// dohResolverEnvVar is the environment variable name that can be used to
+	// specify the URL of a DNS-over-HTTPS resolver (RFC 8484) used instead of
+	// the recursive nameservers.
+	dohResolverEnvVar = "LEGO_DOH_RESOLVER"
+
+	// dohFallbackEnvVar is the environment variable name that can be used to
+	// fall back to the recursive nameservers when the DNS-over-HTTPS resolver fails.
+	dohFallbackEnvVar = "LEGO_DOH_FALLBACK"
+
+	// dohMediaType is the media type of the DNS wire format messages.
+	dohMediaType = "application/dns-message"
+
+	// maxDoHBodySize is the maximum size of a DNS message.
+	maxDoHBodySize = 64 * 1024
+)
+
+var (
+	dohResolverURL = os.Getenv(dohResolverEnvVar)
+	dohFallback    = os.Getenv(dohFallbackEnvVar) == "true"
+)
+
+// SetDoHResolver enables DNS-over-HTTPS (RFC 8484) for the recursive DNS queries
+// (SOA lookups and propagation checks) using the resolver at the given URL,
+// for example "https://1.1.1.1/dns-query". An empty URL disables DNS-over-HTTPS.
+// If fallback is true, the recursive nameservers are used when the DNS-over-HTTPS resolver fails.
+func SetDoHResolver(url string, fallback bool) {
+	dohResolverURL = url
+	dohFallback = fallback
+}
+
+// dohQuery sends the DNS message to the DNS-over-HTTPS resolver, and validates the response.
+func dohQuery(m *dns.Msg) (*dns.Msg, error) {
+	msg := m.Copy()
+	// RFC 8484 section 4.1: the DNS ID should be 0 to be cache friendly.
+	msg.Id = 0
+
+	wire, err := msg.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("DoH: failed to pack DNS message: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, dohResolverURL, bytes.NewReader(wire))
+	if err != nil {
+		return nil, fmt.Errorf("DoH: failed to create request to %s: %v", dohResolverURL, err)
+	}
+	req.Header.Set("Content-Type", dohMediaType)
+	req.Header.Set("Accept", dohMediaType)
+	req.Header.Set("User-Agent", userAgent())
+
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("DoH: query to %s failed: %v", dohResolverURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH: %s returned HTTP status %d", dohResolverURL, resp.StatusCode)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, dohMediaType) {
+		return nil, fmt.Errorf("DoH: %s returned an unexpected content type %q", dohResolverURL, ct)
+	}
+
+	body, err := ioutil.ReadAll(limitReader(resp.Body, maxDoHBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("DoH: failed to read response from %s: %v", dohResolverURL, err)
+	}
+
+	in := new(dns.Msg)
+	if err = in.Unpack(body); err != nil {
+		return nil, fmt.Errorf("DoH: failed to unpack response from %s: %v", dohResolverURL, err)
+	}
+
+	if err = checkDoHResponse(msg, in); err != nil {
+		return nil, fmt.Errorf("DoH: invalid response from %s: %v", dohResolverURL, err)
+	}
+
+	return in, nil
+}
+
+// checkDoHResponse verifies that the response matches the question,
+// and that the answers only concern the question name or the CNAME chain originating from it.
+func checkDoHResponse(req, resp *dns.Msg) error {
+	if !resp.Response {
+		return errors.New("message is not a response")
+	}
+
+	if len(resp.Question) != 1 {
+		return fmt.Errorf("expected 1 question, got %d", len(resp.Question))
+	}
+
+	question := req.Question[0]
+	if !strings.EqualFold(resp.Question[0].Name, question.Name) || resp.Question[0].Qtype != question.Qtype {
+		return fmt.Errorf("response question %s does not match %s", resp.Question[0].String(), question.String())
+	}
+
+	names := map[string]bool{strings.ToLower(question.Name): true}
+	for _, rr := range resp.Answer {
+		name := strings.ToLower(rr.Header().Name)
+		if !names[name] {
+			return fmt.Errorf("unexpected answer for %s", rr.Header().Name)
+		}
+
+		if cn, ok := rr.(*dns.CNAME); ok {
+			names[strings.ToLower(cn.Target)] = true
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package acme
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// newDoHServer returns a DNS-over-HTTPS stub server answering with a SOA record for example.com.
+// The answer is built for the given owner name, or for the question name if owner is empty.
+func newDoHServer(t *testing.T, owner string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != dohMediaType {
+			http.Error(w, "unsupported media type", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		req := new(dns.Msg)
+		if err := req.Unpack(body); err != nil {
+			t.Errorf("failed to unpack DoH request: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+
+		name := owner
+		if name == "" {
+			name = req.Question[0].Name
+		}
+		if req.Question[0].Name == "example.com." || owner != "" {
+			resp.Answer = append(resp.Answer, &dns.SOA{
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 60},
+				Ns:  "ns.example.com.", Mbox: "admin.example.com.",
+			})
+		}
+
+		wire, _ := resp.Pack()
+		w.Header().Set("Content-Type", dohMediaType)
+		w.Write(wire)
+	}))
+}
+
+func TestFindZoneByFqdnDoH(t *testing.T) {
+	ts := newDoHServer(t, "")
+	defer ts.Close()
+
+	SetDoHResolver(ts.URL, false)
+	defer SetDoHResolver("", false)
+	ClearFqdnCache()
+	defer ClearFqdnCache()
+
+	zone, err := FindZoneByFqdn("_acme-challenge.www.example.com.", []string{"192.0.2.1:53"})
+	if err != nil {
+		t.Fatalf("FindZoneByFqdn failed: %v", err)
+	}
+
+	if zone != "example.com." {
+		t.Errorf("got %s; want example.com.", zone)
+	}
+}
+
+func TestDoHQueryUnexpectedAnswer(t *testing.T) {
+	ts := newDoHServer(t, "attacker.example.org.")
+	defer ts.Close()
+
+	SetDoHResolver(ts.URL, false)
+	defer SetDoHResolver("", false)
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeSOA)
+
+	_, err := dohQuery(m)
+	if err == nil || !strings.Contains(err.Error(), "unexpected answer") {
+		t.Errorf("expected an unexpected answer error; got %v", err)
+	}
+}
+
+func TestDoHQueryNoFallback(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	SetDoHResolver(ts.URL, false)
+	defer SetDoHResolver("", false)
+
+	_, err := dnsQuery("example.com.", dns.TypeSOA, []string{"192.0.2.1:53"}, true)
+	if err == nil || !strings.Contains(err.Error(), "HTTP status 503") {
+		t.Errorf("expected the DoH error without fallback; got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package acme
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// maxZoneCacheTTL caps the time a zone is cached, whatever the TTL of its SOA record.
+	maxZoneCacheTTL = time.Hour
+
+	// maxZoneCacheSize is the number of fqdns cached, the least recently used being evicted.
+	maxZoneCacheSize = 1000
+)
+
+// fqdnToZone caches the zones found by FindZoneByFqdn, by fqdn and nameservers.
+var fqdnToZone = newZoneCache(maxZoneCacheSize)
+
+// zoneCache is a bounded LRU cache of the zones of fqdns, safe for concurrent use.
+type zoneCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	// lru are the zoneCacheEntry, the most recently used first.
+	lru *list.List
+}
+
+type zoneCacheEntry struct {
+	fqdn    string
+	zone    string
+	expires time.Time
+}
+
+func newZoneCache(size int) *zoneCache {
+	return &zoneCache{size: size, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+// get returns the zone of fqdn, if cached and not expired at now.
+func (c *zoneCache) get(fqdn string, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[fqdn]
+	if !ok {
+		return "", false
+	}
+
+	entry := elem.Value.(*zoneCacheEntry)
+	if !now.Before(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, fqdn)
+		return "", false
+	}
+
+	c.lru.MoveToFront(elem)
+	return entry.zone, true
+}
+
+// set caches the zone of fqdn for the TTL of its SOA record, capped by maxZoneCacheTTL.
+// A zone with a zero TTL is not cached.
+func (c *zoneCache) set(fqdn, zone string, ttl time.Duration, now time.Time) {
+	if ttl > maxZoneCacheTTL {
+		ttl = maxZoneCacheTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &zoneCacheEntry{fqdn: fqdn, zone: zone, expires: now.Add(ttl)}
+	if elem, ok := c.entries[fqdn]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[fqdn] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*zoneCacheEntry).fqdn)
+	}
+}
+
+// clear removes every zone cached.
+func (c *zoneCache) clear() {
+	c.mu.Lock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.mu.Unlock()
+}
+
+// ClearFqdnCache clears the cache of fqdn to zone mappings,
+// e.g. after the delegation of a zone changed. Primarily used in testing.
+func ClearFqdnCache() {
+	fqdnToZone.clear()
+}
@@ -0,0 +1,72 @@
+package acme
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestZoneCache(t *testing.T) {
+	now := time.Now()
+	cache := newZoneCache(2)
+
+	cache.set("a.example.com.", "example.com.", time.Minute, now)
+	if zone, ok := cache.get("a.example.com.", now.Add(59*time.Second)); !ok || zone != "example.com." {
+		t.Errorf("Expected the zone to be cached, got %q (%t)", zone, ok)
+	}
+	if _, ok := cache.get("a.example.com.", now.Add(time.Minute)); ok {
+		t.Error("Expected the zone to expire after the TTL of the SOA record")
+	}
+
+	// the TTL is capped, and a zero TTL is not cached.
+	cache.set("b.example.com.", "example.com.", 48*time.Hour, now)
+	if _, ok := cache.get("b.example.com.", now.Add(maxZoneCacheTTL)); ok {
+		t.Errorf("Expected the zone to expire after %s", maxZoneCacheTTL)
+	}
+	cache.set("c.example.com.", "example.com.", 0, now)
+	if _, ok := cache.get("c.example.com.", now); ok {
+		t.Error("Expected a zone with a zero TTL not to be cached")
+	}
+
+	// the least recently used fqdn is evicted.
+	cache.set("a.example.com.", "example.com.", time.Minute, now)
+	cache.set("b.example.com.", "example.com.", time.Minute, now)
+	cache.get("a.example.com.", now)
+	cache.set("c.example.com.", "example.com.", time.Minute, now)
+	if _, ok := cache.get("b.example.com.", now); ok {
+		t.Error("Expected the least recently used fqdn to be evicted")
+	}
+	for _, fqdn := range []string{"a.example.com.", "c.example.com."} {
+		if _, ok := cache.get(fqdn, now); !ok {
+			t.Errorf("Expected %s to be cached", fqdn)
+		}
+	}
+
+	cache.clear()
+	if _, ok := cache.get("a.example.com.", now); ok {
+		t.Error("Expected the cache to be cleared")
+	}
+}
+
+func TestFindZoneByFqdnConcurrently(t *testing.T) {
+	srv, shutdown := startLocalNameserver(t)
+	defer shutdown()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%10 == 0 {
+				ClearFqdnCache()
+			}
+			fqdn := fmt.Sprintf("_acme-challenge.host%d.example.com.", i%5)
+			zone, err := FindZoneByFqdn(fqdn, []string{srv.Addr()})
+			if err != nil || zone != "example.com." {
+				t.Errorf("%s: expected the zone example.com., got %q (%v)", fqdn, zone, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -3,41 +3,168 @@ package acme
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
 	"strings"
+	"time"
 )
 
 const (
-	tosAgreementError = "Terms of service have changed"
-	invalidNonceError = "urn:ietf:params:acme:error:badNonce"
+	tosAgreementError       = "Terms of service have changed"
+	userActionRequiredError = "urn:ietf:params:acme:error:userActionRequired"
+	invalidNonceError       = "urn:ietf:params:acme:error:badNonce"
+	rateLimitedError        = "urn:ietf:params:acme:error:rateLimited"
+	caaError                = "urn:ietf:params:acme:error:caa"
+	invalidProfileError     = "urn:ietf:params:acme:error:invalidProfile"
+	alreadyReplacedError    = "urn:ietf:params:acme:error:alreadyReplaced"
+
+	externalAccountRequiredError = "urn:ietf:params:acme:error:externalAccountRequired"
 )
 
-// RemoteError is the base type for all errors specific to the ACME protocol.
-type RemoteError struct {
-	StatusCode int    `json:"status,omitempty"`
-	Type       string `json:"type"`
-	Detail     string `json:"detail"`
+// ErrAccountDeactivated is returned for all the requests of a client
+// after its account was deactivated.
+var ErrAccountDeactivated = errors.New("acme: account deactivated")
+
+// ErrOrdersNotSupported is returned when listing the orders of an account
+// if the CA does not provide the orders list.
+var ErrOrdersNotSupported = errors.New("acme: listing the orders of an account is not supported by this CA")
+
+// ErrRenewalInfoNotSupported is returned when getting the renewal information of a certificate
+// if the CA does not support ACME Renewal Information (RFC 9773).
+var ErrRenewalInfoNotSupported = errors.New("acme: renewal information is not supported by this CA")
+
+// ProblemDetails is an ACME problem document, returned by the server when a request fails.
+// It is the base type for all errors specific to the ACME protocol,
+// and can be retrieved from the errors of the client with errors.As.
+type ProblemDetails struct {
+	// StatusCode is the HTTP status of the response.
+	StatusCode  int          `json:"status,omitempty"`
+	Type        string       `json:"type"`
+	Detail      string       `json:"detail"`
+	Instance    string       `json:"instance,omitempty"`
+	SubProblems []SubProblem `json:"subproblems,omitempty"`
 }
 
-func (e RemoteError) Error() string {
-	return fmt.Sprintf("acme: Error %d - %s - %s", e.StatusCode, e.Type, e.Detail)
+func (e ProblemDetails) Error() string {
+	msg := fmt.Sprintf("acme: Error %d - %s - %s", e.StatusCode, e.Type, e.Detail)
+	for _, sub := range e.SubProblems {
+		msg += fmt.Sprintf(", problem: %s - %s - %s", sub.Identifier.Value, sub.Type, sub.Detail)
+	}
+	return msg
 }
 
+// SubProblem is the problem of one of the identifiers of a request.
+type SubProblem struct {
+	Type       string     `json:"type"`
+	Detail     string     `json:"detail"`
+	Identifier Identifier `json:"identifier"`
+}
+
+// RemoteError is the former name of ProblemDetails.
+type RemoteError = ProblemDetails
+
 // TOSError represents the error which is returned if the user needs to
 // accept the TOS.
-// TODO: include the new TOS url if we can somehow obtain it.
 type TOSError struct {
 	RemoteError
+
+	// TOSURL is the URL of the new TOS, if the server returned it.
+	TOSURL string
 }
 
+// Unwrap returns the problem document of the server.
+func (e TOSError) Unwrap() error { return e.RemoteError }
+
 // NonceError represents the error which is returned if the
 // nonce sent by the client was not accepted by the server.
 type NonceError struct {
 	RemoteError
 }
 
+// Unwrap returns the problem document of the server.
+func (e NonceError) Unwrap() error { return e.RemoteError }
+
+// RateLimitError represents the error which is returned if the server
+// rejected the request because of a rate limit, or because it is unavailable.
+type RateLimitError struct {
+	RemoteError
+
+	// RetryAfter is the time after which the request can be retried,
+	// as advertised by the server. It is zero if the server did not advertise it.
+	RetryAfter time.Time
+}
+
+// Unwrap returns the problem document of the server.
+func (e RateLimitError) Unwrap() error { return e.RemoteError }
+
+func (e RateLimitError) Error() string {
+	if e.RetryAfter.IsZero() {
+		return e.RemoteError.Error()
+	}
+	return fmt.Sprintf("%s - retry after %s", e.RemoteError.Error(), e.RetryAfter.Format(time.RFC3339))
+}
+
+// KeyConflictError represents the error which is returned if the new
+// account key of a key change is already used by another account.
+type KeyConflictError struct {
+	RemoteError
+
+	// AccountURL is the URL of the account using the key, if the server returned it.
+	AccountURL string
+}
+
+// Unwrap returns the problem document of the server.
+func (e KeyConflictError) Unwrap() error { return e.RemoteError }
+
+// ExternalAccountRequiredError represents the error which is returned if the
+// CA requires an External Account Binding to register an account.
+type ExternalAccountRequiredError struct {
+	RemoteError
+}
+
+// Unwrap returns the problem document of the server.
+func (e ExternalAccountRequiredError) Unwrap() error { return e.RemoteError }
+
+func (e ExternalAccountRequiredError) Error() string {
+	if e.Detail == "" {
+		return "acme: the CA requires an external account binding, see RegisterWithExternalAccountBinding"
+	}
+	return fmt.Sprintf("acme: the CA requires an external account binding, see RegisterWithExternalAccountBinding: %s", e.Detail)
+}
+
+// InvalidProfileError represents the error which is returned if the CA
+// rejected the issuance profile requested by an order.
+type InvalidProfileError struct {
+	RemoteError
+
+	// Profile is the requested profile.
+	Profile string
+}
+
+// Unwrap returns the problem document of the server.
+func (e InvalidProfileError) Unwrap() error { return e.RemoteError }
+
+func (e InvalidProfileError) Error() string {
+	return fmt.Sprintf("acme: the CA rejected the profile %q: %s", e.Profile, e.RemoteError.Error())
+}
+
+// TooManyIdentifiersError is returned, without creating the order, if an order has more identifiers
+// than the CA accepts, see Client.MaxIdentifiers. The order can be split with the SplitLargeOrders option
+// of ObtainCertificatesWithOptions.
+type TooManyIdentifiersError struct {
+	// Identifiers is the number of identifiers of the order.
+	Identifiers int
+	// Max is the maximum number of identifiers of an order.
+	Max int
+}
+
+func (e TooManyIdentifiersError) Error() string {
+	return fmt.Sprintf("acme: the order has %d identifiers, the CA accepts at most %d per order", e.Identifiers, e.Max)
+}
+
 type domainError struct {
 	Domain string
 	Error  error
@@ -49,12 +176,95 @@ type ObtainError map[string]error
 
 func (e ObtainError) Error() string {
 	buffer := bytes.NewBufferString("acme: Error -> One or more domains had a problem:\n")
-	for dom, err := range e {
-		buffer.WriteString(fmt.Sprintf("[%s] %s\n", dom, err))
+	for _, dom := range e.Domains() {
+		buffer.WriteString(fmt.Sprintf("[%s] %s\n", dom, e[dom]))
 	}
 	return buffer.String()
 }
 
+// Domains returns the domains with an error, sorted.
+func (e ObtainError) Domains() []string {
+	var domains []string
+	for dom := range e {
+		domains = append(domains, dom)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// As finds the first error of the domains, sorted by domain, matching target, for errors.As.
+func (e ObtainError) As(target interface{}) bool {
+	for _, dom := range e.Domains() {
+		if errors.As(e[dom], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Is reports whether an error of the domains matches target, for errors.Is.
+func (e ObtainError) Is(target error) bool {
+	for _, dom := range e.Domains() {
+		if errors.Is(e[dom], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChallengeError represents the failure of a challenge of an identifier.
+type ChallengeError struct {
+	Identifier string
+	Challenge  Challenge
+	Err        error
+
+	// ValidationRecord are the validation attempts of the CA, if the server invalidated the challenge.
+	ValidationRecord []ValidationRecord
+}
+
+func (e ChallengeError) Error() string {
+	msg := fmt.Sprintf("acme: the %s challenge failed: %v", e.Challenge, e.Err)
+	for _, record := range e.ValidationRecord {
+		msg += fmt.Sprintf(" (validation: %s)", record)
+	}
+	return msg
+}
+
+// Unwrap returns the cause of the failure, a ProblemDetails if the server invalidated the challenge.
+func (e ChallengeError) Unwrap() error { return e.Err }
+
+// IsRateLimited returns true if err was caused by a rate limit of the server,
+// or because the server was unavailable.
+func IsRateLimited(err error) bool {
+	var rateLimitErr RateLimitError
+	return errors.As(err, &rateLimitErr)
+}
+
+// IsBadNonce returns true if err was caused by a nonce refused by the server.
+func IsBadNonce(err error) bool {
+	var nonceErr NonceError
+	return errors.As(err, &nonceErr)
+}
+
+// IsProblemType returns true if err was caused by a problem of the given type,
+// e.g. "urn:ietf:params:acme:error:unauthorized".
+// The subproblems are also checked.
+func IsProblemType(err error, problemType string) bool {
+	var problem ProblemDetails
+	if !errors.As(err, &problem) {
+		return false
+	}
+	if problem.Type == problemType {
+		return true
+	}
+	for _, sub := range problem.SubProblems {
+		if sub.Type == problemType {
+			return true
+		}
+	}
+	return false
+}
+
 func handleHTTPError(resp *http.Response) error {
 	var errorDetail RemoteError
 
@@ -75,17 +285,48 @@ func handleHTTPError(resp *http.Response) error {
 	errorDetail.StatusCode = resp.StatusCode
 
 	// Check for errors we handle specifically
-	if errorDetail.StatusCode == http.StatusForbidden && errorDetail.Detail == tosAgreementError {
-		return TOSError{errorDetail}
+	if errorDetail.StatusCode == http.StatusForbidden && errorDetail.Detail == tosAgreementError ||
+		errorDetail.Type == userActionRequiredError && parseLinks(resp.Header["Link"])["terms-of-service"] != "" {
+		return TOSError{RemoteError: errorDetail, TOSURL: parseLinks(resp.Header["Link"])["terms-of-service"]}
 	}
 
 	if errorDetail.StatusCode == http.StatusBadRequest && errorDetail.Type == invalidNonceError {
 		return NonceError{errorDetail}
 	}
 
+	if errorDetail.Type == externalAccountRequiredError {
+		return ExternalAccountRequiredError{errorDetail}
+	}
+
+	if errorDetail.StatusCode == http.StatusTooManyRequests || errorDetail.StatusCode == http.StatusServiceUnavailable ||
+		errorDetail.Type == rateLimitedError {
+		rateLimitErr := RateLimitError{RemoteError: errorDetail}
+		if ra, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			rateLimitErr.RetryAfter = time.Now().Add(ra)
+		}
+		return rateLimitErr
+	}
+
 	return errorDetail
 }
 
+// challengeProblem is the problem of a challenge invalidated by the server, with its validation record.
+type challengeProblem struct {
+	ProblemDetails
+	validationRecord []ValidationRecord
+}
+
+// Unwrap returns the problem document of the server.
+func (e challengeProblem) Unwrap() error { return e.ProblemDetails }
+
 func handleChallengeError(chlng challenge) error {
-	return chlng.Error
+	return challengeProblem{ProblemDetails: chlng.Error, validationRecord: chlng.ValidationRecord}
+}
+
+// orderError returns the error of an invalid order, the problem of the order if the server sent it.
+func orderError(order orderMessage) error {
+	if order.Error != nil {
+		return *order.Error
+	}
+	return errors.New("order has invalid state: invalid")
 }
@@ -0,0 +1,198 @@
+package acme
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleHTTPErrorProblemDetails(t *testing.T) {
+	body := `{
+		"type": "urn:ietf:params:acme:error:rejectedIdentifier",
+		"detail": "Error creating new order",
+		"status": 400,
+		"instance": "https://example.com/problems/1",
+		"subproblems": [
+			{
+				"type": "urn:ietf:params:acme:error:caa",
+				"detail": "CAA record forbids issuance",
+				"identifier": {"type": "dns", "value": "example.org"}
+			}
+		]
+	}`
+
+	resp := &http.Response{
+		StatusCode: http.StatusBadRequest,
+		Header:     http.Header{"Content-Type": []string{"application/problem+json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+
+	err := handleHTTPError(resp)
+
+	var problem ProblemDetails
+	if !errors.As(err, &problem) {
+		t.Fatalf("Expected a ProblemDetails, got %T: %v", err, err)
+	}
+	if problem.Instance != "https://example.com/problems/1" || problem.StatusCode != http.StatusBadRequest {
+		t.Errorf("Unexpected problem %+v", problem)
+	}
+	if len(problem.SubProblems) != 1 || problem.SubProblems[0].Identifier != (Identifier{Type: "dns", Value: "example.org"}) {
+		t.Errorf("Unexpected subproblems %+v", problem.SubProblems)
+	}
+
+	if !IsProblemType(err, "urn:ietf:params:acme:error:rejectedIdentifier") || !IsProblemType(err, caaError) {
+		t.Error("Expected the problem and subproblem types to be found")
+	}
+	if IsProblemType(err, "urn:ietf:params:acme:error:unauthorized") {
+		t.Error("Expected the unauthorized type to not be found")
+	}
+}
+
+func TestProblemDetailsErrorsAs(t *testing.T) {
+	nonceErr := NonceError{RemoteError{StatusCode: http.StatusBadRequest, Type: invalidNonceError}}
+	rateLimitErr := RateLimitError{RemoteError: RemoteError{StatusCode: http.StatusTooManyRequests, Type: rateLimitedError}}
+
+	// wrapped in the challenge failure of a domain.
+	obtainErr := ObtainError{
+		"a.example.com": challengeFailure("a.example.com", challenge{Type: string(HTTP01)}, nonceErr),
+		"b.example.com": fmt.Errorf("order failed: %w", rateLimitErr),
+	}
+
+	if !IsBadNonce(obtainErr) || !IsRateLimited(obtainErr) {
+		t.Error("Expected the nonce and rate limit errors to be found")
+	}
+	if IsBadNonce(rateLimitErr) || IsRateLimited(nonceErr) {
+		t.Error("Expected the errors to be distinguished")
+	}
+
+	var chlngErr ChallengeError
+	if !errors.As(obtainErr, &chlngErr) || chlngErr.Identifier != "a.example.com" || chlngErr.Challenge != HTTP01 {
+		t.Errorf("Expected the challenge error of a.example.com, got %+v", chlngErr)
+	}
+	if expected := "acme: the http-01 challenge failed: " + nonceErr.Error(); chlngErr.Error() != expected {
+		t.Errorf("Expected the message %q, got %q", expected, chlngErr.Error())
+	}
+
+	var problem ProblemDetails
+	if !errors.As(chlngErr, &problem) || problem.Type != invalidNonceError {
+		t.Errorf("Expected the problem of the challenge, got %+v", problem)
+	}
+
+	obtainErr["c.example.com"] = fmt.Errorf("order failed: %w", ErrAccountDeactivated)
+	if !errors.Is(obtainErr, ErrAccountDeactivated) || errors.Is(obtainErr, ErrOrdersNotSupported) {
+		t.Error("Expected the sentinel error of c.example.com to be found")
+	}
+}
+
+func TestObtainCertificateOrderFailures(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	// the authorizations are valid, the finalization fails with a subproblem for a.example.com,
+	// and the challenge of b.example.com is found invalid by a recheck of the CA.
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+
+		parts := strings.Split(r.URL.Path, "/")
+		domain := parts[len(parts)-1]
+
+		switch {
+		case r.URL.Path == "/directory":
+			writeJSONResponse(w, directory{
+				NewNonceURL:   ts.URL + "/nonce",
+				NewAccountURL: ts.URL + "/account",
+				NewOrderURL:   ts.URL + "/newOrder",
+				RevokeCertURL: ts.URL + "/revokeCert",
+				KeyChangeURL:  ts.URL + "/keyChange",
+			})
+		case r.URL.Path == "/nonce":
+		case r.URL.Path == "/newOrder":
+			order := orderMessage{Status: "ready", Finalize: ts.URL + "/finalize"}
+			for _, domain := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+				order.Identifiers = append(order.Identifiers, Identifier{Type: "dns", Value: domain})
+				order.Authorizations = append(order.Authorizations, ts.URL+"/authz/"+domain)
+			}
+			w.Header().Set("Location", ts.URL+"/order/1")
+			w.WriteHeader(http.StatusCreated)
+			writeJSONResponse(w, order)
+		case strings.HasPrefix(r.URL.Path, "/authz/") && r.Method == http.MethodPost:
+			writeJSONResponse(w, authorization{Status: "deactivated"})
+		case r.URL.Path == "/authz/b.example.com":
+			writeJSONResponse(w, authorization{
+				Status:     "valid",
+				Identifier: Identifier{Type: "dns", Value: domain},
+				Challenges: []challenge{{
+					Type:   string(HTTP01),
+					Status: "invalid",
+					Error:  RemoteError{Type: "urn:ietf:params:acme:error:connection", Detail: "Connection refused"},
+					ValidationRecord: []ValidationRecord{{
+						URL:               "http://b.example.com/.well-known/acme-challenge/token",
+						Hostname:          "b.example.com",
+						Port:              "80",
+						AddressesResolved: []string{"192.0.2.1"},
+						AddressUsed:       "192.0.2.1",
+					}},
+				}},
+			})
+		case strings.HasPrefix(r.URL.Path, "/authz/"):
+			writeJSONResponse(w, authorization{Status: "valid", Identifier: Identifier{Type: "dns", Value: domain}})
+		case r.URL.Path == "/finalize":
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"type":"urn:ietf:params:acme:error:rejectedIdentifier","detail":"Error finalizing order",
+				"subproblems":[{"type":"urn:ietf:params:acme:error:caa","detail":"CAA record forbids issuance",
+				"identifier":{"type":"dns","value":"a.example.com"}}]}`))
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     &RegistrationResource{URI: ts.URL + "/account/1"},
+		privatekey: key,
+	}
+	client, err := NewClient(ts.URL+"/directory", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+
+	_, err = client.ObtainCertificate([]string{"a.example.com", "b.example.com", "c.example.com"}, false, key, false)
+	obtainErr, ok := err.(ObtainError)
+	if !ok {
+		t.Fatalf("Expected an ObtainError, got %T: %v", err, err)
+	}
+
+	if problem, ok := obtainErr["a.example.com"].(ProblemDetails); !ok || problem.Type != caaError {
+		t.Errorf("Expected the subproblem of a.example.com, got %v", obtainErr["a.example.com"])
+	}
+
+	var chlngErr ChallengeError
+	if !errors.As(obtainErr["b.example.com"], &chlngErr) || chlngErr.Challenge != HTTP01 ||
+		len(chlngErr.ValidationRecord) != 1 || chlngErr.ValidationRecord[0].AddressUsed != "192.0.2.1" {
+		t.Errorf("Expected the invalid challenge of b.example.com with its validation record, got %+v", obtainErr["b.example.com"])
+	}
+
+	if !IsProblemType(obtainErr["c.example.com"], "urn:ietf:params:acme:error:rejectedIdentifier") {
+		t.Errorf("Expected the problem of the order for c.example.com, got %v", obtainErr["c.example.com"])
+	}
+
+	expected := "acme: Error -> One or more domains had a problem:\n" +
+		"[a.example.com] acme: Error 403 - urn:ietf:params:acme:error:caa - CAA record forbids issuance\n" +
+		"[b.example.com] acme: the http-01 challenge failed: acme: Error 0 - urn:ietf:params:acme:error:connection - Connection refused" +
+		" (validation: url http://b.example.com/.well-known/acme-challenge/token, hostname b.example.com:80, resolved 192.0.2.1, used 192.0.2.1)\n" +
+		"[c.example.com] " + obtainErr["c.example.com"].Error() + "\n"
+	if obtainErr.Error() != expected {
+		t.Errorf("Expected the message:\n%s\ngot:\n%s", expected, obtainErr.Error())
+	}
+}
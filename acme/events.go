@@ -0,0 +1,89 @@
+package acme
+
+// Events receives the events of the lifecycle of the certificates issued by the Client,
+// e.g. to update a database or to emit metrics without parsing the log.
+//
+// The methods are called synchronously by the goroutine obtaining the certificate,
+// possibly concurrently for the challenges of different domains.
+// They must be fast and must not call the Client: the issuance waits for them,
+// and the authorizations expire if it waits too long.
+// Embed NopEvents to only implement some of them.
+type Events interface {
+	// OrderCreated is called once the CA created the order of the certificate.
+	OrderCreated(event OrderEvent)
+	// ChallengePresented is called once the provider presented the challenge, before it is validated.
+	ChallengePresented(event ChallengeEvent)
+	// ChallengeValidated is called once the CA validated the challenge.
+	ChallengeValidated(event ChallengeEvent)
+	// ChallengeFailed is called if the challenge could not be presented or validated, with the reason in Err.
+	ChallengeFailed(event ChallengeEvent)
+	// CertificateIssued is called once the certificate was downloaded from the CA.
+	CertificateIssued(event CertificateEvent)
+}
+
+// OrderEvent describes an order created by the CA.
+type OrderEvent struct {
+	Domains []string
+	// URL is the URL of the order.
+	URL string
+}
+
+// ChallengeEvent describes a challenge of a domain.
+type ChallengeEvent struct {
+	Domain string
+	Type   Challenge
+	// URL is the URL of the challenge.
+	URL string
+	// AuthorizationURL is the URL of the authorization of the domain.
+	AuthorizationURL string
+	// Err is the reason of the failure, for ChallengeFailed.
+	Err error
+}
+
+// CertificateEvent describes a certificate issued by the CA.
+type CertificateEvent struct {
+	Domain  string
+	Domains []string
+	// OrderURL is the URL of the order of the certificate.
+	OrderURL string
+	// CertURL is the URL of the certificate.
+	CertURL     string
+	Certificate *CertificateResource
+}
+
+// NopEvents ignores every event, it is embedded by the Events implementing only some of the methods.
+type NopEvents struct{}
+
+func (NopEvents) OrderCreated(OrderEvent)            {}
+func (NopEvents) ChallengePresented(ChallengeEvent)  {}
+func (NopEvents) ChallengeValidated(ChallengeEvent)  {}
+func (NopEvents) ChallengeFailed(ChallengeEvent)     {}
+func (NopEvents) CertificateIssued(CertificateEvent) {}
+
+// SetEvents sets the receiver of the events of the lifecycle of the certificates, nil to disable it.
+// It must be set before obtaining certificates.
+func (c *Client) SetEvents(events Events) {
+	c.events = events
+}
+
+// orderCreated sends the event of the order, if events are set.
+func (c *Client) orderCreated(order orderResource) {
+	if c.events == nil {
+		return
+	}
+	c.events.OrderCreated(OrderEvent{Domains: order.Domains, URL: order.URL})
+}
+
+// certificateIssued sends the event of the certificate of the order, if events are set.
+func (c *Client) certificateIssued(order orderResource, certRes *CertificateResource) {
+	if c.events == nil {
+		return
+	}
+	c.events.CertificateIssued(CertificateEvent{
+		Domain:      certRes.Domain,
+		Domains:     order.Domains,
+		OrderURL:    order.URL,
+		CertURL:     certRes.CertURL,
+		Certificate: certRes,
+	})
+}
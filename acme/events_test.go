@@ -0,0 +1,164 @@
+package acme
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type eventsMock struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (e *eventsMock) add(format string, args ...interface{}) {
+	e.mu.Lock()
+	e.events = append(e.events, fmt.Sprintf(format, args...))
+	e.mu.Unlock()
+}
+
+func (e *eventsMock) OrderCreated(event OrderEvent) {
+	e.add("order created %v %s", event.Domains, event.URL)
+}
+
+func (e *eventsMock) ChallengePresented(event ChallengeEvent) {
+	e.add("challenge presented %s %s %s %s", event.Domain, event.Type, event.URL, event.AuthorizationURL)
+}
+
+func (e *eventsMock) ChallengeValidated(event ChallengeEvent) {
+	e.add("challenge validated %s %s", event.Domain, event.Type)
+}
+
+func (e *eventsMock) ChallengeFailed(event ChallengeEvent) {
+	e.add("challenge failed %s %s: %t", event.Domain, event.Type, event.Err != nil)
+}
+
+func (e *eventsMock) CertificateIssued(event CertificateEvent) {
+	e.add("certificate issued %s %v %s %s %t", event.Domain, event.Domains, event.OrderURL, event.CertURL, len(event.Certificate.Certificate) > 0)
+}
+
+type nopProviderMock struct{}
+
+func (nopProviderMock) Present(domain, token, keyAuth string) error { return nil }
+func (nopProviderMock) CleanUp(domain, token, keyAuth string) error { return nil }
+
+func TestEvents(t *testing.T) {
+	defer func(f PreCheckFunc) { PreCheckDNS = f }(PreCheckDNS)
+	PreCheckDNS = func(fqdn, value string) (bool, error) { return true, nil }
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	// the stub server orders orderDomains, and validates the challenges of every domain but invalid.example.com.
+	var orderDomains []string
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+
+		parts := strings.Split(r.URL.Path, "/")
+		domain := parts[len(parts)-1]
+
+		switch {
+		case r.URL.Path == "/directory":
+			writeJSONResponse(w, directory{
+				NewNonceURL:   ts.URL + "/nonce",
+				NewAccountURL: ts.URL + "/account",
+				NewOrderURL:   ts.URL + "/newOrder",
+				RevokeCertURL: ts.URL + "/revokeCert",
+				KeyChangeURL:  ts.URL + "/keyChange",
+			})
+		case r.URL.Path == "/nonce":
+		case r.URL.Path == "/newOrder":
+			order := orderMessage{Status: "pending", Finalize: ts.URL + "/finalize"}
+			for _, domain := range orderDomains {
+				order.Identifiers = append(order.Identifiers, Identifier{Type: "dns", Value: domain})
+				order.Authorizations = append(order.Authorizations, ts.URL+"/authz/"+domain)
+			}
+			w.Header().Set("Location", ts.URL+"/order/1")
+			w.WriteHeader(http.StatusCreated)
+			writeJSONResponse(w, order)
+		case strings.HasPrefix(r.URL.Path, "/authz/") && r.Method == http.MethodPost:
+			writeJSONResponse(w, authorization{Status: "deactivated"})
+		case strings.HasPrefix(r.URL.Path, "/authz/"):
+			writeJSONResponse(w, authorization{
+				Status:     "pending",
+				Identifier: Identifier{Type: "dns", Value: domain},
+				Challenges: []challenge{{Type: string(DNS01), URL: ts.URL + "/chlg/" + domain, Token: "token"}},
+			})
+		case r.URL.Path == "/chlg/invalid.example.com":
+			writeJSONResponse(w, challenge{Type: string(DNS01), Status: "invalid", Error: RemoteError{Type: "urn:ietf:params:acme:error:unauthorized", Detail: "no TXT record"}})
+		case strings.HasPrefix(r.URL.Path, "/chlg/"):
+			writeJSONResponse(w, challenge{Type: string(DNS01), Status: "valid"})
+		case r.URL.Path == "/finalize":
+			writeJSONResponse(w, orderMessage{Status: "valid", Certificate: ts.URL + "/cert"})
+		case r.URL.Path == "/cert":
+			cert, err := generatePemCert(key, "example.com", nil)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Write(cert)
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     &RegistrationResource{URI: ts.URL + "/account/1"},
+		privatekey: key,
+	}
+
+	client, err := NewClient(ts.URL+"/directory", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	if err = client.SetChallengeProvider(DNS01, nopProviderMock{}); err != nil {
+		t.Fatal(err)
+	}
+
+	events := &eventsMock{}
+	client.SetEvents(events)
+
+	orderDomains = []string{"example.com", "invalid.example.com"}
+	if _, err = client.ObtainCertificate(orderDomains, false, key, false); err == nil {
+		t.Fatal("Expected the challenge of invalid.example.com to fail")
+	}
+
+	expected := []string{
+		"order created [example.com invalid.example.com] " + ts.URL + "/order/1",
+		"challenge presented example.com dns-01 " + ts.URL + "/chlg/example.com " + ts.URL + "/authz/example.com",
+		"challenge presented invalid.example.com dns-01 " + ts.URL + "/chlg/invalid.example.com " + ts.URL + "/authz/invalid.example.com",
+		"challenge validated example.com dns-01",
+		"challenge failed invalid.example.com dns-01: true",
+	}
+	if !reflect.DeepEqual(events.events, expected) {
+		t.Errorf("Expected the events\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(events.events, "\n"))
+	}
+
+	// the certificate is issued once every challenge is validated.
+	events.events = nil
+	orderDomains = []string{"example.com"}
+	if _, err = client.ObtainCertificate(orderDomains, false, key, false); err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []string{
+		"order created [example.com] " + ts.URL + "/order/1",
+		"challenge presented example.com dns-01 " + ts.URL + "/chlg/example.com " + ts.URL + "/authz/example.com",
+		"challenge validated example.com dns-01",
+		"certificate issued example.com [example.com] " + ts.URL + "/order/1 " + ts.URL + "/cert true",
+	}
+	if !reflect.DeepEqual(events.events, expected) {
+		t.Errorf("Expected the events\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(events.events, "\n"))
+	}
+}
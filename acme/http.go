@@ -1,6 +1,7 @@
 package acme
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
@@ -12,17 +13,26 @@ import (
 	"net/http"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/xenolf/lego/log"
+	"github.com/xenolf/lego/platform/wait"
 )
 
 var (
 	// UserAgent (if non-empty) will be tacked onto the User-Agent string in requests.
+	//
+	// Deprecated: it applies to every client of the process, use WithUserAgent.
 	UserAgent string
 
 	// HTTPClient is an HTTP client with a reasonable timeout value and
 	// potentially a custom *x509.CertPool based on the caCertificatesEnvVar
-	// environment variable (see the `initCertPool` function)
+	// environment variable (see the `initCertPool` function).
+	// It is used by the clients created without WithHTTPClient.
+	//
+	// Deprecated: it applies to every client of the process, use WithHTTPClient.
 	HTTPClient = http.Client{
 		Transport: &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
@@ -60,6 +70,9 @@ const (
 	// authenticate an ACME server with a HTTPS certificate not issued by a CA in
 	// the system-wide trusted root list.
 	caServerNameEnvVar = "LEGO_CA_SERVER_NAME"
+
+	// maxNonceRetries is the maximum number of retries of a request rejected because of a bad nonce.
+	maxNonceRetries = 5
 )
 
 // initCertPool creates a *x509.CertPool populated with the PEM certificates
@@ -84,19 +97,73 @@ func initCertPool() *x509.CertPool {
 	return nil
 }
 
+// sender performs the HTTP requests of an ACME client.
+type sender struct {
+	// client is the HTTP client used for the requests.
+	// HTTPClient is used if nil.
+	client *http.Client
+
+	// userAgentProduct (if non-empty) is prepended to the User-Agent string in requests, instead of UserAgent.
+	userAgentProduct string
+
+	// userAgentSuffix (if non-empty) is appended to the User-Agent string in requests.
+	userAgentSuffix string
+
+	// leveledLogger writes the log entries of the client, the logger of the log package is used if nil.
+	leveledLogger log.LeveledLogger
+
+	// rateLimitBudget is the maximum time spent waiting to retry a rate limited request.
+	// Rate limited requests are not retried if zero.
+	rateLimitBudget time.Duration
+}
+
+// defaultSender performs the HTTP requests with HTTPClient.
+var defaultSender = &sender{}
+
+// do sends the request using the HTTP client of the sender.
+// A nil sender is valid and uses HTTPClient.
+func (s *sender) do(req *http.Request) (*http.Response, error) {
+	if s == nil || s.client == nil {
+		return HTTPClient.Do(req)
+	}
+	return s.client.Do(req)
+}
+
+// userAgent builds and returns the User-Agent string to use in the requests of the sender.
+func (s *sender) userAgent() string {
+	ua := userAgent()
+	if s != nil && s.userAgentProduct != "" {
+		ua = userAgentOf(s.userAgentProduct)
+	}
+	if s != nil && s.userAgentSuffix != "" {
+		ua += " " + s.userAgentSuffix
+	}
+	return ua
+}
+
+// logger returns the logger of the client of the sender.
+// A nil sender is valid and uses the logger of the log package.
+func (s *sender) logger() log.LeveledLogger {
+	if s == nil || s.leveledLogger == nil {
+		return packageLogger{}
+	}
+	return s.leveledLogger
+}
+
 // httpHead performs a HEAD request with a proper User-Agent string.
 // The response body (resp.Body) is already closed when this function returns.
-func httpHead(url string) (resp *http.Response, err error) {
+func (s *sender) httpHead(ctx context.Context, url string) (resp *http.Response, err error) {
 	req, err := http.NewRequest(http.MethodHead, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to head %q: %v", url, err)
 	}
+	req = req.WithContext(ctx)
 
-	req.Header.Set("User-Agent", userAgent())
+	req.Header.Set("User-Agent", s.userAgent())
 
-	resp, err = HTTPClient.Do(req)
+	resp, err = s.do(req)
 	if err != nil {
-		return resp, fmt.Errorf("failed to do head %q: %v", url, err)
+		return resp, fmt.Errorf("failed to do head %q: %w", url, err)
 	}
 	resp.Body.Close()
 	return resp, err
@@ -104,35 +171,75 @@ func httpHead(url string) (resp *http.Response, err error) {
 
 // httpPost performs a POST request with a proper User-Agent string.
 // Callers should close resp.Body when done reading from it.
-func httpPost(url string, bodyType string, body io.Reader) (resp *http.Response, err error) {
+func (s *sender) httpPost(ctx context.Context, url string, bodyType string, body io.Reader) (resp *http.Response, err error) {
 	req, err := http.NewRequest(http.MethodPost, url, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to post %q: %v", url, err)
 	}
+	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", bodyType)
-	req.Header.Set("User-Agent", userAgent())
+	req.Header.Set("User-Agent", s.userAgent())
 
-	return HTTPClient.Do(req)
+	return s.do(req)
 }
 
 // httpGet performs a GET request with a proper User-Agent string.
 // Callers should close resp.Body when done reading from it.
-func httpGet(url string) (resp *http.Response, err error) {
+func (s *sender) httpGet(ctx context.Context, url string) (resp *http.Response, err error) {
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get %q: %v", url, err)
 	}
-	req.Header.Set("User-Agent", userAgent())
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", s.userAgent())
 
-	return HTTPClient.Do(req)
+	return s.do(req)
+}
+
+// rateLimitWait returns how long to wait before retrying a request rejected with err,
+// given the time already spent waiting to retry it.
+// It returns false if the request must not be retried.
+func (s *sender) rateLimitWait(err error, waited time.Duration) (time.Duration, bool) {
+	rateLimitErr, ok := err.(RateLimitError)
+	if !ok || s == nil || rateLimitErr.RetryAfter.IsZero() {
+		return 0, false
+	}
+
+	delay := time.Until(rateLimitErr.RetryAfter)
+	if delay < 0 {
+		delay = 0
+	}
+	if waited+delay > s.rateLimitBudget {
+		return 0, false
+	}
+	return delay, true
 }
 
 // getJSON performs an HTTP GET request and parses the response body
 // as JSON, into the provided respBody object.
-func getJSON(uri string, respBody interface{}) (http.Header, error) {
-	resp, err := httpGet(uri)
+// The request is retried when the server rate limits it, within the rate limit budget.
+func (s *sender) getJSON(ctx context.Context, uri string, respBody interface{}) (http.Header, error) {
+	var waited time.Duration
+	for {
+		hdr, err := s.doGetJSON(ctx, uri, respBody)
+
+		delay, ok := s.rateLimitWait(err, waited)
+		if !ok {
+			return hdr, err
+		}
+
+		s.logger().Warnf("acme: Rate limited on %s, retrying in %s", uri, delay)
+		if err := wait.Sleep(ctx, delay); err != nil {
+			return hdr, fmt.Errorf("failed to get json %q: %w", uri, err)
+		}
+		waited += delay
+	}
+}
+
+func (s *sender) doGetJSON(ctx context.Context, uri string, respBody interface{}) (http.Header, error) {
+	resp, err := s.httpGet(ctx, uri)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get json %q: %v", uri, err)
+		return nil, fmt.Errorf("failed to get json %q: %w", uri, err)
 	}
 	defer resp.Body.Close()
 
@@ -145,62 +252,105 @@ func getJSON(uri string, respBody interface{}) (http.Header, error) {
 
 // postJSON performs an HTTP POST request and parses the response body
 // as JSON, into the provided respBody object.
-func postJSON(j *jws, uri string, reqBody, respBody interface{}) (http.Header, error) {
-	jsonBytes, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, errors.New("Failed to marshal network message")
+// The request is signed again and retried with a fresh nonce when the server
+// rejects the nonce, up to maxNonceRetries times, and when the server rate limits it,
+// within the rate limit budget.
+func postJSON(ctx context.Context, j *jws, uri string, reqBody, respBody interface{}) (http.Header, error) {
+	if j.deactivated {
+		return nil, ErrAccountDeactivated
 	}
 
-	resp, err := j.post(uri, jsonBytes)
+	jsonBytes, err := json.Marshal(reqBody)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to post JWS message. -> %v", err)
+		return nil, errors.New("Failed to marshal network message")
 	}
 
-	defer resp.Body.Close()
+	var retries int
+	var waited time.Duration
+	var tosAgreed bool
+	for {
+		hdr, err := doPostJSON(ctx, j, uri, jsonBytes, respBody)
 
-	if resp.StatusCode >= http.StatusBadRequest {
-
-		err := handleHTTPError(resp)
+		if tosErr, ok := err.(TOSError); ok && !tosAgreed && j.tosChanged != nil {
+			if tosAgreed = j.tosChanged(ctx, tosErr.TOSURL); tosAgreed {
+				continue
+			}
+		}
 
-		switch err.(type) {
+		// ACME servers check the nonce before processing the payload,
+		// so it is always safe to retry the request.
+		if _, ok := err.(NonceError); ok && retries < maxNonceRetries {
+			retries++
+			j.logger().Warnf("acme: Bad nonce for %s, retrying with a fresh nonce (%d/%d)", uri, retries, maxNonceRetries)
+			continue
+		}
 
-		case NonceError:
+		delay, ok := j.getSender().rateLimitWait(err, waited)
+		if !ok {
+			return hdr, err
+		}
 
-			// Retry once if the nonce was invalidated
+		j.logger().Warnf("acme: Rate limited on %s, retrying in %s", uri, delay)
+		if err := wait.Sleep(ctx, delay); err != nil {
+			return hdr, fmt.Errorf("Failed to post JWS message. -> %w", err)
+		}
+		waited += delay
+	}
+}
 
-			retryResp, err := j.post(uri, jsonBytes)
-			if err != nil {
-				return nil, fmt.Errorf("Failed to post JWS message. -> %v", err)
-			}
+func doPostJSON(ctx context.Context, j *jws, uri string, jsonBytes []byte, respBody interface{}) (http.Header, error) {
+	resp, err := j.post(ctx, uri, jsonBytes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to post JWS message. -> %w", err)
+	}
 
-			defer retryResp.Body.Close()
+	defer resp.Body.Close()
 
-			if retryResp.StatusCode >= http.StatusBadRequest {
-				return retryResp.Header, handleHTTPError(retryResp)
-			}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return resp.Header, handleHTTPError(resp)
+	}
 
-			if respBody == nil {
-				return retryResp.Header, nil
-			}
+	if respBody == nil {
+		return resp.Header, nil
+	}
 
-			return retryResp.Header, json.NewDecoder(retryResp.Body).Decode(respBody)
+	return resp.Header, json.NewDecoder(resp.Body).Decode(respBody)
+}
 
-		default:
-			return resp.Header, err
+// parseRetryAfter parses the value of a Retry-After header,
+// which is either a number of seconds or an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
 
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
 		}
-
+		return time.Duration(seconds) * time.Second, true
 	}
 
-	if respBody == nil {
-		return resp.Header, nil
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
 	}
 
-	return resp.Header, json.NewDecoder(resp.Body).Decode(respBody)
+	ra := time.Until(date)
+	if ra < 0 {
+		ra = 0
+	}
+	return ra, true
 }
 
 // userAgent builds and returns the User-Agent string to use in requests.
 func userAgent() string {
-	ua := fmt.Sprintf("%s %s (%s; %s) %s", UserAgent, ourUserAgent, runtime.GOOS, runtime.GOARCH, defaultGoUserAgent)
+	return userAgentOf(UserAgent)
+}
+
+// userAgentOf builds and returns the User-Agent string of the given product token.
+func userAgentOf(product string) string {
+	ua := fmt.Sprintf("%s %s (%s; %s) %s", product, ourUserAgent, runtime.GOOS, runtime.GOARCH, defaultGoUserAgent)
 	return strings.TrimSpace(ua)
 }
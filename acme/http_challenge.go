@@ -1,6 +1,7 @@
 package acme
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/xenolf/lego/log"
@@ -17,9 +18,49 @@ func HTTP01ChallengePath(token string) string {
 	return "/.well-known/acme-challenge/" + token
 }
 
-func (s *httpChallenge) Solve(chlng challenge, domain string) error {
+// HTTPProbe describes a request received for an `http-01` challenge,
+// usually sent by the CA to validate the challenge.
+// A CA validating from multiple perspectives sends several probes for the same challenge.
+type HTTPProbe struct {
+	// Domain is the domain of the challenge,
+	// or the HOST header without port if the token does not match any challenge.
+	Domain     string
+	Token      string
+	RemoteAddr string
+	Host       string
+	// ProxyHeader is the header matched instead of Host, set with SetProxyHeader,
+	// and ProxyHost its value in the request.
+	ProxyHeader string
+	ProxyHost   string
+	UserAgent   string
+	// Matched is true if the request was answered with the key authorization:
+	// the token and the Host header (or the proxy header) matched the challenge.
+	Matched bool
+}
+
+// HTTPProbeFunc is called for every request received for an `http-01` challenge.
+// It may be called concurrently.
+type HTTPProbeFunc func(probe HTTPProbe)
+
+// LogHTTPProbe logs a single line for the probe. It is the default HTTPProbeFunc.
+func LogHTTPProbe(probe HTTPProbe) {
+	if probe.Matched {
+		log.Infof("[%s] acme: Served the key authorization to %s (Host: %s, User-Agent: %q)",
+			probe.Domain, probe.RemoteAddr, probe.Host, probe.UserAgent)
+		return
+	}
+	if probe.ProxyHeader != "" {
+		log.Warnf("[%s] acme: Received a request from %s not matching the challenge, check the token and the %s header (token: %q, Host: %s, %s: %q, User-Agent: %q)",
+			probe.Domain, probe.RemoteAddr, probe.ProxyHeader, probe.Token, probe.Host, probe.ProxyHeader, probe.ProxyHost, probe.UserAgent)
+		return
+	}
+	log.Warnf("[%s] acme: Received a request from %s not matching the challenge, check the token and the HOST header (token: %q, Host: %s, User-Agent: %q)",
+		probe.Domain, probe.RemoteAddr, probe.Token, probe.Host, probe.UserAgent)
+}
 
-	log.Infof("[%s] acme: Trying to solve HTTP-01", domain)
+func (s *httpChallenge) Solve(ctx context.Context, chlng challenge, domain string) error {
+
+	s.jws.logger().Infof("[%s] acme: Trying to solve HTTP-01", domain)
 
 	// Generate the Key Authorization for the challenge
 	keyAuth, err := getKeyAuthorization(chlng.Token, s.jws.privKey)
@@ -27,16 +68,23 @@ func (s *httpChallenge) Solve(chlng challenge, domain string) error {
 		return err
 	}
 
-	err = s.provider.Present(domain, chlng.Token, keyAuth)
+	record := challengeRecordFrom(ctx)
+	start := record.start()
+	err = presentChallenge(s.provider, chlng, domain, keyAuth)
+	record.end(phasePresent, start)
 	if err != nil {
 		return fmt.Errorf("[%s] error presenting token: %v", domain, err)
 	}
+	record.presented()
 	defer func() {
-		err := s.provider.CleanUp(domain, chlng.Token, keyAuth)
+		err := cleanUpChallenge(s.provider, chlng, domain, keyAuth)
 		if err != nil {
-			log.Warnf("[%s] error cleaning up: %v", domain, err)
+			s.jws.logger().Warnf("[%s] acme: Error cleaning up: %v", domain, err)
 		}
 	}()
 
-	return s.validate(s.jws, domain, chlng.URL, challenge{Type: chlng.Type, Token: chlng.Token, KeyAuthorization: keyAuth})
+	start = record.start()
+	defer record.end(phaseValidation, start)
+
+	return s.validate(ctx, s.jws, domain, chlng.URL, challenge{Type: chlng.Type, Token: chlng.Token, KeyAuthorization: keyAuth})
 }
@@ -0,0 +1,89 @@
+package acme
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// HTTPProviderHandler implements ChallengeProvider for `http-01` challenge as an http.Handler,
+// mounted in a web server already listening on the port 80 instead of starting one.
+// It answers the requests of `HTTP01ChallengePath(token)` for the presented challenges from memory,
+// and passes the other requests, including the ones of the tokens it does not present, to the next handler.
+// The challenges of several domains may be presented concurrently.
+type HTTPProviderHandler struct {
+	next  http.Handler
+	probe HTTPProbeFunc
+	// proxyHeader is the header matched against the domain instead of Host, if set.
+	proxyHeader string
+
+	// mu protects the challenges.
+	mu sync.RWMutex
+	// challenges are the presented challenges, by token.
+	challenges map[string]presentedHTTPChallenge
+}
+
+// NewHTTPProviderHandler creates a new HTTPProviderHandler passing the requests it does not answer to next,
+// or answering them with a 404 Not Found if next is nil.
+func NewHTTPProviderHandler(next http.Handler) *HTTPProviderHandler {
+	return &HTTPProviderHandler{next: next, challenges: make(map[string]presentedHTTPChallenge)}
+}
+
+// SetProbeHook sets the function called for every request of a presented token,
+// LogHTTPProbe is used if nil.
+// It must be called before the handler serves requests.
+func (h *HTTPProviderHandler) SetProbeHook(probe HTTPProbeFunc) {
+	h.probe = probe
+}
+
+// SetProxyHeader sets the header matched against the domain of the challenge instead of the Host header,
+// as HTTPProviderServer.SetProxyHeader.
+// It must be called before the handler serves requests.
+func (h *HTTPProviderHandler) SetProxyHeader(name string) {
+	h.proxyHeader = name
+}
+
+// Present makes the token available at `HTTP01ChallengePath(token)` for the requests served by the handler.
+func (h *HTTPProviderHandler) Present(domain, token, keyAuth string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.challenges[token] = presentedHTTPChallenge{domain: domain, keyAuth: keyAuth}
+	return nil
+}
+
+// CleanUp removes the token from `HTTP01ChallengePath(token)`,
+// whose requests are passed to the next handler again.
+func (h *HTTPProviderHandler) CleanUp(domain, token, keyAuth string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.challenges, token)
+	return nil
+}
+
+// ServeHTTP answers the requests of the presented tokens, and passes the others to the next handler.
+func (h *HTTPProviderHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, HTTP01ChallengePath("")) {
+		token := strings.TrimPrefix(r.URL.Path, HTTP01ChallengePath(""))
+
+		h.mu.RLock()
+		chlng, found := h.challenges[token]
+		h.mu.RUnlock()
+
+		if found {
+			probe := h.probe
+			if probe == nil {
+				probe = LogHTTPProbe
+			}
+			respondHTTPChallenge(w, r, token, chlng, found, h.proxyHeader, probe)
+			return
+		}
+	}
+
+	if h.next == nil {
+		http.NotFound(w, r)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
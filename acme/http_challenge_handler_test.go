@@ -0,0 +1,122 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func getBody(t *testing.T, uri string) (int, string) {
+	t.Helper()
+
+	resp, err := http.Get(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestHTTPProviderHandler(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("next " + r.URL.Path))
+	})
+	handler := NewHTTPProviderHandler(next)
+	var probes []HTTPProbe
+	handler.SetProbeHook(func(probe HTTPProbe) { probes = append(probes, probe) })
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 512)
+	j := &jws{privKey: privKey}
+	clientChallenge := challenge{Type: string(HTTP01), Token: "handler1"}
+	mockValidate := func(_ context.Context, _ *jws, _, _ string, chlng challenge) error {
+		status, body := getBody(t, srv.URL+HTTP01ChallengePath(chlng.Token))
+		if status != http.StatusOK || body != chlng.KeyAuthorization {
+			t.Errorf("Expected the key authorization %q, got %d %q", chlng.KeyAuthorization, status, body)
+		}
+		return nil
+	}
+	solver := &httpChallenge{jws: j, validate: mockValidate, provider: handler}
+
+	if err := solver.Solve(context.Background(), clientChallenge, "127.0.0.1"); err != nil {
+		t.Errorf("Solve error: got %v, want nil", err)
+	}
+	if len(probes) != 1 || !probes[0].Matched {
+		t.Errorf("Expected a matched probe, got %+v", probes)
+	}
+
+	// the token and the other paths fall through to the next handler.
+	for _, path := range []string{HTTP01ChallengePath(clientChallenge.Token), "/index.html"} {
+		if status, body := getBody(t, srv.URL+path); status != http.StatusOK || body != "next "+path {
+			t.Errorf("Expected %s to be served by the next handler, got %d %q", path, status, body)
+		}
+	}
+
+	// without next handler, the other paths are not found.
+	srv.Config.Handler = NewHTTPProviderHandler(nil)
+	if status, _ := getBody(t, srv.URL+"/index.html"); status != http.StatusNotFound {
+		t.Errorf("Expected a 404 Not Found without next handler, got %d", status)
+	}
+}
+
+func TestHTTPProviderHandlerConcurrentChallenges(t *testing.T) {
+	handler := NewHTTPProviderHandler(nil)
+	handler.SetProbeHook(func(HTTPProbe) {})
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			token, keyAuth := fmt.Sprintf("token%d", i), fmt.Sprintf("keyAuth%d", i)
+			if err := handler.Present("127.0.0.1", token, keyAuth); err != nil {
+				t.Error(err)
+				return
+			}
+			if status, body := getBody(t, srv.URL+HTTP01ChallengePath(token)); status != http.StatusOK || body != keyAuth {
+				t.Errorf("Expected the key authorization %q, got %d %q", keyAuth, status, body)
+			}
+			if err := handler.CleanUp("127.0.0.1", token, keyAuth); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(handler.challenges) != 0 {
+		t.Errorf("Expected the tokens to be removed, got %d", len(handler.challenges))
+	}
+}
+
+func TestClientHTTPChallengeHandler(t *testing.T) {
+	client := &Client{solvers: map[Challenge]solver{HTTP01: &httpChallenge{provider: &HTTPProviderServer{}}}}
+
+	handler := client.HTTPChallengeHandler(nil)
+	if client.solvers[HTTP01].(*httpChallenge).provider != handler.(*HTTPProviderHandler) {
+		t.Error("Expected the handler to be the HTTP provider")
+	}
+
+	if err := client.SetHTTPProxyHeader("X-Forwarded-Host"); err != nil {
+		t.Fatal(err)
+	}
+	if header := handler.(*HTTPProviderHandler).proxyHeader; header != "X-Forwarded-Host" {
+		t.Errorf("Expected the proxy header of the handler to be set, got %q", header)
+	}
+}
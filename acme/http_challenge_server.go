@@ -4,19 +4,41 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"os"
 	"strings"
-
-	"github.com/xenolf/lego/log"
+	"sync"
+	"time"
 )
 
 // HTTPProviderServer implements ChallengeProvider for `http-01` challenge
 // It may be instantiated without using the NewHTTPProviderServer function if
 // you want only to use the default values.
+// The challenges of several domains may be presented concurrently: they share a single web server,
+// kept for a few seconds once no challenge is presented, for the next challenges of the run.
 type HTTPProviderServer struct {
-	iface    string
-	port     string
-	done     chan bool
-	listener net.Listener
+	iface string
+	port  string
+	probe HTTPProbeFunc
+	// proxyHeader is the header matched against the domain instead of Host, if set.
+	proxyHeader string
+
+	// socketPath is the UNIX socket to listen on instead of iface and port, if set.
+	socketPath string
+	socketMode os.FileMode
+
+	// mu protects the web server and the challenges.
+	mu     sync.Mutex
+	server *challengeServer
+	// idleGeneration identifies the last closing of the server once idle, cancelled by a new challenge.
+	idleGeneration int
+	// challenges are the presented challenges, by token.
+	challenges map[string]presentedHTTPChallenge
+}
+
+// presentedHTTPChallenge is a challenge served by an HTTPProviderServer.
+type presentedHTTPChallenge struct {
+	domain  string
+	keyAuth string
 }
 
 // NewHTTPProviderServer creates a new HTTPProviderServer on the selected interface and port.
@@ -26,56 +48,205 @@ func NewHTTPProviderServer(iface, port string) *HTTPProviderServer {
 	return &HTTPProviderServer{iface: iface, port: port}
 }
 
-// Present starts a web server and makes the token available at `HTTP01ChallengePath(token)` for web requests.
+// NewUnixProviderServer creates a new HTTPProviderServer listening on the UNIX socket socketPath,
+// e.g. for a local reverse proxy forwarding the requests of `HTTP01ChallengePath("")` to it.
+// The socket is created with the permissions mode, 0666 if zero, and removed once no challenge is presented anymore.
+func NewUnixProviderServer(socketPath string, mode os.FileMode) *HTTPProviderServer {
+	if mode == 0 {
+		mode = 0666
+	}
+	return &HTTPProviderServer{socketPath: socketPath, socketMode: mode}
+}
+
+// SetProbeHook sets the function called for every request received under `HTTP01ChallengePath("")`,
+// LogHTTPProbe is used if nil.
+// It must be called before Present.
+func (s *HTTPProviderServer) SetProbeHook(probe HTTPProbeFunc) {
+	s.probe = probe
+}
+
+// SetProxyHeader sets the header matched against the domain of the challenge instead of the Host header,
+// e.g. X-Forwarded-Host behind a reverse proxy rewriting the Host header.
+// The first value of a header listing several hops is used,
+// and the requests without the header are matched with the Host header.
+// It must be called before Present.
+func (s *HTTPProviderServer) SetProxyHeader(name string) {
+	s.proxyHeader = name
+}
+
+// Present starts a web server if needed and makes the token available at `HTTP01ChallengePath(token)` for web requests.
 func (s *HTTPProviderServer) Present(domain, token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.port == "" {
 		s.port = "80"
 	}
 
-	var err error
-	s.listener, err = net.Listen("tcp", net.JoinHostPort(s.iface, s.port))
-	if err != nil {
-		return fmt.Errorf("Could not start HTTP server for challenge -> %v", err)
+	// the server waiting for its closing is kept.
+	s.idleGeneration++
+
+	if s.server == nil {
+		listener, err := s.listen()
+		if err != nil {
+			return fmt.Errorf("Could not start HTTP server for challenge -> %v", err)
+		}
+
+		s.server = startChallengeServer(listener, s.handler())
 	}
 
-	s.done = make(chan bool)
-	go s.serve(domain, token, keyAuth)
+	if s.challenges == nil {
+		s.challenges = make(map[string]presentedHTTPChallenge)
+	}
+	s.challenges[token] = presentedHTTPChallenge{domain: domain, keyAuth: keyAuth}
 	return nil
 }
 
-// CleanUp closes the HTTP server and removes the token from `HTTP01ChallengePath(token)`
+// CleanUp removes the token from `HTTP01ChallengePath(token)`.
+// Once no challenge is presented anymore, the HTTP server is closed after a few seconds without new challenge,
+// or immediately if it listens on a UNIX socket, waiting for the requests in flight.
 func (s *HTTPProviderServer) CleanUp(domain, token, keyAuth string) error {
-	if s.listener == nil {
+	s.mu.Lock()
+	delete(s.challenges, token)
+
+	if s.server == nil || len(s.challenges) > 0 {
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.idleGeneration++
+	generation := s.idleGeneration
+	s.mu.Unlock()
+
+	if s.socketPath != "" {
+		s.closeIdle(generation)
 		return nil
 	}
-	s.listener.Close()
-	<-s.done
+
+	time.AfterFunc(challengeServerIdleTimeout, func() { s.closeIdle(generation) })
 	return nil
 }
 
-func (s *HTTPProviderServer) serve(domain, token, keyAuth string) {
-	path := HTTP01ChallengePath(token)
+// closeIdle closes the server, unless a challenge was presented since the given idle generation.
+func (s *HTTPProviderServer) closeIdle(generation int) {
+	s.mu.Lock()
+	if s.server == nil || s.idleGeneration != generation {
+		s.mu.Unlock()
+		return
+	}
+	server := s.server
+	s.server = nil
+	s.mu.Unlock()
 
-	// The handler validates the HOST header and request type.
-	// For validation it then writes the token the server returned with the challenge
-	mux := http.NewServeMux()
-	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.Host, domain) && r.Method == http.MethodGet {
-			w.Header().Add("Content-Type", "text/plain")
-			w.Write([]byte(keyAuth))
-			log.Infof("[%s] Served key authentication", domain)
+	server.shutdown()
+}
+
+// listen listens on the UNIX socket of the server if set, on its interface and port otherwise.
+func (s *HTTPProviderServer) listen() (net.Listener, error) {
+	if s.socketPath == "" {
+		return listenTCP(net.JoinHostPort(s.iface, s.port))
+	}
+
+	// the socket left by a process which did not clean up is removed, not the one of a running server.
+	if info, err := os.Stat(s.socketPath); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", s.socketPath); err == nil {
+			conn.Close()
 		} else {
-			log.Warnf("Received request for domain %s with method %s but the domain did not match any challenge. Please ensure your are passing the HOST header properly.", r.Host, r.Method)
-			w.Write([]byte("TEST"))
+			os.Remove(s.socketPath)
 		}
+	}
+
+	listener, err := net.Listen("unix", s.socketPath)
+	if err != nil {
+		return nil, err
+	}
+	// the socket is removed when the listener is closed.
+	if err = os.Chmod(s.socketPath, s.socketMode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// handler returns the handler of the challenges of the server.
+func (s *HTTPProviderServer) handler() http.Handler {
+	probe := s.probe
+	if probe == nil {
+		probe = LogHTTPProbe
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(HTTP01ChallengePath(""), func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.URL.Path, HTTP01ChallengePath(""))
+
+		s.mu.Lock()
+		chlng, found := s.challenges[token]
+		s.mu.Unlock()
+
+		respondHTTPChallenge(w, r, token, chlng, found, s.proxyHeader, probe)
+	})
+
+	return mux
+}
+
+// respondHTTPChallenge answers the request of the token with the challenge, if found.
+// The handler validates the HOST header, or the proxy header if set, and request type.
+// For validation it then writes the token the server returned with the challenge
+func respondHTTPChallenge(w http.ResponseWriter, r *http.Request, token string, chlng presentedHTTPChallenge, found bool, proxyHeader string, probe HTTPProbeFunc) {
+	domain := chlng.domain
+	if !found {
+		domain = r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			domain = h
+		}
+	}
+
+	host := r.Host
+	var proxyHost string
+	if proxyHeader != "" {
+		proxyHost = r.Header.Get(proxyHeader)
+		if first := strings.TrimSpace(strings.Split(proxyHost, ",")[0]); first != "" {
+			host = first
+		}
+	}
+
+	matched := found && matchHost(host, chlng.domain) && r.Method == http.MethodGet
+
+	probe(HTTPProbe{
+		Domain:      domain,
+		Token:       token,
+		RemoteAddr:  r.RemoteAddr,
+		Host:        r.Host,
+		ProxyHeader: proxyHeader,
+		ProxyHost:   proxyHost,
+		UserAgent:   r.UserAgent(),
+		Matched:     matched,
 	})
 
-	httpServer := &http.Server{
-		Handler: mux,
+	if !matched {
+		// the token, the host or the method did not match the challenge
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Add("Content-Type", "text/plain")
+	w.Write([]byte(chlng.keyAuth))
+}
+
+// matchHost checks whether the HOST header matches the domain,
+// which can be an IP address (brackets are used around IPv6 addresses in the header).
+func matchHost(hostHeader, domain string) bool {
+	if strings.HasPrefix(hostHeader, domain) {
+		return true
+	}
+
+	host := hostHeader
+	if h, _, err := net.SplitHostPort(hostHeader); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.Equal(net.ParseIP(domain))
 	}
-	// Once httpServer is shut down we don't want any lingering
-	// connections, so disable KeepAlives.
-	httpServer.SetKeepAlivesEnabled(false)
-	httpServer.Serve(s.listener)
-	s.done <- true
+	return false
 }
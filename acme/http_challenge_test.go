@@ -1,20 +1,32 @@
 package acme
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+
+	"github.com/xenolf/lego/internal/challengetest"
 )
 
 func TestHTTPChallenge(t *testing.T) {
 	privKey, _ := rsa.GenerateKey(rand.Reader, 512)
 	j := &jws{privKey: privKey}
 	clientChallenge := challenge{Type: string(HTTP01), Token: "http1"}
-	mockValidate := func(_ *jws, _, _ string, chlng challenge) error {
+	mockValidate := func(_ context.Context, _ *jws, _, _ string, chlng challenge) error {
 		uri := "http://localhost:23457/.well-known/acme-challenge/" + chlng.Token
-		resp, err := httpGet(uri)
+		resp, err := defaultSender.httpGet(context.Background(), uri)
 		if err != nil {
 			return err
 		}
@@ -38,9 +50,52 @@ func TestHTTPChallenge(t *testing.T) {
 	}
 	solver := &httpChallenge{jws: j, validate: mockValidate, provider: &HTTPProviderServer{port: "23457"}}
 
-	if err := solver.Solve(clientChallenge, "localhost:23457"); err != nil {
+	if err := solver.Solve(context.Background(), clientChallenge, "localhost:23457"); err != nil {
+		t.Errorf("Solve error: got %v, want nil", err)
+	}
+}
+
+func TestHTTPChallengeProvider(t *testing.T) {
+	srv := challengetest.NewHTTPServer()
+	defer srv.Close()
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 512)
+	j := &jws{privKey: privKey}
+	clientChallenge := challenge{Type: string(HTTP01), Token: "http9"}
+	mockValidate := func(_ context.Context, _ *jws, _, _ string, chlng challenge) error {
+		resp, err := defaultSender.httpGet(context.Background(), srv.ChallengeURL(chlng.Token))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if string(body) != chlng.KeyAuthorization {
+			t.Errorf("Body: got %q, want %q", body, chlng.KeyAuthorization)
+		}
+		return nil
+	}
+	solver := &httpChallenge{jws: j, validate: mockValidate, provider: srv}
+
+	if err := solver.Solve(context.Background(), clientChallenge, "example.com"); err != nil {
 		t.Errorf("Solve error: got %v, want nil", err)
 	}
+	if srv.Requests() != 1 {
+		t.Errorf("Expected a single request for the challenge, got %d", srv.Requests())
+	}
+
+	// the token is not served once the challenge is cleaned up.
+	resp, err := http.Get(srv.ChallengeURL(clientChallenge.Token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the token to be removed, got %s", resp.Status)
+	}
 }
 
 func TestHTTPChallengeInvalidPort(t *testing.T) {
@@ -49,9 +104,282 @@ func TestHTTPChallengeInvalidPort(t *testing.T) {
 	clientChallenge := challenge{Type: string(HTTP01), Token: "http2"}
 	solver := &httpChallenge{jws: j, validate: stubValidate, provider: &HTTPProviderServer{port: "123456"}}
 
-	if err := solver.Solve(clientChallenge, "localhost:123456"); err == nil {
+	if err := solver.Solve(context.Background(), clientChallenge, "localhost:123456"); err == nil {
 		t.Errorf("Solve error: got %v, want error", err)
 	} else if want, want18 := "invalid port 123456", "123456: invalid port"; !strings.HasSuffix(err.Error(), want) && !strings.HasSuffix(err.Error(), want18) {
 		t.Errorf("Solve error: got %q, want suffix %q", err.Error(), want)
 	}
 }
+
+func TestHTTPChallengeCustomAddress(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 512)
+	j := &jws{privKey: privKey}
+	clientChallenge := challenge{Type: string(HTTP01), Token: "http4", URL: "http://example.com/chlg/1"}
+
+	// the CA connects to the port 80 of the domain, forwarded to the port lego listens on.
+	mockValidate := func(_ context.Context, _ *jws, domain, uri string, chlng challenge) error {
+		if uri != clientChallenge.URL {
+			t.Errorf("Expected the challenge URL %s, got %s", clientChallenge.URL, uri)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:23461"+HTTP01ChallengePath(chlng.Token), nil)
+		req.Host = domain
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if string(body) != chlng.KeyAuthorization {
+			t.Errorf("Got the key authorization %q, want %q", body, chlng.KeyAuthorization)
+		}
+		return nil
+	}
+	solver := &httpChallenge{jws: j, validate: mockValidate, provider: NewHTTPProviderServer("127.0.0.1", "23461")}
+
+	if err := solver.Solve(context.Background(), clientChallenge, "example.com"); err != nil {
+		t.Errorf("Solve error: got %v, want nil", err)
+	}
+}
+
+func TestHTTPProviderServerBusyPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:23462")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	provider := NewHTTPProviderServer("127.0.0.1", "23462")
+	err = provider.Present("example.com", "http5", "http5.keyauth")
+	if err == nil {
+		t.Fatal("Expected an error for a port already in use")
+	}
+	if !strings.Contains(err.Error(), "127.0.0.1:23462") {
+		t.Errorf("Expected the error to contain the address, got %q", err)
+	}
+}
+
+func TestHTTPProviderServerProbeHook(t *testing.T) {
+	var mu sync.Mutex
+	var probes []HTTPProbe
+
+	provider := NewHTTPProviderServer("127.0.0.1", "23458")
+	provider.SetProbeHook(func(probe HTTPProbe) {
+		mu.Lock()
+		defer mu.Unlock()
+		probe.RemoteAddr = ""
+		probes = append(probes, probe)
+	})
+
+	if err := provider.Present("localhost", "http3", "http3.keyauth"); err != nil {
+		t.Fatalf("Present error: %v", err)
+	}
+
+	// several validation perspectives, then a mistyped token.
+	requests := []struct{ token, userAgent string }{
+		{token: "http3", userAgent: "perspective-1"},
+		{token: "http3", userAgent: "perspective-2"},
+		{token: "other", userAgent: "perspective-3"},
+	}
+	for _, request := range requests {
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:23458"+HTTP01ChallengePath(request.token), nil)
+		req.Host = "localhost"
+		req.Header.Set("User-Agent", request.userAgent)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Get error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if err := provider.CleanUp("localhost", "http3", "http3.keyauth"); err != nil {
+		t.Fatalf("CleanUp error: %v", err)
+	}
+
+	expected := []HTTPProbe{
+		{Domain: "localhost", Token: "http3", Host: "localhost", UserAgent: "perspective-1", Matched: true},
+		{Domain: "localhost", Token: "http3", Host: "localhost", UserAgent: "perspective-2", Matched: true},
+		{Domain: "localhost", Token: "other", Host: "localhost", UserAgent: "perspective-3", Matched: false},
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(probes, expected) {
+		t.Errorf("got probes %+v; want %+v", probes, expected)
+	}
+}
+
+func TestHTTPProviderServerUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "http.sock")
+
+	provider := NewUnixProviderServer(socketPath, 0660)
+	if err = provider.Present("example.com", "http6", "http6.keyauth"); err != nil {
+		t.Fatalf("Present error: %v", err)
+	}
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("Expected the socket to be created: %v", err)
+	}
+	if info.Mode().Perm() != 0660 {
+		t.Errorf("Expected the socket with the mode 0660, got %v", info.Mode().Perm())
+	}
+
+	// the reverse proxy forwards the challenges to the socket, with the Host header of the request.
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: "socket"})
+	proxy.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Host = r.Header.Get("X-Test-Host")
+	}
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	testCases := []struct {
+		host     string
+		expected string
+	}{
+		{host: "example.com", expected: "http6.keyauth"},
+		{host: "other.example.com", expected: "404 page not found\n"},
+	}
+	for _, test := range testCases {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+HTTP01ChallengePath("http6"), nil)
+		req.Header.Set("X-Test-Host", test.host)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Get error: %v", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(body) != test.expected {
+			t.Errorf("Response for the Host %s: got %q, want %q", test.host, body, test.expected)
+		}
+	}
+
+	if err = provider.CleanUp("example.com", "http6", "http6.keyauth"); err != nil {
+		t.Fatalf("CleanUp error: %v", err)
+	}
+	if _, err = os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the socket to be removed, got %v", err)
+	}
+}
+
+func TestHTTPProviderServerProxyHeader(t *testing.T) {
+	var mu sync.Mutex
+	var probes []HTTPProbe
+
+	provider := NewHTTPProviderServer("127.0.0.1", "23463")
+	provider.SetProxyHeader("X-Forwarded-Host")
+	provider.SetProbeHook(func(probe HTTPProbe) {
+		mu.Lock()
+		defer mu.Unlock()
+		probes = append(probes, probe)
+	})
+
+	if err := provider.Present("example.com", "http7", "http7.keyauth"); err != nil {
+		t.Fatalf("Present error: %v", err)
+	}
+	defer provider.CleanUp("example.com", "http7", "http7.keyauth")
+
+	testCases := []struct {
+		desc           string
+		host           string
+		forwardedHost  string
+		expectedStatus int
+	}{
+		{desc: "rewritten Host", host: "backend:8080", forwardedHost: "example.com", expectedStatus: http.StatusOK},
+		{desc: "several hops", host: "backend:8080", forwardedHost: "example.com, proxy.internal", expectedStatus: http.StatusOK},
+		{desc: "no header", host: "example.com", expectedStatus: http.StatusOK},
+		{desc: "other domain", host: "example.com", forwardedHost: "other.example.com", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, test := range testCases {
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:23463"+HTTP01ChallengePath("http7"), nil)
+		req.Host = test.host
+		if test.forwardedHost != "" {
+			req.Header.Set("X-Forwarded-Host", test.forwardedHost)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Get error: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != test.expectedStatus {
+			t.Errorf("%s: got the status %d, want %d", test.desc, resp.StatusCode, test.expectedStatus)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	last := probes[len(probes)-1]
+	if last.Matched || last.ProxyHeader != "X-Forwarded-Host" || last.ProxyHost != "other.example.com" {
+		t.Errorf("Expected the unmatched probe to record the proxy header, got %+v", last)
+	}
+}
+
+func TestHTTPProviderServerSequentialChallenges(t *testing.T) {
+	provider := NewHTTPProviderServer("127.0.0.1", "23465")
+
+	var server *challengeServer
+	for _, domain := range []string{"a.example.com", "b.example.com"} {
+		if err := provider.Present(domain, "token-"+domain, "keyauth-"+domain); err != nil {
+			t.Fatalf("Present error: %v", err)
+		}
+		if server != nil && provider.server != server {
+			t.Error("Expected the server of the previous challenge to be reused")
+		}
+		server = provider.server
+
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:23465"+HTTP01ChallengePath("token-"+domain), nil)
+		req.Host = domain
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Get error: %v", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "keyauth-"+domain {
+			t.Errorf("Response for %s: got %q", domain, body)
+		}
+
+		if err = provider.CleanUp(domain, "token-"+domain, "keyauth-"+domain); err != nil {
+			t.Fatalf("CleanUp error: %v", err)
+		}
+	}
+
+	// a closing cancelled by a new challenge does not close the server.
+	provider.closeIdle(provider.idleGeneration - 1)
+	if provider.server == nil {
+		t.Fatal("Expected the server to be kept by a cancelled closing")
+	}
+
+	provider.closeIdle(provider.idleGeneration)
+	if provider.server != nil {
+		t.Fatal("Expected the server to be closed once idle")
+	}
+
+	// the port can be bound again at once.
+	listener, err := listenTCP("127.0.0.1:23465")
+	if err != nil {
+		t.Fatalf("Expected the port to be free, got %v", err)
+	}
+	listener.Close()
+}
@@ -1,12 +1,20 @@
 package acme
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
 )
 
 func TestHTTPHeadUserAgent(t *testing.T) {
@@ -17,7 +25,7 @@ func TestHTTPHeadUserAgent(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	_, err := httpHead(ts.URL)
+	_, err := defaultSender.httpHead(context.Background(), ts.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -38,7 +46,7 @@ func TestHTTPGetUserAgent(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	res, err := httpGet(ts.URL)
+	res, err := defaultSender.httpGet(context.Background(), ts.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -60,7 +68,7 @@ func TestHTTPPostUserAgent(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	res, err := httpPost(ts.URL, "text/plain", strings.NewReader("falalalala"))
+	res, err := defaultSender.httpPost(context.Background(), ts.URL, "text/plain", strings.NewReader("falalalala"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -208,3 +216,175 @@ p9BI7gVKtWSZYegicA==
 		})
 	}
 }
+
+func TestPostJSONBadNonceRetry(t *testing.T) {
+	var posts int
+	var usedNonces []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", posts))
+
+		body, _ := ioutil.ReadAll(r.Body)
+		sig, err := jose.ParseSigned(string(body))
+		if err != nil {
+			t.Errorf("Could not parse JWS: %v", err)
+		}
+		usedNonces = append(usedNonces, sig.Signatures[0].Protected.Nonce)
+
+		if posts <= 2 {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"type":"urn:ietf:params:acme:error:badNonce","detail":"JWS has an invalid anti-replay nonce"}`))
+			return
+		}
+
+		writeJSONResponse(w, accountMessage{Status: "valid"})
+	}))
+	defer ts.Close()
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 512)
+	j := &jws{privKey: privKey, getNonceURL: ts.URL}
+	j.nonces.Push("nonce-0")
+
+	var acc accountMessage
+	if _, err := postJSON(context.Background(), j, ts.URL, accountMessage{}, &acc); err != nil {
+		t.Fatalf("Expected the request to succeed after retries, got: %v", err)
+	}
+
+	if acc.Status != "valid" {
+		t.Errorf("Expected status valid, got %q", acc.Status)
+	}
+
+	expected := []string{"nonce-0", "nonce-1", "nonce-2"}
+	if !reflect.DeepEqual(usedNonces, expected) {
+		t.Errorf("Expected nonces %v, got %v", expected, usedNonces)
+	}
+}
+
+func TestPostJSONBadNonceRetryLimit(t *testing.T) {
+	var posts int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", posts))
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"type":"urn:ietf:params:acme:error:badNonce","detail":"JWS has an invalid anti-replay nonce"}`))
+	}))
+	defer ts.Close()
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 512)
+	j := &jws{privKey: privKey, getNonceURL: ts.URL}
+	j.nonces.Push("nonce-0")
+
+	_, err := postJSON(context.Background(), j, ts.URL, accountMessage{}, nil)
+	if _, ok := err.(NonceError); !ok {
+		t.Fatalf("Expected a NonceError, got: %v", err)
+	}
+
+	if posts != maxNonceRetries+1 {
+		t.Errorf("Expected %d requests, got %d", maxNonceRetries+1, posts)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{desc: "seconds", value: "120", expected: 120 * time.Second, ok: true},
+		{desc: "past date", value: "Wed, 21 Oct 2015 07:28:00 GMT", expected: 0, ok: true},
+		{desc: "empty", value: "", ok: false},
+		{desc: "negative", value: "-1", ok: false},
+		{desc: "invalid", value: "soon", ok: false},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			ra, ok := parseRetryAfter(test.value)
+			if ok != test.ok || ra != test.expected {
+				t.Errorf("Expected (%s, %t), got (%s, %t)", test.expected, test.ok, ra, ok)
+			}
+		})
+	}
+
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	ra, ok := parseRetryAfter(date)
+	if !ok || ra <= 58*time.Minute || ra > time.Hour {
+		t.Errorf("Expected about an hour for %q, got (%s, %t)", date, ra, ok)
+	}
+}
+
+func TestPostJSONRateLimited(t *testing.T) {
+	var posts int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", posts))
+
+		if posts == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"type":"urn:ietf:params:acme:error:rateLimited","detail":"Too many requests"}`))
+			return
+		}
+
+		writeJSONResponse(w, accountMessage{Status: "valid"})
+	}))
+	defer ts.Close()
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 512)
+
+	// Without budget, the typed error is returned right away.
+	j := &jws{privKey: privKey, getNonceURL: ts.URL}
+	j.nonces.Push("nonce-0")
+
+	_, err := postJSON(context.Background(), j, ts.URL, accountMessage{}, nil)
+	rateLimitErr, ok := err.(RateLimitError)
+	if !ok {
+		t.Fatalf("Expected a RateLimitError, got: %v", err)
+	}
+	if wait := time.Until(rateLimitErr.RetryAfter); wait <= 0 || wait > time.Second {
+		t.Errorf("Expected to retry within a second, got %s", wait)
+	}
+
+	// With budget, the request is retried after the advertised delay.
+	posts = 0
+	j = &jws{sender: &sender{rateLimitBudget: 5 * time.Second}, privKey: privKey, getNonceURL: ts.URL}
+	j.nonces.Push("nonce-0")
+
+	start := time.Now()
+	var acc accountMessage
+	if _, err = postJSON(context.Background(), j, ts.URL, accountMessage{}, &acc); err != nil {
+		t.Fatalf("Expected the request to succeed after a retry, got: %v", err)
+	}
+	if acc.Status != "valid" {
+		t.Errorf("Expected status valid, got %q", acc.Status)
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Errorf("Expected to wait for the Retry-After delay, waited %s", elapsed)
+	}
+	if posts != 2 {
+		t.Errorf("Expected 2 requests, got %d", posts)
+	}
+}
+
+func TestGetJSONServiceUnavailableBudgetExceeded(t *testing.T) {
+	var gets int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets++
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	s := &sender{rateLimitBudget: 5 * time.Second}
+	_, err := s.getJSON(context.Background(), ts.URL, nil)
+	if _, ok := err.(RateLimitError); !ok {
+		t.Fatalf("Expected a RateLimitError, got: %v", err)
+	}
+	if gets != 1 {
+		t.Errorf("Expected 1 request, got %d", gets)
+	}
+}
@@ -0,0 +1,50 @@
+package acme
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile converts the domains to their A-label form,
+// with the transitional processing Let's Encrypt expects.
+var idnaProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.Transitional(true))
+
+// DomainToASCII returns the normalized A-label (punycode) form of the domain
+// used in orders and CSRs: lower case, without trailing dot.
+// Wildcard domains and IP addresses are supported.
+// The error names the offending label of a malformed domain.
+func DomainToASCII(domain string) (string, error) {
+	if net.ParseIP(domain) != nil {
+		return domain, nil
+	}
+
+	name := strings.TrimSuffix(domain, ".")
+
+	var wildcard string
+	if strings.HasPrefix(name, "*.") {
+		wildcard, name = "*.", name[2:]
+	}
+
+	ascii, err := idnaProfile.ToASCII(name)
+	if err != nil {
+		return "", fmt.Errorf("acme: invalid domain %q: %v", domain, err)
+	}
+
+	return wildcard + ascii, nil
+}
+
+// domainsToASCII returns the A-label form of the domains.
+func domainsToASCII(domains []string) ([]string, error) {
+	var asciiDomains []string
+	for _, domain := range domains {
+		ascii, err := DomainToASCII(domain)
+		if err != nil {
+			return nil, err
+		}
+		asciiDomains = append(asciiDomains, ascii)
+	}
+	return asciiDomains, nil
+}
@@ -0,0 +1,44 @@
+package acme
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDomainToASCII(t *testing.T) {
+	testCases := []struct {
+		domain   string
+		expected string
+	}{
+		{domain: "example.com", expected: "example.com"},
+		{domain: "bücher.example", expected: "xn--bcher-kva.example"},
+		{domain: "Bücher.Example", expected: "xn--bcher-kva.example"},
+		{domain: "WWW.Example.COM.", expected: "www.example.com"},
+		{domain: "*.bücher.example", expected: "*.xn--bcher-kva.example"},
+		{domain: "faß.de", expected: "fass.de"},
+		{domain: "xn--bcher-kva.example", expected: "xn--bcher-kva.example"},
+		{domain: "192.0.2.1", expected: "192.0.2.1"},
+		{domain: "2001:db8::1", expected: "2001:db8::1"},
+	}
+
+	for _, test := range testCases {
+		ascii, err := DomainToASCII(test.domain)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.domain, err)
+			continue
+		}
+		if ascii != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.domain, test.expected, ascii)
+		}
+	}
+}
+
+func TestDomainToASCIIInvalidLabel(t *testing.T) {
+	_, err := DomainToASCII("www.xn--a.example")
+	if err == nil {
+		t.Fatal("expected an error for a malformed label")
+	}
+	if !strings.Contains(err.Error(), "xn--a") {
+		t.Errorf("expected the error to name the offending label, got: %v", err)
+	}
+}
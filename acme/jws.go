@@ -2,37 +2,44 @@ package acme
 
 import (
 	"bytes"
+	"context"
 	"crypto"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rsa"
+	"encoding/json"
 	"fmt"
 	"net/http"
-	"sync"
 
+	"github.com/xenolf/lego/log"
 	"gopkg.in/square/go-jose.v2"
 )
 
 type jws struct {
+	sender      *sender
 	getNonceURL string
 	privKey     crypto.PrivateKey
 	kid         string
 	nonces      nonceManager
+	deactivated bool
+
+	// tosChanged is called when a request fails because the TOS changed.
+	// The request is retried if it returns true.
+	tosChanged func(ctx context.Context, tosURL string) bool
 }
 
 // Posts a JWS signed message to the specified URL.
 // It does NOT close the response body, so the caller must
 // do that if no error was returned.
-func (j *jws) post(url string, content []byte) (*http.Response, error) {
+func (j *jws) post(ctx context.Context, url string, content []byte) (*http.Response, error) {
 	signedContent, err := j.signContent(url, content)
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign content -> %s", err.Error())
+		j.nonces.Done()
+		return nil, fmt.Errorf("failed to sign content -> %w", err)
 	}
 
 	data := bytes.NewBuffer([]byte(signedContent.FullSerialize()))
-	resp, err := httpPost(url, "application/jose+json", data)
+	resp, err := j.getSender().httpPost(ctx, url, "application/jose+json", data)
+	j.nonces.Done()
 	if err != nil {
-		return nil, fmt.Errorf("failed to HTTP POST to %s -> %s", url, err.Error())
+		return nil, fmt.Errorf("failed to HTTP POST to %s -> %w", url, err)
 	}
 
 	nonce, nonceErr := getNonceFromResponse(resp)
@@ -44,26 +51,18 @@ func (j *jws) post(url string, content []byte) (*http.Response, error) {
 }
 
 func (j *jws) signContent(url string, content []byte) (*jose.JSONWebSignature, error) {
-
-	var alg jose.SignatureAlgorithm
-	switch k := j.privKey.(type) {
-	case *rsa.PrivateKey:
-		alg = jose.RS256
-	case *ecdsa.PrivateKey:
-		if k.Curve == elliptic.P256() {
-			alg = jose.ES256
-		} else if k.Curve == elliptic.P384() {
-			alg = jose.ES384
-		}
+	opaque, err := newOpaqueSigner(j.privKey)
+	if err != nil {
+		return nil, err
 	}
 
 	jsonKey := jose.JSONWebKey{
-		Key:   j.privKey,
+		Key:   opaque,
 		KeyID: j.kid,
 	}
 
 	signKey := jose.SigningKey{
-		Algorithm: alg,
+		Algorithm: opaque.alg,
 		Key:       jsonKey,
 	}
 	options := jose.SignerOptions{
@@ -87,9 +86,56 @@ func (j *jws) signContent(url string, content []byte) (*jose.JSONWebSignature, e
 	return signed, nil
 }
 
+// signKeyChange builds the inner JWS of a key change request:
+// the account URL and the current public key, signed by the new key.
+func (j *jws) signKeyChange(url string, newKey crypto.PrivateKey) (*jose.JSONWebSignature, error) {
+	oldJWK, err := publicJWK(j.privKey)
+	if err != nil {
+		return nil, err
+	}
+	oldJWKJSON, err := oldJWK.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("acme: error encoding the old jwk key: %s", err.Error())
+	}
+
+	payload, err := json.Marshal(keyChangeMessage{Account: j.kid, OldKey: oldJWKJSON})
+	if err != nil {
+		return nil, fmt.Errorf("acme: error encoding the key change payload: %s", err.Error())
+	}
+
+	newSigner, err := newOpaqueSigner(newKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// The inner JWS has no nonce.
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: newSigner.alg, Key: jose.JSONWebKey{Key: newSigner}},
+		&jose.SignerOptions{
+			EmbedJWK: true,
+			ExtraHeaders: map[jose.HeaderKey]interface{}{
+				"url": url,
+			},
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key change jose signer -> %s", err.Error())
+	}
+
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign key change content -> %s", err.Error())
+	}
+
+	return signed, nil
+}
+
 func (j *jws) signEABContent(url, kid string, hmac []byte) (*jose.JSONWebSignature, error) {
-	jwk := jose.JSONWebKey{Key: j.privKey}
-	jwkJSON, err := jwk.Public().MarshalJSON()
+	jwk, err := publicJWK(j.privKey)
+	if err != nil {
+		return nil, err
+	}
+	jwkJSON, err := jwk.MarshalJSON()
 	if err != nil {
 		return nil, fmt.Errorf("acme: error encoding eab jwk key: %s", err.Error())
 	}
@@ -116,42 +162,53 @@ func (j *jws) signEABContent(url, kid string, hmac []byte) (*jose.JSONWebSignatu
 	return signed, nil
 }
 
+// Nonce implements jose.NonceSource.
+// It checks out a nonce from the pool, or fetches a new one if the pool is empty.
 func (j *jws) Nonce() (string, error) {
-	if nonce, ok := j.nonces.Pop(); ok {
-		return nonce, nil
+	nonce, ok, prefetch := j.nonces.Checkout()
+	if prefetch {
+		go j.prefetchNonce()
 	}
 
-	return getNonce(j.getNonceURL)
-}
+	if ok {
+		return nonce, nil
+	}
 
-type nonceManager struct {
-	nonces []string
-	sync.Mutex
+	return getNonce(context.Background(), j.getSender(), j.getNonceURL)
 }
 
-func (n *nonceManager) Pop() (string, bool) {
-	n.Lock()
-	defer n.Unlock()
+// prefetchNonce fetches a new nonce and adds it to the pool.
+func (j *jws) prefetchNonce() {
+	defer j.nonces.PrefetchDone()
 
-	if len(n.nonces) == 0 {
-		return "", false
+	nonce, err := getNonce(context.Background(), j.getSender(), j.getNonceURL)
+	if err != nil {
+		return
 	}
+	j.nonces.Push(nonce)
+}
 
-	nonce := n.nonces[len(n.nonces)-1]
-	n.nonces = n.nonces[:len(n.nonces)-1]
-	return nonce, true
+// getSender returns the sender of the JWS requests, defaultSender if none.
+func (j *jws) getSender() *sender {
+	if j.sender == nil {
+		return defaultSender
+	}
+	return j.sender
 }
 
-func (n *nonceManager) Push(nonce string) {
-	n.Lock()
-	defer n.Unlock()
-	n.nonces = append(n.nonces, nonce)
+// logger returns the logger of the client of the jws.
+// A nil jws is valid and uses the logger of the log package.
+func (j *jws) logger() log.LeveledLogger {
+	if j == nil {
+		return packageLogger{}
+	}
+	return j.getSender().logger()
 }
 
-func getNonce(url string) (string, error) {
-	resp, err := httpHead(url)
+func getNonce(ctx context.Context, s *sender, url string) (string, error) {
+	resp, err := s.httpHead(ctx, url)
 	if err != nil {
-		return "", fmt.Errorf("failed to get nonce from HTTP HEAD -> %s", err.Error())
+		return "", fmt.Errorf("failed to get nonce from HTTP HEAD -> %w", err)
 	}
 
 	return getNonceFromResponse(resp)
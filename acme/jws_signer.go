@@ -0,0 +1,119 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// opaqueSigner signs the JWS with a crypto.Signer, as a jose.OpaqueSigner.
+// Only the Public and Sign methods of the key are used, never its private key material,
+// so that the account key can be kept in an HSM, a TPM or a cloud KMS.
+type opaqueSigner struct {
+	signer crypto.Signer
+	alg    jose.SignatureAlgorithm
+}
+
+// newOpaqueSigner returns the signer of the JWS signed with key,
+// whose algorithm is selected from the type of its public key.
+func newOpaqueSigner(key crypto.PrivateKey) (*opaqueSigner, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("acme: the key %T does not implement crypto.Signer", key)
+	}
+
+	alg := signatureAlgorithm(signer.Public())
+	if alg == "" {
+		return nil, fmt.Errorf("acme: unsupported public key type %T", signer.Public())
+	}
+	return &opaqueSigner{signer: signer, alg: alg}, nil
+}
+
+// Public implements jose.OpaqueSigner.
+func (s *opaqueSigner) Public() *jose.JSONWebKey {
+	return &jose.JSONWebKey{Key: s.signer.Public()}
+}
+
+// Algs implements jose.OpaqueSigner.
+func (s *opaqueSigner) Algs() []jose.SignatureAlgorithm {
+	return []jose.SignatureAlgorithm{s.alg}
+}
+
+// SignPayload implements jose.OpaqueSigner.
+func (s *opaqueSigner) SignPayload(payload []byte, alg jose.SignatureAlgorithm) ([]byte, error) {
+	var hash crypto.Hash
+	switch alg {
+	case jose.RS256, jose.ES256:
+		hash = crypto.SHA256
+	case jose.ES384:
+		hash = crypto.SHA384
+	default:
+		return nil, jose.ErrUnsupportedAlgorithm
+	}
+
+	hasher := hash.New()
+	hasher.Write(payload)
+	sig, err := s.signer.Sign(rand.Reader, hasher.Sum(nil), hash)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := s.signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return sig, nil
+	}
+
+	// a crypto.Signer returns an ASN.1 ECDSA signature, the JWS one is r || s,
+	// each of the size of the curve (RFC 7518, section 3.4).
+	var ecSig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(sig, &ecSig); err != nil {
+		return nil, fmt.Errorf("acme: invalid ECDSA signature: %v", err)
+	}
+	if ecSig.R == nil || ecSig.S == nil {
+		return nil, errors.New("acme: invalid ECDSA signature")
+	}
+
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	rBytes, sBytes := ecSig.R.Bytes(), ecSig.S.Bytes()
+	if len(rBytes) > size || len(sBytes) > size {
+		return nil, errors.New("acme: invalid ECDSA signature")
+	}
+
+	// r and s are left-padded with zeros.
+	out := make([]byte, 2*size)
+	copy(out[size-len(rBytes):size], rBytes)
+	copy(out[2*size-len(sBytes):], sBytes)
+	return out, nil
+}
+
+// signatureAlgorithm returns the JWS algorithm to use with the public key.
+func signatureAlgorithm(pub crypto.PublicKey) jose.SignatureAlgorithm {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return jose.RS256
+	case *ecdsa.PublicKey:
+		if k.Curve == elliptic.P256() {
+			return jose.ES256
+		} else if k.Curve == elliptic.P384() {
+			return jose.ES384
+		}
+	}
+	return ""
+}
+
+// publicJWK returns the JWK of the public key of key, which must implement crypto.Signer.
+func publicJWK(key crypto.PrivateKey) (*jose.JSONWebKey, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("acme: the key %T does not implement crypto.Signer", key)
+	}
+	return &jose.JSONWebKey{Key: signer.Public()}, nil
+}
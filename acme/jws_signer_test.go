@@ -0,0 +1,96 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// kmsSigner only exposes the Public and Sign methods of its key, as a key kept in an HSM or a KMS.
+type kmsSigner struct {
+	key crypto.Signer
+}
+
+func (s kmsSigner) Public() crypto.PublicKey { return s.key.Public() }
+
+func (s kmsSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.key.Sign(rand, digest, opts)
+}
+
+func TestSignWithSigner(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	ec256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	ec384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+	}))
+	defer ts.Close()
+
+	for _, test := range []struct {
+		key crypto.Signer
+		alg jose.SignatureAlgorithm
+	}{
+		{key: rsaKey, alg: jose.RS256},
+		{key: ec256Key, alg: jose.ES256},
+		{key: ec384Key, alg: jose.ES384},
+	} {
+		signer := kmsSigner{key: test.key}
+		j := &jws{sender: &sender{client: http.DefaultClient}, privKey: signer, getNonceURL: ts.URL, kid: "kid"}
+
+		signed, err := j.signContent(ts.URL, []byte(`{"hello":"world"}`))
+		if err != nil {
+			t.Errorf("%s: %v", test.alg, err)
+			continue
+		}
+
+		parsed, err := jose.ParseSigned(signed.FullSerialize())
+		if err != nil {
+			t.Errorf("%s: could not parse JWS: %v", test.alg, err)
+			continue
+		}
+		if alg := parsed.Signatures[0].Header.Algorithm; alg != string(test.alg) {
+			t.Errorf("Expected the algorithm %s, got %s", test.alg, alg)
+		}
+		payload, err := parsed.Verify(test.key.Public())
+		if err != nil {
+			t.Errorf("%s: could not verify JWS: %v", test.alg, err)
+		} else if string(payload) != `{"hello":"world"}` {
+			t.Errorf("%s: unexpected payload %s", test.alg, payload)
+		}
+
+		// the key authorization is the one of the wrapped key.
+		keyAuth, err := getKeyAuthorization("token", signer)
+		if err != nil {
+			t.Errorf("%s: %v", test.alg, err)
+		}
+		expected, err := getKeyAuthorization("token", test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keyAuth != expected {
+			t.Errorf("%s: expected the key authorization %s, got %s", test.alg, expected, keyAuth)
+		}
+	}
+
+	if _, err := newOpaqueSigner("not a key"); err == nil {
+		t.Error("Expected an error with a key which is not a crypto.Signer")
+	}
+}
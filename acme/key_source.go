@@ -0,0 +1,152 @@
+package acme
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+)
+
+// KeySource provides the private key of a certificate whose CSR is built by the client,
+// set in the Key of the OrderOptions.
+// GenerateKey, ReuseKeyOf and ExternalKey are the key sources of the package.
+type KeySource interface {
+	// CertificateKey returns the key signing the CSR, and the PEM encoding of its private key
+	// returned in the PrivateKey of the CertificateResource, nil if the key is external.
+	// keyType is the key type of the client.
+	CertificateKey(keyType KeyType) (crypto.Signer, []byte, error)
+}
+
+// GenerateKey returns the key source generating a new private key of the key type of the client
+// for every certificate, as when no key is given.
+func GenerateKey() KeySource {
+	return generatedKey{}
+}
+
+// GenerateKeyOfType returns the key source generating a new private key of the given key type for every certificate,
+// whatever the key type of the client.
+func GenerateKeyOfType(keyType KeyType) KeySource {
+	return generatedKey{keyType: keyType}
+}
+
+// ReuseKeyOf returns the key source reusing the private key of cert, e.g. to renew it with the same key.
+func ReuseKeyOf(cert CertificateResource) KeySource {
+	return reusedKey{cert: cert}
+}
+
+// ExternalKey returns the key source signing the CSR with signer, e.g. a key kept in an HSM.
+// The CertificateResource of the certificate has no PrivateKey and has ExternalKey set.
+func ExternalKey(signer crypto.Signer) KeySource {
+	return externalKey{signer: signer}
+}
+
+// generatedKey generates a key of its keyType, of the key type of the client if empty.
+type generatedKey struct {
+	keyType KeyType
+}
+
+func (k generatedKey) CertificateKey(keyType KeyType) (crypto.Signer, []byte, error) {
+	if k.keyType != "" {
+		keyType = k.keyType
+	}
+	privKey, err := GeneratePrivateKey(keyType)
+	if err != nil {
+		return nil, nil, err
+	}
+	return privKey.(crypto.Signer), pemEncode(privKey), nil
+}
+
+type reusedKey struct {
+	cert CertificateResource
+}
+
+func (k reusedKey) CertificateKey(KeyType) (crypto.Signer, []byte, error) {
+	if len(k.cert.PrivateKey) == 0 {
+		return nil, nil, fmt.Errorf("[%s] acme: the certificate has no private key to reuse", k.cert.Domain)
+	}
+
+	privKey, err := parsePEMPrivateKey(k.cert.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return privKey.(crypto.Signer), k.cert.PrivateKey, nil
+}
+
+type externalKey struct {
+	signer crypto.Signer
+}
+
+func (k externalKey) CertificateKey(KeyType) (crypto.Signer, []byte, error) {
+	if k.signer == nil {
+		return nil, nil, errors.New("acme: the external key was nil")
+	}
+	return k.signer, nil, nil
+}
+
+// privateKey is the key source of the private key given to ObtainCertificate.
+type privateKey struct {
+	key crypto.PrivateKey
+}
+
+func (k privateKey) CertificateKey(KeyType) (crypto.Signer, []byte, error) {
+	switch key := k.key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		return key.(crypto.Signer), pemEncode(key), nil
+	case crypto.Signer:
+		return key, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("acme: the private key %T does not implement crypto.Signer", k.key)
+	}
+}
+
+// keySourceOf returns the key source of a certificate requested with privKey and the options,
+// which cannot have both a key.
+func keySourceOf(privKey crypto.PrivateKey, opts OrderOptions) (KeySource, error) {
+	switch {
+	case privKey != nil && opts.Key != nil:
+		return nil, errors.New("acme: both a private key and a key source were given")
+	case privKey != nil:
+		return privateKey{key: privKey}, nil
+	case opts.Key != nil:
+		return opts.Key, nil
+	default:
+		return generatedKey{}, nil
+	}
+}
+
+// publicKeyType returns the key type of the public key, empty if it is not a key type of the package.
+func publicKeyType(pub crypto.PublicKey) KeyType {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		switch key.N.BitLen() {
+		case 2048:
+			return RSA2048
+		case 4096:
+			return RSA4096
+		case 8192:
+			return RSA8192
+		}
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return EC256
+		case elliptic.P384():
+			return EC384
+		}
+	}
+	return ""
+}
+
+// hasMustStaple returns true if the extensions request the OCSP must staple TLS feature.
+func hasMustStaple(extensions []pkix.Extension) bool {
+	for _, ext := range extensions {
+		if ext.Id.Equal(tlsFeatureExtensionOID) && bytes.Equal(ext.Value, ocspMustStapleFeature) {
+			return true
+		}
+	}
+	return false
+}
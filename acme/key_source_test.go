@@ -0,0 +1,190 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObtainCertificateKeySource(t *testing.T) {
+	defer func(f PreCheckFunc) { PreCheckDNS = f }(PreCheckDNS)
+	PreCheckDNS = func(fqdn, value string) (bool, error) { return true, nil }
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	// the stub server records the public key of the CSR of every finalized order.
+	var csrKey crypto.PublicKey
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+
+		switch {
+		case r.URL.Path == "/directory":
+			writeJSONResponse(w, directory{
+				NewNonceURL:   ts.URL + "/nonce",
+				NewAccountURL: ts.URL + "/account",
+				NewOrderURL:   ts.URL + "/newOrder",
+				RevokeCertURL: ts.URL + "/revokeCert",
+				KeyChangeURL:  ts.URL + "/keyChange",
+			})
+		case r.URL.Path == "/nonce":
+		case r.URL.Path == "/newOrder":
+			w.Header().Set("Location", ts.URL+"/order/1")
+			w.WriteHeader(http.StatusCreated)
+			writeJSONResponse(w, orderMessage{
+				Status:         "pending",
+				Identifiers:    []Identifier{{Type: "dns", Value: "example.com"}},
+				Authorizations: []string{ts.URL + "/authz/1"},
+				Finalize:       ts.URL + "/finalize",
+			})
+		case r.URL.Path == "/authz/1":
+			writeJSONResponse(w, authorization{Status: "valid", Identifier: Identifier{Type: "dns", Value: "example.com"}})
+		case r.URL.Path == "/finalize":
+			var msg csrMessage
+			if err := json.Unmarshal(readJWSPayload(t, r), &msg); err != nil {
+				http.Error(w, "invalid finalize request", http.StatusBadRequest)
+				return
+			}
+			der, err := base64.RawURLEncoding.DecodeString(msg.Csr)
+			if err != nil {
+				http.Error(w, "invalid CSR", http.StatusBadRequest)
+				return
+			}
+			csr, err := x509.ParseCertificateRequest(der)
+			if err != nil {
+				http.Error(w, "invalid CSR", http.StatusBadRequest)
+				return
+			}
+			csrKey = csr.PublicKey
+			writeJSONResponse(w, orderMessage{Status: "valid", Certificate: ts.URL + "/cert"})
+		case r.URL.Path == "/cert":
+			cert, err := generatePemCert(key, "example.com", nil)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Write(cert)
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     &RegistrationResource{URI: ts.URL + "/account/1"},
+		privatekey: key,
+	}
+	client, err := NewClient(ts.URL+"/directory", user, EC256)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+
+	domains := []string{"example.com"}
+
+	// a new key is generated without key source.
+	generated, err := client.ObtainCertificate(domains, false, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generated.ExternalKey || len(generated.PrivateKey) == 0 {
+		t.Fatalf("Expected the generated key in the certificate resource, got %+v", generated)
+	}
+	generatedKey, err := parsePEMPrivateKey(generated.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !samePublicKey(csrKey, generatedKey.(crypto.Signer).Public()) {
+		t.Error("Expected the CSR to be signed with the generated key")
+	}
+	if generated.KeyType != EC256 || !reflect.DeepEqual(generated.Domains, domains) || generated.Bundle || generated.MustStaple {
+		t.Errorf("Expected the request in the certificate resource, got %+v", generated)
+	}
+
+	// the renewal generates a key of the key type of the certificate, not of the client.
+	template := x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "example.com"}, NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	renewed, err := client.RenewCertificate(CertificateResource{Domain: "example.com", Certificate: certificate, KeyType: RSA2048}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := csrKey.(*rsa.PublicKey); !ok || renewed.KeyType != RSA2048 {
+		t.Errorf("Expected the renewal to generate an RSA key, got %T and %s", csrKey, renewed.KeyType)
+	}
+
+	// the key of the previous certificate is reused.
+	reused, err := client.ObtainCertificateWithOptions(context.Background(), domains, false, nil, false,
+		OrderOptions{Key: ReuseKeyOf(*generated)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reused.PrivateKey, generated.PrivateKey) || reused.ExternalKey {
+		t.Error("Expected the private key of the previous certificate in the certificate resource")
+	}
+	if !samePublicKey(csrKey, generatedKey.(crypto.Signer).Public()) {
+		t.Error("Expected the CSR to be signed with the reused key")
+	}
+
+	// the external key only signs the CSR, and is not included.
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	external, err := client.ObtainCertificateWithOptions(context.Background(), domains, false, nil, false,
+		OrderOptions{Key: ExternalKey(kmsSigner{key: ecKey})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !external.ExternalKey || len(external.PrivateKey) != 0 {
+		t.Errorf("Expected no private key in the certificate resource, got %+v", external)
+	}
+	if !samePublicKey(csrKey, ecKey.Public()) {
+		t.Error("Expected the CSR to be signed with the external key")
+	}
+
+	if _, err := client.RenewCertificate(*external, false, false); err == nil || !strings.Contains(err.Error(), "external key") {
+		t.Errorf("Expected the renewal without the external key to fail, got %v", err)
+	}
+
+	if _, err := client.ObtainCertificateWithOptions(context.Background(), domains, false, key, false,
+		OrderOptions{Key: GenerateKey()}); err == nil {
+		t.Error("Expected an error with both a private key and a key source")
+	}
+	if _, err := client.ObtainCertificateWithOptions(context.Background(), domains, false, nil, false,
+		OrderOptions{Key: ReuseKeyOf(*external)}); err == nil {
+		t.Error("Expected an error reusing the key of a certificate without private key")
+	}
+}
+
+// samePublicKey returns true if the public keys are equal.
+func samePublicKey(a, b crypto.PublicKey) bool {
+	aDER, err := x509.MarshalPKIXPublicKey(a)
+	if err != nil {
+		return false
+	}
+	bDER, err := x509.MarshalPKIXPublicKey(b)
+	return err == nil && bytes.Equal(aDER, bDER)
+}
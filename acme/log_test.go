@@ -0,0 +1,92 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xenolf/lego/internal/challengetest"
+)
+
+func TestChallengeLogNoSecrets(t *testing.T) {
+	srv, shutdown := startLocalNameserver(t)
+	defer shutdown()
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 512)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Replay-Nonce", "12345")
+		w.Write([]byte(`{"type":"dns01","status":"valid","uri":"http://some.url","token":"log1"}`))
+	}))
+	defer ts.Close()
+
+	keyAuth, err := getKeyAuthorization("log1", privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("dns-01", func(t *testing.T) {
+		logs := challengetest.RecordLogs()
+		defer logs.Stop()
+
+		j := &jws{privKey: privKey, getNonceURL: ts.URL}
+		solver := &dnsChallenge{jws: j, validate: validate, provider: srv}
+		chlng := challenge{Type: string(DNS01), Status: "pending", URL: ts.URL, Token: "log1"}
+
+		if err := solver.PreSolve(chlng, "log.example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if err := solver.Solve(context.Background(), chlng, "log.example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if err := solver.CleanUp(chlng, "log.example.com"); err != nil {
+			t.Fatal(err)
+		}
+
+		logs.AssertNoSecrets(t, keyAuth)
+		assertLogged(t, logs, "info: [log.example.com] acme: Trying to solve DNS-01")
+		assertLogged(t, logs, "debug: [log.example.com] acme: The TXT record _acme-challenge.log.example.com. is propagated (attempt 1)")
+	})
+
+	t.Run("http-01", func(t *testing.T) {
+		logs := challengetest.RecordLogs()
+		defer logs.Stop()
+
+		provider := &HTTPProviderServer{iface: "127.0.0.1", port: "23470"}
+		mockValidate := func(_ context.Context, _ *jws, _, _ string, chlng challenge) error {
+			// a request for another token is logged with the token, never with the key authorization.
+			for _, token := range []string{"other", chlng.Token} {
+				resp, err := http.Get("http://127.0.0.1:23470" + HTTP01ChallengePath(token))
+				if err != nil {
+					return err
+				}
+				resp.Body.Close()
+			}
+			return nil
+		}
+		solver := &httpChallenge{jws: &jws{privKey: privKey}, validate: mockValidate, provider: provider}
+
+		if err := solver.Solve(context.Background(), challenge{Type: string(HTTP01), Token: "log1"}, "log.example.com"); err != nil {
+			t.Fatal(err)
+		}
+
+		logs.AssertNoSecrets(t, keyAuth)
+		assertLogged(t, logs, "info: [log.example.com] acme: Trying to solve HTTP-01")
+		assertLogged(t, logs, "warn: [log.example.com] acme: Received a request from")
+	})
+}
+
+// assertLogged fails the test if no entry starts with prefix.
+func assertLogged(t *testing.T, logs *challengetest.LogRecorder, prefix string) {
+	t.Helper()
+
+	for _, entry := range logs.Entries() {
+		if strings.HasPrefix(entry, prefix) {
+			return
+		}
+	}
+	t.Errorf("Expected an entry %q, got %q", prefix, logs.Entries())
+}
@@ -1,8 +1,14 @@
 package acme
 
 import (
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"net"
+	"strings"
 	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
 )
 
 // RegistrationResource represents all important informations about a registration
@@ -10,20 +16,36 @@ import (
 type RegistrationResource struct {
 	Body accountMessage `json:"body,omitempty"`
 	URI  string         `json:"uri,omitempty"`
+
+	// TOSAgreedURL is the URL of the TOS the user agreed to, if any.
+	TOSAgreedURL string `json:"tosAgreedUrl,omitempty"`
 }
 
 type directory struct {
-	NewNonceURL   string `json:"newNonce"`
-	NewAccountURL string `json:"newAccount"`
-	NewOrderURL   string `json:"newOrder"`
-	RevokeCertURL string `json:"revokeCert"`
-	KeyChangeURL  string `json:"keyChange"`
-	Meta          struct {
-		TermsOfService          string   `json:"termsOfService"`
-		Website                 string   `json:"website"`
-		CaaIdentities           []string `json:"caaIdentities"`
-		ExternalAccountRequired bool     `json:"externalAccountRequired"`
-	} `json:"meta"`
+	NewNonceURL   string        `json:"newNonce"`
+	NewAccountURL string        `json:"newAccount"`
+	NewOrderURL   string        `json:"newOrder"`
+	RevokeCertURL string        `json:"revokeCert"`
+	KeyChangeURL  string        `json:"keyChange"`
+	Meta          DirectoryMeta `json:"meta"`
+
+	// RenewalInfoURL is the base URL of the renewal information (RFC 9773), empty if the CA does not support it.
+	RenewalInfoURL string `json:"renewalInfo,omitempty"`
+}
+
+// DirectoryMeta represents the metadata of the ACME directory.
+type DirectoryMeta struct {
+	TermsOfService          string   `json:"termsOfService"`
+	Website                 string   `json:"website"`
+	CaaIdentities           []string `json:"caaIdentities"`
+	ExternalAccountRequired bool     `json:"externalAccountRequired"`
+
+	// Profiles are the descriptions of the issuance profiles of the CA, by name.
+	Profiles map[string]string `json:"profiles,omitempty"`
+
+	// MaxIdentifiers is the maximum number of identifiers of an order, zero if the CA does not advertise it.
+	// DefaultMaxIdentifiers is used in that case, see Client.MaxIdentifiers.
+	MaxIdentifiers int `json:"maxIdentifiers,omitempty"`
 }
 
 type accountMessage struct {
@@ -35,35 +57,121 @@ type accountMessage struct {
 	ExternalAccountBinding json.RawMessage `json:"externalAccountBinding,omitempty"`
 }
 
+type keyChangeMessage struct {
+	Account string          `json:"account"`
+	OldKey  json.RawMessage `json:"oldKey"`
+}
+
+// newIdentifier returns the identifier of the domain,
+// which can be an IPv4 or IPv6 address (RFC 8738).
+func newIdentifier(domain string) Identifier {
+	if ip := net.ParseIP(domain); ip != nil {
+		return Identifier{Type: "ip", Value: ip.String()}
+	}
+	return Identifier{Type: "dns", Value: domain}
+}
+
 type orderResource struct {
 	URL          string   `json:"url,omitempty"`
 	Domains      []string `json:"domains,omitempty"`
 	orderMessage `json:"body,omitempty"`
 }
 
+// profile returns the profile of the order, as echoed by the CA or as requested.
+func (o orderResource) profile(opts OrderOptions) string {
+	if o.Profile != "" {
+		return o.Profile
+	}
+	return opts.Profile
+}
+
+// setOptions records the options of the order in the certificate, as echoed by the CA or as requested.
+func (o orderResource) setOptions(cert *CertificateResource, opts OrderOptions) {
+	cert.Profile = o.profile(opts)
+
+	cert.NotBefore, cert.NotAfter = o.NotBefore, o.NotAfter
+	if cert.NotBefore == "" {
+		cert.NotBefore = formatOrderTime(opts.NotBefore)
+	}
+	if cert.NotAfter == "" {
+		cert.NotAfter = formatOrderTime(opts.NotAfter)
+	}
+}
+
+// setRequest sets the request of the certificate of the order, so that the renewals can request it identically.
+func (o orderResource) setRequest(cert *CertificateResource, bundle, mustStaple bool) {
+	cert.Domains = o.Domains
+	cert.Bundle = bundle
+	cert.MustStaple = mustStaple
+}
+
 type orderMessage struct {
 	Status         string       `json:"status,omitempty"`
 	Expires        string       `json:"expires,omitempty"`
-	Identifiers    []identifier `json:"identifiers"`
+	Identifiers    []Identifier `json:"identifiers"`
 	NotBefore      string       `json:"notBefore,omitempty"`
 	NotAfter       string       `json:"notAfter,omitempty"`
 	Authorizations []string     `json:"authorizations,omitempty"`
 	Finalize       string       `json:"finalize,omitempty"`
 	Certificate    string       `json:"certificate,omitempty"`
+	Profile        string       `json:"profile,omitempty"`
+	Replaces       string       `json:"replaces,omitempty"`
+	// Error is the problem of an invalid order.
+	Error *ProblemDetails `json:"error,omitempty"`
 }
 
 type authorization struct {
 	Status     string      `json:"status"`
 	Expires    time.Time   `json:"expires"`
-	Identifier identifier  `json:"identifier"`
+	Identifier Identifier  `json:"identifier"`
 	Challenges []challenge `json:"challenges"`
+
+	// url is the location of the authorization, it is not part of the message.
+	url string
+}
+
+// setURL sets the location of the authorization and of its challenges.
+func (a *authorization) setURL(url string) {
+	a.url = url
+	for i := range a.Challenges {
+		a.Challenges[i].authzURL = url
+	}
 }
 
-type identifier struct {
+// Identifier is the identifier of an order, an authorization or a problem:
+// a domain (type "dns") or an IP address (type "ip").
+type Identifier struct {
 	Type  string `json:"type"`
 	Value string `json:"value"`
 }
 
+// ValidationRecord is the record of a validation attempt of the CA, sent with the http-01 and tls-alpn-01 challenges:
+// the URL and the host requested, and the addresses resolved and used to connect.
+type ValidationRecord struct {
+	URL               string   `json:"url,omitempty"`
+	Hostname          string   `json:"hostname,omitempty"`
+	Port              string   `json:"port,omitempty"`
+	AddressesResolved []string `json:"addressesResolved,omitempty"`
+	AddressUsed       string   `json:"addressUsed,omitempty"`
+}
+
+func (r ValidationRecord) String() string {
+	var parts []string
+	if r.URL != "" {
+		parts = append(parts, "url "+r.URL)
+	}
+	if r.Hostname != "" {
+		parts = append(parts, "hostname "+net.JoinHostPort(r.Hostname, r.Port))
+	}
+	if len(r.AddressesResolved) > 0 {
+		parts = append(parts, "resolved "+strings.Join(r.AddressesResolved, " "))
+	}
+	if r.AddressUsed != "" {
+		parts = append(parts, "used "+r.AddressUsed)
+	}
+	return strings.Join(parts, ", ")
+}
+
 type challenge struct {
 	URL              string      `json:"url"`
 	Type             string      `json:"type"`
@@ -72,6 +180,11 @@ type challenge struct {
 	Validated        time.Time   `json:"validated"`
 	KeyAuthorization string      `json:"keyAuthorization"`
 	Error            RemoteError `json:"error"`
+
+	ValidationRecord []ValidationRecord `json:"validationRecord,omitempty"`
+
+	// authzURL is the location of the authorization of the challenge, it is not part of the message.
+	authzURL string
 }
 
 type csrMessage struct {
@@ -80,24 +193,139 @@ type csrMessage struct {
 
 type revokeCertMessage struct {
 	Certificate string `json:"certificate"`
+	Reason      *uint  `json:"reason,omitempty"`
 }
 
 type deactivateAuthMessage struct {
-	Status string `jsom:"status"`
+	Status string `json:"status"`
+}
+
+type ordersMessage struct {
+	Orders []string `json:"orders"`
+}
+
+// Order represents an order of the account.
+type Order struct {
+	URL            string
+	Status         string
+	Expires        string
+	Identifiers    []string
+	Authorizations []string
+	Certificate    string
+	Profile        string
 }
 
 // CertificateResource represents a CA issued certificate.
 // PrivateKey, Certificate and IssuerCertificate are all
 // already PEM encoded and can be directly written to disk.
-// Certificate may be a certificate bundle, depending on the
-// options supplied to create it.
+// Certificate is the issued certificate only, or the issued certificate
+// followed by the issuer certificates if a bundle was requested.
+// IssuerCertificate always holds the issuer certificates sent by the CA, if any.
+// Profile, NotBefore and NotAfter are the options of the order (see OrderOptions),
+// only the profile is reused by the renewals.
+// Domains, KeyType, MustStaple and Bundle are the request of the certificate:
+// the identifiers of the order, the type of the key of the CSR, and the mustStaple and bundle arguments.
+// The renewals generating a new private key give it the KeyType.
+// ReuseKey is set if the renewals keep the private key of the certificate, given in PrivateKey.
+// ExternalKey is set if the private key was given as a crypto.Signer by a KeySource, e.g. ExternalKey:
+// PrivateKey is then empty.
 type CertificateResource struct {
-	Domain            string `json:"domain"`
-	CertURL           string `json:"certUrl"`
-	CertStableURL     string `json:"certStableUrl"`
-	AccountRef        string `json:"accountRef,omitempty"`
-	PrivateKey        []byte `json:"-"`
-	Certificate       []byte `json:"-"`
-	IssuerCertificate []byte `json:"-"`
-	CSR               []byte `json:"-"`
+	Domain            string   `json:"domain"`
+	CertURL           string   `json:"certUrl"`
+	CertStableURL     string   `json:"certStableUrl"`
+	AccountRef        string   `json:"accountRef,omitempty"`
+	Profile           string   `json:"profile,omitempty"`
+	NotBefore         string   `json:"notBefore,omitempty"`
+	NotAfter          string   `json:"notAfter,omitempty"`
+	Domains           []string `json:"domains,omitempty"`
+	KeyType           KeyType  `json:"keyType,omitempty"`
+	MustStaple        bool     `json:"mustStaple,omitempty"`
+	Bundle            bool     `json:"bundle,omitempty"`
+	ReuseKey          bool     `json:"reuseKey,omitempty"`
+	ExternalKey       bool     `json:"externalKey,omitempty"`
+	PrivateKey        []byte   `json:"-"`
+	Certificate       []byte   `json:"-"`
+	IssuerCertificate []byte   `json:"-"`
+	CSR               []byte   `json:"-"`
+}
+
+// Leaf returns the issued certificate, the first certificate of Certificate.
+func (c *CertificateResource) Leaf() (*x509.Certificate, error) {
+	certificates, err := ParsePEMBundle(c.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	return certificates[0], nil
+}
+
+// Chain returns the issuer certificates, from IssuerCertificate,
+// or from the bundle in Certificate if IssuerCertificate is empty.
+// The chain is empty if the CA did not send any issuer certificate.
+func (c *CertificateResource) Chain() ([]*x509.Certificate, error) {
+	if len(c.IssuerCertificate) > 0 {
+		return ParsePEMBundle(c.IssuerCertificate)
+	}
+
+	certificates, err := ParsePEMBundle(c.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	return certificates[1:], nil
+}
+
+// PEM returns the private key followed by the leaf certificate and the issuer chain,
+// the single PEM file expected by servers like HAProxy.
+// The issuer chain is included even if Certificate is not a bundle.
+func (c *CertificateResource) PEM() ([]byte, error) {
+	if len(c.PrivateKey) == 0 {
+		return nil, errors.New("acme: the private key of the certificate is unknown")
+	}
+
+	leaf, err := c.Leaf()
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := c.Chain()
+	if err != nil {
+		return nil, err
+	}
+
+	data := append([]byte{}, c.PrivateKey...)
+	for _, cert := range append([]*x509.Certificate{leaf}, chain...) {
+		data = append(data, pemEncode(derCertificateBytes(cert.Raw))...)
+	}
+	return data, nil
+}
+
+// PKCS12 encodes the private key, the leaf certificate and the issuer chain
+// into a PKCS#12 archive (.pfx) protected by the given password.
+// The archive is encrypted with 3DES and authenticated with a HMAC-SHA1,
+// the algorithms supported by most of the importers (Windows, Java keystores, OpenSSL).
+// The private key is unknown, and the archive cannot be encoded, if the certificate was obtained for a CSR.
+func (c *CertificateResource) PKCS12(password string) ([]byte, error) {
+	if len(c.PrivateKey) == 0 {
+		return nil, errors.New("acme: the private key of the certificate is unknown")
+	}
+
+	privateKey, err := parsePEMPrivateKey(c.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := c.Leaf()
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := c.Chain()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkCertificateKey(leaf, privateKey); err != nil {
+		return nil, err
+	}
+
+	return pkcs12.LegacyDES.Encode(privateKey, leaf, chain, password)
 }
@@ -0,0 +1,64 @@
+package acme
+
+import "sync"
+
+// nonceManager is a concurrency-safe pool of nonces fed by the Replay-Nonce headers of the responses.
+// Each nonce is checked out by a single request, so concurrent signers never reuse a nonce.
+type nonceManager struct {
+	nonces []string
+
+	// inflight is the number of checked out nonces for which no response was received yet.
+	inflight    int
+	prefetching bool
+
+	sync.Mutex
+}
+
+// Checkout removes a nonce from the pool, if any.
+// prefetch is true when the pool ran dry while other requests are in flight:
+// the caller should then fetch a nonce in the background and call PrefetchDone when finished.
+func (n *nonceManager) Checkout() (nonce string, ok bool, prefetch bool) {
+	n.Lock()
+	defer n.Unlock()
+
+	n.inflight++
+
+	if len(n.nonces) > 0 {
+		nonce = n.nonces[len(n.nonces)-1]
+		n.nonces = n.nonces[:len(n.nonces)-1]
+		ok = true
+	}
+
+	// A single signer is always refilled by the response to its request,
+	// only concurrent signers can drain the pool.
+	if len(n.nonces) == 0 && n.inflight > 1 && !n.prefetching {
+		n.prefetching = true
+		prefetch = true
+	}
+
+	return nonce, ok, prefetch
+}
+
+// Done marks a checked out nonce as used, whether the request succeeded or not.
+func (n *nonceManager) Done() {
+	n.Lock()
+	defer n.Unlock()
+
+	if n.inflight > 0 {
+		n.inflight--
+	}
+}
+
+// PrefetchDone marks the end of a background prefetch.
+func (n *nonceManager) PrefetchDone() {
+	n.Lock()
+	defer n.Unlock()
+	n.prefetching = false
+}
+
+// Push adds a nonce to the pool.
+func (n *nonceManager) Push(nonce string) {
+	n.Lock()
+	defer n.Unlock()
+	n.nonces = append(n.nonces, nonce)
+}
@@ -0,0 +1,122 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// newNonceServer returns a stub ACME server issuing a unique nonce with every response,
+// and recording the nonces used by the signed requests.
+func newNonceServer(t *testing.T) (*httptest.Server, *nonceServerStats) {
+	stats := &nonceServerStats{used: map[string]int{}}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats.Lock()
+		defer stats.Unlock()
+
+		stats.issued++
+		w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", stats.issued))
+
+		switch r.Method {
+		case http.MethodHead:
+			stats.newNonceCalls++
+		case http.MethodPost:
+			body, _ := ioutil.ReadAll(r.Body)
+			sig, err := jose.ParseSigned(string(body))
+			if err != nil {
+				t.Errorf("Could not parse JWS: %v", err)
+				return
+			}
+			stats.used[sig.Signatures[0].Protected.Nonce]++
+			writeJSONResponse(w, accountMessage{Status: "valid"})
+		}
+	}))
+
+	return ts, stats
+}
+
+type nonceServerStats struct {
+	issued        int
+	newNonceCalls int
+	used          map[string]int
+	sync.Mutex
+}
+
+func TestNonceManagerSequential(t *testing.T) {
+	ts, stats := newNonceServer(t)
+	defer ts.Close()
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 512)
+	j := &jws{privKey: privKey, getNonceURL: ts.URL}
+
+	for i := 0; i < 10; i++ {
+		if _, err := postJSON(context.Background(), j, ts.URL, accountMessage{}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stats.newNonceCalls != 1 {
+		t.Errorf("Expected 1 new-nonce call, got %d", stats.newNonceCalls)
+	}
+
+	for nonce, count := range stats.used {
+		if count > 1 {
+			t.Errorf("Nonce %s used %d times", nonce, count)
+		}
+	}
+}
+
+func TestNonceManagerConcurrent(t *testing.T) {
+	ts, stats := newNonceServer(t)
+	defer ts.Close()
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 512)
+	j := &jws{privKey: privKey, getNonceURL: ts.URL}
+
+	const workers, requestsPerWorker = 5, 20
+	const requests = workers * requestsPerWorker
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < requestsPerWorker; k++ {
+				if _, err := postJSON(context.Background(), j, ts.URL, accountMessage{}, nil); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats.Lock()
+	defer stats.Unlock()
+
+	var total int
+	for nonce, count := range stats.used {
+		total += count
+		if count > 1 {
+			t.Errorf("Nonce %s used %d times", nonce, count)
+		}
+	}
+
+	if total != requests {
+		t.Errorf("Expected %d signed requests, got %d", requests, total)
+	}
+
+	// the responses refill the pool: only the first requests of each worker,
+	// and a few prefetches while the pool is drained, need a new nonce.
+	if stats.newNonceCalls > 2*workers {
+		t.Errorf("Expected at most %d new-nonce calls, got %d", 2*workers, stats.newNonceCalls)
+	}
+}
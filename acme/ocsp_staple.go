@@ -0,0 +1,81 @@
+package acme
+
+import (
+	"encoding/pem"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// OCSPStaple is the OCSP response of a certificate, to staple in the TLS handshakes.
+type OCSPStaple struct {
+	// Raw is the DER encoding of the response, e.g. for the ssl_stapling_file of nginx.
+	Raw []byte
+	// Status is OCSPGood, OCSPRevoked or OCSPUnknown.
+	Status     int
+	RevokedAt  time.Time
+	ThisUpdate time.Time
+	// NextUpdate is the time of the next response, zero if the responder did not tell.
+	NextUpdate time.Time
+}
+
+// GetOCSPStaple fetches the OCSP response of the certificate, see GetOCSPForCert.
+// The issuer certificate is the one of IssuerCertificate, of the bundle in Certificate otherwise,
+// or downloaded from the IssuingCertificateURL of the certificate.
+// A response reporting the certificate as revoked is returned without error.
+func GetOCSPStaple(cert CertificateResource) (*OCSPStaple, error) {
+	leaf, err := cert.Leaf()
+	if err != nil {
+		return nil, err
+	}
+	chain, err := cert.Chain()
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+	if len(chain) > 0 {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: chain[0].Raw})...)
+	}
+
+	raw, resp, err := GetOCSPForCert(bundle)
+	if err != nil {
+		return nil, err
+	}
+	return newOCSPStaple(raw, resp), nil
+}
+
+// ParseOCSPStaple parses the DER encoding of an OCSP response, e.g. a response stored by the caller.
+// The signature of the response is not verified, it is expected to be verified by GetOCSPStaple.
+func ParseOCSPStaple(raw []byte) (*OCSPStaple, error) {
+	if len(raw) == 0 {
+		return nil, errors.New("acme: empty OCSP response")
+	}
+
+	resp, err := ocsp.ParseResponse(raw, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newOCSPStaple(raw, resp), nil
+}
+
+func newOCSPStaple(raw []byte, resp *ocsp.Response) *OCSPStaple {
+	return &OCSPStaple{
+		Raw:        raw,
+		Status:     resp.Status,
+		RevokedAt:  resp.RevokedAt,
+		ThisUpdate: resp.ThisUpdate,
+		NextUpdate: resp.NextUpdate,
+	}
+}
+
+// NeedsRefresh returns true if more than half of the validity of the response, from ThisUpdate to NextUpdate, has elapsed.
+// A response without NextUpdate always needs a refresh.
+func (s *OCSPStaple) NeedsRefresh(now time.Time) bool {
+	if s.NextUpdate.IsZero() || !s.NextUpdate.After(s.ThisUpdate) {
+		return true
+	}
+	half := s.NextUpdate.Sub(s.ThisUpdate) / 2
+	return !now.Before(s.ThisUpdate.Add(half))
+}
@@ -0,0 +1,125 @@
+package acme
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestGetOCSPStaple(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	caTemplate := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, &caTemplate, &caTemplate, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the responder reports the certificate with the given status.
+	status := ocsp.Good
+	thisUpdate := time.Now().Add(-time.Hour).Truncate(time.Second).UTC()
+	nextUpdate := thisUpdate.Add(4 * time.Hour)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   thisUpdate,
+			NextUpdate:   nextUpdate,
+			RevokedAt:    thisUpdate,
+		}, key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resp)
+	}))
+	defer ts.Close()
+
+	leafTemplate := x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		OCSPServer:   []string{ts.URL},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, &leafTemplate, ca, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := CertificateResource{
+		Domain:            "example.com",
+		Certificate:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}),
+		IssuerCertificate: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+	}
+
+	staple, err := GetOCSPStaple(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if staple.Status != OCSPGood || !staple.NextUpdate.Equal(nextUpdate) || len(staple.Raw) == 0 {
+		t.Errorf("Expected a good response until %s, got %+v", nextUpdate, staple)
+	}
+
+	parsed, err := ParseOCSPStaple(staple.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Status != OCSPGood || !parsed.ThisUpdate.Equal(thisUpdate) || !parsed.NextUpdate.Equal(nextUpdate) {
+		t.Errorf("Expected the stored response to be parsed, got %+v", parsed)
+	}
+
+	if staple.NeedsRefresh(thisUpdate.Add(time.Hour)) {
+		t.Error("Expected no refresh before half of the validity")
+	}
+	if !staple.NeedsRefresh(thisUpdate.Add(3 * time.Hour)) {
+		t.Error("Expected a refresh after half of the validity")
+	}
+	if !(&OCSPStaple{ThisUpdate: thisUpdate}).NeedsRefresh(thisUpdate) {
+		t.Error("Expected a refresh without NextUpdate")
+	}
+
+	status = ocsp.Revoked
+	revoked, err := GetOCSPStaple(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked.Status != OCSPRevoked || !revoked.RevokedAt.Equal(thisUpdate) {
+		t.Errorf("Expected a revoked response, got %+v", revoked)
+	}
+
+	if _, err := ParseOCSPStaple(nil); err == nil {
+		t.Error("Expected an error for an empty response")
+	}
+}
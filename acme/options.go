@@ -0,0 +1,88 @@
+package acme
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/xenolf/lego/log"
+)
+
+// ClientOption configures a Client created by NewClientWithOptions.
+type ClientOption func(*clientOptions) error
+
+// clientOptions are the settings of a client, stored on the client instance.
+type clientOptions struct {
+	keyType    KeyType
+	httpClient *http.Client
+	resolvers  []string
+	userAgent  string
+	logger     log.LeveledLogger
+}
+
+// WithKeyType sets the type of the private keys generated for the certificates
+// requested without key, RSA2048 by default.
+func WithKeyType(keyType KeyType) ClientOption {
+	return func(o *clientOptions) error {
+		o.keyType = keyType
+		return nil
+	}
+}
+
+// WithHTTPClient sends all the requests to the ACME server, including the directory discovery,
+// with the given HTTP client, e.g. one with a custom timeout. HTTPClient is used if nil.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(o *clientOptions) error {
+		o.httpClient = client
+		return nil
+	}
+}
+
+// WithDNSResolvers sets the recursive nameservers used by the client to find the zones
+// and to pre-check the propagation of the dns-01 challenges, instead of RecursiveNameservers.
+// Each nameserver is given as for SetRecursiveNameservers.
+// A client with resolvers checks the propagation with them, not with PreCheckDNS.
+func WithDNSResolvers(nameservers ...string) ClientOption {
+	return func(o *clientOptions) error {
+		if len(nameservers) == 0 {
+			return errors.New("no recursive nameservers provided")
+		}
+
+		o.resolvers = nil
+		for _, ns := range nameservers {
+			server, err := parseNameserver(ns)
+			if err != nil {
+				return err
+			}
+			o.resolvers = append(o.resolvers, server)
+		}
+		return nil
+	}
+}
+
+// WithUserAgent sets the product token (e.g. "myproduct/2.3") prepended to the User-Agent string
+// of the requests of the client, instead of UserAgent.
+func WithUserAgent(product string) ClientOption {
+	return func(o *clientOptions) error {
+		o.userAgent = strings.TrimSpace(product)
+		return nil
+	}
+}
+
+// WithLogger writes the log entries of the client, of its challenges and of its requests to logger,
+// instead of the logger of the log package.
+// The entries of the package functions, e.g. FindZoneByFqdn, are still written to the log package.
+func WithLogger(logger log.LeveledLogger) ClientOption {
+	return func(o *clientOptions) error {
+		o.logger = logger
+		return nil
+	}
+}
+
+// packageLogger writes the log entries with the logger of the log package, as set by log.SetLogger.
+type packageLogger struct{}
+
+func (packageLogger) Debugf(format string, args ...interface{}) { log.Debugf(format, args...) }
+func (packageLogger) Infof(format string, args ...interface{})  { log.Infof(format, args...) }
+func (packageLogger) Warnf(format string, args ...interface{})  { log.Warnf(format, args...) }
+func (packageLogger) Errorf(format string, args ...interface{}) { log.Errorf(format, args...) }
@@ -0,0 +1,129 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/xenolf/lego/challenge/dns01"
+	"github.com/xenolf/lego/internal/challengetest"
+)
+
+func TestNewClientWithOptions(t *testing.T) {
+	com := challengetest.NewDNSServer(t, "example.com.")
+	defer com.Close()
+	org := challengetest.NewDNSServer(t, "example.org.")
+	defer org.Close()
+
+	defer func(addr func(string) string) { nameserverAddr = addr }(nameserverAddr)
+	nameserverAddr = func(ns string) string {
+		if strings.HasSuffix(ns, ".example.org.") {
+			return org.Addr()
+		}
+		return com.Addr()
+	}
+	defer ClearFqdnCache()
+	ClearFqdnCache()
+
+	var mu sync.Mutex
+	userAgents := map[string]bool{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		userAgents[r.UserAgent()] = true
+		mu.Unlock()
+
+		writeJSONResponse(w, directory{
+			NewNonceURL:   "http://test",
+			NewAccountURL: "http://test",
+			NewOrderURL:   "http://test",
+			RevokeCertURL: "http://test",
+			KeyChangeURL:  "http://test",
+		})
+	}))
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{email: "test@test.com", regres: new(RegistrationResource), privatekey: key}
+
+	// each client resolves the names with the nameserver of its zone only.
+	comLogs, orgLogs := &challengetest.LogRecorder{}, &challengetest.LogRecorder{}
+	comClient, err := NewClientWithOptions(ts.URL, user, WithKeyType(EC256), WithDNSResolvers(com.Addr()),
+		WithUserAgent("com/1.0"), WithLogger(comLogs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orgClient, err := NewClientWithOptions(ts.URL, user, WithDNSResolvers(org.Addr()),
+		WithUserAgent("org/2.0"), WithLogger(orgLogs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if comClient.keyType != EC256 || orgClient.keyType != RSA2048 {
+		t.Errorf("Expected the key types EC256 and RSA2048, got %s and %s", comClient.keyType, orgClient.keyType)
+	}
+	for _, product := range []string{"com/1.0", "org/2.0"} {
+		if !userAgents[userAgentOf(product)] {
+			t.Errorf("Expected the directory to be requested with the product %s, got %v", product, userAgents)
+		}
+	}
+
+	for _, test := range []struct {
+		client *Client
+		server *challengetest.DNSServer
+		domain string
+		other  string
+	}{
+		{client: comClient, server: com, domain: "www.example.com", other: "www.example.org"},
+		{client: orgClient, server: org, domain: "www.example.org", other: "www.example.com"},
+	} {
+		if err := test.client.SetChallengeProvider(DNS01, test.server); err != nil {
+			t.Fatal(err)
+		}
+		solver := test.client.solvers[DNS01].(*dnsChallenge)
+
+		if err := test.server.Present(test.domain, "token", "keyAuth"); err != nil {
+			t.Fatal(err)
+		}
+		if err := solver.waitForPropagation(context.Background(), test.domain, "keyAuth"); err != nil {
+			t.Errorf("Expected the record of %s to be found by its nameserver: %v", test.domain, err)
+		}
+
+		fqdn, value := dns01.GetRecord(test.other, "keyAuth")
+		if ok, err := solver.preCheck(test.other)(fqdn, value); ok || err == nil {
+			t.Errorf("Expected %s not to be resolved by the resolvers of %s, got %t (%v)", test.other, test.domain, ok, err)
+		}
+	}
+
+	// every client logs with its own logger.
+	if !containsEntry(comLogs.Entries(), "info: [www.example.com] acme: Checking DNS record propagation using ["+com.Addr()+"]") {
+		t.Errorf("Expected the check of www.example.com in the log of its client, got %q", comLogs.Entries())
+	}
+	if !containsEntry(orgLogs.Entries(), "info: [www.example.org] acme: Checking DNS record propagation using ["+org.Addr()+"]") {
+		t.Errorf("Expected the check of www.example.org in the log of its client, got %q", orgLogs.Entries())
+	}
+	if containsEntry(orgLogs.Entries(), "info: [www.example.com]") {
+		t.Errorf("Expected no entry of the other client, got %q", orgLogs.Entries())
+	}
+
+	if _, err := NewClientWithOptions(ts.URL, user, WithDNSResolvers()); err == nil {
+		t.Error("Expected an error without resolvers")
+	}
+}
+
+// containsEntry returns true if an entry starts with prefix.
+func containsEntry(entries []string, prefix string) bool {
+	for _, entry := range entries {
+		if strings.HasPrefix(entry, prefix) {
+			return true
+		}
+	}
+	return false
+}
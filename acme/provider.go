@@ -1,6 +1,10 @@
 package acme
 
-import "time"
+import (
+	"time"
+
+	"github.com/xenolf/lego/challenge/dns01"
+)
 
 // ChallengeProvider enables implementing a custom challenge
 // provider. Present presents the solution to a challenge available to
@@ -26,3 +30,151 @@ type ChallengeProviderTimeout interface {
 	ChallengeProvider
 	Timeout() (timeout, interval time.Duration)
 }
+
+// ChallengeProviderSequential allows for implementing a ChallengeProvider
+// which can only hold one challenge record at a time, such as DNS APIs
+// storing a single TXT value per name. If an implementor of a
+// ChallengeProvider provides a Sequential method, the challenges using
+// this provider are presented, validated and cleaned up one after the
+// other instead of in parallel. The returned value is the delay to wait
+// between two challenges.
+type ChallengeProviderSequential interface {
+	ChallengeProvider
+	Sequential() time.Duration
+}
+
+// ChallengeProviderPreCheck allows for implementing a dns-01
+// ChallengeProvider with its own source of truth about the TXT record,
+// such as a DNS API telling whether a change is live. If an implementor
+// of a ChallengeProvider provides a PreCheck method, it is used instead of
+// checking the propagation to the authoritative nameservers before
+// notifying ACME that the challenge is ready.
+type ChallengeProviderPreCheck interface {
+	ChallengeProvider
+	PreCheck(domain, fqdn, value string) (bool, error)
+}
+
+// ChallengeRecord is a TXT record of a dns-01 challenge found in a zone.
+type ChallengeRecord struct {
+	// FQDN is the name of the record, starting with _acme-challenge.
+	FQDN  string
+	Value string
+	// ID identifies the record in the DNS service, if needed to delete it.
+	ID string
+	// Created is the creation time of the record, zero if the DNS service does not tell it.
+	Created time.Time
+}
+
+// ChallengeProviderLister allows for implementing a dns-01
+// ChallengeProvider able to list the challenge records of a zone,
+// and to delete them without their key authorization. It is used by
+// SweepChallengeRecords to remove the records left by the challenges
+// which were never cleaned up, e.g. after a crash.
+// ListChallengeRecords returns the TXT records whose name starts with
+// _acme-challenge in the zone of domain.
+type ChallengeProviderLister interface {
+	ChallengeProvider
+	ListChallengeRecords(domain string) ([]ChallengeRecord, error)
+	DeleteChallengeRecord(record ChallengeRecord) error
+}
+
+// ChallengeInfo describes a challenge to solve,
+// for the providers presenting it in a system outside lego.
+type ChallengeInfo struct {
+	Type Challenge
+	// Domain is the identifier of the authorization, without the "*." of a wildcard.
+	Domain  string
+	Token   string
+	KeyAuth string
+
+	// AuthorizationURL and ChallengeURL are the locations of the authorization and of the challenge at the CA.
+	AuthorizationURL string
+	ChallengeURL     string
+
+	// HTTPPath is the path where KeyAuth must be served, for the http-01 challenges.
+	HTTPPath string
+
+	// FQDN and Value are the name and the value of the TXT record to create, for the dns-01 challenges.
+	// FQDN is the effective FQDN, see dns01.ChallengeInfo.
+	FQDN  string
+	Value string
+}
+
+// ChallengeProviderInfo allows for implementing a ChallengeProvider
+// which needs the full description of the challenges, such as their type
+// and their authorization URL. If an implementor of a ChallengeProvider
+// provides PresentChallenge and CleanUpChallenge methods, they are used
+// instead of Present and CleanUp.
+type ChallengeProviderInfo interface {
+	ChallengeProvider
+	PresentChallenge(info ChallengeInfo) error
+	CleanUpChallenge(info ChallengeInfo) error
+}
+
+// CallbackProvider is a ChallengeProviderInfo handing the challenges to callbacks,
+// e.g. to push them to an external system serving the tokens.
+// CleanUpFunc is optional.
+type CallbackProvider struct {
+	PresentFunc func(info ChallengeInfo) error
+	CleanUpFunc func(info ChallengeInfo) error
+}
+
+// Present calls PresentFunc with the information available without the challenge.
+func (p *CallbackProvider) Present(domain, token, keyAuth string) error {
+	return p.PresentChallenge(ChallengeInfo{Domain: domain, Token: token, KeyAuth: keyAuth})
+}
+
+// CleanUp calls CleanUpFunc with the information available without the challenge.
+func (p *CallbackProvider) CleanUp(domain, token, keyAuth string) error {
+	return p.CleanUpChallenge(ChallengeInfo{Domain: domain, Token: token, KeyAuth: keyAuth})
+}
+
+// PresentChallenge calls PresentFunc.
+func (p *CallbackProvider) PresentChallenge(info ChallengeInfo) error {
+	return p.PresentFunc(info)
+}
+
+// CleanUpChallenge calls CleanUpFunc if set.
+func (p *CallbackProvider) CleanUpChallenge(info ChallengeInfo) error {
+	if p.CleanUpFunc == nil {
+		return nil
+	}
+	return p.CleanUpFunc(info)
+}
+
+// newChallengeInfo describes the challenge of the given domain.
+func newChallengeInfo(chlng challenge, domain, keyAuth string) ChallengeInfo {
+	info := ChallengeInfo{
+		Type:             Challenge(chlng.Type),
+		Domain:           domain,
+		Token:            chlng.Token,
+		KeyAuth:          keyAuth,
+		AuthorizationURL: chlng.authzURL,
+		ChallengeURL:     chlng.URL,
+	}
+
+	switch info.Type {
+	case HTTP01:
+		info.HTTPPath = HTTP01ChallengePath(chlng.Token)
+	case DNS01:
+		info.FQDN, info.Value = dns01.GetRecord(domain, keyAuth)
+	}
+	return info
+}
+
+// presentChallenge presents the challenge with the provider,
+// giving the full description of the challenge to a ChallengeProviderInfo.
+func presentChallenge(p ChallengeProvider, chlng challenge, domain, keyAuth string) error {
+	if provider, ok := p.(ChallengeProviderInfo); ok {
+		return provider.PresentChallenge(newChallengeInfo(chlng, domain, keyAuth))
+	}
+	return p.Present(domain, chlng.Token, keyAuth)
+}
+
+// cleanUpChallenge is like presentChallenge, but cleans up the challenge.
+func cleanUpChallenge(p ChallengeProvider, chlng challenge, domain, keyAuth string) error {
+	if provider, ok := p.(ChallengeProviderInfo); ok {
+		return provider.CleanUpChallenge(newChallengeInfo(chlng, domain, keyAuth))
+	}
+	return p.CleanUp(domain, chlng.Token, keyAuth)
+}
@@ -0,0 +1,95 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+// RenewalInfo is the renewal window suggested by the CA for a certificate,
+// with ACME Renewal Information (RFC 9773).
+type RenewalInfo struct {
+	// WindowStart and WindowEnd bound the period when the certificate should be renewed.
+	WindowStart time.Time
+	WindowEnd   time.Time
+
+	// ExplanationURL is a page of the CA explaining the window, e.g. an early renewal after an incident, if any.
+	ExplanationURL string
+
+	// RetryAfter is when the renewal information should be fetched again, zero if the CA did not say.
+	RetryAfter time.Time
+}
+
+// ShouldRenew returns true if the window suggested by the CA has started at the given time.
+func (r *RenewalInfo) ShouldRenew(now time.Time) bool {
+	return !now.Before(r.WindowStart)
+}
+
+type renewalInfoMessage struct {
+	SuggestedWindow struct {
+		Start time.Time `json:"start"`
+		End   time.Time `json:"end"`
+	} `json:"suggestedWindow"`
+	ExplanationURL string `json:"explanationURL,omitempty"`
+}
+
+// SupportsRenewalInfo returns true if the CA provides renewal information (RFC 9773).
+func (c *Client) SupportsRenewalInfo() bool {
+	return c.directory.RenewalInfoURL != ""
+}
+
+// GetRenewalInfo returns the renewal window suggested by the CA for the PEM encoded certificate or bundle.
+// It returns ErrRenewalInfoNotSupported if the CA does not support renewal information.
+func (c *Client) GetRenewalInfo(ctx context.Context, cert []byte) (*RenewalInfo, error) {
+	if !c.SupportsRenewalInfo() {
+		return nil, ErrRenewalInfoNotSupported
+	}
+
+	certificates, err := ParsePEMBundle(cert)
+	if err != nil {
+		return nil, err
+	}
+	certID, err := CertificateID(certificates[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var info renewalInfoMessage
+	hdr, err := c.sender.getJSON(ctx, strings.TrimSuffix(c.directory.RenewalInfoURL, "/")+"/"+certID, &info)
+	if err != nil {
+		return nil, err
+	}
+	if info.SuggestedWindow.Start.IsZero() || info.SuggestedWindow.End.Before(info.SuggestedWindow.Start) {
+		return nil, errors.New("acme: invalid suggested renewal window")
+	}
+
+	renewalInfo := &RenewalInfo{
+		WindowStart:    info.SuggestedWindow.Start,
+		WindowEnd:      info.SuggestedWindow.End,
+		ExplanationURL: info.ExplanationURL,
+	}
+	if ra, ok := parseRetryAfter(hdr.Get("Retry-After")); ok {
+		renewalInfo.RetryAfter = time.Now().Add(ra)
+	}
+	return renewalInfo, nil
+}
+
+// CertificateID returns the identifier of the certificate in the renewal information requests (RFC 9773),
+// and in the Replaces option of the order renewing it:
+// the authority key identifier and the serial number of the certificate, encoded in base64url.
+func CertificateID(cert *x509.Certificate) (string, error) {
+	if len(cert.AuthorityKeyId) == 0 {
+		return "", errors.New("acme: the certificate has no authority key identifier")
+	}
+
+	// the serial number is the content of its DER encoding, a positive integer.
+	serial := cert.SerialNumber.Bytes()
+	if len(serial) == 0 || serial[0]&0x80 != 0 {
+		serial = append([]byte{0}, serial...)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(cert.AuthorityKeyId) + "." + base64.RawURLEncoding.EncodeToString(serial), nil
+}
@@ -0,0 +1,108 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCertificateID(t *testing.T) {
+	// the example of RFC 9773, section 4.1.
+	cert := &x509.Certificate{
+		AuthorityKeyId: []byte{0x69, 0x88, 0x5b, 0x6b, 0x87, 0x46, 0x40, 0x41, 0xe1, 0xb3,
+			0x7b, 0x84, 0x7b, 0xa0, 0xae, 0x2c, 0xde, 0x01, 0xc8, 0xd4},
+		SerialNumber: big.NewInt(0x87654321),
+	}
+
+	certID, err := CertificateID(cert)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE"; certID != expected {
+		t.Errorf("Expected the CertificateID %s, got %s", expected, certID)
+	}
+
+	if _, err = CertificateID(&x509.Certificate{SerialNumber: big.NewInt(1)}); err == nil {
+		t.Error("Expected an error for a certificate without authority key identifier")
+	}
+}
+
+func TestGetRenewalInfo(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(0x87654321),
+		AuthorityKeyId: []byte{1, 2, 3},
+		NotBefore:      time.Now(),
+		NotAfter:       time.Now().Add(90 * 24 * time.Hour),
+		DNSNames:       []string{"example.com"},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Could not generate test certificate:", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+
+	certID := "AQID.AIdlQyE"
+
+	var supported = true
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/directory":
+			dir := directory{NewNonceURL: ts.URL + "/nonce", NewAccountURL: ts.URL + "/account", NewOrderURL: ts.URL + "/newOrder", RevokeCertURL: ts.URL + "/revokeCert"}
+			if supported {
+				dir.RenewalInfoURL = ts.URL + "/renewalInfo"
+			}
+			writeJSONResponse(w, dir)
+		case "/renewalInfo/" + certID:
+			w.Header().Set("Retry-After", "21600")
+			w.Write([]byte(`{"suggestedWindow":{"start":"2025-01-02T04:00:00Z","end":"2025-01-03T04:00:00Z"},"explanationURL":"https://example.com/incident"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	user := mockUser{email: "test@test.com", regres: &RegistrationResource{}, privatekey: key}
+	client, err := NewClient(ts.URL+"/directory", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+
+	info, err := client.GetRenewalInfo(context.Background(), certPEM)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := time.Date(2025, 1, 2, 4, 0, 0, 0, time.UTC); !info.WindowStart.Equal(expected) {
+		t.Errorf("Expected the window to start on %s, got %s", expected, info.WindowStart)
+	}
+	if info.ExplanationURL != "https://example.com/incident" {
+		t.Errorf("Unexpected explanation URL %s", info.ExplanationURL)
+	}
+	if info.RetryAfter.IsZero() {
+		t.Error("Expected the Retry-After to be parsed")
+	}
+	if !info.ShouldRenew(info.WindowStart) || info.ShouldRenew(info.WindowStart.Add(-time.Second)) {
+		t.Error("Expected a renewal from the start of the window")
+	}
+
+	supported = false
+	client, err = NewClient(ts.URL+"/directory", user, RSA2048)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+	if _, err = client.GetRenewalInfo(context.Background(), nil); err != ErrRenewalInfoNotSupported {
+		t.Errorf("Expected ErrRenewalInfoNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package acme
+
+import (
+	"syscall"
+)
+
+// reuseAddr sets SO_REUSEADDR on the socket of a listener.
+func reuseAddr(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
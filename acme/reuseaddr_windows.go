@@ -0,0 +1,11 @@
+package acme
+
+import (
+	"syscall"
+)
+
+// reuseAddr does not set SO_REUSEADDR on Windows,
+// where it allows another process to bind the port in use.
+func reuseAddr(network, address string, c syscall.RawConn) error {
+	return nil
+}
@@ -1,14 +1,13 @@
 package acme
 
 import (
+	"context"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"fmt"
-
-	"github.com/xenolf/lego/log"
 )
 
 // idPeAcmeIdentifierV1 is the SMI Security for PKIX Certification Extension OID referencing the ACME extension.
@@ -22,8 +21,8 @@ type tlsALPNChallenge struct {
 }
 
 // Solve manages the provider to validate and solve the challenge.
-func (t *tlsALPNChallenge) Solve(chlng challenge, domain string) error {
-	log.Infof("[%s] acme: Trying to solve TLS-ALPN-01", domain)
+func (t *tlsALPNChallenge) Solve(ctx context.Context, chlng challenge, domain string) error {
+	t.jws.logger().Infof("[%s] acme: Trying to solve TLS-ALPN-01", domain)
 
 	// Generate the Key Authorization for the challenge
 	keyAuth, err := getKeyAuthorization(chlng.Token, t.jws.privKey)
@@ -31,18 +30,25 @@ func (t *tlsALPNChallenge) Solve(chlng challenge, domain string) error {
 		return err
 	}
 
-	err = t.provider.Present(domain, chlng.Token, keyAuth)
+	record := challengeRecordFrom(ctx)
+	start := record.start()
+	err = presentChallenge(t.provider, chlng, domain, keyAuth)
+	record.end(phasePresent, start)
 	if err != nil {
 		return fmt.Errorf("[%s] error presenting token: %v", domain, err)
 	}
+	record.presented()
 	defer func() {
-		err := t.provider.CleanUp(domain, chlng.Token, keyAuth)
+		err := cleanUpChallenge(t.provider, chlng, domain, keyAuth)
 		if err != nil {
-			log.Warnf("[%s] error cleaning up: %v", domain, err)
+			t.jws.logger().Warnf("[%s] acme: Error cleaning up: %v", domain, err)
 		}
 	}()
 
-	return t.validate(t.jws, domain, chlng.URL, challenge{Type: chlng.Type, Token: chlng.Token, KeyAuthorization: keyAuth})
+	start = record.start()
+	defer record.end(phaseValidation, start)
+
+	return t.validate(ctx, t.jws, domain, chlng.URL, challenge{Type: chlng.Type, Token: chlng.Token, KeyAuthorization: keyAuth})
 }
 
 // TLSALPNChallengeBlocks returns PEM blocks (certPEMBlock, keyPEMBlock) with the acmeValidation-v1 extension
@@ -68,7 +74,7 @@ func TLSALPNChallengeBlocks(domain, keyAuth string) ([]byte, []byte, error) {
 	}
 
 	// Generate a new RSA key for the certificates.
-	tempPrivKey, err := generatePrivateKey(RSA2048)
+	tempPrivKey, err := GeneratePrivateKey(RSA2048)
 	if err != nil {
 		return nil, nil, err
 	}
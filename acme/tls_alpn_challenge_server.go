@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -19,10 +22,20 @@ const (
 // TLSALPNProviderServer implements ChallengeProvider for `TLS-ALPN-01`
 // challenge. It may be instantiated without using the NewTLSALPNProviderServer
 // if you want only to use the default values.
+// The challenges of several domains may be presented concurrently: they share a single server,
+// which selects the challenge certificate with the SNI of the connection,
+// and is kept for a few seconds once no challenge is presented, for the next challenges of the run.
 type TLSALPNProviderServer struct {
-	iface    string
-	port     string
-	listener net.Listener
+	iface string
+	port  string
+
+	// mu protects the server and the certificates.
+	mu     sync.Mutex
+	server *challengeServer
+	// idleGeneration identifies the last closing of the server once idle, cancelled by a new challenge.
+	idleGeneration int
+	// certs are the challenge certificates, by domain.
+	certs map[string]*tls.Certificate
 }
 
 // NewTLSALPNProviderServer creates a new TLSALPNProviderServer on the selected
@@ -36,6 +49,9 @@ func NewTLSALPNProviderServer(iface, port string) *TLSALPNProviderServer {
 // as the acmeValidation-v1 extension value to conform to the ACME-TLS-ALPN
 // spec.
 func (t *TLSALPNProviderServer) Present(domain, token, keyAuth string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	if t.port == "" {
 		// Fallback to port 443 if the port was not provided.
 		t.port = defaultTLSPort
@@ -47,10 +63,22 @@ func (t *TLSALPNProviderServer) Present(domain, token, keyAuth string) error {
 		return err
 	}
 
-	// Place the generated certificate with the extension into the TLS config
+	if t.certs == nil {
+		t.certs = make(map[string]*tls.Certificate)
+	}
+	t.certs[strings.ToLower(domain)] = cert
+
+	// the server waiting for its closing is kept.
+	t.idleGeneration++
+
+	if t.server != nil {
+		return nil
+	}
+
+	// The certificate with the extension is selected by the TLS config
 	// so that it can serve the correct details.
 	tlsConf := new(tls.Config)
-	tlsConf.Certificates = []tls.Certificate{*cert}
+	tlsConf.GetCertificate = t.getCertificate
 
 	// We must set that the `acme-tls/1` application level protocol is supported
 	// so that the protocol negotiation can succeed. Reference:
@@ -58,29 +86,64 @@ func (t *TLSALPNProviderServer) Present(domain, token, keyAuth string) error {
 	tlsConf.NextProtos = []string{ACMETLS1Protocol}
 
 	// Create the listener with the created tls.Config.
-	t.listener, err = tls.Listen("tcp", net.JoinHostPort(t.iface, t.port), tlsConf)
+	listener, err := listenTCP(net.JoinHostPort(t.iface, t.port))
 	if err != nil {
+		delete(t.certs, strings.ToLower(domain))
 		return fmt.Errorf("could not start HTTPS server for challenge -> %v", err)
 	}
 
-	// Shut the server down when we're finished.
-	go func() {
-		http.Serve(t.listener, nil)
-	}()
+	t.server = startChallengeServer(tls.NewListener(listener, tlsConf), http.NotFoundHandler())
 
 	return nil
 }
 
-// CleanUp closes the HTTPS server.
+// getCertificate returns the challenge certificate of the domain requested by the client.
+// If a single challenge is presented, its certificate is returned whatever the SNI,
+// e.g. to the clients validating an IP address.
+func (t *TLSALPNProviderServer) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if cert, ok := t.certs[strings.ToLower(hello.ServerName)]; ok {
+		return cert, nil
+	}
+	if len(t.certs) == 1 {
+		for _, cert := range t.certs {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("no challenge certificate for %q", hello.ServerName)
+}
+
+// CleanUp removes the challenge certificate of the domain.
+// Once no challenge is presented anymore, the HTTPS server is closed after a few seconds without new challenge.
 func (t *TLSALPNProviderServer) CleanUp(domain, token, keyAuth string) error {
-	if t.listener == nil {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.certs, strings.ToLower(domain))
+
+	if t.server == nil || len(t.certs) > 0 {
 		return nil
 	}
 
-	// Server was created, close it.
-	if err := t.listener.Close(); err != nil && err != http.ErrServerClosed {
-		return err
-	}
+	t.idleGeneration++
+	generation := t.idleGeneration
+	time.AfterFunc(challengeServerIdleTimeout, func() { t.closeIdle(generation) })
 
 	return nil
 }
+
+// closeIdle closes the server, unless a challenge was presented since the given idle generation.
+func (t *TLSALPNProviderServer) closeIdle(generation int) {
+	t.mu.Lock()
+	if t.server == nil || t.idleGeneration != generation {
+		t.mu.Unlock()
+		return
+	}
+	server := t.server
+	t.server = nil
+	t.mu.Unlock()
+
+	server.shutdown()
+}
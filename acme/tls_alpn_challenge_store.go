@@ -0,0 +1,100 @@
+package acme
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// TLSALPNProviderStore implements ChallengeProvider for `TLS-ALPN-01` challenge
+// without listening: it keeps the challenge certificates in memory for the GetCertificate callback
+// of a TLS server already listening on the port 443, which must add ACMETLS1Protocol to its NextProtos.
+// Present generates the certificate of the domain, CleanUp removes it.
+// The challenges of several domains may be presented concurrently.
+type TLSALPNProviderStore struct {
+	mu sync.RWMutex
+	// certs are the challenge certificates, by the server name matching their domain.
+	certs map[string]*tls.Certificate
+}
+
+// NewTLSALPNProviderStore creates a new empty TLSALPNProviderStore.
+func NewTLSALPNProviderStore() *TLSALPNProviderStore {
+	return &TLSALPNProviderStore{certs: make(map[string]*tls.Certificate)}
+}
+
+// Present generates the challenge certificate of the domain with TLSALPNChallengeCert and stores it.
+func (s *TLSALPNProviderStore) Present(domain, token, keyAuth string) error {
+	cert, err := TLSALPNChallengeCert(domain, keyAuth)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.certs[tlsALPNServerName(domain)] = cert
+	return nil
+}
+
+// CleanUp removes the challenge certificate of the domain.
+func (s *TLSALPNProviderStore) CleanUp(domain, token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.certs, tlsALPNServerName(domain))
+	return nil
+}
+
+// GetCertificate returns the challenge certificate for the connection of the CA, and false for the other connections,
+// which are to be answered with the usual certificate of the server.
+// The rules are:
+//   - the client must offer the ACMETLS1Protocol ("acme-tls/1") ALPN protocol, which only the CAs validating a challenge do;
+//   - the SNI must be the domain of a presented challenge, compared case-insensitively,
+//     or the reverse DNS name of an IP address (e.g. 4.3.2.1.in-addr.arpa), as in RFC 8738;
+//   - without SNI, the certificate is returned only if a single challenge is presented.
+//
+// A proxy in front of the server must pass both the ALPN extension and the SNI unchanged.
+func (s *TLSALPNProviderStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, bool) {
+	if !offersACMETLS1(hello) {
+		return nil, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if hello.ServerName == "" {
+		if len(s.certs) == 1 {
+			for _, cert := range s.certs {
+				return cert, true
+			}
+		}
+		return nil, false
+	}
+
+	cert, ok := s.certs[tlsALPNServerName(hello.ServerName)]
+	return cert, ok
+}
+
+// offersACMETLS1 returns true if the client offers the ACMETLS1Protocol ALPN protocol.
+func offersACMETLS1(hello *tls.ClientHelloInfo) bool {
+	for _, proto := range hello.SupportedProtos {
+		if proto == ACMETLS1Protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsALPNServerName returns the SNI of the challenge of the domain:
+// the domain in lower case, or the reverse DNS name of an IP address.
+func tlsALPNServerName(domain string) string {
+	if net.ParseIP(domain) != nil {
+		if arpa, err := dns.ReverseAddr(domain); err == nil {
+			domain = arpa
+		}
+	}
+	return strings.TrimSuffix(strings.ToLower(domain), ".")
+}
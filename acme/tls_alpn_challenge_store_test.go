@@ -0,0 +1,128 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+func TestTLSALPNProviderStore(t *testing.T) {
+	store := NewTLSALPNProviderStore()
+	if err := store.Present("Example.com", "", "keyAuth"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Present("192.0.2.1", "", "keyAuth"); err != nil {
+		t.Fatal(err)
+	}
+
+	acmeProtos := []string{"h2", ACMETLS1Protocol}
+	tests := []struct {
+		desc       string
+		serverName string
+		protos     []string
+		found      bool
+	}{
+		{desc: "domain", serverName: "example.COM", protos: acmeProtos, found: true},
+		{desc: "IP address", serverName: "1.2.0.192.in-addr.arpa", protos: acmeProtos, found: true},
+		{desc: "without ALPN", serverName: "example.com", protos: []string{"h2", "http/1.1"}},
+		{desc: "other domain", serverName: "www.example.com", protos: acmeProtos},
+		{desc: "without SNI, several challenges", protos: acmeProtos},
+	}
+	for _, test := range tests {
+		_, found := store.GetCertificate(&tls.ClientHelloInfo{ServerName: test.serverName, SupportedProtos: test.protos})
+		if found != test.found {
+			t.Errorf("%s: expected the certificate to be found: %t, got %t", test.desc, test.found, found)
+		}
+	}
+
+	if err := store.CleanUp("192.0.2.1", "", "keyAuth"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := store.GetCertificate(&tls.ClientHelloInfo{SupportedProtos: acmeProtos}); !found {
+		t.Error("Expected the certificate of the single challenge without SNI")
+	}
+
+	if err := store.CleanUp("example.com", "", "keyAuth"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com", SupportedProtos: acmeProtos}); found {
+		t.Error("Expected the certificate to be removed")
+	}
+}
+
+func TestClientTLSChallengeCert(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 512)
+	j := &jws{privKey: privKey}
+	client := &Client{jws: j, solvers: map[Challenge]solver{TLSALPN01: &tlsALPNChallenge{jws: j, provider: &TLSALPNProviderServer{}}}}
+
+	hello := &tls.ClientHelloInfo{ServerName: "example.com", SupportedProtos: []string{ACMETLS1Protocol}}
+	if _, found := client.TLSChallengeCert(hello); found {
+		t.Error("Expected no certificate with the default TLS-ALPN provider")
+	}
+
+	client.SetTLSChallengeStore()
+
+	// the server of the caller answers the CA with the challenge certificate.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	fallback, err := TLSALPNChallengeCert("fallback.example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsListener := tls.NewListener(listener, &tls.Config{
+		NextProtos: []string{"h2", ACMETLS1Protocol},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if cert, ok := client.TLSChallengeCert(hello); ok {
+				return cert, nil
+			}
+			return fallback, nil
+		},
+	})
+	go func() {
+		for {
+			conn, err := tlsListener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	dialName := func(protos []string) string {
+		conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+			ServerName:         "example.com",
+			NextProtos:         protos,
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].DNSNames[0]
+	}
+
+	client.solvers[TLSALPN01].(*tlsALPNChallenge).validate = func(_ context.Context, _ *jws, _, _ string, _ challenge) error {
+		if name := dialName([]string{ACMETLS1Protocol}); name != "example.com" {
+			t.Errorf("Expected the challenge certificate for the CA, got %s", name)
+		}
+		if name := dialName([]string{"h2"}); name != "fallback.example.com" {
+			t.Errorf("Expected the usual certificate for the other clients, got %s", name)
+		}
+		return nil
+	}
+	if err := client.solvers[TLSALPN01].Solve(context.Background(), challenge{Type: string(TLSALPN01), Token: "tlsalpn2"}, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found := client.TLSChallengeCert(hello); found {
+		t.Error("Expected the certificate to be removed after the challenge")
+	}
+}
@@ -1,6 +1,7 @@
 package acme
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -12,11 +13,11 @@ import (
 )
 
 func TestTLSALPNChallenge(t *testing.T) {
-	domain := "localhost:23457"
+	domain := "localhost:23464"
 	privKey, _ := rsa.GenerateKey(rand.Reader, 512)
 	j := &jws{privKey: privKey}
 	clientChallenge := challenge{Type: string(TLSALPN01), Token: "tlsalpn1"}
-	mockValidate := func(_ *jws, _, _ string, chlng challenge) error {
+	mockValidate := func(_ context.Context, _ *jws, _, _ string, chlng challenge) error {
 		conn, err := tls.Dial("tcp", domain, &tls.Config{
 			InsecureSkipVerify: true,
 		})
@@ -72,8 +73,8 @@ func TestTLSALPNChallenge(t *testing.T) {
 
 		return nil
 	}
-	solver := &tlsALPNChallenge{jws: j, validate: mockValidate, provider: &TLSALPNProviderServer{port: "23457"}}
-	if err := solver.Solve(clientChallenge, domain); err != nil {
+	solver := &tlsALPNChallenge{jws: j, validate: mockValidate, provider: &TLSALPNProviderServer{port: "23464"}}
+	if err := solver.Solve(context.Background(), clientChallenge, domain); err != nil {
 		t.Errorf("Solve error: got %v, want nil", err)
 	}
 }
@@ -84,9 +85,51 @@ func TestTLSALPNChallengeInvalidPort(t *testing.T) {
 	clientChallenge := challenge{Type: string(TLSALPN01), Token: "tlsalpn1"}
 	solver := &tlsALPNChallenge{jws: j, validate: stubValidate, provider: &TLSALPNProviderServer{port: "123456"}}
 
-	if err := solver.Solve(clientChallenge, "localhost:123456"); err == nil {
+	if err := solver.Solve(context.Background(), clientChallenge, "localhost:123456"); err == nil {
 		t.Errorf("Solve error: got %v, want error", err)
 	} else if want, want18 := "invalid port 123456", "123456: invalid port"; !strings.HasSuffix(err.Error(), want) && !strings.HasSuffix(err.Error(), want18) {
 		t.Errorf("Solve error: got %q, want suffix %q", err.Error(), want)
 	}
 }
+
+func TestTLSALPNProviderServerConcurrentChallenges(t *testing.T) {
+	provider := NewTLSALPNProviderServer("127.0.0.1", "23460")
+
+	domains := []string{"a.example.com", "b.example.com"}
+	for _, domain := range domains {
+		if err := provider.Present(domain, "token", "keyauth-"+domain); err != nil {
+			t.Fatalf("Present error: %v", err)
+		}
+	}
+
+	for _, domain := range domains {
+		conn, err := tls.Dial("tcp", "127.0.0.1:23460", &tls.Config{
+			InsecureSkipVerify: true,
+			ServerName:         domain,
+			NextProtos:         []string{ACMETLS1Protocol},
+		})
+		if err != nil {
+			t.Fatalf("Expected to connect to challenge server without an error. %v", err)
+		}
+		names := conn.ConnectionState().PeerCertificates[0].DNSNames
+		conn.Close()
+
+		if len(names) != 1 || names[0] != domain {
+			t.Errorf("Expected the challenge certificate of %s, got %v", domain, names)
+		}
+	}
+
+	for _, domain := range domains {
+		if err := provider.CleanUp(domain, "token", "keyauth-"+domain); err != nil {
+			t.Fatalf("CleanUp error: %v", err)
+		}
+	}
+	// the server is kept for the next challenges, then closed once idle.
+	if provider.server == nil {
+		t.Fatal("Expected the server to be kept for the next challenges")
+	}
+	provider.closeIdle(provider.idleGeneration)
+	if provider.server != nil {
+		t.Error("Expected the server to be closed once idle")
+	}
+}
@@ -1,29 +1,54 @@
 package acme
 
 import (
-	"fmt"
+	"context"
+	"net/http"
 	"time"
+
+	"github.com/xenolf/lego/platform/wait"
+)
+
+const (
+	// pollingInitialInterval is the first delay between the polls of an order or a challenge.
+	pollingInitialInterval = 250 * time.Millisecond
+
+	// pollingMaxInterval is the maximum delay between the polls if the server does not send a Retry-After.
+	pollingMaxInterval = 10 * time.Second
 )
 
 // WaitFor polls the given function 'f', once every 'interval', up to 'timeout'.
+// It is wait.For without context.
 func WaitFor(timeout, interval time.Duration, f func() (bool, error)) error {
-	var lastErr string
-	timeup := time.After(timeout)
-	for {
-		select {
-		case <-timeup:
-			return fmt.Errorf("Time limit exceeded. Last error: %s", lastErr)
-		default:
-		}
-
-		stop, err := f()
-		if stop {
-			return nil
-		}
-		if err != nil {
-			lastErr = err.Error()
-		}
-
-		time.Sleep(interval)
+	return WaitForWithContext(context.Background(), timeout, interval, f)
+}
+
+// WaitForWithContext polls the given function 'f', once every 'interval', up to 'timeout'.
+// It stops polling when the context is done. It is wait.For without option.
+func WaitForWithContext(ctx context.Context, timeout, interval time.Duration, f func() (bool, error)) error {
+	return wait.For(ctx, timeout, interval, f)
+}
+
+// backoff computes the delays between the polls of an order or a challenge status:
+// the delay grows exponentially from pollingInitialInterval, with full jitter
+// so that concurrent pollers do not hit the server at the same time.
+type backoff struct {
+	delays wait.Backoff
+	// polls is the number of delays returned so far.
+	polls int
+}
+
+// next returns the delay before the next poll.
+// The delay is capped by the Retry-After header of the last response if present,
+// by pollingMaxInterval otherwise.
+func (b *backoff) next(hdr http.Header) time.Duration {
+	ceiling := pollingMaxInterval
+	if ra, ok := parseRetryAfter(hdr.Get("Retry-After")); ok {
+		ceiling = ra
+	}
+
+	if b.polls == 0 {
+		b.delays = wait.Backoff{Initial: pollingInitialInterval, Max: pollingMaxInterval, Jitter: 1}
 	}
+	b.polls++
+	return b.delays.NextWithin(ceiling)
 }
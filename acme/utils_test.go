@@ -1,6 +1,9 @@
 package acme
 
 import (
+	"context"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 )
@@ -24,3 +27,66 @@ func TestWaitForTimeout(t *testing.T) {
 		}
 	}
 }
+
+func TestWaitForWithContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := make(chan error)
+	go func() {
+		err := WaitForWithContext(ctx, time.Minute, 10*time.Second, func() (bool, error) {
+			return false, nil
+		})
+		c <- err
+	}()
+
+	cancel()
+
+	select {
+	case <-time.After(time.Second):
+		t.Fatal("polling was not canceled")
+	case err := <-c:
+		if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+			t.Errorf("expected cancellation error; got %v", err)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		retryAfter string
+		maxDelays  []time.Duration
+	}{
+		{
+			desc:      "exponential",
+			maxDelays: []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second},
+		},
+		{
+			desc:       "capped by Retry-After",
+			retryAfter: "1",
+			maxDelays:  []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, time.Second, time.Second},
+		},
+		{
+			desc:       "Retry-After of zero",
+			retryAfter: "0",
+			maxDelays:  []time.Duration{0, 0},
+		},
+	}
+
+	for _, test := range testCases {
+		hdr := http.Header{}
+		if test.retryAfter != "" {
+			hdr.Set("Retry-After", test.retryAfter)
+		}
+
+		var b backoff
+		for i, maxDelay := range test.maxDelays {
+			if delay := b.next(hdr); delay < 0 || delay > maxDelay {
+				t.Errorf("%s: expected the delay of poll %d to be between 0 and %s, got %s", test.desc, i+1, maxDelay, delay)
+			}
+		}
+		if b.polls != len(test.maxDelays) {
+			t.Errorf("%s: expected %d polls, got %d", test.desc, len(test.maxDelays), b.polls)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/log"
+)
+
+// batchFailure is a certificate of the batch which could not be obtained or renewed.
+type batchFailure struct {
+	domain  string
+	err     error
+	errType string
+}
+
+// readBatch returns the certificates of --domains-file, nil if it is not set.
+func readBatch(c *cli.Context) [][]string {
+	filename := c.GlobalString("domains-file")
+	if filename == "" {
+		return nil
+	}
+
+	switch {
+	case len(c.GlobalStringSlice("domains")) > 0 || c.GlobalString("csr") != "":
+		fatalf(errorTypeUsage, "Please specify either --domains-file or --domains/-d and --csr/-c, but not both")
+	case c.GlobalString("filename") != "":
+		fatalf(errorTypeUsage, "The --filename switch cannot be used with --domains-file: every certificate is stored under its first domain")
+	case c.GlobalInt("concurrency") < 1:
+		fatalf(errorTypeUsage, "The --concurrency must be at least 1.")
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		fatalf(errorTypeUsage, "Could not read the domains file: %v", err)
+	}
+	defer file.Close()
+
+	certificates, err := parseDomainsFile(file)
+	if err != nil {
+		fatalf(errorTypeUsage, "Could not read the domains file %s: %v", filename, err)
+	}
+
+	var domains []string
+	for _, certificate := range certificates {
+		domains = append(domains, certificate...)
+	}
+	if err = NewConfiguration(c).CheckDNSMapping(domains); err != nil {
+		fatalf(errorTypeUsage, "%v", err)
+	}
+
+	return certificates
+}
+
+// parseDomainsFile parses the certificates of a domains file:
+// one certificate per line, with its domains separated by whitespace, the first one being the common name.
+// The text following a # is a comment.
+func parseDomainsFile(r io.Reader) ([][]string, error) {
+	var certificates [][]string
+	// lines are the lines defining the certificates, by stored name.
+	lines := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		domains := strings.Fields(line)
+		if len(domains) == 0 {
+			continue
+		}
+
+		name := sanitizedDomain(domains[0])
+		if previous, ok := lines[name]; ok {
+			return nil, fmt.Errorf("line %d: the certificate of %s is already defined on line %d", lineNumber, domains[0], previous)
+		}
+		lines[name] = lineNumber
+
+		certificates = append(certificates, domains)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("no certificate defined")
+	}
+	return certificates, nil
+}
+
+// runBatch obtains or renews the certificates with process, with at most --concurrency certificates at once.
+// process returns a nil certificate if the certificate is up to date.
+// A failing certificate, or its failing hook, does not stop the batch:
+// the failures are logged once all the certificates were processed, and lego exits with an error.
+func runBatch(c *cli.Context, conf *Configuration, acc *Account, hookFlag string, certificates [][]string,
+	process func(ctx context.Context, domains []string) (*acme.CertificateResource, error)) {
+	if err := conf.CertStorage().Check(); err != nil {
+		fatalf(errorTypeStorage, "Could not use the certificate storage: %v", err)
+	}
+
+	tosAgreedURL := acc.Registration.TOSAgreedURL
+
+	var (
+		mu       sync.Mutex
+		saved    int
+		skipped  int
+		failures []batchFailure
+	)
+	failed := func(ctx context.Context, domain string, err error) {
+		log.Errorf("[%s] %v", domain, err)
+		mu.Lock()
+		failures = append(failures, batchFailure{domain: domain, err: err, errType: errorType(ctx, err)})
+		mu.Unlock()
+	}
+
+	queue := make(chan []string)
+	var wg sync.WaitGroup
+	for i := 0; i < c.GlobalInt("concurrency"); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for domains := range queue {
+				ctx, cancel := conf.CertContext(context.Background())
+				cert, err := process(ctx, domains)
+				if err != nil {
+					reportError(ctx, domains[0], err)
+					failed(ctx, domains[0], err)
+					cancel()
+					continue
+				}
+				cancel()
+
+				if cert == nil {
+					name := storedCertName(conf, domains[0])
+					reportSkipped(conf, name, domains[0])
+					if err := refreshStoredOCSPFlag(c, conf, name, domains[0]); err != nil {
+						reportError(context.Background(), domains[0], err)
+						failed(context.Background(), domains[0], err)
+						continue
+					}
+					mu.Lock()
+					skipped++
+					mu.Unlock()
+					continue
+				}
+
+				if err := saveCertRes(cert, conf); err != nil {
+					reportError(context.Background(), domains[0], err)
+					failed(context.Background(), domains[0], err)
+					continue
+				}
+				revokedErr := refreshOCSPFlag(c, conf, cert, true)
+				if c.String(hookFlag) != "" {
+					timeout := time.Duration(c.Int("hook-timeout")) * time.Second
+					if err := runHook(c.String(hookFlag), timeout, cert, conf); err != nil {
+						reportError(context.Background(), domains[0], err)
+						failed(context.Background(), domains[0], err)
+						continue
+					}
+				}
+
+				reportCertificate(domainResult{Domain: domains[0]}, cert, conf)
+				if revokedErr != nil {
+					reportError(context.Background(), domains[0], revokedErr)
+					failed(context.Background(), domains[0], revokedErr)
+					continue
+				}
+				mu.Lock()
+				saved++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, domains := range certificates {
+		queue <- domains
+	}
+	close(queue)
+	wg.Wait()
+
+	saveTOSAgreement(acc, tosAgreedURL)
+
+	log.Printf("%d certificates: %d saved, %d up to date, %d failed", len(certificates), saved, skipped, len(failures))
+	if len(failures) == 0 {
+		writeReport()
+		return
+	}
+
+	for _, failure := range failures {
+		log.Printf("[%s] Failed: %v", failure.domain, failure.err)
+	}
+	exit(batchExitCode(failures))
+}
+
+// batchExitCode returns the exit code of the failures of a batch:
+// the one of their error type if they all have the same, exitCodeFailure otherwise.
+func batchExitCode(failures []batchFailure) int {
+	for _, failure := range failures {
+		if failure.errType != failures[0].errType {
+			return exitCodeFailure
+		}
+	}
+	return exitCode(failures[0].errType)
+}
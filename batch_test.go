@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDomainsFile(t *testing.T) {
+	content := `# the certificates of the web servers
+example.com www.example.com
+	example.org   www.example.org	mail.example.org  # with the mail server
+
+*.example.net # wildcard
+`
+
+	certificates, err := parseDomainsFile(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := [][]string{
+		{"example.com", "www.example.com"},
+		{"example.org", "www.example.org", "mail.example.org"},
+		{"*.example.net"},
+	}
+	if !reflect.DeepEqual(certificates, expected) {
+		t.Errorf("Expected %v, got %v", expected, certificates)
+	}
+}
+
+func TestParseDomainsFileErrors(t *testing.T) {
+	testCases := map[string]string{
+		"empty":     "# nothing\n\n",
+		"duplicate": "example.com www.example.com\nexample.com\n",
+	}
+
+	for desc, content := range testCases {
+		t.Run(desc, func(t *testing.T) {
+			if _, err := parseDomainsFile(strings.NewReader(content)); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CertStorage stores the files of the certificates.
+// A file is given by the name of its certificate and by its extension in the default layout, e.g. certExt.
+type CertStorage interface {
+	// Check returns an error if the storage cannot be used, before any certificate is obtained.
+	Check() error
+	SaveResource(name, ext string, data []byte) error
+	// LoadResource returns an error satisfying os.IsNotExist if the file does not exist.
+	LoadResource(name, ext string) ([]byte, error)
+	DeleteResource(name, ext string) error
+	Exists(name, ext string) (bool, error)
+	// ListResources returns the sorted names of the stored certificates.
+	ListResources() ([]string, error)
+	// Location returns where the file is stored, e.g. its path, for the hooks and the reports.
+	Location(name, ext string) string
+}
+
+// newCertStorage returns the storage of --storage:
+// the files of certPath if empty, the files of a directory with file://<dir>, or an S3 bucket with s3://<bucket>/<prefix>.
+// An invalid value is a usageError.
+func newCertStorage(storage, certPath string, certbotLayout bool) (CertStorage, error) {
+	if storage == "" {
+		return newFileCertStorage(certPath, certbotLayout), nil
+	}
+
+	u, err := url.Parse(storage)
+	if err != nil {
+		return nil, usageError{err}
+	}
+
+	switch u.Scheme {
+	case "file":
+		dir := filepath.FromSlash(u.Host + u.Path)
+		if dir == "" {
+			return nil, usageError{fmt.Errorf("the directory is missing in %s", storage)}
+		}
+		return newFileCertStorage(dir, certbotLayout), nil
+	case "s3":
+		return newS3CertStorage(u, certbotLayout)
+	}
+	return nil, usageError{fmt.Errorf("unsupported storage %q, expected file://<dir> or s3://<bucket>/<prefix>", storage)}
+}
+
+// certResourcePath returns the slash-separated path of a file of the certificate, relative to the root of the storage.
+// An extension suffixed in the default layout, e.g. .crt.revoked, suffixes the file name in the Certbot layout.
+func certResourcePath(certbotLayout bool, name, ext string) string {
+	if !certbotLayout {
+		return name + ext
+	}
+
+	file, ok := certbotFileNames[ext]
+	if !ok {
+		var base string
+		for known, knownFile := range certbotFileNames {
+			if strings.HasPrefix(ext, known) && len(known) > len(base) {
+				base = known
+				file = knownFile + strings.TrimPrefix(ext, known)
+			}
+		}
+	}
+	return path.Join(name, file)
+}
+
+// certResourceName returns the name of the certificate of the file at the slash-separated path
+// relative to the root of the storage, false if it is not the certificate file of certExt.
+func certResourceName(certbotLayout bool, file string) (string, bool) {
+	if certbotLayout {
+		dir, base := path.Split(file)
+		name := strings.TrimSuffix(dir, "/")
+		if name == "" || strings.Contains(name, "/") || base != certbotFileNames[certExt] {
+			return "", false
+		}
+		return name, true
+	}
+
+	if strings.Contains(file, "/") || !strings.HasSuffix(file, certExt) ||
+		strings.HasSuffix(file, issuerExt) || strings.HasSuffix(file, leafExt) {
+		return "", false
+	}
+	return strings.TrimSuffix(file, certExt), true
+}
+
+// fileCertStorage stores the certificates in the files of a directory.
+type fileCertStorage struct {
+	path          string
+	certbotLayout bool
+}
+
+func newFileCertStorage(path string, certbotLayout bool) *fileCertStorage {
+	return &fileCertStorage{path: path, certbotLayout: certbotLayout}
+}
+
+func (s *fileCertStorage) Check() error {
+	return checkFolder(s.path)
+}
+
+// SaveResource replaces the file atomically, servers reloading it never read a partial key or chain.
+func (s *fileCertStorage) SaveResource(name, ext string, data []byte) error {
+	file := s.Location(name, ext)
+	if err := checkFolder(filepath.Dir(file)); err != nil {
+		return err
+	}
+	return writeFileAtomic(file, data, 0600)
+}
+
+func (s *fileCertStorage) LoadResource(name, ext string) ([]byte, error) {
+	return ioutil.ReadFile(s.Location(name, ext))
+}
+
+func (s *fileCertStorage) DeleteResource(name, ext string) error {
+	return os.Remove(s.Location(name, ext))
+}
+
+func (s *fileCertStorage) Exists(name, ext string) (bool, error) {
+	_, err := os.Stat(s.Location(name, ext))
+	switch {
+	case err == nil:
+		return true, nil
+	case os.IsNotExist(err):
+		return false, nil
+	}
+	return false, err
+}
+
+func (s *fileCertStorage) ListResources() ([]string, error) {
+	files, err := filepath.Glob(s.Location("*", certExt))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, file := range files {
+		rel, err := filepath.Rel(s.path, file)
+		if err != nil {
+			return nil, err
+		}
+		if name, ok := certResourceName(s.certbotLayout, filepath.ToSlash(rel)); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *fileCertStorage) Location(name, ext string) string {
+	return certFilePath(s.path, s.certbotLayout, name, ext)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xenolf/lego/platform/s3client"
+)
+
+// s3CertStorage stores the certificates in the objects of an S3 bucket, under a prefix.
+// The objects are named like the files of the file storage, relative to the prefix.
+type s3CertStorage struct {
+	bucket        string
+	prefix        string
+	certbotLayout bool
+	client        *s3client.Client
+}
+
+// newS3CertStorage returns the storage of --storage s3://<bucket>/<prefix>.
+// The query parameters region, endpoint and path-style configure the S3 API,
+// overriding S3_REGION, S3_ENDPOINT and S3_PATH_STYLE like in the s3 HTTP provider.
+// The credentials are the ones of the standard AWS chain.
+func newS3CertStorage(u *url.URL, certbotLayout bool) (*s3CertStorage, error) {
+	if u.Host == "" {
+		return nil, usageError{fmt.Errorf("the bucket is missing in %s", u)}
+	}
+
+	query := u.Query()
+	client, err := s3client.New(s3client.Config{
+		Bucket:     u.Host,
+		Region:     firstNonEmpty(query.Get("region"), os.Getenv("S3_REGION"), os.Getenv("AWS_REGION")),
+		Endpoint:   firstNonEmpty(query.Get("endpoint"), os.Getenv("S3_ENDPOINT")),
+		PathStyle:  firstNonEmpty(query.Get("path-style"), os.Getenv("S3_PATH_STYLE")) == "true",
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	})
+	if err == s3client.ErrMissingRegion {
+		return nil, usageError{err}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3CertStorage{
+		bucket:        u.Host,
+		prefix:        strings.Trim(u.Path, "/"),
+		certbotLayout: certbotLayout,
+		client:        client,
+	}, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Check checks that the bucket can be read with the credentials.
+func (s *s3CertStorage) Check() error {
+	_, err := s.do(http.MethodHead, "", nil, nil)
+	return err
+}
+
+func (s *s3CertStorage) SaveResource(name, ext string, data []byte) error {
+	_, err := s.do(http.MethodPut, s.key(name, ext), nil, data)
+	return err
+}
+
+func (s *s3CertStorage) LoadResource(name, ext string) ([]byte, error) {
+	return s.do(http.MethodGet, s.key(name, ext), nil, nil)
+}
+
+func (s *s3CertStorage) DeleteResource(name, ext string) error {
+	_, err := s.do(http.MethodDelete, s.key(name, ext), nil, nil)
+	return err
+}
+
+func (s *s3CertStorage) Exists(name, ext string) (bool, error) {
+	_, err := s.do(http.MethodHead, s.key(name, ext), nil, nil)
+	switch {
+	case err == nil:
+		return true, nil
+	case os.IsNotExist(err):
+		return false, nil
+	}
+	return false, err
+}
+
+// listBucketResult is the response of ListObjectsV2.
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *s3CertStorage) ListResources() ([]string, error) {
+	prefix := s.prefix
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var names []string
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		body, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result listBucketResult
+		if err = xml.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("could not parse the objects of the bucket %s: %v", s.bucket, err)
+		}
+
+		for _, object := range result.Contents {
+			if name, ok := certResourceName(s.certbotLayout, strings.TrimPrefix(object.Key, prefix)); ok {
+				names = append(names, name)
+			}
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *s3CertStorage) Location(name, ext string) string {
+	return "s3://" + s.bucket + "/" + s.key(name, ext)
+}
+
+// key returns the key of the object of a file of the certificate.
+func (s *s3CertStorage) key(name, ext string) string {
+	return path.Join(s.prefix, certResourcePath(s.certbotLayout, name, ext))
+}
+
+// do sends a request of the S3 API, and returns the body of the response.
+// A missing object is an error satisfying os.IsNotExist.
+func (s *s3CertStorage) do(method, key string, query url.Values, body []byte) ([]byte, error) {
+	return s.client.Do(method, key, query, nil, body)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFileCertStorage(t *testing.T) {
+	for _, certbotLayout := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "lego-storage")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		testCertStorage(t, newFileCertStorage(dir, certbotLayout))
+
+		if _, err := os.Stat(certFilePath(dir, certbotLayout, "example.com", keyExt+".revoked")); err != nil {
+			t.Errorf("Expected the file in the layout of the storage: %v", err)
+		}
+	}
+}
+
+// fakeS3Storage is an S3 API with path-style addressing, storing the objects of the bucket in memory.
+type fakeS3Storage struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string][]byte
+}
+
+func (f *fakeS3Storage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=id/") {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if r.URL.Path == "/"+f.bucket {
+		if r.Method == http.MethodGet {
+			f.list(w, r.URL.Query())
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		// like S3, the chunked uploads are rejected.
+		if r.ContentLength < 0 {
+			http.Error(w, "MissingContentLength", http.StatusLengthRequired)
+			return
+		}
+		f.objects[key], _ = ioutil.ReadAll(r.Body)
+	case http.MethodGet, http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(object)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// list answers ListObjectsV2 with a page per object.
+func (f *fakeS3Storage) list(w http.ResponseWriter, query url.Values) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, query.Get("prefix")) && key > query.Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var result listBucketResult
+	if len(keys) > 0 {
+		result.Contents = append(result.Contents, struct {
+			Key string `xml:"Key"`
+		}{Key: keys[0]})
+		result.IsTruncated = len(keys) > 1
+		result.NextContinuationToken = keys[0]
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+// setS3Credentials sets the AWS credentials of the environment, and returns the function restoring them.
+func setS3Credentials(id string) func() {
+	oldID, oldSecret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	os.Setenv("AWS_ACCESS_KEY_ID", id)
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	return func() {
+		os.Setenv("AWS_ACCESS_KEY_ID", oldID)
+		os.Setenv("AWS_SECRET_ACCESS_KEY", oldSecret)
+	}
+}
+
+func TestS3CertStorage(t *testing.T) {
+	fake := &fakeS3Storage{bucket: "certs", objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	restore := setS3Credentials("id")
+	defer restore()
+
+	for _, certbotLayout := range []bool{false, true} {
+		store, err := newCertStorage("s3://certs/lego/prod?region=us-east-1&path-style=true&endpoint="+url.QueryEscape(server.URL), "", certbotLayout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// another prefix of the bucket is not listed.
+		fake.objects["lego/staging/other.example.com.crt"] = []byte("other")
+
+		testCertStorage(t, store)
+
+		if _, ok := fake.objects["lego/prod/"+certResourcePath(certbotLayout, "example.com", keyExt+".revoked")]; !ok {
+			t.Errorf("Expected the object in the layout of the storage, got %v", fake.objects)
+		}
+		if expected := "s3://certs/lego/prod/" + certResourcePath(certbotLayout, "example.com", certExt); store.Location("example.com", certExt) != expected {
+			t.Errorf("Expected the location %s, got %s", expected, store.Location("example.com", certExt))
+		}
+		fake.objects = make(map[string][]byte)
+	}
+
+	setS3Credentials("denied")
+	store, err := newCertStorage("s3://certs?region=us-east-1&path-style=true&endpoint="+url.QueryEscape(server.URL), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Check(); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected the bucket to be denied, got %v", err)
+	}
+}
+
+// testCertStorage saves, lists, moves aside and loads the files of two certificates.
+func testCertStorage(t *testing.T, store CertStorage) {
+	t.Helper()
+
+	if err := store.Check(); err != nil {
+		t.Fatalf("Expected a usable storage: %v", err)
+	}
+
+	for _, name := range []string{"example.com", "_.example.org"} {
+		for _, ext := range []string{certExt, leafExt, issuerExt, keyExt, metaExt} {
+			if err := store.SaveResource(name, ext, []byte(name+ext)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	names, err := store.ListResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"_.example.org", "example.com"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected the certificates %v, got %v", expected, names)
+	}
+
+	moved, err := moveCertFilesAside(store, "example.com", ".revoked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{certExt, leafExt, issuerExt, keyExt, metaExt}; !reflect.DeepEqual(moved, expected) {
+		t.Errorf("Expected the files %v to be moved, got %v", expected, moved)
+	}
+
+	// a revoked certificate is not listed anymore.
+	names, err = store.ListResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"_.example.org"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected the certificates %v, got %v", expected, names)
+	}
+
+	if _, err := store.LoadResource("example.com", certExt); !os.IsNotExist(err) {
+		t.Errorf("Expected the moved certificate to be missing, got %v", err)
+	}
+	if ok, err := store.Exists("example.com", keyExt); ok || err != nil {
+		t.Errorf("Expected the moved key to be missing, got %t (%v)", ok, err)
+	}
+	if ok, err := store.Exists("example.com", keyExt+".revoked"); !ok || err != nil {
+		t.Errorf("Expected the key to be moved aside, got %t (%v)", ok, err)
+	}
+
+	data, err := store.LoadResource("_.example.org", keyExt)
+	if err != nil || string(data) != "_.example.org"+keyExt {
+		t.Errorf("Expected the stored key, got %q (%v)", data, err)
+	}
+}
+
+func TestNewCertStorage(t *testing.T) {
+	testCases := []struct {
+		storage  string
+		expected string
+	}{
+		{storage: "", expected: "lego/certificates/example.com.crt"},
+		{storage: "file:///etc/lego", expected: "/etc/lego/example.com.crt"},
+		{storage: "file://certs", expected: "certs/example.com.crt"},
+	}
+
+	for _, test := range testCases {
+		store, err := newCertStorage(test.storage, "lego/certificates", false)
+		if err != nil {
+			t.Fatalf("%q: %v", test.storage, err)
+		}
+		if got := store.Location("example.com", certExt); got != filepath.FromSlash(test.expected) {
+			t.Errorf("%q: expected the path %s, got %s", test.storage, test.expected, got)
+		}
+	}
+
+	for _, storage := range []string{"file://", "ftp://example.com/certs", "s3:///certs"} {
+		_, err := newCertStorage(storage, "lego/certificates", false)
+		if _, ok := err.(usageError); !ok {
+			t.Errorf("%q: expected a usage error, got %v", storage, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Package dns01 computes the TXT record fulfilling the ACME dns-01 challenge.
+//
+// It is a small and stable API meant to be used by the DNS providers,
+// and by external systems which provision the records themselves.
+package dns01
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xenolf/lego/log"
+)
+
+const (
+	// DefaultTTL is the TTL (in seconds) of the TXT record, unless the DNS provider is configured otherwise.
+	DefaultTTL = 120
+
+	// cnameSupportEnvVar is the environment variable name that can be used
+	// to follow the CNAME chain of the challenge FQDN.
+	cnameSupportEnvVar = "LEGO_EXPERIMENTAL_CNAME_SUPPORT"
+
+	// maxCNAMEChainLength is the maximum number of CNAMEs followed for the challenge FQDN.
+	maxCNAMEChainLength = 10
+
+	// CheckLabel is the label of the TXT records of the credential checks of the DNS providers, e.g. _lego-test.example.com.
+	// It is distinct from _acme-challenge so that a check does not disturb a concurrent issuance.
+	CheckLabel = "_lego-test"
+)
+
+// checks are the key authorizations of the credential checks in progress, see StartCheck.
+var checks sync.Map
+
+// CNAMELookupFunc returns the target of the CNAME record of fqdn,
+// or an empty string if fqdn has no CNAME record.
+type CNAMELookupFunc func(fqdn string) (string, error)
+
+// lookupCNAME is used to follow the CNAME chain of the challenge FQDN.
+var lookupCNAME CNAMELookupFunc
+
+// SetCNAMELookup sets the lookup used to follow the CNAME chain of the challenge FQDN
+// when LEGO_EXPERIMENTAL_CNAME_SUPPORT is true.
+// The acme package sets a lookup using its recursive nameservers.
+// Without lookup, the CNAME records are not followed.
+func SetCNAMELookup(lookup CNAMELookupFunc) {
+	lookupCNAME = lookup
+}
+
+// StartCheck makes the TXT record of keyAuth a credential check record, named with CheckLabel
+// instead of _acme-challenge, until stop is called.
+// The DNS providers then create the record of a credential check as the record of a challenge.
+func StartCheck(keyAuth string) (stop func()) {
+	checks.Store(keyAuth, struct{}{})
+	return func() { checks.Delete(keyAuth) }
+}
+
+// ChallengeInfo contains the information used to create the TXT record of a dns-01 challenge.
+type ChallengeInfo struct {
+	// FQDN is the _acme-challenge name of the domain, the CheckLabel name for a credential check.
+	FQDN string
+
+	// EffectiveFQDN is the name where the TXT record must be created:
+	// the final target of the CNAME chain of FQDN when LEGO_EXPERIMENTAL_CNAME_SUPPORT is true,
+	// FQDN otherwise.
+	EffectiveFQDN string
+
+	// Value is the content of the TXT record.
+	Value string
+}
+
+// GetChallengeInfo returns the information used to create the TXT record
+// which will fulfill the dns-01 challenge of domain.
+func GetChallengeInfo(domain, keyAuth string) ChallengeInfo {
+	keyAuthShaBytes := sha256.Sum256([]byte(keyAuth))
+
+	label := "_acme-challenge"
+	if _, ok := checks.Load(keyAuth); ok {
+		label = CheckLabel
+	}
+	fqdn := fmt.Sprintf("%s.%s.", label, domain)
+
+	info := ChallengeInfo{
+		FQDN:          fqdn,
+		EffectiveFQDN: fqdn,
+		// base64URL encoding without padding
+		Value: base64.RawURLEncoding.EncodeToString(keyAuthShaBytes[:sha256.Size]),
+	}
+
+	if ok, _ := strconv.ParseBool(os.Getenv(cnameSupportEnvVar)); ok && lookupCNAME != nil {
+		info.EffectiveFQDN = followCNAMEs(fqdn, lookupCNAME)
+	}
+
+	return info
+}
+
+// GetRecord returns the name and the value of the TXT record
+// which will fulfill the dns-01 challenge of domain.
+// The name is the effective FQDN, see ChallengeInfo.
+func GetRecord(domain, keyAuth string) (fqdn, value string) {
+	info := GetChallengeInfo(domain, keyAuth)
+	return info.EffectiveFQDN, info.Value
+}
+
+// followCNAMEs resolves the CNAME chain of the given fqdn and returns its final target.
+// The fqdn is returned unchanged if the chain contains a loop or is too long.
+func followCNAMEs(fqdn string, lookup CNAMELookupFunc) string {
+	seen := map[string]bool{}
+
+	target := fqdn
+	for i := 0; i < maxCNAMEChainLength; i++ {
+		seen[strings.ToLower(target)] = true
+
+		next, err := lookup(target)
+		if err != nil || next == "" {
+			return target
+		}
+
+		if seen[strings.ToLower(next)] {
+			log.Warnf("acme: CNAME loop detected for %s, using it as is", fqdn)
+			return fqdn
+		}
+
+		log.Debugf("acme: Following CNAME %s -> %s", target, next)
+		target = next
+	}
+
+	log.Warnf("acme: CNAME chain of %s is longer than %d, using it as is", fqdn, maxCNAMEChainLength)
+	return fqdn
+}
@@ -0,0 +1,78 @@
+package dns01
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestGetRecord(t *testing.T) {
+	fqdn, value := GetRecord("example.com", "token.thumbprint")
+
+	if fqdn != "_acme-challenge.example.com." {
+		t.Errorf("Expected fqdn _acme-challenge.example.com., got %s", fqdn)
+	}
+	// base64url(sha256("token.thumbprint")) without padding
+	if expected := "61rBZ_4knHblO0MNoxFsXZ_eTFUHum0B6IVRbhvUn5I"; value != expected {
+		t.Errorf("Expected value %s, got %s", expected, value)
+	}
+}
+
+func TestGetRecordCheck(t *testing.T) {
+	stop := StartCheck("check.thumbprint")
+
+	if fqdn, _ := GetRecord("example.com", "check.thumbprint"); fqdn != "_lego-test.example.com." {
+		t.Errorf("Expected fqdn _lego-test.example.com., got %s", fqdn)
+	}
+	if fqdn, _ := GetRecord("example.com", "token.thumbprint"); fqdn != "_acme-challenge.example.com." {
+		t.Errorf("Expected the challenge fqdn _acme-challenge.example.com. during a check, got %s", fqdn)
+	}
+
+	stop()
+	if fqdn, _ := GetRecord("example.com", "check.thumbprint"); fqdn != "_acme-challenge.example.com." {
+		t.Errorf("Expected fqdn _acme-challenge.example.com. after the check, got %s", fqdn)
+	}
+}
+
+func TestGetChallengeInfoCNAME(t *testing.T) {
+	defer SetCNAMELookup(lookupCNAME)
+	defer os.Unsetenv(cnameSupportEnvVar)
+
+	cnames := map[string]string{
+		"_acme-challenge.example.com.":           "_acme-challenge.delegated.example.net.",
+		"_acme-challenge.delegated.example.net.": "challenges.example.org.",
+		"_acme-challenge.loop.com.":              "loop.example.net.",
+		"loop.example.net.":                      "_acme-challenge.loop.com.",
+	}
+	SetCNAMELookup(func(fqdn string) (string, error) {
+		if fqdn == "_acme-challenge.error.com." {
+			return "", errors.New("lookup failed")
+		}
+		return cnames[fqdn], nil
+	})
+
+	tests := []struct {
+		desc     string
+		domain   string
+		enabled  string
+		expected string
+	}{
+		{desc: "disabled", domain: "example.com", expected: "_acme-challenge.example.com."},
+		{desc: "chain", domain: "example.com", enabled: "true", expected: "challenges.example.org."},
+		{desc: "no CNAME", domain: "example.org", enabled: "true", expected: "_acme-challenge.example.org."},
+		{desc: "loop", domain: "loop.com", enabled: "true", expected: "_acme-challenge.loop.com."},
+		{desc: "lookup error", domain: "error.com", enabled: "true", expected: "_acme-challenge.error.com."},
+	}
+
+	for _, test := range tests {
+		os.Setenv(cnameSupportEnvVar, test.enabled)
+
+		info := GetChallengeInfo(test.domain, "keyAuth")
+		if info.EffectiveFQDN != test.expected {
+			t.Errorf("%s: got %s; want %s", test.desc, info.EffectiveFQDN, test.expected)
+		}
+		if expected := "_acme-challenge." + test.domain + "."; info.FQDN != expected {
+			t.Errorf("%s: got FQDN %s; want %s", test.desc, info.FQDN, expected)
+		}
+	}
+}
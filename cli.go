@@ -6,11 +6,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/urfave/cli"
 	"github.com/xenolf/lego/acme"
 	"github.com/xenolf/lego/log"
+	"github.com/xenolf/lego/platform/config/env"
+	"github.com/xenolf/lego/providers/dns"
 )
 
 var (
@@ -34,7 +38,23 @@ func main() {
 
 	app.Before = func(c *cli.Context) error {
 		if c.GlobalString("path") == "" {
-			log.Fatal("Could not determine current working directory. Please pass --path.")
+			fatalf(errorTypeUsage, "Could not determine current working directory. Please pass --path.")
+		}
+		if c.GlobalBool("json") {
+			// stdout is kept for the report.
+			log.Logger.SetOutput(os.Stderr)
+		}
+		level, err := log.ParseLevel(c.GlobalString("log-level"))
+		if err != nil {
+			fatalf(errorTypeUsage, "Invalid --log-level: %v", err)
+		}
+		if c.GlobalBool("quiet") && level < log.LevelWarn {
+			level = log.LevelWarn
+		}
+		log.SetLevel(level)
+
+		if err := loadEnvFiles(c.GlobalStringSlice("env-file")); err != nil {
+			fatalf(errorTypeUsage, "Could not load the environment file: %v", err)
 		}
 		return nil
 	}
@@ -53,12 +73,55 @@ func main() {
 					Name:  "must-staple",
 					Usage: "Include the OCSP must staple TLS extension in the CSR and generated certificate. Only works if the CSR is generated by lego.",
 				},
+				cli.StringFlag{
+					Name:  "profile",
+					Usage: "Request the certificate with the given issuance profile of the CA, e.g. \"shortlived\". The profile is reused by the renewals.",
+				},
+				cli.StringFlag{
+					Name:  "not-before",
+					Usage: "Request the certificate to be valid from the given time, in RFC 3339 format or as a duration from now (e.g. \"+1h\"). Most CAs reject it.",
+				},
+				cli.StringFlag{
+					Name:  "not-after",
+					Usage: "Request the certificate to be valid until the given time, in RFC 3339 format or as a duration from now (e.g. \"+24h\"). Most CAs reject it.",
+				},
+				cli.BoolFlag{
+					Name:  "ocsp",
+					Usage: "Write the OCSP response of the certificate in <domain>.ocsp, e.g. for the ssl_stapling_file of nginx. A revoked certificate exits with the code 66.",
+				},
+				cli.BoolFlag{
+					Name:  "split-san",
+					Usage: "Obtain several certificates if there are more domains than the CA accepts per order (100 unless advertised by the CA), saved as <domain>, <domain>-1...",
+				},
+				cli.StringFlag{
+					Name:  "run-hook",
+					Usage: "Run the command with the shell once the certificate was obtained, with the variables LEGO_CERT_DOMAIN, LEGO_CERT_PATH, LEGO_CERT_KEY_PATH and LEGO_CERT_SANS (comma separated).",
+				},
+				cli.IntFlag{
+					Name:  "hook-timeout",
+					Value: 120,
+					Usage: "Kill the hook if it does not finish within the given number of seconds.",
+				},
 			},
 		},
 		{
 			Name:   "revoke",
 			Usage:  "Revoke a certificate",
 			Action: revoke,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "reason",
+					Usage: "The reason of the revocation, as a RFC 5280 code or name, e.g. 1 or keyCompromise. Supported: unspecified, keyCompromise, cACompromise, affiliationChanged, superseded, cessationOfOperation, certificateHold, removeFromCRL, privilegeWithdrawn, aACompromise",
+				},
+				cli.StringFlag{
+					Name:  "priv-key",
+					Usage: "Sign the revocation with the private key of the certificate in this file instead of the account key. Requires --reason.",
+				},
+				cli.BoolFlag{
+					Name:  "keep",
+					Usage: "Keep the files of the revoked certificate instead of renaming them with the .revoked suffix, which prevents renew from renewing it.",
+				},
+			},
 		},
 		{
 			Name:   "renew",
@@ -67,12 +130,32 @@ func main() {
 			Flags: []cli.Flag{
 				cli.IntFlag{
 					Name:  "days",
-					Value: 0,
-					Usage: "The number of days left on a certificate to renew it.",
+					Value: 30,
+					Usage: "Renew the certificate only if it expires within the given number of days, 0 to always renew it.",
+				},
+				cli.BoolFlag{
+					Name:  "force",
+					Usage: "Always renew the certificate, like --days 0.",
+				},
+				cli.BoolFlag{
+					Name:  "check-ocsp",
+					Usage: "Also renew the certificate if its OCSP responder reports it as revoked.",
 				},
 				cli.BoolFlag{
 					Name:  "reuse-key",
-					Usage: "Used to indicate you want to reuse your current private key for the new certificate.",
+					Usage: "Used to indicate you want to reuse your current private key for the new certificate. The next renewals then reuse the key too, with or without --reuse-key.",
+				},
+				cli.BoolFlag{
+					Name:  "new-key",
+					Usage: "Generate a new private key, even if the previous renewals reused the key.",
+				},
+				cli.BoolFlag{
+					Name:  "ari-enable",
+					Usage: "Also renew the certificate if the renewal window suggested by the CA (ACME Renewal Information) has started, and tell the CA the certificate which is replaced. Ignored if the CA does not support it.",
+				},
+				cli.BoolFlag{
+					Name:  "ari-wait-to-renew",
+					Usage: "Print when the renewal window suggested by the CA opens for the certificate, without renewing it.",
 				},
 				cli.BoolFlag{
 					Name:  "no-bundle",
@@ -82,12 +165,207 @@ func main() {
 					Name:  "must-staple",
 					Usage: "Include the OCSP must staple TLS extension in the CSR and generated certificate. Only works if the CSR is generated by lego.",
 				},
+				cli.StringFlag{
+					Name:  "profile",
+					Usage: "Renew the certificate with the given issuance profile of the CA instead of the profile of the certificate.",
+				},
+				cli.StringFlag{
+					Name:  "not-before",
+					Usage: "Request the certificate to be valid from the given time, in RFC 3339 format or as a duration from now (e.g. \"+1h\"). Most CAs reject it.",
+				},
+				cli.StringFlag{
+					Name:  "not-after",
+					Usage: "Request the certificate to be valid until the given time, in RFC 3339 format or as a duration from now (e.g. \"+24h\"). Most CAs reject it.",
+				},
+				cli.BoolFlag{
+					Name:  "ocsp",
+					Usage: "Write the OCSP response of the certificate in <domain>.ocsp, and refresh the response of a certificate which is not renewed once half of its validity elapsed. A revoked certificate exits with the code 66.",
+				},
+				cli.StringFlag{
+					Name:  "renew-hook",
+					Usage: "Run the command with the shell once the certificate was renewed, with the variables LEGO_CERT_DOMAIN, LEGO_CERT_PATH, LEGO_CERT_KEY_PATH and LEGO_CERT_SANS (comma separated).",
+				},
+				cli.IntFlag{
+					Name:  "hook-timeout",
+					Value: 120,
+					Usage: "Kill the hook if it does not finish within the given number of seconds.",
+				},
+			},
+		},
+		{
+			Name:   "daemon",
+			Usage:  "Obtain the certificate of --domains if needed, then renew the stored certificates periodically until stopped",
+			Action: daemon,
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:  "interval",
+					Value: 24 * time.Hour,
+					Usage: "Check the stored certificates with this interval, plus a random delay of up to a tenth of it. A failed renewal is retried sooner, with an exponential backoff from 5 minutes.",
+				},
+				cli.IntFlag{
+					Name:  "days",
+					Value: 30,
+					Usage: "Renew the certificates expiring within the given number of days.",
+				},
+				cli.BoolFlag{
+					Name:  "check-ocsp",
+					Usage: "Also renew the certificates whose OCSP responder reports them as revoked.",
+				},
+				cli.BoolFlag{
+					Name:  "reuse-key",
+					Usage: "Used to indicate you want to reuse your current private key for the new certificate. The next renewals then reuse the key too, with or without --reuse-key.",
+				},
+				cli.BoolFlag{
+					Name:  "new-key",
+					Usage: "Generate a new private key, even if the previous renewals reused the key.",
+				},
+				cli.BoolFlag{
+					Name:  "ari-enable",
+					Usage: "Also renew the certificate if the renewal window suggested by the CA (ACME Renewal Information) has started, and tell the CA the certificate which is replaced. Ignored if the CA does not support it.",
+				},
+				cli.BoolFlag{
+					Name:  "no-bundle",
+					Usage: "Do not create a certificate bundle by adding the issuers certificate to the new certificate.",
+				},
+				cli.BoolFlag{
+					Name:  "must-staple",
+					Usage: "Include the OCSP must staple TLS extension in the CSR and generated certificate. Only works if the CSR is generated by lego.",
+				},
+				cli.StringFlag{
+					Name:  "profile",
+					Usage: "Request the certificates with the given issuance profile of the CA instead of the profile of each certificate.",
+				},
+				cli.StringFlag{
+					Name:  "renew-hook",
+					Usage: "Run the command with the shell once a certificate was obtained or renewed, with the variables LEGO_CERT_DOMAIN, LEGO_CERT_PATH, LEGO_CERT_KEY_PATH and LEGO_CERT_SANS (comma separated). A failing hook is only logged.",
+				},
+				cli.IntFlag{
+					Name:  "hook-timeout",
+					Value: 120,
+					Usage: "Kill the hook if it does not finish within the given number of seconds.",
+				},
+			},
+		},
+		{
+			Name:  "account",
+			Usage: "Manage the account",
+			Subcommands: []cli.Command{
+				{
+					Name:   "rollover",
+					Usage:  "Replace the account key with a newly generated key",
+					Action: rollover,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "new-key-type",
+							Value: "ec384",
+							Usage: "Key type of the new account key. Supported: rsa2048, rsa4096, rsa8192, ec256, ec384",
+						},
+					},
+				},
+				{
+					Name:   "deactivate",
+					Usage:  "Deactivate the account, and rename its local files so that they are not reused",
+					Action: deactivate,
+				},
+				{
+					Name:   "orders",
+					Usage:  "List the orders of the account",
+					Action: listOrders,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "deactivate-pending",
+							Usage: "Deactivate the pending authorizations of the orders",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:   "list",
+			Usage:  "Display the certificates and accounts stored in the path",
+			Action: list,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "accounts",
+					Usage: "Display the accounts by ACME server and email instead of the certificates.",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Display the entries in JSON format.",
+				},
+			},
+		},
+		{
+			Name:  "dns",
+			Usage: "Manage the records of the DNS providers",
+			Subcommands: []cli.Command{
+				{
+					Name:   "cleanup",
+					Usage:  "Remove the _acme-challenge TXT records of the domains left by the challenges which were never cleaned up",
+					Action: dnsCleanup,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "dns",
+							Usage: "The DNS provider listing the records, e.g. ovh. Comma-separated providers are swept in turn. Defaults to the --dns global option.",
+						},
+						cli.StringSliceFlag{
+							Name:  "domains, d",
+							Usage: "The domain whose records, and the records of its subdomains, are removed. Can be specified multiple times. Defaults to the --domains global option.",
+						},
+						cli.DurationFlag{
+							Name:  "older-than",
+							Usage: "Only remove the records created before this duration, e.g. 24h, to keep the challenges in progress. The records of the providers which do not tell their creation time are then kept.",
+						},
+						cli.BoolFlag{
+							Name:  "dry-run",
+							Usage: "Only display the records which would be removed.",
+						},
+					},
+				},
+				{
+					Name:   "check",
+					Usage:  "Check the credentials of the DNS providers without contacting the CA: create a _lego-test TXT record, check its propagation and remove it",
+					Action: dnsCheck,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "dns",
+							Usage: "The DNS provider to check, e.g. ovh. Comma-separated providers are checked in turn. Defaults to the --dns global option.",
+						},
+						cli.StringSliceFlag{
+							Name:  "domains, d",
+							Usage: "The domain whose record _lego-test.<domain> is created. Can be specified multiple times. Defaults to the --domains global option.",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:  "ocsp",
+			Usage: "Manage the OCSP responses stapled by the servers",
+			Subcommands: []cli.Command{
+				{
+					Name:   "refresh",
+					Usage:  "Refresh the <domain>.ocsp OCSP responses of the stored certificates of --domains once half of their validity elapsed. A revoked certificate exits with the code 66.",
+					Action: ocspRefresh,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "force",
+							Usage: "Always fetch a new OCSP response.",
+						},
+					},
+				},
 			},
 		},
 		{
 			Name:   "dnshelp",
 			Usage:  "Shows additional help for the --dns global option",
 			Action: dnshelp,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "provider",
+					Usage: "Display the description of the environment variables of the provider, e.g. ovh.",
+				},
+			},
 		},
 	}
 
@@ -100,6 +378,15 @@ func main() {
 			Name:  "csr, c",
 			Usage: "Certificate signing request filename, if an external CSR is to be used",
 		},
+		cli.StringFlag{
+			Name:  "domains-file",
+			Usage: "Obtain or renew a certificate for each line of the file, with the domains of the line separated by whitespace, the first one being the CN. The text after a # is a comment. The certificates share the account, and a failing certificate does not stop the others.",
+		},
+		cli.IntFlag{
+			Name:  "concurrency",
+			Value: 4,
+			Usage: "The number of certificates of --domains-file obtained or renewed at once.",
+		},
 		cli.StringFlag{
 			Name:  "server, s",
 			Value: "https://acme-v02.api.letsencrypt.org/directory",
@@ -111,7 +398,15 @@ func main() {
 		},
 		cli.StringFlag{
 			Name:  "filename",
-			Usage: "Filename of the generated certificate",
+			Usage: "Filename of the generated certificate, used instead of the domain by all the commands. In the Certbot layout, it is the name of the directory of the certificate.",
+		},
+		cli.BoolFlag{
+			Name:  "certbot-layout",
+			Usage: "Store the certificates like Certbot, in live/<domain>/ with fullchain.pem, cert.pem, chain.pem and privkey.pem, instead of certificates/<domain>.crt and .key.",
+		},
+		cli.StringFlag{
+			Name:  "storage",
+			Usage: "Storage of the certificates: file://<dir> to store their files in <dir> instead of --path, or s3://<bucket>/<prefix> for an S3 bucket. The accounts are always stored in --path.",
 		},
 		cli.BoolFlag{
 			Name:  "accept-tos, a",
@@ -119,15 +414,17 @@ func main() {
 		},
 		cli.BoolFlag{
 			Name:  "eab",
-			Usage: "Use External Account Binding for account registration. Requires --kid and --hmac.",
+			Usage: "Use External Account Binding for account registration. Requires --kid and --hmac. Ignored if the account is already registered.",
 		},
 		cli.StringFlag{
-			Name:  "kid",
-			Usage: "Key identifier from External CA. Used for External Account Binding.",
+			Name:   "kid",
+			Usage:  "Key identifier from External CA. Used for External Account Binding.",
+			EnvVar: "LEGO_EAB_KID",
 		},
 		cli.StringFlag{
-			Name:  "hmac",
-			Usage: "MAC key from External CA. Should be in Base64 URL Encoding without padding format. Used for External Account Binding.",
+			Name:   "hmac",
+			Usage:  "MAC key from External CA. Should be in Base64 URL Encoding without padding format. Used for External Account Binding.",
+			EnvVar: "LEGO_EAB_HMAC",
 		},
 		cli.StringFlag{
 			Name:  "key-type, k",
@@ -143,44 +440,150 @@ func main() {
 			Name:  "exclude, x",
 			Usage: "Explicitly disallow solvers by name from being used. Solvers: \"http-01\", \"dns-01\", \"tls-alpn-01\".",
 		},
+		cli.StringSliceFlag{
+			Name:  "challenge-for",
+			Usage: "Set the challenges to attempt for a domain, in order of preference, e.g. \"internal.example.com=dns\" or \"example.com=http-01,dns-01\". Can be specified multiple times. Challenges: \"http\", \"dns\", \"tls-alpn\".",
+		},
+		cli.StringFlag{
+			Name:  "challenge-order",
+			Usage: "Set the order in which the challenges are attempted for the domains without preference, e.g. \"tls-alpn-01,http-01\". The next challenge is attempted if one fails and the CA allows it. Challenges: \"http\", \"dns\", \"tls-alpn\".",
+		},
+		cli.StringFlag{
+			Name:  "http.webroot",
+			Usage: "Set the webroot folder to use for HTTP based challenges to write directly in a file in .well-known/acme-challenge. Several folders separated by commas, e.g. of virtual hosts, are all written.",
+		},
 		cli.StringFlag{
 			Name:  "webroot",
-			Usage: "Set the webroot folder to use for HTTP based challenges to write directly in a file in .well-known/acme-challenge",
+			Usage: "Deprecated, same as --http.webroot.",
+		},
+		cli.StringSliceFlag{
+			Name:   "http.memcached-host",
+			Usage:  "Set the memcached host(s) to use for HTTP based challenges. Challenges will be written to all specified hosts. Can be specified multiple times.",
+			EnvVar: "LEGO_HTTP_MEMCACHED_HOSTS",
 		},
 		cli.StringSliceFlag{
 			Name:  "memcached-host",
-			Usage: "Set the memcached host(s) to use for HTTP based challenges. Challenges will be written to all specified hosts.",
+			Usage: "Deprecated, same as --http.memcached-host.",
+		},
+		cli.StringFlag{
+			Name:   "http.s3-bucket",
+			Usage:  "Set the S3 bucket to upload the HTTP based challenges to, served over HTTP e.g. as a bucket website. The AWS credentials, the region and the endpoint are read from the environment, see providers/http/s3.",
+			EnvVar: "LEGO_HTTP_S3_BUCKET",
+		},
+		cli.StringFlag{
+			Name:  "http.port",
+			Usage: "Set the interface and port to listen on for HTTP based challenges, e.g. 127.0.0.1:8080 or [::1]:8888. The CA still connects to the port 80: use it behind a port forwarding or a reverse proxy. Supported: host:port or :port",
+		},
+		cli.StringFlag{
+			Name:  "http.socket",
+			Usage: "Set the UNIX socket to listen on for HTTP based challenges instead of a port, e.g. for a local reverse proxy forwarding /.well-known/acme-challenge/ to it. The socket is removed once the challenges are done.",
+		},
+		cli.StringFlag{
+			Name:  "http.socket-mode",
+			Value: "0666",
+			Usage: "Set the permissions of the --http.socket socket, in octal.",
+		},
+		cli.StringFlag{
+			Name:  "http.proxy-header",
+			Usage: "Match the HTTP based challenges with this header instead of the Host header, e.g. X-Forwarded-Host behind a reverse proxy rewriting it. By default, the Host header must match the domain.",
+		},
+		cli.StringFlag{
+			Name:  "tls.port",
+			Usage: "Set the interface and port to listen on for TLS based challenges, e.g. 127.0.0.1:8443. The CA still connects to the port 443: use it behind a port forwarding or a TLS passthrough proxy. Supported: host:port or :port",
 		},
 		cli.StringFlag{
 			Name:  "http",
-			Usage: "Set the port and interface to use for HTTP based challenges to listen on. Supported: interface:port or :port",
+			Usage: "Deprecated, same as --http.port.",
 		},
 		cli.StringFlag{
 			Name:  "tls",
-			Usage: "Set the port and interface to use for TLS based challenges to listen on. Supported: interface:port or :port",
+			Usage: "Deprecated, same as --tls.port.",
 		},
 		cli.StringFlag{
 			Name:  "dns",
-			Usage: "Solve a DNS challenge using the specified provider. Disables all other challenges. Run 'lego dnshelp' for help on usage.",
+			Usage: "Solve a DNS challenge using the specified provider. Disables all other challenges. Comma-separated providers, e.g. \"cloudflare,route53\", are tried in order, each one on the failure of the previous one. Run 'lego dnshelp' for help on usage.",
+		},
+		cli.IntFlag{
+			Name:  "dns.manual-wait",
+			Usage: "Wait at most the given seconds after printing a record with the manual DNS provider, pressing 'Enter' ending the wait on a terminal. Without terminal, lego waits the full duration. Overrides MANUAL_SLEEP.",
+		},
+		cli.StringSliceFlag{
+			Name:  "env-file",
+			Usage: "Read the NAME=VALUE lines of the file into the environment, e.g. the credentials of the DNS provider. Can be specified multiple times, a file overriding the previous ones. The variables already set are not overridden.",
+		},
+		cli.StringSliceFlag{
+			Name:  "dns-mapping",
+			Usage: "Solve the DNS challenges of a domain and its subdomains with the given provider instead of --dns, e.g. \"example.com=cloudflare\". Can be specified multiple times. Each provider reads its own environment variables. Disables all other challenges.",
 		},
 		cli.IntFlag{
 			Name:  "http-timeout",
-			Usage: "Set the HTTP timeout value to a specific value in seconds. The default is 10 seconds.",
+			Usage: "Set the timeout of the HTTP requests to the ACME server in seconds. By default, only the connection and the response headers have a timeout.",
+		},
+		cli.IntFlag{
+			Name:  "cert.timeout",
+			Usage: "Set the timeout in seconds of obtaining or renewing a certificate, including the validation of the challenges. lego exits with the code 75 on timeout. By default, there is no timeout.",
 		},
 		cli.IntFlag{
 			Name:  "dns-timeout",
 			Usage: "Set the DNS timeout value to a specific value in seconds. The default is 10 seconds.",
 		},
+		cli.StringSliceFlag{
+			Name:  "dns.resolvers",
+			Usage: "Set the resolvers to use for performing recursive DNS queries. Can be specified multiple times. Supported: host, host:port, IPv6 literals. The default is to use the system resolvers, or Google's DNS resolvers if the system's cannot be determined.",
+		},
 		cli.StringSliceFlag{
 			Name:  "dns-resolvers",
-			Usage: "Set the resolvers to use for performing recursive DNS queries. Supported: host:port. The default is to use the system resolvers, or Google's DNS resolvers if the system's cannot be determined.",
+			Usage: "Deprecated, same as --dns.resolvers.",
+		},
+		cli.BoolFlag{
+			Name:  "dns.disable-cp",
+			Usage: "By setting this flag to true, disables the need to wait the propagation of the TXT record to all authoritative name servers.",
+		},
+		cli.BoolFlag{
+			Name:  "dns.require-all-ns",
+			Usage: "Wait until every IPv4 and IPv6 address of every authoritative name server serves the TXT record, as the CA may validate from several network perspectives. The unreachable name servers are retried until the propagation timeout, and the timeout error lists the status of every address.",
+		},
+		cli.StringFlag{
+			Name:  "user-agent",
+			Usage: "Prepend a product token to the user-agent sent to the CA to identify an application embedding lego-cli, e.g. \"myproduct/2.3\".",
+		},
+		cli.BoolFlag{
+			Name:  "always-deactivate-authorizations",
+			Usage: "Deactivate the authorizations of an order after issuing its certificate, not only when the order fails.",
 		},
 		cli.BoolFlag{
 			Name:  "pem",
-			Usage: "Generate a .pem file by concatanating the .key and .crt files together.",
+			Usage: "Generate a .pem file with the private key followed by the certificate and the issuer chain, e.g. for HAProxy.",
+		},
+		cli.BoolFlag{
+			Name:  "pfx",
+			Usage: "Generate a .pfx (PKCS#12) file with the private key, the certificate and the issuer chain.",
+		},
+		cli.StringFlag{
+			Name:   "pfx.pass",
+			Usage:  "The password of the .pfx file.",
+			EnvVar: "LEGO_PFX_PASSWORD",
+			Value:  "changeit",
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "Write the outcome of the run, renew and revoke commands for each domain as a JSON document on stdout, and the logs on stderr.",
+		},
+		cli.StringFlag{
+			Name:  "log-level",
+			Usage: "Level of the least severe entries of the log of the challenges and of the DNS providers: debug, info, warn or error.",
+			Value: "info",
+		},
+		cli.BoolFlag{
+			Name:  "quiet, q",
+			Usage: "Only log the warnings and the errors of the challenges and of the DNS providers, like --log-level warn.",
 		},
 	}
 
+	// an invalid flag exits with exitCodeUsage.
+	app.OnUsageError = onUsageError
+	setOnUsageError(app.Commands)
+
 	err = app.Run(os.Args)
 	if err != nil {
 		log.Fatal(err)
@@ -188,6 +591,15 @@ func main() {
 }
 
 func dnshelp(c *cli.Context) error {
+	if name := c.String("provider"); name != "" {
+		doc, err := dns.DocumentationByName(name)
+		if err != nil {
+			log.Fatalf("%v. Run 'lego dnshelp' for the list of the providers.", err)
+		}
+		dnsProviderHelp(doc)
+		return nil
+	}
+
 	fmt.Printf(
 		`Credentials for DNS providers must be passed through environment variables.
 
@@ -202,47 +614,62 @@ Here is an example bash command using the CloudFlare DNS provider:
 	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
 	fmt.Fprintln(w, "Valid providers and their associated credential environment variables:")
 	fmt.Fprintln(w)
-	fmt.Fprintln(w, "\tacme-dns:\tACME_DNS_API_BASE, ACME_DNS_STORAGE_PATH")
-	fmt.Fprintln(w, "\talidns:\tALIDNS_API_KEY, ALIDNS_SECRET_KEY")
-	fmt.Fprintln(w, "\tazure:\tAZURE_CLIENT_ID, AZURE_CLIENT_SECRET, AZURE_SUBSCRIPTION_ID, AZURE_TENANT_ID, AZURE_RESOURCE_GROUP")
-	fmt.Fprintln(w, "\tauroradns:\tAURORA_USER_ID, AURORA_KEY, AURORA_ENDPOINT")
-	fmt.Fprintln(w, "\tbluecat:\tBLUECAT_SERVER_URL, BLUECAT_USER_NAME, BLUECAT_PASSWORD, BLUECAT_CONFIG_NAME, BLUECAT_DNS_VIEW")
-	fmt.Fprintln(w, "\tcloudxns:\tCLOUDXNS_API_KEY, CLOUDXNS_SECRET_KEY")
-	fmt.Fprintln(w, "\tcloudflare:\tCLOUDFLARE_EMAIL, CLOUDFLARE_API_KEY")
-	fmt.Fprintln(w, "\tdigitalocean:\tDO_AUTH_TOKEN")
-	fmt.Fprintln(w, "\tdnsimple:\tDNSIMPLE_EMAIL, DNSIMPLE_OAUTH_TOKEN")
-	fmt.Fprintln(w, "\tdnsmadeeasy:\tDNSMADEEASY_API_KEY, DNSMADEEASY_API_SECRET")
-	fmt.Fprintln(w, "\tduckdns:\tDUCKDNS_TOKEN")
-	fmt.Fprintln(w, "\texoscale:\tEXOSCALE_API_KEY, EXOSCALE_API_SECRET, EXOSCALE_ENDPOINT")
-	fmt.Fprintln(w, "\tgandi:\tGANDI_API_KEY")
-	fmt.Fprintln(w, "\tgandiv5:\tGANDIV5_API_KEY")
-	fmt.Fprintln(w, "\tgcloud:\tGCE_PROJECT, GCE_SERVICE_ACCOUNT_FILE")
-	fmt.Fprintln(w, "\tglesys:\tGLESYS_API_USER, GLESYS_API_KEY")
-	fmt.Fprintln(w, "\tiij:\tIIJ_API_ACCESS_KEY, IIJ_API_SECRET_KEY, IIJ_DO_SERVICE_CODE")
-	fmt.Fprintln(w, "\tlinode:\tLINODE_API_KEY")
-	fmt.Fprintln(w, "\tlightsail:\tAWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, DNS_ZONE")
-	fmt.Fprintln(w, "\tmanual:\tnone")
-	fmt.Fprintln(w, "\tnamecheap:\tNAMECHEAP_API_USER, NAMECHEAP_API_KEY")
-	fmt.Fprintln(w, "\tnamedotcom:\tNAMECOM_USERNAME, NAMECOM_API_TOKEN")
-	fmt.Fprintln(w, "\tnetcup:\tNETCUP_CUSTOMER_NUMBER, NETCUP_API_KEY, NETCUP_API_PASSWORD")
-	fmt.Fprintln(w, "\tnifcloud:\tNIFCLOUD_ACCESS_KEY_ID, NIFCLOUD_SECRET_ACCESS_KEY")
-	fmt.Fprintln(w, "\trackspace:\tRACKSPACE_USER, RACKSPACE_API_KEY")
-	fmt.Fprintln(w, "\trfc2136:\tRFC2136_TSIG_KEY, RFC2136_TSIG_SECRET,\n\t\tRFC2136_TSIG_ALGORITHM, RFC2136_NAMESERVER")
-	fmt.Fprintln(w, "\troute53:\tAWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_REGION, AWS_HOSTED_ZONE_ID")
-	fmt.Fprintln(w, "\tdyn:\tDYN_CUSTOMER_NAME, DYN_USER_NAME, DYN_PASSWORD")
-	fmt.Fprintln(w, "\tvegadns:\tSECRET_VEGADNS_KEY, SECRET_VEGADNS_SECRET, VEGADNS_URL")
-	fmt.Fprintln(w, "\tvultr:\tVULTR_API_KEY")
-	fmt.Fprintln(w, "\tovh:\tOVH_ENDPOINT, OVH_APPLICATION_KEY, OVH_APPLICATION_SECRET, OVH_CONSUMER_KEY")
-	fmt.Fprintln(w, "\tpdns:\tPDNS_API_KEY, PDNS_API_URL")
-	fmt.Fprintln(w, "\tdnspod:\tDNSPOD_API_KEY")
-	fmt.Fprintln(w, "\totc:\tOTC_USER_NAME, OTC_PASSWORD, OTC_PROJECT_NAME, OTC_DOMAIN_NAME, OTC_IDENTITY_ENDPOINT")
-	fmt.Fprintln(w, "\tsakuracloud:\tSAKURACLOUD_ACCESS_TOKEN, SAKURACLOUD_ACCESS_TOKEN_SECRET")
-	fmt.Fprintln(w, "\texec:\tEXEC_PATH, EXEC_MODE")
+	for _, doc := range dns.Documentations() {
+		fmt.Fprintf(w, "\t%s:\t%s\n", doc.Name, varNames(doc.Required))
+	}
 	w.Flush()
 
 	fmt.Println(`
-For a more detailed explanation of a DNS provider's credential variables,
-please consult their online documentation.`)
+For the description of the variables of a provider, including the optional ones, run 'lego dnshelp --provider <name>'.
+The DNS propagation timeout and polling interval of a provider are set in seconds with its
+<PREFIX>_PROPAGATION_TIMEOUT and <PREFIX>_POLLING_INTERVAL variables, e.g. CLOUDFLARE_PROPAGATION_TIMEOUT.`)
 
 	return nil
 }
+
+// dnsProviderHelp displays the documentation of a DNS provider.
+func dnsProviderHelp(doc env.Documentation) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintf(w, "%s: %s\n", doc.Name, doc.Description)
+	if doc.URL != "" {
+		fmt.Fprintf(w, "Documentation: %s\n", doc.URL)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Credentials:")
+	if len(doc.Required) == 0 {
+		fmt.Fprintln(w, "\tnone")
+	}
+	for _, v := range doc.Required {
+		fmt.Fprintf(w, "\t%s\t%s\n", v.Name, v.Description)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Optional variables:")
+	for _, v := range doc.Optional {
+		fmt.Fprintf(w, "\t%s\t%s\n", v.Name, v.Description)
+	}
+	for _, v := range dnsCommonVars {
+		fmt.Fprintf(w, "\t%s\t%s\n", v.Name, v.Description)
+	}
+	w.Flush()
+}
+
+// dnsCommonVars are the environment variables of every DNS provider.
+var dnsCommonVars = []env.Var{
+	{Name: "LEGO_DNS_PROPAGATION_TIMEOUT", Description: "The DNS propagation timeout in seconds, overriding the one of the provider"},
+	{Name: "LEGO_DNS_POLLING_INTERVAL", Description: "The DNS propagation polling interval in seconds, overriding the one of the provider"},
+}
+
+// varNames returns the names of the variables, separated by commas.
+func varNames(vars []env.Var) string {
+	if len(vars) == 0 {
+		return "none"
+	}
+
+	var names []string
+	for _, v := range vars {
+		names = append(names, v.Name)
+	}
+	return strings.Join(names, ", ")
+}
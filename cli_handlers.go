@@ -2,16 +2,20 @@ package main
 
 import (
 	"bufio"
-	"bytes"
+	"context"
+	"crypto"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/http"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/urfave/cli"
@@ -19,6 +23,7 @@ import (
 	"github.com/xenolf/lego/log"
 	"github.com/xenolf/lego/providers/dns"
 	"github.com/xenolf/lego/providers/http/memcached"
+	"github.com/xenolf/lego/providers/http/s3"
 	"github.com/xenolf/lego/providers/http/webroot"
 )
 
@@ -29,35 +34,101 @@ func checkFolder(path string) error {
 	return nil
 }
 
-func setup(c *cli.Context) (*Configuration, *Account, *acme.Client) {
+// writeFileAtomic writes the data to a temporary file renamed to filename,
+// so that readers never see a partially written file.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if errC := tmp.Close(); err == nil {
+		err = errC
+	}
+	if err != nil {
+		return err
+	}
 
-	if c.GlobalIsSet("http-timeout") {
-		acme.HTTPClient = http.Client{Timeout: time.Duration(c.GlobalInt("http-timeout")) * time.Second}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
 	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// dnsResolvers returns the recursive nameservers of --dns.resolvers, and of the deprecated --dns-resolvers.
+func dnsResolvers(c *cli.Context) []string {
+	return append(c.GlobalStringSlice("dns.resolvers"), c.GlobalStringSlice("dns-resolvers")...)
+}
 
+// setupDNS sets the DNS timeout and the recursive nameservers of --dns-timeout and --dns.resolvers.
+func setupDNS(c *cli.Context) {
 	if c.GlobalIsSet("dns-timeout") {
 		acme.DNSTimeout = time.Duration(c.GlobalInt("dns-timeout")) * time.Second
 	}
 
-	if len(c.GlobalStringSlice("dns-resolvers")) > 0 {
-		var resolvers []string
-		for _, resolver := range c.GlobalStringSlice("dns-resolvers") {
-			if !strings.Contains(resolver, ":") {
-				resolver += ":53"
-			}
-			resolvers = append(resolvers, resolver)
+	// the client checks the propagation with its own resolvers,
+	// the providers find their zones with the recursive nameservers of the package.
+	if resolvers := dnsResolvers(c); len(resolvers) > 0 {
+		err := acme.SetRecursiveNameservers(resolvers)
+		if err != nil {
+			fatalf(errorTypeUsage, "Invalid --dns.resolvers: %v", err)
+		}
+	}
+}
+
+func setup(c *cli.Context) (*Configuration, *Account, *acme.Client) {
+	setupDNS(c)
+
+	if c.GlobalBool("dns.disable-cp") {
+		if c.GlobalBool("dns.require-all-ns") {
+			fatalf(errorTypeUsage, "The --dns.require-all-ns switch cannot be used with --dns.disable-cp")
+		}
+		acme.DNS01DisableCompletePropagationRequirement()
+	}
+
+	// the listeners are checked before contacting the CA.
+	httpFlag := setFlagName(c, "http.port", "http")
+	if httpFlag != "" {
+		checkListenAddress(httpFlag, c.GlobalString(httpFlag), "80")
+	}
+	tlsFlag := setFlagName(c, "tls.port", "tls")
+	if tlsFlag != "" {
+		checkListenAddress(tlsFlag, c.GlobalString(tlsFlag), "443")
+	}
+	var socketMode uint64
+	if c.GlobalString("http.socket") != "" {
+		if httpFlag != "" {
+			fatalf(errorTypeUsage, "Please specify either --http.socket or --%s, but not both", httpFlag)
+		}
+
+		var err error
+		socketMode, err = strconv.ParseUint(c.GlobalString("http.socket-mode"), 8, 32)
+		if err != nil {
+			fatalf(errorTypeUsage, "Invalid --http.socket-mode %s: expected octal permissions, e.g. 0660", c.GlobalString("http.socket-mode"))
 		}
-		acme.RecursiveNameservers = resolvers
 	}
 
 	err := checkFolder(c.GlobalString("path"))
 	if err != nil {
-		log.Fatalf("Could not check/create path: %v", err)
+		fatalf(errorTypeSave, "Could not check/create path: %v", err)
 	}
 
 	conf := NewConfiguration(c)
 	if len(c.GlobalString("email")) == 0 {
-		log.Fatal("You have to pass an account (email address) to the program using --email or -m")
+		fatalf(errorTypeUsage, "You have to pass an account (email address) to the program using --email or -m")
+	}
+
+	// the DNS providers of the domains are checked before contacting the CA.
+	mapping, err := conf.DNSMapping()
+	if err != nil {
+		fatalf(errorTypeUsage, "%v", err)
+	}
+	if err = conf.CheckDNSMapping(c.GlobalStringSlice("domains")); err != nil {
+		fatalf(errorTypeUsage, "%v", err)
 	}
 
 	//TODO: move to account struct? Currently MUST pass email.
@@ -65,24 +136,45 @@ func setup(c *cli.Context) (*Configuration, *Account, *acme.Client) {
 
 	keyType, err := conf.KeyType()
 	if err != nil {
-		log.Fatal(err)
+		fatalf(errorTypeUsage, "%v", err)
+	}
+
+	client, err := acme.NewClientWithOptions(c.GlobalString("server"), acc, conf.ClientOptions(keyType)...)
+	if err != nil {
+		fatalf(errorType(context.Background(), err), "Could not create client: %v", err)
+	}
+
+	if c.GlobalBool("always-deactivate-authorizations") {
+		client.SetAlwaysDeactivateAuthorizations(true)
 	}
 
-	acme.UserAgent = fmt.Sprintf("lego-cli/%s", c.App.Version)
+	// asked when the CA requires to agree to new TOS.
+	client.SetTOSCallback(func(tosURL string) bool {
+		return handleTOS(c, tosURL)
+	})
 
-	client, err := acme.NewClient(c.GlobalString("server"), acc, keyType)
+	preferences, err := conf.ChallengePreferences()
 	if err != nil {
-		log.Fatalf("Could not create client: %v", err)
+		fatalf(errorTypeUsage, "%v", err)
+	}
+	for domain, challenges := range preferences {
+		client.SetChallengePreference(domain, challenges)
 	}
 
+	order, err := conf.ChallengeOrder()
+	if err != nil {
+		fatalf(errorTypeUsage, "%v", err)
+	}
+	client.SetChallengeOrder(order)
+
 	if len(c.GlobalStringSlice("exclude")) > 0 {
 		client.ExcludeChallenges(conf.ExcludedSolvers())
 	}
 
-	if c.GlobalIsSet("webroot") {
-		provider, err := webroot.NewHTTPProvider(c.GlobalString("webroot"))
+	if webrootFlag := setFlagName(c, "http.webroot", "webroot"); webrootFlag != "" {
+		provider, err := webroot.NewHTTPProviderConfig(&webroot.Config{Paths: strings.Split(c.GlobalString(webrootFlag), ",")})
 		if err != nil {
-			log.Fatal(err)
+			fatalf(errorTypeUsage, "%v", err)
 		}
 
 		err = client.SetChallengeProvider(acme.HTTP01, provider)
@@ -90,14 +182,14 @@ func setup(c *cli.Context) (*Configuration, *Account, *acme.Client) {
 			log.Fatal(err)
 		}
 
-		// --webroot=foo indicates that the user specifically want to do a HTTP challenge
+		// --http.webroot=foo indicates that the user specifically want to do a HTTP challenge
 		// infer that the user also wants to exclude all other challenges
 		client.ExcludeChallenges([]acme.Challenge{acme.DNS01, acme.TLSALPN01})
 	}
-	if c.GlobalIsSet("memcached-host") {
-		provider, err := memcached.NewMemcachedProvider(c.GlobalStringSlice("memcached-host"))
+	if hosts := append(c.GlobalStringSlice("http.memcached-host"), c.GlobalStringSlice("memcached-host")...); len(hosts) > 0 {
+		provider, err := memcached.NewMemcachedProvider(hosts)
 		if err != nil {
-			log.Fatal(err)
+			fatalf(errorTypeUsage, "%v", err)
 		}
 
 		err = client.SetChallengeProvider(acme.HTTP01, provider)
@@ -105,33 +197,63 @@ func setup(c *cli.Context) (*Configuration, *Account, *acme.Client) {
 			log.Fatal(err)
 		}
 
-		// --memcached-host=foo:11211 indicates that the user specifically want to do a HTTP challenge
+		// --http.memcached-host=foo:11211 indicates that the user specifically want to do a HTTP challenge
 		// infer that the user also wants to exclude all other challenges
 		client.ExcludeChallenges([]acme.Challenge{acme.DNS01, acme.TLSALPN01})
 	}
-	if c.GlobalIsSet("http") {
-		if !strings.Contains(c.GlobalString("http"), ":") {
-			log.Fatalf("The --http switch only accepts interface:port or :port for its argument.")
+	if c.GlobalString("http.s3-bucket") != "" {
+		config := s3.NewDefaultConfig()
+		config.Bucket = c.GlobalString("http.s3-bucket")
+
+		provider, err := s3.NewHTTPProviderConfig(config)
+		if err != nil {
+			fatalf(errorTypeUsage, "%v", err)
 		}
 
-		err = client.SetHTTPAddress(c.GlobalString("http"))
+		err = client.SetChallengeProvider(acme.HTTP01, provider)
 		if err != nil {
 			log.Fatal(err)
 		}
+
+		// --http.s3-bucket=foo indicates that the user specifically want to do a HTTP challenge
+		// infer that the user also wants to exclude all other challenges
+		client.ExcludeChallenges([]acme.Challenge{acme.DNS01, acme.TLSALPN01})
+	}
+	if httpFlag != "" {
+		err = client.SetHTTPAddress(c.GlobalString(httpFlag))
+		if err != nil {
+			fatalf(errorTypeUsage, "%v", err)
+		}
+	}
+	if c.GlobalString("http.socket") != "" {
+		err = client.SetHTTPSocket(c.GlobalString("http.socket"), os.FileMode(socketMode))
+		if err != nil {
+			fatalf(errorTypeUsage, "%v", err)
+		}
+	}
+	if c.GlobalString("http.proxy-header") != "" {
+		err = client.SetHTTPProxyHeader(c.GlobalString("http.proxy-header"))
+		if err != nil {
+			fatalf(errorTypeUsage, "The --http.proxy-header cannot be used with --http.webroot, --http.memcached-host or --http.s3-bucket: %v", err)
+		}
 	}
 
-	if c.GlobalIsSet("tls") {
-		if !strings.Contains(c.GlobalString("tls"), ":") {
-			log.Fatalf("The --tls switch only accepts interface:port or :port for its argument.")
+	if tlsFlag != "" {
+		err = client.SetTLSAddress(c.GlobalString(tlsFlag))
+		if err != nil {
+			fatalf(errorTypeUsage, "%v", err)
 		}
-		client.SetTLSAddress(c.GlobalString("tls"))
 	}
 
+	client.SetChallengeObserver(challenges)
+	client.SetDNSRequireAllNameservers(c.GlobalBool("dns.require-all-ns"))
+
 	if c.GlobalIsSet("dns") {
 		provider, err := dns.NewDNSChallengeProviderByName(c.GlobalString("dns"))
 		if err != nil {
-			log.Fatal(err)
+			fatalf(errorTypeUsage, "%v", err)
 		}
+		setManualWait(c, provider)
 
 		err = client.SetChallengeProvider(acme.DNS01, provider)
 		if err != nil {
@@ -143,87 +265,316 @@ func setup(c *cli.Context) (*Configuration, *Account, *acme.Client) {
 		client.ExcludeChallenges([]acme.Challenge{acme.HTTP01, acme.TLSALPN01})
 	}
 
-	if client.GetExternalAccountRequired() && !c.GlobalIsSet("eab") {
-		log.Fatal("Server requires External Account Binding. Use --eab with --kid and --hmac.")
+	if len(mapping) > 0 {
+		// a provider used for several domains is created once.
+		providers := make(map[string]acme.ChallengeProvider)
+		for domain, name := range mapping {
+			provider, ok := providers[name]
+			if !ok {
+				provider, err = dns.NewDNSChallengeProviderByName(name)
+				if err != nil {
+					fatalf(errorTypeUsage, "Could not create the DNS provider %s of %s: %v", name, domain, err)
+				}
+				setManualWait(c, provider)
+				providers[name] = provider
+			}
+			client.SetDNSProviderForDomain(domain, provider)
+		}
+
+		// like --dns, a mapping disables all other challenges.
+		client.ExcludeChallenges([]acme.Challenge{acme.HTTP01, acme.TLSALPN01})
+	}
+
+	// the External Account Binding is only used to register a new account.
+	switch {
+	case acc.Registration != nil:
+		if c.GlobalBool("eab") {
+			log.Printf("The account %s is already registered, ignoring --eab, --kid and --hmac.", acc.Email)
+		}
+	case c.GlobalBool("eab"):
+		if c.GlobalString("kid") == "" || c.GlobalString("hmac") == "" {
+			fatalf(errorTypeUsage, "Registering with External Account Binding requires --kid and --hmac (or LEGO_EAB_KID and LEGO_EAB_HMAC).")
+		}
+	case client.GetExternalAccountRequired():
+		fatalf(errorTypeExternalAccount, "Server requires External Account Binding to register the account. Use --eab with --kid and --hmac (or LEGO_EAB_KID and LEGO_EAB_HMAC), as given by the CA.")
 	}
 
 	return conf, acc, client
 }
 
-func saveCertRes(certRes *acme.CertificateResource, conf *Configuration) {
-	var domainName string
+// setManualWait sets the wait of --dns.manual-wait on the manual DNS provider.
+func setManualWait(c *cli.Context, provider acme.ChallengeProvider) {
+	manual, ok := provider.(*acme.DNSProviderManual)
+	if !ok || !c.GlobalIsSet("dns.manual-wait") {
+		return
+	}
+	if c.GlobalInt("dns.manual-wait") < 0 {
+		fatalf(errorTypeUsage, "The --dns.manual-wait cannot be negative.")
+	}
+	manual.SetWait(time.Duration(c.GlobalInt("dns.manual-wait")) * time.Second)
+}
+
+// setFlagName returns the name of the set flag, the flag or its former name,
+// e.g. the address of a challenge listener, or an empty string if none is set.
+func setFlagName(c *cli.Context, flag, formerFlag string) string {
+	switch {
+	case c.GlobalIsSet(flag):
+		return flag
+	case c.GlobalIsSet(formerFlag):
+		return formerFlag
+	default:
+		return ""
+	}
+}
+
+// checkListenAddress fails fast if the address of a challenge listener is invalid or cannot be bound,
+// rather than when the challenge is presented.
+func checkListenAddress(flag, address, caPort string) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || port == "" {
+		fatalf(errorTypeUsage, "The --%s switch only accepts host:port or :port for its argument, e.g. 127.0.0.1:8080 or [::1]:8888.", flag)
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		fatalf(errorTypeUsage, "Could not listen on %s (--%s): %v\n\tThe CA connects to the port %s of the domains: "+
+			"listen on an address of this host and a free port, which the port %s is forwarded to.", address, flag, err, caPort, caPort)
+	}
+	listener.Close()
+}
+
+// sanitizedDomain returns the domain usable in file names.
+// Internationalized domains are named after their A-label (punycode) form, like the certificates.
+// Make sure no funny chars are in the cert names (like wildcards ;) or the colons of IPv6 addresses).
+func sanitizedDomain(domain string) string {
+	if ascii, err := acme.DomainToASCII(domain); err == nil {
+		domain = ascii
+	}
+	return strings.NewReplacer("*", "_", ":", "-").Replace(domain)
+}
+
+// certFileName returns the name of the files of the certificate, without extension.
+func certFileName(certRes *acme.CertificateResource, conf *Configuration) string {
+	if name, ok := conf.certNames[certRes.Domain]; ok {
+		return name
+	}
+	return storedCertName(conf, certRes.Domain)
+}
+
+// nameSplitCerts names the files of the certificates of a split order after the first one:
+// example.com, example.com-1, example.com-2...
+func nameSplitCerts(certs []*acme.CertificateResource, conf *Configuration) {
+	if len(certs) < 2 {
+		return
+	}
+
+	name := certFileName(certs[0], conf)
+	conf.certNames = make(map[string]string)
+	for i, cert := range certs {
+		if i > 0 {
+			conf.certNames[cert.Domain] = fmt.Sprintf("%s-%d", name, i)
+		}
+	}
+}
 
+// storedCertName returns the name of the files of the certificate of the domain,
+// --filename if set.
+func storedCertName(conf *Configuration, domain string) string {
 	// Check filename cli parameter
 	if conf.context.GlobalString("filename") == "" {
-		// Make sure no funny chars are in the cert names (like wildcards ;))
-		domainName = strings.Replace(certRes.Domain, "*", "_", -1)
-	} else {
-		domainName = conf.context.GlobalString("filename")
+		return sanitizedDomain(domain)
 	}
+	return conf.context.GlobalString("filename")
+}
+
+// saveCertRes saves the files and the meta data of the certificate.
+// The failures to write a file are saveErrors.
+func saveCertRes(certRes *acme.CertificateResource, conf *Configuration) error {
+	domainName := certFileName(certRes, conf)
 
 	// We store the certificate, private key and metadata in different files
 	// as web servers would not be able to work with a combined file.
-	certOut := filepath.Join(conf.CertPath(), domainName+".crt")
-	privOut := filepath.Join(conf.CertPath(), domainName+".key")
-	pemOut := filepath.Join(conf.CertPath(), domainName+".pem")
-	metaOut := filepath.Join(conf.CertPath(), domainName+".json")
-	issuerOut := filepath.Join(conf.CertPath(), domainName+".issuer.crt")
+	store := conf.CertStorage()
 
-	err := checkFolder(filepath.Dir(certOut))
-	if err != nil {
-		log.Fatalf("Could not check/create path: %v", err)
+	var err error
+	certificate := certRes.Certificate
+	if conf.CertbotLayout() {
+		// like Certbot, fullchain.pem always has the issuer chain, and cert.pem only the leaf.
+		var leaf []byte
+		leaf, certificate, err = splitFullChain(certRes)
+		if err != nil {
+			return fmt.Errorf("Unable to parse Certificate for domain %s\n\t%v", certRes.Domain, err)
+		}
+
+		err = store.SaveResource(domainName, leafExt, leaf)
+		if err != nil {
+			return saveError{fmt.Errorf("Unable to save Certificate for domain %s\n\t%v", certRes.Domain, err)}
+		}
 	}
 
-	err = ioutil.WriteFile(certOut, certRes.Certificate, 0600)
+	err = store.SaveResource(domainName, certExt, certificate)
 	if err != nil {
-		log.Fatalf("Unable to save Certificate for domain %s\n\t%v", certRes.Domain, err)
+		return saveError{fmt.Errorf("Unable to save Certificate for domain %s\n\t%v", certRes.Domain, err)}
 	}
 
 	if certRes.IssuerCertificate != nil {
-		err = ioutil.WriteFile(issuerOut, certRes.IssuerCertificate, 0600)
+		err = store.SaveResource(domainName, issuerExt, certRes.IssuerCertificate)
 		if err != nil {
-			log.Fatalf("Unable to save IssuerCertificate for domain %s\n\t%v", certRes.Domain, err)
+			return saveError{fmt.Errorf("Unable to save IssuerCertificate for domain %s\n\t%v", certRes.Domain, err)}
 		}
 	}
 
 	if certRes.PrivateKey != nil {
-		// if we were given a CSR, we don't know the private key
-		err = ioutil.WriteFile(privOut, certRes.PrivateKey, 0600)
-		if err != nil {
-			log.Fatalf("Unable to save PrivateKey for domain %s\n\t%v", certRes.Domain, err)
+		// if we were given a CSR, we don't know the private key.
+		// A reused key is already stored.
+		if !certRes.ReuseKey {
+			err = store.SaveResource(domainName, keyExt, certRes.PrivateKey)
+			if err != nil {
+				return saveError{fmt.Errorf("Unable to save PrivateKey for domain %s\n\t%v", certRes.Domain, err)}
+			}
 		}
 
 		if conf.context.GlobalBool("pem") {
-			err = ioutil.WriteFile(pemOut, bytes.Join([][]byte{certRes.Certificate, certRes.PrivateKey}, nil), 0600)
+			pemData, errP := certRes.PEM()
+			if errP != nil {
+				return fmt.Errorf("Unable to encode the .pem for domain %s\n\t%v", certRes.Domain, errP)
+			}
+
+			err = store.SaveResource(domainName, pemExt, pemData)
 			if err != nil {
-				log.Fatalf("Unable to save Certificate and PrivateKey in .pem for domain %s\n\t%v", certRes.Domain, err)
+				return saveError{fmt.Errorf("Unable to save Certificate and PrivateKey in .pem for domain %s\n\t%v", certRes.Domain, err)}
+			}
+		}
+
+		if conf.context.GlobalBool("pfx") {
+			pfxData, errP := certRes.PKCS12(conf.context.GlobalString("pfx.pass"))
+			if errP != nil {
+				return fmt.Errorf("Unable to encode the .pfx for domain %s\n\t%v", certRes.Domain, errP)
+			}
+
+			err = store.SaveResource(domainName, pfxExt, pfxData)
+			if err != nil {
+				return saveError{fmt.Errorf("Unable to save Certificate and PrivateKey in .pfx for domain %s\n\t%v", certRes.Domain, err)}
 			}
 		}
 
 	} else if conf.context.GlobalBool("pem") {
 		// we don't have the private key; can't write the .pem file
-		log.Fatalf("Unable to save pem without private key for domain %s\n\t%v; are you using a CSR?", certRes.Domain, err)
+		return usageError{fmt.Errorf("Unable to save pem without private key for domain %s; are you using a CSR?", certRes.Domain)}
+	} else if conf.context.GlobalBool("pfx") {
+		// we don't have the private key; can't write the .pfx file
+		return usageError{fmt.Errorf("Unable to save pfx without private key for domain %s; are you using a CSR?", certRes.Domain)}
+	}
+
+	meta := certificateMeta{
+		Version:             certificateMetaVersion,
+		CertificateResource: certRes,
+		Server:              conf.context.GlobalString("server"),
+		Account:             conf.context.GlobalString("email"),
+		CSR:                 string(certRes.CSR),
+	}
+	jsonBytes, err := json.MarshalIndent(meta, "", "\t")
+	if err != nil {
+		return fmt.Errorf("Unable to marshal CertResource for domain %s\n\t%v", certRes.Domain, err)
+	}
+
+	err = store.SaveResource(domainName, metaExt, jsonBytes)
+	if err != nil {
+		return saveError{fmt.Errorf("Unable to save CertResource for domain %s\n\t%v", certRes.Domain, err)}
+	}
+	return nil
+}
+
+// certificateMetaVersion is the version of the meta data files written by lego.
+// The files of version 0 were written before the request of the certificate (key type, must staple, bundle, CSR) was stored.
+const certificateMetaVersion = 1
+
+// certificateMeta is the content of the meta data file of a certificate.
+type certificateMeta struct {
+	// Version is the version of the file, see certificateMetaVersion.
+	Version int `json:"version,omitempty"`
+
+	*acme.CertificateResource
+
+	// Server is the directory URL of the CA which issued the certificate.
+	Server string `json:"server,omitempty"`
+
+	// Account is the email of the account which obtained the certificate.
+	Account string `json:"account,omitempty"`
+
+	// CSR is the PEM encoding of the CSR of the certificate obtained with --csr.
+	CSR string `json:"csr,omitempty"`
+}
+
+// readCertificateMeta reads the meta data file of the certificate stored under name.
+func readCertificateMeta(conf *Configuration, name string) (certificateMeta, error) {
+	metaBytes, err := conf.CertStorage().LoadResource(name, metaExt)
+	if err != nil {
+		return certificateMeta{CertificateResource: &acme.CertificateResource{}}, err
+	}
+	return parseCertificateMeta(metaBytes)
+}
+
+// parseCertificateMeta parses the content of a meta data file, of any version up to certificateMetaVersion.
+func parseCertificateMeta(metaBytes []byte) (certificateMeta, error) {
+	meta := certificateMeta{CertificateResource: &acme.CertificateResource{}}
+
+	if err := json.Unmarshal(metaBytes, &meta); err != nil {
+		return meta, err
+	}
+	if meta.Version > certificateMetaVersion {
+		return meta, fmt.Errorf("the meta data version %d was written by a newer lego, the supported version is %d", meta.Version, certificateMetaVersion)
+	}
+	return meta, nil
+}
+
+// request returns the bundle and must staple options of the renewal of the certificate:
+// the options of its request, unless --no-bundle or --must-staple is set.
+// The flags are used for the files of version 0, which do not have them.
+func (m certificateMeta) request(c *cli.Context) (bundle, mustStaple bool) {
+	bundle, mustStaple = !c.Bool("no-bundle"), c.Bool("must-staple")
+	if m.Version == 0 {
+		return bundle, mustStaple
 	}
 
-	jsonBytes, err := json.MarshalIndent(certRes, "", "\t")
+	if !c.IsSet("no-bundle") {
+		bundle = m.Bundle
+	}
+	if !c.IsSet("must-staple") {
+		mustStaple = m.MustStaple
+	}
+	return bundle, mustStaple
+}
+
+// splitFullChain returns the leaf certificate, and the leaf followed by the issuer chain,
+// whether the certificate is a bundle or not.
+func splitFullChain(certRes *acme.CertificateResource) (leaf, fullChain []byte, err error) {
+	leafCert, err := certRes.Leaf()
 	if err != nil {
-		log.Fatalf("Unable to marshal CertResource for domain %s\n\t%v", certRes.Domain, err)
+		return nil, nil, err
 	}
 
-	err = ioutil.WriteFile(metaOut, jsonBytes, 0600)
+	chain, err := certRes.Chain()
 	if err != nil {
-		log.Fatalf("Unable to save CertResource for domain %s\n\t%v", certRes.Domain, err)
+		return nil, nil, err
+	}
+
+	leaf = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafCert.Raw})
+	fullChain = leaf
+	for _, cert := range chain {
+		fullChain = append(fullChain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
 	}
+	return leaf, fullChain, nil
 }
 
-func handleTOS(c *cli.Context, client *acme.Client) bool {
+func handleTOS(c *cli.Context, tosURL string) bool {
 	// Check for a global accept override
 	if c.GlobalBool("accept-tos") {
 		return true
 	}
 
 	reader := bufio.NewReader(os.Stdin)
-	log.Printf("Please review the TOS at %s", client.GetToSURL())
+	log.Printf("Please review the TOS at %s", tosURL)
 
 	for {
 		log.Println("Do you accept the TOS? Y/n")
@@ -235,7 +586,7 @@ func handleTOS(c *cli.Context, client *acme.Client) bool {
 		text = strings.Trim(text, "\r\n")
 
 		if text == "n" {
-			log.Fatal("You did not accept the TOS. Unable to proceed.")
+			fatalf(errorTypeTOS, "You did not accept the TOS. Unable to proceed.")
 		}
 
 		if text == "Y" || text == "y" || text == "" {
@@ -280,183 +631,849 @@ func readCSRFile(filename string) (*x509.CertificateRequest, error) {
 func run(c *cli.Context) error {
 	var err error
 
+	startReport(c.GlobalBool("json"), "run")
+	batch := readBatch(c)
+
 	conf, acc, client := setup(c)
 	if acc.Registration == nil {
-		accepted := handleTOS(c, client)
-		if !accepted {
-			log.Fatal("You did not accept the TOS. Unable to proceed.")
-		}
-
-		var reg *acme.RegistrationResource
-
-		if c.GlobalBool("eab") {
-			kid := c.GlobalString("kid")
-			hmacEncoded := c.GlobalString("hmac")
-
-			if kid == "" || hmacEncoded == "" {
-				log.Fatalf("Requires arguments --kid and --hmac.")
-			}
-
-			reg, err = client.RegisterWithExternalAccountBinding(
-				accepted,
-				kid,
-				hmacEncoded,
-			)
-		} else {
-			reg, err = client.Register(accepted)
-		}
-
-		if err != nil {
-			log.Fatalf("Could not complete registration\n\t%v", err)
-		}
-
-		acc.Registration = reg
-		acc.Save()
+		register(c, conf, acc, client)
+	}
+	tosAgreedURL := acc.Registration.TOSAgreedURL
 
-		log.Print("!!!! HEADS UP !!!!")
-		log.Printf(`
-		Your account credentials have been saved in your Let's Encrypt
-		configuration directory at "%s".
-		You should make a secure backup	of this folder now. This
-		configuration directory will also contain certificates and
-		private keys obtained from Let's Encrypt so making regular
-		backups of this folder is ideal.`, conf.AccountPath(c.GlobalString("email")))
+	orderOptions, err := parseOrderOptions(c)
+	if err != nil {
+		fatalf(errorTypeUsage, "%v", err)
+	}
 
+	if batch != nil {
+		runBatch(c, conf, acc, "run-hook", batch, func(ctx context.Context, domains []string) (*acme.CertificateResource, error) {
+			return client.ObtainCertificateWithOptions(ctx, domains, !c.Bool("no-bundle"), nil, c.Bool("must-staple"), orderOptions)
+		})
+		return nil
 	}
 
 	// we require either domains or csr, but not both
 	hasDomains := len(c.GlobalStringSlice("domains")) > 0
 	hasCsr := len(c.GlobalString("csr")) > 0
 	if hasDomains && hasCsr {
-		log.Fatal("Please specify either --domains/-d or --csr/-c, but not both")
+		fatalf(errorTypeUsage, "Please specify either --domains/-d or --csr/-c, but not both")
 	}
 	if !hasDomains && !hasCsr {
-		log.Fatal("Please specify --domains/-d (or --csr/-c if you already have a CSR)")
+		fatalf(errorTypeUsage, "Please specify --domains/-d or --domains-file (or --csr/-c if you already have a CSR)")
+	}
+	if hasCsr && c.GlobalBool("pem") {
+		fatalf(errorTypeUsage, "Unable to generate a .pem file for a CSR: the private key is unknown")
+	}
+	if hasCsr && c.GlobalBool("pfx") {
+		fatalf(errorTypeUsage, "Unable to generate a .pfx file for a CSR: the private key is unknown")
 	}
 
-	var cert *acme.CertificateResource
+	var certs []*acme.CertificateResource
 
+	ctx, cancel := conf.CertContext(context.Background())
+	defer cancel()
+
+	var domain string
 	if hasDomains {
-		// obtain a certificate, generating a new private key
-		cert, err = client.ObtainCertificate(c.GlobalStringSlice("domains"), !c.Bool("no-bundle"), nil, c.Bool("must-staple"))
+		domain = c.GlobalStringSlice("domains")[0]
+
+		// obtain the certificates, generating new private keys; several with --split-san if there are too many domains.
+		orderOptions.SplitLargeOrders = c.Bool("split-san")
+		certs, err = client.ObtainCertificatesWithOptions(ctx, c.GlobalStringSlice("domains"), !c.Bool("no-bundle"), nil, c.Bool("must-staple"), orderOptions)
 	} else {
 		// read the CSR
 		var csr *x509.CertificateRequest
 		csr, err = readCSRFile(c.GlobalString("csr"))
 		if err == nil {
+			domain = csr.Subject.CommonName
+
 			// obtain a certificate for this CSR
-			cert, err = client.ObtainCertificateForCSR(*csr, !c.Bool("no-bundle"))
+			var cert *acme.CertificateResource
+			cert, err = client.ObtainCertificateForCSRWithOptions(ctx, *csr, !c.Bool("no-bundle"), orderOptions)
+			if err == nil {
+				certs = []*acme.CertificateResource{cert}
+			}
 		}
 	}
 
-	if err != nil {
-		// Make sure to return a non-zero exit code if ObtainSANCertificate
-		// returned at least one error. Due to us not returning partial
-		// certificate we can just exit here instead of at the end.
-		log.Fatalf("Could not obtain certificates\n\t%v", err)
+	var tooManyErr acme.TooManyIdentifiersError
+	if errors.As(err, &tooManyErr) && !c.Bool("split-san") {
+		log.Printf("[%s] The CA accepts at most %d domains per certificate, use --split-san to obtain several certificates", domain, tooManyErr.Max)
+	}
+
+	// Make sure to return a non-zero exit code if ObtainSANCertificate
+	// returned at least one error. We do not save partial certificates,
+	// only the certificates of the parts of a split order obtained before the error.
+	if err != nil && len(certs) == 0 {
+		fatalCertError(ctx, domain, fmt.Errorf("Could not obtain certificates\n\t%w", err))
 	}
+	obtainErr := err
+
+	if err = conf.CertStorage().Check(); err != nil {
+		fatalf(errorTypeStorage, "Could not use the certificate storage: %v", err)
+	}
+
+	nameSplitCerts(certs, conf)
 
-	if err = checkFolder(conf.CertPath()); err != nil {
-		log.Fatalf("Could not check/create path: %v", err)
+	var revokedErr error
+	for _, cert := range certs {
+		if err := saveCertRes(cert, conf); err != nil {
+			fatalCertError(context.Background(), cert.Domain, err)
+		}
+		if err := refreshOCSPFlag(c, conf, cert, true); err != nil && revokedErr == nil {
+			revokedErr = err
+		}
+		runCertHook(c, "run-hook", cert, conf)
+
+		reportCertificate(domainResult{Domain: cert.Domain}, cert, conf)
 	}
+	saveTOSAgreement(acc, tosAgreedURL)
 
-	saveCertRes(cert, conf)
+	if obtainErr != nil {
+		fatalCertError(ctx, domain, fmt.Errorf("Could not obtain certificates\n\t%w", obtainErr))
+	}
+	if revokedErr != nil {
+		fatalCertError(context.Background(), domain, revokedErr)
+	}
+	writeReport()
 
 	return nil
 }
 
+// register registers the account, once the user accepted the TOS.
+func register(c *cli.Context, conf *Configuration, acc *Account, client *acme.Client) {
+	accepted := handleTOS(c, client.GetToSURL())
+	if !accepted {
+		fatalf(errorTypeTOS, "You did not accept the TOS. Unable to proceed.")
+	}
+
+	var err error
+	var reg *acme.RegistrationResource
+
+	if c.GlobalBool("eab") {
+		kid := c.GlobalString("kid")
+		hmacEncoded := c.GlobalString("hmac")
+
+		reg, err = client.RegisterWithExternalAccountBinding(
+			accepted,
+			kid,
+			hmacEncoded,
+		)
+	} else {
+		reg, err = client.Register(accepted)
+	}
+
+	if err != nil {
+		fatalErr(errorTypeAccount, err, "Could not complete registration\n\t%v", err)
+	}
+
+	acc.Registration = reg
+	acc.Save()
+
+	log.Print("!!!! HEADS UP !!!!")
+	log.Printf(`
+		Your account credentials have been saved in your Let's Encrypt
+		configuration directory at "%s".
+		You should make a secure backup	of this folder now. This
+		configuration directory will also contain certificates and
+		private keys obtained from Let's Encrypt so making regular
+		backups of this folder is ideal.`, conf.AccountPath(c.GlobalString("email")))
+}
+
+// fatalCertError exits with the error of the certificate of the domain, once it was reported with --json.
+// The exit code is the one of the type of the error, exitCodeNetwork if the operation did not finish within --cert.timeout.
+func fatalCertError(ctx context.Context, domain string, err error) {
+	reportError(ctx, domain, err)
+
+	errType := errorType(ctx, err)
+	if errType == errorTypeTimeout {
+		log.Printf("The certificate could not be obtained within --cert.timeout, try again later: %v", err)
+	} else {
+		log.Print(err)
+	}
+	exit(exitCode(errType))
+}
+
+// parseOrderOptions returns the order options of the run and renew commands.
+func parseOrderOptions(c *cli.Context) (acme.OrderOptions, error) {
+	opts := acme.OrderOptions{Profile: c.String("profile")}
+
+	var err error
+	now := time.Now()
+	if opts.NotBefore, err = parseOrderTime(c.String("not-before"), now); err != nil {
+		return opts, fmt.Errorf("Invalid --not-before: %v", err)
+	}
+	if opts.NotAfter, err = parseOrderTime(c.String("not-after"), now); err != nil {
+		return opts, fmt.Errorf("Invalid --not-after: %v", err)
+	}
+	return opts, nil
+}
+
+// parseOrderTime parses a time in RFC 3339 format, or a duration from now starting with "+".
+// The zero time is returned for an empty value.
+func parseOrderTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if strings.HasPrefix(value, "+") {
+		d, err := time.ParseDuration(value[1:])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// saveTOSAgreement saves the account if the user agreed to new TOS while running the command.
+func saveTOSAgreement(acc *Account, tosAgreedURL string) {
+	if acc.Registration.TOSAgreedURL == tosAgreedURL {
+		return
+	}
+	if err := acc.Save(); err != nil {
+		fatalf(errorTypeSave, "Could not save the account: %v", err)
+	}
+}
+
 func revoke(c *cli.Context) error {
+	startReport(c.GlobalBool("json"), "revoke")
+
 	conf, acc, client := setup(c)
 	if acc.Registration == nil {
-		log.Fatalf("Account %s is not registered. Use 'run' to register a new account.\n", acc.Email)
+		fatalf(errorTypeAccount, "Account %s is not registered. Use 'run' to register a new account.", acc.Email)
+	}
+
+	if err := conf.CertStorage().Check(); err != nil {
+		fatalf(errorTypeStorage, "Could not use the certificate storage: %v", err)
 	}
 
-	if err := checkFolder(conf.CertPath()); err != nil {
-		log.Fatalf("Could not check/create path: %v", err)
+	var reason uint
+	if c.IsSet("reason") {
+		var err error
+		reason, err = parseRevocationReason(c.String("reason"))
+		if err != nil {
+			fatalf(errorTypeUsage, "%v", err)
+		}
+	}
+
+	var privKey crypto.PrivateKey
+	if c.IsSet("priv-key") {
+		if !c.IsSet("reason") {
+			fatalf(errorTypeUsage, "Revoking a certificate with its private key requires --reason.")
+		}
+
+		var err error
+		privKey, err = loadPrivateKey(c.String("priv-key"))
+		if err != nil {
+			log.Fatalf("Could not load the private key from file %s: %v", c.String("priv-key"), err)
+		}
 	}
 
 	for _, domain := range c.GlobalStringSlice("domains") {
 		log.Printf("Trying to revoke certificate for domain %s", domain)
 
-		certPath := filepath.Join(conf.CertPath(), domain+".crt")
-		certBytes, err := ioutil.ReadFile(certPath)
+		name := storedCertName(conf, domain)
+		certBytes, err := conf.CertStorage().LoadResource(name, certExt)
 		if err != nil {
 			log.Println(err)
 		}
 
-		err = client.RevokeCertificate(certBytes)
+		switch {
+		case c.IsSet("priv-key"):
+			err = client.RevokeCertificateWithKey(certBytes, reason, privKey)
+		case c.IsSet("reason"):
+			err = client.RevokeCertificateWithReason(certBytes, reason)
+		default:
+			err = client.RevokeCertificate(certBytes)
+		}
 		if err != nil {
-			log.Fatalf("Error while revoking the certificate for domain %s\n\t%v", domain, err)
+			fatalCertError(context.Background(), domain, fmt.Errorf("Error while revoking the certificate for domain %s\n\t%w", domain, err))
 		} else {
 			log.Println("Certificate was revoked.")
 		}
+
+		// the key of the certificate is not reported, as it must not be used anymore.
+		certRes := &acme.CertificateResource{Domain: domain, Certificate: certBytes}
+		if c.Bool("keep") {
+			reportCertificate(domainResult{Domain: domain, Revoked: true}, certRes, conf)
+			continue
+		}
+
+		// the revoked certificate is moved aside so that it is not renewed by the next renew.
+		moved, err := moveCertFilesAside(conf.CertStorage(), name, ".revoked")
+		if err != nil {
+			log.Fatalf("The certificate was revoked, but its files could not be renamed: %v", err)
+		}
+		for _, ext := range moved {
+			log.Printf("Moved %s to %s", conf.CertStorage().Location(name, ext), conf.CertStorage().Location(name, ext+".revoked"))
+		}
+		reportCertificate(domainResult{Domain: domain, Revoked: true, CertPath: conf.CertStorage().Location(name, certExt+".revoked")}, certRes, conf)
 	}
 
+	writeReport()
 	return nil
 }
 
+// moveCertFilesAside renames the files of the certificate with their extension suffixed,
+// and returns the extensions of the files which were renamed.
+func moveCertFilesAside(store CertStorage, domainName, suffix string) ([]string, error) {
+	var moved []string
+	for _, ext := range []string{certExt, leafExt, issuerExt, keyExt, pemExt, pfxExt, metaExt, ocspExt} {
+		data, err := store.LoadResource(domainName, ext)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return moved, err
+		}
+
+		if err := store.SaveResource(domainName, ext+suffix, data); err != nil {
+			return moved, err
+		}
+		if err := store.DeleteResource(domainName, ext); err != nil {
+			return moved, err
+		}
+		moved = append(moved, ext)
+	}
+	return moved, nil
+}
+
+// parseRevocationReason parses a revocation reason given as a code or a name.
+func parseRevocationReason(value string) (uint, error) {
+	if code, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return uint(code), nil
+	}
+
+	switch strings.ToLower(value) {
+	case "unspecified":
+		return acme.RevocationReasonUnspecified, nil
+	case "keycompromise":
+		return acme.RevocationReasonKeyCompromise, nil
+	case "cacompromise":
+		return acme.RevocationReasonCACompromise, nil
+	case "affiliationchanged":
+		return acme.RevocationReasonAffiliationChanged, nil
+	case "superseded":
+		return acme.RevocationReasonSuperseded, nil
+	case "cessationofoperation":
+		return acme.RevocationReasonCessationOfOperation, nil
+	case "certificatehold":
+		return acme.RevocationReasonCertificateHold, nil
+	case "removefromcrl":
+		return acme.RevocationReasonRemoveFromCRL, nil
+	case "privilegewithdrawn":
+		return acme.RevocationReasonPrivilegeWithdrawn, nil
+	case "aacompromise":
+		return acme.RevocationReasonAACompromise, nil
+	}
+
+	return 0, fmt.Errorf("Unsupported revocation reason: %s", value)
+}
+
 func renew(c *cli.Context) error {
+	startReport(c.GlobalBool("json"), "renew")
+	batch := readBatch(c)
+
+	// without --server and --email, a certificate is renewed by the CA and the account which obtained it.
+	if batch == nil && len(c.GlobalStringSlice("domains")) > 0 {
+		name := storedCertName(NewConfiguration(c), c.GlobalStringSlice("domains")[0])
+		if meta, err := readCertificateMeta(NewConfiguration(c), name); err == nil {
+			if !c.GlobalIsSet("server") && meta.Server != "" && meta.Server != c.GlobalString("server") {
+				log.Printf("Renewing with the server %s which issued the certificate.", meta.Server)
+				if err := c.GlobalSet("server", meta.Server); err != nil {
+					log.Fatal(err)
+				}
+			}
+			if !c.GlobalIsSet("email") && meta.Account != "" {
+				log.Printf("Renewing with the account %s which obtained the certificate.", meta.Account)
+				if err := c.GlobalSet("email", meta.Account); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+	}
+
 	conf, acc, client := setup(c)
 	if acc.Registration == nil {
-		log.Fatalf("Account %s is not registered. Use 'run' to register a new account.\n", acc.Email)
+		fatalf(errorTypeAccount, "Account %s is not registered. Use 'run' to register a new account.", acc.Email)
+	}
+
+	orderOptions, err := parseOrderOptions(c)
+	if err != nil {
+		fatalf(errorTypeUsage, "%v", err)
+	}
+
+	if c.Bool("ari-wait-to-renew") {
+		names := batch
+		if names == nil {
+			if len(c.GlobalStringSlice("domains")) <= 0 {
+				fatalf(errorTypeUsage, "Please specify at least one domain, or --domains-file.")
+			}
+			names = [][]string{c.GlobalStringSlice("domains")}
+		}
+		printRenewalWindows(conf, client, names)
+		writeReport()
+		return nil
+	}
+
+	if batch != nil {
+		runBatch(c, conf, acc, "renew-hook", batch, func(ctx context.Context, domains []string) (*acme.CertificateResource, error) {
+			return renewOrObtain(ctx, c, conf, client, domains, orderOptions)
+		})
+		return nil
 	}
 
 	if len(c.GlobalStringSlice("domains")) <= 0 {
-		log.Fatal("Please specify at least one domain.")
+		fatalf(errorTypeUsage, "Please specify at least one domain, or --domains-file.")
 	}
 
-	domain := c.GlobalStringSlice("domains")[0]
-	domain = strings.Replace(domain, "*", "_", -1)
+	mainDomain := c.GlobalStringSlice("domains")[0]
+
+	tosAgreedURL := acc.Registration.TOSAgreedURL
 
+	ctx, cancel := conf.CertContext(context.Background())
+	defer cancel()
+
+	newCert, err := renewOrObtain(ctx, c, conf, client, c.GlobalStringSlice("domains"), orderOptions)
+	if err != nil {
+		fatalCertError(ctx, mainDomain, err)
+	}
+	if newCert == nil {
+		name := storedCertName(conf, mainDomain)
+		reportSkipped(conf, name, mainDomain)
+		if err := refreshStoredOCSPFlag(c, conf, name, mainDomain); err != nil {
+			fatalCertError(context.Background(), mainDomain, err)
+		}
+		writeReport()
+		return nil
+	}
+
+	if err := saveCertRes(newCert, conf); err != nil {
+		fatalCertError(context.Background(), mainDomain, err)
+	}
+	saveTOSAgreement(acc, tosAgreedURL)
+	revokedErr := refreshOCSPFlag(c, conf, newCert, true)
+	runCertHook(c, "renew-hook", newCert, conf)
+
+	reportCertificate(domainResult{Domain: mainDomain}, newCert, conf)
+	if revokedErr != nil {
+		fatalCertError(context.Background(), mainDomain, revokedErr)
+	}
+	writeReport()
+
+	return nil
+}
+
+// renewOrObtain renews the stored certificate of the domains with the options of the renew command,
+// or obtains it if it is missing or corrupt.
+// It returns a nil certificate if the renewal was skipped.
+func renewOrObtain(ctx context.Context, c *cli.Context, conf *Configuration, client *acme.Client, domains []string, orderOptions acme.OrderOptions) (*acme.CertificateResource, error) {
+	domain := sanitizedDomain(domains[0])
+
+	name := storedCertName(conf, domains[0])
+	if _, err := loadStoredCertificate(conf, name); err != nil {
+		// A missing or corrupt certificate is obtained again for the given domains.
+		log.Printf("[%s] Could not load the certificate, obtaining a new one: %v", domain, err)
+		return client.ObtainCertificateWithOptions(ctx, domains, !c.Bool("no-bundle"), nil, c.Bool("must-staple"), orderOptions)
+	}
+
+	return renewStoredCertificate(ctx, c, conf, client, name, domain, orderOptions)
+}
+
+// loadStoredCertificate reads and checks the certificate stored under name.
+func loadStoredCertificate(conf *Configuration, name string) ([]byte, error) {
+	certBytes, err := conf.CertStorage().LoadResource(name, certExt)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = acme.ParsePEMBundle(certBytes); err != nil {
+		return nil, err
+	}
+	return certBytes, nil
+}
+
+// renewStoredCertificate renews the certificate stored under name with the options of the renew command,
+// if it is forced or if it expires within --days.
+// It returns a nil certificate if the renewal was skipped.
+func renewStoredCertificate(ctx context.Context, c *cli.Context, conf *Configuration, client *acme.Client, name, domain string, orderOptions acme.OrderOptions) (*acme.CertificateResource, error) {
 	// load the cert resource from files.
 	// We store the certificate, private key and metadata in different files
 	// as web servers would not be able to work with a combined file.
-	certPath := filepath.Join(conf.CertPath(), domain+".crt")
-	privPath := filepath.Join(conf.CertPath(), domain+".key")
-	metaPath := filepath.Join(conf.CertPath(), domain+".json")
+	certBytes, err := loadStoredCertificate(conf, name)
+	if err != nil {
+		return nil, err
+	}
 
-	certBytes, err := ioutil.ReadFile(certPath)
+	if c.Bool("force") || c.Int("days") == 0 {
+		log.Printf("[%s] Renewing: forced", domain)
+	} else {
+		renew, reason, err := acme.NeedsRenewal(certBytes, c.Int("days"), c.Bool("check-ocsp"))
+		if err == nil && !renew && c.Bool("ari-enable") {
+			renew, reason = renewalWindowStarted(ctx, client, certBytes, domain, reason)
+		}
+		switch {
+		case err != nil:
+			log.Printf("Could not get Certification expiration for domain %s: %v", domain, err)
+		case !renew:
+			log.Printf("[%s] Skipping the renewal: %s", domain, reason)
+			return nil, nil
+		default:
+			log.Printf("[%s] Renewing: %s", domain, reason)
+		}
+	}
+
+	// The domains of the renewal are the ones of the certificate, or of its CSR,
+	// the metadata holds the options of its order and its request.
+	certRes := acme.CertificateResource{Domain: domain}
+	meta, err := readCertificateMeta(conf, name)
 	if err != nil {
-		log.Fatalf("Error while loading the certificate for domain %s\n\t%v", domain, err)
+		log.Printf("[%s] Could not load the meta data, renewing without: %v", domain, err)
+		meta = certificateMeta{CertificateResource: &acme.CertificateResource{}}
+	} else {
+		certRes = *meta.CertificateResource
+		if meta.Server != "" && meta.Server != c.GlobalString("server") {
+			log.Warnf("[%s] The certificate was issued by %s, renewing it with %s", domain, meta.Server, c.GlobalString("server"))
+		}
 	}
+	certRes.CSR = []byte(meta.CSR)
+	bundle, mustStaple := meta.request(c)
+
+	// --key-type replaces the key type of the certificate.
+	if c.GlobalIsSet("key-type") {
+		certRes.KeyType = ""
+	}
+
+	// once reused, the key is kept by the next renewals, unless --new-key is set.
+	certRes.ReuseKey = (c.Bool("reuse-key") || certRes.ReuseKey) && !c.Bool("new-key")
+	if certRes.ReuseKey {
+		if !c.Bool("reuse-key") {
+			log.Printf("[%s] Reusing the private key, like the previous renewals", domain)
+		}
 
-	if c.IsSet("days") {
-		expTime, err := acme.GetPEMCertExpiration(certBytes)
+		keyBytes, err := loadReusedKey(c, conf, name)
 		if err != nil {
-			log.Printf("Could not get Certification expiration for domain %s", domain)
+			return nil, fmt.Errorf("Error while loading the private key for domain %s\n\t%w", domain, err)
 		}
+		certRes.PrivateKey = keyBytes
+	}
 
-		if int(time.Until(expTime).Hours()/24.0) > c.Int("days") {
-			return nil
+	certRes.Certificate = certBytes
+
+	if orderOptions.Profile == "" {
+		orderOptions.Profile = certRes.Profile
+	}
+	if c.Bool("ari-enable") && client.SupportsRenewalInfo() {
+		certID, err := storedCertificateID(certBytes)
+		if err != nil {
+			log.Warnf("[%s] The new certificate does not replace the stored one for the CA: %v", domain, err)
 		}
+		orderOptions.Replaces = certID
 	}
 
-	metaBytes, err := ioutil.ReadFile(metaPath)
+	return client.RenewCertificateWithOptions(ctx, certRes, bundle, mustStaple, orderOptions)
+}
+
+// ariNotSupported logs once that --ari-enable is ignored, for all the certificates of a batch.
+var ariNotSupported sync.Once
+
+// renewalWindowStarted returns true if the renewal window suggested by the CA for the certificate has started,
+// with the reason of the renewal or of its skipping.
+// The certificate is not renewed if its renewal information is missing, the --days decision given by reason is kept.
+func renewalWindowStarted(ctx context.Context, client *acme.Client, certBytes []byte, domain, reason string) (bool, string) {
+	info, err := client.GetRenewalInfo(ctx, certBytes)
+	switch {
+	case errors.Is(err, acme.ErrRenewalInfoNotSupported):
+		ariNotSupported.Do(func() {
+			log.Printf("The CA does not support ACME Renewal Information, ignoring --ari-enable")
+		})
+		return false, reason
+	case err != nil:
+		log.Warnf("[%s] Could not get the renewal information, only using --days: %v", domain, err)
+		return false, reason
+	}
+
+	if info.ShouldRenew(time.Now()) {
+		return true, fmt.Sprintf("the renewal window suggested by the CA opened on %s", info.WindowStart.Format(time.RFC3339))
+	}
+	return false, fmt.Sprintf("%s, and the renewal window suggested by the CA opens on %s", reason, info.WindowStart.Format(time.RFC3339))
+}
+
+// storedCertificateID returns the CertificateID of the leaf of the stored certificate, replaced by its renewal.
+func storedCertificateID(certBytes []byte) (string, error) {
+	certificates, err := acme.ParsePEMBundle(certBytes)
 	if err != nil {
-		log.Fatalf("Error while loading the meta data for domain %s\n\t%v", domain, err)
+		return "", err
 	}
+	return acme.CertificateID(certificates[0])
+}
 
-	var certRes acme.CertificateResource
-	if err := json.Unmarshal(metaBytes, &certRes); err != nil {
-		log.Fatalf("Error while marshalling the meta data for domain %s\n\t%v", domain, err)
+// printRenewalWindows logs the renewal windows suggested by the CA for the stored certificates, for --ari-wait-to-renew.
+func printRenewalWindows(conf *Configuration, client *acme.Client, certificates [][]string) {
+	if !client.SupportsRenewalInfo() {
+		log.Printf("The CA does not support ACME Renewal Information, no renewal window to print")
+		return
 	}
 
-	if c.Bool("reuse-key") {
-		keyBytes, err := ioutil.ReadFile(privPath)
+	for _, domains := range certificates {
+		domain := sanitizedDomain(domains[0])
+		certBytes, err := loadStoredCertificate(conf, storedCertName(conf, domains[0]))
 		if err != nil {
-			log.Fatalf("Error while loading the private key for domain %s\n\t%v", domain, err)
+			log.Errorf("[%s] Could not load the certificate: %v", domain, err)
+			continue
+		}
+
+		ctx, cancel := conf.CertContext(context.Background())
+		info, err := client.GetRenewalInfo(ctx, certBytes)
+		cancel()
+		if err != nil {
+			log.Errorf("[%s] Could not get the renewal information: %v", domain, err)
+			continue
+		}
+
+		now := time.Now()
+		start, end := info.WindowStart.Format(time.RFC3339), info.WindowEnd.Format(time.RFC3339)
+		if info.ShouldRenew(now) {
+			log.Printf("[%s] The renewal window suggested by the CA is open, from %s to %s", domain, start, end)
+		} else {
+			log.Printf("[%s] The renewal window suggested by the CA opens on %s (in %s), until %s",
+				domain, start, info.WindowStart.Sub(now).Round(time.Minute), end)
+		}
+		if info.ExplanationURL != "" {
+			log.Printf("[%s] The CA explains the window at %s", domain, info.ExplanationURL)
 		}
-		certRes.PrivateKey = keyBytes
 	}
+}
 
-	certRes.Certificate = certBytes
+// loadReusedKey reads the private key stored under name, for a renewal keeping it.
+// If --key-type is set, the key must have this type.
+func loadReusedKey(c *cli.Context, conf *Configuration, name string) ([]byte, error) {
+	keyBytes, err := conf.CertStorage().LoadResource(name, keyExt)
+	if err != nil {
+		return nil, err
+	}
+	if !c.GlobalIsSet("key-type") {
+		return keyBytes, nil
+	}
+
+	privateKey, err := parsePrivateKey(keyBytes)
+	if err != nil {
+		return nil, err
+	}
+	storedType, err := privateKeyType(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	keyType, err := conf.KeyType()
+	if err != nil {
+		return nil, usageError{err}
+	}
+
+	if storedType != keyType {
+		return nil, usageError{fmt.Errorf("the stored private key does not have the type %s of --key-type: "+
+			"remove --key-type to keep the key, or use --new-key to replace it", c.GlobalString("key-type"))}
+	}
+	return keyBytes, nil
+}
+
+func rollover(c *cli.Context) error {
+	conf, acc, client := setup(c)
+	if acc.Registration == nil {
+		fatalf(errorTypeAccount, "Account %s is not registered. Use 'run' to register a new account.", acc.Email)
+	}
+
+	keyType, err := parseKeyType(c.String("new-key-type"))
+	if err != nil {
+		fatalf(errorTypeUsage, "%v", err)
+	}
 
-	newCert, err := client.RenewCertificate(certRes, !c.Bool("no-bundle"), c.Bool("must-staple"))
+	newKey, err := acme.GeneratePrivateKey(keyType)
 	if err != nil {
-		log.Fatal(err)
+		fatalf(errorTypeOther, "Could not generate the new account key: %v", err)
+	}
+
+	// Save the new key before the rollover, so that it cannot be lost.
+	accountStorage, server := conf.AccountStorage(), c.GlobalString("server")
+	if err = accountStorage.SaveNewKey(server, acc.Email, newKey); err != nil {
+		fatalf(errorTypeSave, "Could not save the new account key: %v", err)
+	}
+
+	if _, err = client.ChangeAccountKey(newKey); err != nil {
+		accountStorage.RemoveNewKey(server, acc.Email)
+
+		if conflictErr, ok := err.(acme.KeyConflictError); ok {
+			fatalf(errorTypeAccount, "The new account key is already used by the account %s: %v", conflictErr.AccountURL, err)
+		}
+		fatalErr(errorTypeAccount, err, "Could not change the account key: %v", err)
+	}
+
+	if err = accountStorage.ReplaceKey(server, acc.Email); err != nil {
+		fatalf(errorTypeSave, "The account key was changed, but %v", err)
+	}
+
+	log.Printf("The account key was changed. The old key was moved to %s", conf.AccountKeyPath(acc.Email)+".old")
+
+	return nil
+}
+
+func deactivate(c *cli.Context) error {
+	conf, acc, client := setup(c)
+	if acc.Registration == nil {
+		fatalf(errorTypeAccount, "Account %s is not registered. Use 'run' to register a new account.", acc.Email)
+	}
+
+	if err := client.DeactivateAccount(); err != nil {
+		fatalErr(errorTypeAccount, err, "Could not deactivate the account %s: %v", acc.Email, err)
+	}
+
+	if err := conf.AccountStorage().ArchiveAccount(c.GlobalString("server"), acc.Email); err != nil {
+		fatalf(errorTypeSave, "The account was deactivated, but %v", err)
 	}
 
-	saveCertRes(newCert, conf)
+	log.Printf("The account %s was deactivated.", acc.Email)
 
 	return nil
 }
+
+func listOrders(c *cli.Context) error {
+	_, acc, client := setup(c)
+	if acc.Registration == nil {
+		fatalf(errorTypeAccount, "Account %s is not registered. Use 'run' to register a new account.", acc.Email)
+	}
+
+	orderURLs, err := client.GetOrderURLs()
+	if err == acme.ErrOrdersNotSupported {
+		fatalf(errorTypeOther, "Listing the orders is not supported by this CA.")
+	}
+	if err != nil {
+		fatalErr(errorTypeAccount, err, "Could not list the orders of the account %s: %v", acc.Email, err)
+	}
+
+	if len(orderURLs) == 0 {
+		log.Printf("The account %s has no orders.", acc.Email)
+		return nil
+	}
+
+	for _, orderURL := range orderURLs {
+		order, err := client.GetOrder(orderURL)
+		if err != nil {
+			fatalErr(errorTypeOther, err, "Could not get the order %s: %v", orderURL, err)
+		}
+
+		log.Printf("[%s] %s: %s (expires: %s)", strings.Join(order.Identifiers, ", "), order.URL, order.Status, order.Expires)
+
+		if !c.Bool("deactivate-pending") {
+			continue
+		}
+
+		deactivated, err := client.DeactivatePendingAuthorizations(order)
+		for _, authzURL := range deactivated {
+			log.Printf("\tDeactivated the pending authorization %s", authzURL)
+		}
+		if err != nil {
+			fatalErr(errorTypeOther, err, "Could not deactivate the pending authorizations of the order %s: %v", orderURL, err)
+		}
+	}
+
+	return nil
+}
+
+func dnsCleanup(c *cli.Context) error {
+	names := c.String("dns")
+	if names == "" {
+		names = c.GlobalString("dns")
+	}
+	domains := c.StringSlice("domains")
+	if len(domains) == 0 {
+		domains = c.GlobalStringSlice("domains")
+	}
+	if names == "" || len(domains) == 0 {
+		fatalf(errorTypeUsage, "Cleaning up the challenge records requires --dns and --domains.")
+	}
+
+	// the providers find the zones to sweep with the resolvers of --dns.resolvers.
+	setupDNS(c)
+
+	opts := acme.SweepOptions{OlderThan: c.Duration("older-than"), DryRun: c.Bool("dry-run")}
+
+	var failed bool
+	for _, name := range strings.Split(names, ",") {
+		provider, err := dns.NewDNSChallengeProviderByName(name)
+		if err != nil {
+			fatalf(errorTypeUsage, "%v", err)
+		}
+		lister, ok := provider.(acme.ChallengeProviderLister)
+		if !ok {
+			fatalf(errorTypeUsage, "The DNS provider %s cannot list its records.", name)
+		}
+
+		for _, domain := range domains {
+			records, err := acme.SweepChallengeRecords(lister, domain, opts)
+			if opts.DryRun {
+				for _, record := range records {
+					log.Printf("[%s] Would remove the challenge record %s %q", domain, record.FQDN, record.Value)
+				}
+			}
+			if err != nil {
+				log.Printf("Could not clean up the challenge records of %s with %s: %v", domain, name, err)
+				failed = true
+				continue
+			}
+			if len(records) == 0 {
+				log.Printf("[%s] No orphaned challenge record with %s.", domain, name)
+			}
+		}
+	}
+
+	if failed {
+		log.Fatal("Some challenge records could not be cleaned up.")
+	}
+	return nil
+}
+
+func dnsCheck(c *cli.Context) error {
+	names := c.String("dns")
+	if names == "" {
+		names = c.GlobalString("dns")
+	}
+	domains := c.StringSlice("domains")
+	if len(domains) == 0 {
+		domains = c.GlobalStringSlice("domains")
+	}
+	if names == "" || len(domains) == 0 {
+		fatalf(errorTypeUsage, "Checking the DNS providers requires --dns and --domains.")
+	}
+
+	setupDNS(c)
+
+	var failed bool
+	for _, name := range strings.Split(names, ",") {
+		provider, err := dns.NewDNSChallengeProviderByName(name)
+		if err != nil {
+			fatalf(errorTypeUsage, "%v", err)
+		}
+
+		for _, domain := range domains {
+			report, err := acme.CheckDNSProvider(context.Background(), provider, domain)
+			if report != nil {
+				log.Printf("[%s] Checking %s with the record %s %q", report.Domain, name, report.FQDN, report.Value)
+				for _, step := range report.Steps {
+					if step.Err != nil {
+						log.Printf("[%s] %s: failed after %s: %v", report.Domain, step.Name, step.Duration.Round(time.Millisecond), step.Err)
+					} else {
+						log.Printf("[%s] %s: ok in %s", report.Domain, step.Name, step.Duration.Round(time.Millisecond))
+					}
+				}
+			}
+			if err != nil {
+				log.Printf("The check of %s with %s failed: %v", domain, name, err)
+				failed = true
+			}
+		}
+	}
+
+	if failed {
+		log.Fatal("Some DNS providers could not be checked.")
+	}
+	return nil
+}
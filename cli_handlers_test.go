@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli"
+	"github.com/xenolf/lego/acme"
+)
+
+func TestCertificateMetaRoundTrip(t *testing.T) {
+	meta := certificateMeta{
+		Version: certificateMetaVersion,
+		CertificateResource: &acme.CertificateResource{
+			Domain:     "example.com",
+			Profile:    "shortlived",
+			Domains:    []string{"example.com", "www.example.com"},
+			KeyType:    acme.EC384,
+			MustStaple: true,
+			ReuseKey:   true,
+		},
+		Server:  "https://acme.example.com/directory",
+		Account: "me@example.com",
+		CSR:     "-----BEGIN CERTIFICATE REQUEST-----\n-----END CERTIFICATE REQUEST-----\n",
+	}
+
+	metaBytes, err := json.MarshalIndent(meta, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parseCertificateMeta(metaBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, meta) {
+		t.Errorf("Expected the meta data to be reloaded identically, got %+v and %+v", parsed, parsed.CertificateResource)
+	}
+}
+
+func TestParseCertificateMetaVersions(t *testing.T) {
+	// a file written before the request of the certificate was stored.
+	meta, err := parseCertificateMeta([]byte(`{"domain": "example.com", "certUrl": "https://acme.example.com/cert/1", "reuseKey": true, "server": "https://acme.example.com/directory"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Version != 0 || meta.Domain != "example.com" || !meta.ReuseKey || meta.Server != "https://acme.example.com/directory" {
+		t.Errorf("Expected the version 0 file to load, got %+v and %+v", meta, meta.CertificateResource)
+	}
+
+	if _, err := parseCertificateMeta([]byte(`{"version": 2, "domain": "example.com"}`)); err == nil {
+		t.Error("Expected an error for a newer version")
+	}
+}
+
+func TestCertificateMetaRequest(t *testing.T) {
+	newContext := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("renew", flag.ContinueOnError)
+		set.Bool("no-bundle", false, "")
+		set.Bool("must-staple", false, "")
+		if err := set.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return cli.NewContext(nil, set, nil)
+	}
+
+	stored := certificateMeta{Version: certificateMetaVersion, CertificateResource: &acme.CertificateResource{MustStaple: true}}
+	legacy := certificateMeta{CertificateResource: &acme.CertificateResource{}}
+
+	testCases := []struct {
+		desc       string
+		meta       certificateMeta
+		args       []string
+		bundle     bool
+		mustStaple bool
+	}{
+		{desc: "stored", meta: stored, bundle: false, mustStaple: true},
+		{desc: "flags", meta: stored, args: []string{"--must-staple=false"}, bundle: false, mustStaple: false},
+		{desc: "version 0", meta: legacy, bundle: true, mustStaple: false},
+		{desc: "version 0 flags", meta: legacy, args: []string{"--no-bundle", "--must-staple"}, bundle: false, mustStaple: true},
+	}
+	for _, test := range testCases {
+		bundle, mustStaple := test.meta.request(newContext(test.args...))
+		if bundle != test.bundle || mustStaple != test.mustStaple {
+			t.Errorf("%s: expected bundle %v and must staple %v, got %v and %v", test.desc, test.bundle, test.mustStaple, bundle, mustStaple)
+		}
+	}
+}
+
+func TestNameSplitCerts(t *testing.T) {
+	set := flag.NewFlagSet("lego", flag.ContinueOnError)
+	set.String("filename", "", "")
+	conf := NewConfiguration(cli.NewContext(nil, set, nil))
+
+	certs := []*acme.CertificateResource{{Domain: "*.example.com"}, {Domain: "c.example.com"}, {Domain: "e.example.com"}}
+	nameSplitCerts(certs, conf)
+
+	var names []string
+	for _, cert := range certs {
+		names = append(names, certFileName(cert, conf))
+	}
+	expected := []string{"_.example.com", "_.example.com-1", "_.example.com-2"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected the names %v, got %v", expected, names)
+	}
+
+	// a single certificate keeps its name.
+	single := NewConfiguration(cli.NewContext(nil, set, nil))
+	nameSplitCerts(certs[1:2], single)
+	if name := certFileName(certs[1], single); name != "c.example.com" {
+		t.Errorf("Expected the name c.example.com, got %s", name)
+	}
+}
+
+// certConfiguration returns the configuration of the certificates stored under path.
+func certConfiguration(path string) *Configuration {
+	set := flag.NewFlagSet("lego", flag.ContinueOnError)
+	set.String("path", path, "")
+	set.String("storage", "", "")
+	set.String("filename", "", "")
+	set.String("server", "https://acme-v02.api.letsencrypt.org/directory", "")
+	set.String("email", "foo@example.com", "")
+	set.Bool("certbot-layout", false, "")
+	set.Bool("pem", false, "")
+	set.Bool("pfx", false, "")
+	return NewConfiguration(cli.NewContext(nil, set, nil))
+}
+
+func TestSaveCertRes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-save")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certRes := &acme.CertificateResource{Domain: "example.com", Certificate: []byte("certificate"), PrivateKey: []byte("key")}
+	if err = saveCertRes(certRes, certConfiguration(dir)); err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range []string{certExt, keyExt, metaExt} {
+		if _, err := os.Stat(filepath.Join(dir, "certificates", "example.com"+ext)); err != nil {
+			t.Errorf("Expected the %s file to be saved: %v", ext, err)
+		}
+	}
+
+	// the directory of the certificates cannot be created under a file.
+	file := filepath.Join(dir, "file")
+	if err = ioutil.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = saveCertRes(certRes, certConfiguration(file))
+	if err == nil {
+		t.Fatal("Expected an error saving under a file")
+	}
+	if errType := errorType(context.Background(), err); errType != errorTypeSave {
+		t.Errorf("Expected the error type %s, got %s: %v", errorTypeSave, errType, err)
+	}
+}
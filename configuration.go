@@ -1,19 +1,30 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"net/url"
-	"os"
+	"net/http"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/urfave/cli"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/registration/storage"
 )
 
 // Configuration type from CLI and config files.
 type Configuration struct {
 	context *cli.Context
+
+	certStorageOnce sync.Once
+	certStorage     CertStorage
+
+	// certNames are the names of the files of the certificates, by domain, instead of storedCertName,
+	// e.g. for the parts of a split order.
+	certNames map[string]string
 }
 
 // NewConfiguration creates a new configuration from CLI data.
@@ -23,7 +34,11 @@ func NewConfiguration(c *cli.Context) *Configuration {
 
 // KeyType the type from which private keys should be generated
 func (c *Configuration) KeyType() (acme.KeyType, error) {
-	switch strings.ToUpper(c.context.GlobalString("key-type")) {
+	return parseKeyType(c.context.GlobalString("key-type"))
+}
+
+func parseKeyType(keyType string) (acme.KeyType, error) {
+	switch strings.ToUpper(keyType) {
 	case "RSA2048":
 		return acme.RSA2048, nil
 	case "RSA4096":
@@ -36,7 +51,7 @@ func (c *Configuration) KeyType() (acme.KeyType, error) {
 		return acme.EC384, nil
 	}
 
-	return "", fmt.Errorf("Unsupported KeyType: %s", c.context.GlobalString("key-type"))
+	return "", fmt.Errorf("Unsupported KeyType: %s", keyType)
 }
 
 // ExcludedSolvers is a list of solvers that are to be excluded.
@@ -47,23 +62,233 @@ func (c *Configuration) ExcludedSolvers() (cc []acme.Challenge) {
 	return
 }
 
+// ChallengePreferences returns the challenges to attempt by domain.
+func (c *Configuration) ChallengePreferences() (map[string][]acme.Challenge, error) {
+	preferences := make(map[string][]acme.Challenge)
+	for _, value := range c.context.GlobalStringSlice("challenge-for") {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid challenge preference %q, expected domain=challenge[,challenge]", value)
+		}
+
+		for _, name := range strings.Split(parts[1], ",") {
+			challenge, err := parseChallenge(strings.TrimSpace(name))
+			if err != nil {
+				return nil, err
+			}
+			preferences[parts[0]] = append(preferences[parts[0]], challenge)
+		}
+	}
+	return preferences, nil
+}
+
+// DNSMapping returns the DNS providers of --dns-mapping, by domain.
+func (c *Configuration) DNSMapping() (map[string]string, error) {
+	return parseDNSMapping(c.context.GlobalStringSlice("dns-mapping"))
+}
+
+func parseDNSMapping(values []string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("Invalid DNS mapping %q, expected domain=provider", value)
+		}
+
+		domain := mappedDomain(parts[0])
+		provider := strings.TrimSpace(parts[1])
+		if previous, ok := mapping[domain]; ok && previous != provider {
+			return nil, fmt.Errorf("Invalid DNS mapping %q, the domain %s is already mapped to %s", value, domain, previous)
+		}
+		mapping[domain] = provider
+	}
+	return mapping, nil
+}
+
+// CheckDNSMapping returns an error if a domain has no DNS provider,
+// when --dns-mapping is set without the fallback --dns.
+func (c *Configuration) CheckDNSMapping(domains []string) error {
+	mapping, err := c.DNSMapping()
+	if err != nil {
+		return err
+	}
+	if len(mapping) == 0 {
+		return nil
+	}
+
+	for _, domain := range domains {
+		if dnsProviderName(mapping, c.context.GlobalString("dns"), domain) == "" {
+			return fmt.Errorf("No DNS provider for the domain %s: map it or one of its parent domains with --dns-mapping, or set --dns", domain)
+		}
+	}
+	return nil
+}
+
+// dnsProviderName returns the provider of the domain in the mapping:
+// the one of its closest parent domain, or fallback.
+func dnsProviderName(mapping map[string]string, fallback, domain string) string {
+	name := mappedDomain(domain)
+	for {
+		if provider, ok := mapping[name]; ok {
+			return provider
+		}
+
+		i := strings.Index(name, ".")
+		if i < 0 {
+			return fallback
+		}
+		name = name[i+1:]
+	}
+}
+
+// mappedDomain returns the domain as it is matched by --dns-mapping:
+// a wildcard is solved with the challenge of its base domain.
+func mappedDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	return strings.TrimSuffix(strings.TrimPrefix(domain, "*."), ".")
+}
+
+// ChallengeOrder returns the order in which the challenges are attempted.
+func (c *Configuration) ChallengeOrder() ([]acme.Challenge, error) {
+	var order []acme.Challenge
+	if c.context.GlobalString("challenge-order") == "" {
+		return order, nil
+	}
+
+	for _, name := range strings.Split(c.context.GlobalString("challenge-order"), ",") {
+		challenge, err := parseChallenge(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		order = append(order, challenge)
+	}
+	return order, nil
+}
+
+func parseChallenge(name string) (acme.Challenge, error) {
+	switch strings.ToLower(name) {
+	case "http", string(acme.HTTP01):
+		return acme.HTTP01, nil
+	case "dns", string(acme.DNS01):
+		return acme.DNS01, nil
+	case "tls-alpn", string(acme.TLSALPN01):
+		return acme.TLSALPN01, nil
+	}
+	return "", fmt.Errorf("Unsupported challenge: %s", name)
+}
+
+// HTTPClient returns the HTTP client of the requests to the ACME server,
+// nil to use acme.HTTPClient if --http-timeout is not set.
+func (c *Configuration) HTTPClient() *http.Client {
+	if !c.context.GlobalIsSet("http-timeout") {
+		return nil
+	}
+
+	// the transport of acme.HTTPClient is kept for the proxy and CA certificates settings.
+	client := acme.HTTPClient
+	client.Timeout = time.Duration(c.context.GlobalInt("http-timeout")) * time.Second
+	return &client
+}
+
+// ClientOptions returns the options of the ACME clients: the key type,
+// the HTTP client, the user agent and the recursive nameservers of --dns.resolvers.
+func (c *Configuration) ClientOptions(keyType acme.KeyType) []acme.ClientOption {
+	userAgent := fmt.Sprintf("lego-cli/%s", c.context.App.Version)
+	if c.context.GlobalIsSet("user-agent") {
+		userAgent = fmt.Sprintf("%s %s", c.context.GlobalString("user-agent"), userAgent)
+	}
+
+	opts := []acme.ClientOption{acme.WithKeyType(keyType), acme.WithHTTPClient(c.HTTPClient()), acme.WithUserAgent(userAgent)}
+	if resolvers := dnsResolvers(c.context); len(resolvers) > 0 {
+		opts = append(opts, acme.WithDNSResolvers(resolvers...))
+	}
+	return opts
+}
+
+// CertContext returns the context bounding obtaining or renewing a certificate by --cert.timeout.
+func (c *Configuration) CertContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if c.context.GlobalInt("cert.timeout") <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, time.Duration(c.context.GlobalInt("cert.timeout"))*time.Second)
+}
+
 // ServerPath returns the OS dependent path to the data for a specific CA
 func (c *Configuration) ServerPath() string {
-	srv, _ := url.Parse(c.context.GlobalString("server"))
-	return strings.NewReplacer(":", "_", "/", string(os.PathSeparator)).Replace(srv.Host)
+	return storage.ServerPath(c.context.GlobalString("server"))
+}
+
+// The files of a certificate, named by their extension in the default layout.
+const (
+	certExt   = ".crt"
+	leafExt   = ".leaf.crt"
+	issuerExt = ".issuer.crt"
+	keyExt    = ".key"
+	pemExt    = ".pem"
+	pfxExt    = ".pfx"
+	metaExt   = ".json"
+	ocspExt   = ".ocsp"
+)
+
+// certbotFileNames are the names of the files of a certificate in the Certbot layout.
+// The leaf certificate alone is only written in this layout.
+var certbotFileNames = map[string]string{
+	certExt:   "fullchain.pem",
+	leafExt:   "cert.pem",
+	issuerExt: "chain.pem",
+	keyExt:    "privkey.pem",
+	pemExt:    "combined.pem",
+	pfxExt:    "certificate.pfx",
+	metaExt:   "certificate.json",
+	ocspExt:   "ocsp.der",
+}
+
+// CertbotLayout returns true if the certificates are stored like Certbot, in live/<name>/.
+func (c *Configuration) CertbotLayout() bool {
+	return c.context.GlobalBool("certbot-layout")
 }
 
 // CertPath gets the path for certificates.
 func (c *Configuration) CertPath() string {
+	if c.CertbotLayout() {
+		return filepath.Join(c.context.GlobalString("path"), "live")
+	}
 	return filepath.Join(c.context.GlobalString("path"), "certificates")
 }
 
+// CertStorage returns the storage of the certificates of --storage, the files of CertPath by default.
+// lego exits if --storage is invalid.
+func (c *Configuration) CertStorage() CertStorage {
+	c.certStorageOnce.Do(func() {
+		store, err := newCertStorage(c.context.GlobalString("storage"), c.CertPath(), c.CertbotLayout())
+		if err != nil {
+			var usageErr usageError
+			if errors.As(err, &usageErr) {
+				fatalf(errorTypeUsage, "Invalid --storage: %v", err)
+			}
+			fatalf(errorTypeStorage, "Could not open the certificate storage: %v", err)
+		}
+		c.certStorage = store
+	})
+	return c.certStorage
+}
+
+// certFilePath returns the path of a file of the certificate, given by its extension in the default layout.
+func certFilePath(certPath string, certbotLayout bool, name, ext string) string {
+	return filepath.Join(certPath, filepath.FromSlash(certResourcePath(certbotLayout, name, ext)))
+}
+
 // AccountsPath returns the OS dependent path to the
 // local accounts for a specific CA
 func (c *Configuration) AccountsPath() string {
 	return filepath.Join(c.context.GlobalString("path"), "accounts", c.ServerPath())
 }
 
+// AccountStorage returns the storage of the accounts: the files of AccountsPath for each CA.
+func (c *Configuration) AccountStorage() storage.AccountStorage {
+	return storage.NewFileStorage(filepath.Join(c.context.GlobalString("path"), "accounts"))
+}
+
 // AccountPath returns the OS dependent path to a particular account
 func (c *Configuration) AccountPath(acc string) string {
 	return filepath.Join(c.AccountsPath(), acc)
@@ -73,3 +298,8 @@ func (c *Configuration) AccountPath(acc string) string {
 func (c *Configuration) AccountKeysPath(acc string) string {
 	return filepath.Join(c.AccountPath(acc), "keys")
 }
+
+// AccountKeyPath returns the OS dependent path to the private key of a particular account
+func (c *Configuration) AccountKeyPath(acc string) string {
+	return filepath.Join(c.AccountKeysPath(acc), acc+".key")
+}
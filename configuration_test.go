@@ -0,0 +1,102 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCertFilePath(t *testing.T) {
+	certPath := filepath.Join("lego", "certificates")
+	livePath := filepath.Join("lego", "live")
+
+	testCases := []struct {
+		desc          string
+		certPath      string
+		certbotLayout bool
+		ext           string
+		expected      string
+	}{
+		{desc: "certificate", certPath: certPath, ext: certExt, expected: filepath.Join(certPath, "example.com.crt")},
+		{desc: "issuer", certPath: certPath, ext: issuerExt, expected: filepath.Join(certPath, "example.com.issuer.crt")},
+		{desc: "key", certPath: certPath, ext: keyExt, expected: filepath.Join(certPath, "example.com.key")},
+		{desc: "meta data", certPath: certPath, ext: metaExt, expected: filepath.Join(certPath, "example.com.json")},
+		{desc: "certbot full chain", certPath: livePath, certbotLayout: true, ext: certExt, expected: filepath.Join(livePath, "example.com", "fullchain.pem")},
+		{desc: "certbot leaf", certPath: livePath, certbotLayout: true, ext: leafExt, expected: filepath.Join(livePath, "example.com", "cert.pem")},
+		{desc: "certbot issuer", certPath: livePath, certbotLayout: true, ext: issuerExt, expected: filepath.Join(livePath, "example.com", "chain.pem")},
+		{desc: "certbot key", certPath: livePath, certbotLayout: true, ext: keyExt, expected: filepath.Join(livePath, "example.com", "privkey.pem")},
+		{desc: "certbot pfx", certPath: livePath, certbotLayout: true, ext: pfxExt, expected: filepath.Join(livePath, "example.com", "certificate.pfx")},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := certFilePath(test.certPath, test.certbotLayout, "example.com", test.ext); got != test.expected {
+				t.Errorf("Expected %s, got %s", test.expected, got)
+			}
+		})
+	}
+
+	// every file of a certificate has a name in the Certbot layout.
+	for _, ext := range []string{certExt, leafExt, issuerExt, keyExt, pemExt, pfxExt, metaExt, ocspExt} {
+		if certbotFileNames[ext] == "" {
+			t.Errorf("Expected a Certbot file name for %s", ext)
+		}
+	}
+}
+
+func TestSanitizedDomain(t *testing.T) {
+	testCases := map[string]string{
+		"example.com":   "example.com",
+		"*.example.com": "_.example.com",
+		"2001:db8::1":   "2001-db8--1",
+		"bücher.de":     "xn--bcher-kva.de",
+	}
+
+	for domain, expected := range testCases {
+		if got := sanitizedDomain(domain); got != expected {
+			t.Errorf("Expected %s to be stored as %s, got %s", domain, expected, got)
+		}
+	}
+}
+
+func TestDNSProviderName(t *testing.T) {
+	mapping, err := parseDNSMapping([]string{"example.com=cloudflare", "*.Internal.example.com=route53", "example.org.=ovh"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testCases := map[string]string{
+		"example.com":                 "cloudflare",
+		"*.www.example.com":           "cloudflare",
+		"db.internal.example.com":     "route53",
+		"example.org":                 "ovh",
+		"notexample.com":              "exec",
+		"com":                         "exec",
+		"*.internal.example.com":      "route53",
+		"mail.example.org.":           "ovh",
+		"sub.db.internal.example.com": "route53",
+	}
+	for domain, expected := range testCases {
+		if got := dnsProviderName(mapping, "exec", domain); got != expected {
+			t.Errorf("Expected the provider %s for %s, got %s", expected, domain, got)
+		}
+	}
+
+	if got := dnsProviderName(mapping, "", "example.net"); got != "" {
+		t.Errorf("Expected no provider without fallback, got %s", got)
+	}
+}
+
+func TestParseDNSMappingErrors(t *testing.T) {
+	testCases := [][]string{
+		{"example.com"},
+		{"example.com="},
+		{"=cloudflare"},
+		{"example.com=cloudflare", "example.com=ovh"},
+	}
+
+	for _, values := range testCases {
+		if _, err := parseDNSMapping(values); err == nil {
+			t.Errorf("Expected an error for %v", values)
+		}
+	}
+}
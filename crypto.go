@@ -4,38 +4,14 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/x509"
-	"encoding/pem"
+	"crypto/rsa"
 	"errors"
+	"fmt"
 	"io/ioutil"
-	"os"
-)
-
-func generatePrivateKey(file string) (crypto.PrivateKey, error) {
-
-	privateKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
-	if err != nil {
-		return nil, err
-	}
-
-	keyBytes, err := x509.MarshalECPrivateKey(privateKey)
-	if err != nil {
-		return nil, err
-	}
-
-	pemKey := pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}
 
-	certOut, err := os.Create(file)
-	if err != nil {
-		return nil, err
-	}
-
-	pem.Encode(certOut, &pemKey)
-	certOut.Close()
-
-	return privateKey, nil
-}
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/registration/storage"
+)
 
 func loadPrivateKey(file string) (crypto.PrivateKey, error) {
 	keyBytes, err := ioutil.ReadFile(file)
@@ -43,14 +19,35 @@ func loadPrivateKey(file string) (crypto.PrivateKey, error) {
 		return nil, err
 	}
 
-	keyBlock, _ := pem.Decode(keyBytes)
+	return parsePrivateKey(keyBytes)
+}
+
+func parsePrivateKey(keyBytes []byte) (crypto.PrivateKey, error) {
+	return storage.DecodePrivateKey(keyBytes)
+}
 
-	switch keyBlock.Type {
-	case "RSA PRIVATE KEY":
-		return x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
-	case "EC PRIVATE KEY":
-		return x509.ParseECPrivateKey(keyBlock.Bytes)
+// privateKeyType returns the type of the private key, among the ones of --key-type.
+func privateKeyType(privateKey crypto.PrivateKey) (acme.KeyType, error) {
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		switch key.N.BitLen() {
+		case 2048:
+			return acme.RSA2048, nil
+		case 4096:
+			return acme.RSA4096, nil
+		case 8192:
+			return acme.RSA8192, nil
+		}
+		return "", fmt.Errorf("unsupported RSA key size: %d", key.N.BitLen())
+	case *ecdsa.PrivateKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return acme.EC256, nil
+		case elliptic.P384():
+			return acme.EC384, nil
+		}
+		return "", fmt.Errorf("unsupported EC curve: %s", key.Curve.Params().Name)
 	}
 
-	return nil, errors.New("unknown private key type")
+	return "", errors.New("unknown private key type")
 }
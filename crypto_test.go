@@ -0,0 +1,38 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/xenolf/lego/acme"
+)
+
+func TestPrivateKeyType(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyType, err := privateKeyType(ecKey); err != nil || keyType != acme.EC256 {
+		t.Errorf("Expected %s, got %s (%v)", acme.EC256, keyType, err)
+	}
+	if keyType, err := privateKeyType(rsaKey); err != nil || keyType != acme.RSA2048 {
+		t.Errorf("Expected %s, got %s (%v)", acme.RSA2048, keyType, err)
+	}
+
+	// a key type lego cannot generate is not a --key-type.
+	ecKey224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := privateKeyType(ecKey224); err == nil {
+		t.Error("Expected an error for a P-224 key")
+	}
+}
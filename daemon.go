@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/log"
+)
+
+const (
+	// daemonRetryInitialDelay is the delay before retrying a failed renewal the first time,
+	// doubled for every further failure, up to the check interval.
+	daemonRetryInitialDelay = 5 * time.Minute
+
+	// daemonJitterRatio is the part of the check interval randomly added to the delay between two checks,
+	// so that many daemons started together do not hit the CA at the same time.
+	daemonJitterRatio = 0.1
+)
+
+// renewalRetry is the backoff of a certificate whose renewal failed.
+type renewalRetry struct {
+	failures int
+	next     time.Time
+}
+
+// retryDelay returns the delay before retrying a renewal after the given number of consecutive failures.
+func retryDelay(failures int, interval time.Duration) time.Duration {
+	delay := daemonRetryInitialDelay
+	for i := 1; i < failures && delay < interval; i++ {
+		delay *= 2
+	}
+	if delay > interval {
+		delay = interval
+	}
+	return delay
+}
+
+// nextCheck returns the time of the next check: after the interval with jitter,
+// or earlier to retry a failed renewal.
+func nextCheck(now time.Time, interval time.Duration, retries map[string]*renewalRetry) time.Time {
+	next := now.Add(interval)
+	if jitter := int64(float64(interval) * daemonJitterRatio); jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(jitter)))
+	}
+
+	for _, retry := range retries {
+		if retry.next.Before(next) {
+			next = retry.next
+		}
+	}
+	return next
+}
+
+func daemon(c *cli.Context) error {
+	conf, acc, client := setup(c)
+	if acc.Registration == nil {
+		register(c, conf, acc, client)
+	}
+
+	orderOptions, err := parseOrderOptions(c)
+	if err != nil {
+		fatalf(errorTypeUsage, "%v", err)
+	}
+
+	interval := c.Duration("interval")
+	if interval <= 0 {
+		fatalf(errorTypeUsage, "The --interval must be positive.")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		sig := <-signals
+		log.Printf("Received %s, stopping.", sig)
+		cancel()
+	}()
+
+	d := &renewalDaemon{
+		c:            c,
+		conf:         conf,
+		acc:          acc,
+		client:       client,
+		tosAgreedURL: acc.Registration.TOSAgreedURL,
+		orderOptions: orderOptions,
+		interval:     interval,
+		retries:      make(map[string]*renewalRetry),
+	}
+
+	for {
+		// the certificate of --domains is obtained at startup if it is not stored yet.
+		if len(c.GlobalStringSlice("domains")) > 0 {
+			d.obtainMissing(ctx, c.GlobalStringSlice("domains"))
+		}
+
+		d.checkAll(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		next := nextCheck(time.Now(), interval, d.retries)
+		log.Printf("Next check of the certificates at %s", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// renewalDaemon renews the stored certificates, with a backoff per certificate.
+type renewalDaemon struct {
+	c            *cli.Context
+	conf         *Configuration
+	acc          *Account
+	client       *acme.Client
+	tosAgreedURL string
+	orderOptions acme.OrderOptions
+	interval     time.Duration
+
+	// retries are the backoffs of the certificates whose renewal failed, by name.
+	retries map[string]*renewalRetry
+}
+
+// obtainMissing obtains the certificate of the domains if it is not stored,
+// unless it is waiting for a retry.
+func (d *renewalDaemon) obtainMissing(ctx context.Context, domains []string) {
+	name := storedCertName(d.conf, domains[0])
+	if _, err := loadStoredCertificate(d.conf, name); err == nil {
+		return
+	}
+	if retry, ok := d.retries[name]; ok && time.Now().Before(retry.next) {
+		return
+	}
+
+	log.Printf("[%s] No certificate stored, obtaining one.", domains[0])
+
+	certCtx, cancel := d.conf.CertContext(ctx)
+	defer cancel()
+
+	cert, err := d.client.ObtainCertificateWithOptions(certCtx, domains, !d.c.Bool("no-bundle"), nil, d.c.Bool("must-staple"), d.orderOptions)
+	switch {
+	case ctx.Err() != nil:
+		log.Printf("[%s] Obtaining the certificate was interrupted.", domains[0])
+	case err != nil:
+		d.failed(name, err)
+	default:
+		d.saved(name, cert)
+	}
+}
+
+// checkAll renews the stored certificates expiring within --days,
+// except the ones waiting for a retry.
+func (d *renewalDaemon) checkAll(ctx context.Context) {
+	names, err := d.conf.CertStorage().ListResources()
+	if err != nil {
+		log.Errorf("Could not list the certificates: %v", err)
+		return
+	}
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if retry, ok := d.retries[name]; ok && time.Now().Before(retry.next) {
+			continue
+		}
+
+		certCtx, cancel := d.conf.CertContext(ctx)
+		cert, err := renewStoredCertificate(certCtx, d.c, d.conf, d.client, name, name, d.orderOptions)
+		cancel()
+
+		switch {
+		case ctx.Err() != nil:
+			log.Printf("[%s] The renewal was interrupted.", name)
+			return
+		case err != nil:
+			d.failed(name, err)
+		case cert == nil:
+			delete(d.retries, name)
+		default:
+			d.saved(name, cert)
+		}
+	}
+}
+
+// failed schedules the next attempt for the certificate, with an exponential backoff.
+func (d *renewalDaemon) failed(name string, err error) {
+	retry, ok := d.retries[name]
+	if !ok {
+		retry = &renewalRetry{}
+		d.retries[name] = retry
+	}
+	retry.failures++
+	retry.next = time.Now().Add(retryDelay(retry.failures, d.interval))
+
+	log.Errorf("[%s] Could not obtain or save the certificate (%d consecutive failures), retrying at %s: %v",
+		name, retry.failures, retry.next.Format(time.RFC3339), err)
+	logChallengeSummary()
+}
+
+// saved saves the obtained certificate and runs the renew hook.
+// A certificate which cannot be saved is retried like a failed renewal:
+// a transient failure of the storage does not stop the daemon.
+func (d *renewalDaemon) saved(name string, cert *acme.CertificateResource) {
+	if err := saveCertRes(cert, d.conf); err != nil {
+		d.failed(name, err)
+		return
+	}
+
+	delete(d.retries, name)
+	logChallengeSummary()
+	saveTOSAgreement(d.acc, d.tosAgreedURL)
+
+	// unlike the renew command, a failing hook does not stop the daemon.
+	if d.c.String("renew-hook") != "" {
+		timeout := time.Duration(d.c.Int("hook-timeout")) * time.Second
+		if err := runHook(d.c.String("renew-hook"), timeout, cert, d.conf); err != nil {
+			log.Errorf("[%s] %v", cert.Domain, err)
+		}
+	}
+}
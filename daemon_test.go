@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+)
+
+func TestRetryDelay(t *testing.T) {
+	testCases := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{failures: 1, expected: 5 * time.Minute},
+		{failures: 2, expected: 10 * time.Minute},
+		{failures: 4, expected: 40 * time.Minute},
+		{failures: 10, expected: 24 * time.Hour},
+		{failures: 1000, expected: 24 * time.Hour},
+	}
+
+	for _, test := range testCases {
+		if got := retryDelay(test.failures, 24*time.Hour); got != test.expected {
+			t.Errorf("Expected a delay of %s after %d failures, got %s", test.expected, test.failures, got)
+		}
+	}
+}
+
+func TestNextCheck(t *testing.T) {
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	interval := 24 * time.Hour
+
+	for i := 0; i < 100; i++ {
+		next := nextCheck(now, interval, nil)
+		if next.Before(now.Add(interval)) || !next.Before(now.Add(interval+interval/10)) {
+			t.Fatalf("Expected the next check within the jitter after the interval, got %s", next)
+		}
+	}
+
+	retries := map[string]*renewalRetry{
+		"example.com": {failures: 1, next: now.Add(5 * time.Minute)},
+		"example.org": {failures: 3, next: now.Add(20 * time.Minute)},
+	}
+	if next := nextCheck(now, interval, retries); !next.Equal(now.Add(5 * time.Minute)) {
+		t.Errorf("Expected the next check at the earliest retry, got %s", next)
+	}
+}
+
+func TestRenewalDaemonSavedRetries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the directory of the certificates cannot be created under a file.
+	file := filepath.Join(dir, "file")
+	if err = ioutil.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &renewalDaemon{conf: certConfiguration(file), interval: 24 * time.Hour, retries: map[string]*renewalRetry{}}
+	certRes := &acme.CertificateResource{Domain: "example.com", Certificate: []byte("certificate"), PrivateKey: []byte("key")}
+	d.saved("example.com", certRes)
+	d.saved("example.com", certRes)
+
+	retry, ok := d.retries["example.com"]
+	if !ok {
+		t.Fatal("Expected the certificate which cannot be saved to be retried")
+	}
+	if retry.failures != 2 {
+		t.Errorf("Expected 2 failures, got %d", retry.failures)
+	}
+	if min := time.Now().Add(retryDelay(1, d.interval)); retry.next.Before(min) {
+		t.Errorf("Expected the retry after the backoff, got %s", retry.next)
+	}
+}
@@ -0,0 +1,181 @@
+//go:build e2e
+// +build e2e
+
+package e2e
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/xenolf/lego/acme"
+)
+
+// oidMustStaple is the TLS Feature extension requesting the OCSP staples (RFC 7633).
+var oidMustStaple = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// TestCLIRenewalFromMetadata obtains a certificate with non-default options with the lego CLI,
+// and renews it with the storage directory only: the request of the certificate is read from its meta data.
+func TestCLIRenewalFromMetadata(t *testing.T) {
+	if pebble == nil {
+		t.Skip(skipReason)
+	}
+
+	binDir, err := ioutil.TempDir("", "lego-e2e-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(binDir)
+	lego := buildLego(t, binDir)
+
+	work, err := ioutil.TempDir("", "lego-e2e-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(work)
+	storage := filepath.Join(work, "storage")
+	certPath := filepath.Join(storage, "certificates")
+
+	domains := []string{"cli.example.com", "www.cli.example.org"}
+	runLego(t, work, lego,
+		"--server", directoryURL, "--email", "cli@example.com", "--accept-tos", "--path", storage,
+		"--key-type", "ec384", "--exclude", "tls-alpn-01", "--http.port", httpAddr,
+		"--domains", domains[0], "--domains", domains[1],
+		"run", "--no-bundle", "--must-staple")
+
+	leaf := checkCLICertificate(t, certPath, domains)
+	meta := readMeta(t, certPath)
+	expected := map[string]interface{}{
+		"server": directoryURL, "account": "cli@example.com", "keyType": string(acme.EC384), "mustStaple": true,
+	}
+	for field, value := range expected {
+		if meta[field] != value {
+			t.Errorf("Expected the %s %v in the meta data, got %v", field, value, meta[field])
+		}
+	}
+	if _, ok := meta["bundle"]; ok {
+		t.Errorf("Expected the certificate to be stored without bundle, got %v", meta["bundle"])
+	}
+
+	// the renewal has only the storage directory left, and none of the flags of the request.
+	entries, err := ioutil.ReadDir(work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "storage" {
+			if err := os.RemoveAll(filepath.Join(work, entry.Name())); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	runLego(t, work, lego,
+		"--path", storage, "--exclude", "tls-alpn-01", "--http.port", httpAddr, "--domains", domains[0],
+		"renew", "--force")
+
+	renewed := checkCLICertificate(t, certPath, domains)
+	if renewed.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+		t.Error("Expected a new certificate, got the same serial number")
+	}
+	if renewedMeta := readMeta(t, certPath); !reflect.DeepEqual(renewedMeta, meta) {
+		t.Errorf("Expected the request of the certificate to be renewed identically:\n%v\ngot\n%v", meta, renewedMeta)
+	}
+}
+
+// buildLego builds the lego CLI in the directory, and returns its path.
+func buildLego(t *testing.T, dir string) string {
+	t.Helper()
+
+	binary := filepath.Join(dir, "lego")
+	cmd := exec.Command(filepath.Join(runtime.GOROOT(), "bin", "go"), "build", "-o", binary, "github.com/xenolf/lego")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Could not build lego: %v\n%s", err, output)
+	}
+	return binary
+}
+
+// runLego runs the lego CLI in the directory, trusting the TLS certificate of Pebble.
+func runLego(t *testing.T, dir, lego string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command(lego, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "LEGO_CA_CERTIFICATES="+filepath.Join(pebble.dir, "cert.pem"))
+	output, err := cmd.CombinedOutput()
+	if testing.Verbose() {
+		t.Logf("lego %v:\n%s", args, output)
+	}
+	if err != nil {
+		t.Fatalf("lego %v: %v\n%s", args, err, output)
+	}
+}
+
+// checkCLICertificate checks the certificate stored for the domains, sorted:
+// not bundled, with must staple and an EC P-384 key, like the request of the test.
+func checkCLICertificate(t *testing.T, certPath string, domains []string) *x509.Certificate {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join(certPath, domains[0]+".crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, rest := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("Expected a PEM certificate, got %s", data)
+	}
+	if next, _ := pem.Decode(rest); next != nil {
+		t.Error("Expected the certificate without its issuer, as with --no-bundle")
+	}
+
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := append([]string(nil), leaf.DNSNames...)
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, domains) {
+		t.Errorf("Expected the names %v, got %v", domains, names)
+	}
+	if key, ok := leaf.PublicKey.(*ecdsa.PublicKey); !ok || key.Curve != elliptic.P384() {
+		t.Errorf("Expected an EC P-384 key, got %T", leaf.PublicKey)
+	}
+
+	mustStaple := false
+	for _, ext := range leaf.Extensions {
+		mustStaple = mustStaple || ext.Id.Equal(oidMustStaple)
+	}
+	if !mustStaple {
+		t.Error("Expected the must staple extension")
+	}
+	return leaf
+}
+
+// readMeta returns the request of the certificate stored in the meta data file of the test:
+// its fields, except the ones of the certificate issued.
+func readMeta(t *testing.T, certPath string) map[string]interface{} {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join(certPath, "cli.example.com.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta map[string]interface{}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	}
+	delete(meta, "certUrl")
+	delete(meta, "certStableUrl")
+	return meta
+}
@@ -0,0 +1,16 @@
+// Package e2e runs the end-to-end tests of the acme package against Pebble, the ACME test server of Let's Encrypt.
+//
+// The tests start Pebble and pebble-challtestsrv as subprocesses, register an account,
+// and obtain, renew and revoke certificates with the http-01 and dns-01 challenges.
+// The lego CLI, built with the go command running the tests, obtains and renews a certificate from its storage directory.
+// They are built with the e2e tag:
+//
+//	go test -tags e2e ./e2e/...
+//
+// The binaries are found in the PATH, or given by the PEBBLE and PEBBLE_CHALLTESTSRV environment variables.
+// Without them, the tests are skipped.
+//
+// The tests listen on the fixed ports of the Pebble configuration:
+// 14000 and 15000 for Pebble, 8053 and 8055 for pebble-challtestsrv,
+// and 5002 for the http-01 challenges, which must be free.
+package e2e
@@ -0,0 +1,147 @@
+//go:build e2e
+// +build e2e
+
+package e2e
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/xenolf/lego/acme"
+)
+
+func TestHTTP01(t *testing.T) {
+	client := newClient(t, acme.HTTP01)
+
+	cert, err := client.ObtainCertificate([]string{"http.example.com"}, true, nil, false)
+	if err != nil {
+		t.Fatalf("Could not obtain the certificate: %v", err)
+	}
+	checkCertificate(t, cert, []string{"http.example.com"})
+}
+
+func TestDNS01(t *testing.T) {
+	client := newClient(t, acme.DNS01)
+
+	// the wildcard and its apex domain share the TXT record name.
+	domains := []string{"dns.example.com", "*.dns.example.com"}
+	cert, err := client.ObtainCertificate(domains, true, nil, false)
+	if err != nil {
+		t.Fatalf("Could not obtain the certificate: %v", err)
+	}
+	checkCertificate(t, cert, domains)
+}
+
+func TestMultiSAN(t *testing.T) {
+	client := newClient(t, acme.HTTP01)
+
+	domains := []string{"san.example.com", "www.san.example.com", "san.example.org", "mail.san.example.org"}
+	cert, err := client.ObtainCertificate(domains, false, nil, false)
+	if err != nil {
+		t.Fatalf("Could not obtain the certificate: %v", err)
+	}
+	checkCertificate(t, cert, domains)
+
+	leaf, _ := cert.Leaf()
+	if leaf.Subject.CommonName != domains[0] {
+		t.Errorf("Expected the common name %s, got %s", domains[0], leaf.Subject.CommonName)
+	}
+}
+
+func TestRenewal(t *testing.T) {
+	client := newClient(t, acme.HTTP01)
+
+	domains := []string{"renew.example.com", "www.renew.example.com"}
+	cert, err := client.ObtainCertificate(domains, true, nil, false)
+	if err != nil {
+		t.Fatalf("Could not obtain the certificate: %v", err)
+	}
+
+	renewed, err := client.RenewCertificate(*cert, true, false)
+	if err != nil {
+		t.Fatalf("Could not renew the certificate: %v", err)
+	}
+	checkCertificate(t, renewed, domains)
+
+	leaf, _ := cert.Leaf()
+	renewedLeaf, _ := renewed.Leaf()
+	if leaf.SerialNumber.Cmp(renewedLeaf.SerialNumber) == 0 {
+		t.Error("Expected a new certificate, got the same serial number")
+	}
+	if !reflect.DeepEqual(leaf.PublicKey, renewedLeaf.PublicKey) {
+		t.Error("Expected the renewed certificate to keep the private key")
+	}
+}
+
+func TestRevocation(t *testing.T) {
+	client := newClient(t, acme.HTTP01)
+
+	cert, err := client.ObtainCertificate([]string{"revoke.example.com"}, true, nil, false)
+	if err != nil {
+		t.Fatalf("Could not obtain the certificate: %v", err)
+	}
+
+	if err := client.RevokeCertificateWithReason(cert.Certificate, 4); err != nil {
+		t.Fatalf("Could not revoke the certificate: %v", err)
+	}
+
+	// a certificate cannot be revoked twice.
+	err = client.RevokeCertificate(cert.Certificate)
+	if err == nil {
+		t.Fatal("Expected an error revoking the certificate again")
+	}
+	if !strings.Contains(err.Error(), "alreadyRevoked") {
+		t.Errorf("Expected an alreadyRevoked error, got %v", err)
+	}
+}
+
+// checkCertificate checks that the certificate is for the domains,
+// matches its private key and is issued by the root of Pebble.
+func checkCertificate(t *testing.T, cert *acme.CertificateResource, domains []string) {
+	t.Helper()
+
+	leaf, err := cert.Leaf()
+	if err != nil {
+		t.Fatalf("Invalid certificate: %v", err)
+	}
+
+	names := append([]string(nil), leaf.DNSNames...)
+	expected := append([]string(nil), domains...)
+	sort.Strings(names)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected the names %v, got %v", expected, names)
+	}
+	if cert.Domain != domains[0] {
+		t.Errorf("Expected the domain %s, got %s", domains[0], cert.Domain)
+	}
+
+	if _, err := tls.X509KeyPair(cert.Certificate, cert.PrivateKey); err != nil {
+		t.Errorf("Expected the certificate to match the private key: %v", err)
+	}
+
+	chain, err := cert.Chain()
+	if err != nil || len(chain) == 0 {
+		t.Fatalf("Expected the issuer certificates, got %d (%v)", len(chain), err)
+	}
+	intermediates := x509.NewCertPool()
+	for _, issuer := range chain {
+		intermediates.AddCert(issuer)
+	}
+
+	for _, domain := range domains {
+		_, err = leaf.Verify(x509.VerifyOptions{
+			// a name matched by the wildcard domain.
+			DNSName:       strings.Replace(domain, "*", "wildcard", 1),
+			Intermediates: intermediates,
+			Roots:         pebble.rootCertificates(t),
+		})
+		if err != nil {
+			t.Errorf("Could not verify the certificate for %s: %v", domain, err)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+//go:build e2e
+// +build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
+)
+
+const (
+	directoryURL    = "https://127.0.0.1:14000/dir"
+	managementURL   = "https://127.0.0.1:15000"
+	dnsAddr         = "127.0.0.1:8053"
+	challtestsrvURL = "http://127.0.0.1:8055"
+
+	// httpAddr is where lego serves the http-01 challenges: the httpPort of the Pebble configuration.
+	httpAddr = "127.0.0.1:5002"
+)
+
+// errNotAvailable is returned when the binaries of Pebble are not found.
+var errNotAvailable = errors.New("pebble is not available")
+
+var (
+	// pebble is the running Pebble, nil when the tests are skipped.
+	pebble *pebbleEnv
+	// skipReason is the reason why the tests are skipped.
+	skipReason string
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	env, err := startPebble()
+	switch {
+	case err == errNotAvailable:
+		skipReason = "pebble and pebble-challtestsrv are not available: install them in the PATH, or set PEBBLE and PEBBLE_CHALLTESTSRV"
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Could not start Pebble: %v\n", err)
+		os.Exit(1)
+	default:
+		pebble = env
+	}
+
+	code := m.Run()
+	if pebble != nil {
+		pebble.stop()
+	}
+	os.Exit(code)
+}
+
+// pebbleEnv is a running Pebble and its pebble-challtestsrv.
+type pebbleEnv struct {
+	dir        string
+	processes  []*exec.Cmd
+	httpClient *http.Client
+}
+
+// startPebble starts pebble-challtestsrv, as the nameserver of Pebble, and Pebble with a new TLS certificate.
+func startPebble() (*pebbleEnv, error) {
+	pebbleBin, err := lookBinary("PEBBLE", "pebble")
+	if err != nil {
+		return nil, err
+	}
+	challtestsrvBin, err := lookBinary("PEBBLE_CHALLTESTSRV", "pebble-challtestsrv")
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "lego-e2e")
+	if err != nil {
+		return nil, err
+	}
+	env := &pebbleEnv{dir: dir}
+
+	roots, err := env.writeConfig()
+	if err != nil {
+		env.stop()
+		return nil, err
+	}
+	env.httpClient = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+	}
+
+	// every domain resolves to 127.0.0.1, where lego answers the http-01 challenges.
+	err = env.start(challtestsrvBin, nil,
+		"-defaultIPv4", "127.0.0.1", "-defaultIPv6", "",
+		"-dns01", dnsAddr, "-management", strings.TrimPrefix(challtestsrvURL, "http://"),
+		"-http01", "", "-https01", "", "-tlsalpn01", "")
+	if err != nil {
+		env.stop()
+		return nil, err
+	}
+
+	// Pebble keeps rejecting some nonces, to exercise the retries of lego.
+	err = env.start(pebbleBin, []string{"PEBBLE_VA_NOSLEEP=1"},
+		"-config", filepath.Join(dir, "pebble-config.json"), "-dnsserver", dnsAddr)
+	if err != nil {
+		env.stop()
+		return nil, err
+	}
+
+	if err := env.waitReady(30 * time.Second); err != nil {
+		env.stop()
+		return nil, err
+	}
+	return env, nil
+}
+
+// lookBinary returns the path of the binary given by envVar, or of name in the PATH.
+func lookBinary(envVar, name string) (string, error) {
+	if path := os.Getenv(envVar); path != "" {
+		return path, nil
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", errNotAvailable
+	}
+	return path, nil
+}
+
+// start starts a subprocess, logging its output with -v.
+func (e *pebbleEnv) start(name string, env []string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	if testing.Verbose() {
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	e.processes = append(e.processes, cmd)
+	return nil
+}
+
+// stop kills the subprocesses and removes the configuration.
+func (e *pebbleEnv) stop() {
+	for _, cmd := range e.processes {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+	os.RemoveAll(e.dir)
+}
+
+// waitReady waits until the directory of Pebble and the management API of pebble-challtestsrv answer.
+func (e *pebbleEnv) waitReady(timeout time.Duration) error {
+	return acme.WaitFor(timeout, 100*time.Millisecond, func() (bool, error) {
+		resp, err := e.httpClient.Get(directoryURL)
+		if err != nil {
+			return false, nil
+		}
+		resp.Body.Close()
+
+		conn, err := net.Dial("tcp", strings.TrimPrefix(challtestsrvURL, "http://"))
+		if err != nil {
+			return false, nil
+		}
+		conn.Close()
+		return true, nil
+	})
+}
+
+// writeConfig writes the configuration of Pebble, with a new self-signed TLS certificate of 127.0.0.1.
+// It returns the pool of the certificate.
+func (e *pebbleEnv) writeConfig() (*x509.CertPool, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "lego e2e"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	certFile, keyFile := filepath.Join(e.dir, "cert.pem"), filepath.Join(e.dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return nil, err
+	}
+
+	config := map[string]interface{}{
+		"pebble": map[string]interface{}{
+			"listenAddress":           strings.TrimSuffix(strings.TrimPrefix(directoryURL, "https://"), "/dir"),
+			"managementListenAddress": strings.TrimPrefix(managementURL, "https://"),
+			"certificate":             certFile,
+			"privateKey":              keyFile,
+			"httpPort":                5002,
+			"tlsPort":                 5001,
+		},
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(e.dir, "pebble-config.json"), data, 0600); err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return roots, nil
+}
+
+// rootCertificates returns the roots of the certificates issued by Pebble, generated when it starts.
+func (e *pebbleEnv) rootCertificates(t *testing.T) *x509.CertPool {
+	resp, err := e.httpClient.Get(managementURL + "/roots/0")
+	if err != nil {
+		t.Fatalf("Could not get the root certificate of Pebble: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		t.Fatalf("Invalid root certificate of Pebble: %s", data)
+	}
+	return roots
+}
+
+// testUser is the user of the account of a test.
+type testUser struct {
+	email        string
+	registration *acme.RegistrationResource
+	key          *ecdsa.PrivateKey
+}
+
+func (u *testUser) GetEmail() string                            { return u.email }
+func (u *testUser) GetRegistration() *acme.RegistrationResource { return u.registration }
+func (u *testUser) GetPrivateKey() crypto.PrivateKey            { return u.key }
+
+// newClient returns a client of a new account, solving the given challenges only.
+// The test is skipped if Pebble is not available.
+func newClient(t *testing.T, challenges ...acme.Challenge) *acme.Client {
+	if pebble == nil {
+		t.Skip(skipReason)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &testUser{email: "e2e@example.com", key: key}
+
+	client, err := acme.NewClientWithHTTPClient(directoryURL, user, acme.RSA2048, pebble.httpClient)
+	if err != nil {
+		t.Fatalf("Could not create the client: %v", err)
+	}
+
+	user.registration, err = client.Register(true)
+	if err != nil {
+		t.Fatalf("Could not register the account: %v", err)
+	}
+
+	var excluded []acme.Challenge
+	for _, chlng := range []acme.Challenge{acme.HTTP01, acme.DNS01, acme.TLSALPN01} {
+		if !containsChallenge(challenges, chlng) {
+			excluded = append(excluded, chlng)
+		}
+	}
+	client.ExcludeChallenges(excluded)
+
+	if containsChallenge(challenges, acme.HTTP01) {
+		if err := client.SetHTTPAddress(httpAddr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if containsChallenge(challenges, acme.DNS01) {
+		if err := client.SetChallengeProvider(acme.DNS01, &challtestsrvProvider{client: pebble.httpClient}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return client
+}
+
+func containsChallenge(challenges []acme.Challenge, chlng acme.Challenge) bool {
+	for _, c := range challenges {
+		if c == chlng {
+			return true
+		}
+	}
+	return false
+}
+
+// challtestsrvProvider is a dns-01 provider setting the TXT records with the management API of pebble-challtestsrv,
+// the nameserver of Pebble.
+type challtestsrvProvider struct {
+	client *http.Client
+}
+
+func (p *challtestsrvProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	return p.post("/set-txt", map[string]string{"host": fqdn, "value": value})
+}
+
+func (p *challtestsrvProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
+	return p.post("/clear-txt", map[string]string{"host": fqdn})
+}
+
+// PreCheck queries pebble-challtestsrv, which is not a nameserver of the public zones.
+func (p *challtestsrvProvider) PreCheck(domain, fqdn, value string) (bool, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(fqdn, dns.TypeTXT)
+
+	r, _, err := new(dns.Client).Exchange(m, dnsAddr)
+	if err != nil {
+		return false, err
+	}
+
+	for _, rr := range r.Answer {
+		if txt, ok := rr.(*dns.TXT); ok && strings.Join(txt.Txt, "") == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (p *challtestsrvProvider) Timeout() (timeout, interval time.Duration) {
+	return 10 * time.Second, 100 * time.Millisecond
+}
+
+func (p *challtestsrvProvider) post(path string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Post(challtestsrvURL+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("pebble-challtestsrv: %s returned %s", path, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envVarName is the syntax of the names of an environment file.
+var envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envVar is a variable of an environment file.
+type envVar struct {
+	name  string
+	value string
+}
+
+// loadEnvFiles sets the variables of the environment files, in order,
+// so that a file overrides the variables of the previous ones.
+// The variables set before lego started are never overridden.
+func loadEnvFiles(filenames []string) error {
+	vars := make(map[string]string)
+	var names []string
+
+	for _, filename := range filenames {
+		fileVars, err := readEnvFile(filename)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range fileVars {
+			if _, ok := vars[v.name]; !ok {
+				names = append(names, v.name)
+			}
+			vars[v.name] = v.value
+		}
+	}
+
+	for _, name := range names {
+		if _, ok := os.LookupEnv(name); ok {
+			continue
+		}
+		if err := os.Setenv(name, vars[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readEnvFile(filename string) ([]envVar, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	vars, err := parseEnvFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return vars, nil
+}
+
+// parseEnvFile parses the NAME=VALUE lines of an environment file, without shell expansion.
+// The lines starting with # are comments, as the text following a # after an unquoted value.
+// A value can be enclosed in single quotes, taken literally,
+// or in double quotes, where \", \\ and \n are interpreted.
+// The errors never contain the values, which are usually secrets.
+func parseEnvFile(r io.Reader) ([]envVar, error) {
+	var vars []envVar
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected NAME=VALUE", lineNumber)
+		}
+
+		name := strings.TrimSpace(parts[0])
+		if !envVarName.MatchString(name) {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", lineNumber, name)
+		}
+
+		value, err := parseEnvValue(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value of %s: %v", lineNumber, name, err)
+		}
+
+		vars = append(vars, envVar{name: name, value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return vars, nil
+}
+
+func parseEnvValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	var value, rest string
+	switch raw[0] {
+	case '\'':
+		end := strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("missing closing quote")
+		}
+		value, rest = raw[1:end+1], raw[end+2:]
+
+	case '"':
+		var b strings.Builder
+		i := 1
+		for ; i < len(raw) && raw[i] != '"'; i++ {
+			if raw[i] != '\\' || i+1 == len(raw) {
+				b.WriteByte(raw[i])
+				continue
+			}
+
+			i++
+			switch raw[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case '"', '\\':
+				b.WriteByte(raw[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(raw[i])
+			}
+		}
+		if i == len(raw) {
+			return "", fmt.Errorf("missing closing quote")
+		}
+		value, rest = b.String(), raw[i+1:]
+
+	default:
+		// an unquoted value ends at a comment.
+		if i := strings.Index(raw, " #"); i >= 0 {
+			raw = raw[:i]
+		}
+		if i := strings.Index(raw, "\t#"); i >= 0 {
+			raw = raw[:i]
+		}
+		return strings.TrimSpace(raw), nil
+	}
+
+	rest = strings.TrimSpace(rest)
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected text after the closing quote")
+	}
+	return value, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	content := `# the credentials of the DNS provider
+CLOUDFLARE_EMAIL=foo@example.com
+export CLOUDFLARE_API_KEY = abc#def # the key
+
+SINGLE='$HOME is not expanded # nor a comment'
+DOUBLE="a \"quoted\"\nvalue" # comment
+EMPTY=
+`
+
+	vars, err := parseEnvFile(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []envVar{
+		{name: "CLOUDFLARE_EMAIL", value: "foo@example.com"},
+		{name: "CLOUDFLARE_API_KEY", value: "abc#def"},
+		{name: "SINGLE", value: "$HOME is not expanded # nor a comment"},
+		{name: "DOUBLE", value: "a \"quoted\"\nvalue"},
+		{name: "EMPTY", value: ""},
+	}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Errorf("Expected %q, got %q", expected, vars)
+	}
+}
+
+func TestParseEnvFileErrors(t *testing.T) {
+	testCases := map[string]string{
+		"line 2: expected NAME=VALUE":                       "A=1\nsecret-value\n",
+		`line 1: invalid variable name "1A"`:                "1A=secret-value\n",
+		"line 1: invalid value of A: missing closing quote": "A=\"secret-value\n",
+		"line 3: invalid value of B: unexpected text after": "# comment\n\nB='secret' value\n",
+	}
+
+	for expected, content := range testCases {
+		_, err := parseEnvFile(strings.NewReader(content))
+		if err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("Expected the error %q, got %v", expected, err)
+		}
+		if err != nil && strings.Contains(err.Error(), "secret") {
+			t.Errorf("Expected the error not to contain the value, got %v", err)
+		}
+	}
+}
+
+func TestLoadEnvFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "first.env")
+	second := filepath.Join(dir, "second.env")
+	if err = ioutil.WriteFile(first, []byte("LEGO_TEST_A=first\nLEGO_TEST_B=first\nLEGO_TEST_SET=first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(second, []byte("LEGO_TEST_B=second\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("LEGO_TEST_SET", "environment")
+	defer func() {
+		for _, name := range []string{"LEGO_TEST_A", "LEGO_TEST_B", "LEGO_TEST_SET"} {
+			os.Unsetenv(name)
+		}
+	}()
+
+	if err = loadEnvFiles([]string{first, second}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{"LEGO_TEST_A": "first", "LEGO_TEST_B": "second", "LEGO_TEST_SET": "environment"}
+	for name, value := range expected {
+		if got := os.Getenv(name); got != value {
+			t.Errorf("Expected %s=%s, got %s", name, value, got)
+		}
+	}
+
+	if err = loadEnvFiles([]string{filepath.Join(dir, "missing.env")}); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
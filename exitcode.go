@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+	"github.com/xenolf/lego/log"
+)
+
+// The exit codes of lego, from sysexits.h, by class of failure.
+// 1 is kept for the failures of no other class, e.g. a certificate which cannot be encoded.
+const (
+	exitCodeFailure = 1
+
+	// exitCodeUsage is EX_USAGE: a flag, an environment variable or a file given to lego is invalid.
+	exitCodeUsage = 64
+
+	// exitCodeChallenge is EX_DATAERR: the CA could not validate a challenge of a domain.
+	exitCodeChallenge = 65
+
+	// exitCodeRateLimited is EX_UNAVAILABLE: the CA rate limited the account or was unavailable.
+	exitCodeRateLimited = 69
+
+	// exitCodeNetwork is EX_TEMPFAIL: the CA could not be reached, or a certificate was not obtained within --cert.timeout.
+	// Unlike a validation failure, the command can be retried later.
+	exitCodeNetwork = 75
+
+	// exitCodeAccount is EX_NOPERM: the account is not registered, could not be registered,
+	// or the CA refused it, e.g. because the TOS were not accepted.
+	exitCodeAccount = 77
+
+	// exitCodeRevoked is EX_NOINPUT, not used otherwise: the OCSP responder reports a certificate as revoked, see --ocsp.
+	exitCodeRevoked = 66
+
+	// exitCodeSave is EX_CANTCREAT: a file of a certificate or of an account could not be written.
+	exitCodeSave = 73
+
+	// exitCodeStorage is EX_IOERR: the storage of the certificates could not be opened, read or listed.
+	exitCodeStorage = 74
+)
+
+// The error types of the failures, the errorType of the report with --json.
+const (
+	errorTypeUsage              = "usage"
+	errorTypeInvalidProfile     = "invalidProfile"
+	errorTypeTooManyIdentifiers = "tooManyIdentifiers"
+	errorTypeChallenge          = "challenge"
+	errorTypeRateLimited        = "rateLimited"
+	errorTypeNetwork            = "network"
+	errorTypeTimeout            = "timeout"
+	errorTypeAccount            = "account"
+	errorTypeTOS                = "tos"
+	errorTypeExternalAccount    = "externalAccountRequired"
+	errorTypeRevoked            = "revoked"
+	errorTypeSave               = "save"
+	errorTypeStorage            = "storage"
+
+	// errorTypeACME is a problem document of the CA of no other type.
+	errorTypeACME = "acme"
+	// errorTypeOther is an error of no other type.
+	errorTypeOther = "other"
+)
+
+// usageError is an error caused by a flag or a file given to lego, of the error type usage.
+type usageError struct {
+	error
+}
+
+func (e usageError) Unwrap() error { return e.error }
+
+// saveError is an error writing a file of a certificate, of the error type save.
+type saveError struct {
+	error
+}
+
+func (e saveError) Unwrap() error { return e.error }
+
+// exitCodes are the exit codes of the error types, exitCodeFailure for the others.
+var exitCodes = map[string]int{
+	errorTypeUsage:              exitCodeUsage,
+	errorTypeInvalidProfile:     exitCodeUsage,
+	errorTypeTooManyIdentifiers: exitCodeUsage,
+	errorTypeChallenge:          exitCodeChallenge,
+	errorTypeRateLimited:        exitCodeRateLimited,
+	errorTypeNetwork:            exitCodeNetwork,
+	errorTypeTimeout:            exitCodeNetwork,
+	errorTypeAccount:            exitCodeAccount,
+	errorTypeTOS:                exitCodeAccount,
+	errorTypeExternalAccount:    exitCodeAccount,
+	errorTypeRevoked:            exitCodeRevoked,
+	errorTypeSave:               exitCodeSave,
+	errorTypeStorage:            exitCodeStorage,
+}
+
+// exitCode returns the exit code of the error type.
+func exitCode(errType string) int {
+	if code, ok := exitCodes[errType]; ok {
+		return code
+	}
+	return exitCodeFailure
+}
+
+// fatalf logs the error of the command, of the given error type, and exits with its exit code.
+// With --json, the report is written first.
+func fatalf(errType, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Print(msg)
+
+	if report != nil {
+		report.mu.Lock()
+		report.Success = false
+		report.Error = msg
+		report.ErrorType = errType
+		report.mu.Unlock()
+	}
+	exit(exitCode(errType))
+}
+
+// fatalErr logs the error of the command and exits with the exit code of its type.
+// An error of no particular type is given the type fallback, e.g. the account for the errors of a registration.
+func fatalErr(fallback string, err error, format string, args ...interface{}) {
+	errType := errorType(context.Background(), err)
+	if errType == errorTypeOther || errType == errorTypeACME {
+		errType = fallback
+	}
+	fatalf(errType, format, args...)
+}
+
+// exit logs the summary of the challenges, writes the report with --json, with the exit code, and exits.
+func exit(code int) {
+	logChallengeSummary()
+
+	if report != nil {
+		report.ExitCode = code
+		writeReport()
+	}
+	os.Exit(code)
+}
+
+// onUsageError exits with exitCodeUsage on an invalid flag.
+func onUsageError(c *cli.Context, err error, isSubcommand bool) error {
+	fatalf(errorTypeUsage, "Incorrect usage: %v. Run 'lego help' for the flags.", err)
+	return err
+}
+
+// setOnUsageError sets onUsageError on the commands and their subcommands.
+func setOnUsageError(commands []cli.Command) {
+	for i := range commands {
+		commands[i].OnUsageError = onUsageError
+		setOnUsageError(commands[i].Subcommands)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestExitCode(t *testing.T) {
+	testCases := map[string]int{
+		errorTypeUsage:            exitCodeUsage,
+		"invalidProfile":          exitCodeUsage,
+		"tooManyIdentifiers":      exitCodeUsage,
+		"challenge":               exitCodeChallenge,
+		"rateLimited":             exitCodeRateLimited,
+		"network":                 exitCodeNetwork,
+		"timeout":                 exitCodeNetwork,
+		errorTypeAccount:          exitCodeAccount,
+		"tos":                     exitCodeAccount,
+		"externalAccountRequired": exitCodeAccount,
+		errorTypeRevoked:          exitCodeRevoked,
+		"save":                    exitCodeSave,
+		"storage":                 exitCodeStorage,
+		"acme":                    exitCodeFailure,
+		"other":                   exitCodeFailure,
+	}
+
+	for errType, expected := range testCases {
+		if got := exitCode(errType); got != expected {
+			t.Errorf("Expected the exit code %d for %s, got %d", expected, errType, got)
+		}
+	}
+}
+
+func TestBatchExitCode(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		errTypes []string
+		expected int
+	}{
+		{desc: "one failure", errTypes: []string{"rateLimited"}, expected: exitCodeRateLimited},
+		{desc: "same type", errTypes: []string{"challenge", "challenge"}, expected: exitCodeChallenge},
+		{desc: "different types", errTypes: []string{"challenge", "network"}, expected: exitCodeFailure},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			var failures []batchFailure
+			for _, errType := range test.errTypes {
+				failures = append(failures, batchFailure{domain: "example.com", errType: errType})
+			}
+
+			if got := batchExitCode(failures); got != test.expected {
+				t.Errorf("Expected %d, got %d", test.expected, got)
+			}
+		})
+	}
+}
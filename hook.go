@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/log"
+)
+
+// runCertHook runs the hook command of the given flag, if set, once the certificate was saved.
+// lego exits with an error if the hook fails.
+func runCertHook(c *cli.Context, flag string, certRes *acme.CertificateResource, conf *Configuration) {
+	if c.String(flag) == "" {
+		return
+	}
+
+	timeout := time.Duration(c.Int("hook-timeout")) * time.Second
+	if err := runHook(c.String(flag), timeout, certRes, conf); err != nil {
+		fatalCertError(context.Background(), certRes.Domain, fmt.Errorf("[%s] %w", certRes.Domain, err))
+	}
+}
+
+// runHook runs the command with the shell once the certificate was saved,
+// with the environment variables describing the certificate.
+// The output of the command is streamed to the output of the logs of lego, stderr with --json.
+// The command is killed if it does not finish within timeout.
+func runHook(command string, timeout time.Duration, certRes *acme.CertificateResource, conf *Configuration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	env, err := hookEnv(certRes, conf)
+	if err != nil {
+		return err
+	}
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = log.Logger.Writer()
+	cmd.Stderr = os.Stderr
+
+	log.Printf("[%s] Running the hook: %s", certRes.Domain, command)
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("the hook did not finish within %s", timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("the hook failed: %v", err)
+	}
+	return nil
+}
+
+// hookEnv returns the environment variables describing the saved certificate.
+func hookEnv(certRes *acme.CertificateResource, conf *Configuration) ([]string, error) {
+	leaf, err := certRes.Leaf()
+	if err != nil {
+		return nil, err
+	}
+
+	sans := certificateSANs(leaf)
+
+	domainName := certFileName(certRes, conf)
+
+	// the private key is unknown if the certificate was obtained for a CSR.
+	var keyPath string
+	if certRes.PrivateKey != nil {
+		keyPath = conf.CertStorage().Location(domainName, keyExt)
+	}
+
+	return []string{
+		"LEGO_CERT_DOMAIN=" + certRes.Domain,
+		"LEGO_CERT_PATH=" + conf.CertStorage().Location(domainName, certExt),
+		"LEGO_CERT_KEY_PATH=" + keyPath,
+		"LEGO_CERT_SANS=" + strings.Join(sans, ","),
+	}, nil
+}
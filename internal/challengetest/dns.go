@@ -0,0 +1,388 @@
+// Package challengetest runs in-process DNS and HTTP servers for the tests of the challenge solvers and the providers,
+// so that they can exercise a complete challenge without the network.
+// It also records the log of the tests, e.g. to check that no secret is logged.
+package challengetest
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/xenolf/lego/challenge/dns01"
+)
+
+const ttl = 60
+
+// DNSServer is an authoritative nameserver of a single zone, answering the SOA, NS, A, AAAA, TXT and CNAME queries.
+// It also answers the recursive queries for the zone,
+// so that it can be used as acme.RecursiveNameservers and as the authoritative nameserver at once.
+//
+// Its TXT records are changed by the tests, by Present and CleanUp as a dns-01 provider,
+// or by the RFC 2136 dynamic updates of the zone.
+// The names out of the zone are refused.
+type DNSServer struct {
+	zone   string
+	addr   string
+	ip     net.IP
+	server *dns.Server
+
+	mu      sync.Mutex
+	txt     map[string][]string
+	cnames  map[string]string
+	rcodes  map[string]int
+	queries int
+}
+
+// NewDNSServer starts the nameserver of zone on a random UDP port of 127.0.0.1.
+// The server must be stopped with Close.
+func NewDNSServer(tb testing.TB, zone string) *DNSServer {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("challengetest: could not start the DNS server: %v", err)
+	}
+	return startDNSServer(pc, zone)
+}
+
+// NewDNSServer6 starts the nameserver of zone on a random UDP port of ::1,
+// whose nameservers have AAAA records only, as the nameservers seen from an IPv6-only host.
+// The test is skipped if the host has no IPv6 loopback.
+// The server must be stopped with Close.
+func NewDNSServer6(tb testing.TB, zone string) *DNSServer {
+	pc, err := net.ListenPacket("udp6", "[::1]:0")
+	if err != nil {
+		tb.Skipf("challengetest: IPv6 is not available: %v", err)
+	}
+	return startDNSServer(pc, zone)
+}
+
+func startDNSServer(pc net.PacketConn, zone string) *DNSServer {
+	s := &DNSServer{
+		zone:   canonical(zone),
+		addr:   pc.LocalAddr().String(),
+		ip:     pc.LocalAddr().(*net.UDPAddr).IP,
+		txt:    make(map[string][]string),
+		cnames: make(map[string]string),
+		rcodes: make(map[string]int),
+	}
+
+	started := make(chan struct{})
+	s.server = &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(s.serveDNS), NotifyStartedFunc: func() { close(started) }}
+	go s.server.ActivateAndServe()
+	<-started
+
+	return s
+}
+
+// Close stops the server.
+func (s *DNSServer) Close() {
+	s.server.Shutdown()
+}
+
+// Addr returns the host:port address of the server.
+func (s *DNSServer) Addr() string {
+	return s.addr
+}
+
+// Zone returns the fqdn of the zone of the server.
+func (s *DNSServer) Zone() string {
+	return s.zone
+}
+
+// Nameservers returns the names of the NS records of the zone, all resolving to the IP address of the server.
+func (s *DNSServer) Nameservers() []string {
+	return []string{"ns1." + s.zone, "ns2." + s.zone}
+}
+
+// Queries returns the number of queries answered by the server.
+func (s *DNSServer) Queries() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries
+}
+
+// AddTXT adds the values to the TXT records of fqdn.
+func (s *DNSServer) AddTXT(fqdn string, values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := canonical(fqdn)
+	for _, value := range values {
+		s.addTXT(name, value)
+	}
+}
+
+// RemoveTXT removes the given values from the TXT records of fqdn, all its TXT records if no value is given.
+func (s *DNSServer) RemoveTXT(fqdn string, values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := canonical(fqdn)
+	if len(values) == 0 {
+		delete(s.txt, name)
+		return
+	}
+
+	for _, value := range values {
+		s.removeTXT(name, value)
+	}
+}
+
+// TXT returns the values of the TXT records of fqdn.
+func (s *DNSServer) TXT(fqdn string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.txt[canonical(fqdn)]...)
+}
+
+// AddCNAME adds a CNAME record from fqdn to target.
+// A target in the zone is resolved in the answers, as a recursive nameserver would.
+func (s *DNSServer) AddCNAME(fqdn, target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cnames[canonical(fqdn)] = canonical(target)
+}
+
+// SetRcode makes the server answer the queries of fqdn with rcode only, e.g. dns.RcodeServerFailure.
+func (s *DNSServer) SetRcode(fqdn string, rcode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rcodes[canonical(fqdn)] = rcode
+}
+
+// Present adds the TXT record of the dns-01 challenge of domain: the server is a dns-01 provider of its zone.
+func (s *DNSServer) Present(domain, token, keyAuth string) error {
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	s.AddTXT(fqdn, value)
+	return nil
+}
+
+// CleanUp removes the TXT record added by Present.
+func (s *DNSServer) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	s.RemoveTXT(fqdn, value)
+	return nil
+}
+
+func (s *DNSServer) serveDNS(w dns.ResponseWriter, req *dns.Msg) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queries++
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Authoritative = true
+	m.RecursionAvailable = true
+
+	if len(req.Question) != 1 {
+		m.Rcode = dns.RcodeFormatError
+		w.WriteMsg(m)
+		return
+	}
+
+	switch req.Opcode {
+	case dns.OpcodeQuery:
+		s.answer(m, req.Question[0])
+	case dns.OpcodeUpdate:
+		s.update(m, req)
+	default:
+		m.Rcode = dns.RcodeNotImplemented
+	}
+
+	w.WriteMsg(m)
+}
+
+// answer fills the reply to the question q, following the CNAME records of the zone.
+func (s *DNSServer) answer(m *dns.Msg, q dns.Question) {
+	name := canonical(q.Name)
+	if !dns.IsSubDomain(s.zone, name) {
+		m.Rcode = dns.RcodeRefused
+		return
+	}
+	if rcode, ok := s.rcodes[name]; ok {
+		m.Rcode = rcode
+		return
+	}
+
+	for i := 0; i < 10; i++ {
+		target, ok := s.cnames[name]
+		if !ok || q.Qtype == dns.TypeCNAME {
+			break
+		}
+
+		m.Answer = append(m.Answer, &dns.CNAME{Hdr: s.header(name, dns.TypeCNAME), Target: target})
+		if !dns.IsSubDomain(s.zone, target) {
+			return
+		}
+		name = target
+	}
+
+	m.Answer = append(m.Answer, s.records(name, q.Qtype)...)
+	if len(m.Answer) > 0 {
+		return
+	}
+
+	// A negative answer carries the SOA of the zone in the authority section.
+	m.Ns = append(m.Ns, s.soa())
+	if !s.exists(name) {
+		m.Rcode = dns.RcodeNameError
+	}
+}
+
+// records returns the records of the zone of the given name and type.
+func (s *DNSServer) records(name string, qtype uint16) []dns.RR {
+	var rrs []dns.RR
+
+	switch qtype {
+	case dns.TypeSOA:
+		if name == s.zone {
+			rrs = append(rrs, s.soa())
+		}
+	case dns.TypeNS:
+		if name == s.zone {
+			for _, ns := range s.Nameservers() {
+				rrs = append(rrs, &dns.NS{Hdr: s.header(name, dns.TypeNS), Ns: ns})
+			}
+		}
+	case dns.TypeA:
+		for _, ns := range s.Nameservers() {
+			if name == ns && s.ip.To4() != nil {
+				rrs = append(rrs, &dns.A{Hdr: s.header(name, dns.TypeA), A: s.ip})
+			}
+		}
+	case dns.TypeAAAA:
+		for _, ns := range s.Nameservers() {
+			if name == ns && s.ip.To4() == nil {
+				rrs = append(rrs, &dns.AAAA{Hdr: s.header(name, dns.TypeAAAA), AAAA: s.ip})
+			}
+		}
+	case dns.TypeTXT:
+		for _, value := range s.txt[name] {
+			rrs = append(rrs, &dns.TXT{Hdr: s.header(name, dns.TypeTXT), Txt: []string{value}})
+		}
+	case dns.TypeCNAME:
+		if target, ok := s.cnames[name]; ok {
+			rrs = append(rrs, &dns.CNAME{Hdr: s.header(name, dns.TypeCNAME), Target: target})
+		}
+	}
+
+	return rrs
+}
+
+// exists returns true if the zone has records at name or below it.
+func (s *DNSServer) exists(name string) bool {
+	if name == s.zone {
+		return true
+	}
+
+	names := s.Nameservers()
+	for n := range s.txt {
+		names = append(names, n)
+	}
+	for n := range s.cnames {
+		names = append(names, n)
+	}
+
+	for _, n := range names {
+		if dns.IsSubDomain(name, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// update applies the RFC 2136 dynamic update req to the TXT records of the zone.
+func (s *DNSServer) update(m *dns.Msg, req *dns.Msg) {
+	if canonical(req.Question[0].Name) != s.zone {
+		m.Rcode = dns.RcodeNotZone
+		return
+	}
+
+	for _, rr := range req.Ns {
+		if rr.Header().Rrtype != dns.TypeTXT {
+			m.Rcode = dns.RcodeNotImplemented
+			return
+		}
+
+		name := canonical(rr.Header().Name)
+		if !dns.IsSubDomain(s.zone, name) {
+			m.Rcode = dns.RcodeNotZone
+			return
+		}
+
+		// RemoveRRset: all the TXT records of the name.
+		if rr.Header().Class == dns.ClassANY {
+			delete(s.txt, name)
+			continue
+		}
+
+		txt, ok := rr.(*dns.TXT)
+		if !ok {
+			m.Rcode = dns.RcodeFormatError
+			return
+		}
+
+		// Remove: the TXT record with the given value, Insert otherwise.
+		if rr.Header().Class == dns.ClassNONE {
+			s.removeTXT(name, strings.Join(txt.Txt, ""))
+		} else {
+			s.addTXT(name, strings.Join(txt.Txt, ""))
+		}
+	}
+}
+
+func (s *DNSServer) addTXT(name, value string) {
+	if !contains(s.txt[name], value) {
+		s.txt[name] = append(s.txt[name], value)
+	}
+}
+
+func (s *DNSServer) removeTXT(name, value string) {
+	var kept []string
+	for _, v := range s.txt[name] {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	if len(kept) == 0 {
+		delete(s.txt, name)
+		return
+	}
+	s.txt[name] = kept
+}
+
+func (s *DNSServer) soa() dns.RR {
+	return &dns.SOA{
+		Hdr:     s.header(s.zone, dns.TypeSOA),
+		Ns:      s.Nameservers()[0],
+		Mbox:    "hostmaster." + s.zone,
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  ttl,
+	}
+}
+
+func (s *DNSServer) header(name string, rrtype uint16) dns.RR_Header {
+	return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: ttl}
+}
+
+// canonical returns the lowercase fqdn of name.
+func canonical(name string) string {
+	return strings.ToLower(dns.Fqdn(name))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
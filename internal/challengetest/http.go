@@ -0,0 +1,90 @@
+package challengetest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// challengePath is the path of the http-01 challenges, followed by their token.
+const challengePath = "/.well-known/acme-challenge/"
+
+// HTTPServer serves the key authorizations of the http-01 challenges:
+// it is an http-01 provider, whose Present and CleanUp add and remove the tokens it serves.
+// The unknown tokens are not found.
+type HTTPServer struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	keyAuths map[string]string
+	requests int
+}
+
+// NewHTTPServer starts the server on a random port of 127.0.0.1.
+// The server must be stopped with Close.
+func NewHTTPServer() *HTTPServer {
+	s := &HTTPServer{keyAuths: make(map[string]string)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Close stops the server.
+func (s *HTTPServer) Close() {
+	s.server.Close()
+}
+
+// URL returns the base URL of the server, e.g. http://127.0.0.1:1234.
+func (s *HTTPServer) URL() string {
+	return s.server.URL
+}
+
+// Addr returns the host:port address of the server.
+func (s *HTTPServer) Addr() string {
+	return strings.TrimPrefix(s.server.URL, "http://")
+}
+
+// ChallengeURL returns the URL of the challenge of token.
+func (s *HTTPServer) ChallengeURL(token string) string {
+	return s.server.URL + challengePath + token
+}
+
+// Requests returns the number of challenge requests received by the server.
+func (s *HTTPServer) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Present serves the key authorization of the challenge of token.
+func (s *HTTPServer) Present(domain, token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keyAuths[token] = keyAuth
+	return nil
+}
+
+// CleanUp stops serving the challenge of token.
+func (s *HTTPServer) CleanUp(domain, token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keyAuths, token)
+	return nil
+}
+
+func (s *HTTPServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	keyAuth, ok := s.keyAuths[strings.TrimPrefix(r.URL.Path, challengePath)]
+	s.mu.Unlock()
+
+	if r.Method != http.MethodGet || !strings.HasPrefix(r.URL.Path, challengePath) || !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(keyAuth))
+}
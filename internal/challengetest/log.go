@@ -0,0 +1,64 @@
+package challengetest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/xenolf/lego/log"
+)
+
+// LogRecorder records the entries of the leveled log, e.g. to check that no secret is logged.
+type LogRecorder struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+// RecordLogs records the entries of the leveled log until Stop.
+func RecordLogs() *LogRecorder {
+	r := &LogRecorder{}
+	log.SetLogger(r)
+	return r
+}
+
+// Stop restores the default logger.
+func (r *LogRecorder) Stop() {
+	log.SetLogger(nil)
+}
+
+func (r *LogRecorder) Debugf(format string, args ...interface{}) { r.record("debug", format, args) }
+func (r *LogRecorder) Infof(format string, args ...interface{})  { r.record("info", format, args) }
+func (r *LogRecorder) Warnf(format string, args ...interface{})  { r.record("warn", format, args) }
+func (r *LogRecorder) Errorf(format string, args ...interface{}) { r.record("error", format, args) }
+
+func (r *LogRecorder) record(level, format string, args []interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, level+": "+fmt.Sprintf(format, args...))
+}
+
+// Entries returns the entries recorded, prefixed by their level, e.g. "info: ...".
+func (r *LogRecorder) Entries() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.entries...)
+}
+
+// AssertNoSecrets fails the test if an entry contains one of the secrets.
+// It also fails if nothing was logged, as the test would then check nothing.
+func (r *LogRecorder) AssertNoSecrets(tb testing.TB, secrets ...string) {
+	tb.Helper()
+
+	entries := r.Entries()
+	if len(entries) == 0 {
+		tb.Error("Expected log entries to check")
+	}
+	for _, entry := range entries {
+		for _, secret := range secrets {
+			if secret != "" && strings.Contains(entry, secret) {
+				tb.Errorf("Expected no secret in the log, got %q", entry)
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli"
+	"github.com/xenolf/lego/acme"
+)
+
+// certificateInfo describes a certificate of the storage path.
+// Error is set instead of the other fields if the file could not be parsed.
+type certificateInfo struct {
+	Path          string     `json:"path"`
+	Domain        string     `json:"domain,omitempty"`
+	SANs          []string   `json:"sans,omitempty"`
+	SerialNumber  string     `json:"serialNumber,omitempty"`
+	NotAfter      *time.Time `json:"notAfter,omitempty"`
+	DaysRemaining *int       `json:"daysRemaining,omitempty"`
+	KeyType       string     `json:"keyType,omitempty"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// accountInfo describes an account of the storage path.
+// Error is set instead of the other fields if the file could not be parsed.
+type accountInfo struct {
+	Path   string `json:"path"`
+	Server string `json:"server"`
+	Email  string `json:"email"`
+	Status string `json:"status,omitempty"`
+	URI    string `json:"uri,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func list(c *cli.Context) error {
+	conf := NewConfiguration(c)
+
+	if c.Bool("accounts") {
+		accounts, err := listAccounts(filepath.Join(c.GlobalString("path"), "accounts"))
+		if err != nil {
+			fatalf(errorTypeStorage, "Could not list the accounts: %v", err)
+		}
+		return printList(c, accounts, printAccounts)
+	}
+
+	certificates, err := listCertificates(conf.CertStorage(), time.Now())
+	if err != nil {
+		fatalf(errorTypeStorage, "Could not list the certificates: %v", err)
+	}
+	return printList(c, certificates, printCertificates)
+}
+
+// printList writes the entries as JSON with --json, with the print function otherwise.
+func printList(c *cli.Context, entries interface{}, print func(w *tabwriter.Writer, entries interface{})) error {
+	if c.Bool("json") || c.GlobalBool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "\t")
+		return encoder.Encode(entries)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	print(w, entries)
+	return w.Flush()
+}
+
+func printCertificates(w *tabwriter.Writer, entries interface{}) {
+	certificates := entries.([]certificateInfo)
+	if len(certificates) == 0 {
+		fmt.Fprintln(w, "No certificates found.")
+		return
+	}
+
+	fmt.Fprintln(w, "DOMAIN\tSANS\tSERIAL\tNOT AFTER\tDAYS\tKEY TYPE\tPATH")
+	for _, cert := range certificates {
+		if cert.Error != "" {
+			fmt.Fprintf(w, "-\t-\t-\t-\t-\t-\t%s (error: %s)\n", cert.Path, cert.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", cert.Domain, strings.Join(cert.SANs, ","), cert.SerialNumber,
+			cert.NotAfter.Format(time.RFC3339), *cert.DaysRemaining, cert.KeyType, cert.Path)
+	}
+}
+
+func printAccounts(w *tabwriter.Writer, entries interface{}) {
+	accounts := entries.([]accountInfo)
+	if len(accounts) == 0 {
+		fmt.Fprintln(w, "No accounts found.")
+		return
+	}
+
+	fmt.Fprintln(w, "SERVER\tEMAIL\tSTATUS\tURI")
+	for _, acc := range accounts {
+		if acc.Error != "" {
+			fmt.Fprintf(w, "%s\t%s\t\t%s (error: %s)\n", acc.Server, acc.Email, acc.Path, acc.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", acc.Server, acc.Email, acc.Status, acc.URI)
+	}
+}
+
+// listCertificates describes the certificates of the storage.
+// A file which cannot be parsed is reported by its entry, and does not abort the listing.
+func listCertificates(store CertStorage, now time.Time) ([]certificateInfo, error) {
+	names, err := store.ListResources()
+	if err != nil {
+		return nil, err
+	}
+
+	certificates := []certificateInfo{}
+	for _, name := range names {
+		info, err := readCertificateInfo(store, name, now)
+		if err != nil {
+			info = certificateInfo{Path: store.Location(name, certExt), Error: err.Error()}
+		}
+		certificates = append(certificates, info)
+	}
+	return certificates, nil
+}
+
+func readCertificateInfo(store CertStorage, name string, now time.Time) (certificateInfo, error) {
+	certBytes, err := store.LoadResource(name, certExt)
+	if err != nil {
+		return certificateInfo{}, err
+	}
+
+	certificates, err := acme.ParsePEMBundle(certBytes)
+	if err != nil {
+		return certificateInfo{}, err
+	}
+	leaf := certificates[0]
+
+	sans := certificateSANs(leaf)
+
+	domain := leaf.Subject.CommonName
+	if domain == "" && len(sans) > 0 {
+		domain = sans[0]
+	}
+
+	notAfter := leaf.NotAfter.UTC()
+	daysRemaining := int(notAfter.Sub(now).Hours() / 24)
+
+	return certificateInfo{
+		Path:          store.Location(name, certExt),
+		Domain:        domain,
+		SANs:          sans,
+		SerialNumber:  fmt.Sprintf("%x", leaf.SerialNumber),
+		NotAfter:      &notAfter,
+		DaysRemaining: &daysRemaining,
+		KeyType:       certificateKeyType(leaf),
+	}, nil
+}
+
+// certificateSANs returns the DNS names and the IP addresses of the certificate.
+func certificateSANs(cert *x509.Certificate) []string {
+	sans := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return sans
+}
+
+// certificateKeyType returns the key type of the certificate,
+// with the names of the --key-type flag if possible.
+func certificateKeyType(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("rsa%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ec%d", key.Curve.Params().BitSize)
+	default:
+		return cert.PublicKeyAlgorithm.String()
+	}
+}
+
+// listAccounts describes the accounts of the directory, by ACME server and email.
+// An account which cannot be parsed is reported by its entry, and does not abort the listing.
+func listAccounts(accountsPath string) ([]accountInfo, error) {
+	accounts := []accountInfo{}
+
+	err := filepath.Walk(accountsPath, func(path string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == accountsPath {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || fi.Name() != "account.json" {
+			return nil
+		}
+
+		// the accounts are stored in <accounts>/<server>/<email>/account.json
+		accountDir := filepath.Dir(path)
+		server, err := filepath.Rel(accountsPath, filepath.Dir(accountDir))
+		if err != nil {
+			return err
+		}
+
+		info := accountInfo{Path: path, Server: filepath.ToSlash(server), Email: filepath.Base(accountDir)}
+		if err := readAccountInfo(path, &info); err != nil {
+			info.Error = err.Error()
+		}
+		accounts = append(accounts, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+func readAccountInfo(file string, info *accountInfo) error {
+	fileBytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var acc Account
+	if err := json.Unmarshal(fileBytes, &acc); err != nil {
+		return err
+	}
+
+	if acc.Email != "" {
+		info.Email = acc.Email
+	}
+	if acc.Registration != nil {
+		info.Status = acc.Registration.Body.Status
+		info.URI = acc.Registration.URI
+	}
+	return nil
+}
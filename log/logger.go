@@ -1,13 +1,85 @@
 package log
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strings"
 )
 
 // Logger is an optional custom logger.
 var Logger = log.New(os.Stdout, "", log.LstdFlags)
 
+// LeveledLogger is a logger with levels,
+// which allows to plug lego into a structured logging library.
+type LeveledLogger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// leveled is the logger used by Debugf, Infof, Warnf and Errorf.
+var leveled LeveledLogger = stdLogger{}
+
+// SetLogger sets the logger used by Debugf, Infof, Warnf and Errorf.
+// It must be called before using lego.
+// If l is nil, the entries are written to Logger with a level prefix, which is the default.
+func SetLogger(l LeveledLogger) {
+	if l == nil {
+		l = stdLogger{}
+	}
+	leveled = l
+}
+
+// Level is the level of a log entry.
+type Level int
+
+// The levels of the log entries, from the most verbose.
+const (
+	// LevelDebug is the level of the details of the operations, e.g. the attempts of the DNS propagation checks.
+	LevelDebug Level = iota
+	// LevelInfo is the level of the lifecycle of the challenges and of the certificates.
+	LevelInfo
+	// LevelWarn is the level of the recoverable failures, e.g. the retried requests.
+	LevelWarn
+	// LevelError is the level of the failures.
+	LevelError
+)
+
+var levelNames = map[Level]string{LevelDebug: "debug", LevelInfo: "info", LevelWarn: "warn", LevelError: "error"}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// ParseLevel returns the level of its name: debug, info, warn or error.
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	if strings.EqualFold(name, "warning") {
+		return LevelWarn, nil
+	}
+	return LevelDebug, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", name)
+}
+
+// minLevel is the level of the least severe entries written by the default logger.
+var minLevel = LevelInfo
+
+// SetLevel sets the level of the least severe entries written to Logger by Debugf, Infof, Warnf and Errorf,
+// LevelInfo by default.
+// It does not apply to a logger set with SetLogger, which filters the entries itself.
+// It must be called before using lego.
+func SetLevel(level Level) {
+	minLevel = level
+}
+
 // Fatal writes a log entry.
 // It uses Logger if not nil, otherwise it uses the default log.Logger.
 func Fatal(args ...interface{}) {
@@ -38,12 +110,47 @@ func Printf(format string, args ...interface{}) {
 	Logger.Printf(format, args...)
 }
 
-// Warnf writes a log entry.
-func Warnf(format string, args ...interface{}) {
-	Printf("[WARN] "+format, args...)
+// Debugf writes a debug log entry.
+func Debugf(format string, args ...interface{}) {
+	leveled.Debugf(format, args...)
 }
 
-// Infof writes a log entry.
+// Infof writes an info log entry.
 func Infof(format string, args ...interface{}) {
-	Printf("[INFO] "+format, args...)
+	leveled.Infof(format, args...)
+}
+
+// Warnf writes a warning log entry.
+func Warnf(format string, args ...interface{}) {
+	leveled.Warnf(format, args...)
+}
+
+// Errorf writes an error log entry.
+func Errorf(format string, args ...interface{}) {
+	leveled.Errorf(format, args...)
+}
+
+// stdLogger writes the entries of SetLevel and above to Logger, with a level prefix.
+type stdLogger struct{}
+
+func (stdLogger) Debugf(format string, args ...interface{}) {
+	if minLevel <= LevelDebug {
+		Printf("[DEBUG] "+format, args...)
+	}
+}
+
+func (stdLogger) Infof(format string, args ...interface{}) {
+	if minLevel <= LevelInfo {
+		Printf("[INFO] "+format, args...)
+	}
+}
+
+func (stdLogger) Warnf(format string, args ...interface{}) {
+	if minLevel <= LevelWarn {
+		Printf("[WARN] "+format, args...)
+	}
+}
+
+func (stdLogger) Errorf(format string, args ...interface{}) {
+	Printf("[ERROR] "+format, args...)
 }
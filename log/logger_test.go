@@ -0,0 +1,95 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+)
+
+type recordingLogger struct {
+	entries []string
+}
+
+func (r *recordingLogger) Debugf(format string, args ...interface{}) {
+	r.entries = append(r.entries, "debug: "+fmt.Sprintf(format, args...))
+}
+
+func (r *recordingLogger) Infof(format string, args ...interface{}) {
+	r.entries = append(r.entries, "info: "+fmt.Sprintf(format, args...))
+}
+
+func (r *recordingLogger) Warnf(format string, args ...interface{}) {
+	r.entries = append(r.entries, "warn: "+fmt.Sprintf(format, args...))
+}
+
+func (r *recordingLogger) Errorf(format string, args ...interface{}) {
+	r.entries = append(r.entries, "error: "+fmt.Sprintf(format, args...))
+}
+
+func TestSetLogger(t *testing.T) {
+	defer SetLogger(nil)
+
+	rec := &recordingLogger{}
+	SetLogger(rec)
+
+	Debugf("a %d", 1)
+	Infof("b %d", 2)
+	Warnf("c %d", 3)
+	Errorf("d %d", 4)
+
+	expected := []string{"debug: a 1", "info: b 2", "warn: c 3", "error: d 4"}
+	if strings.Join(rec.entries, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected entries %v, got %v", expected, rec.entries)
+	}
+}
+
+func TestDefaultLogger(t *testing.T) {
+	defer func(l *log.Logger) { Logger = l }(Logger)
+
+	buf := &bytes.Buffer{}
+	Logger = log.New(buf, "", 0)
+
+	Infof("hello %s", "world")
+	Debugf("details")
+
+	// the debug entries are only written with SetLevel(LevelDebug).
+	if expected := "[INFO] hello world\n"; buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	defer func(l *log.Logger) { Logger = l }(Logger)
+	defer SetLevel(LevelInfo)
+
+	buf := &bytes.Buffer{}
+	Logger = log.New(buf, "", 0)
+
+	SetLevel(LevelDebug)
+	Debugf("details")
+	if expected := "[DEBUG] details\n"; buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+	buf.Reset()
+
+	level, err := ParseLevel("WARN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetLevel(level)
+
+	Debugf("details")
+	Infof("lifecycle")
+	Warnf("retrying")
+	Errorf("failed")
+
+	if expected := "[WARN] retrying\n[ERROR] failed\n"; buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+}
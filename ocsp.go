@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/log"
+)
+
+// revokedError is the error of a certificate reported as revoked by its OCSP responder, of the error type revoked.
+type revokedError struct {
+	domain    string
+	revokedAt time.Time
+}
+
+func (e revokedError) Error() string {
+	return fmt.Sprintf("[%s] the OCSP responder reports the certificate as revoked since %s", e.domain, e.revokedAt.Format(time.RFC3339))
+}
+
+// refreshOCSPStaple returns the OCSP staple of the certificate stored under name.
+// It is fetched and written in the ocspExt file of the certificate if the stored staple is missing,
+// if more than half of its validity elapsed, or if force is set: refreshed is then true.
+func refreshOCSPStaple(store CertStorage, name string, cert *acme.CertificateResource, force bool) (staple *acme.OCSPStaple, refreshed bool, err error) {
+	if !force {
+		if raw, err := store.LoadResource(name, ocspExt); err == nil {
+			if stored, err := acme.ParseOCSPStaple(raw); err == nil && !stored.NeedsRefresh(time.Now()) {
+				return stored, false, nil
+			}
+		}
+	}
+
+	staple, err = acme.GetOCSPStaple(*cert)
+	if err != nil {
+		return nil, false, err
+	}
+	if err = store.SaveResource(name, ocspExt, staple.Raw); err != nil {
+		return nil, false, err
+	}
+	return staple, true, nil
+}
+
+// stapleOCSP refreshes the OCSP staple of the certificate stored under name, see refreshOCSPStaple.
+// A staple reporting the certificate as revoked is written too, and a revokedError is returned.
+func stapleOCSP(conf *Configuration, name string, cert *acme.CertificateResource, force bool) error {
+	store := conf.CertStorage()
+
+	staple, refreshed, err := refreshOCSPStaple(store, name, cert, force)
+	if err != nil {
+		return fmt.Errorf("[%s] could not get the OCSP response: %w", cert.Domain, err)
+	}
+
+	validity := "without next update"
+	if !staple.NextUpdate.IsZero() {
+		validity = "valid until " + staple.NextUpdate.Format(time.RFC3339)
+	}
+	if refreshed {
+		log.Printf("[%s] Saved the OCSP staple %s, %s", cert.Domain, store.Location(name, ocspExt), validity)
+	} else {
+		log.Printf("[%s] Keeping the OCSP staple %s, %s", cert.Domain, store.Location(name, ocspExt), validity)
+	}
+
+	if staple.Status == acme.OCSPRevoked {
+		log.Warnf("[%s] !!!! The certificate is REVOKED since %s according to its OCSP responder: replace it !!!!",
+			cert.Domain, staple.RevokedAt.Format(time.RFC3339))
+		return revokedError{domain: cert.Domain, revokedAt: staple.RevokedAt}
+	}
+	return nil
+}
+
+// refreshOCSPFlag refreshes the OCSP staple of a saved certificate with --ocsp.
+// The certificate being saved, a failure to get the OCSP response is only logged:
+// only the revokedError of a revoked certificate is returned.
+func refreshOCSPFlag(c *cli.Context, conf *Configuration, cert *acme.CertificateResource, force bool) error {
+	if !c.Bool("ocsp") {
+		return nil
+	}
+
+	err := stapleOCSP(conf, certFileName(cert, conf), cert, force)
+	var revokedErr revokedError
+	if err != nil && !errors.As(err, &revokedErr) {
+		log.Errorf("%v", err)
+		return nil
+	}
+	return err
+}
+
+// refreshStoredOCSPFlag refreshes the OCSP staple of the certificate stored under name with --ocsp, see refreshOCSPFlag,
+// e.g. once its renewal was skipped.
+func refreshStoredOCSPFlag(c *cli.Context, conf *Configuration, name, domain string) error {
+	if !c.Bool("ocsp") {
+		return nil
+	}
+
+	cert, err := loadStoredCertResource(conf, name, domain)
+	if err != nil {
+		log.Errorf("[%s] Could not load the certificate to refresh its OCSP staple: %v", domain, err)
+		return nil
+	}
+	return refreshOCSPFlag(c, conf, cert, false)
+}
+
+// loadStoredCertResource reads the certificate stored under name, and its issuer certificate if any.
+func loadStoredCertResource(conf *Configuration, name, domain string) (*acme.CertificateResource, error) {
+	certBytes, err := loadStoredCertificate(conf, name)
+	if err != nil {
+		return nil, err
+	}
+
+	issuerBytes, err := conf.CertStorage().LoadResource(name, issuerExt)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return &acme.CertificateResource{Domain: domain, Certificate: certBytes, IssuerCertificate: issuerBytes}, nil
+}
+
+func ocspRefresh(c *cli.Context) error {
+	domains := c.GlobalStringSlice("domains")
+	if len(domains) == 0 {
+		fatalf(errorTypeUsage, "Please specify at least one domain.")
+	}
+
+	conf := NewConfiguration(c)
+	if err := conf.CertStorage().Check(); err != nil {
+		fatalf(errorTypeStorage, "Could not use the certificate storage: %v", err)
+	}
+
+	var failed, revoked bool
+	for _, domain := range domains {
+		name := storedCertName(conf, domain)
+		cert, err := loadStoredCertResource(conf, name, domain)
+		if err != nil {
+			log.Errorf("[%s] Could not load the certificate: %v", domain, err)
+			failed = true
+			continue
+		}
+
+		err = stapleOCSP(conf, name, cert, c.Bool("force"))
+		var revokedErr revokedError
+		switch {
+		case errors.As(err, &revokedErr):
+			revoked = true
+		case err != nil:
+			log.Errorf("%v", err)
+			failed = true
+		}
+	}
+
+	// a revoked certificate has its own exit code, even if other staples failed.
+	switch {
+	case revoked:
+		log.Print("Some certificates are revoked.")
+		exit(exitCodeRevoked)
+	case failed:
+		log.Fatal("Some OCSP staples could not be refreshed.")
+	}
+	return nil
+}
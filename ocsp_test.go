@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestRefreshOCSPStaple(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-ocsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := newFileCertStorage(dir, false)
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the certificate has no OCSP server: a refresh fails.
+	cert := &acme.CertificateResource{Domain: "example.com", Certificate: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+
+	storeResponse := func(thisUpdate time.Time) {
+		raw, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: template.SerialNumber,
+			ThisUpdate:   thisUpdate,
+			NextUpdate:   thisUpdate.Add(4 * 24 * time.Hour),
+		}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SaveResource("example.com", ocspExt, raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the stored response is kept until half of its validity elapsed.
+	storeResponse(time.Now().Add(-24 * time.Hour))
+	staple, refreshed, err := refreshOCSPStaple(store, "example.com", cert, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed || staple.Status != acme.OCSPGood {
+		t.Errorf("Expected the stored response to be kept, got %+v", staple)
+	}
+
+	if _, _, err := refreshOCSPStaple(store, "example.com", cert, true); err == nil {
+		t.Error("Expected a forced refresh to fetch a new response")
+	}
+
+	storeResponse(time.Now().Add(-3 * 24 * time.Hour))
+	if _, _, err := refreshOCSPStaple(store, "example.com", cert, false); err == nil {
+		t.Error("Expected the refresh of a response past half of its validity")
+	}
+
+	if err := store.DeleteResource("example.com", ocspExt); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := refreshOCSPStaple(store, "example.com", cert, false); err == nil {
+		t.Error("Expected a missing response to be fetched")
+	}
+}
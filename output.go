@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/log"
+)
+
+// commandReport is the outcome of the run, renew or revoke command,
+// written on stdout once the command finished with --json.
+type commandReport struct {
+	// mu protects the results, added concurrently by a batch.
+	mu sync.Mutex
+
+	Command string `json:"command"`
+	Success bool   `json:"success"`
+	// ExitCode is the exit code of lego.
+	// The error and its type are set if the command failed before processing the domains.
+	ExitCode  int            `json:"exitCode"`
+	Error     string         `json:"error,omitempty"`
+	ErrorType string         `json:"errorType,omitempty"`
+	Results   []domainResult `json:"results"`
+}
+
+// domainResult is the outcome of the command for a domain.
+// The certificate fields are set if the certificate is known, even if a later step failed.
+type domainResult struct {
+	Domain    string     `json:"domain"`
+	Success   bool       `json:"success"`
+	Skipped   bool       `json:"skipped,omitempty"`
+	Revoked   bool       `json:"revoked,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	ErrorType string     `json:"errorType,omitempty"`
+	Problem   *problem   `json:"problem,omitempty"`
+	CertPath  string     `json:"certPath,omitempty"`
+	KeyPath   string     `json:"keyPath,omitempty"`
+	SANs      []string   `json:"sans,omitempty"`
+	NotAfter  *time.Time `json:"notAfter,omitempty"`
+}
+
+// problem is the problem of the CA for a domain, e.g. the error of its challenge.
+type problem struct {
+	Type             string                  `json:"type,omitempty"`
+	Detail           string                  `json:"detail,omitempty"`
+	Challenge        acme.Challenge          `json:"challenge,omitempty"`
+	ValidationRecord []acme.ValidationRecord `json:"validationRecord,omitempty"`
+}
+
+// problemOf returns the problem of the CA causing err, nil if err was not caused by the CA.
+func problemOf(err error) *problem {
+	var problemDetails acme.ProblemDetails
+	if !errors.As(err, &problemDetails) {
+		return nil
+	}
+
+	p := &problem{Type: problemDetails.Type, Detail: problemDetails.Detail}
+	var challengeErr acme.ChallengeError
+	if errors.As(err, &challengeErr) {
+		p.Challenge = challengeErr.Challenge
+		p.ValidationRecord = challengeErr.ValidationRecord
+	}
+	return p
+}
+
+// report is the outcome of the current command, nil without --json.
+var report *commandReport
+
+// startReport starts the report of the command if --json is set.
+func startReport(jsonOutput bool, command string) {
+	if jsonOutput {
+		report = &commandReport{Command: command, Success: true, Results: []domainResult{}}
+	}
+}
+
+// reportCertificate adds the outcome of a certificate obtained, renewed, skipped or revoked.
+// The path of the certificate is the one of the storage, unless set in result.
+func reportCertificate(result domainResult, certRes *acme.CertificateResource, conf *Configuration) {
+	if report == nil {
+		return
+	}
+
+	domainName := certFileName(certRes, conf)
+	result.Success = true
+	if result.CertPath == "" {
+		result.CertPath = conf.CertStorage().Location(domainName, certExt)
+	}
+	if certRes.PrivateKey != nil {
+		result.KeyPath = conf.CertStorage().Location(domainName, keyExt)
+	}
+
+	if leaf, err := certRes.Leaf(); err == nil {
+		notAfter := leaf.NotAfter.UTC()
+		result.SANs = certificateSANs(leaf)
+		result.NotAfter = &notAfter
+	}
+
+	report.mu.Lock()
+	report.Results = append(report.Results, result)
+	report.mu.Unlock()
+}
+
+// reportSkipped adds the outcome of the certificate stored under name, whose renewal was skipped.
+func reportSkipped(conf *Configuration, name, domain string) {
+	if report == nil {
+		return
+	}
+
+	certBytes, _ := loadStoredCertificate(conf, name)
+	keyBytes, _ := conf.CertStorage().LoadResource(name, keyExt)
+	stored := &acme.CertificateResource{Domain: domain, Certificate: certBytes, PrivateKey: keyBytes}
+
+	reportCertificate(domainResult{Domain: domain, Skipped: true}, stored, conf)
+}
+
+// reportError adds the error of the domain, with an entry per domain for the errors of an order.
+func reportError(ctx context.Context, domain string, err error) {
+	if report == nil {
+		return
+	}
+
+	report.mu.Lock()
+	defer report.mu.Unlock()
+	report.Success = false
+
+	var obtainErr acme.ObtainError
+	if !errors.As(err, &obtainErr) {
+		report.Results = append(report.Results,
+			domainResult{Domain: domain, Error: err.Error(), ErrorType: errorType(ctx, err), Problem: problemOf(err)})
+		return
+	}
+
+	for _, dom := range obtainErr.Domains() {
+		report.Results = append(report.Results, domainResult{Domain: dom, Error: obtainErr[dom].Error(),
+			ErrorType: errorType(ctx, obtainErr[dom]), Problem: problemOf(obtainErr[dom])})
+	}
+}
+
+// accountProblemTypes are the problems returned by the CA because of the account rather than the order.
+var accountProblemTypes = []string{
+	"urn:ietf:params:acme:error:accountDoesNotExist",
+	"urn:ietf:params:acme:error:badPublicKey",
+	"urn:ietf:params:acme:error:invalidContact",
+	"urn:ietf:params:acme:error:unsupportedContact",
+	"urn:ietf:params:acme:error:unauthorized",
+}
+
+// errorType returns a short name of the kind of the error, for the scripts reading the report.
+// It gives the exit code of a failing command.
+func errorType(ctx context.Context, err error) string {
+	var (
+		rateLimitErr  acme.RateLimitError
+		tosErr        acme.TOSError
+		eabErr        acme.ExternalAccountRequiredError
+		profileErr    acme.InvalidProfileError
+		tooManyErr    acme.TooManyIdentifiersError
+		challengeErr  acme.ChallengeError
+		usageErr      usageError
+		saveErr       saveError
+		keyConflict   acme.KeyConflictError
+		netErr        net.Error
+		problemDetail acme.ProblemDetails
+		revokedErr    revokedError
+	)
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return errorTypeTimeout
+	case errors.As(err, &rateLimitErr):
+		return errorTypeRateLimited
+	case errors.As(err, &tosErr):
+		return errorTypeTOS
+	case errors.As(err, &eabErr):
+		return errorTypeExternalAccount
+	case errors.As(err, &profileErr):
+		return errorTypeInvalidProfile
+	case errors.As(err, &tooManyErr):
+		return errorTypeTooManyIdentifiers
+	case errors.As(err, &challengeErr):
+		return errorTypeChallenge
+	case errors.As(err, &usageErr):
+		return errorTypeUsage
+	case errors.As(err, &saveErr):
+		return errorTypeSave
+	case errors.As(err, &revokedErr):
+		return errorTypeRevoked
+	case errors.As(err, &keyConflict), errors.Is(err, acme.ErrAccountDeactivated), isAccountProblem(err):
+		return errorTypeAccount
+	case errors.As(err, &netErr):
+		return errorTypeNetwork
+	case errors.As(err, &problemDetail):
+		return errorTypeACME
+	default:
+		return errorTypeOther
+	}
+}
+
+// isAccountProblem returns true if the CA refused the account.
+func isAccountProblem(err error) bool {
+	for _, problemType := range accountProblemTypes {
+		if acme.IsProblemType(err, problemType) {
+			return true
+		}
+	}
+	return false
+}
+
+// challengeSummary collects the metrics of the challenges, logged at the debug level once the command finished.
+type challengeSummary struct {
+	mu      sync.Mutex
+	metrics []acme.ChallengeMetrics
+}
+
+// challenges are the metrics of the challenges of the command, since the last summary.
+var challenges = &challengeSummary{}
+
+func (s *challengeSummary) ObserveChallenge(metrics acme.ChallengeMetrics) {
+	s.mu.Lock()
+	s.metrics = append(s.metrics, metrics)
+	s.mu.Unlock()
+}
+
+// logChallengeSummary logs the durations of the challenges solved since the last summary.
+func logChallengeSummary() {
+	challenges.mu.Lock()
+	metrics := challenges.metrics
+	challenges.metrics = nil
+	challenges.mu.Unlock()
+
+	for _, m := range metrics {
+		summary := fmt.Sprintf("[%s] %s challenge with %T: presented in %s", m.Domain, m.Type, m.Provider, m.Present.Round(time.Millisecond))
+		if m.Type == acme.DNS01 {
+			summary += fmt.Sprintf(", propagated in %s", m.Propagation.Round(time.Millisecond))
+		}
+		summary += fmt.Sprintf(", validated in %s", m.Validation.Round(time.Millisecond))
+		if m.Err != nil {
+			summary += fmt.Sprintf(", failed: %v", m.Err)
+		}
+		log.Debugf("%s", summary)
+	}
+}
+
+// writeReport logs the summary of the challenges, and writes the report on stdout if --json is set.
+func writeReport() {
+	logChallengeSummary()
+
+	if report == nil {
+		return
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "\t")
+	if err := encoder.Encode(report); err != nil {
+		log.Printf("Could not write the report: %v", err)
+	}
+}
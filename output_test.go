@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/xenolf/lego/acme"
+)
+
+func TestErrorType(t *testing.T) {
+	problem := acme.ProblemDetails{StatusCode: 400, Type: "urn:ietf:params:acme:error:malformed"}
+
+	testCases := []struct {
+		desc     string
+		err      error
+		expected string
+	}{
+		{desc: "rate limit", err: fmt.Errorf("order failed: %w", acme.RateLimitError{RemoteError: problem}), expected: "rateLimited"},
+		{desc: "challenge", err: acme.ChallengeError{Identifier: "example.com", Err: problem}, expected: "challenge"},
+		{desc: "invalid profile", err: acme.InvalidProfileError{Profile: "foo", RemoteError: problem}, expected: "invalidProfile"},
+		{desc: "too many identifiers", err: fmt.Errorf("order failed: %w", acme.TooManyIdentifiersError{Identifiers: 101, Max: 100}), expected: "tooManyIdentifiers"},
+		{desc: "account", err: fmt.Errorf("order failed: %w", acme.ProblemDetails{StatusCode: 403, Type: "urn:ietf:params:acme:error:unauthorized"}), expected: "account"},
+		{desc: "deactivated account", err: acme.ErrAccountDeactivated, expected: "account"},
+		{desc: "network", err: fmt.Errorf("failed to get json: %w", &url.Error{Op: "Get", URL: "https://acme.example.com", Err: errors.New("connection refused")}), expected: "network"},
+		{desc: "problem", err: problem, expected: "acme"},
+		{desc: "revoked", err: revokedError{domain: "example.com"}, expected: "revoked"},
+		{desc: "save", err: saveError{errors.New("no space left on device")}, expected: "save"},
+		{desc: "other", err: errors.New("boom"), expected: "other"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := errorType(context.Background(), test.err); got != test.expected {
+				t.Errorf("Expected %s, got %s", test.expected, got)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+	if got := errorType(ctx, errors.New("canceled")); got != "timeout" {
+		t.Errorf("Expected timeout, got %s", got)
+	}
+}
+
+func TestReportError(t *testing.T) {
+	defer func() { report = nil }()
+	startReport(true, "run")
+
+	err := acme.ObtainError{
+		"b.example.com": errors.New("boom"),
+		"a.example.com": acme.ChallengeError{Identifier: "a.example.com", Err: errors.New("timeout")},
+	}
+	reportError(context.Background(), "a.example.com", fmt.Errorf("Could not obtain certificates\n\t%w", err))
+
+	if report.Success {
+		t.Error("Expected the report to fail")
+	}
+	if len(report.Results) != 2 {
+		t.Fatalf("Expected a result per domain, got %d", len(report.Results))
+	}
+
+	expected := []domainResult{
+		{Domain: "a.example.com", ErrorType: "challenge"},
+		{Domain: "b.example.com", ErrorType: "other"},
+	}
+	for i, result := range report.Results {
+		if result.Domain != expected[i].Domain || result.ErrorType != expected[i].ErrorType || result.Success {
+			t.Errorf("Expected the failure %v, got %v", expected[i], result)
+		}
+	}
+}
+
+func TestReportErrorProblem(t *testing.T) {
+	defer func() { report = nil }()
+	startReport(true, "run")
+
+	record := acme.ValidationRecord{URL: "http://a.example.com/.well-known/acme-challenge/token", AddressUsed: "192.0.2.1"}
+	err := acme.ObtainError{
+		"a.example.com": acme.ChallengeError{
+			Identifier:       "a.example.com",
+			Challenge:        acme.HTTP01,
+			Err:              acme.ProblemDetails{Type: "urn:ietf:params:acme:error:connection", Detail: "Connection refused"},
+			ValidationRecord: []acme.ValidationRecord{record},
+		},
+		"b.example.com": acme.ProblemDetails{Type: "urn:ietf:params:acme:error:caa", Detail: "CAA record forbids issuance"},
+		"c.example.com": errors.New("boom"),
+	}
+	reportError(context.Background(), "a.example.com", err)
+
+	if len(report.Results) != 3 {
+		t.Fatalf("Expected a result per domain, got %d", len(report.Results))
+	}
+
+	a := report.Results[0].Problem
+	if a == nil || a.Type != "urn:ietf:params:acme:error:connection" || a.Challenge != acme.HTTP01 ||
+		len(a.ValidationRecord) != 1 || a.ValidationRecord[0].AddressUsed != record.AddressUsed {
+		t.Errorf("Expected the problem of the challenge of a.example.com, got %+v", a)
+	}
+	if b := report.Results[1].Problem; b == nil || b.Type != "urn:ietf:params:acme:error:caa" || b.Challenge != "" {
+		t.Errorf("Expected the problem of b.example.com, got %+v", b)
+	}
+	if c := report.Results[2].Problem; c != nil {
+		t.Errorf("Expected no problem for c.example.com, got %+v", c)
+	}
+}
@@ -0,0 +1,35 @@
+package env
+
+import (
+	"fmt"
+	"time"
+)
+
+// Documentation describes the environment variables configuring a DNS provider.
+type Documentation struct {
+	// Name is the name of the provider, as given to --dns.
+	Name string
+	// Description is the DNS service managed by the provider.
+	Description string
+	// URL is the documentation of the API of the DNS service.
+	URL string
+	// Required are the variables the provider cannot work without, usually the credentials.
+	Required []Var
+	// Optional are the variables tuning the provider, e.g. a TTL or a propagation timeout.
+	Optional []Var
+}
+
+// Var describes an environment variable.
+type Var struct {
+	Name        string
+	Description string
+}
+
+// PropagationVars documents the <prefix>_PROPAGATION_TIMEOUT and <prefix>_POLLING_INTERVAL variables,
+// which override the given DNS propagation timeout and polling interval of a provider.
+func PropagationVars(prefix string, timeout, interval time.Duration) []Var {
+	return []Var{
+		{Name: prefix + "_PROPAGATION_TIMEOUT", Description: fmt.Sprintf("Maximum waiting time for the DNS propagation, in seconds (default %d)", int(timeout/time.Second))},
+		{Name: prefix + "_POLLING_INTERVAL", Description: fmt.Sprintf("Time between the DNS propagation checks, in seconds (default %d)", int(interval/time.Second))},
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Get environment variables
@@ -37,3 +38,14 @@ func GetOrDefaultInt(envVar string, defaultValue int) int {
 
 	return v
 }
+
+// GetOrDefaultSecond returns the given environment variable value as a time.Duration (second).
+// Returns the default if the envvar cannot be coopered to an int, or is not found.
+func GetOrDefaultSecond(envVar string, defaultValue time.Duration) time.Duration {
+	v := GetOrDefaultInt(envVar, -1)
+	if v < 0 {
+		return defaultValue
+	}
+
+	return time.Duration(v) * time.Second
+}
@@ -3,6 +3,7 @@ package env
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -54,3 +55,50 @@ func Test_GetOrDefaultInt(t *testing.T) {
 		})
 	}
 }
+
+func Test_GetOrDefaultSecond(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		envValue     string
+		defaultValue time.Duration
+		expected     time.Duration
+	}{
+		{
+			desc:         "valid value",
+			envValue:     "100",
+			defaultValue: 2 * time.Second,
+			expected:     100 * time.Second,
+		},
+		{
+			desc:         "zero",
+			envValue:     "0",
+			defaultValue: 2 * time.Second,
+			expected:     0,
+		},
+		{
+			desc:         "invalid content, use default value",
+			envValue:     "abc123",
+			defaultValue: 2 * time.Second,
+			expected:     2 * time.Second,
+		},
+		{
+			desc:         "negative value, use default value",
+			envValue:     "-111",
+			defaultValue: 2 * time.Second,
+			expected:     2 * time.Second,
+		},
+	}
+
+	const key = "LEGO_ENV_TC"
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			defer os.Unsetenv(key)
+			err := os.Setenv(key, test.envValue)
+			require.NoError(t, err)
+
+			result := GetOrDefaultSecond(key, test.defaultValue)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
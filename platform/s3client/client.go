@@ -0,0 +1,162 @@
+// Package s3client sends the few requests of the S3 API used by lego, signed with AWS Signature Version 4.
+package s3client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+// ErrMissingRegion is returned by New for a custom endpoint without region,
+// the region being only found from the buckets of AWS.
+var ErrMissingRegion = errors.New("the region is missing, it is required with a custom endpoint")
+
+// Config is the bucket of a Client and the way to reach it.
+type Config struct {
+	Bucket string
+	// Region is the region of the bucket, found from the bucket if empty.
+	Region string
+	// Endpoint is the URL of the S3 API, e.g. of a MinIO server, the one of AWS if empty.
+	Endpoint string
+	// PathStyle puts the bucket in the path of the URLs instead of in the host name.
+	PathStyle bool
+	// Credentials are the AWS credentials, the ones of the standard chain if nil:
+	// the environment variables, the shared credentials file and the instance role.
+	Credentials *credentials.Credentials
+	HTTPClient  *http.Client
+}
+
+// Client sends the requests of the objects of a bucket.
+type Client struct {
+	config Config
+	signer *v4.Signer
+}
+
+// New returns a Client of the bucket of the configuration,
+// completing the credentials and the region from the standard AWS chain, then from the bucket.
+func New(config Config) (*Client, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("the bucket is missing")
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+
+	if config.Credentials == nil || config.Region == "" {
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		if config.Credentials == nil {
+			config.Credentials = sess.Config.Credentials
+		}
+		if config.Region == "" && sess.Config.Region != nil {
+			config.Region = *sess.Config.Region
+		}
+	}
+
+	if config.Region == "" {
+		if config.Endpoint != "" {
+			return nil, ErrMissingRegion
+		}
+
+		region, err := bucketRegion(config.HTTPClient, config.Bucket)
+		if err != nil {
+			return nil, fmt.Errorf("could not find the region of the bucket %s: %v", config.Bucket, err)
+		}
+		config.Region = region
+	}
+
+	return &Client{config: config, signer: v4.NewSigner(config.Credentials)}, nil
+}
+
+// ObjectURL returns the URL of the object of the key in the S3 API, of the bucket for an empty key.
+func (c *Client) ObjectURL(key string, query url.Values) string {
+	endpoint := c.config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + c.config.Region + ".amazonaws.com"
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		// an endpoint given without a scheme, e.g. minio:9000.
+		u = &url.URL{Scheme: "https", Host: endpoint}
+	}
+
+	if c.config.PathStyle {
+		u.Path = path.Join("/", u.Path, c.config.Bucket, key)
+	} else {
+		u.Host = c.config.Bucket + "." + u.Host
+		u.Path = path.Join("/", u.Path, key)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Do signs and sends a request of the object of the key, of the bucket for an empty key,
+// and returns the body of the response.
+// The body of the request is sent with its Content-Length: S3 rejects the chunked uploads.
+// A missing object is an error satisfying os.IsNotExist.
+func (c *Client) Do(method, key string, query url.Values, header http.Header, body []byte) ([]byte, error) {
+	location := "s3://" + path.Join(c.config.Bucket, key)
+
+	var reader io.ReadSeeker
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, c.ObjectURL(key, query), reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if _, err = c.signer.Sign(req, reader, "s3", c.config.Region, time.Now()); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	switch {
+	case err != nil:
+		return nil, err
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, &os.PathError{Op: strings.ToLower(method), Path: location, Err: os.ErrNotExist}
+	case resp.StatusCode/100 != 2:
+		return nil, fmt.Errorf("%s %s: %d: %s", method, location, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return respBody, nil
+}
+
+// bucketRegion returns the region of the bucket, which S3 gives to any request of the bucket.
+func bucketRegion(client *http.Client, bucket string) (string, error) {
+	resp, err := client.Head("https://" + bucket + ".s3.amazonaws.com/")
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	region := resp.Header.Get("X-Amz-Bucket-Region")
+	if region == "" {
+		return "", fmt.Errorf("no region in the response %d", resp.StatusCode)
+	}
+	return region, nil
+}
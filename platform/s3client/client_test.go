@@ -0,0 +1,117 @@
+package s3client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientDo(t *testing.T) {
+	var length int64
+	var body, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/bucket/key":
+			length = r.ContentLength
+			data, _ := ioutil.ReadAll(r.Body)
+			body, contentType = string(data), r.Header.Get("Content-Type")
+		case r.Method == http.MethodGet && r.URL.Path == "/bucket/key":
+			w.Write([]byte(body))
+		case r.URL.Path == "/bucket/denied":
+			http.Error(w, "AccessDenied", http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(Config{
+		Bucket:      "bucket",
+		Region:      "eu-west-1",
+		Endpoint:    server.URL,
+		PathStyle:   true,
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	require.NoError(t, err)
+
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain")
+	_, err = client.Do(http.MethodPut, "key", nil, header, []byte("data"))
+	require.NoError(t, err)
+	// S3 rejects the uploads without Content-Length.
+	assert.EqualValues(t, 4, length)
+	assert.Equal(t, "data", body)
+	assert.Equal(t, "text/plain", contentType)
+
+	data, err := client.Do(http.MethodGet, "key", nil, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+
+	_, err = client.Do(http.MethodGet, "missing", nil, nil, nil)
+	assert.True(t, os.IsNotExist(err), "Expected a missing object, got %v", err)
+
+	_, err = client.Do(http.MethodGet, "denied", nil, nil, nil)
+	assert.EqualError(t, err, "GET s3://bucket/denied: 403: AccessDenied")
+}
+
+func TestClientObjectURL(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		config   Config
+		query    url.Values
+		expected string
+	}{
+		{
+			desc:     "AWS",
+			config:   Config{Bucket: "bucket", Region: "eu-west-1"},
+			expected: "https://bucket.s3.eu-west-1.amazonaws.com/key",
+		},
+		{
+			desc:     "path style",
+			config:   Config{Bucket: "bucket", Region: "eu-west-1", PathStyle: true},
+			expected: "https://s3.eu-west-1.amazonaws.com/bucket/key",
+		},
+		{
+			desc:     "MinIO",
+			config:   Config{Bucket: "bucket", Region: "us-east-1", Endpoint: "http://minio:9000", PathStyle: true},
+			expected: "http://minio:9000/bucket/key",
+		},
+		{
+			desc:     "endpoint without scheme",
+			config:   Config{Bucket: "bucket", Region: "us-east-1", Endpoint: "minio:9000", PathStyle: true},
+			expected: "https://minio:9000/bucket/key",
+		},
+		{
+			desc:     "query",
+			config:   Config{Bucket: "bucket", Region: "eu-west-1"},
+			query:    url.Values{"list-type": {"2"}},
+			expected: "https://bucket.s3.eu-west-1.amazonaws.com/key?list-type=2",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			config := test.config
+			config.Credentials = credentials.AnonymousCredentials
+
+			client, err := New(config)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, client.ObjectURL("key", test.query))
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{})
+	assert.EqualError(t, err, "the bucket is missing")
+
+	_, err = New(Config{Bucket: "bucket", Endpoint: "http://minio:9000", Credentials: credentials.AnonymousCredentials})
+	assert.Equal(t, ErrMissingRegion, err)
+}
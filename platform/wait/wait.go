@@ -0,0 +1,165 @@
+// Package wait polls a condition until it is met, e.g. until a DNS provider reports a change as applied.
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// ErrTimeout is wrapped by the error returned by For when the timeout is exceeded.
+var ErrTimeout = errors.New("time limit exceeded")
+
+// Option configures the delays between the polls of For.
+type Option func(*Backoff)
+
+// WithJitter reduces every delay by a random fraction of up to jitter (between 0 and 1),
+// so that concurrent pollers do not hit the same server at the same time.
+func WithJitter(jitter float64) Option {
+	return func(b *Backoff) {
+		b.Jitter = jitter
+	}
+}
+
+// WithExponentialBackoff doubles the delay after every poll, starting at the interval of For, up to max.
+func WithExponentialBackoff(max time.Duration) Option {
+	return func(b *Backoff) {
+		b.Max = max
+	}
+}
+
+// For polls f once every interval, up to timeout, until f returns true.
+// The errors of f are retried, the last one being part of the error returned on timeout,
+// unless marked as permanent with Permanent: For stops polling and returns it.
+// It stops polling when the context is done.
+func For(ctx context.Context, timeout, interval time.Duration, f func() (bool, error), opts ...Option) error {
+	delays := Backoff{Initial: interval}
+	for _, opt := range opts {
+		opt(&delays)
+	}
+
+	pollCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var lastErr error
+	for {
+		if err := pollCtx.Err(); err != nil {
+			return pollingError(ctx, lastErr)
+		}
+
+		stop, err := f()
+		if stop {
+			return nil
+		}
+		if err != nil {
+			var permanent *permanentError
+			if errors.As(err, &permanent) {
+				return permanent.err
+			}
+			lastErr = err
+		}
+
+		if err := Sleep(pollCtx, delays.Next()); err != nil {
+			return pollingError(ctx, lastErr)
+		}
+	}
+}
+
+// pollingError returns the error of For once the polling context is done,
+// a cancellation if the context of the caller is done, a timeout otherwise.
+func pollingError(ctx context.Context, lastErr error) error {
+	var err error
+	if ctx.Err() != nil {
+		err = fmt.Errorf("polling canceled: %w", ctx.Err())
+	} else {
+		err = ErrTimeout
+	}
+
+	if lastErr == nil {
+		return err
+	}
+	return fmt.Errorf("%w. Last error: %v", err, lastErr)
+}
+
+// permanentError is an error of the function polled by For which is not retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as permanent: the polling of For stops, and err is returned as is.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Sleep pauses for the given duration, or until the context is done.
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Backoff computes the delays between polls: the delay starts at Initial,
+// and doubles after every poll up to Max if Max is greater than Initial.
+// Every delay is reduced by a random fraction of up to Jitter, 1 being a full jitter.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	Jitter  float64
+
+	// polls is the number of delays returned so far.
+	polls int
+}
+
+// Next returns the delay before the next poll.
+func (b *Backoff) Next() time.Duration {
+	ceiling := b.Max
+	if ceiling < b.Initial {
+		ceiling = b.Initial
+	}
+	return b.NextWithin(ceiling)
+}
+
+// NextWithin is like Next, but the delay grows up to ceiling instead of Max, e.g. the delay advertised by a server.
+func (b *Backoff) NextWithin(ceiling time.Duration) time.Duration {
+	interval := b.Initial
+	for i := 0; i < b.polls && interval < ceiling; i++ {
+		interval *= 2
+	}
+	if interval > ceiling {
+		interval = ceiling
+	}
+	b.polls++
+
+	if interval <= 0 {
+		return 0
+	}
+	if b.Jitter <= 0 {
+		return interval
+	}
+
+	jitter := b.Jitter
+	if jitter > 1 {
+		jitter = 1
+	}
+	return interval - time.Duration(rand.Int63n(int64(float64(interval)*jitter)+1))
+}
+
+// Polls returns the number of delays returned so far.
+func (b *Backoff) Polls() int {
+	return b.polls
+}
@@ -0,0 +1,94 @@
+package wait
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestForEarlySuccess(t *testing.T) {
+	polls := 0
+	err := For(context.Background(), time.Second, time.Millisecond, func() (bool, error) {
+		polls++
+		return polls == 3, errors.New("not yet")
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if polls != 3 {
+		t.Errorf("Expected 3 polls, got %d", polls)
+	}
+}
+
+func TestForTimeout(t *testing.T) {
+	err := For(context.Background(), 20*time.Millisecond, time.Millisecond, func() (bool, error) {
+		return false, errors.New("record not found")
+	})
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Expected a timeout, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "record not found") {
+		t.Errorf("Expected the last error in %q", err)
+	}
+}
+
+func TestForPermanentError(t *testing.T) {
+	permanent := errors.New("access denied")
+
+	polls := 0
+	err := For(context.Background(), time.Second, time.Millisecond, func() (bool, error) {
+		polls++
+		return false, Permanent(permanent)
+	})
+	if err != permanent {
+		t.Fatalf("Expected the permanent error, got %v", err)
+	}
+	if polls != 1 {
+		t.Errorf("Expected 1 poll, got %d", polls)
+	}
+}
+
+func TestForCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	polls := 0
+	err := For(ctx, time.Minute, time.Hour, func() (bool, error) {
+		polls++
+		cancel()
+		return false, nil
+	})
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrTimeout) {
+		t.Fatalf("Expected a cancellation, got %v", err)
+	}
+	if polls != 1 {
+		t.Errorf("Expected 1 poll, got %d", polls)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Initial: time.Second, Max: 5 * time.Second}
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if delay := b.Next(); delay != expected {
+			t.Errorf("Expected a delay of %v, got %v", expected, delay)
+		}
+	}
+	if b.Polls() != 5 {
+		t.Errorf("Expected 5 polls, got %d", b.Polls())
+	}
+
+	constant := Backoff{Initial: time.Second}
+	for i := 0; i < 3; i++ {
+		if delay := constant.Next(); delay != time.Second {
+			t.Errorf("Expected a constant delay, got %v", delay)
+		}
+	}
+
+	jittered := Backoff{Initial: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if delay := jittered.Next(); delay < 500*time.Millisecond || delay > time.Second {
+			t.Fatalf("Expected a delay between 500ms and 1s, got %v", delay)
+		}
+	}
+}
@@ -6,12 +6,26 @@ package acmedns
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/cpu/goacmedns"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the acme-dns server and the file of its accounts.
+var Documentation = env.Documentation{
+	Name:        "acme-dns",
+	Description: "Joohoi's acme-dns",
+	URL:         "https://github.com/joohoi/acme-dns",
+	Required: []env.Var{
+		{Name: "ACME_DNS_API_BASE", Description: "The URL of the acme-dns server"},
+		{Name: "ACME_DNS_STORAGE_PATH", Description: "The file storing the acme-dns accounts, created if needed"},
+	},
+	Optional: env.PropagationVars("ACME_DNS", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval),
+}
+
 const (
 	// envNamespace is the prefix for ACME-DNS environment variables.
 	envNamespace = "ACME_DNS_"
@@ -39,8 +53,10 @@ type acmeDNSClient interface {
 // DNSProvider is an implementation of the acme.ChallengeProvider interface for
 // an ACME-DNS server.
 type DNSProvider struct {
-	client  acmeDNSClient
-	storage goacmedns.Storage
+	client             acmeDNSClient
+	storage            goacmedns.Storage
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider creates an ACME-DNS provider using file based account storage.
@@ -69,11 +85,19 @@ func NewDNSProviderClient(client acmeDNSClient, storage goacmedns.Storage) (*DNS
 	}
 
 	return &DNSProvider{
-		client:  client,
-		storage: storage,
+		client:             client,
+		storage:            storage,
+		propagationTimeout: env.GetOrDefaultSecond("ACME_DNS_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("ACME_DNS_POLLING_INTERVAL", acme.DefaultPollingInterval),
 	}, nil
 }
 
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with ACME_DNS_PROPAGATION_TIMEOUT and ACME_DNS_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
+}
+
 // ErrCNAMERequired is returned by Present when the Domain indicated had no
 // existing ACME-DNS account in the Storage and additional setup is required.
 // The user must create a CNAME in the DNS zone for Domain that aliases FQDN
@@ -112,7 +136,7 @@ func (e ErrCNAMERequired) Error() string {
 func (d *DNSProvider) Present(domain, _, keyAuth string) error {
 	// Compute the challenge response FQDN and TXT value for the domain based
 	// on the keyAuth.
-	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
 
 	// Check if credentials were previously saved for this domain.
 	account, err := d.storage.Fetch(domain)
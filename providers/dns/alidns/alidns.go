@@ -6,18 +6,36 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/alidns"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the access keys of Alibaba Cloud and the region of the API.
+var Documentation = env.Documentation{
+	Name:        "alidns",
+	Description: "Alibaba Cloud DNS",
+	URL:         "https://www.alibabacloud.com/help/doc-detail/29739.htm",
+	Required: []env.Var{
+		{Name: "ALIDNS_API_KEY", Description: "The access key ID"},
+		{Name: "ALIDNS_SECRET_KEY", Description: "The access key secret"},
+	},
+	Optional: append([]env.Var{
+		{Name: "ALIDNS_REGION_ID", Description: "The region of the API (default cn-hangzhou)"},
+	}, env.PropagationVars("ALIDNS", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval)...),
+}
+
 const defaultRegionID = "cn-hangzhou"
 
 // DNSProvider is an implementation of the acme.ChallengeProvider interface
 type DNSProvider struct {
-	client *alidns.Client
+	client             *alidns.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for Alibaba Cloud DNS.
@@ -49,13 +67,22 @@ func NewDNSProviderCredentials(apiKey, secretKey, regionID string) (*DNSProvider
 	}
 
 	return &DNSProvider{
-		client: client,
+		client:             client,
+		propagationTimeout: env.GetOrDefaultSecond("ALIDNS_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("ALIDNS_POLLING_INTERVAL", acme.DefaultPollingInterval),
 	}, nil
 }
 
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with ALIDNS_PROPAGATION_TIMEOUT and ALIDNS_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
+}
+
 // Present creates a TXT record to fulfil the dns-01 challenge.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 
 	_, zoneName, err := d.getHostedZone(domain)
 	if err != nil {
@@ -73,7 +100,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters.
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	records, err := d.findTxtRecords(domain, fqdn)
 	if err != nil {
@@ -4,19 +4,37 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/edeckers/auroradnsclient"
 	"github.com/edeckers/auroradnsclient/records"
 	"github.com/edeckers/auroradnsclient/zones"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the API credentials of Aurora DNS and its endpoint.
+var Documentation = env.Documentation{
+	Name:        "auroradns",
+	Description: "Aurora DNS of PCextreme",
+	URL:         "https://www.pcextreme.com/aurora/dns",
+	Required: []env.Var{
+		{Name: "AURORA_USER_ID", Description: "The API key"},
+		{Name: "AURORA_KEY", Description: "The API secret"},
+	},
+	Optional: append([]env.Var{
+		{Name: "AURORA_ENDPOINT", Description: "The URL of the API (default https://api.auroradns.eu)"},
+	}, env.PropagationVars("AURORA", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval)...),
+}
+
 // DNSProvider describes a provider for AuroraDNS
 type DNSProvider struct {
-	recordIDs   map[string]string
-	recordIDsMu sync.Mutex
-	client      *auroradnsclient.AuroraDNSClient
+	recordIDs          map[string]string
+	recordIDsMu        sync.Mutex
+	client             *auroradnsclient.AuroraDNSClient
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for AuroraDNS.
@@ -46,11 +64,19 @@ func NewDNSProviderCredentials(baseURL string, userID string, key string) (*DNSP
 	}
 
 	return &DNSProvider{
-		client:    client,
-		recordIDs: make(map[string]string),
+		client:             client,
+		recordIDs:          make(map[string]string),
+		propagationTimeout: env.GetOrDefaultSecond("AURORA_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("AURORA_POLLING_INTERVAL", acme.DefaultPollingInterval),
 	}, nil
 }
 
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with AURORA_PROPAGATION_TIMEOUT and AURORA_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
+}
+
 func (d *DNSProvider) getZoneInformationByName(name string) (zones.ZoneRecord, error) {
 	zs, err := d.client.GetZones()
 
@@ -69,7 +95,7 @@ func (d *DNSProvider) getZoneInformationByName(name string) (zones.ZoneRecord, e
 
 // Present creates a record with a secret
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
 
 	authZone, err := acme.FindZoneByFqdn(acme.ToFqdn(domain), acme.RecursiveNameservers)
 	if err != nil {
@@ -114,7 +140,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes a given record that was generated by Present
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	d.recordIDsMu.Lock()
 	recordID, ok := d.recordIDs[fqdn]
@@ -16,17 +16,40 @@ import (
 	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+const (
+	defaultPropagationTimeout = 120 * time.Second
+	defaultPollingInterval    = 2 * time.Second
+)
+
+// Documentation lists the service principal and the resource group of the Azure DNS zones.
+var Documentation = env.Documentation{
+	Name:        "azure",
+	Description: "Azure DNS",
+	URL:         "https://docs.microsoft.com/en-us/azure/dns/",
+	Required: []env.Var{
+		{Name: "AZURE_CLIENT_ID", Description: "The client ID of the service principal"},
+		{Name: "AZURE_CLIENT_SECRET", Description: "The client secret of the service principal"},
+		{Name: "AZURE_SUBSCRIPTION_ID", Description: "The subscription of the DNS zone"},
+		{Name: "AZURE_TENANT_ID", Description: "The tenant of the service principal"},
+		{Name: "AZURE_RESOURCE_GROUP", Description: "The resource group of the DNS zone"},
+	},
+	Optional: env.PropagationVars("AZURE", defaultPropagationTimeout, defaultPollingInterval),
+}
+
 // DNSProvider is an implementation of the acme.ChallengeProvider interface
 type DNSProvider struct {
-	clientID       string
-	clientSecret   string
-	subscriptionID string
-	tenantID       string
-	resourceGroup  string
-	context        context.Context
+	clientID           string
+	clientSecret       string
+	subscriptionID     string
+	tenantID           string
+	resourceGroup      string
+	context            context.Context
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for azure.
@@ -61,19 +84,22 @@ func NewDNSProviderCredentials(clientID, clientSecret, subscriptionID, tenantID,
 		tenantID:       tenantID,
 		resourceGroup:  resourceGroup,
 		// TODO: A timeout can be added here for cancellation purposes.
-		context: context.Background(),
+		context:            context.Background(),
+		propagationTimeout: env.GetOrDefaultSecond("AZURE_PROPAGATION_TIMEOUT", defaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("AZURE_POLLING_INTERVAL", defaultPollingInterval),
 	}, nil
 }
 
 // Timeout returns the timeout and interval to use when checking for DNS
 // propagation. Adjusting here to cope with spikes in propagation times.
+// AZURE_PROPAGATION_TIMEOUT and AZURE_POLLING_INTERVAL override them.
 func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
-	return 120 * time.Second, 2 * time.Second
+	return d.propagationTimeout, d.pollingInterval
 }
 
 // Present creates a TXT record to fulfil the dns-01 challenge
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
 	zone, err := d.getHostedZoneID(fqdn)
 	if err != nil {
 		return err
@@ -107,7 +133,7 @@ func toRelativeRecord(domain, zone string) string {
 
 // CleanUp removes the TXT record matching the specified parameters
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	zone, err := d.getHostedZoneID(fqdn)
 	if err != nil {
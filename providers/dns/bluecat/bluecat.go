@@ -14,9 +14,25 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the Bluecat Address Manager server, its account and the DNS view of the records.
+var Documentation = env.Documentation{
+	Name:        "bluecat",
+	Description: "Bluecat Address Manager",
+	URL:         "https://www.bluecatnetworks.com",
+	Required: []env.Var{
+		{Name: "BLUECAT_SERVER_URL", Description: "The URL of the Address Manager, e.g. https://bam.example.com"},
+		{Name: "BLUECAT_USER_NAME", Description: "The API user"},
+		{Name: "BLUECAT_PASSWORD", Description: "The password of the API user"},
+		{Name: "BLUECAT_CONFIG_NAME", Description: "The configuration of the DNS view"},
+		{Name: "BLUECAT_DNS_VIEW", Description: "The DNS view of the zones"},
+	},
+	Optional: env.PropagationVars("BLUECAT", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval),
+}
+
 const bluecatURLTemplate = "%s/Services/REST/v1"
 const configType = "Configuration"
 const viewType = "View"
@@ -33,13 +49,15 @@ type entityResponse struct {
 // DNSProvider is an implementation of the acme.ChallengeProvider interface that uses
 // Bluecat's Address Manager REST API to manage TXT records for a domain.
 type DNSProvider struct {
-	baseURL    string
-	userName   string
-	password   string
-	configName string
-	dnsView    string
-	token      string
-	client     *http.Client
+	baseURL            string
+	userName           string
+	password           string
+	configName         string
+	dnsView            string
+	token              string
+	client             *http.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for Bluecat DNS.
@@ -50,7 +68,7 @@ type DNSProvider struct {
 // and external DNS View Name must be passed in BLUECAT_CONFIG_NAME and
 // BLUECAT_DNS_VIEW
 func NewDNSProvider() (*DNSProvider, error) {
-	values, err := env.Get("BLUECAT_SERVER_URL", "BLUECAT_USER_NAME", "BLUECAT_CONFIG_NAME", "BLUECAT_CONFIG_NAME", "BLUECAT_DNS_VIEW")
+	values, err := env.Get("BLUECAT_SERVER_URL", "BLUECAT_USER_NAME", "BLUECAT_PASSWORD", "BLUECAT_CONFIG_NAME", "BLUECAT_DNS_VIEW")
 	if err != nil {
 		return nil, fmt.Errorf("BlueCat: %v", err)
 	}
@@ -80,15 +98,23 @@ func NewDNSProviderCredentials(server, userName, password, configName, dnsView s
 	}
 
 	return &DNSProvider{
-		baseURL:    fmt.Sprintf(bluecatURLTemplate, server),
-		userName:   userName,
-		password:   password,
-		configName: configName,
-		dnsView:    dnsView,
-		client:     client,
+		baseURL:            fmt.Sprintf(bluecatURLTemplate, server),
+		userName:           userName,
+		password:           password,
+		configName:         configName,
+		dnsView:            dnsView,
+		client:             client,
+		propagationTimeout: env.GetOrDefaultSecond("BLUECAT_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("BLUECAT_POLLING_INTERVAL", acme.DefaultPollingInterval),
 	}, nil
 }
 
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with BLUECAT_PROPAGATION_TIMEOUT and BLUECAT_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
+}
+
 // Send a REST request, using query parameters specified. The Authorization
 // header will be set if we have an active auth token
 func (d *DNSProvider) sendRequest(method, resource string, payload interface{}, queryArgs map[string]string) (*http.Response, error) {
@@ -300,7 +326,8 @@ func (d *DNSProvider) getZone(parentID uint, name string) (uint, error) {
 // This will *not* create a subzone to contain the TXT record,
 // so make sure the FQDN specified is within an extant zone.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 
 	err := d.login()
 	if err != nil {
@@ -366,7 +393,7 @@ func (d *DNSProvider) deploy(entityID uint) error {
 
 // CleanUp removes the TXT record matching the specified parameters
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	err := d.login()
 	if err != nil {
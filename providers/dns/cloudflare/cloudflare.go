@@ -10,21 +10,42 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+const (
+	defaultPropagationTimeout = 120 * time.Second
+	defaultPollingInterval    = 2 * time.Second
+)
+
+// Documentation lists the email and the global API key of the Cloudflare account.
+var Documentation = env.Documentation{
+	Name:        "cloudflare",
+	Description: "Cloudflare",
+	URL:         "https://api.cloudflare.com/",
+	Required: []env.Var{
+		{Name: "CLOUDFLARE_EMAIL", Description: "The email of the account"},
+		{Name: "CLOUDFLARE_API_KEY", Description: "The global API key of the account"},
+	},
+	Optional: env.PropagationVars("CLOUDFLARE", defaultPropagationTimeout, defaultPollingInterval),
+}
+
 // CloudFlareAPIURL represents the API endpoint to call.
 // TODO: Unexport?
 const CloudFlareAPIURL = "https://api.cloudflare.com/client/v4"
 
 // DNSProvider is an implementation of the acme.ChallengeProvider interface
 type DNSProvider struct {
-	authEmail string
-	authKey   string
-	client    *http.Client
+	authEmail          string
+	authKey            string
+	client             *http.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for cloudflare.
@@ -47,21 +68,25 @@ func NewDNSProviderCredentials(email, key string) (*DNSProvider, error) {
 	}
 
 	return &DNSProvider{
-		authEmail: email,
-		authKey:   key,
-		client:    &http.Client{Timeout: 30 * time.Second},
+		authEmail:          email,
+		authKey:            key,
+		client:             &http.Client{Timeout: 30 * time.Second},
+		propagationTimeout: env.GetOrDefaultSecond("CLOUDFLARE_PROPAGATION_TIMEOUT", defaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("CLOUDFLARE_POLLING_INTERVAL", defaultPollingInterval),
 	}, nil
 }
 
 // Timeout returns the timeout and interval to use when checking for DNS
 // propagation. Adjusting here to cope with spikes in propagation times.
+// CLOUDFLARE_PROPAGATION_TIMEOUT and CLOUDFLARE_POLLING_INTERVAL override them.
 func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
-	return 120 * time.Second, 2 * time.Second
+	return d.propagationTimeout, d.pollingInterval
 }
 
 // Present creates a TXT record to fulfil the dns-01 challenge
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 	zoneID, err := d.getHostedZoneID(fqdn)
 	if err != nil {
 		return err
@@ -85,7 +110,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	record, err := d.findTxtRecord(fqdn)
 	if err != nil {
@@ -96,6 +121,55 @@ func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 	return err
 }
 
+// ListChallengeRecords returns the _acme-challenge TXT records of the zone of domain.
+func (d *DNSProvider) ListChallengeRecords(domain string) ([]acme.ChallengeRecord, error) {
+	zoneID, err := d.getHostedZoneID(acme.ToFqdn(domain))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := d.doRequest(http.MethodGet, fmt.Sprintf("/zones/%s/dns_records?per_page=1000&type=TXT", zoneID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []struct {
+		cloudFlareRecord
+		CreatedOn time.Time `json:"created_on"`
+	}
+	err = json.Unmarshal(result, &records)
+	if err != nil {
+		return nil, err
+	}
+
+	var challengeRecords []acme.ChallengeRecord
+	for _, rec := range records {
+		if !strings.HasPrefix(rec.Name, "_acme-challenge.") {
+			continue
+		}
+
+		challengeRecords = append(challengeRecords, acme.ChallengeRecord{
+			FQDN:    acme.ToFqdn(rec.Name),
+			Value:   rec.Content,
+			ID:      zoneID + "/" + rec.ID,
+			Created: rec.CreatedOn,
+		})
+	}
+
+	return challengeRecords, nil
+}
+
+// DeleteChallengeRecord deletes a record returned by ListChallengeRecords.
+func (d *DNSProvider) DeleteChallengeRecord(record acme.ChallengeRecord) error {
+	ids := strings.SplitN(record.ID, "/", 2)
+	if len(ids) != 2 {
+		return fmt.Errorf("invalid record ID '%s'", record.ID)
+	}
+
+	_, err := d.doRequest(http.MethodDelete, fmt.Sprintf("/zones/%s/dns_records/%s", ids[0], ids[1]), nil)
+	return err
+}
+
 func (d *DNSProvider) getHostedZoneID(fqdn string) (string, error) {
 	// HostedZone represents a CloudFlare DNS zone
 	type HostedZone struct {
@@ -13,15 +13,30 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the API key and secret of CloudXNS.
+var Documentation = env.Documentation{
+	Name:        "cloudxns",
+	Description: "CloudXNS",
+	URL:         "https://www.cloudxns.net/Support/lists/cid/17.html",
+	Required: []env.Var{
+		{Name: "CLOUDXNS_API_KEY", Description: "The API key"},
+		{Name: "CLOUDXNS_SECRET_KEY", Description: "The secret key"},
+	},
+	Optional: env.PropagationVars("CLOUDXNS", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval),
+}
+
 const cloudXNSBaseURL = "https://www.cloudxns.net/api2/"
 
 // DNSProvider is an implementation of the acme.ChallengeProvider interface
 type DNSProvider struct {
-	apiKey    string
-	secretKey string
+	apiKey             string
+	secretKey          string
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for cloudxns.
@@ -44,14 +59,23 @@ func NewDNSProviderCredentials(apiKey, secretKey string) (*DNSProvider, error) {
 	}
 
 	return &DNSProvider{
-		apiKey:    apiKey,
-		secretKey: secretKey,
+		apiKey:             apiKey,
+		secretKey:          secretKey,
+		propagationTimeout: env.GetOrDefaultSecond("CLOUDXNS_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("CLOUDXNS_POLLING_INTERVAL", acme.DefaultPollingInterval),
 	}, nil
 }
 
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with CLOUDXNS_PROPAGATION_TIMEOUT and CLOUDXNS_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
+}
+
 // Present creates a TXT record to fulfil the dns-01 challenge.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 	zoneID, err := d.getHostedZoneID(fqdn)
 	if err != nil {
 		return err
@@ -62,7 +86,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters.
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 	zoneID, err := d.getHostedZoneID(fqdn)
 	if err != nil {
 		return err
@@ -11,16 +11,35 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+const (
+	defaultPropagationTimeout = 60 * time.Second
+	defaultPollingInterval    = 5 * time.Second
+)
+
+// Documentation lists the API token of DigitalOcean.
+var Documentation = env.Documentation{
+	Name:        "digitalocean",
+	Description: "DigitalOcean",
+	URL:         "https://developers.digitalocean.com/documentation/v2/#domain-records",
+	Required: []env.Var{
+		{Name: "DO_AUTH_TOKEN", Description: "The personal access token, with the write scope"},
+	},
+	Optional: env.PropagationVars("DO", defaultPropagationTimeout, defaultPollingInterval),
+}
+
 // DNSProvider is an implementation of the acme.ChallengeProvider interface
 // that uses DigitalOcean's REST API to manage TXT records for a domain.
 type DNSProvider struct {
-	apiAuthToken string
-	recordIDs    map[string]int
-	recordIDsMu  sync.Mutex
-	client       *http.Client
+	apiAuthToken       string
+	recordIDs          map[string]int
+	recordIDsMu        sync.Mutex
+	client             *http.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for Digital
@@ -42,21 +61,24 @@ func NewDNSProviderCredentials(apiAuthToken string) (*DNSProvider, error) {
 		return nil, fmt.Errorf("DigitalOcean credentials missing")
 	}
 	return &DNSProvider{
-		apiAuthToken: apiAuthToken,
-		recordIDs:    make(map[string]int),
-		client:       &http.Client{Timeout: 30 * time.Second},
+		apiAuthToken:       apiAuthToken,
+		recordIDs:          make(map[string]int),
+		client:             &http.Client{Timeout: 30 * time.Second},
+		propagationTimeout: env.GetOrDefaultSecond("DO_PROPAGATION_TIMEOUT", defaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("DO_POLLING_INTERVAL", defaultPollingInterval),
 	}, nil
 }
 
 // Timeout returns the timeout and interval to use when checking for DNS
 // propagation. Adjusting here to cope with spikes in propagation times.
+// DO_PROPAGATION_TIMEOUT and DO_POLLING_INTERVAL override them.
 func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
-	return 60 * time.Second, 5 * time.Second
+	return d.propagationTimeout, d.pollingInterval
 }
 
 // Present creates a TXT record using the specified parameters
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
 
 	authZone, err := acme.FindZoneByFqdn(acme.ToFqdn(domain), acme.RecursiveNameservers)
 	if err != nil {
@@ -106,7 +128,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	// get the record's unique ID from when we created it
 	d.recordIDsMu.Lock()
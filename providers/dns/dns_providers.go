@@ -2,8 +2,11 @@ package dns
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/platform/config/env"
 	"github.com/xenolf/lego/providers/dns/acmedns"
 	"github.com/xenolf/lego/providers/dns/alidns"
 	"github.com/xenolf/lego/providers/dns/auroradns"
@@ -25,6 +28,7 @@ import (
 	"github.com/xenolf/lego/providers/dns/gcloud"
 	"github.com/xenolf/lego/providers/dns/glesys"
 	"github.com/xenolf/lego/providers/dns/godaddy"
+	"github.com/xenolf/lego/providers/dns/httpreq"
 	"github.com/xenolf/lego/providers/dns/iij"
 	"github.com/xenolf/lego/providers/dns/lightsail"
 	"github.com/xenolf/lego/providers/dns/linode"
@@ -44,88 +48,108 @@ import (
 	"github.com/xenolf/lego/providers/dns/vultr"
 )
 
-// NewDNSChallengeProviderByName Factory for DNS providers
+// manualDocumentation describes the manual provider, which needs no credentials.
+var manualDocumentation = env.Documentation{
+	Name:        "manual",
+	Description: "Prompts to create and remove the TXT records by hand",
+	Optional: []env.Var{
+		{Name: "MANUAL_SLEEP", Description: "Maximum time in seconds waited after printing a record, 'Enter' ending the wait on a terminal (same as --dns.manual-wait)"},
+	},
+}
+
+// registration is a DNS provider of NewDNSChallengeProviderByName.
+type registration struct {
+	doc         env.Documentation
+	newProvider func() (acme.ChallengeProvider, error)
+}
+
+// registry are the providers of NewDNSChallengeProviderByName, by the name of their documentation.
+// Adding a provider only needs a line here.
+var registry = []registration{
+	{acmedns.Documentation, func() (acme.ChallengeProvider, error) { return acmedns.NewDNSProvider() }},
+	{alidns.Documentation, func() (acme.ChallengeProvider, error) { return alidns.NewDNSProvider() }},
+	{auroradns.Documentation, func() (acme.ChallengeProvider, error) { return auroradns.NewDNSProvider() }},
+	{azure.Documentation, func() (acme.ChallengeProvider, error) { return azure.NewDNSProvider() }},
+	{bluecat.Documentation, func() (acme.ChallengeProvider, error) { return bluecat.NewDNSProvider() }},
+	{cloudflare.Documentation, func() (acme.ChallengeProvider, error) { return cloudflare.NewDNSProvider() }},
+	{cloudxns.Documentation, func() (acme.ChallengeProvider, error) { return cloudxns.NewDNSProvider() }},
+	{digitalocean.Documentation, func() (acme.ChallengeProvider, error) { return digitalocean.NewDNSProvider() }},
+	{dnsimple.Documentation, func() (acme.ChallengeProvider, error) { return dnsimple.NewDNSProvider() }},
+	{dnsmadeeasy.Documentation, func() (acme.ChallengeProvider, error) { return dnsmadeeasy.NewDNSProvider() }},
+	{dnspod.Documentation, func() (acme.ChallengeProvider, error) { return dnspod.NewDNSProvider() }},
+	{duckdns.Documentation, func() (acme.ChallengeProvider, error) { return duckdns.NewDNSProvider() }},
+	{dyn.Documentation, func() (acme.ChallengeProvider, error) { return dyn.NewDNSProvider() }},
+	{exec.Documentation, func() (acme.ChallengeProvider, error) { return exec.NewDNSProvider() }},
+	{exoscale.Documentation, func() (acme.ChallengeProvider, error) { return exoscale.NewDNSProvider() }},
+	{fastdns.Documentation, func() (acme.ChallengeProvider, error) { return fastdns.NewDNSProvider() }},
+	{gandi.Documentation, func() (acme.ChallengeProvider, error) { return gandi.NewDNSProvider() }},
+	{gandiv5.Documentation, func() (acme.ChallengeProvider, error) { return gandiv5.NewDNSProvider() }},
+	{gcloud.Documentation, func() (acme.ChallengeProvider, error) { return gcloud.NewDNSProvider() }},
+	{glesys.Documentation, func() (acme.ChallengeProvider, error) { return glesys.NewDNSProvider() }},
+	{godaddy.Documentation, func() (acme.ChallengeProvider, error) { return godaddy.NewDNSProvider() }},
+	{httpreq.Documentation, func() (acme.ChallengeProvider, error) { return httpreq.NewDNSProvider() }},
+	{iij.Documentation, func() (acme.ChallengeProvider, error) { return iij.NewDNSProvider() }},
+	{lightsail.Documentation, func() (acme.ChallengeProvider, error) { return lightsail.NewDNSProvider() }},
+	{linode.Documentation, func() (acme.ChallengeProvider, error) { return linode.NewDNSProvider() }},
+	{namecheap.Documentation, func() (acme.ChallengeProvider, error) { return namecheap.NewDNSProvider() }},
+	{namedotcom.Documentation, func() (acme.ChallengeProvider, error) { return namedotcom.NewDNSProvider() }},
+	{netcup.Documentation, func() (acme.ChallengeProvider, error) { return netcup.NewDNSProvider() }},
+	{nifcloud.Documentation, func() (acme.ChallengeProvider, error) { return nifcloud.NewDNSProvider() }},
+	{ns1.Documentation, func() (acme.ChallengeProvider, error) { return ns1.NewDNSProvider() }},
+	{otc.Documentation, func() (acme.ChallengeProvider, error) { return otc.NewDNSProvider() }},
+	{ovh.Documentation, func() (acme.ChallengeProvider, error) { return ovh.NewDNSProvider() }},
+	{pdns.Documentation, func() (acme.ChallengeProvider, error) { return pdns.NewDNSProvider() }},
+	{rackspace.Documentation, func() (acme.ChallengeProvider, error) { return rackspace.NewDNSProvider() }},
+	{rfc2136.Documentation, func() (acme.ChallengeProvider, error) { return rfc2136.NewDNSProvider() }},
+	{route53.Documentation, func() (acme.ChallengeProvider, error) { return route53.NewDNSProvider() }},
+	{sakuracloud.Documentation, func() (acme.ChallengeProvider, error) { return sakuracloud.NewDNSProvider() }},
+	{vegadns.Documentation, func() (acme.ChallengeProvider, error) { return vegadns.NewDNSProvider() }},
+	{vultr.Documentation, func() (acme.ChallengeProvider, error) { return vultr.NewDNSProvider() }},
+	{manualDocumentation, func() (acme.ChallengeProvider, error) { return acme.NewDNSProviderManual() }},
+}
+
+// Documentations returns the documentation of the DNS providers, sorted by name.
+func Documentations() []env.Documentation {
+	docs := make([]env.Documentation, 0, len(registry))
+	for _, r := range registry {
+		docs = append(docs, r.doc)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Name < docs[j].Name })
+	return docs
+}
+
+// DocumentationByName returns the documentation of the DNS provider.
+func DocumentationByName(name string) (env.Documentation, error) {
+	for _, r := range registry {
+		if r.doc.Name == name {
+			return r.doc, nil
+		}
+	}
+	return env.Documentation{}, fmt.Errorf("unrecognised DNS provider: %s", name)
+}
+
+// Names returns the names of the DNS providers, sorted.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for _, r := range registry {
+		names = append(names, r.doc.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewDNSChallengeProviderByName Factory for DNS providers.
+// Comma-separated names, e.g. "cloudflare,route53", return a FallbackProvider
+// trying each provider after the failure of the previous one.
 func NewDNSChallengeProviderByName(name string) (acme.ChallengeProvider, error) {
-	switch name {
-	case "acme-dns":
-		return acmedns.NewDNSProvider()
-	case "alidns":
-		return alidns.NewDNSProvider()
-	case "azure":
-		return azure.NewDNSProvider()
-	case "auroradns":
-		return auroradns.NewDNSProvider()
-	case "bluecat":
-		return bluecat.NewDNSProvider()
-	case "cloudflare":
-		return cloudflare.NewDNSProvider()
-	case "cloudxns":
-		return cloudxns.NewDNSProvider()
-	case "digitalocean":
-		return digitalocean.NewDNSProvider()
-	case "dnsimple":
-		return dnsimple.NewDNSProvider()
-	case "dnsmadeeasy":
-		return dnsmadeeasy.NewDNSProvider()
-	case "dnspod":
-		return dnspod.NewDNSProvider()
-	case "duckdns":
-		return duckdns.NewDNSProvider()
-	case "dyn":
-		return dyn.NewDNSProvider()
-	case "fastdns":
-		return fastdns.NewDNSProvider()
-	case "exoscale":
-		return exoscale.NewDNSProvider()
-	case "gandi":
-		return gandi.NewDNSProvider()
-	case "gandiv5":
-		return gandiv5.NewDNSProvider()
-	case "glesys":
-		return glesys.NewDNSProvider()
-	case "gcloud":
-		return gcloud.NewDNSProvider()
-	case "godaddy":
-		return godaddy.NewDNSProvider()
-	case "iij":
-		return iij.NewDNSProvider()
-	case "lightsail":
-		return lightsail.NewDNSProvider()
-	case "linode":
-		return linode.NewDNSProvider()
-	case "manual":
-		return acme.NewDNSProviderManual()
-	case "namecheap":
-		return namecheap.NewDNSProvider()
-	case "namedotcom":
-		return namedotcom.NewDNSProvider()
-	case "netcup":
-		return netcup.NewDNSProvider()
-	case "nifcloud":
-		return nifcloud.NewDNSProvider()
-	case "rackspace":
-		return rackspace.NewDNSProvider()
-	case "route53":
-		return route53.NewDNSProvider()
-	case "rfc2136":
-		return rfc2136.NewDNSProvider()
-	case "sakuracloud":
-		return sakuracloud.NewDNSProvider()
-	case "vultr":
-		return vultr.NewDNSProvider()
-	case "ovh":
-		return ovh.NewDNSProvider()
-	case "pdns":
-		return pdns.NewDNSProvider()
-	case "ns1":
-		return ns1.NewDNSProvider()
-	case "otc":
-		return otc.NewDNSProvider()
-	case "exec":
-		return exec.NewDNSProvider()
-	case "vegadns":
-		return vegadns.NewDNSProvider()
-	default:
-		return nil, fmt.Errorf("unrecognised DNS provider: %s", name)
+	if strings.Contains(name, ",") {
+		return newFallbackProviderByNames(name)
+	}
+
+	for _, r := range registry {
+		if r.doc.Name == name {
+			return r.newProvider()
+		}
 	}
+	return nil, fmt.Errorf("unrecognised DNS provider: %s, the valid providers are: %s", name, strings.Join(Names(), ", "))
 }
@@ -1,11 +1,18 @@
 package dns
 
 import (
+	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/platform/config/env"
 	"github.com/xenolf/lego/providers/dns/exoscale"
+	"github.com/xenolf/lego/providers/dns/route53"
 )
 
 var (
@@ -46,5 +53,163 @@ func TestKnownDNSProviderError(t *testing.T) {
 
 func TestUnknownDNSProvider(t *testing.T) {
 	_, err := NewDNSChallengeProviderByName("foobar")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cloudflare, cloudxns")
+}
+
+// providerNames are the names of the providers whose package has another name.
+var providerNames = map[string]string{
+	"acmedns": "acme-dns",
+}
+
+func TestEveryProviderRegistered(t *testing.T) {
+	dirs, err := ioutil.ReadDir(".")
+	require.NoError(t, err)
+
+	names := Names()
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+
+		name := dir.Name()
+		if n, ok := providerNames[name]; ok {
+			name = n
+		}
+		assert.Contains(t, names, name, "Expected the provider of providers/dns/%s to be registered", dir.Name())
+	}
+	assert.Contains(t, names, "manual")
+	assert.Len(t, registry, len(names))
+}
+
+func TestKnownDNSProviderByName(t *testing.T) {
+	defer setEnv(map[string]string{
+		"AWS_ACCESS_KEY_ID":     "dummy",
+		"AWS_SECRET_ACCESS_KEY": "dummy",
+		"AWS_REGION":            "us-east-1",
+		"AWS_HOSTED_ZONE_ID":    "dummy",
+	})()
+
+	provider, err := NewDNSChallengeProviderByName("route53")
+	require.NoError(t, err)
+	assert.IsType(t, &route53.DNSProvider{}, provider)
+
+	provider, err = NewDNSChallengeProviderByName("manual")
+	require.NoError(t, err)
+	assert.IsType(t, &acme.DNSProviderManual{}, provider)
+}
+
+func TestDocumentations(t *testing.T) {
+	docs := Documentations()
+	assert.Len(t, docs, len(registry))
+
+	for i, doc := range docs {
+		if i > 0 {
+			assert.True(t, docs[i-1].Name < doc.Name, "Expected the providers sorted by name, got %s before %s", docs[i-1].Name, doc.Name)
+		}
+
+		_, err := NewDNSChallengeProviderByName(doc.Name)
+		if err != nil {
+			assert.NotContains(t, err.Error(), "unrecognised DNS provider", "The documented provider %s is not a provider", doc.Name)
+		}
+
+		if doc.Name != "manual" {
+			assert.NotEmpty(t, doc.Required, "Expected the required variables of %s", doc.Name)
+			assert.NotEmpty(t, doc.URL, "Expected the documentation URL of %s", doc.Name)
+		}
+	}
+}
+
+func TestDocumentationByName(t *testing.T) {
+	doc, err := DocumentationByName("exoscale")
+	assert.NoError(t, err)
+	assert.Equal(t, "exoscale", doc.Name)
+
+	_, err = DocumentationByName("foobar")
 	assert.Error(t, err)
 }
+
+// setEnv sets the environment variables and returns a function restoring them.
+func setEnv(values map[string]string) func() {
+	previous := make(map[string]*string)
+	for name, value := range values {
+		if v, ok := os.LookupEnv(name); ok {
+			previous[name] = &v
+		} else {
+			previous[name] = nil
+		}
+		os.Setenv(name, value)
+	}
+
+	return func() {
+		for name, value := range previous {
+			if value == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *value)
+			}
+		}
+	}
+}
+
+// dummyValues are the values of the required variables which cannot be any string, "dummy" for the others.
+var dummyValues = map[string]string{
+	"OVH_ENDPOINT": "ovh-eu",
+	"PDNS_API_URL": "http://127.0.0.1:8081",
+}
+
+// assertProviderTimeout asserts that the provider documents <PREFIX>_PROPAGATION_TIMEOUT and <PREFIX>_POLLING_INTERVAL,
+// and that its Timeout method returns their values.
+// The required variables are set to dummy values: the providers which cannot be created without reaching their API are skipped.
+func assertProviderTimeout(t *testing.T, doc env.Documentation) {
+	values := map[string]string{}
+	for _, v := range doc.Required {
+		values[v.Name] = "dummy"
+		if value, ok := dummyValues[v.Name]; ok {
+			values[v.Name] = value
+		}
+	}
+
+	var timeoutVar, intervalVar string
+	for _, v := range doc.Optional {
+		switch {
+		case strings.HasSuffix(v.Name, "_PROPAGATION_TIMEOUT"):
+			timeoutVar = v.Name
+		case strings.HasSuffix(v.Name, "_POLLING_INTERVAL"):
+			intervalVar = v.Name
+		}
+	}
+	require.NotEmpty(t, timeoutVar, "Expected %s to document a _PROPAGATION_TIMEOUT variable", doc.Name)
+	require.NotEmpty(t, intervalVar, "Expected %s to document a _POLLING_INTERVAL variable", doc.Name)
+	assert.Equal(t, strings.TrimSuffix(timeoutVar, "_PROPAGATION_TIMEOUT"), strings.TrimSuffix(intervalVar, "_POLLING_INTERVAL"),
+		"Expected the variables of %s to have the same prefix", doc.Name)
+
+	values[timeoutVar] = "123"
+	values[intervalVar] = "7"
+	defer setEnv(values)()
+
+	provider, err := NewDNSChallengeProviderByName(doc.Name)
+	if err != nil {
+		t.Skipf("The provider %s cannot be created with dummy credentials: %v", doc.Name, err)
+	}
+
+	timeoutProvider, ok := provider.(acme.ChallengeProviderTimeout)
+	require.True(t, ok, "Expected %s to implement acme.ChallengeProviderTimeout", doc.Name)
+
+	timeout, interval := timeoutProvider.Timeout()
+	assert.Equal(t, 123*time.Second, timeout, "Expected the timeout of %s to be set with %s", doc.Name, timeoutVar)
+	assert.Equal(t, 7*time.Second, interval, "Expected the interval of %s to be set with %s", doc.Name, intervalVar)
+}
+
+func TestProviderTimeouts(t *testing.T) {
+	for _, doc := range Documentations() {
+		if doc.Name == "manual" {
+			continue
+		}
+
+		doc := doc
+		t.Run(doc.Name, func(t *testing.T) {
+			assertProviderTimeout(t, doc)
+		})
+	}
+}
@@ -7,14 +7,32 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dnsimple/dnsimple-go/dnsimple"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
+	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the OAuth token of DNSimple and its API URL, e.g. of the sandbox.
+var Documentation = env.Documentation{
+	Name:        "dnsimple",
+	Description: "DNSimple",
+	URL:         "https://developer.dnsimple.com/v2/",
+	Required: []env.Var{
+		{Name: "DNSIMPLE_OAUTH_TOKEN", Description: "The OAuth2 access token of the account"},
+	},
+	Optional: append([]env.Var{
+		{Name: "DNSIMPLE_BASE_URL", Description: "The URL of the API, e.g. the one of the sandbox (default https://api.dnsimple.com)"},
+	}, env.PropagationVars("DNSIMPLE", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval)...),
+}
+
 // DNSProvider is an implementation of the acme.ChallengeProvider interface.
 type DNSProvider struct {
-	client *dnsimple.Client
+	client             *dnsimple.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for dnsimple.
@@ -42,12 +60,23 @@ func NewDNSProviderCredentials(accessToken, baseURL string) (*DNSProvider, error
 		client.BaseURL = baseURL
 	}
 
-	return &DNSProvider{client: client}, nil
+	return &DNSProvider{
+		client:             client,
+		propagationTimeout: env.GetOrDefaultSecond("DNSIMPLE_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("DNSIMPLE_POLLING_INTERVAL", acme.DefaultPollingInterval),
+	}, nil
+}
+
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with DNSIMPLE_PROPAGATION_TIMEOUT and DNSIMPLE_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
 }
 
 // Present creates a TXT record to fulfil the dns-01 challenge.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 
 	zoneName, err := d.getHostedZone(domain)
 
@@ -71,7 +100,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters.
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	records, err := d.findTxtRecords(domain, fqdn)
 	if err != nil {
@@ -15,16 +15,33 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the API key and secret of DNS Made Easy, and the switch to its sandbox.
+var Documentation = env.Documentation{
+	Name:        "dnsmadeeasy",
+	Description: "DNS Made Easy",
+	URL:         "https://api-docs.dnsmadeeasy.com/",
+	Required: []env.Var{
+		{Name: "DNSMADEEASY_API_KEY", Description: "The API key"},
+		{Name: "DNSMADEEASY_API_SECRET", Description: "The API secret"},
+	},
+	Optional: append([]env.Var{
+		{Name: "DNSMADEEASY_SANDBOX", Description: "Use the sandbox API if true (default false)"},
+	}, env.PropagationVars("DNSMADEEASY", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval)...),
+}
+
 // DNSProvider is an implementation of the acme.ChallengeProvider interface that uses
 // DNSMadeEasy's DNS API to manage TXT records for a domain.
 type DNSProvider struct {
-	baseURL   string
-	apiKey    string
-	apiSecret string
-	client    *http.Client
+	baseURL            string
+	apiKey             string
+	apiSecret          string
+	client             *http.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // Domain holds the DNSMadeEasy API representation of a Domain
@@ -78,16 +95,25 @@ func NewDNSProviderCredentials(baseURL, apiKey, apiSecret string) (*DNSProvider,
 	}
 
 	return &DNSProvider{
-		baseURL:   baseURL,
-		apiKey:    apiKey,
-		apiSecret: apiSecret,
-		client:    client,
+		baseURL:            baseURL,
+		apiKey:             apiKey,
+		apiSecret:          apiSecret,
+		client:             client,
+		propagationTimeout: env.GetOrDefaultSecond("DNSMADEEASY_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("DNSMADEEASY_POLLING_INTERVAL", acme.DefaultPollingInterval),
 	}, nil
 }
 
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with DNSMADEEASY_PROPAGATION_TIMEOUT and DNSMADEEASY_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
+}
+
 // Present creates a TXT record using the specified parameters
 func (d *DNSProvider) Present(domainName, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domainName, keyAuth)
+	fqdn, value := dns01.GetRecord(domainName, keyAuth)
+	ttl := dns01.DefaultTTL
 
 	authZone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	if err != nil {
@@ -110,7 +136,7 @@ func (d *DNSProvider) Present(domainName, token, keyAuth string) error {
 
 // CleanUp removes the TXT records matching the specified parameters
 func (d *DNSProvider) CleanUp(domainName, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domainName, keyAuth)
+	fqdn, _ := dns01.GetRecord(domainName, keyAuth)
 
 	authZone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	if err != nil {
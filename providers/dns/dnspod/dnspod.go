@@ -5,15 +5,30 @@ package dnspod
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/decker502/dnspod-go"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the API key of DNSPod.
+var Documentation = env.Documentation{
+	Name:        "dnspod",
+	Description: "DNSPod",
+	URL:         "https://www.dnspod.cn/docs/index.html",
+	Required: []env.Var{
+		{Name: "DNSPOD_API_KEY", Description: "The API token, as ID,TOKEN"},
+	},
+	Optional: env.PropagationVars("DNSPOD", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval),
+}
+
 // DNSProvider is an implementation of the acme.ChallengeProvider interface.
 type DNSProvider struct {
-	client *dnspod.Client
+	client             *dnspod.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for dnspod.
@@ -36,13 +51,22 @@ func NewDNSProviderCredentials(key string) (*DNSProvider, error) {
 
 	params := dnspod.CommonParams{LoginToken: key, Format: "json"}
 	return &DNSProvider{
-		client: dnspod.NewClient(params),
+		client:             dnspod.NewClient(params),
+		propagationTimeout: env.GetOrDefaultSecond("DNSPOD_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("DNSPOD_POLLING_INTERVAL", acme.DefaultPollingInterval),
 	}, nil
 }
 
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with DNSPOD_PROPAGATION_TIMEOUT and DNSPOD_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
+}
+
 // Present creates a TXT record to fulfil the dns-01 challenge.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 	zoneID, zoneName, err := d.getHostedZone(domain)
 	if err != nil {
 		return err
@@ -59,7 +83,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters.
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	records, err := d.findTxtRecords(domain, fqdn)
 	if err != nil {
@@ -6,15 +6,30 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the token of the Duck DNS account.
+var Documentation = env.Documentation{
+	Name:        "duckdns",
+	Description: "Duck DNS",
+	URL:         "https://www.duckdns.org/spec.jsp",
+	Required: []env.Var{
+		{Name: "DUCKDNS_TOKEN", Description: "The token of the account"},
+	},
+	Optional: env.PropagationVars("DUCKDNS", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval),
+}
+
 // DNSProvider adds and removes the record for the DNS challenge
 type DNSProvider struct {
 	// The api token
-	token string
+	token              string
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a new DNS provider using
@@ -35,12 +50,22 @@ func NewDNSProviderCredentials(token string) (*DNSProvider, error) {
 		return nil, errors.New("DuckDNS: credentials missing")
 	}
 
-	return &DNSProvider{token: token}, nil
+	return &DNSProvider{
+		token:              token,
+		propagationTimeout: env.GetOrDefaultSecond("DUCKDNS_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("DUCKDNS_POLLING_INTERVAL", acme.DefaultPollingInterval),
+	}, nil
+}
+
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with DUCKDNS_PROPAGATION_TIMEOUT and DUCKDNS_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
 }
 
 // Present creates a TXT record to fulfil the dns-01 challenge.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	_, txtRecord, _ := acme.DNS01Record(domain, keyAuth)
+	_, txtRecord := dns01.GetRecord(domain, keyAuth)
 	return updateTxtRecord(domain, d.token, txtRecord, false)
 }
 
@@ -49,6 +74,12 @@ func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 	return updateTxtRecord(domain, d.token, "", true)
 }
 
+// Sequential All DNS challenges for this provider will be resolved sequentially.
+// Returns the interval between each iteration.
+func (d *DNSProvider) Sequential() time.Duration {
+	return 60 * time.Second
+}
+
 // updateTxtRecord Update the domains TXT record
 // To update the TXT record we just need to make one simple get request.
 // In DuckDNS you only have one TXT record shared with the domain and all sub domains.
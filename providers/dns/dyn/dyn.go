@@ -11,9 +11,23 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the customer, the user and the password of the Dyn Managed DNS account.
+var Documentation = env.Documentation{
+	Name:        "dyn",
+	Description: "Dyn Managed DNS",
+	URL:         "https://help.dyn.com/rest/",
+	Required: []env.Var{
+		{Name: "DYN_CUSTOMER_NAME", Description: "The customer name"},
+		{Name: "DYN_USER_NAME", Description: "The API user"},
+		{Name: "DYN_PASSWORD", Description: "The password of the API user"},
+	},
+	Optional: env.PropagationVars("DYN", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval),
+}
+
 var dynBaseURL = "https://api.dynect.net/REST"
 
 type dynResponse struct {
@@ -33,11 +47,13 @@ type dynResponse struct {
 // DNSProvider is an implementation of the acme.ChallengeProvider interface that uses
 // Dyn's Managed DNS API to manage TXT records for a domain.
 type DNSProvider struct {
-	customerName string
-	userName     string
-	password     string
-	token        string
-	client       *http.Client
+	customerName       string
+	userName           string
+	password           string
+	token              string
+	client             *http.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for Dyn DNS.
@@ -60,13 +76,21 @@ func NewDNSProviderCredentials(customerName, userName, password string) (*DNSPro
 	}
 
 	return &DNSProvider{
-		customerName: customerName,
-		userName:     userName,
-		password:     password,
-		client:       &http.Client{Timeout: 10 * time.Second},
+		customerName:       customerName,
+		userName:           userName,
+		password:           password,
+		client:             &http.Client{Timeout: 10 * time.Second},
+		propagationTimeout: env.GetOrDefaultSecond("DYN_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("DYN_POLLING_INTERVAL", acme.DefaultPollingInterval),
 	}, nil
 }
 
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with DYN_PROPAGATION_TIMEOUT and DYN_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
+}
+
 func (d *DNSProvider) sendRequest(method, resource string, payload interface{}) (*dynResponse, error) {
 	url := fmt.Sprintf("%s/%s", dynBaseURL, resource)
 
@@ -178,7 +202,8 @@ func (d *DNSProvider) logout() error {
 
 // Present creates a TXT record using the specified parameters
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 
 	authZone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	if err != nil {
@@ -226,7 +251,7 @@ func (d *DNSProvider) publish(zone, notes string) error {
 
 // CleanUp removes the TXT record matching the specified parameters
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	authZone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	if err != nil {
@@ -17,7 +17,14 @@ It will then call the program './update-dns.sh' with like this:
 	./update-dns.sh "present" "_acme-challenge.foo.example.com." "MsijOYZxqyjGnFGwhjrhfg-Xgbl5r68WPda0J9EgqqI" "120"
 
 The program then needs to make sure the record is inserted.
-When it returns an error via a non-zero exit code, lego aborts.
+When it returns an error via a non-zero exit code, lego aborts,
+with the exit code and the standard error of the program in its error.
+A program still running after `EXEC_TIMEOUT` seconds (60 by default, 0 for no limit) is killed.
+
+The challenges of the domains of a certificate are solved one after the other,
+`EXEC_SEQUENCE_INTERVAL` seconds apart (60 by default),
+and the propagation of each record is checked for `EXEC_PROPAGATION_TIMEOUT` seconds (60 by default),
+every `EXEC_POLLING_INTERVAL` seconds (2 by default).
 
 When the record is to be removed again,
 the program is called with the first command-line parameter set to "cleanup" instead of "present".
@@ -1,21 +1,58 @@
 package exec
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/log"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the program creating and removing the records, and how it is run.
+var Documentation = env.Documentation{
+	Name:        "exec",
+	Description: "An external program, run to create and remove the TXT records",
+	URL:         "https://github.com/xenolf/lego/blob/master/providers/dns/exec/doc.go",
+	Required: []env.Var{
+		{Name: "EXEC_PATH", Description: "The program, run with present or cleanup, the FQDN and the value of the record"},
+	},
+	Optional: append([]env.Var{
+		{Name: "EXEC_MODE", Description: "RAW to pass the domain, the token and the key authorization instead of the FQDN and the value"},
+		{Name: "EXEC_TIMEOUT", Description: "Time limit of a run of the program, in seconds, after which it is killed (default 60)"},
+		{Name: "EXEC_SEQUENCE_INTERVAL", Description: "Time between the challenges of the domains, which are solved one after the other, in seconds (default 60)"},
+	}, env.PropagationVars("EXEC", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval)...),
+}
+
 // Config Provider configuration.
 type Config struct {
 	Program string
 	Mode    string
+	// Timeout is the time limit of a run of the program, after which it is killed.
+	// There is no limit if it is zero.
+	Timeout            time.Duration
+	PropagationTimeout time.Duration
+	PollingInterval    time.Duration
+	SequenceInterval   time.Duration
+}
+
+// NewDefaultConfig returns a default configuration for the DNSProvider
+func NewDefaultConfig() *Config {
+	return &Config{
+		Mode:               os.Getenv("EXEC_MODE"),
+		Timeout:            env.GetOrDefaultSecond("EXEC_TIMEOUT", 60*time.Second),
+		PropagationTimeout: env.GetOrDefaultSecond("EXEC_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		PollingInterval:    env.GetOrDefaultSecond("EXEC_POLLING_INTERVAL", acme.DefaultPollingInterval),
+		SequenceInterval:   env.GetOrDefaultSecond("EXEC_SEQUENCE_INTERVAL", 60*time.Second),
+	}
 }
 
 // DNSProvider adds and removes the record for the DNS challenge by calling a
@@ -32,10 +69,10 @@ func NewDNSProvider() (*DNSProvider, error) {
 		return nil, fmt.Errorf("exec: %v", err)
 	}
 
-	return NewDNSProviderConfig(&Config{
-		Program: values["EXEC_PATH"],
-		Mode:    os.Getenv("EXEC_MODE"),
-	})
+	config := NewDefaultConfig()
+	config.Program = values["EXEC_PATH"]
+
+	return NewDNSProviderConfig(config)
 }
 
 // NewDNSProviderConfig returns a new DNS provider which runs the given configuration
@@ -56,45 +93,107 @@ func NewDNSProviderProgram(program string) (*DNSProvider, error) {
 		return nil, errors.New("the program is undefined")
 	}
 
-	return NewDNSProviderConfig(&Config{Program: program})
+	config := NewDefaultConfig()
+	config.Program = program
+
+	return NewDNSProviderConfig(config)
 }
 
 // Present creates a TXT record to fulfil the dns-01 challenge.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	var args []string
-	if d.config.Mode == "RAW" {
-		args = []string{"present", "--", domain, token, keyAuth}
-	} else {
-		fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
-		args = []string{"present", fqdn, value, strconv.Itoa(ttl)}
-	}
+	return d.run("present", domain, token, keyAuth)
+}
 
-	cmd := exec.Command(d.config.Program, args...)
+// CleanUp removes the TXT record matching the specified parameters
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	return d.run("cleanup", domain, token, keyAuth)
+}
 
-	output, err := cmd.CombinedOutput()
-	if len(output) > 0 {
-		log.Println(string(output))
-	}
+// Timeout returns the timeout and interval to use when checking for DNS
+// propagation. Adjusting here to cope with spikes in propagation times.
+// EXEC_PROPAGATION_TIMEOUT and EXEC_POLLING_INTERVAL override them.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.config.PropagationTimeout, d.config.PollingInterval
+}
 
-	return err
+// Sequential All DNS challenges for this provider will be resolved sequentially.
+// Returns the interval between each iteration.
+func (d *DNSProvider) Sequential() time.Duration {
+	return d.config.SequenceInterval
 }
 
-// CleanUp removes the TXT record matching the specified parameters
-func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+// run runs the program for the action, and returns its exit code and its standard error in the error if it fails.
+func (d *DNSProvider) run(action, domain, token, keyAuth string) error {
 	var args []string
 	if d.config.Mode == "RAW" {
-		args = []string{"cleanup", "--", domain, token, keyAuth}
+		args = []string{action, "--", domain, token, keyAuth}
 	} else {
-		fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
-		args = []string{"cleanup", fqdn, value, strconv.Itoa(ttl)}
+		fqdn, value := dns01.GetRecord(domain, keyAuth)
+		ttl := dns01.DefaultTTL
+		args = []string{action, fqdn, value, strconv.Itoa(ttl)}
 	}
 
+	ctx := context.Background()
+	if d.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.config.Timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
 	cmd := exec.Command(d.config.Program, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	setProcessGroup(cmd)
+
+	err := cmd.Start()
+	if err == nil {
+		// on timeout, the processes started by the program are also killed:
+		// they would keep its output open, and Wait blocked, until they exit.
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				killProcessGroup(cmd)
+			case <-done:
+			}
+		}()
+		err = cmd.Wait()
+		close(done)
+	}
 
-	output, err := cmd.CombinedOutput()
-	if len(output) > 0 {
-		log.Println(string(output))
+	// the key authorization is a secret, it is not logged if the program prints its arguments.
+	if output := redact(string(append(stdout.Bytes(), stderr.Bytes()...)), keyAuth); output != "" {
+		if err != nil {
+			log.Warnf("[%s] exec: %s %s: %s", domain, d.config.Program, action, output)
+		} else {
+			log.Infof("[%s] exec: %s %s: %s", domain, d.config.Program, action, output)
+		}
 	}
 
-	return err
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("exec: %s %s was killed after %s", d.config.Program, action, d.config.Timeout)
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		msg := redact(stderr.String(), keyAuth)
+		if msg == "" {
+			return fmt.Errorf("exec: %s %s exited with code %d", d.config.Program, action, exitErr.ExitCode())
+		}
+		return fmt.Errorf("exec: %s %s exited with code %d: %s", d.config.Program, action, exitErr.ExitCode(), msg)
+	}
+	if err != nil {
+		return fmt.Errorf("exec: %v", err)
+	}
+	return nil
+}
+
+// redact trims the output of the program and hides the key authorization in it.
+func redact(output, keyAuth string) string {
+	output = strings.TrimSpace(output)
+	if keyAuth == "" {
+		return output
+	}
+	return strings.Replace(output, keyAuth, "<redacted>", -1)
 }
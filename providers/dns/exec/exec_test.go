@@ -0,0 +1,127 @@
+package exec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/internal/challengetest"
+)
+
+// writeProgram writes a shell script running the given commands in the directory, and returns its path.
+func writeProgram(t *testing.T, dir, script string) string {
+	program := filepath.Join(dir, "update-dns.sh")
+	err := ioutil.WriteFile(program, []byte("#!/bin/sh\n"+script+"\n"), 0700)
+	require.NoError(t, err)
+
+	return program
+}
+
+// tempDir returns a new temporary directory, and the function removing it.
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "lego-exec")
+	require.NoError(t, err)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestDNSProvider_Present(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+	argsFile := filepath.Join(dir, "args")
+
+	program := writeProgram(t, dir, `echo "$@" > `+argsFile)
+
+	testCases := []struct {
+		desc     string
+		mode     string
+		expected string
+	}{
+		{
+			desc:     "default mode",
+			expected: "present _acme-challenge.example.com. pW9ZKG0xz_PCriK-nCMOjADy9eJcgGWIzkkj2fN4uZM 120",
+		},
+		{
+			desc:     "raw mode",
+			mode:     "RAW",
+			expected: "present -- example.com token keyAuth",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			provider, err := NewDNSProviderConfig(&Config{Program: program, Mode: test.mode})
+			require.NoError(t, err)
+
+			err = provider.Present("example.com", "token", "keyAuth")
+			require.NoError(t, err)
+
+			args, err := ioutil.ReadFile(argsFile)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, strings.TrimSpace(string(args)))
+		})
+	}
+}
+
+func TestDNSProvider_ExitCode(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+	program := writeProgram(t, dir, `echo "zone not found" >&2; exit 3`)
+
+	provider, err := NewDNSProviderConfig(&Config{Program: program})
+	require.NoError(t, err)
+
+	err = provider.CleanUp("example.com", "token", "keyAuth")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exited with code 3: zone not found")
+}
+
+func TestDNSProvider_Timeout(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+	// sleep is a child of the shell, keeping its output open if only the shell is killed.
+	program := writeProgram(t, dir, `sleep 10`)
+
+	provider, err := NewDNSProviderConfig(&Config{Program: program, Timeout: 100 * time.Millisecond})
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = provider.Present("example.com", "token", "keyAuth")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "was killed after")
+	assert.True(t, time.Since(start) < 5*time.Second, "the program was not killed")
+}
+
+func TestNewDefaultConfig(t *testing.T) {
+	defer os.Unsetenv("EXEC_SEQUENCE_INTERVAL")
+	os.Setenv("EXEC_SEQUENCE_INTERVAL", "5")
+
+	config := NewDefaultConfig()
+	assert.Equal(t, 5*time.Second, config.SequenceInterval)
+	assert.Equal(t, 60*time.Second, config.Timeout)
+	assert.Equal(t, 60*time.Second, config.PropagationTimeout)
+	assert.Equal(t, 2*time.Second, config.PollingInterval)
+}
+
+func TestDNSProvider_NoSecretLogged(t *testing.T) {
+	logs := challengetest.RecordLogs()
+	defer logs.Stop()
+
+	dir, remove := tempDir(t)
+	defer remove()
+	program := writeProgram(t, dir, `echo "$@"; echo "$@" >&2; exit 1`)
+
+	provider, err := NewDNSProviderConfig(&Config{Program: program, Mode: "RAW"})
+	require.NoError(t, err)
+
+	err = provider.Present("example.com", "token", "secret-key-authorization")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret-key-authorization")
+
+	logs.AssertNoSecrets(t, "secret-key-authorization")
+	assert.Contains(t, logs.Entries(), "warn: [example.com] exec: "+program+" present: present -- example.com token <redacted>\npresent -- example.com token <redacted>")
+}
@@ -0,0 +1,11 @@
+package exec
+
+import "os/exec"
+
+// setProcessGroup does nothing on Windows, which has no process groups.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the program only, the processes it started keep running.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -6,15 +6,33 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/exoscale/egoscale"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the API key and secret of Exoscale and its endpoint.
+var Documentation = env.Documentation{
+	Name:        "exoscale",
+	Description: "Exoscale DNS",
+	URL:         "https://community.exoscale.com/documentation/dns/api/",
+	Required: []env.Var{
+		{Name: "EXOSCALE_API_KEY", Description: "The API key"},
+		{Name: "EXOSCALE_API_SECRET", Description: "The API secret"},
+	},
+	Optional: append([]env.Var{
+		{Name: "EXOSCALE_ENDPOINT", Description: "The URL of the API (default https://api.exoscale.ch/dns)"},
+	}, env.PropagationVars("EXOSCALE", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval)...),
+}
+
 // DNSProvider is an implementation of the acme.ChallengeProvider interface.
 type DNSProvider struct {
-	client *egoscale.Client
+	client             *egoscale.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider Credentials must be passed in the environment variables:
@@ -41,13 +59,22 @@ func NewDNSProviderClient(key, secret, endpoint string) (*DNSProvider, error) {
 	}
 
 	return &DNSProvider{
-		client: egoscale.NewClient(endpoint, key, secret),
+		client:             egoscale.NewClient(endpoint, key, secret),
+		propagationTimeout: env.GetOrDefaultSecond("EXOSCALE_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("EXOSCALE_POLLING_INTERVAL", acme.DefaultPollingInterval),
 	}, nil
 }
 
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with EXOSCALE_PROPAGATION_TIMEOUT and EXOSCALE_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
+}
+
 // Present creates a TXT record to fulfil the dns-01 challenge.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 	zone, recordName, err := d.FindZoneAndRecordName(fqdn, domain)
 	if err != nil {
 		return err
@@ -90,7 +117,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the record matching the specified parameters.
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 	zone, recordName, err := d.FindZoneAndRecordName(fqdn, domain)
 	if err != nil {
 		return err
@@ -0,0 +1,119 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/log"
+)
+
+// FallbackProvider is a dns-01 ChallengeProvider presenting the records with a primary provider,
+// and with a secondary provider when the primary fails, e.g. during an outage of its API.
+// Both providers must manage the same zone, e.g. with the zone slaved to the secondary.
+type FallbackProvider struct {
+	primary   acme.ChallengeProvider
+	secondary acme.ChallengeProvider
+
+	mu sync.Mutex
+	// presenters are the providers which presented the challenges, by challenge.
+	presenters map[fallbackChallenge]acme.ChallengeProvider
+}
+
+type fallbackChallenge struct {
+	domain, token, keyAuth string
+}
+
+// NewFallbackProvider returns a FallbackProvider trying primary then secondary.
+func NewFallbackProvider(primary, secondary acme.ChallengeProvider) *FallbackProvider {
+	return &FallbackProvider{
+		primary:    primary,
+		secondary:  secondary,
+		presenters: make(map[fallbackChallenge]acme.ChallengeProvider),
+	}
+}
+
+// Present creates the TXT record with the primary provider, with the secondary one if it fails.
+func (f *FallbackProvider) Present(domain, token, keyAuth string) error {
+	presenter := f.primary
+	err := f.primary.Present(domain, token, keyAuth)
+	if err != nil {
+		log.Warnf("[%s] fallback: the primary DNS provider failed, trying the secondary one: %v", domain, err)
+
+		presenter = f.secondary
+		if secondaryErr := f.secondary.Present(domain, token, keyAuth); secondaryErr != nil {
+			return fmt.Errorf("fallback: primary: %v; secondary: %v", err, secondaryErr)
+		}
+	}
+
+	f.mu.Lock()
+	f.presenters[fallbackChallenge{domain, token, keyAuth}] = presenter
+	f.mu.Unlock()
+	return nil
+}
+
+// CleanUp removes the TXT record with the provider which created it.
+func (f *FallbackProvider) CleanUp(domain, token, keyAuth string) error {
+	key := fallbackChallenge{domain, token, keyAuth}
+
+	f.mu.Lock()
+	presenter, ok := f.presenters[key]
+	delete(f.presenters, key)
+	f.mu.Unlock()
+
+	if !ok {
+		presenter = f.primary
+	}
+	return presenter.CleanUp(domain, token, keyAuth)
+}
+
+// Timeout returns the longest timeout and interval of the providers,
+// so that the propagation of a record created by either of them can be waited for.
+func (f *FallbackProvider) Timeout() (timeout, interval time.Duration) {
+	timeout, interval = providerTimeout(f.primary)
+	secondaryTimeout, secondaryInterval := providerTimeout(f.secondary)
+
+	if secondaryTimeout > timeout {
+		timeout = secondaryTimeout
+	}
+	if secondaryInterval > interval {
+		interval = secondaryInterval
+	}
+	return timeout, interval
+}
+
+// providerTimeout returns the timeout and interval of the provider, the defaults of the acme package if it has none.
+func providerTimeout(provider acme.ChallengeProvider) (timeout, interval time.Duration) {
+	if p, ok := provider.(acme.ChallengeProviderTimeout); ok {
+		return p.Timeout()
+	}
+	return acme.DefaultPropagationTimeout, acme.DefaultPollingInterval
+}
+
+// newFallbackProviderByNames returns the providers of the comma-separated names,
+// each one falling back to the next one, e.g. "cloudflare,route53".
+func newFallbackProviderByNames(names string) (acme.ChallengeProvider, error) {
+	var provider acme.ChallengeProvider
+
+	list := strings.Split(names, ",")
+	for i := len(list) - 1; i >= 0; i-- {
+		name := strings.TrimSpace(list[i])
+		if name == "" {
+			return nil, fmt.Errorf("fallback: empty DNS provider name in %q", names)
+		}
+
+		p, err := NewDNSChallengeProviderByName(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if provider == nil {
+			provider = p
+		} else {
+			provider = NewFallbackProvider(p, provider)
+		}
+	}
+	return provider, nil
+}
@@ -0,0 +1,97 @@
+package dns
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvider struct {
+	presentErr error
+	timeout    time.Duration
+	presented  []string
+	cleaned    []string
+}
+
+func (p *fakeProvider) Present(domain, token, keyAuth string) error {
+	if p.presentErr != nil {
+		return p.presentErr
+	}
+	p.presented = append(p.presented, domain)
+	return nil
+}
+
+func (p *fakeProvider) CleanUp(domain, token, keyAuth string) error {
+	p.cleaned = append(p.cleaned, domain)
+	return nil
+}
+
+func (p *fakeProvider) Timeout() (timeout, interval time.Duration) {
+	return p.timeout, time.Second
+}
+
+func TestFallbackProviderPrimary(t *testing.T) {
+	primary := &fakeProvider{}
+	secondary := &fakeProvider{}
+	provider := NewFallbackProvider(primary, secondary)
+
+	require.NoError(t, provider.Present("example.com", "token", "keyAuth"))
+	require.NoError(t, provider.CleanUp("example.com", "token", "keyAuth"))
+
+	assert.Equal(t, []string{"example.com"}, primary.presented)
+	assert.Equal(t, []string{"example.com"}, primary.cleaned)
+	assert.Empty(t, secondary.presented)
+	assert.Empty(t, secondary.cleaned)
+}
+
+func TestFallbackProviderSecondary(t *testing.T) {
+	primary := &fakeProvider{presentErr: errors.New("primary: API down")}
+	secondary := &fakeProvider{}
+	provider := NewFallbackProvider(primary, secondary)
+
+	require.NoError(t, provider.Present("example.com", "token", "keyAuth"))
+	require.NoError(t, provider.CleanUp("example.com", "token", "keyAuth"))
+
+	assert.Empty(t, primary.cleaned)
+	assert.Equal(t, []string{"example.com"}, secondary.presented)
+	assert.Equal(t, []string{"example.com"}, secondary.cleaned)
+}
+
+func TestFallbackProviderBothFail(t *testing.T) {
+	primary := &fakeProvider{presentErr: errors.New("primary: API down")}
+	secondary := &fakeProvider{presentErr: errors.New("secondary: unauthorized")}
+	provider := NewFallbackProvider(primary, secondary)
+
+	err := provider.Present("example.com", "token", "keyAuth")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "primary: API down")
+	assert.Contains(t, err.Error(), "secondary: unauthorized")
+}
+
+func TestFallbackProviderTimeout(t *testing.T) {
+	provider := NewFallbackProvider(&fakeProvider{timeout: 2 * time.Minute}, &fakeProvider{timeout: 5 * time.Minute})
+
+	timeout, interval := provider.Timeout()
+	assert.Equal(t, 5*time.Minute, timeout)
+	assert.Equal(t, time.Second, interval)
+}
+
+func TestFallbackProviderByNames(t *testing.T) {
+	defer restoreExoscaleEnv()
+	os.Setenv("EXOSCALE_API_KEY", "abc")
+	os.Setenv("EXOSCALE_API_SECRET", "123")
+
+	provider, err := NewDNSChallengeProviderByName("exoscale, manual")
+	require.NoError(t, err)
+	assert.IsType(t, &FallbackProvider{}, provider)
+
+	_, err = NewDNSChallengeProviderByName("exoscale,")
+	assert.Error(t, err)
+
+	_, err = NewDNSChallengeProviderByName("exoscale,foobar")
+	assert.Error(t, err)
+}
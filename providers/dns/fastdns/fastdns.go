@@ -3,16 +3,34 @@ package fastdns
 import (
 	"fmt"
 	"reflect"
+	"time"
 
 	configdns "github.com/akamai/AkamaiOPEN-edgegrid-golang/configdns-v1"
 	"github.com/akamai/AkamaiOPEN-edgegrid-golang/edgegrid"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the EdgeGrid credentials of the Akamai API.
+var Documentation = env.Documentation{
+	Name:        "fastdns",
+	Description: "Akamai FastDNS",
+	URL:         "https://developer.akamai.com/api/web_performance/fast_dns_zone_management/v2.html",
+	Required: []env.Var{
+		{Name: "AKAMAI_HOST", Description: "The host of the API client"},
+		{Name: "AKAMAI_CLIENT_TOKEN", Description: "The client token"},
+		{Name: "AKAMAI_CLIENT_SECRET", Description: "The client secret"},
+		{Name: "AKAMAI_ACCESS_TOKEN", Description: "The access token"},
+	},
+	Optional: env.PropagationVars("AKAMAI", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval),
+}
+
 // DNSProvider is an implementation of the acme.ChallengeProvider interface.
 type DNSProvider struct {
-	config edgegrid.Config
+	config             edgegrid.Config
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider uses the supplied environment variables to return a DNSProvider instance:
@@ -46,13 +64,22 @@ func NewDNSProviderClient(host, clientToken, clientSecret, accessToken string) (
 	}
 
 	return &DNSProvider{
-		config: config,
+		config:             config,
+		propagationTimeout: env.GetOrDefaultSecond("AKAMAI_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("AKAMAI_POLLING_INTERVAL", acme.DefaultPollingInterval),
 	}, nil
 }
 
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with AKAMAI_PROPAGATION_TIMEOUT and AKAMAI_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
+}
+
 // Present creates a TXT record to fullfil the dns-01 challenge.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 	zoneName, recordName, err := d.findZoneAndRecordName(fqdn, domain)
 	if err != nil {
 		return err
@@ -86,7 +113,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the record matching the specified parameters.
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 	zoneName, recordName, err := d.findZoneAndRecordName(fqdn, domain)
 	if err != nil {
 		return err
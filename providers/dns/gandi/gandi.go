@@ -14,9 +14,26 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+const (
+	defaultPropagationTimeout = 40 * time.Minute
+	defaultPollingInterval    = 60 * time.Second
+)
+
+// Documentation lists the API key of the Gandi XML-RPC API.
+var Documentation = env.Documentation{
+	Name:        "gandi",
+	Description: "Gandi XML-RPC API (v3)",
+	URL:         "http://doc.rpc.gandi.net/index.html",
+	Required: []env.Var{
+		{Name: "GANDI_API_KEY", Description: "The API key"},
+	},
+	Optional: env.PropagationVars("GANDI", defaultPropagationTimeout, defaultPollingInterval),
+}
+
 // Gandi API reference:       http://doc.rpc.gandi.net/index.html
 // Gandi API domain examples: http://doc.rpc.gandi.net/domain/faq.html
 
@@ -45,6 +62,8 @@ type DNSProvider struct {
 	inProgressAuthZones map[string]struct{}
 	inProgressMu        sync.Mutex
 	client              *http.Client
+	propagationTimeout  time.Duration
+	pollingInterval     time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for Gandi.
@@ -69,6 +88,8 @@ func NewDNSProviderCredentials(apiKey string) (*DNSProvider, error) {
 		inProgressFQDNs:     make(map[string]inProgressInfo),
 		inProgressAuthZones: make(map[string]struct{}),
 		client:              &http.Client{Timeout: 60 * time.Second},
+		propagationTimeout:  env.GetOrDefaultSecond("GANDI_PROPAGATION_TIMEOUT", defaultPropagationTimeout),
+		pollingInterval:     env.GetOrDefaultSecond("GANDI_POLLING_INTERVAL", defaultPollingInterval),
 	}, nil
 }
 
@@ -76,7 +97,8 @@ func NewDNSProviderCredentials(apiKey string) (*DNSProvider, error) {
 // does this by creating and activating a new temporary Gandi DNS
 // zone. This new zone contains the TXT record.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 	if ttl < 300 {
 		ttl = 300 // 300 is gandi minimum value for ttl
 	}
@@ -156,7 +178,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 // parameters. It does this by restoring the old Gandi DNS zone and
 // removing the temporary one created by Present.
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 	// acquire lock and retrieve zoneID, newZoneID and authZone
 	d.inProgressMu.Lock()
 	defer d.inProgressMu.Unlock()
@@ -183,9 +205,10 @@ func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 
 // Timeout returns the values (40*time.Minute, 60*time.Second) which
 // are used by the acme package as timeout and check interval values
-// when checking for DNS record propagation with Gandi.
+// when checking for DNS record propagation with Gandi,
+// unless set with GANDI_PROPAGATION_TIMEOUT and GANDI_POLLING_INTERVAL.
 func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
-	return 40 * time.Minute, 60 * time.Second
+	return d.propagationTimeout, d.pollingInterval
 }
 
 // types for XML-RPC method calls and parameters
@@ -12,10 +12,27 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/log"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+const (
+	defaultPropagationTimeout = 20 * time.Minute
+	defaultPollingInterval    = 20 * time.Second
+)
+
+// Documentation lists the API key of Gandi LiveDNS.
+var Documentation = env.Documentation{
+	Name:        "gandiv5",
+	Description: "Gandi LiveDNS (v5)",
+	URL:         "http://doc.livedns.gandi.net/",
+	Required: []env.Var{
+		{Name: "GANDIV5_API_KEY", Description: "The API key"},
+	},
+	Optional: env.PropagationVars("GANDIV5", defaultPropagationTimeout, defaultPollingInterval),
+}
+
 // Gandi API reference:       http://doc.livedns.gandi.net/
 
 var (
@@ -38,10 +55,12 @@ type inProgressInfo struct {
 // acme.ChallengeProviderTimeout interface that uses Gandi's LiveDNS
 // API to manage TXT records for a domain.
 type DNSProvider struct {
-	apiKey          string
-	inProgressFQDNs map[string]inProgressInfo
-	inProgressMu    sync.Mutex
-	client          *http.Client
+	apiKey             string
+	inProgressFQDNs    map[string]inProgressInfo
+	inProgressMu       sync.Mutex
+	client             *http.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for Gandi.
@@ -62,15 +81,18 @@ func NewDNSProviderCredentials(apiKey string) (*DNSProvider, error) {
 		return nil, fmt.Errorf("Gandi DNS: No Gandi API Key given")
 	}
 	return &DNSProvider{
-		apiKey:          apiKey,
-		inProgressFQDNs: make(map[string]inProgressInfo),
-		client:          &http.Client{Timeout: 10 * time.Second},
+		apiKey:             apiKey,
+		inProgressFQDNs:    make(map[string]inProgressInfo),
+		client:             &http.Client{Timeout: 10 * time.Second},
+		propagationTimeout: env.GetOrDefaultSecond("GANDIV5_PROPAGATION_TIMEOUT", defaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("GANDIV5_POLLING_INTERVAL", defaultPollingInterval),
 	}, nil
 }
 
 // Present creates a TXT record using the specified parameters.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 	if ttl < 300 {
 		ttl = 300 // 300 is gandi minimum value for ttl
 	}
@@ -110,7 +132,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters.
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	// acquire lock and retrieve authZone
 	d.inProgressMu.Lock()
@@ -130,9 +152,10 @@ func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 
 // Timeout returns the values (20*time.Minute, 20*time.Second) which
 // are used by the acme package as timeout and check interval values
-// when checking for DNS record propagation with Gandi.
+// when checking for DNS record propagation with Gandi,
+// unless set with GANDIV5_PROPAGATION_TIMEOUT and GANDIV5_POLLING_INTERVAL.
 func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
-	return 20 * time.Minute, 20 * time.Second
+	return d.propagationTimeout, d.pollingInterval
 }
 
 // types for JSON method calls and parameters
@@ -10,6 +10,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/internal/challengetest"
 )
 
 // TestDNSProvider runs Present and CleanUp against a fake Gandi RPC
@@ -27,6 +29,7 @@ func TestDNSProvider(t *testing.T) {
 	// start fake RPC server
 	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		require.Equal(t, "application/json", r.Header.Get("Content-Type"), "invalid content type")
+		require.Equal(t, "/domains/example.com/records/_acme-challenge.abc.def/TXT", r.URL.Path, "invalid zone or record name")
 
 		req, err := ioutil.ReadAll(r.Body)
 		require.NoError(t, err)
@@ -41,18 +44,20 @@ func TestDNSProvider(t *testing.T) {
 	}))
 	defer fakeServer.Close()
 
-	// define function to override findZoneByFqdn with
-	fakeFindZoneByFqdn := func(fqdn string, nameserver []string) (string, error) {
-		return "example.com.", nil
-	}
+	// the zone is found by the nameserver of example.com.
+	nameserver := challengetest.NewDNSServer(t, "example.com.")
+	defer nameserver.Close()
 
-	// override gandi endpoint and findZoneByFqdn function
-	savedEndpoint, savedFindZoneByFqdn := endpoint, findZoneByFqdn
+	acme.ClearFqdnCache()
+	defer acme.ClearFqdnCache()
+
+	// override gandi endpoint and the recursive nameservers
+	savedEndpoint, savedNameservers := endpoint, acme.RecursiveNameservers
 	defer func() {
-		endpoint, findZoneByFqdn = savedEndpoint, savedFindZoneByFqdn
+		endpoint, acme.RecursiveNameservers = savedEndpoint, savedNameservers
 	}()
 
-	endpoint, findZoneByFqdn = fakeServer.URL, fakeFindZoneByFqdn
+	endpoint, acme.RecursiveNameservers = fakeServer.URL, []string{nameserver.Addr()}
 
 	// run Present
 	err = provider.Present("abc.def.example.com", "", fakeKeyAuth)
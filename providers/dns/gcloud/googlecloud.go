@@ -10,6 +10,9 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
+	"github.com/xenolf/lego/platform/config/env"
+	"github.com/xenolf/lego/platform/wait"
 
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2/google"
@@ -17,10 +20,30 @@ import (
 	"google.golang.org/api/dns/v1"
 )
 
+const (
+	defaultPropagationTimeout = 180 * time.Second
+	defaultPollingInterval    = 5 * time.Second
+)
+
+// Documentation lists the Google Cloud project and its service account.
+var Documentation = env.Documentation{
+	Name:        "gcloud",
+	Description: "Google Cloud DNS",
+	URL:         "https://cloud.google.com/dns/api/v1/",
+	Required: []env.Var{
+		{Name: "GCE_PROJECT", Description: "The project of the DNS zones, unless GCE_SERVICE_ACCOUNT_FILE is set"},
+	},
+	Optional: append([]env.Var{
+		{Name: "GCE_SERVICE_ACCOUNT_FILE", Description: "The JSON key file of a service account, whose project is used (default: the application default credentials)"},
+	}, env.PropagationVars("GCE", defaultPropagationTimeout, defaultPollingInterval)...),
+}
+
 // DNSProvider is an implementation of the DNSProvider interface.
 type DNSProvider struct {
-	project string
-	client  *dns.Service
+	project            string
+	client             *dns.Service
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for Google Cloud
@@ -52,8 +75,10 @@ func NewDNSProviderCredentials(project string) (*DNSProvider, error) {
 		return nil, fmt.Errorf("unable to create Google Cloud DNS service: %v", err)
 	}
 	return &DNSProvider{
-		project: project,
-		client:  svc,
+		project:            project,
+		client:             svc,
+		propagationTimeout: env.GetOrDefaultSecond("GCE_PROPAGATION_TIMEOUT", defaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("GCE_POLLING_INTERVAL", defaultPollingInterval),
 	}, nil
 }
 
@@ -90,14 +115,17 @@ func NewDNSProviderServiceAccount(saFile string) (*DNSProvider, error) {
 		return nil, fmt.Errorf("unable to create Google Cloud DNS service: %v", err)
 	}
 	return &DNSProvider{
-		project: project,
-		client:  svc,
+		project:            project,
+		client:             svc,
+		propagationTimeout: env.GetOrDefaultSecond("GCE_PROPAGATION_TIMEOUT", defaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("GCE_POLLING_INTERVAL", defaultPollingInterval),
 	}, nil
 }
 
 // Present creates a TXT record to fulfil the dns-01 challenge.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 
 	zone, err := d.getHostedZone(domain)
 	if err != nil {
@@ -130,21 +158,22 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 	}
 
 	// wait for change to be acknowledged
-	for chg.Status == "pending" {
-		time.Sleep(time.Second)
+	return wait.For(context.Background(), d.propagationTimeout, time.Second, func() (bool, error) {
+		if chg.Status != "pending" {
+			return true, nil
+		}
 
 		chg, err = d.client.Changes.Get(d.project, zone, chg.Id).Do()
 		if err != nil {
-			return err
+			return false, wait.Permanent(err)
 		}
-	}
-
-	return nil
+		return chg.Status != "pending", nil
+	})
 }
 
 // CleanUp removes the TXT record matching the specified parameters.
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	zone, err := d.getHostedZone(domain)
 	if err != nil {
@@ -165,9 +194,9 @@ func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 }
 
 // Timeout customizes the timeout values used by the ACME package for checking
-// DNS record validity.
+// DNS record validity, set with GCE_PROPAGATION_TIMEOUT and GCE_POLLING_INTERVAL.
 func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
-	return 180 * time.Second, 5 * time.Second
+	return d.propagationTimeout, d.pollingInterval
 }
 
 // getHostedZone returns the managed-zone
@@ -12,10 +12,28 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/log"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+const (
+	defaultPropagationTimeout = 20 * time.Minute
+	defaultPollingInterval    = 20 * time.Second
+)
+
+// Documentation lists the API user and key of GleSYS.
+var Documentation = env.Documentation{
+	Name:        "glesys",
+	Description: "GleSYS",
+	URL:         "https://github.com/GleSYS/API/wiki/API-Documentation",
+	Required: []env.Var{
+		{Name: "GLESYS_API_USER", Description: "The API user"},
+		{Name: "GLESYS_API_KEY", Description: "The API key"},
+	},
+	Optional: env.PropagationVars("GLESYS", defaultPropagationTimeout, defaultPollingInterval),
+}
+
 // GleSYS API reference: https://github.com/GleSYS/API/wiki/API-Documentation
 
 // domainAPI is the GleSYS API endpoint used by Present and CleanUp.
@@ -25,11 +43,13 @@ const domainAPI = "https://api.glesys.com/domain"
 // acme.ChallengeProviderTimeout interface that uses GleSYS
 // API to manage TXT records for a domain.
 type DNSProvider struct {
-	apiUser       string
-	apiKey        string
-	activeRecords map[string]int
-	inProgressMu  sync.Mutex
-	client        *http.Client
+	apiUser            string
+	apiKey             string
+	activeRecords      map[string]int
+	inProgressMu       sync.Mutex
+	client             *http.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for GleSYS.
@@ -52,16 +72,19 @@ func NewDNSProviderCredentials(apiUser string, apiKey string) (*DNSProvider, err
 	}
 
 	return &DNSProvider{
-		apiUser:       apiUser,
-		apiKey:        apiKey,
-		activeRecords: make(map[string]int),
-		client:        &http.Client{Timeout: 10 * time.Second},
+		apiUser:            apiUser,
+		apiKey:             apiKey,
+		activeRecords:      make(map[string]int),
+		client:             &http.Client{Timeout: 10 * time.Second},
+		propagationTimeout: env.GetOrDefaultSecond("GLESYS_PROPAGATION_TIMEOUT", defaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("GLESYS_POLLING_INTERVAL", defaultPollingInterval),
 	}, nil
 }
 
 // Present creates a TXT record using the specified parameters.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 	if ttl < 60 {
 		ttl = 60 // 60 is GleSYS minimum value for ttl
 	}
@@ -97,7 +120,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters.
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	// acquire lock and retrieve authZone
 	d.inProgressMu.Lock()
@@ -116,9 +139,10 @@ func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 
 // Timeout returns the values (20*time.Minute, 20*time.Second) which
 // are used by the acme package as timeout and check interval values
-// when checking for DNS record propagation with GleSYS.
+// when checking for DNS record propagation with GleSYS,
+// unless set with GLESYS_PROPAGATION_TIMEOUT and GLESYS_POLLING_INTERVAL.
 func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
-	return 20 * time.Minute, 20 * time.Second
+	return d.propagationTimeout, d.pollingInterval
 }
 
 // types for JSON method calls, parameters, and responses
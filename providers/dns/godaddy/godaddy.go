@@ -12,17 +12,37 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+const (
+	defaultPropagationTimeout = 120 * time.Second
+	defaultPollingInterval    = 2 * time.Second
+)
+
+// Documentation lists the API key and secret of GoDaddy.
+var Documentation = env.Documentation{
+	Name:        "godaddy",
+	Description: "GoDaddy",
+	URL:         "https://developer.godaddy.com/doc/endpoint/domains",
+	Required: []env.Var{
+		{Name: "GODADDY_API_KEY", Description: "The API key"},
+		{Name: "GODADDY_API_SECRET", Description: "The API secret"},
+	},
+	Optional: env.PropagationVars("GODADDY", defaultPropagationTimeout, defaultPollingInterval),
+}
+
 // GoDaddyAPIURL represents the API endpoint to call.
 const apiURL = "https://api.godaddy.com"
 
 // DNSProvider is an implementation of the acme.ChallengeProvider interface
 type DNSProvider struct {
-	apiKey    string
-	apiSecret string
-	client    *http.Client
+	apiKey             string
+	apiSecret          string
+	client             *http.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for godaddy.
@@ -45,16 +65,19 @@ func NewDNSProviderCredentials(apiKey, apiSecret string) (*DNSProvider, error) {
 	}
 
 	return &DNSProvider{
-		apiKey:    apiKey,
-		apiSecret: apiSecret,
-		client:    &http.Client{Timeout: 30 * time.Second},
+		apiKey:             apiKey,
+		apiSecret:          apiSecret,
+		client:             &http.Client{Timeout: 30 * time.Second},
+		propagationTimeout: env.GetOrDefaultSecond("GODADDY_PROPAGATION_TIMEOUT", defaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("GODADDY_POLLING_INTERVAL", defaultPollingInterval),
 	}, nil
 }
 
 // Timeout returns the timeout and interval to use when checking for DNS
 // propagation. Adjusting here to cope with spikes in propagation times.
+// GODADDY_PROPAGATION_TIMEOUT and GODADDY_POLLING_INTERVAL override them.
 func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
-	return 120 * time.Second, 2 * time.Second
+	return d.propagationTimeout, d.pollingInterval
 }
 
 func (d *DNSProvider) extractRecordName(fqdn, domain string) string {
@@ -67,7 +90,8 @@ func (d *DNSProvider) extractRecordName(fqdn, domain string) string {
 
 // Present creates a TXT record to fulfil the dns-01 challenge
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 	domainZone, err := d.getZone(fqdn)
 	if err != nil {
 		return err
@@ -113,7 +137,7 @@ func (d *DNSProvider) updateRecords(records []DNSRecord, domainZone string, reco
 
 // CleanUp sets null value in the TXT DNS record as GoDaddy has no proper DELETE record method
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 	domainZone, err := d.getZone(fqdn)
 	if err != nil {
 		return err
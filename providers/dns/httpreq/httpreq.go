@@ -0,0 +1,179 @@
+// Package httpreq implements a DNS provider for solving the DNS-01 challenge
+// by calling an HTTP server which creates and removes the records, so that lego holds no DNS credentials.
+package httpreq
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
+	"github.com/xenolf/lego/platform/config/env"
+)
+
+// Documentation lists the HTTP server creating and removing the records, and how it is called.
+var Documentation = env.Documentation{
+	Name:        "httpreq",
+	Description: "An HTTP server, called to create and remove the TXT records",
+	URL:         "https://github.com/xenolf/lego/blob/master/providers/dns/httpreq/httpreq.go",
+	Required: []env.Var{
+		{Name: "HTTPREQ_ENDPOINT", Description: "The URL of the server, receiving the POST requests on /present and /cleanup"},
+	},
+	Optional: append([]env.Var{
+		{Name: "HTTPREQ_MODE", Description: "RAW to send the domain, the token and the key authorization instead of the FQDN and the value"},
+		{Name: "HTTPREQ_USERNAME", Description: "The user name of the basic authentication"},
+		{Name: "HTTPREQ_PASSWORD", Description: "The password of the basic authentication"},
+		{Name: "HTTPREQ_HTTP_TIMEOUT", Description: "Time limit of a request to the server, in seconds (default 30)"},
+	}, env.PropagationVars("HTTPREQ", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval)...),
+}
+
+type message struct {
+	FQDN  string `json:"fqdn"`
+	Value string `json:"value"`
+}
+
+type messageRaw struct {
+	Domain  string `json:"domain"`
+	Token   string `json:"token"`
+	KeyAuth string `json:"keyAuth"`
+}
+
+// Config is used to configure the creation of the DNSProvider
+type Config struct {
+	Endpoint           *url.URL
+	Mode               string
+	Username           string
+	Password           string
+	PropagationTimeout time.Duration
+	PollingInterval    time.Duration
+	HTTPClient         *http.Client
+}
+
+// NewDefaultConfig returns a default configuration for the DNSProvider
+func NewDefaultConfig() *Config {
+	return &Config{
+		Mode:               os.Getenv("HTTPREQ_MODE"),
+		Username:           os.Getenv("HTTPREQ_USERNAME"),
+		Password:           os.Getenv("HTTPREQ_PASSWORD"),
+		PropagationTimeout: env.GetOrDefaultSecond("HTTPREQ_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		PollingInterval:    env.GetOrDefaultSecond("HTTPREQ_POLLING_INTERVAL", acme.DefaultPollingInterval),
+		HTTPClient: &http.Client{
+			Timeout: env.GetOrDefaultSecond("HTTPREQ_HTTP_TIMEOUT", 30*time.Second),
+		},
+	}
+}
+
+// DNSProvider adds and removes the record for the DNS challenge
+// by sending requests to an HTTP server.
+type DNSProvider struct {
+	config *Config
+}
+
+// NewDNSProvider returns a DNSProvider instance calling the server of the environment variable HTTPREQ_ENDPOINT.
+func NewDNSProvider() (*DNSProvider, error) {
+	values, err := env.Get("HTTPREQ_ENDPOINT")
+	if err != nil {
+		return nil, fmt.Errorf("httpreq: %v", err)
+	}
+
+	endpoint, err := url.Parse(values["HTTPREQ_ENDPOINT"])
+	if err != nil {
+		return nil, fmt.Errorf("httpreq: %v", err)
+	}
+
+	config := NewDefaultConfig()
+	config.Endpoint = endpoint
+
+	return NewDNSProviderConfig(config)
+}
+
+// NewDNSProviderConfig return a DNSProvider instance configured for the HTTP server.
+func NewDNSProviderConfig(config *Config) (*DNSProvider, error) {
+	if config == nil {
+		return nil, errors.New("httpreq: the configuration of the DNS provider is nil")
+	}
+
+	if config.Endpoint == nil {
+		return nil, errors.New("httpreq: the endpoint is missing")
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+
+	return &DNSProvider{config: config}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge.
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	return d.doPost("/present", d.message(domain, token, keyAuth))
+}
+
+// CleanUp removes the TXT record matching the specified parameters.
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	return d.doPost("/cleanup", d.message(domain, token, keyAuth))
+}
+
+// Timeout returns the timeout and interval to use when checking for DNS
+// propagation. Adjusting here to cope with spikes in propagation times.
+// HTTPREQ_PROPAGATION_TIMEOUT and HTTPREQ_POLLING_INTERVAL override them.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.config.PropagationTimeout, d.config.PollingInterval
+}
+
+// message returns the body of the requests, depending on the mode.
+func (d *DNSProvider) message(domain, token, keyAuth string) interface{} {
+	if d.config.Mode == "RAW" {
+		return &messageRaw{Domain: domain, Token: token, KeyAuth: keyAuth}
+	}
+
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	return &message{FQDN: fqdn, Value: value}
+}
+
+func (d *DNSProvider) doPost(uri string, msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("httpreq: %v", err)
+	}
+
+	endpoint := *d.config.Endpoint
+	endpoint.Path = path.Join(endpoint.Path, uri)
+
+	req, err := http.NewRequest(http.MethodPost, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("httpreq: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if len(d.config.Username) > 0 && len(d.config.Password) > 0 {
+		req.SetBasicAuth(d.config.Username, d.config.Password)
+	}
+
+	resp, err := d.config.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpreq: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("httpreq: %d: failed to read the response body: %v", resp.StatusCode, err)
+		}
+
+		return fmt.Errorf("httpreq: %d: request to %s failed: %s", resp.StatusCode, endpoint.String(), strings.TrimSpace(string(respBody)))
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package httpreq
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDNSProvider(t *testing.T) {
+	defer os.Unsetenv("HTTPREQ_ENDPOINT")
+
+	os.Setenv("HTTPREQ_ENDPOINT", "")
+	_, err := NewDNSProvider()
+	assert.Error(t, err)
+
+	os.Setenv("HTTPREQ_ENDPOINT", "http://localhost:8090")
+	provider, err := NewDNSProvider()
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:8090", provider.config.Endpoint.Host)
+}
+
+func TestNewDNSProviderConfig(t *testing.T) {
+	_, err := NewDNSProviderConfig(nil)
+	assert.Error(t, err)
+
+	_, err = NewDNSProviderConfig(&Config{})
+	assert.EqualError(t, err, "httpreq: the endpoint is missing")
+}
+
+func TestDNSProvider(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		mode          string
+		username      string
+		password      string
+		handler       http.HandlerFunc
+		expectedError string
+	}{
+		{
+			desc: "default mode",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				var msg message
+				if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if msg.FQDN != "_acme-challenge.example.com." || msg.Value != "pW9ZKG0xz_PCriK-nCMOjADy9eJcgGWIzkkj2fN4uZM" {
+					http.Error(w, fmt.Sprintf("unexpected record %+v", msg), http.StatusBadRequest)
+				}
+			},
+		},
+		{
+			desc: "raw mode",
+			mode: "RAW",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				var msg messageRaw
+				if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if msg.Domain != "example.com" || msg.Token != "token" || msg.KeyAuth != "keyAuth" {
+					http.Error(w, fmt.Sprintf("unexpected message %+v", msg), http.StatusBadRequest)
+				}
+			},
+		},
+		{
+			desc:     "basic auth",
+			username: "user",
+			password: "secret",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "secret" {
+					http.Error(w, "invalid credentials", http.StatusUnauthorized)
+				}
+			},
+		},
+		{
+			desc: "error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "zone not found", http.StatusNotFound)
+			},
+			expectedError: "httpreq: 404: request to %s failed: zone not found",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/present", test.handler)
+			mux.HandleFunc("/api/cleanup", test.handler)
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			endpoint, err := url.Parse(server.URL + "/api")
+			require.NoError(t, err)
+
+			config := NewDefaultConfig()
+			config.Endpoint = endpoint
+			config.Mode = test.mode
+			config.Username = test.username
+			config.Password = test.password
+
+			provider, err := NewDNSProviderConfig(config)
+			require.NoError(t, err)
+
+			err = provider.Present("example.com", "token", "keyAuth")
+			if test.expectedError != "" {
+				assert.EqualError(t, err, fmt.Sprintf(test.expectedError, server.URL+"/api/present"))
+			} else {
+				assert.NoError(t, err)
+			}
+
+			err = provider.CleanUp("example.com", "token", "keyAuth")
+			if test.expectedError != "" {
+				assert.EqualError(t, err, fmt.Sprintf(test.expectedError, server.URL+"/api/cleanup"))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
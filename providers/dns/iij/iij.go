@@ -8,15 +8,35 @@ import (
 
 	"github.com/iij/doapi"
 	"github.com/iij/doapi/protocol"
-	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+const (
+	defaultPropagationTimeout = 2 * time.Minute
+	defaultPollingInterval    = 4 * time.Second
+)
+
+// Documentation lists the API keys of the IIJ DNS Platform Service and the code of the service.
+var Documentation = env.Documentation{
+	Name:        "iij",
+	Description: "IIJ DNS Platform Service",
+	URL:         "https://manual.iij.jp/p2/pubapi/",
+	Required: []env.Var{
+		{Name: "IIJ_API_ACCESS_KEY", Description: "The API access key"},
+		{Name: "IIJ_API_SECRET_KEY", Description: "The API secret key"},
+		{Name: "IIJ_DO_SERVICE_CODE", Description: "The service code of the DNS Platform Service"},
+	},
+	Optional: env.PropagationVars("IIJ", defaultPropagationTimeout, defaultPollingInterval),
+}
+
 // Config is used to configure the creation of the DNSProvider
 type Config struct {
-	AccessKey     string
-	SecretKey     string
-	DoServiceCode string
+	AccessKey          string
+	SecretKey          string
+	DoServiceCode      string
+	PropagationTimeout time.Duration
+	PollingInterval    time.Duration
 }
 
 // DNSProvider implements the acme.ChallengeProvider interface
@@ -33,35 +53,46 @@ func NewDNSProvider() (*DNSProvider, error) {
 	}
 
 	return NewDNSProviderConfig(&Config{
-		AccessKey:     values["IIJ_API_ACCESS_KEY"],
-		SecretKey:     values["IIJ_API_SECRET_KEY"],
-		DoServiceCode: values["IIJ_DO_SERVICE_CODE"],
+		AccessKey:          values["IIJ_API_ACCESS_KEY"],
+		SecretKey:          values["IIJ_API_SECRET_KEY"],
+		DoServiceCode:      values["IIJ_DO_SERVICE_CODE"],
+		PropagationTimeout: env.GetOrDefaultSecond("IIJ_PROPAGATION_TIMEOUT", defaultPropagationTimeout),
+		PollingInterval:    env.GetOrDefaultSecond("IIJ_POLLING_INTERVAL", defaultPollingInterval),
 	})
 }
 
 // NewDNSProviderConfig takes a given config ans returns a custom configured
-// DNSProvider instance
+// DNSProvider instance.
+// The zero PropagationTimeout and PollingInterval are replaced by the defaults.
 func NewDNSProviderConfig(config *Config) (*DNSProvider, error) {
+	if config.PropagationTimeout == 0 {
+		config.PropagationTimeout = defaultPropagationTimeout
+	}
+	if config.PollingInterval == 0 {
+		config.PollingInterval = defaultPollingInterval
+	}
+
 	return &DNSProvider{
 		api:    doapi.NewAPI(config.AccessKey, config.SecretKey),
 		config: config,
 	}, nil
 }
 
-// Timeout returns the timeout and interval to use when checking for DNS propagation.
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with IIJ_PROPAGATION_TIMEOUT and IIJ_POLLING_INTERVAL.
 func (p *DNSProvider) Timeout() (timeout, interval time.Duration) {
-	return time.Minute * 2, time.Second * 4
+	return p.config.PropagationTimeout, p.config.PollingInterval
 }
 
 // Present creates a TXT record using the specified parameters
 func (p *DNSProvider) Present(domain, token, keyAuth string) error {
-	_, value, _ := acme.DNS01Record(domain, keyAuth)
+	_, value := dns01.GetRecord(domain, keyAuth)
 	return p.addTxtRecord(domain, value)
 }
 
 // CleanUp removes the TXT record matching the specified parameters
 func (p *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	_, value, _ := acme.DNS01Record(domain, keyAuth)
+	_, value := dns01.GetRecord(domain, keyAuth)
 	return p.deleteTxtRecord(domain, value)
 }
 
@@ -13,16 +13,35 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/lightsail"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
+	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the AWS credentials and the Lightsail zone of the records.
+var Documentation = env.Documentation{
+	Name:        "lightsail",
+	Description: "Amazon Lightsail DNS",
+	URL:         "https://docs.aws.amazon.com/lightsail/2016-11-28/api-reference/",
+	Required: []env.Var{
+		{Name: "AWS_ACCESS_KEY_ID", Description: "The access key ID, unless set in the shared credentials file or by an instance role"},
+		{Name: "AWS_SECRET_ACCESS_KEY", Description: "The secret access key, unless set in the shared credentials file or by an instance role"},
+	},
+	Optional: append([]env.Var{
+		{Name: "AWS_SESSION_TOKEN", Description: "The session token of temporary credentials"},
+		{Name: "DNS_ZONE", Description: "The domain managed by Lightsail"},
+	}, env.PropagationVars("LIGHTSAIL", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval)...),
+}
+
 const (
 	maxRetries = 5
 )
 
 // DNSProvider implements the acme.ChallengeProvider interface
 type DNSProvider struct {
-	client  *lightsail.Lightsail
-	dnsZone string
+	client             *lightsail.Lightsail
+	dnsZone            string
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // customRetryer implements the client.Retryer interface by composing the
@@ -71,14 +90,22 @@ func NewDNSProvider() (*DNSProvider, error) {
 	}
 
 	return &DNSProvider{
-		dnsZone: os.Getenv("DNS_ZONE"),
-		client:  lightsail.New(sess),
+		dnsZone:            os.Getenv("DNS_ZONE"),
+		client:             lightsail.New(sess),
+		propagationTimeout: env.GetOrDefaultSecond("LIGHTSAIL_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("LIGHTSAIL_POLLING_INTERVAL", acme.DefaultPollingInterval),
 	}, nil
 }
 
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with LIGHTSAIL_PROPAGATION_TIMEOUT and LIGHTSAIL_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
+}
+
 // Present creates a TXT record using the specified parameters
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
 	value = `"` + value + `"`
 
 	err := d.newTxtRecord(domain, fqdn, value)
@@ -87,7 +114,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
 	value = `"` + value + `"`
 	params := &lightsail.DeleteDomainEntryInput{
 		DomainName: aws.String(d.dnsZone),
@@ -10,13 +10,30 @@ import (
 
 	"github.com/timewasted/linode/dns"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the API key of Linode.
+var Documentation = env.Documentation{
+	Name:        "linode",
+	Description: "Linode DNS Manager",
+	URL:         "https://www.linode.com/api/dns",
+	Required: []env.Var{
+		{Name: "LINODE_API_KEY", Description: "The API key"},
+	},
+	Optional: []env.Var{
+		{Name: "LINODE_PROPAGATION_TIMEOUT", Description: "Maximum waiting time for the DNS propagation, in seconds (default: until the next zone update, up to 22 minutes)"},
+		{Name: "LINODE_POLLING_INTERVAL", Description: "Time between the DNS propagation checks, in seconds (default 15)"},
+	},
+}
+
 const (
 	dnsMinTTLSecs      = 300
 	dnsUpdateFreqMins  = 15
 	dnsUpdateFudgeSecs = 120
+
+	defaultPollingInterval = 15 * time.Second
 )
 
 type hostedZoneInfo struct {
@@ -27,6 +44,10 @@ type hostedZoneInfo struct {
 // DNSProvider implements the acme.ChallengeProvider interface.
 type DNSProvider struct {
 	client *dns.DNS
+	// propagationTimeout is the timeout set with LINODE_PROPAGATION_TIMEOUT,
+	// zero to wait for the next update of the zone files.
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for Linode.
@@ -48,13 +69,20 @@ func NewDNSProviderCredentials(apiKey string) (*DNSProvider, error) {
 	}
 
 	return &DNSProvider{
-		client: dns.New(apiKey),
+		client:             dns.New(apiKey),
+		propagationTimeout: env.GetOrDefaultSecond("LINODE_PROPAGATION_TIMEOUT", 0),
+		pollingInterval:    env.GetOrDefaultSecond("LINODE_POLLING_INTERVAL", defaultPollingInterval),
 	}, nil
 }
 
 // Timeout returns the timeout and interval to use when checking for DNS
-// propagation.  Adjusting here to cope with spikes in propagation times.
+// propagation, set with LINODE_PROPAGATION_TIMEOUT and LINODE_POLLING_INTERVAL.
+// By default, the timeout is adjusted to cope with the updates of the zone files.
 func (p *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	if p.propagationTimeout > 0 {
+		return p.propagationTimeout, p.pollingInterval
+	}
+
 	// Since Linode only updates their zone files every X minutes, we need
 	// to figure out how many minutes we have to wait until we hit the next
 	// interval of X.  We then wait another couple of minutes, just to be
@@ -65,13 +93,13 @@ func (p *DNSProvider) Timeout() (timeout, interval time.Duration) {
 	timeout = (time.Duration(minsRemaining) * time.Minute) +
 		(dnsMinTTLSecs * time.Second) +
 		(dnsUpdateFudgeSecs * time.Second)
-	interval = 15 * time.Second
+	interval = p.pollingInterval
 	return
 }
 
 // Present creates a TXT record using the specified parameters.
 func (p *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
 	zone, err := p.getHostedZoneInfo(fqdn)
 	if err != nil {
 		return err
@@ -86,7 +114,7 @@ func (p *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters.
 func (p *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
 	zone, err := p.getHostedZoneInfo(fqdn)
 	if err != nil {
 		return err
@@ -12,10 +12,28 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/log"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+const (
+	defaultPropagationTimeout = 60 * time.Minute
+	defaultPollingInterval    = 15 * time.Second
+)
+
+// Documentation lists the API user and key of Namecheap.
+var Documentation = env.Documentation{
+	Name:        "namecheap",
+	Description: "Namecheap",
+	URL:         "https://www.namecheap.com/support/api/methods.aspx",
+	Required: []env.Var{
+		{Name: "NAMECHEAP_API_USER", Description: "The API user"},
+		{Name: "NAMECHEAP_API_KEY", Description: "The API key"},
+	},
+	Optional: env.PropagationVars("NAMECHEAP", defaultPropagationTimeout, defaultPollingInterval),
+}
+
 // Notes about namecheap's tool API:
 // 1. Using the API requires registration. Once registered, use your account
 //    name and API key to access the API.
@@ -38,11 +56,13 @@ var (
 // DNSProvider is an implementation of the ChallengeProviderTimeout interface
 // that uses Namecheap's tool API to manage TXT records for a domain.
 type DNSProvider struct {
-	baseURL  string
-	apiUser  string
-	apiKey   string
-	clientIP string
-	client   *http.Client
+	baseURL            string
+	apiUser            string
+	apiKey             string
+	clientIP           string
+	client             *http.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for namecheap.
@@ -72,19 +92,22 @@ func NewDNSProviderCredentials(apiUser, apiKey string) (*DNSProvider, error) {
 	}
 
 	return &DNSProvider{
-		baseURL:  defaultBaseURL,
-		apiUser:  apiUser,
-		apiKey:   apiKey,
-		clientIP: clientIP,
-		client:   client,
+		baseURL:            defaultBaseURL,
+		apiUser:            apiUser,
+		apiKey:             apiKey,
+		clientIP:           clientIP,
+		client:             client,
+		propagationTimeout: env.GetOrDefaultSecond("NAMECHEAP_PROPAGATION_TIMEOUT", defaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("NAMECHEAP_POLLING_INTERVAL", defaultPollingInterval),
 	}, nil
 }
 
 // Timeout returns the timeout and interval to use when checking for DNS
 // propagation. Namecheap can sometimes take a long time to complete an
-// update, so wait up to 60 minutes for the update to propagate.
+// update, so wait up to 60 minutes for the update to propagate,
+// unless set otherwise with NAMECHEAP_PROPAGATION_TIMEOUT and NAMECHEAP_POLLING_INTERVAL.
 func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
-	return 60 * time.Minute, 15 * time.Second
+	return d.propagationTimeout, d.pollingInterval
 }
 
 // host describes a DNS record returned by the Namecheap DNS gethosts API.
@@ -119,7 +142,7 @@ func getClientIP(client *http.Client) (addr string, err error) {
 	}
 
 	if debug {
-		log.Println("Client IP:", string(clientIP))
+		log.Debugf("Client IP: %s", clientIP)
 	}
 	return string(clientIP), nil
 }
@@ -162,7 +185,7 @@ func newChallenge(domain, keyAuth string, tlds map[string]string) (*challenge, e
 		host = strings.Join(parts[:longest-1], ".")
 	}
 
-	key, keyValue, _ := acme.DNS01Record(domain, keyAuth)
+	key, keyValue := dns01.GetRecord(domain, keyAuth)
 
 	return &challenge{
 		domain:   domain,
@@ -389,8 +412,8 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 	if debug {
 		for _, h := range hosts {
-			log.Printf(
-				"%-5.5s %-30.30s %-6s %-70.70s\n",
+			log.Debugf(
+				"%-5.5s %-30.30s %-6s %-70.70s",
 				h.Type, h.Name, h.TTL, h.Address)
 		}
 	}
@@ -6,15 +6,33 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/namedotcom/go/namecom"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the username and API token of Name.com, and its API server.
+var Documentation = env.Documentation{
+	Name:        "namedotcom",
+	Description: "Name.com",
+	URL:         "https://www.name.com/api-docs/DNS",
+	Required: []env.Var{
+		{Name: "NAMECOM_USERNAME", Description: "The user name of the account"},
+		{Name: "NAMECOM_API_TOKEN", Description: "The API token"},
+	},
+	Optional: append([]env.Var{
+		{Name: "NAMECOM_SERVER", Description: "The host of the API, e.g. the one of the test environment (default api.name.com)"},
+	}, env.PropagationVars("NAMECOM", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval)...),
+}
+
 // DNSProvider is an implementation of the acme.ChallengeProvider interface.
 type DNSProvider struct {
-	client *namecom.NameCom
+	client             *namecom.NameCom
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for namedotcom.
@@ -45,12 +63,23 @@ func NewDNSProviderCredentials(username, apiToken, server string) (*DNSProvider,
 		client.Server = server
 	}
 
-	return &DNSProvider{client: client}, nil
+	return &DNSProvider{
+		client:             client,
+		propagationTimeout: env.GetOrDefaultSecond("NAMECOM_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("NAMECOM_POLLING_INTERVAL", acme.DefaultPollingInterval),
+	}, nil
+}
+
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with NAMECOM_PROPAGATION_TIMEOUT and NAMECOM_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
 }
 
 // Present creates a TXT record to fulfil the dns-01 challenge.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 
 	request := &namecom.Record{
 		DomainName: domain,
@@ -70,7 +99,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters.
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	records, err := d.getRecords(domain)
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 )
 
 func TestClientAuth(t *testing.T) {
@@ -51,7 +52,7 @@ func TestClientGetDnsRecords(t *testing.T) {
 	sessionID, err := client.Login()
 	assert.NoError(t, err)
 
-	fqdn, _, _ := acme.DNS01Record(testDomain, "123d==")
+	fqdn, _ := dns01.GetRecord(testDomain, "123d==")
 
 	zone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	assert.NoError(t, err, "error finding DNSZone")
@@ -81,7 +82,7 @@ func TestClientUpdateDnsRecord(t *testing.T) {
 	sessionID, err := client.Login()
 	assert.NoError(t, err)
 
-	fqdn, _, _ := acme.DNS01Record(testDomain, "123d==")
+	fqdn, _ := dns01.GetRecord(testDomain, "123d==")
 
 	zone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	assert.NoError(t, err, fmt.Errorf("error finding DNSZone, %v", err))
@@ -8,12 +8,28 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the customer number and the API credentials of Netcup.
+var Documentation = env.Documentation{
+	Name:        "netcup",
+	Description: "Netcup",
+	URL:         "https://www.netcup-wiki.de/wiki/CCP_API",
+	Required: []env.Var{
+		{Name: "NETCUP_CUSTOMER_NUMBER", Description: "The customer number"},
+		{Name: "NETCUP_API_KEY", Description: "The API key"},
+		{Name: "NETCUP_API_PASSWORD", Description: "The API password"},
+	},
+	Optional: env.PropagationVars("NETCUP", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval),
+}
+
 // DNSProvider is an implementation of the acme.ChallengeProvider interface
 type DNSProvider struct {
-	client *Client
+	client             *Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for netcup.
@@ -40,13 +56,21 @@ func NewDNSProviderCredentials(customer, key, password string) (*DNSProvider, er
 	}
 
 	return &DNSProvider{
-		client: NewClient(httpClient, customer, key, password),
+		client:             NewClient(httpClient, customer, key, password),
+		propagationTimeout: env.GetOrDefaultSecond("NETCUP_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("NETCUP_POLLING_INTERVAL", acme.DefaultPollingInterval),
 	}, nil
 }
 
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with NETCUP_PROPAGATION_TIMEOUT and NETCUP_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
+}
+
 // Present creates a TXT record to fulfill the dns-01 challenge
 func (d *DNSProvider) Present(domainName, token, keyAuth string) error {
-	fqdn, value, _ := acme.DNS01Record(domainName, keyAuth)
+	fqdn, value := dns01.GetRecord(domainName, keyAuth)
 
 	zone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	if err != nil {
@@ -74,7 +98,7 @@ func (d *DNSProvider) Present(domainName, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters
 func (d *DNSProvider) CleanUp(domainname, token, keyAuth string) error {
-	fqdn, value, _ := acme.DNS01Record(domainname, keyAuth)
+	fqdn, value := dns01.GetRecord(domainname, keyAuth)
 
 	zone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	if err != nil {
@@ -7,6 +7,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 )
 
 var (
@@ -36,7 +37,7 @@ func TestDNSProviderPresentAndCleanup(t *testing.T) {
 	p, err := NewDNSProvider()
 	assert.NoError(t, err)
 
-	fqdn, _, _ := acme.DNS01Record(testDomain, "123d==")
+	fqdn, _ := dns01.GetRecord(testDomain, "123d==")
 
 	zone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	assert.NoError(t, err, "error finding DNSZone")
@@ -3,18 +3,37 @@
 package nifcloud
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
+	"github.com/xenolf/lego/platform/wait"
 )
 
+// Documentation lists the access keys of NIFCLOUD and the endpoint of its DNS API.
+var Documentation = env.Documentation{
+	Name:        "nifcloud",
+	Description: "NIFCLOUD DNS",
+	URL:         "https://mbaas.nifcloud.com/doc/current/rest/common/format.html",
+	Required: []env.Var{
+		{Name: "NIFCLOUD_ACCESS_KEY_ID", Description: "The access key"},
+		{Name: "NIFCLOUD_SECRET_ACCESS_KEY", Description: "The secret access key"},
+	},
+	Optional: append([]env.Var{
+		{Name: "NIFCLOUD_DNS_ENDPOINT", Description: "The URL of the API (default https://dns.api.cloud.nifty.com)"},
+	}, env.PropagationVars("NIFCLOUD", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval)...),
+}
+
 // DNSProvider implements the acme.ChallengeProvider interface
 type DNSProvider struct {
-	client *Client
+	client             *Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for the NIFCLOUD DNS service.
@@ -41,19 +60,29 @@ func NewDNSProviderCredentials(httpClient *http.Client, endpoint, accessKey, sec
 	client := newClient(httpClient, accessKey, secretKey, endpoint)
 
 	return &DNSProvider{
-		client: client,
+		client:             client,
+		propagationTimeout: env.GetOrDefaultSecond("NIFCLOUD_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("NIFCLOUD_POLLING_INTERVAL", acme.DefaultPollingInterval),
 	}, nil
 }
 
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with NIFCLOUD_PROPAGATION_TIMEOUT and NIFCLOUD_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
+}
+
 // Present creates a TXT record using the specified parameters
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 	return d.changeRecord("CREATE", fqdn, value, domain, ttl)
 }
 
 // CleanUp removes the TXT record matching the specified parameters
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 	return d.changeRecord("DELETE", fqdn, value, domain, ttl)
 }
 
@@ -93,7 +122,7 @@ func (d *DNSProvider) changeRecord(action, fqdn, value, domain string, ttl int)
 
 	statusID := resp.ChangeInfo.ID
 
-	return acme.WaitFor(120*time.Second, 4*time.Second, func() (bool, error) {
+	return wait.For(context.Background(), 120*time.Second, 4*time.Second, func() (bool, error) {
 		resp, err := d.client.GetChange(statusID)
 		if err != nil {
 			return false, fmt.Errorf("failed to query NIFCLOUD DNS change status: %v", err)
@@ -9,14 +9,28 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 	"gopkg.in/ns1/ns1-go.v2/rest"
 	"gopkg.in/ns1/ns1-go.v2/rest/model/dns"
 )
 
+// Documentation lists the API key of NS1.
+var Documentation = env.Documentation{
+	Name:        "ns1",
+	Description: "NS1",
+	URL:         "https://ns1.com/api",
+	Required: []env.Var{
+		{Name: "NS1_API_KEY", Description: "The API key"},
+	},
+	Optional: env.PropagationVars("NS1", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval),
+}
+
 // DNSProvider is an implementation of the acme.ChallengeProvider interface.
 type DNSProvider struct {
-	client *rest.Client
+	client             *rest.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for NS1.
@@ -40,12 +54,23 @@ func NewDNSProviderCredentials(key string) (*DNSProvider, error) {
 	httpClient := &http.Client{Timeout: time.Second * 10}
 	client := rest.NewClient(httpClient, rest.SetAPIKey(key))
 
-	return &DNSProvider{client}, nil
+	return &DNSProvider{
+		client:             client,
+		propagationTimeout: env.GetOrDefaultSecond("NS1_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("NS1_POLLING_INTERVAL", acme.DefaultPollingInterval),
+	}, nil
+}
+
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with NS1_PROPAGATION_TIMEOUT and NS1_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
 }
 
 // Present creates a TXT record to fulfil the dns-01 challenge.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 
 	zone, err := d.getHostedZone(domain)
 	if err != nil {
@@ -63,7 +88,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters.
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	zone, err := d.getHostedZone(domain)
 	if err != nil {
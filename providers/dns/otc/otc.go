@@ -13,19 +13,38 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the user and project of the Open Telekom Cloud, and its identity endpoint.
+var Documentation = env.Documentation{
+	Name:        "otc",
+	Description: "Open Telekom Cloud DNS",
+	URL:         "https://docs.otc.t-systems.com/en-us/dns/index.html",
+	Required: []env.Var{
+		{Name: "OTC_DOMAIN_NAME", Description: "The domain name of the account"},
+		{Name: "OTC_USER_NAME", Description: "The user name"},
+		{Name: "OTC_PASSWORD", Description: "The password of the user"},
+		{Name: "OTC_PROJECT_NAME", Description: "The project of the DNS zones"},
+	},
+	Optional: append([]env.Var{
+		{Name: "OTC_IDENTITY_ENDPOINT", Description: "The URL of the identity service (default https://iam.eu-de.otc.t-systems.com:443/v3/auth/tokens)"},
+	}, env.PropagationVars("OTC", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval)...),
+}
+
 // DNSProvider is an implementation of the acme.ChallengeProvider interface that uses
 // OTC's Managed DNS API to manage TXT records for a domain.
 type DNSProvider struct {
-	identityEndpoint string
-	otcBaseURL       string
-	domainName       string
-	projectName      string
-	userName         string
-	password         string
-	token            string
+	identityEndpoint   string
+	otcBaseURL         string
+	domainName         string
+	projectName        string
+	userName           string
+	password           string
+	token              string
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for OTC DNS.
@@ -58,14 +77,22 @@ func NewDNSProviderCredentials(domainName, userName, password, projectName, iden
 	}
 
 	return &DNSProvider{
-		identityEndpoint: identityEndpoint,
-		domainName:       domainName,
-		userName:         userName,
-		password:         password,
-		projectName:      projectName,
+		identityEndpoint:   identityEndpoint,
+		domainName:         domainName,
+		userName:           userName,
+		password:           password,
+		projectName:        projectName,
+		propagationTimeout: env.GetOrDefaultSecond("OTC_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("OTC_POLLING_INTERVAL", acme.DefaultPollingInterval),
 	}, nil
 }
 
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with OTC_PROPAGATION_TIMEOUT and OTC_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
+}
+
 // SendRequest send request
 func (d *DNSProvider) SendRequest(method, resource string, payload interface{}) (io.Reader, error) {
 	url := fmt.Sprintf("%s/%s", d.otcBaseURL, resource)
@@ -313,7 +340,8 @@ func (d *DNSProvider) deleteRecordSet(zoneID, recordID string) error {
 
 // Present creates a TXT record using the specified parameters
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 
 	if ttl < 300 {
 		ttl = 300 // 300 is otc minimum value for ttl
@@ -357,7 +385,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	authZone, err := acme.FindZoneByFqdn(fqdn, acme.RecursiveNameservers)
 	if err != nil {
@@ -6,21 +6,39 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ovh/go-ovh/ovh"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the endpoint of the OVH API and the keys of the application.
+var Documentation = env.Documentation{
+	Name:        "ovh",
+	Description: "OVH",
+	URL:         "https://eu.api.ovh.com/",
+	Required: []env.Var{
+		{Name: "OVH_ENDPOINT", Description: "The API endpoint, ovh-eu or ovh-ca"},
+		{Name: "OVH_APPLICATION_KEY", Description: "The application key"},
+		{Name: "OVH_APPLICATION_SECRET", Description: "The application secret"},
+		{Name: "OVH_CONSUMER_KEY", Description: "The consumer key, created with https://eu.api.ovh.com/createToken/"},
+	},
+	Optional: env.PropagationVars("OVH", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval),
+}
+
 // OVH API reference:       https://eu.api.ovh.com/
 // Create a Token:					https://eu.api.ovh.com/createToken/
 
 // DNSProvider is an implementation of the acme.ChallengeProvider interface
 // that uses OVH's REST API to manage TXT records for a domain.
 type DNSProvider struct {
-	client      *ovh.Client
-	recordIDs   map[string]int
-	recordIDsMu sync.Mutex
+	client             *ovh.Client
+	recordIDs          map[string]int
+	recordIDsMu        sync.Mutex
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for OVH
@@ -62,14 +80,23 @@ func NewDNSProviderCredentials(apiEndpoint, applicationKey, applicationSecret, c
 	}
 
 	return &DNSProvider{
-		client:    ovhClient,
-		recordIDs: make(map[string]int),
+		client:             ovhClient,
+		recordIDs:          make(map[string]int),
+		propagationTimeout: env.GetOrDefaultSecond("OVH_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("OVH_POLLING_INTERVAL", acme.DefaultPollingInterval),
 	}, nil
 }
 
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with OVH_PROPAGATION_TIMEOUT and OVH_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
+}
+
 // Present creates a TXT record to fulfil the dns-01 challenge.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 
 	// Parse domain name
 	authZone, err := acme.FindZoneByFqdn(acme.ToFqdn(domain), acme.RecursiveNameservers)
@@ -106,7 +133,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	// get the record's unique ID from when we created it
 	d.recordIDsMu.Lock()
@@ -138,6 +165,64 @@ func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
 	return nil
 }
 
+// ListChallengeRecords returns the _acme-challenge TXT records of the zone of domain.
+// OVH does not tell the creation time of the records.
+func (d *DNSProvider) ListChallengeRecords(domain string) ([]acme.ChallengeRecord, error) {
+	authZone, err := acme.FindZoneByFqdn(acme.ToFqdn(domain), acme.RecursiveNameservers)
+	if err != nil {
+		return nil, fmt.Errorf("could not determine zone for domain: '%s'. %s", domain, err)
+	}
+
+	authZone = acme.UnFqdn(authZone)
+
+	var recordIDs []int
+	err = d.client.Get(fmt.Sprintf("/domain/zone/%s/record?fieldType=TXT", authZone), &recordIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error when call OVH api to list records: %v", err)
+	}
+
+	var records []acme.ChallengeRecord
+	for _, recordID := range recordIDs {
+		var record txtRecordResponse
+		err = d.client.Get(fmt.Sprintf("/domain/zone/%s/record/%d", authZone, recordID), &record)
+		if err != nil {
+			return nil, fmt.Errorf("error when call OVH api to get record %d: %v", recordID, err)
+		}
+
+		if record.SubDomain != "_acme-challenge" && !strings.HasPrefix(record.SubDomain, "_acme-challenge.") {
+			continue
+		}
+
+		records = append(records, acme.ChallengeRecord{
+			FQDN:  acme.ToFqdn(record.SubDomain + "." + authZone),
+			Value: strings.Trim(record.Target, `"`),
+			ID:    fmt.Sprintf("%s/%d", authZone, recordID),
+		})
+	}
+
+	return records, nil
+}
+
+// DeleteChallengeRecord deletes a record returned by ListChallengeRecords.
+func (d *DNSProvider) DeleteChallengeRecord(record acme.ChallengeRecord) error {
+	i := strings.LastIndex(record.ID, "/")
+	if i < 0 {
+		return fmt.Errorf("invalid record ID '%s'", record.ID)
+	}
+	authZone := record.ID[:i]
+
+	err := d.client.Delete(fmt.Sprintf("/domain/zone/%s/record/%s", authZone, record.ID[i+1:]), nil)
+	if err != nil {
+		return fmt.Errorf("error when call OVH api to delete challenge record: %v", err)
+	}
+
+	err = d.client.Post(fmt.Sprintf("/domain/zone/%s/refresh", authZone), nil, nil)
+	if err != nil {
+		return fmt.Errorf("error when call OVH api to refresh zone: %v", err)
+	}
+	return nil
+}
+
 func (d *DNSProvider) extractRecordName(fqdn, domain string) string {
 	name := acme.UnFqdn(fqdn)
 	if idx := strings.Index(name, "."+domain); idx != -1 {
@@ -1,11 +1,18 @@
 package ovh
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/internal/challengetest"
 )
 
 var (
@@ -117,6 +124,68 @@ func TestNewDNSProviderMissingCredErr(t *testing.T) {
 	}
 }
 
+func TestListChallengeRecords(t *testing.T) {
+	records := map[int]txtRecordResponse{
+		1: {ID: 1, FieldType: "TXT", SubDomain: "_acme-challenge", Target: `"apex"`, TTL: 120, Zone: "example.com"},
+		2: {ID: 2, FieldType: "TXT", SubDomain: "_acme-challenge.www", Target: "www", TTL: 120, Zone: "example.com"},
+		3: {ID: 3, FieldType: "TXT", SubDomain: "", Target: "v=spf1 -all", TTL: 3600, Zone: "example.com"},
+	}
+
+	var deleted []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/time", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, time.Now().Unix())
+	})
+	mux.HandleFunc("/domain/zone/example.com/record", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "TXT", r.URL.Query().Get("fieldType"))
+		json.NewEncoder(w).Encode([]int{1, 2, 3})
+	})
+	mux.HandleFunc("/domain/zone/example.com/record/", func(w http.ResponseWriter, r *http.Request) {
+		var id int
+		fmt.Sscanf(r.URL.Path, "/domain/zone/example.com/record/%d", &id)
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(records[id])
+		case http.MethodDelete:
+			deleted = append(deleted, r.URL.Path)
+			fmt.Fprint(w, "null")
+		}
+	})
+	mux.HandleFunc("/domain/zone/example.com/refresh", func(w http.ResponseWriter, r *http.Request) {
+		deleted = append(deleted, r.URL.Path)
+		fmt.Fprint(w, "null")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// the zone is found by the nameserver of example.com.
+	nameserver := challengetest.NewDNSServer(t, "example.com.")
+	defer nameserver.Close()
+
+	acme.ClearFqdnCache()
+	defer acme.ClearFqdnCache()
+
+	savedNameservers := acme.RecursiveNameservers
+	defer func() { acme.RecursiveNameservers = savedNameservers }()
+	acme.RecursiveNameservers = []string{nameserver.Addr()}
+
+	provider, err := NewDNSProviderCredentials(server.URL, "1234", "5678", "abcde")
+	require.NoError(t, err)
+
+	listed, err := provider.ListChallengeRecords("www.example.com")
+	require.NoError(t, err)
+
+	expected := []acme.ChallengeRecord{
+		{FQDN: "_acme-challenge.example.com.", Value: "apex", ID: "example.com/1"},
+		{FQDN: "_acme-challenge.www.example.com.", Value: "www", ID: "example.com/2"},
+	}
+	assert.Equal(t, expected, listed)
+
+	err = provider.DeleteChallengeRecord(listed[1])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/domain/zone/example.com/record/2", "/domain/zone/example.com/refresh"}, deleted)
+}
+
 func TestLivePresent(t *testing.T) {
 	if !liveTest {
 		t.Skip("skipping live test")
@@ -14,16 +14,36 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/log"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+const (
+	defaultPropagationTimeout = 120 * time.Second
+	defaultPollingInterval    = 2 * time.Second
+)
+
+// Documentation lists the URL and the API key of the PowerDNS server.
+var Documentation = env.Documentation{
+	Name:        "pdns",
+	Description: "PowerDNS",
+	URL:         "https://doc.powerdns.com/md/httpapi/README/",
+	Required: []env.Var{
+		{Name: "PDNS_API_KEY", Description: "The API key"},
+		{Name: "PDNS_API_URL", Description: "The URL of the API, e.g. http://pdns.example.com:8081"},
+	},
+	Optional: env.PropagationVars("PDNS", defaultPropagationTimeout, defaultPollingInterval),
+}
+
 // DNSProvider is an implementation of the acme.ChallengeProvider interface
 type DNSProvider struct {
-	apiKey     string
-	host       *url.URL
-	apiVersion int
-	client     *http.Client
+	apiKey             string
+	host               *url.URL
+	apiVersion         int
+	client             *http.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for pdns.
@@ -55,14 +75,17 @@ func NewDNSProviderCredentials(host *url.URL, key string) (*DNSProvider, error)
 	}
 
 	d := &DNSProvider{
-		host:   host,
-		apiKey: key,
-		client: &http.Client{Timeout: 30 * time.Second},
+		host:               host,
+		apiKey:             key,
+		client:             &http.Client{Timeout: 30 * time.Second},
+		propagationTimeout: env.GetOrDefaultSecond("PDNS_PROPAGATION_TIMEOUT", defaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("PDNS_POLLING_INTERVAL", defaultPollingInterval),
 	}
 
 	apiVersion, err := d.getAPIVersion()
 	if err != nil {
-		log.Warnf("PDNS: failed to get API version %v", err)
+		// the API key is not logged if the server returns it in its error.
+		log.Warnf("PDNS: failed to get API version %s", strings.Replace(err.Error(), key, "<redacted>", -1))
 	}
 	d.apiVersion = apiVersion
 
@@ -71,13 +94,14 @@ func NewDNSProviderCredentials(host *url.URL, key string) (*DNSProvider, error)
 
 // Timeout returns the timeout and interval to use when checking for DNS
 // propagation. Adjusting here to cope with spikes in propagation times.
+// PDNS_PROPAGATION_TIMEOUT and PDNS_POLLING_INTERVAL override them.
 func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
-	return 120 * time.Second, 2 * time.Second
+	return d.propagationTimeout, d.pollingInterval
 }
 
 // Present creates a TXT record to fulfil the dns-01 challenge
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
 	zone, err := d.getHostedZone(fqdn)
 	if err != nil {
 		return err
@@ -124,7 +148,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	zone, err := d.getHostedZone(fqdn)
 	if err != nil {
@@ -1,11 +1,14 @@
 package pdns
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/xenolf/lego/internal/challengetest"
 )
 
 var (
@@ -82,3 +85,21 @@ func TestPdnsPresentAndCleanup(t *testing.T) {
 	err = provider.CleanUp(pdnsDomain, "", "123d==")
 	assert.NoError(t, err)
 }
+
+func TestNewDNSProviderNoSecretLogged(t *testing.T) {
+	logs := challengetest.RecordLogs()
+	defer logs.Stop()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"error":"invalid API key ` + r.Header.Get("X-API-Key") + `"}`))
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	_, err := NewDNSProviderCredentials(serverURL, "secret-api-key")
+	assert.NoError(t, err)
+
+	logs.AssertNoSecrets(t, "secret-api-key")
+	assert.Equal(t, []string{"warn: PDNS: failed to get API version error talking to PDNS API -> invalid API key <redacted>"}, logs.Entries())
+}
@@ -11,18 +11,33 @@ import (
 	"time"
 
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the user and API key of Rackspace.
+var Documentation = env.Documentation{
+	Name:        "rackspace",
+	Description: "Rackspace Cloud DNS",
+	URL:         "https://developer.rackspace.com/docs/cloud-dns/v1/",
+	Required: []env.Var{
+		{Name: "RACKSPACE_USER", Description: "The user name"},
+		{Name: "RACKSPACE_API_KEY", Description: "The API key"},
+	},
+	Optional: env.PropagationVars("RACKSPACE", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval),
+}
+
 // rackspaceAPIURL represents the Identity API endpoint to call
 var rackspaceAPIURL = "https://identity.api.rackspacecloud.com/v2.0/tokens"
 
 // DNSProvider is an implementation of the acme.ChallengeProvider interface
 // used to store the reusable token and DNS API endpoint
 type DNSProvider struct {
-	token            string
-	cloudDNSEndpoint string
-	client           *http.Client
+	token              string
+	cloudDNSEndpoint   string
+	client             *http.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for Rackspace.
@@ -95,15 +110,23 @@ func NewDNSProviderCredentials(user, key string) (*DNSProvider, error) {
 	}
 
 	return &DNSProvider{
-		token:            rackspaceIdentity.Access.Token.ID,
-		cloudDNSEndpoint: dnsEndpoint,
-		client:           client,
+		token:              rackspaceIdentity.Access.Token.ID,
+		cloudDNSEndpoint:   dnsEndpoint,
+		client:             client,
+		propagationTimeout: env.GetOrDefaultSecond("RACKSPACE_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("RACKSPACE_POLLING_INTERVAL", acme.DefaultPollingInterval),
 	}, nil
 }
 
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with RACKSPACE_PROPAGATION_TIMEOUT and RACKSPACE_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
+}
+
 // Present creates a TXT record to fulfil the dns-01 challenge
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
 	zoneID, err := d.getHostedZoneID(fqdn)
 	if err != nil {
 		return err
@@ -129,7 +152,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 	zoneID, err := d.getHostedZoneID(fqdn)
 	if err != nil {
 		return err
@@ -11,16 +11,37 @@ import (
 
 	"github.com/miekg/dns"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
+	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the name server receiving the updates and their TSIG key.
+var Documentation = env.Documentation{
+	Name:        "rfc2136",
+	Description: "A name server supporting RFC 2136 dynamic updates",
+	URL:         "https://tools.ietf.org/html/rfc2136",
+	Required: []env.Var{
+		{Name: "RFC2136_NAMESERVER", Description: "The name server, as host or host:port"},
+	},
+	Optional: []env.Var{
+		{Name: "RFC2136_TSIG_KEY", Description: "The name of the TSIG key"},
+		{Name: "RFC2136_TSIG_SECRET", Description: "The secret of the TSIG key"},
+		{Name: "RFC2136_TSIG_ALGORITHM", Description: "The algorithm of the TSIG key (default hmac-md5.sig-alg.reg.int.)"},
+		{Name: "RFC2136_TIMEOUT", Description: "The DNS propagation timeout, e.g. 90s (default 60s)"},
+		{Name: "RFC2136_PROPAGATION_TIMEOUT", Description: "Maximum waiting time for the DNS propagation, in seconds, overriding RFC2136_TIMEOUT"},
+		{Name: "RFC2136_POLLING_INTERVAL", Description: "Time between the DNS propagation checks, in seconds (default 2)"},
+	},
+}
+
 // DNSProvider is an implementation of the acme.ChallengeProvider interface that
 // uses dynamic DNS updates (RFC 2136) to create TXT records on a nameserver.
 type DNSProvider struct {
-	nameserver    string
-	tsigAlgorithm string
-	tsigKey       string
-	tsigSecret    string
-	timeout       time.Duration
+	nameserver      string
+	tsigAlgorithm   string
+	tsigKey         string
+	tsigSecret      string
+	timeout         time.Duration
+	pollingInterval time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for rfc2136
@@ -31,6 +52,7 @@ type DNSProvider struct {
 // RFC2136_TSIG_KEY: Name of the secret key as defined in DNS server configuration.
 // RFC2136_TSIG_SECRET: Secret key payload.
 // RFC2136_TIMEOUT: DNS propagation timeout in time.ParseDuration format. (60s)
+// RFC2136_PROPAGATION_TIMEOUT and RFC2136_POLLING_INTERVAL: DNS propagation timeout and polling interval in seconds.
 // To disable TSIG authentication, leave the RFC2136_TSIG* variables unset.
 func NewDNSProvider() (*DNSProvider, error) {
 	nameserver := os.Getenv("RFC2136_NAMESERVER")
@@ -39,7 +61,14 @@ func NewDNSProvider() (*DNSProvider, error) {
 	tsigSecret := os.Getenv("RFC2136_TSIG_SECRET")
 	timeout := os.Getenv("RFC2136_TIMEOUT")
 
-	return NewDNSProviderCredentials(nameserver, tsigAlgorithm, tsigKey, tsigSecret, timeout)
+	d, err := NewDNSProviderCredentials(nameserver, tsigAlgorithm, tsigKey, tsigSecret, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	d.timeout = env.GetOrDefaultSecond("RFC2136_PROPAGATION_TIMEOUT", d.timeout)
+	d.pollingInterval = env.GetOrDefaultSecond("RFC2136_POLLING_INTERVAL", d.pollingInterval)
+	return d, nil
 }
 
 // NewDNSProviderCredentials uses the supplied credentials to return a
@@ -60,7 +89,7 @@ func NewDNSProviderCredentials(nameserver, tsigAlgorithm, tsigKey, tsigSecret, t
 		}
 	}
 
-	d := &DNSProvider{nameserver: nameserver}
+	d := &DNSProvider{nameserver: nameserver, pollingInterval: acme.DefaultPollingInterval}
 
 	if tsigAlgorithm == "" {
 		tsigAlgorithm = dns.HmacMD5
@@ -73,7 +102,7 @@ func NewDNSProviderCredentials(nameserver, tsigAlgorithm, tsigKey, tsigSecret, t
 	}
 
 	if timeout == "" {
-		d.timeout = 60 * time.Second
+		d.timeout = acme.DefaultPropagationTimeout
 	} else {
 		t, err := time.ParseDuration(timeout)
 		if err != nil {
@@ -88,20 +117,23 @@ func NewDNSProviderCredentials(nameserver, tsigAlgorithm, tsigKey, tsigSecret, t
 	return d, nil
 }
 
-// Timeout Returns the timeout configured with RFC2136_TIMEOUT, or 60s.
+// Timeout Returns the timeout configured with RFC2136_PROPAGATION_TIMEOUT or RFC2136_TIMEOUT, or 60s,
+// and the interval configured with RFC2136_POLLING_INTERVAL, or 2s.
 func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
-	return d.timeout, 2 * time.Second
+	return d.timeout, d.pollingInterval
 }
 
 // Present creates a TXT record using the specified parameters
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 	return d.changeRecord("INSERT", fqdn, value, ttl)
 }
 
 // CleanUp removes the TXT record matching the specified parameters
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 	return d.changeRecord("REMOVE", fqdn, value, ttl)
 }
 
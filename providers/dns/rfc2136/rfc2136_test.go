@@ -13,6 +13,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
+	"github.com/xenolf/lego/internal/challengetest"
 )
 
 var (
@@ -101,6 +103,28 @@ func TestRFC2136TsigClient(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestRFC2136PresentCleanUp(t *testing.T) {
+	acme.ClearFqdnCache()
+	defer acme.ClearFqdnCache()
+
+	srv := challengetest.NewDNSServer(t, rfc2136TestZone)
+	defer srv.Close()
+
+	provider, err := NewDNSProviderCredentials(srv.Addr(), "", "", "", "")
+	require.NoError(t, err)
+
+	err = provider.Present(rfc2136TestDomain, "", rfc2136TestKeyAuth)
+	require.NoError(t, err)
+
+	_, value := dns01.GetRecord(rfc2136TestDomain, rfc2136TestKeyAuth)
+	assert.Equal(t, []string{value}, srv.TXT(rfc2136TestFqdn))
+
+	err = provider.CleanUp(rfc2136TestDomain, "", rfc2136TestKeyAuth)
+	require.NoError(t, err)
+
+	assert.Empty(t, srv.TXT(rfc2136TestFqdn))
+}
+
 func TestRFC2136ValidUpdatePacket(t *testing.T) {
 	acme.ClearFqdnCache()
 	dns.HandleFunc(rfc2136TestZone, serverHandlerPassBackRequest)
@@ -3,6 +3,7 @@
 package route53
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -16,9 +17,34 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/route53"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
+	"github.com/xenolf/lego/platform/wait"
 )
 
+const (
+	defaultPropagationTimeout = 2 * time.Minute
+	defaultPollingInterval    = 4 * time.Second
+)
+
+// Documentation lists the AWS credentials and the tuning of the Route 53 updates.
+var Documentation = env.Documentation{
+	Name:        "route53",
+	Description: "Amazon Route 53",
+	URL:         "https://docs.aws.amazon.com/Route53/latest/APIReference/",
+	Required: []env.Var{
+		{Name: "AWS_ACCESS_KEY_ID", Description: "The access key ID, unless set in the shared credentials file or by an instance role"},
+		{Name: "AWS_SECRET_ACCESS_KEY", Description: "The secret access key, unless set in the shared credentials file or by an instance role"},
+		{Name: "AWS_REGION", Description: "The region of the API, unless set in the shared configuration file"},
+	},
+	Optional: append([]env.Var{
+		{Name: "AWS_SESSION_TOKEN", Description: "The session token of temporary credentials"},
+		{Name: "AWS_HOSTED_ZONE_ID", Description: "The hosted zone of the records (default: found from the domain)"},
+		{Name: "AWS_MAX_RETRIES", Description: "The number of retries of a request (default 5)"},
+		{Name: "AWS_TTL", Description: "The TTL of the TXT records in seconds (default 10)"},
+	}, env.PropagationVars("AWS", defaultPropagationTimeout, defaultPollingInterval)...),
+}
+
 // Config is used to configure the creation of the DNSProvider
 type Config struct {
 	MaxRetries         int
@@ -30,13 +56,11 @@ type Config struct {
 
 // NewDefaultConfig returns a default configuration for the DNSProvider
 func NewDefaultConfig() *Config {
-	propagationMins := env.GetOrDefaultInt("AWS_PROPAGATION_TIMEOUT", 2)
-	intervalSecs := env.GetOrDefaultInt("AWS_POLLING_INTERVAL", 4)
 	return &Config{
 		MaxRetries:         env.GetOrDefaultInt("AWS_MAX_RETRIES", 5),
 		TTL:                env.GetOrDefaultInt("AWS_TTL", 10),
-		PropagationTimeout: time.Second * time.Duration(propagationMins),
-		PollingInterval:    time.Second * time.Duration(intervalSecs),
+		PropagationTimeout: env.GetOrDefaultSecond("AWS_PROPAGATION_TIMEOUT", defaultPropagationTimeout),
+		PollingInterval:    env.GetOrDefaultSecond("AWS_POLLING_INTERVAL", defaultPollingInterval),
 		HostedZoneID:       os.Getenv("AWS_HOSTED_ZONE_ID"),
 	}
 }
@@ -110,21 +134,21 @@ func NewDNSProviderConfig(config *Config) (*DNSProvider, error) {
 }
 
 // Timeout returns the timeout and interval to use when checking for DNS
-// propagation.
+// propagation, set with AWS_PROPAGATION_TIMEOUT and AWS_POLLING_INTERVAL.
 func (r *DNSProvider) Timeout() (timeout, interval time.Duration) {
 	return r.config.PropagationTimeout, r.config.PollingInterval
 }
 
 // Present creates a TXT record using the specified parameters
 func (r *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
 	value = `"` + value + `"`
 	return r.changeRecord("UPSERT", fqdn, value, r.config.TTL)
 }
 
 // CleanUp removes the TXT record matching the specified parameters
 func (r *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
 	value = `"` + value + `"`
 	return r.changeRecord("DELETE", fqdn, value, r.config.TTL)
 }
@@ -135,7 +159,10 @@ func (r *DNSProvider) changeRecord(action, fqdn, value string, ttl int) error {
 		return fmt.Errorf("failed to determine Route 53 hosted zone ID: %v", err)
 	}
 
-	recordSet := newTXTRecordSet(fqdn, value, ttl)
+	return r.changeRecordSet(hostedZoneID, action, newTXTRecordSet(fqdn, value, ttl))
+}
+
+func (r *DNSProvider) changeRecordSet(hostedZoneID, action string, recordSet *route53.ResourceRecordSet) error {
 	reqParams := &route53.ChangeResourceRecordSetsInput{
 		HostedZoneId: aws.String(hostedZoneID),
 		ChangeBatch: &route53.ChangeBatch{
@@ -156,7 +183,7 @@ func (r *DNSProvider) changeRecord(action, fqdn, value string, ttl int) error {
 
 	statusID := resp.ChangeInfo.Id
 
-	return acme.WaitFor(r.config.PropagationTimeout, r.config.PollingInterval, func() (bool, error) {
+	return wait.For(context.Background(), r.config.PropagationTimeout, r.config.PollingInterval, func() (bool, error) {
 		reqParams := &route53.GetChangeInput{
 			Id: statusID,
 		}
@@ -171,6 +198,89 @@ func (r *DNSProvider) changeRecord(action, fqdn, value string, ttl int) error {
 	})
 }
 
+// ListChallengeRecords returns the values of the _acme-challenge TXT record sets of the hosted zone of domain.
+// Route 53 does not tell the creation time of the records.
+func (r *DNSProvider) ListChallengeRecords(domain string) ([]acme.ChallengeRecord, error) {
+	hostedZoneID, err := r.getHostedZoneID(acme.ToFqdn(domain))
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine Route 53 hosted zone ID: %v", err)
+	}
+
+	recordSets, err := r.listChallengeRecordSets(hostedZoneID)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []acme.ChallengeRecord
+	for _, recordSet := range recordSets {
+		for _, rr := range recordSet.ResourceRecords {
+			records = append(records, acme.ChallengeRecord{
+				FQDN:  aws.StringValue(recordSet.Name),
+				Value: strings.Trim(aws.StringValue(rr.Value), `"`),
+				ID:    hostedZoneID,
+			})
+		}
+	}
+
+	return records, nil
+}
+
+// DeleteChallengeRecord deletes a record returned by ListChallengeRecords:
+// the record set is deleted with its last value, otherwise it keeps the other values.
+func (r *DNSProvider) DeleteChallengeRecord(record acme.ChallengeRecord) error {
+	recordSets, err := r.listChallengeRecordSets(record.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, recordSet := range recordSets {
+		if aws.StringValue(recordSet.Name) != record.FQDN {
+			continue
+		}
+
+		var remaining []*route53.ResourceRecord
+		for _, rr := range recordSet.ResourceRecords {
+			if strings.Trim(aws.StringValue(rr.Value), `"`) != record.Value {
+				remaining = append(remaining, rr)
+			}
+		}
+		if len(remaining) == len(recordSet.ResourceRecords) {
+			break
+		}
+
+		if len(remaining) == 0 {
+			return r.changeRecordSet(record.ID, "DELETE", recordSet)
+		}
+
+		recordSet.ResourceRecords = remaining
+		return r.changeRecordSet(record.ID, "UPSERT", recordSet)
+	}
+
+	return fmt.Errorf("no existing record found for %s %q", record.FQDN, record.Value)
+}
+
+// listChallengeRecordSets returns the _acme-challenge TXT record sets of the hosted zone.
+func (r *DNSProvider) listChallengeRecordSets(hostedZoneID string) ([]*route53.ResourceRecordSet, error) {
+	var recordSets []*route53.ResourceRecordSet
+
+	reqParams := &route53.ListResourceRecordSetsInput{
+		HostedZoneId: aws.String(hostedZoneID),
+	}
+	err := r.client.ListResourceRecordSetsPages(reqParams, func(resp *route53.ListResourceRecordSetsOutput, lastPage bool) bool {
+		for _, recordSet := range resp.ResourceRecordSets {
+			if aws.StringValue(recordSet.Type) == route53.RRTypeTxt && strings.HasPrefix(aws.StringValue(recordSet.Name), "_acme-challenge.") {
+				recordSets = append(recordSets, recordSet)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Route 53 record sets: %v", err)
+	}
+
+	return recordSets, nil
+}
+
 func (r *DNSProvider) getHostedZoneID(fqdn string) (string, error) {
 	if r.config.HostedZoneID != "" {
 		return r.config.HostedZoneID, nil
@@ -11,6 +11,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/route53"
 	"github.com/stretchr/testify/assert"
+	"github.com/xenolf/lego/acme"
 )
 
 var (
@@ -140,3 +141,32 @@ func TestRoute53Present(t *testing.T) {
 	err := provider.Present(domain, "", keyAuth)
 	assert.NoError(t, err, "Expected Present to return no error")
 }
+
+func TestRoute53ListChallengeRecords(t *testing.T) {
+	mockResponses := MockResponseMap{
+		"/2013-04-01/hostedzone/ABCDEFG/rrset":  MockResponse{StatusCode: 200, Body: ListResourceRecordSetsResponse},
+		"/2013-04-01/hostedzone/ABCDEFG/rrset/": MockResponse{StatusCode: 200, Body: ChangeResourceRecordSetsResponse},
+		"/2013-04-01/change/123456":             MockResponse{StatusCode: 200, Body: GetChangeResponse},
+	}
+
+	ts := newMockServer(t, mockResponses)
+	defer ts.Close()
+
+	provider := makeRoute53Provider(ts)
+	provider.config.HostedZoneID = "ABCDEFG"
+
+	records, err := provider.ListChallengeRecords("example.com")
+	assert.NoError(t, err, "Expected ListChallengeRecords to return no error")
+
+	expected := []acme.ChallengeRecord{
+		{FQDN: "_acme-challenge.example.com.", Value: "first", ID: "ABCDEFG"},
+		{FQDN: "_acme-challenge.example.com.", Value: "second", ID: "ABCDEFG"},
+	}
+	assert.Equal(t, expected, records)
+
+	err = provider.DeleteChallengeRecord(records[1])
+	assert.NoError(t, err, "Expected DeleteChallengeRecord to return no error")
+
+	err = provider.DeleteChallengeRecord(acme.ChallengeRecord{FQDN: "_acme-challenge.example.com.", Value: "unknown", ID: "ABCDEFG"})
+	assert.Error(t, err, "Expected DeleteChallengeRecord to fail for an unknown record")
+}
@@ -7,16 +7,32 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/sacloud/libsacloud/api"
 	"github.com/sacloud/libsacloud/sacloud"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the access token of SakuraCloud and its secret.
+var Documentation = env.Documentation{
+	Name:        "sakuracloud",
+	Description: "SakuraCloud DNS",
+	URL:         "https://developer.sakura.ad.jp/cloud/api/1.1/",
+	Required: []env.Var{
+		{Name: "SAKURACLOUD_ACCESS_TOKEN", Description: "The access token"},
+		{Name: "SAKURACLOUD_ACCESS_TOKEN_SECRET", Description: "The access token secret"},
+	},
+	Optional: env.PropagationVars("SAKURACLOUD", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval),
+}
+
 // DNSProvider is an implementation of the acme.ChallengeProvider interface.
 type DNSProvider struct {
-	client *api.Client
+	client             *api.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for sakuracloud.
@@ -43,12 +59,23 @@ func NewDNSProviderCredentials(token, secret string) (*DNSProvider, error) {
 	client := api.NewClient(token, secret, "tk1a")
 	client.UserAgent = acme.UserAgent
 
-	return &DNSProvider{client: client}, nil
+	return &DNSProvider{
+		client:             client,
+		propagationTimeout: env.GetOrDefaultSecond("SAKURACLOUD_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("SAKURACLOUD_POLLING_INTERVAL", acme.DefaultPollingInterval),
+	}, nil
+}
+
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with SAKURACLOUD_PROPAGATION_TIMEOUT and SAKURACLOUD_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
 }
 
 // Present creates a TXT record to fulfil the dns-01 challenge.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 
 	zone, err := d.getHostedZone(domain)
 	if err != nil {
@@ -68,7 +95,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters.
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	zone, err := d.getHostedZone(domain)
 	if err != nil {
@@ -9,13 +9,34 @@ import (
 	"time"
 
 	vegaClient "github.com/OpenDNS/vegadns2client"
-	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+const (
+	defaultPropagationTimeout = 12 * time.Minute
+	defaultPollingInterval    = 1 * time.Minute
+)
+
+// Documentation lists the URL of the VegaDNS API and its credentials.
+var Documentation = env.Documentation{
+	Name:        "vegadns",
+	Description: "VegaDNS",
+	URL:         "https://github.com/shupp/VegaDNS-API",
+	Required: []env.Var{
+		{Name: "VEGADNS_URL", Description: "The URL of the API"},
+	},
+	Optional: append([]env.Var{
+		{Name: "SECRET_VEGADNS_KEY", Description: "The API key"},
+		{Name: "SECRET_VEGADNS_SECRET", Description: "The API secret"},
+	}, env.PropagationVars("VEGADNS", defaultPropagationTimeout, defaultPollingInterval)...),
+}
+
 // DNSProvider describes a provider for VegaDNS
 type DNSProvider struct {
-	client vegaClient.VegaDNSClient
+	client             vegaClient.VegaDNSClient
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance configured for VegaDNS.
@@ -41,21 +62,22 @@ func NewDNSProviderCredentials(vegaDNSURL string, key string, secret string) (*D
 	vega.APISecret = secret
 
 	return &DNSProvider{
-		client: vega,
+		client:             vega,
+		propagationTimeout: env.GetOrDefaultSecond("VEGADNS_PROPAGATION_TIMEOUT", defaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("VEGADNS_POLLING_INTERVAL", defaultPollingInterval),
 	}, nil
 }
 
 // Timeout returns the timeout and interval to use when checking for DNS
 // propagation. Adjusting here to cope with spikes in propagation times.
+// VEGADNS_PROPAGATION_TIMEOUT and VEGADNS_POLLING_INTERVAL override them.
 func (r *DNSProvider) Timeout() (timeout, interval time.Duration) {
-	timeout = 12 * time.Minute
-	interval = 1 * time.Minute
-	return
+	return r.propagationTimeout, r.pollingInterval
 }
 
 // Present creates a TXT record to fulfil the dns-01 challenge
 func (r *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
 
 	_, domainID, err := r.client.GetAuthZone(fqdn)
 	if err != nil {
@@ -67,7 +89,7 @@ func (r *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters
 func (r *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	_, domainID, err := r.client.GetAuthZone(fqdn)
 	if err != nil {
@@ -6,15 +6,30 @@ package vultr
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	vultr "github.com/JamesClonk/vultr/lib"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/challenge/dns01"
 	"github.com/xenolf/lego/platform/config/env"
 )
 
+// Documentation lists the API key of Vultr.
+var Documentation = env.Documentation{
+	Name:        "vultr",
+	Description: "Vultr",
+	URL:         "https://www.vultr.com/api/#dns",
+	Required: []env.Var{
+		{Name: "VULTR_API_KEY", Description: "The API key"},
+	},
+	Optional: env.PropagationVars("VULTR", acme.DefaultPropagationTimeout, acme.DefaultPollingInterval),
+}
+
 // DNSProvider is an implementation of the acme.ChallengeProvider interface.
 type DNSProvider struct {
-	client *vultr.Client
+	client             *vultr.Client
+	propagationTimeout time.Duration
+	pollingInterval    time.Duration
 }
 
 // NewDNSProvider returns a DNSProvider instance with a configured Vultr client.
@@ -35,12 +50,23 @@ func NewDNSProviderCredentials(apiKey string) (*DNSProvider, error) {
 		return nil, fmt.Errorf("Vultr credentials missing")
 	}
 
-	return &DNSProvider{client: vultr.NewClient(apiKey, nil)}, nil
+	return &DNSProvider{
+		client:             vultr.NewClient(apiKey, nil),
+		propagationTimeout: env.GetOrDefaultSecond("VULTR_PROPAGATION_TIMEOUT", acme.DefaultPropagationTimeout),
+		pollingInterval:    env.GetOrDefaultSecond("VULTR_POLLING_INTERVAL", acme.DefaultPollingInterval),
+	}, nil
+}
+
+// Timeout returns the timeout and interval to use when checking for DNS propagation,
+// set with VULTR_PROPAGATION_TIMEOUT and VULTR_POLLING_INTERVAL.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.propagationTimeout, d.pollingInterval
 }
 
 // Present creates a TXT record to fulfil the DNS-01 challenge.
 func (d *DNSProvider) Present(domain, token, keyAuth string) error {
-	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+	ttl := dns01.DefaultTTL
 
 	zoneDomain, err := d.getHostedZone(domain)
 	if err != nil {
@@ -59,7 +85,7 @@ func (d *DNSProvider) Present(domain, token, keyAuth string) error {
 
 // CleanUp removes the TXT record matching the specified parameters.
 func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
 
 	zoneDomain, records, err := d.findTxtRecords(domain, fqdn)
 	if err != nil {
@@ -8,8 +8,12 @@ import (
 
 	"github.com/rainycape/memcache"
 	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/log"
 )
 
+// expiration is the lifetime of the keys, in seconds, removing them if CleanUp could not.
+const expiration = 300
+
 // HTTPProvider implements HTTPProvider for `http-01` challenge
 type HTTPProvider struct {
 	hosts []string
@@ -28,7 +32,8 @@ func NewMemcachedProvider(hosts []string) (*HTTPProvider, error) {
 	return c, nil
 }
 
-// Present makes the token available at `HTTP01ChallengePath(token)` by creating a file in the given webroot path
+// Present makes the token available at `HTTP01ChallengePath(token)` by storing the key authorization
+// in all the memcached hosts. It succeeds if at least one host stored it, the failing hosts are logged.
 func (w *HTTPProvider) Present(domain, token, keyAuth string) error {
 	var errs []error
 
@@ -39,22 +44,42 @@ func (w *HTTPProvider) Present(domain, token, keyAuth string) error {
 			errs = append(errs, err)
 			continue
 		}
-		_ = mc.Add(&memcache.Item{
+
+		err = mc.Set(&memcache.Item{
 			Key:        challengePath,
 			Value:      []byte(keyAuth),
-			Expiration: 60,
+			Expiration: expiration,
 		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", host, err))
+		}
 	}
 
 	if len(errs) == len(w.hosts) {
 		return fmt.Errorf("unable to store key in any of the memcache hosts -> %v", errs)
 	}
+	for _, err := range errs {
+		log.Warnf("[%s] memcached: could not store the key: %v", domain, err)
+	}
 
 	return nil
 }
 
-// CleanUp removes the file created for the challenge
+// CleanUp removes the key of the challenge from the memcached hosts.
+// It never fails: the keys which could not be deleted expire anyway.
 func (w *HTTPProvider) CleanUp(domain, token, keyAuth string) error {
-	// Memcached will clean up itself, that's what expiration is for.
+	challengePath := path.Join("/", acme.HTTP01ChallengePath(token))
+	for _, host := range w.hosts {
+		mc, err := memcache.New(host)
+		if err != nil {
+			log.Warnf("[%s] memcached: could not delete the key from %s: %v", domain, host, err)
+			continue
+		}
+
+		if err = mc.Delete(challengePath); err != nil && err != memcache.ErrCacheMiss {
+			log.Warnf("[%s] memcached: could not delete the key from %s: %v", domain, host, err)
+		}
+	}
+
 	return nil
 }
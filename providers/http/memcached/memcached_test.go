@@ -1,9 +1,13 @@
 package memcached
 
 import (
+	"encoding/binary"
+	"io"
+	"net"
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/rainycape/memcache"
@@ -109,3 +113,128 @@ func TestMemcachedCleanup(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NoError(t, p.CleanUp(domain, token, keyAuth))
 }
+
+// fakeMemcached is a memcached server of the binary protocol, implementing only set and delete.
+type fakeMemcached struct {
+	listener net.Listener
+	mu       sync.Mutex
+	items    map[string][]byte
+}
+
+func newFakeMemcached(t *testing.T) *fakeMemcached {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeMemcached{listener: listener, items: make(map[string][]byte)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeMemcached) Close() { f.listener.Close() }
+
+func (f *fakeMemcached) Addr() string { return f.listener.Addr().String() }
+
+func (f *fakeMemcached) item(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, ok := f.items[key]
+	return value, ok
+}
+
+func (f *fakeMemcached) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		header := make([]byte, 24)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header[8:12]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+
+		extrasLength := int(header[4])
+		keyLength := int(binary.BigEndian.Uint16(header[2:4]))
+		key := string(body[extrasLength : extrasLength+keyLength])
+
+		var status uint16
+		f.mu.Lock()
+		switch header[1] {
+		case 0x01: // set
+			f.items[key] = body[extrasLength+keyLength:]
+		case 0x04: // delete
+			if _, ok := f.items[key]; !ok {
+				status = 0x01
+			}
+			delete(f.items, key)
+		default:
+			status = 0x81
+		}
+		f.mu.Unlock()
+
+		response := make([]byte, 24)
+		response[0] = 0x81
+		response[1] = header[1]
+		binary.BigEndian.PutUint16(response[6:8], status)
+		if _, err := conn.Write(response); err != nil {
+			return
+		}
+	}
+}
+
+func TestMemcachedFakeHosts(t *testing.T) {
+	server1 := newFakeMemcached(t)
+	defer server1.Close()
+	server2 := newFakeMemcached(t)
+	defer server2.Close()
+
+	// a closed port, refusing the connections.
+	down := newFakeMemcached(t)
+	down.Close()
+
+	p, err := NewMemcachedProvider([]string{server1.Addr(), down.Addr(), server2.Addr()})
+	assert.NoError(t, err)
+
+	challengePath := path.Join("/", acme.HTTP01ChallengePath(token))
+
+	assert.NoError(t, p.Present(domain, token, keyAuth))
+	for _, server := range []*fakeMemcached{server1, server2} {
+		value, ok := server.item(challengePath)
+		assert.True(t, ok, "the key was not stored on %s", server.Addr())
+		assert.Equal(t, []byte(keyAuth), value)
+	}
+
+	// the key is replaced by a new challenge with the same token.
+	assert.NoError(t, p.Present(domain, token, "baz"))
+	value, _ := server1.item(challengePath)
+	assert.Equal(t, []byte("baz"), value)
+
+	assert.NoError(t, p.CleanUp(domain, token, keyAuth))
+	for _, server := range []*fakeMemcached{server1, server2} {
+		_, ok := server.item(challengePath)
+		assert.False(t, ok, "the key was not deleted on %s", server.Addr())
+	}
+
+	// the removed keys are not an error.
+	assert.NoError(t, p.CleanUp(domain, token, keyAuth))
+}
+
+func TestMemcachedFakeHostsAllDown(t *testing.T) {
+	down := newFakeMemcached(t)
+	down.Close()
+
+	p, err := NewMemcachedProvider([]string{down.Addr()})
+	assert.NoError(t, err)
+	assert.Error(t, p.Present(domain, token, keyAuth))
+}
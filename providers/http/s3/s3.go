@@ -0,0 +1,167 @@
+// Package s3 implements a HTTP provider for solving the HTTP-01 challenge
+// by uploading the key authorization to an S3 bucket served over HTTP, e.g. as a bucket website behind a load balancer.
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/xenolf/lego/acme"
+	"github.com/xenolf/lego/platform/config/env"
+	"github.com/xenolf/lego/platform/s3client"
+	"github.com/xenolf/lego/platform/wait"
+)
+
+// aclNone is the value of S3_ACL sending no ACL, the objects being readable through the bucket policy.
+const aclNone = "none"
+
+// Config is used to configure the creation of the HTTPProvider
+type Config struct {
+	Bucket string
+	// Region is the region of the bucket, found from the bucket if empty.
+	Region string
+	// Endpoint is the URL of the S3 API, e.g. of a MinIO server, the one of AWS if empty.
+	Endpoint string
+	// PathStyle puts the bucket in the path of the URLs instead of in the host name.
+	PathStyle bool
+	// ACL is the canned ACL of the objects, none to rely on the bucket policy.
+	ACL string
+	// VerifyURL is the URL from which the objects are read before Present returns,
+	// http://<domain> if empty.
+	VerifyURL string
+	// VerifyTimeout is the time waited for the objects to be readable, they are not read if it is zero.
+	VerifyTimeout time.Duration
+	// Credentials are the AWS credentials, the ones of the standard chain if nil:
+	// the environment variables, the shared credentials file and the instance role.
+	Credentials *credentials.Credentials
+	HTTPClient  *http.Client
+}
+
+// NewDefaultConfig returns a default configuration for the HTTPProvider
+func NewDefaultConfig() *Config {
+	region := os.Getenv("S3_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+
+	return &Config{
+		Bucket:        os.Getenv("S3_BUCKET"),
+		Region:        region,
+		Endpoint:      os.Getenv("S3_ENDPOINT"),
+		PathStyle:     os.Getenv("S3_PATH_STYLE") == "true",
+		ACL:           os.Getenv("S3_ACL"),
+		VerifyURL:     os.Getenv("S3_VERIFY_URL"),
+		VerifyTimeout: env.GetOrDefaultSecond("S3_VERIFY_TIMEOUT", 30*time.Second),
+		HTTPClient:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// HTTPProvider implements ChallengeProvider for `http-01` challenge
+type HTTPProvider struct {
+	config *Config
+	client *s3client.Client
+}
+
+// NewHTTPProvider returns a HTTPProvider instance uploading to the bucket of the environment variable S3_BUCKET.
+func NewHTTPProvider() (*HTTPProvider, error) {
+	return NewHTTPProviderConfig(NewDefaultConfig())
+}
+
+// NewHTTPProviderConfig returns a HTTPProvider instance uploading to the bucket of the configuration.
+func NewHTTPProviderConfig(config *Config) (*HTTPProvider, error) {
+	if config == nil {
+		return nil, errors.New("s3: the configuration of the HTTP provider is nil")
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+
+	client, err := s3client.New(s3client.Config{
+		Bucket:      config.Bucket,
+		Region:      config.Region,
+		Endpoint:    config.Endpoint,
+		PathStyle:   config.PathStyle,
+		Credentials: config.Credentials,
+		HTTPClient:  config.HTTPClient,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3: %v", err)
+	}
+
+	return &HTTPProvider{config: config, client: client}, nil
+}
+
+// Present makes the token available at `HTTP01ChallengePath(token)` by uploading the key authorization to the bucket,
+// and waits until it can be read over HTTP.
+func (p *HTTPProvider) Present(domain, token, keyAuth string) error {
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain")
+	switch p.config.ACL {
+	case "":
+		header.Set("X-Amz-Acl", "public-read")
+	case aclNone:
+	default:
+		header.Set("X-Amz-Acl", p.config.ACL)
+	}
+
+	if _, err := p.client.Do(http.MethodPut, acme.HTTP01ChallengePath(token), nil, header, []byte(keyAuth)); err != nil {
+		return fmt.Errorf("s3: could not upload the challenge of %s: %v", domain, err)
+	}
+
+	if p.config.VerifyTimeout > 0 {
+		return p.verify(domain, token, keyAuth)
+	}
+	return nil
+}
+
+// CleanUp removes the object of the challenge from the bucket.
+func (p *HTTPProvider) CleanUp(domain, token, keyAuth string) error {
+	if _, err := p.client.Do(http.MethodDelete, acme.HTTP01ChallengePath(token), nil, nil, nil); err != nil {
+		return fmt.Errorf("s3: could not delete the challenge of %s: %v", domain, err)
+	}
+	return nil
+}
+
+// verify waits until the key authorization can be read from the URL requested by the CA,
+// so that a permission or a routing problem does not fail a validation attempt.
+func (p *HTTPProvider) verify(domain, token, keyAuth string) error {
+	base := p.config.VerifyURL
+	if base == "" {
+		base = "http://" + domain
+	}
+	challengeURL := strings.TrimSuffix(base, "/") + acme.HTTP01ChallengePath(token)
+
+	var lastErr error
+	err := wait.For(context.Background(), p.config.VerifyTimeout, time.Second, func() (bool, error) {
+		resp, err := p.config.HTTPClient.Get(challengeURL)
+		if err != nil {
+			lastErr = err
+			return false, nil
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		switch {
+		case err != nil:
+			lastErr = err
+		case resp.StatusCode != http.StatusOK:
+			lastErr = fmt.Errorf("%s returned %d", challengeURL, resp.StatusCode)
+		case strings.TrimSpace(string(body)) != keyAuth:
+			lastErr = fmt.Errorf("%s returned another key authorization", challengeURL)
+		default:
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("s3: the challenge of %s is not readable over HTTP: %v", domain, lastErr)
+	}
+	return nil
+}
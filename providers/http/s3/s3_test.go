@@ -0,0 +1,126 @@
+package s3
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is an S3 API with path-style addressing, storing the objects in memory.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]string
+	acls    map[string]string
+	// lengths are the Content-Length of the uploads, -1 for the chunked ones.
+	lengths map[string]int64
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=id/") {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		f.objects[r.URL.Path] = string(body)
+		f.acls[r.URL.Path] = r.Header.Get("X-Amz-Acl")
+		f.lengths[r.URL.Path] = r.ContentLength
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// website serves the objects of the bucket, like a bucket website.
+func (f *fakeS3) website(bucket string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		object, ok := f.objects["/"+bucket+r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(object))
+	})
+}
+
+func TestHTTPProvider(t *testing.T) {
+	storage := &fakeS3{objects: make(map[string]string), acls: make(map[string]string), lengths: make(map[string]int64)}
+	api := httptest.NewServer(storage)
+	defer api.Close()
+	website := httptest.NewServer(storage.website("bucket"))
+	defer website.Close()
+
+	provider, err := NewHTTPProviderConfig(&Config{
+		Bucket:        "bucket",
+		Region:        "eu-west-1",
+		Endpoint:      api.URL,
+		PathStyle:     true,
+		VerifyURL:     website.URL,
+		VerifyTimeout: 5 * time.Second,
+		Credentials:   credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	require.NoError(t, err)
+
+	key := "/bucket/.well-known/acme-challenge/token"
+
+	require.NoError(t, provider.Present("example.com", "token", "keyAuth"))
+	assert.Equal(t, "keyAuth", storage.objects[key])
+	assert.Equal(t, "public-read", storage.acls[key])
+	assert.EqualValues(t, len("keyAuth"), storage.lengths[key])
+
+	require.NoError(t, provider.CleanUp("example.com", "token", "keyAuth"))
+	assert.Empty(t, storage.objects)
+}
+
+func TestHTTPProviderNotReadable(t *testing.T) {
+	storage := &fakeS3{objects: make(map[string]string), acls: make(map[string]string), lengths: make(map[string]int64)}
+	api := httptest.NewServer(storage)
+	defer api.Close()
+	// the website of another bucket, never serving the object.
+	website := httptest.NewServer(storage.website("other"))
+	defer website.Close()
+
+	provider, err := NewHTTPProviderConfig(&Config{
+		Bucket:        "bucket",
+		Region:        "eu-west-1",
+		Endpoint:      api.URL,
+		PathStyle:     true,
+		ACL:           aclNone,
+		VerifyURL:     website.URL,
+		VerifyTimeout: 1500 * time.Millisecond,
+		Credentials:   credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	require.NoError(t, err)
+
+	err = provider.Present("example.com", "token", "keyAuth")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is not readable over HTTP")
+	assert.Equal(t, "", storage.acls["/bucket/.well-known/acme-challenge/token"])
+}
+
+func TestNewHTTPProviderConfig(t *testing.T) {
+	_, err := NewHTTPProviderConfig(nil)
+	assert.Error(t, err)
+
+	_, err = NewHTTPProviderConfig(&Config{})
+	assert.EqualError(t, err, "s3: the bucket is missing")
+
+	_, err = NewHTTPProviderConfig(&Config{Bucket: "bucket", Endpoint: "http://minio:9000", Credentials: credentials.AnonymousCredentials})
+	assert.EqualError(t, err, "s3: the region is missing, it is required with a custom endpoint")
+}
@@ -6,52 +6,128 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
 
 	"github.com/xenolf/lego/acme"
 )
 
+// Config is used to configure the creation of the HTTPProvider
+type Config struct {
+	// Paths are the webroots, the challenges being written to all of them.
+	Paths []string
+	// DirMode is the permissions of the directories created in the webroots, 0755 if zero.
+	DirMode os.FileMode
+}
+
 // HTTPProvider implements ChallengeProvider for `http-01` challenge
 type HTTPProvider struct {
-	path string
+	config *Config
+
+	// mu protects the directories created in the webroots, removed once empty.
+	mu      sync.Mutex
+	created map[string]bool
 }
 
 // NewHTTPProvider returns a HTTPProvider instance with a configured webroot path
 func NewHTTPProvider(path string) (*HTTPProvider, error) {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return nil, fmt.Errorf("Webroot path does not exist")
+	return NewHTTPProviderConfig(&Config{Paths: []string{path}})
+}
+
+// NewHTTPProviderConfig returns a HTTPProvider instance writing the challenges to the webroots of the configuration.
+func NewHTTPProviderConfig(config *Config) (*HTTPProvider, error) {
+	if config == nil || len(config.Paths) == 0 {
+		return nil, fmt.Errorf("No webroot path provided")
+	}
+
+	for _, path := range config.Paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil, fmt.Errorf("Webroot path %s does not exist", path)
+		}
 	}
 
-	c := &HTTPProvider{
-		path: path,
+	if config.DirMode == 0 {
+		config.DirMode = 0755
 	}
 
-	return c, nil
+	return &HTTPProvider{config: config, created: make(map[string]bool)}, nil
 }
 
-// Present makes the token available at `HTTP01ChallengePath(token)` by creating a file in the given webroot path
+// Present makes the token available at `HTTP01ChallengePath(token)` by creating a file in the given webroot paths.
+// It fails on the first webroot which cannot be written, removing the files already written.
 func (w *HTTPProvider) Present(domain, token, keyAuth string) error {
-	var err error
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	challengeFilePath := filepath.Join(w.path, acme.HTTP01ChallengePath(token))
-	err = os.MkdirAll(filepath.Dir(challengeFilePath), 0755)
-	if err != nil {
-		return fmt.Errorf("could not create required directories in webroot for HTTP challenge -> %v", err)
-	}
+	for i, path := range w.config.Paths {
+		challengeFilePath := filepath.Join(path, acme.HTTP01ChallengePath(token))
+		if err := w.mkdirAll(filepath.Dir(challengeFilePath)); err != nil {
+			w.remove(w.config.Paths[:i], token)
+			return fmt.Errorf("could not create required directories in webroot %s for HTTP challenge -> %v", path, err)
+		}
 
-	err = ioutil.WriteFile(challengeFilePath, []byte(keyAuth), 0644)
-	if err != nil {
-		return fmt.Errorf("could not write file in webroot for HTTP challenge -> %v", err)
+		if err := ioutil.WriteFile(challengeFilePath, []byte(keyAuth), 0644); err != nil {
+			w.remove(w.config.Paths[:i], token)
+			return fmt.Errorf("could not write file in webroot %s for HTTP challenge -> %v", path, err)
+		}
 	}
 
 	return nil
 }
 
-// CleanUp removes the file created for the challenge
+// CleanUp removes the file created for the challenge, and the directories created for it once empty.
 func (w *HTTPProvider) CleanUp(domain, token, keyAuth string) error {
-	err := os.Remove(filepath.Join(w.path, acme.HTTP01ChallengePath(token)))
-	if err != nil {
-		return fmt.Errorf("could not remove file in webroot after HTTP challenge -> %v", err)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.remove(w.config.Paths, token)
+}
+
+// mkdirAll creates the directory and its missing parents, recording the ones it created.
+func (w *HTTPProvider) mkdirAll(dir string) error {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); !os.IsNotExist(err) {
+			break
+		}
+		missing = append(missing, d)
 	}
 
+	if err := os.MkdirAll(dir, w.config.DirMode); err != nil {
+		return err
+	}
+
+	for _, d := range missing {
+		w.created[d] = true
+	}
+	return nil
+}
+
+// remove removes the challenge file of the token from the webroots,
+// and the directories created by the provider which are now empty.
+func (w *HTTPProvider) remove(paths []string, token string) error {
+	var errs []error
+	for _, path := range paths {
+		err := os.Remove(filepath.Join(path, acme.HTTP01ChallengePath(token)))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", path, err))
+		}
+	}
+
+	// the deepest directories first, a directory which is not empty is kept.
+	var dirs []string
+	for dir := range w.created {
+		dirs = append(dirs, dir)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		if err := os.Remove(dir); err == nil || os.IsNotExist(err) {
+			delete(w.created, dir)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("could not remove file in webroot after HTTP challenge -> %v", errs)
+	}
 	return nil
 }
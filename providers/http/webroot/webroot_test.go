@@ -3,6 +3,8 @@ package webroot
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -44,3 +46,84 @@ func TestHTTPProvider(t *testing.T) {
 		t.Errorf("Webroot provider CleanUp() error: got %v, want nil", err)
 	}
 }
+
+func TestHTTPProviderMultipleWebroots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-webroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the first webroot already has the challenge directory, the second has none.
+	existing := filepath.Join(dir, "existing")
+	if err = os.MkdirAll(filepath.Join(existing, ".well-known", "acme-challenge"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty")
+	if err = os.Mkdir(empty, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := NewHTTPProviderConfig(&Config{Paths: []string{existing, empty}, DirMode: 0750})
+	if err != nil {
+		t.Fatalf("Webroot provider error: got %v, want nil", err)
+	}
+
+	if err = provider.Present("domain", "token", "keyAuth"); err != nil {
+		t.Fatalf("Webroot provider present() error: got %v, want nil", err)
+	}
+	for _, webroot := range []string{existing, empty} {
+		data, err := ioutil.ReadFile(filepath.Join(webroot, ".well-known", "acme-challenge", "token"))
+		if err != nil || string(data) != "keyAuth" {
+			t.Errorf("Challenge file of %s: got %q (%v), want %q", webroot, data, err, "keyAuth")
+		}
+	}
+	info, err := os.Stat(filepath.Join(empty, ".well-known"))
+	if err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("Expected the created directory with the mode 0750, got %v (%v)", info, err)
+	}
+
+	if err = provider.CleanUp("domain", "token", "keyAuth"); err != nil {
+		t.Fatalf("Webroot provider CleanUp() error: got %v, want nil", err)
+	}
+	// the directories created by the provider are removed, not the others.
+	if _, err = os.Stat(filepath.Join(empty, ".well-known")); !os.IsNotExist(err) {
+		t.Errorf("Expected the created directories to be removed, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(existing, ".well-known", "acme-challenge")); err != nil {
+		t.Errorf("Expected the existing directories to be kept, got %v", err)
+	}
+}
+
+func TestHTTPProviderPresentFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-webroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a file in place of the .well-known directory of the second webroot.
+	broken := filepath.Join(dir, "broken")
+	if err = os.Mkdir(broken, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(broken, ".well-known"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := NewHTTPProviderConfig(&Config{Paths: []string{dir, broken}})
+	if err != nil {
+		t.Fatalf("Webroot provider error: got %v, want nil", err)
+	}
+
+	err = provider.Present("domain", "token", "keyAuth")
+	if err == nil {
+		t.Fatal("Expected an error for the webroot which cannot be written")
+	}
+	if got := err.Error(); !strings.Contains(got, broken) {
+		t.Errorf("Expected the webroot %s in the error, got %q", broken, got)
+	}
+	if _, err = os.Stat(filepath.Join(dir, ".well-known")); !os.IsNotExist(err) {
+		t.Errorf("Expected the challenge of the first webroot to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStorage stores the accounts in files, as the CLI does under <--path>/accounts:
+// <path>/<server host>/<email>/account.json holds the registration,
+// and <path>/<server host>/<email>/keys/<email>.key the PEM private key.
+// The registration file is only written once the account is registered.
+//
+// The new key of a key rollover is saved in <email>.key.new, and the replaced key is archived in <email>.key.old.
+// The files of a deactivated account are archived with the .deactivated suffix.
+type FileStorage struct {
+	path string
+}
+
+// NewFileStorage returns a FileStorage of the accounts under path.
+func NewFileStorage(path string) *FileStorage {
+	return &FileStorage{path: path}
+}
+
+// AccountPath returns the directory of the account of the server and email.
+func (s *FileStorage) AccountPath(server, email string) string {
+	return filepath.Join(s.path, ServerPath(server), email)
+}
+
+// AccountKeyPath returns the file of the private key of the account of the server and email.
+func (s *FileStorage) AccountKeyPath(server, email string) string {
+	return filepath.Join(s.AccountPath(server, email), "keys", email+".key")
+}
+
+// LoadAccount reads the account of the server and email.
+func (s *FileStorage) LoadAccount(server, email string) (*Account, error) {
+	keyBytes, err := ioutil.ReadFile(s.AccountKeyPath(server, email))
+	if os.IsNotExist(err) {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := DecodePrivateKey(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not load the private key of the account %s: %v", email, err)
+	}
+
+	account := &Account{Email: email}
+	accountBytes, err := ioutil.ReadFile(filepath.Join(s.AccountPath(server, email), "account.json"))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		if err = json.Unmarshal(accountBytes, account); err != nil {
+			return nil, fmt.Errorf("could not parse the file of the account %s: %v", email, err)
+		}
+	}
+
+	account.Key = key
+	return account, nil
+}
+
+// SaveAccount writes the private key of the account, and its registration if set.
+func (s *FileStorage) SaveAccount(server string, account *Account) error {
+	keyPath := s.AccountKeyPath(server, account.Email)
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return err
+	}
+
+	keyBytes, err := EncodePrivateKey(account.Key)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(keyPath, keyBytes, 0600); err != nil {
+		return err
+	}
+
+	if account.Registration == nil {
+		return nil
+	}
+
+	jsonBytes, err := json.MarshalIndent(account, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(s.AccountPath(server, account.Email), "account.json"), jsonBytes, 0600)
+}
+
+// SaveNewKey writes the new key of a key rollover in <email>.key.new.
+func (s *FileStorage) SaveNewKey(server, email string, key crypto.PrivateKey) error {
+	keyBytes, err := EncodePrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.AccountKeyPath(server, email)+".new", keyBytes, 0600)
+}
+
+// RemoveNewKey removes <email>.key.new.
+func (s *FileStorage) RemoveNewKey(server, email string) error {
+	return os.Remove(s.AccountKeyPath(server, email) + ".new")
+}
+
+// ReplaceKey moves the key of the account to <email>.key.old, and <email>.key.new to the key of the account.
+func (s *FileStorage) ReplaceKey(server, email string) error {
+	keyPath := s.AccountKeyPath(server, email)
+	if err := os.Rename(keyPath, keyPath+".old"); err != nil {
+		return fmt.Errorf("the old key could not be moved: %v. The new key is in %s", err, keyPath+".new")
+	}
+	if err := os.Rename(keyPath+".new", keyPath); err != nil {
+		return fmt.Errorf("the new key could not be moved: %v. The new key is in %s", err, keyPath+".new")
+	}
+	return nil
+}
+
+// ArchiveAccount renames the registration file and the key of the account with the .deactivated suffix.
+func (s *FileStorage) ArchiveAccount(server, email string) error {
+	for _, file := range []string{filepath.Join(s.AccountPath(server, email), "account.json"), s.AccountKeyPath(server, email)} {
+		if err := os.Rename(file, file+".deactivated"); err != nil {
+			return fmt.Errorf("%s could not be renamed: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// ServerPath returns the directory of the accounts of the server URL, named after its host.
+func ServerPath(server string) string {
+	srv, _ := url.Parse(server)
+	if srv == nil {
+		return ""
+	}
+	return strings.NewReplacer(":", "_", "/", string(os.PathSeparator)).Replace(srv.Host)
+}
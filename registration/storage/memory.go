@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"crypto"
+	"errors"
+	"sync"
+)
+
+// MemoryStorage stores the accounts in memory, e.g. for the tests or for short-lived processes
+// whose account is registered again on every run.
+// The replaced keys and the deactivated accounts are forgotten.
+type MemoryStorage struct {
+	mu       sync.Mutex
+	accounts map[string]Account
+	newKeys  map[string]crypto.PrivateKey
+}
+
+// NewMemoryStorage returns an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{accounts: make(map[string]Account), newKeys: make(map[string]crypto.PrivateKey)}
+}
+
+// LoadAccount returns a copy of the account of the server and email.
+func (s *MemoryStorage) LoadAccount(server, email string) (*Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[server+" "+email]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+	return &account, nil
+}
+
+// SaveAccount saves a copy of the account.
+func (s *MemoryStorage) SaveAccount(server string, account *Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accounts[server+" "+account.Email] = *account
+	return nil
+}
+
+// SaveNewKey keeps the new key of a key rollover until ReplaceKey or RemoveNewKey.
+func (s *MemoryStorage) SaveNewKey(server, email string, key crypto.PrivateKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.newKeys[server+" "+email] = key
+	return nil
+}
+
+// RemoveNewKey forgets the new key saved by SaveNewKey.
+func (s *MemoryStorage) RemoveNewKey(server, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.newKeys, server+" "+email)
+	return nil
+}
+
+// ReplaceKey replaces the key of the account with the new key saved by SaveNewKey.
+func (s *MemoryStorage) ReplaceKey(server, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := server + " " + email
+	account, ok := s.accounts[id]
+	if !ok {
+		return ErrAccountNotFound
+	}
+	key, ok := s.newKeys[id]
+	if !ok {
+		return errors.New("storage: no new key saved for the account")
+	}
+
+	account.Key = key
+	s.accounts[id] = account
+	delete(s.newKeys, id)
+	return nil
+}
+
+// ArchiveAccount forgets the account.
+func (s *MemoryStorage) ArchiveAccount(server, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := server + " " + email
+	if _, ok := s.accounts[id]; !ok {
+		return ErrAccountNotFound
+	}
+	delete(s.accounts, id)
+	return nil
+}
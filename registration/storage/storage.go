@@ -0,0 +1,123 @@
+// Package storage stores the ACME accounts, with their registration and their private key,
+// behind the AccountStorage interface: in files by default, as the CLI does, or in memory.
+// Other backends, e.g. a secrets manager, implement the same interface.
+package storage
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+
+	"github.com/xenolf/lego/acme"
+)
+
+// ErrAccountNotFound is returned by AccountStorage.LoadAccount for an account which is not stored.
+var ErrAccountNotFound = errors.New("storage: account not found")
+
+// Account is a stored ACME account. It implements acme.User.
+type Account struct {
+	Email        string                     `json:"email"`
+	Registration *acme.RegistrationResource `json:"registration"`
+	// Key is the private key of the account, stored apart from the registration.
+	Key crypto.PrivateKey `json:"-"`
+}
+
+// GetEmail returns the email address of the account.
+func (a *Account) GetEmail() string {
+	return a.Email
+}
+
+// GetRegistration returns the registration of the account, nil if it is not registered yet.
+func (a *Account) GetRegistration() *acme.RegistrationResource {
+	return a.Registration
+}
+
+// GetPrivateKey returns the private key of the account.
+func (a *Account) GetPrivateKey() crypto.PrivateKey {
+	return a.Key
+}
+
+// AccountStorage loads and saves the accounts, by the URL of the directory of their ACME server and by email.
+// An account with the same email may be registered with several servers.
+type AccountStorage interface {
+	// LoadAccount returns the account, ErrAccountNotFound if it is not stored.
+	// The registration of an account whose key is stored before its registration is nil.
+	LoadAccount(server, email string) (*Account, error)
+	// SaveAccount saves the account, with its key and its registration if set.
+	SaveAccount(server string, account *Account) error
+
+	// SaveNewKey saves the new key of a key rollover of the account, apart from its key, before the rollover:
+	// the new key is not lost if the rollover succeeds but the key of the account cannot be replaced.
+	SaveNewKey(server, email string, key crypto.PrivateKey) error
+	// RemoveNewKey removes the new key saved by SaveNewKey, once the rollover failed.
+	RemoveNewKey(server, email string) error
+	// ReplaceKey archives the key of the account and replaces it with the new key saved by SaveNewKey,
+	// once the rollover succeeded.
+	ReplaceKey(server, email string) error
+
+	// ArchiveAccount archives the registration and the key of a deactivated account,
+	// so that LoadAccount returns ErrAccountNotFound and a new account can be created with the same email.
+	ArchiveAccount(server, email string) error
+}
+
+// LoadOrCreateAccount returns the account stored for the server and email,
+// or a new unregistered account with a new P-384 EC key, saved before being returned.
+// created is true for a new account.
+func LoadOrCreateAccount(s AccountStorage, server, email string) (account *Account, created bool, err error) {
+	account, err = s.LoadAccount(server, email)
+	if err != ErrAccountNotFound {
+		return account, false, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, false, err
+	}
+
+	account = &Account{Email: email, Key: key}
+	if err = s.SaveAccount(server, account); err != nil {
+		return nil, false, err
+	}
+	return account, true, nil
+}
+
+// EncodePrivateKey encodes an RSA or EC private key in a PEM block.
+func EncodePrivateKey(privateKey crypto.PrivateKey) ([]byte, error) {
+	var pemKey pem.Block
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		pemKey = pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	case *ecdsa.PrivateKey:
+		keyBytes, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		pemKey = pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}
+	default:
+		return nil, errors.New("unknown private key type")
+	}
+
+	return pem.EncodeToMemory(&pemKey), nil
+}
+
+// DecodePrivateKey decodes the RSA or EC private key of the first PEM block of keyBytes.
+func DecodePrivateKey(keyBytes []byte) (crypto.PrivateKey, error) {
+	keyBlock, _ := pem.Decode(keyBytes)
+	if keyBlock == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch keyBlock.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(keyBlock.Bytes)
+	}
+
+	return nil, errors.New("unknown private key type")
+}
@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xenolf/lego/acme"
+)
+
+const server = "https://acme-v02.api.letsencrypt.org/directory"
+
+func testAccountStorage(t *testing.T, s AccountStorage) {
+	if _, err := s.LoadAccount(server, "foo@example.com"); err != ErrAccountNotFound {
+		t.Fatalf("Expected ErrAccountNotFound, got %v", err)
+	}
+
+	account, created, err := LoadOrCreateAccount(s, server, "foo@example.com")
+	if err != nil || !created {
+		t.Fatalf("Expected a new account, got %t (%v)", created, err)
+	}
+	if account.Registration != nil {
+		t.Errorf("Expected a new account to be unregistered, got %v", account.Registration)
+	}
+
+	// the key of the new account is saved before its registration.
+	loaded, created, err := LoadOrCreateAccount(s, server, "foo@example.com")
+	if err != nil || created {
+		t.Fatalf("Expected the stored account, got %t (%v)", created, err)
+	}
+	if !reflect.DeepEqual(loaded.Key, account.Key) {
+		t.Error("Expected the key of the stored account")
+	}
+
+	account.Registration = &acme.RegistrationResource{URI: "https://acme-v02.api.letsencrypt.org/acme/acct/1"}
+	if err = s.SaveAccount(server, account); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = s.LoadAccount(server, "foo@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Registration == nil || loaded.Registration.URI != account.Registration.URI || !reflect.DeepEqual(loaded.Key, account.Key) {
+		t.Errorf("Expected the registration and the key of the account, got %+v", loaded)
+	}
+
+	// the accounts are stored by server.
+	if _, err := s.LoadAccount("https://acme-staging-v02.api.letsencrypt.org/directory", "foo@example.com"); err != ErrAccountNotFound {
+		t.Errorf("Expected ErrAccountNotFound for another server, got %v", err)
+	}
+}
+
+func testAccountStorageRollover(t *testing.T, s AccountStorage) {
+	account, _, err := LoadOrCreateAccount(s, server, "foo@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed rollover keeps the key.
+	newKey, err := acme.GeneratePrivateKey(acme.EC256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.SaveNewKey(server, "foo@example.com", newKey); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.RemoveNewKey(server, "foo@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := s.LoadAccount(server, "foo@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Key, account.Key) {
+		t.Error("Expected the key of the account to be kept")
+	}
+
+	if err = s.SaveNewKey(server, "foo@example.com", newKey); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.ReplaceKey(server, "foo@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = s.LoadAccount(server, "foo@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Key, newKey) {
+		t.Error("Expected the new key of the account")
+	}
+}
+
+func testAccountStorageArchive(t *testing.T, s AccountStorage) {
+	account, _, err := LoadOrCreateAccount(s, server, "foo@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	account.Registration = &acme.RegistrationResource{URI: "https://acme-v02.api.letsencrypt.org/acme/acct/1"}
+	if err = s.SaveAccount(server, account); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.ArchiveAccount(server, "foo@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.LoadAccount(server, "foo@example.com"); err != ErrAccountNotFound {
+		t.Errorf("Expected ErrAccountNotFound for an archived account, got %v", err)
+	}
+}
+
+func TestFileStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewFileStorage(dir)
+	testAccountStorage(t, s)
+
+	// the layout of the CLI.
+	accountPath := filepath.Join(dir, "acme-v02.api.letsencrypt.org", "foo@example.com")
+	for _, file := range []string{"account.json", filepath.Join("keys", "foo@example.com.key")} {
+		info, err := os.Stat(filepath.Join(accountPath, file))
+		if err != nil {
+			t.Errorf("Expected %s to be written: %v", file, err)
+			continue
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected %s to be only readable by its owner, got %v", file, info.Mode())
+		}
+	}
+}
+
+func TestFileStorageRollover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testAccountStorageRollover(t, NewFileStorage(dir))
+
+	keysPath := filepath.Join(dir, "acme-v02.api.letsencrypt.org", "foo@example.com", "keys")
+	if _, err := os.Stat(filepath.Join(keysPath, "foo@example.com.key.old")); err != nil {
+		t.Errorf("Expected the old key to be archived: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(keysPath, "foo@example.com.key.new")); !os.IsNotExist(err) {
+		t.Errorf("Expected the new key to be moved, got %v", err)
+	}
+}
+
+func TestFileStorageArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testAccountStorageArchive(t, NewFileStorage(dir))
+
+	accountPath := filepath.Join(dir, "acme-v02.api.letsencrypt.org", "foo@example.com")
+	for _, file := range []string{"account.json", filepath.Join("keys", "foo@example.com.key")} {
+		if _, err := os.Stat(filepath.Join(accountPath, file+".deactivated")); err != nil {
+			t.Errorf("Expected %s to be archived: %v", file, err)
+		}
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testAccountStorage(t, NewMemoryStorage())
+	testAccountStorageRollover(t, NewMemoryStorage())
+	testAccountStorageArchive(t, NewMemoryStorage())
+
+	if err := NewMemoryStorage().ReplaceKey(server, "foo@example.com"); err != ErrAccountNotFound {
+		t.Errorf("Expected ErrAccountNotFound, got %v", err)
+	}
+}
+
+func TestEncodePrivateKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []interface{}{ecKey, rsaKey} {
+		keyBytes, err := EncodePrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodePrivateKey(keyBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, key) {
+			t.Errorf("Expected the decoded key to be the %T key", key)
+		}
+	}
+
+	if _, err := DecodePrivateKey([]byte("key")); err == nil {
+		t.Error("Expected an error without PEM block")
+	}
+}